@@ -0,0 +1,464 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"sbrain/pkg/client"
+	"sbrain/store"
+)
+
+const (
+	// agentMaxLine is the longest line the agent buffers; a longer one is
+	// shipped in pieces.
+	agentMaxLine    = 256 << 10
+	agentMaxBatch   = 1000
+	agentMaxBackoff = time.Minute
+)
+
+// agentLevels maps the level names applications log with to sbrain's.
+var agentLevels = map[string]string{
+	"trace": "debug", "debug": "debug",
+	"info": "info", "information": "info", "notice": "info",
+	"warn": "warn", "warning": "warn",
+	"error": "error", "err": "error",
+	"fatal": "fatal", "critical": "fatal", "crit": "fatal", "panic": "fatal", "emerg": "fatal", "alert": "fatal",
+}
+
+// agentFields are the keys of a JSON line, or the named groups of --regex,
+// that fill a log's fields, by field. Other keys and groups go to the
+// metadata.
+var agentFields = map[string][]string{
+	"message":          {"message", "msg", "log", "text"},
+	"level":            {"level", "lvl", "severity"},
+	"occurred_at":      {"time", "ts", "timestamp", "@timestamp"},
+	"endpoint":         {"endpoint", "path", "url"},
+	"method":           {"method"},
+	"status_code":      {"status_code", "status"},
+	"response_time_ms": {"response_time_ms", "duration_ms", "latency_ms"},
+	"request_id":       {"request_id", "requestId", "trace_id"},
+	"ip":               {"ip", "client_ip", "remote_addr"},
+	"user_agent":       {"user_agent", "ua"},
+}
+
+// runAgentCommand implements "sbrain agent --tail <file> [flags]": it
+// follows log files, parses their new lines and ships them to the server's
+// POST /logs/batch, so applications that only write files get their logs
+// into sbrain unchanged.
+func runAgentCommand(args []string) error {
+	fs := newFlagSet("agent")
+	defaultURL := os.Getenv("SBRAIN_URL")
+	if defaultURL == "" {
+		defaultURL = "http://localhost:8080"
+	}
+	var files []string
+	fs.Func("tail", "file to follow; repeat for more files", func(v string) error {
+		files = append(files, v)
+		return nil
+	})
+	labels := map[string]string{}
+	fs.Func("label", "key=value label for every shipped log; repeatable", func(v string) error {
+		key, value, ok := strings.Cut(v, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return fmt.Errorf("label %q must be key=value", v)
+		}
+		labels[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		return nil
+	})
+	baseURL := fs.String("url", defaultURL, "server to ship to (default $SBRAIN_URL)")
+	token := fs.String("token", os.Getenv("SBRAIN_TOKEN"), "API key or token with the logs scope (default $SBRAIN_TOKEN)")
+	format := fs.String("format", "auto", "how lines are parsed: auto (JSON objects, else plain text), json, regex or plain")
+	pattern := fs.String("regex", "", "regular expression whose named groups (message, level, time, endpoint, status, ...) fill the log; implies --format regex")
+	level := fs.String("level", "info", "level of lines that carry none")
+	service := fs.String("service", "", "service of the shipped logs (default the token's service)")
+	fromStart := fs.Bool("from-start", false, "ship the lines already in the files, not only new ones")
+	batchSize := fs.Int("batch", 200, "most logs per request")
+	interval := fs.Duration("interval", 2*time.Second, "longest a line waits before it is shipped")
+	poll := fs.Duration("poll", 500*time.Millisecond, "how often the files are checked for new lines and rotation")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if len(files) == 0 {
+		return errors.New("agent: --tail is required")
+	}
+	if *pattern != "" && *format == "auto" {
+		*format = "regex"
+	}
+	parser := &agentParser{format: *format, level: *level, service: *service, labels: labels}
+	switch *format {
+	case "auto", "json", "plain":
+	case "regex":
+		if *pattern == "" {
+			return errors.New("agent: --format regex needs --regex")
+		}
+		re, err := regexp.Compile(*pattern)
+		if err != nil {
+			return fmt.Errorf("agent: --regex: %w", err)
+		}
+		parser.re = re
+	default:
+		return fmt.Errorf("agent: unknown --format %q", *format)
+	}
+	if _, ok := agentLevels[strings.ToLower(*level)]; !ok {
+		return fmt.Errorf("agent: unknown --level %q", *level)
+	}
+	parser.level = agentLevels[strings.ToLower(*level)]
+	switch {
+	case *batchSize < 1 || *batchSize > agentMaxBatch:
+		return fmt.Errorf("agent: --batch must be between 1 and %d", agentMaxBatch)
+	case *interval <= 0 || *poll <= 0:
+		return errors.New("agent: --interval and --poll must be positive")
+	}
+
+	c, err := client.New(*baseURL, client.Options{Token: *token})
+	if err != nil {
+		return err
+	}
+	tailers := make([]*agentTailer, len(files))
+	for i, path := range files {
+		tailers[i] = &agentTailer{path: path}
+		if err := tailers[i].open(*fromStart); err != nil {
+			return fmt.Errorf("agent: %w", err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	shipper := &agentShipper{client: c, batch: *batchSize, retryDelay: time.Second}
+	log.Printf("agent: following %s, shipping to %s", strings.Join(files, ", "), *baseURL)
+
+	pollTicker := time.NewTicker(*poll)
+	defer pollTicker.Stop()
+	flushTicker := time.NewTicker(*interval)
+	defer flushTicker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			// Ship what was read before exiting, giving up after a while
+			// rather than hanging on an unreachable server.
+			for _, t := range tailers {
+				t.flushPartial(func(line string) { shipper.add(parser.parse(line, t.path)) })
+				t.close()
+			}
+			flushCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			return shipper.flush(flushCtx)
+		case <-pollTicker.C:
+			for _, t := range tailers {
+				if err := t.poll(func(line string) { shipper.add(parser.parse(line, t.path)) }); err != nil {
+					log.Printf("agent: %s: %v", t.path, err)
+				}
+			}
+			if len(shipper.pending) < shipper.batch {
+				continue
+			}
+		case <-flushTicker.C:
+		}
+		if err := shipper.flush(ctx); err != nil && ctx.Err() == nil {
+			return err
+		}
+	}
+}
+
+// agentParser turns a line into a log.
+type agentParser struct {
+	format  string
+	re      *regexp.Regexp
+	level   string
+	service string
+	labels  map[string]string
+}
+
+// parse maps line, read from file, to a log. Lines that do not parse as the
+// format expects are shipped whole as the message, so nothing is lost.
+func (p *agentParser) parse(line, file string) client.Log {
+	fields := map[string]any{}
+	switch p.format {
+	case "auto", "json":
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "{") {
+			if err := json.Unmarshal([]byte(trimmed), &fields); err != nil {
+				fields = map[string]any{}
+			}
+		}
+	case "regex":
+		if match := p.re.FindStringSubmatch(line); match != nil {
+			for i, name := range p.re.SubexpNames() {
+				if name != "" && match[i] != "" {
+					fields[name] = match[i]
+				}
+			}
+		}
+	}
+	if len(fields) == 0 {
+		fields["message"] = line
+	}
+
+	l := client.Log{Level: p.level, Service: p.service, Labels: p.labels}
+	take := func(field string) (any, bool) {
+		for _, key := range agentFields[field] {
+			if v, ok := fields[key]; ok && v != nil {
+				delete(fields, key)
+				return v, true
+			}
+		}
+		return nil, false
+	}
+	text := func(field string) string {
+		v, _ := take(field)
+		if s, ok := v.(string); ok {
+			return s
+		}
+		if v != nil {
+			return fmt.Sprint(v)
+		}
+		return ""
+	}
+	number := func(field string) *int {
+		v, ok := take(field)
+		if !ok {
+			return nil
+		}
+		var n float64
+		switch v := v.(type) {
+		case float64:
+			n = v
+		case string:
+			var err error
+			if n, err = strconv.ParseFloat(v, 64); err != nil {
+				return nil
+			}
+		default:
+			return nil
+		}
+		i := int(n)
+		return &i
+	}
+
+	l.Message = text("message")
+	if level, ok := agentLevels[strings.ToLower(text("level"))]; ok {
+		l.Level = level
+	}
+	if v, ok := take("occurred_at"); ok {
+		l.OccurredAt = agentTimestamp(v)
+	}
+	l.Endpoint, l.Method = text("endpoint"), strings.ToUpper(text("method"))
+	l.RequestID, l.IP, l.UserAgent = text("request_id"), text("ip"), text("user_agent")
+	l.StatusCode, l.ResponseTimeMs = number("status_code"), number("response_time_ms")
+	if l.Message == "" {
+		l.Message = line
+	}
+	fields["file"] = file
+	metadata, _ := json.Marshal(fields)
+	l.Metadata = string(metadata)
+	return l
+}
+
+// agentTimestamp reads a line's time: RFC 3339 and the other layouts the
+// server accepts, or Unix seconds or milliseconds. Anything else is left
+// for the server to default to the time of ingestion.
+func agentTimestamp(v any) store.Timestamp {
+	switch v := v.(type) {
+	case string:
+		if ts, err := store.ParseTimestamp(v); err == nil {
+			return ts
+		}
+		if n, err := strconv.ParseFloat(v, 64); err == nil {
+			return agentTimestamp(n)
+		}
+	case float64:
+		if v > 1e12 {
+			return store.NewTimestamp(time.UnixMilli(int64(v)))
+		}
+		if v > 0 {
+			return store.NewTimestamp(time.Unix(0, int64(v*float64(time.Second))))
+		}
+	}
+	return ""
+}
+
+// agentTailer follows one file by polling it, like tail -F: when the file
+// is replaced (rotated by renaming) the rest of the old one is read before
+// the new one is opened from the start, and when it is truncated it is read
+// again from the start. Truncation is noticed by the file being shorter than
+// what was read, so a file truncated and refilled past that point between
+// two polls is not.
+type agentTailer struct {
+	path    string
+	file    *os.File
+	info    os.FileInfo
+	offset  int64
+	partial []byte
+}
+
+// open opens the file, at its end unless fromStart. A file that does not
+// exist yet is picked up by poll once it does.
+func (t *agentTailer) open(fromStart bool) error {
+	file, err := os.Open(t.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	t.file, t.info, t.offset, t.partial = file, info, 0, nil
+	if !fromStart {
+		if t.offset, err = file.Seek(0, io.SeekEnd); err != nil {
+			t.close()
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *agentTailer) close() {
+	if t.file != nil {
+		t.file.Close()
+		t.file = nil
+	}
+}
+
+// poll calls emit for every complete line written since the last poll,
+// handling rotation and truncation.
+func (t *agentTailer) poll(emit func(string)) error {
+	if t.file == nil {
+		// Not there at start, or rotated away: a new file is read whole.
+		if err := t.open(true); err != nil || t.file == nil {
+			return err
+		}
+	}
+	if err := t.read(emit); err != nil {
+		return err
+	}
+	info, err := os.Stat(t.path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		// Renamed and not yet recreated: keep the old file until it is.
+		return nil
+	case err != nil:
+		return err
+	case !os.SameFile(info, t.info):
+		t.flushPartial(emit)
+		t.close()
+		if err := t.open(true); err != nil {
+			return err
+		}
+		return t.read(emit)
+	case info.Size() < t.offset:
+		if _, err := t.file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		t.offset, t.partial = 0, nil
+		return t.read(emit)
+	}
+	return nil
+}
+
+// read reads the file to its current end.
+func (t *agentTailer) read(emit func(string)) error {
+	buf := make([]byte, 64<<10)
+	for {
+		n, err := t.file.Read(buf)
+		t.offset += int64(n)
+		data := buf[:n]
+		for len(data) > 0 {
+			i := bytes.IndexByte(data, '\n')
+			if i < 0 {
+				t.partial = append(t.partial, data...)
+				if len(t.partial) >= agentMaxLine {
+					t.flushPartial(emit)
+				}
+				break
+			}
+			t.partial = append(t.partial, data[:i]...)
+			t.flushPartial(emit)
+			data = data[i+1:]
+		}
+		if err == io.EOF || n == 0 {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// flushPartial emits the buffered line, unless it is blank.
+func (t *agentTailer) flushPartial(emit func(string)) {
+	line := strings.TrimRight(string(t.partial), "\r")
+	t.partial = t.partial[:0]
+	if strings.TrimSpace(line) != "" {
+		emit(line)
+	}
+}
+
+// agentShipper batches logs and sends them, retrying until the server
+// takes them.
+type agentShipper struct {
+	client *client.Client
+	batch  int
+	// retryDelay is the first wait after a failed request; it doubles up to
+	// agentMaxBackoff.
+	retryDelay time.Duration
+	pending    []client.Log
+}
+
+func (s *agentShipper) add(l client.Log) {
+	s.pending = append(s.pending, l)
+}
+
+// flush sends the pending logs, backing off while the server is
+// unreachable or failing. It gives up when ctx is done, and at once when
+// the token is refused; a batch the server refuses as malformed is
+// dropped. Retrying cannot help either.
+func (s *agentShipper) flush(ctx context.Context) error {
+	delay := s.retryDelay
+	for len(s.pending) > 0 {
+		batch := s.pending[:min(len(s.pending), s.batch)]
+		result, err := s.client.CreateLogs(ctx, batch)
+		if err == nil {
+			for _, rejected := range result.Rejected {
+				log.Printf("agent: server rejected a log: %+v", rejected.Fields)
+			}
+			s.pending = s.pending[len(batch):]
+			delay = s.retryDelay
+			continue
+		}
+		var apiErr *client.Error
+		if errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden) {
+			return fmt.Errorf("agent: %w", err)
+		}
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusBadRequest {
+			log.Printf("agent: server refused %d logs, dropping them: %v", len(batch), err)
+			s.pending = s.pending[len(batch):]
+			continue
+		}
+		log.Printf("agent: shipping %d logs failed, retrying in %s: %v", len(batch), delay, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, agentMaxBackoff)
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"sbrain/pkg/client"
+)
+
+func TestAgentParseJSON(t *testing.T) {
+	p := &agentParser{format: "auto", level: "info", service: "app", labels: map[string]string{"env": "prod"}}
+	l := p.parse(`{"lvl":"WARNING","msg":"upstream slow","ts":1718186400,"path":"/api/pay","method":"post","status":"502","latency_ms":1200,"order":42}`, "/var/log/app.log")
+	if l.Level != "warn" || l.Message != "upstream slow" || l.OccurredAt != "2024-06-12 10:00:00" ||
+		l.Endpoint != "/api/pay" || l.Method != "POST" || l.Service != "app" || l.Labels["env"] != "prod" {
+		t.Fatalf("log = %+v", l)
+	}
+	if l.StatusCode == nil || *l.StatusCode != 502 || l.ResponseTimeMs == nil || *l.ResponseTimeMs != 1200 {
+		t.Fatalf("status_code = %v, response_time_ms = %v", l.StatusCode, l.ResponseTimeMs)
+	}
+	var metadata map[string]any
+	if err := json.Unmarshal([]byte(l.Metadata), &metadata); err != nil || metadata["order"] != 42.0 || metadata["file"] != "/var/log/app.log" || len(metadata) != 2 {
+		t.Fatalf("metadata = %s (%v)", l.Metadata, err)
+	}
+
+	// Lines that are not JSON objects are shipped whole at the default level,
+	// as are levels sbrain does not know.
+	for _, line := range []string{"plain text", "{not json"} {
+		if l := p.parse(line, "app.log"); l.Message != line || l.Level != "info" {
+			t.Fatalf("parse(%q) = %+v", line, l)
+		}
+	}
+	if l := p.parse(`{"level":"loud","msg":"m"}`, "app.log"); l.Level != "info" {
+		t.Fatalf("unknown level = %q", l.Level)
+	}
+	if l := (&agentParser{format: "plain", level: "info"}).parse(`{"msg":"m"}`, "app.log"); l.Message != `{"msg":"m"}` {
+		t.Fatalf("plain format parsed JSON: %+v", l)
+	}
+}
+
+func TestAgentParseRegex(t *testing.T) {
+	p := &agentParser{format: "regex", level: "info",
+		re: regexp.MustCompile(`^(?P<time>\S+) (?P<level>\w+) \[(?P<worker>\w+)\] (?P<message>.*)$`)}
+	l := p.parse("2024-06-12T10:00:00Z ERROR [w3] job failed", "worker.log")
+	if l.Level != "error" || l.Message != "job failed" || l.OccurredAt != "2024-06-12 10:00:00" {
+		t.Fatalf("log = %+v", l)
+	}
+	if !strings.Contains(l.Metadata, `"worker":"w3"`) {
+		t.Fatalf("metadata = %s", l.Metadata)
+	}
+	if l := p.parse("garbage", "worker.log"); l.Message != "garbage" || l.Level != "info" {
+		t.Fatalf("unmatched line = %+v", l)
+	}
+}
+
+func TestAgentTailer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	write := func(name, text string, flag int) {
+		t.Helper()
+		f, err := os.OpenFile(name, flag|os.O_WRONLY|os.O_CREATE, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString(text)
+		f.Close()
+	}
+	tailer := &agentTailer{path: path}
+	defer tailer.close()
+	var lines []string
+	poll := func(want ...string) {
+		t.Helper()
+		lines = nil
+		if err := tailer.poll(func(line string) { lines = append(lines, line) }); err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(lines, want) {
+			t.Fatalf("lines = %q, want %q", lines, want)
+		}
+	}
+
+	write(path, "before the agent\n", os.O_TRUNC)
+	if err := tailer.open(false); err != nil {
+		t.Fatal(err)
+	}
+	poll()
+	write(path, "one\r\ntw", os.O_APPEND)
+	poll("one")
+	write(path, "o\n", os.O_APPEND)
+	poll("two")
+
+	// Rotated by renaming: the rest of the old file, then the new one.
+	write(path, "last of the old\n", os.O_APPEND)
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	poll("last of the old")
+	write(path, "first of the new\n", os.O_TRUNC)
+	poll("first of the new")
+
+	// Truncated in place: read again from the start.
+	write(path, "short\n", os.O_TRUNC)
+	poll("short")
+}
+
+func TestAgentShipperRetries(t *testing.T) {
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	var mu sync.Mutex
+	var batches [][]client.Log
+	status := []int{http.StatusBadGateway, http.StatusOK}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var batch []client.Log
+		json.NewDecoder(r.Body).Decode(&batch)
+		mu.Lock()
+		defer mu.Unlock()
+		batches = append(batches, batch)
+		code := status[min(len(batches), len(status))-1]
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		if code == http.StatusOK {
+			json.NewEncoder(w).Encode(client.LogBatchResult{Stored: len(batch)})
+		} else {
+			w.Write([]byte(`{"error":{"code":"bad_gateway","message":"try again"}}`))
+		}
+	}))
+	defer srv.Close()
+	c, err := client.New(srv.URL, client.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	shipper := &agentShipper{client: c, batch: 10, retryDelay: time.Millisecond}
+	shipper.add(client.Log{Message: "a"})
+	shipper.add(client.Log{Message: "b"})
+	if err := shipper.flush(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if len(batches) != 2 || len(shipper.pending) != 0 {
+		t.Fatalf("%d requests, %d pending", len(batches), len(shipper.pending))
+	}
+	for _, batch := range batches {
+		if len(batch) != 2 || batch[0].Message != "a" || batch[1].Message != "b" {
+			t.Fatalf("batch = %+v, want the same two logs each time", batch)
+		}
+	}
+
+	// A refused token stops the agent and keeps the logs.
+	status = []int{http.StatusUnauthorized}
+	batches = nil
+	shipper.add(client.Log{Message: "c"})
+	if err := shipper.flush(t.Context()); err == nil || len(shipper.pending) != 1 {
+		t.Fatalf("flush = %v, %d pending", err, len(shipper.pending))
+	}
+}
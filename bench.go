@@ -0,0 +1,359 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"sbrain/pkg/client"
+)
+
+// benchWords make up the synthetic titles, contexts and log messages.
+var benchWords = strings.Fields(`deploy cache index query latency retry timeout
+	migration schema backup replica token session worker queue batch export import
+	search tag project commit review release rollback incident alert metric trace`)
+
+var (
+	benchLevels    = []string{"debug", "info", "info", "info", "info", "warn", "error"}
+	benchEndpoints = []string{"/api/users", "/api/orders", "/api/search", "/healthz", "/api/login", "/api/export"}
+	benchMethods   = []string{"GET", "GET", "GET", "POST", "PUT", "DELETE"}
+)
+
+// benchOp is one kind of request the benchmark makes.
+type benchOp struct {
+	name   string
+	write  bool
+	weight int
+	run    func(b *benchRun, ctx context.Context, rng *rand.Rand) error
+}
+
+// benchOps are the requests of the run phase. Writes and reads are picked
+// by --writes; within each, by weight.
+var benchOps = []benchOp{
+	{"create_brain", true, 1, (*benchRun).createBrain},
+	{"create_log", true, 3, (*benchRun).createLog},
+	{"get_brain", false, 3, (*benchRun).getBrain},
+	{"list_brains", false, 1, (*benchRun).listBrains},
+	{"get_log", false, 3, (*benchRun).getLog},
+	{"list_logs", false, 3, (*benchRun).listLogs},
+}
+
+// benchRun is the state shared by the workers: the client, the project the
+// synthetic records go into, and the ids created so far for reads to use.
+type benchRun struct {
+	client  *client.Client
+	project string
+
+	mu       sync.Mutex
+	brainIDs []int64
+	logIDs   []int64
+}
+
+func (b *benchRun) createBrain(ctx context.Context, rng *rand.Rand) error {
+	created, err := b.client.CreateBrain(ctx, client.Brain{
+		Title:   benchSentence(rng, 3+rng.IntN(5)),
+		Context: benchSentence(rng, 20+rng.IntN(200)),
+		Project: b.project,
+		Tags:    strings.Join([]string{"bench", benchWords[rng.IntN(len(benchWords))]}, ","),
+	})
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	b.brainIDs = append(b.brainIDs, created.ID)
+	b.mu.Unlock()
+	return nil
+}
+
+func (b *benchRun) createLog(ctx context.Context, rng *rand.Rand) error {
+	status := []int{200, 200, 200, 201, 204, 400, 404, 500}[rng.IntN(8)]
+	// Response times are mostly fast with a long tail.
+	responseMs := int(rng.ExpFloat64()*40) + 1
+	created, err := b.client.CreateLog(ctx, client.Log{
+		Level:          benchLevels[rng.IntN(len(benchLevels))],
+		Message:        benchSentence(rng, 4+rng.IntN(12)),
+		Endpoint:       benchEndpoints[rng.IntN(len(benchEndpoints))],
+		Method:         benchMethods[rng.IntN(len(benchMethods))],
+		StatusCode:     &status,
+		ResponseTimeMs: &responseMs,
+		RequestID:      fmt.Sprintf("bench-%016x", rng.Uint64()),
+		Metadata:       fmt.Sprintf(`{"bench":true,"shard":%d}`, rng.IntN(16)),
+		Project:        b.project,
+	})
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	b.logIDs = append(b.logIDs, created.ID)
+	b.mu.Unlock()
+	return nil
+}
+
+func (b *benchRun) getBrain(ctx context.Context, rng *rand.Rand) error {
+	id, ok := b.pick(&b.brainIDs, rng)
+	if !ok {
+		return b.createBrain(ctx, rng)
+	}
+	_, err := b.client.GetBrain(ctx, id)
+	return err
+}
+
+func (b *benchRun) listBrains(ctx context.Context, rng *rand.Rand) error {
+	_, err := b.client.ListBrains(ctx, client.ListBrainsOptions{Project: b.project, Tag: benchWords[rng.IntN(len(benchWords))]})
+	return err
+}
+
+func (b *benchRun) getLog(ctx context.Context, rng *rand.Rand) error {
+	id, ok := b.pick(&b.logIDs, rng)
+	if !ok {
+		return b.createLog(ctx, rng)
+	}
+	_, err := b.client.GetLog(ctx, id)
+	return err
+}
+
+// listLogs lists one level and endpoint over the last minutes, the shape of
+// a dashboard query.
+func (b *benchRun) listLogs(ctx context.Context, rng *rand.Rand) error {
+	_, err := b.client.ListLogs(ctx, client.ListLogsOptions{
+		Level:    benchLevels[rng.IntN(len(benchLevels))],
+		Endpoint: benchEndpoints[rng.IntN(len(benchEndpoints))],
+		Since:    time.Now().Add(-5 * time.Minute),
+	})
+	return err
+}
+
+func (b *benchRun) pick(ids *[]int64, rng *rand.Rand) (int64, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(*ids) == 0 {
+		return 0, false
+	}
+	return (*ids)[rng.IntN(len(*ids))], true
+}
+
+func benchSentence(rng *rand.Rand, words int) string {
+	out := make([]string, words)
+	for i := range out {
+		out[i] = benchWords[rng.IntN(len(benchWords))]
+	}
+	return strings.Join(out, " ")
+}
+
+// benchStats collects the latencies of one operation in one phase.
+type benchStats struct {
+	mu        sync.Mutex
+	latencies []time.Duration
+	errors    int
+	lastError string
+}
+
+func (s *benchStats) record(d time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.errors++
+		s.lastError = err.Error()
+		return
+	}
+	s.latencies = append(s.latencies, d)
+}
+
+// benchResult is one row of the report.
+type benchResult struct {
+	Phase     string  `json:"phase"`
+	Operation string  `json:"operation"`
+	Count     int     `json:"count"`
+	Errors    int     `json:"errors"`
+	OpsPerSec float64 `json:"ops_per_sec"`
+	P50Ms     float64 `json:"p50_ms"`
+	P90Ms     float64 `json:"p90_ms"`
+	P99Ms     float64 `json:"p99_ms"`
+	MaxMs     float64 `json:"max_ms"`
+	LastError string  `json:"last_error,omitempty"`
+}
+
+func (s *benchStats) result(phase, operation string, elapsed time.Duration) benchResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	slices.Sort(s.latencies)
+	ms := func(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
+	percentile := func(p float64) float64 {
+		if len(s.latencies) == 0 {
+			return 0
+		}
+		return ms(s.latencies[int(p*float64(len(s.latencies)-1))])
+	}
+	r := benchResult{
+		Phase: phase, Operation: operation, Count: len(s.latencies), Errors: s.errors,
+		P50Ms: percentile(0.50), P90Ms: percentile(0.90), P99Ms: percentile(0.99), MaxMs: percentile(1),
+		LastError: s.lastError,
+	}
+	if elapsed > 0 {
+		r.OpsPerSec = float64(len(s.latencies)) / elapsed.Seconds()
+	}
+	return r
+}
+
+// runBenchCommand implements "sbrain bench": it seeds the server with
+// synthetic brain records and logs, then drives a mix of concurrent reads
+// and writes for a while and reports throughput and latency percentiles
+// per operation. Point it at a scratch server; everything it writes is in
+// --project.
+func runBenchCommand(args []string) error {
+	fs := newFlagSet("bench")
+	defaultURL := os.Getenv("SBRAIN_URL")
+	if defaultURL == "" {
+		defaultURL = "http://localhost:8080"
+	}
+	baseURL := fs.String("url", defaultURL, "server to benchmark (default $SBRAIN_URL)")
+	token := fs.String("token", os.Getenv("SBRAIN_TOKEN"), "API key or token (default $SBRAIN_TOKEN)")
+	brains := fs.Int("brains", 200, "synthetic brain records to create before the run")
+	logs := fs.Int("logs", 2000, "synthetic logs to create before the run")
+	duration := fs.Duration("duration", 30*time.Second, "how long to drive the mixed workload (0 seeds only)")
+	concurrency := fs.Int("concurrency", 8, "concurrent workers")
+	writes := fs.Float64("writes", 0.2, "fraction of the run's requests that are writes")
+	project := fs.String("project", "bench", "project the synthetic records are created in")
+	seed := fs.Uint64("seed", 1, "random seed, for repeatable data")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	switch {
+	case *brains < 0 || *logs < 0 || *duration < 0:
+		return errors.New("bench: --brains, --logs and --duration must not be negative")
+	case *concurrency < 1:
+		return errors.New("bench: --concurrency must be at least 1")
+	case *writes < 0 || *writes > 1:
+		return errors.New("bench: --writes must be between 0 and 1")
+	}
+	c, err := client.New(*baseURL, client.Options{Token: *token})
+	if err != nil {
+		return err
+	}
+	run := &benchRun{client: c, project: *project}
+	ctx := context.Background()
+
+	var results []benchResult
+	for _, step := range []struct {
+		op    string
+		count int
+		run   func(context.Context, *rand.Rand) error
+	}{{"create_brain", *brains, run.createBrain}, {"create_log", *logs, run.createLog}} {
+		stats := &benchStats{}
+		started := time.Now()
+		var next atomic.Int64
+		benchWorkers(*concurrency, *seed, func(rng *rand.Rand) bool {
+			if next.Add(1) > int64(step.count) {
+				return false
+			}
+			t := time.Now()
+			err := step.run(ctx, rng)
+			stats.record(time.Since(t), err)
+			return true
+		})
+		results = append(results, stats.result("seed", step.op, time.Since(started)))
+	}
+
+	if *duration > 0 {
+		runStats := map[string]*benchStats{}
+		for _, op := range benchOps {
+			runStats[op.name] = &benchStats{}
+		}
+		deadline := time.Now().Add(*duration)
+		started := time.Now()
+		benchWorkers(*concurrency, *seed+1, func(rng *rand.Rand) bool {
+			if time.Now().After(deadline) {
+				return false
+			}
+			op := pickBenchOp(rng, *writes)
+			t := time.Now()
+			err := op.run(run, ctx, rng)
+			runStats[op.name].record(time.Since(t), err)
+			return true
+		})
+		runElapsed := time.Since(started)
+		for _, op := range benchOps {
+			results = append(results, runStats[op.name].result("run", op.name, runElapsed))
+		}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	}
+	printBenchReport(os.Stdout, *baseURL, *concurrency, results)
+	return nil
+}
+
+// benchWorkers runs n workers, each with its own random source, calling
+// work until it returns false.
+func benchWorkers(n int, seed uint64, work func(rng *rand.Rand) bool) {
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rng := rand.New(rand.NewPCG(seed, uint64(i)))
+			for work(rng) {
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func pickBenchOp(rng *rand.Rand, writes float64) benchOp {
+	write := rng.Float64() < writes
+	total := 0
+	for _, op := range benchOps {
+		if op.write == write {
+			total += op.weight
+		}
+	}
+	n := rng.IntN(total)
+	for _, op := range benchOps {
+		if op.write != write {
+			continue
+		}
+		if n < op.weight {
+			return op
+		}
+		n -= op.weight
+	}
+	return benchOps[0]
+}
+
+func printBenchReport(out io.Writer, baseURL string, concurrency int, results []benchResult) {
+	fmt.Fprintf(out, "sbrain bench against %s with %d workers\n\n", baseURL, concurrency)
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "phase\toperation\tcount\terrors\tops/s\tp50 ms\tp90 ms\tp99 ms\tmax ms\t")
+	var failures []string
+	for _, r := range results {
+		if r.Count == 0 && r.Errors == 0 {
+			continue
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%.1f\t%.2f\t%.2f\t%.2f\t%.2f\t\n",
+			r.Phase, r.Operation, r.Count, r.Errors, r.OpsPerSec, r.P50Ms, r.P90Ms, r.P99Ms, r.MaxMs)
+		if r.LastError != "" {
+			failures = append(failures, fmt.Sprintf("%s %s: %s", r.Phase, r.Operation, r.LastError))
+		}
+	}
+	tw.Flush()
+	if len(failures) > 0 {
+		fmt.Fprintln(out, "\nlast errors:")
+		for _, f := range failures {
+			fmt.Fprintln(out, "  "+f)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"sbrain/pkg/sbrain"
+	"sbrain/store"
+)
+
+// runCommand dispatches "sbrain <command> [flags]". Running sbrain without a
+// command starts the HTTP server.
+func runCommand(name string, args []string) error {
+	switch name {
+	case "restore":
+		return runRestoreCommand(args)
+	case "note":
+		return runNoteCommand(args)
+	case "sync":
+		return runSyncCommand(args)
+	case "openapi":
+		return runOpenAPICommand(args)
+	case "bench":
+		return runBenchCommand(args)
+	case "seed":
+		return runSeedCommand(args)
+	case "export-site":
+		return runExportSiteCommand(args)
+	case "agent":
+		return runAgentCommand(args)
+	case "help", "-h", "--help":
+		printUsage()
+		return nil
+	default:
+		printUsage()
+		return fmt.Errorf("unknown command %q", name)
+	}
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, `usage: sbrain [command] [flags]
+
+Without a command sbrain starts the HTTP server.
+
+Commands:
+  restore   rebuild the database file from a replica directory
+  note      list, show, add or edit notes in the offline cache
+  sync      synchronize the offline cache with the server (--resolve to pick conflict winners)
+  openapi   print the OpenAPI document (--format json|yaml)
+  seed      fill the database with fake brain records and logs for development
+  export-site
+            write a static HTML copy of the brain records to a directory
+  bench     load a server with synthetic data and report throughput and latency
+  agent     follow log files (--tail) and ship their lines to a server`)
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	return flag.NewFlagSet("sbrain "+name, flag.ContinueOnError)
+}
+
+// runRestoreCommand implements "sbrain restore --from <dir> [-o path] [--force]".
+func runRestoreCommand(args []string) error {
+	fs := newFlagSet("restore")
+	from := fs.String("from", "", "replica directory written by SBRAIN_REPLICA_DIR")
+	output := fs.String("o", defaultDBPath(), "path of the database file to write")
+	force := fs.Bool("force", false, "overwrite the output file if it exists")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if strings.TrimSpace(*from) == "" {
+		return errors.New("restore: --from is required")
+	}
+	if _, err := os.Stat(*output); err == nil && !*force {
+		return fmt.Errorf("restore: %q already exists; pass --force to overwrite", *output)
+	}
+	return sbrain.RestoreReplica(*from, *output)
+}
+
+// runOpenAPICommand implements "sbrain openapi [--format json|yaml]".
+func runOpenAPICommand(args []string) error {
+	fs := newFlagSet("openapi")
+	format := fs.String("format", "json", "json or yaml")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	return sbrain.WriteOpenAPI(os.Stdout, *format)
+}
+
+// runSeedCommand implements "sbrain seed [--brains N] [--logs N] [--project P]
+// [--days N] [--seed N] [--db path]". It writes to the database file
+// directly, migrating it first, and refuses to run in production.
+func runSeedCommand(args []string) error {
+	fs := newFlagSet("seed")
+	dbPath := fs.String("db", defaultDBPath(), "database file to fill")
+	brains := fs.Int("brains", 1000, "brain records to create")
+	logs := fs.Int("logs", 100000, "logs to create")
+	project := fs.String("project", "", "put everything in this project (default: several made-up ones)")
+	days := fs.Int("days", 90, "how many days back the timestamps reach")
+	seed := fs.Uint64("seed", 1, "random seed, for repeatable data")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if isProductionRuntime() {
+		return errors.New("seed: refusing to fill a production database with fake data")
+	}
+	server, err := sbrain.New(sbrain.Options{DBPath: *dbPath, Migrate: true, SkipSelfTest: true})
+	if err != nil {
+		return err
+	}
+	defer server.Close()
+	result, err := server.Seed(context.Background(), sbrain.SeedOptions{
+		Brains: *brains, Logs: *logs, Project: *project, Days: *days, Seed: *seed,
+		Progress: func(step string, done, total int) {
+			fmt.Fprintf(os.Stderr, "\r%s: %d/%d", step, done, total)
+			if done == total {
+				fmt.Fprintln(os.Stderr)
+			}
+		},
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("seeded %s with %d brain records and %d logs since %s in %s\n",
+		*dbPath, result.Brains, result.Logs, result.Since, result.Took)
+	return nil
+}
+
+// runExportSiteCommand implements "sbrain export-site [-o dir] [--project P]
+// [--tag T] [--db path]". It opens the database file read-only, so it works
+// on a copy or a restored replica without a running server and never
+// changes it.
+func runExportSiteCommand(args []string) error {
+	fs := newFlagSet("export-site")
+	dbPath := fs.String("db", defaultDBPath(), "database file to read")
+	output := fs.String("o", "site", "directory to write the site to")
+	project := fs.String("project", "", "only records in this project")
+	tag := fs.String("tag", "", "only records with this tag")
+	archived := fs.Bool("archived", false, "include archived records")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	server, err := sbrain.New(sbrain.Options{DBPath: *dbPath, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer server.Close()
+	filter := store.BrainFilter{Project: *project, Tag: *tag}
+	if !*archived {
+		filter.Archived = new(bool)
+	}
+	n, err := server.ExportSite(context.Background(), filter, *output)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("wrote %d records to %s\n", n, *output)
+	return nil
+}
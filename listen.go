@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// listenFDsStart is the first file descriptor systemd passes to a
+// socket-activated service.
+const listenFDsStart = 3
+
+// listen opens the listener the server accepts connections on: the socket
+// systemd passed when the service is socket-activated, otherwise addr,
+// which is host:port or unix:/path/to.sock. It also returns a description
+// of the listener for the startup log.
+func listen(addr string) (net.Listener, string, error) {
+	if ln, err := systemdListener(); ln != nil || err != nil {
+		if err != nil {
+			return nil, "", err
+		}
+		return ln, fmt.Sprintf("systemd socket %s", ln.Addr()), nil
+	}
+
+	path, ok := strings.CutPrefix(addr, "unix:")
+	if !ok {
+		ln, err := net.Listen("tcp", addr)
+		return ln, addr, err
+	}
+	if path == "" {
+		return nil, "", errors.New("SBRAIN_ADDR unix: needs a socket path")
+	}
+	mode := fs.FileMode(0o660)
+	if raw := os.Getenv("SBRAIN_SOCKET_MODE"); raw != "" {
+		n, err := strconv.ParseUint(raw, 8, 32)
+		if err != nil || n > 0o777 {
+			return nil, "", fmt.Errorf("invalid SBRAIN_SOCKET_MODE %q: expected octal permissions such as 660", raw)
+		}
+		mode = fs.FileMode(n)
+	}
+	// A socket left behind by a previous run that was not shut down cleanly
+	// would make the bind fail; anything else at the path is left alone.
+	if info, err := os.Lstat(path); err == nil && info.Mode().Type() == fs.ModeSocket {
+		if err := os.Remove(path); err != nil {
+			return nil, "", fmt.Errorf("remove stale socket %s: %w", path, err)
+		}
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		ln.Close()
+		return nil, "", fmt.Errorf("set permissions on %s: %w", path, err)
+	}
+	return ln, "unix socket " + path, nil
+}
+
+// systemdListener returns the socket passed through systemd's LISTEN_FDS
+// protocol, or nil when the process was not socket-activated. The
+// variables are cleared so processes the server starts do not take the
+// socket for theirs.
+func systemdListener() (net.Listener, error) {
+	pid, fds := os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS")
+	if fds == "" || pid != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	n, err := strconv.Atoi(fds)
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS %q", fds)
+	}
+	if n > 1 {
+		return nil, fmt.Errorf("systemd passed %d sockets; sbrain listens on exactly one", n)
+	}
+	f := os.NewFile(listenFDsStart, "systemd-socket")
+	defer f.Close()
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("systemd socket: %w", err)
+	}
+	return ln, nil
+}
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS digest_destinations (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    kind TEXT NOT NULL,
+    target TEXT NOT NULL,
+    send_at TEXT NOT NULL DEFAULT '18:00',
+    group_by_project INTEGER NOT NULL DEFAULT 0,
+    enabled INTEGER NOT NULL DEFAULT 1,
+    last_sent_on TEXT NOT NULL DEFAULT ''
+);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_audit_log_resource;
+DROP INDEX IF EXISTS idx_audit_log_created_at;
+DROP TABLE IF EXISTS audit_log;
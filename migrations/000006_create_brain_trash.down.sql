@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_brain_trash_deleted_at;
+DROP TABLE IF EXISTS brain_trash;
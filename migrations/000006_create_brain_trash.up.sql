@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS brain_trash (
+    id INTEGER PRIMARY KEY,
+    deleted_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    deleted_by TEXT NOT NULL DEFAULT '',
+    created_at TEXT NOT NULL,
+    title TEXT NOT NULL,
+    context TEXT NOT NULL,
+    project TEXT NOT NULL,
+    commits TEXT NOT NULL DEFAULT '',
+    tags TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_brain_trash_deleted_at
+    ON brain_trash (deleted_at);
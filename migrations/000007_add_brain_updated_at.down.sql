@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_brain_tombstones_deleted_at;
+DROP TABLE IF EXISTS brain_tombstones;
+ALTER TABLE brain_trash DROP COLUMN updated_at;
+DROP INDEX IF EXISTS idx_second_brain_updated_at;
+ALTER TABLE second_brain DROP COLUMN updated_at;
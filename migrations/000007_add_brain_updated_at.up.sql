@@ -0,0 +1,20 @@
+-- SQLite cannot add a column with a non-constant default, so the server sets
+-- updated_at explicitly and existing rows are backfilled from created_at.
+ALTER TABLE second_brain ADD COLUMN updated_at TEXT NOT NULL DEFAULT '';
+UPDATE second_brain SET updated_at = created_at WHERE updated_at = '';
+
+CREATE INDEX IF NOT EXISTS idx_second_brain_updated_at
+    ON second_brain (updated_at);
+
+ALTER TABLE brain_trash ADD COLUMN updated_at TEXT NOT NULL DEFAULT '';
+UPDATE brain_trash SET updated_at = deleted_at WHERE updated_at = '';
+
+-- Tombstones outlive the trash so that clients syncing less often than the
+-- trash retention period still learn about deletions.
+CREATE TABLE IF NOT EXISTS brain_tombstones (
+    id INTEGER PRIMARY KEY,
+    deleted_at TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_brain_tombstones_deleted_at
+    ON brain_tombstones (deleted_at);
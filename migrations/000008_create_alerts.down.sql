@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_alert_events_created_at;
+DROP INDEX IF EXISTS idx_alert_events_rule_id;
+DROP TABLE IF EXISTS alert_events;
+DROP TABLE IF EXISTS alert_rules;
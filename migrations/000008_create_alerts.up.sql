@@ -0,0 +1,36 @@
+CREATE TABLE IF NOT EXISTS alert_rules (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    name TEXT NOT NULL,
+    level TEXT NOT NULL DEFAULT '',
+    endpoint TEXT NOT NULL DEFAULT '',
+    method TEXT NOT NULL DEFAULT '',
+    status_code INTEGER NOT NULL DEFAULT 0,
+    message_contains TEXT NOT NULL DEFAULT '',
+    threshold INTEGER NOT NULL,
+    window_minutes INTEGER NOT NULL,
+    channel TEXT NOT NULL,
+    target TEXT NOT NULL,
+    enabled INTEGER NOT NULL DEFAULT 1,
+    last_fired_at TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS alert_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    rule_id INTEGER NOT NULL REFERENCES alert_rules (id) ON DELETE CASCADE,
+    rule_name TEXT NOT NULL,
+    count INTEGER NOT NULL,
+    window_start TEXT NOT NULL,
+    window_end TEXT NOT NULL,
+    delivered INTEGER NOT NULL DEFAULT 0,
+    delivery_error TEXT NOT NULL DEFAULT '',
+    acknowledged_at TEXT NOT NULL DEFAULT '',
+    acknowledged_by TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_alert_events_rule_id
+    ON alert_events (rule_id);
+
+CREATE INDEX IF NOT EXISTS idx_alert_events_created_at
+    ON alert_events (created_at);
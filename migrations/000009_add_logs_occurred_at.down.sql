@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_logs_occurred_at;
+ALTER TABLE logs DROP COLUMN occurred_at;
@@ -0,0 +1,8 @@
+-- occurred_at is when the event happened, which differs from created_at (when
+-- it was ingested) for backfilled and shipped logs. Existing rows take their
+-- created_at.
+ALTER TABLE logs ADD COLUMN occurred_at TEXT NOT NULL DEFAULT '';
+UPDATE logs SET occurred_at = created_at WHERE occurred_at = '';
+
+CREATE INDEX IF NOT EXISTS idx_logs_occurred_at
+    ON logs (occurred_at);
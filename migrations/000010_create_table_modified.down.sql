@@ -0,0 +1,7 @@
+DROP TRIGGER IF EXISTS logs_modified_delete;
+DROP TRIGGER IF EXISTS logs_modified_update;
+DROP TRIGGER IF EXISTS logs_modified_insert;
+DROP TRIGGER IF EXISTS second_brain_modified_delete;
+DROP TRIGGER IF EXISTS second_brain_modified_update;
+DROP TRIGGER IF EXISTS second_brain_modified_insert;
+DROP TABLE IF EXISTS table_modified;
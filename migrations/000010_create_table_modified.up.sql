@@ -0,0 +1,41 @@
+-- table_modified records when each list-backed table last changed, so list
+-- endpoints can answer If-Modified-Since without scanning the table. Triggers
+-- keep it current, including for deletes, which max(updated_at) would miss.
+CREATE TABLE IF NOT EXISTS table_modified (
+    table_name TEXT PRIMARY KEY,
+    updated_at TEXT NOT NULL
+);
+
+INSERT OR IGNORE INTO table_modified (table_name, updated_at) VALUES
+    ('second_brain', CURRENT_TIMESTAMP),
+    ('logs', CURRENT_TIMESTAMP);
+
+CREATE TRIGGER IF NOT EXISTS second_brain_modified_insert AFTER INSERT ON second_brain
+BEGIN
+    UPDATE table_modified SET updated_at = CURRENT_TIMESTAMP WHERE table_name = 'second_brain';
+END;
+
+CREATE TRIGGER IF NOT EXISTS second_brain_modified_update AFTER UPDATE ON second_brain
+BEGIN
+    UPDATE table_modified SET updated_at = CURRENT_TIMESTAMP WHERE table_name = 'second_brain';
+END;
+
+CREATE TRIGGER IF NOT EXISTS second_brain_modified_delete AFTER DELETE ON second_brain
+BEGIN
+    UPDATE table_modified SET updated_at = CURRENT_TIMESTAMP WHERE table_name = 'second_brain';
+END;
+
+CREATE TRIGGER IF NOT EXISTS logs_modified_insert AFTER INSERT ON logs
+BEGIN
+    UPDATE table_modified SET updated_at = CURRENT_TIMESTAMP WHERE table_name = 'logs';
+END;
+
+CREATE TRIGGER IF NOT EXISTS logs_modified_update AFTER UPDATE ON logs
+BEGIN
+    UPDATE table_modified SET updated_at = CURRENT_TIMESTAMP WHERE table_name = 'logs';
+END;
+
+CREATE TRIGGER IF NOT EXISTS logs_modified_delete AFTER DELETE ON logs
+BEGIN
+    UPDATE table_modified SET updated_at = CURRENT_TIMESTAMP WHERE table_name = 'logs';
+END;
@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS brain_templates (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    name TEXT NOT NULL UNIQUE,
+    description TEXT NOT NULL DEFAULT '',
+    title TEXT NOT NULL DEFAULT '',
+    context TEXT NOT NULL DEFAULT '',
+    project TEXT NOT NULL DEFAULT '',
+    tags TEXT NOT NULL DEFAULT ''
+);
+
+INSERT OR IGNORE INTO brain_templates (name, description, title, context, tags) VALUES
+    ('bug-investigation', 'Tracking down a bug from symptom to fix', 'Bug: {{title}}',
+     '## Symptom' || char(10) || char(10) || char(10) ||
+     '## Reproduction' || char(10) || char(10) || char(10) ||
+     '## Root cause' || char(10) || char(10) || char(10) ||
+     '## Fix' || char(10),
+     'bug'),
+    ('meeting-notes', 'Attendees, discussion and action items', 'Meeting notes {{date}}',
+     '## Attendees' || char(10) || char(10) || char(10) ||
+     '## Discussion' || char(10) || char(10) || char(10) ||
+     '## Action items' || char(10) || char(10) || '- [ ] ' || char(10),
+     'meeting'),
+    ('til', 'Today I learned', 'TIL: {{title}}',
+     '## What' || char(10) || char(10) || char(10) ||
+     '## Why it matters' || char(10) || char(10) || char(10) ||
+     '## Source' || char(10),
+     'til');
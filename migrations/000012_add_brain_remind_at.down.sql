@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_second_brain_remind_at;
+ALTER TABLE brain_trash DROP COLUMN remind_at;
+ALTER TABLE second_brain DROP COLUMN reminded_at;
+ALTER TABLE second_brain DROP COLUMN remind_at;
@@ -0,0 +1,9 @@
+-- remind_at is when the record should be brought back to attention (empty for
+-- none); reminded_at is when the notifier last delivered that reminder, and
+-- is cleared whenever remind_at changes.
+ALTER TABLE second_brain ADD COLUMN remind_at TEXT NOT NULL DEFAULT '';
+ALTER TABLE second_brain ADD COLUMN reminded_at TEXT NOT NULL DEFAULT '';
+ALTER TABLE brain_trash ADD COLUMN remind_at TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_second_brain_remind_at
+    ON second_brain (remind_at) WHERE remind_at != '';
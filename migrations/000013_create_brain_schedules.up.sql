@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS brain_schedules (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    name TEXT NOT NULL,
+    template TEXT NOT NULL DEFAULT '',
+    title TEXT NOT NULL DEFAULT '',
+    context TEXT NOT NULL DEFAULT '',
+    project TEXT NOT NULL DEFAULT '',
+    tags TEXT NOT NULL DEFAULT '',
+    frequency TEXT NOT NULL,
+    weekday TEXT NOT NULL DEFAULT '',
+    day_of_month INTEGER NOT NULL DEFAULT 0,
+    at TEXT NOT NULL DEFAULT '08:00',
+    enabled INTEGER NOT NULL DEFAULT 1,
+    last_run_on TEXT NOT NULL DEFAULT '',
+    last_brain_id INTEGER
+);
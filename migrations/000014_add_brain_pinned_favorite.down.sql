@@ -0,0 +1,4 @@
+ALTER TABLE brain_trash DROP COLUMN favorite;
+ALTER TABLE brain_trash DROP COLUMN pinned;
+ALTER TABLE second_brain DROP COLUMN favorite;
+ALTER TABLE second_brain DROP COLUMN pinned;
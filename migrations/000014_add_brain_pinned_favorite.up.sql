@@ -0,0 +1,4 @@
+ALTER TABLE second_brain ADD COLUMN pinned INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE second_brain ADD COLUMN favorite INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE brain_trash ADD COLUMN pinned INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE brain_trash ADD COLUMN favorite INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS brain_shares (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_by TEXT NOT NULL DEFAULT '',
+    brain_id INTEGER NOT NULL,
+    expires_at TEXT NOT NULL DEFAULT '',
+    revoked_at TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_brain_shares_brain_id
+    ON brain_shares (brain_id);
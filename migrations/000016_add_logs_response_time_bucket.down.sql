@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_logs_endpoint_response_time;
+ALTER TABLE logs DROP COLUMN response_time_bucket;
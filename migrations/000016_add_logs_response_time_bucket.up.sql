@@ -0,0 +1,22 @@
+-- response_time_bucket is the lower bound, in ms, of the histogram bucket
+-- response_time_ms falls in (NULL when it was not recorded). Keep the bounds
+-- in step with responseTimeBuckets in log_slow.go.
+ALTER TABLE logs ADD COLUMN response_time_bucket INTEGER GENERATED ALWAYS AS (
+    CASE
+        WHEN response_time_ms IS NULL THEN NULL
+        WHEN response_time_ms >= 10000 THEN 10000
+        WHEN response_time_ms >= 5000 THEN 5000
+        WHEN response_time_ms >= 2500 THEN 2500
+        WHEN response_time_ms >= 1000 THEN 1000
+        WHEN response_time_ms >= 500 THEN 500
+        WHEN response_time_ms >= 250 THEN 250
+        WHEN response_time_ms >= 100 THEN 100
+        WHEN response_time_ms >= 50 THEN 50
+        WHEN response_time_ms >= 25 THEN 25
+        WHEN response_time_ms >= 10 THEN 10
+        ELSE 0
+    END
+) VIRTUAL;
+
+CREATE INDEX IF NOT EXISTS idx_logs_endpoint_response_time
+    ON logs (endpoint, response_time_ms) WHERE response_time_ms IS NOT NULL;
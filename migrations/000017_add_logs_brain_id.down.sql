@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_logs_brain_id;
+ALTER TABLE logs DROP COLUMN brain_id;
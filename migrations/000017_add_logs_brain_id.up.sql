@@ -0,0 +1,7 @@
+-- brain_id links a log line to the brain record written up about it, such
+-- as an incident note. It stays set while the record is in the trash, so a
+-- restore keeps its logs, and is cleared when the trash is purged.
+ALTER TABLE logs ADD COLUMN brain_id INTEGER REFERENCES second_brain (id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_logs_brain_id
+    ON logs (brain_id) WHERE brain_id IS NOT NULL;
@@ -0,0 +1,2 @@
+ALTER TABLE alert_events DROP COLUMN brain_id;
+ALTER TABLE alert_rules DROP COLUMN incident_note;
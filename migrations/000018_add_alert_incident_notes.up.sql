@@ -0,0 +1,4 @@
+-- incident_note makes a rule open a draft brain record each time it fires;
+-- alert_events.brain_id points at that record.
+ALTER TABLE alert_rules ADD COLUMN incident_note INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE alert_events ADD COLUMN brain_id INTEGER REFERENCES second_brain (id) ON DELETE SET NULL;
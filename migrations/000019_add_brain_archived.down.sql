@@ -0,0 +1,2 @@
+ALTER TABLE brain_trash DROP COLUMN archived;
+ALTER TABLE second_brain DROP COLUMN archived;
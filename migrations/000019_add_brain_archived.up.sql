@@ -0,0 +1,3 @@
+-- archived records are kept but left out of the brain list by default.
+ALTER TABLE second_brain ADD COLUMN archived INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE brain_trash ADD COLUMN archived INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,4 @@
+-- version counts the writes to a record, for optimistic locking: an update
+-- names the version it was made from and is refused if that is stale.
+ALTER TABLE second_brain ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE brain_trash ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,2 @@
+ALTER TABLE logs DROP COLUMN last_seen_at;
+ALTER TABLE logs DROP COLUMN count;
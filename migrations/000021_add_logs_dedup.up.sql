@@ -0,0 +1,5 @@
+-- With deduplication enabled, a log identical to the one stored just before
+-- it is folded into that row: count is how many times the message was seen
+-- and last_seen_at when it was last seen (NULL while count is 1).
+ALTER TABLE logs ADD COLUMN count INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE logs ADD COLUMN last_seen_at TEXT;
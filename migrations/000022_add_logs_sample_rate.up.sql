@@ -0,0 +1,4 @@
+-- sample_rate is set on logs stored by ingestion sampling: the fraction of
+-- matching logs that are kept, so each stored one stands for 1/sample_rate.
+-- NULL means the log was not sampled.
+ALTER TABLE logs ADD COLUMN sample_rate REAL;
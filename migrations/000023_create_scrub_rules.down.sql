@@ -0,0 +1 @@
+DROP TABLE IF EXISTS scrub_rules;
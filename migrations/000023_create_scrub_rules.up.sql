@@ -0,0 +1,14 @@
+-- scrub_rules redact personal data and secrets from logs before they are
+-- stored. Each rule sets exactly one of preset (a built-in pattern such as
+-- email), pattern (a regular expression) or field (a metadata key whose
+-- value is replaced wholesale).
+CREATE TABLE IF NOT EXISTS scrub_rules (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    name TEXT NOT NULL,
+    preset TEXT NOT NULL DEFAULT '',
+    pattern TEXT NOT NULL DEFAULT '',
+    field TEXT NOT NULL DEFAULT '',
+    replacement TEXT NOT NULL DEFAULT '',
+    enabled INTEGER NOT NULL DEFAULT 1
+);
@@ -0,0 +1,2 @@
+ALTER TABLE brain_trash DROP COLUMN summary;
+ALTER TABLE second_brain DROP COLUMN summary;
@@ -0,0 +1,5 @@
+-- summary is a short digest of a long context, generated on request by
+-- POST /brain/{id}/summarize and shown in place of the context in search
+-- snippets.
+ALTER TABLE second_brain ADD COLUMN summary TEXT NOT NULL DEFAULT '';
+ALTER TABLE brain_trash ADD COLUMN summary TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,9 @@
+-- notion_pages remembers the Notion page each brain record was exported to
+-- and the record version it held, so later exports only push records that
+-- changed since.
+CREATE TABLE IF NOT EXISTS notion_pages (
+    brain_id INTEGER PRIMARY KEY REFERENCES second_brain (id) ON DELETE CASCADE,
+    page_id TEXT NOT NULL,
+    version INTEGER NOT NULL,
+    exported_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,17 @@
+-- brain_issues links brain records to Jira or Linear issues. title, status
+-- and url are cached from the provider's API and refreshed once fetched_at
+-- grows stale.
+CREATE TABLE IF NOT EXISTS brain_issues (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    brain_id INTEGER NOT NULL REFERENCES second_brain (id) ON DELETE CASCADE,
+    provider TEXT NOT NULL CHECK (provider IN ('jira', 'linear')),
+    key TEXT NOT NULL,
+    title TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT '',
+    url TEXT NOT NULL DEFAULT '',
+    fetched_at TEXT NOT NULL DEFAULT '',
+    UNIQUE (brain_id, provider, key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_brain_issues_key ON brain_issues (key);
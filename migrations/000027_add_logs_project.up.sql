@@ -0,0 +1,7 @@
+-- project is the project a log belongs to. Logs ingested with a
+-- project-bound API key always get the key's project, and such keys only
+-- read logs of their own project.
+ALTER TABLE logs ADD COLUMN project TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_logs_project
+    ON logs (project, occurred_at) WHERE project != '';
@@ -0,0 +1,8 @@
+-- feature_flags hold the overrides set through /admin/flags. A flag without
+-- a row follows SBRAIN_FLAGS or its built-in default.
+CREATE TABLE IF NOT EXISTS feature_flags (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE,
+    enabled INTEGER NOT NULL,
+    updated_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
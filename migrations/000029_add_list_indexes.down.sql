@@ -0,0 +1,9 @@
+DROP TRIGGER IF EXISTS second_brain_tags_delete;
+DROP TRIGGER IF EXISTS second_brain_tags_update;
+DROP TRIGGER IF EXISTS second_brain_tags_insert;
+DROP TABLE IF EXISTS brain_tags;
+DROP INDEX IF EXISTS idx_second_brain_project_created_at;
+DROP INDEX IF EXISTS idx_logs_endpoint_occurred_at;
+CREATE INDEX IF NOT EXISTS idx_logs_level
+    ON logs (level);
+DROP INDEX IF EXISTS idx_logs_level_occurred_at;
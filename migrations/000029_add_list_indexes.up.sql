@@ -0,0 +1,63 @@
+-- Indexes for the list endpoints, which sort by time after filtering.
+-- idx_logs_level_occurred_at covers what idx_logs_level did.
+CREATE INDEX IF NOT EXISTS idx_logs_level_occurred_at
+    ON logs (level, occurred_at);
+
+DROP INDEX IF EXISTS idx_logs_level;
+
+CREATE INDEX IF NOT EXISTS idx_logs_endpoint_occurred_at
+    ON logs (endpoint, occurred_at);
+
+CREATE INDEX IF NOT EXISTS idx_second_brain_project_created_at
+    ON second_brain (project, created_at);
+
+-- brain_tags indexes the comma-separated second_brain.tags one row per tag,
+-- so filtering by tag is a lookup rather than a scan. Triggers keep it in
+-- step with every write to second_brain. The tags are turned into a JSON
+-- array to split them, as trigger bodies cannot use recursive CTEs; values
+-- that would not make valid JSON index no tags rather than fail the write.
+CREATE TABLE IF NOT EXISTS brain_tags (
+    tag TEXT NOT NULL,
+    brain_id INTEGER NOT NULL,
+    PRIMARY KEY (tag, brain_id)
+) WITHOUT ROWID;
+
+CREATE INDEX IF NOT EXISTS idx_brain_tags_brain_id
+    ON brain_tags (brain_id);
+
+INSERT OR IGNORE INTO brain_tags (tag, brain_id)
+SELECT j.value, b.id
+FROM second_brain b,
+    json_each(CASE
+        WHEN json_valid('["' || replace(replace(replace(replace(b.tags, '\', '\\'), '"', '\"'), ' ', ''), ',', '","') || '"]')
+        THEN '["' || replace(replace(replace(replace(b.tags, '\', '\\'), '"', '\"'), ' ', ''), ',', '","') || '"]'
+        ELSE '[]' END) j
+WHERE j.value != '';
+
+CREATE TRIGGER IF NOT EXISTS second_brain_tags_insert AFTER INSERT ON second_brain
+BEGIN
+    INSERT OR IGNORE INTO brain_tags (tag, brain_id)
+    SELECT value, NEW.id
+    FROM json_each(CASE
+        WHEN json_valid('["' || replace(replace(replace(replace(NEW.tags, '\', '\\'), '"', '\"'), ' ', ''), ',', '","') || '"]')
+        THEN '["' || replace(replace(replace(replace(NEW.tags, '\', '\\'), '"', '\"'), ' ', ''), ',', '","') || '"]'
+        ELSE '[]' END)
+    WHERE value != '';
+END;
+
+CREATE TRIGGER IF NOT EXISTS second_brain_tags_update AFTER UPDATE OF id, tags ON second_brain
+BEGIN
+    DELETE FROM brain_tags WHERE brain_id = OLD.id;
+    INSERT OR IGNORE INTO brain_tags (tag, brain_id)
+    SELECT value, NEW.id
+    FROM json_each(CASE
+        WHEN json_valid('["' || replace(replace(replace(replace(NEW.tags, '\', '\\'), '"', '\"'), ' ', ''), ',', '","') || '"]')
+        THEN '["' || replace(replace(replace(replace(NEW.tags, '\', '\\'), '"', '\"'), ' ', ''), ',', '","') || '"]'
+        ELSE '[]' END)
+    WHERE value != '';
+END;
+
+CREATE TRIGGER IF NOT EXISTS second_brain_tags_delete AFTER DELETE ON second_brain
+BEGIN
+    DELETE FROM brain_tags WHERE brain_id = OLD.id;
+END;
@@ -0,0 +1,15 @@
+-- heartbeats are the dead man's switches pinged at POST /heartbeats/{name}.
+-- One that goes interval_seconds plus grace_seconds without a ping is marked
+-- down, logged as an error and, with a channel, announced there.
+CREATE TABLE IF NOT EXISTS heartbeats (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    name TEXT NOT NULL UNIQUE,
+    interval_seconds INTEGER NOT NULL,
+    grace_seconds INTEGER NOT NULL DEFAULT 0,
+    channel TEXT NOT NULL DEFAULT '',
+    target TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'new',
+    last_ping_at TEXT NOT NULL DEFAULT '',
+    last_missed_at TEXT NOT NULL DEFAULT ''
+);
@@ -0,0 +1,24 @@
+-- monitors are the URLs the uptime checker probes every interval_seconds.
+-- Each check is written to logs; status and the last_* columns hold the
+-- latest result, and consecutive_failures how many checks in a row failed.
+CREATE TABLE IF NOT EXISTS monitors (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    name TEXT NOT NULL,
+    url TEXT NOT NULL,
+    method TEXT NOT NULL DEFAULT 'GET',
+    interval_seconds INTEGER NOT NULL,
+    timeout_seconds INTEGER NOT NULL,
+    expected_status INTEGER NOT NULL DEFAULT 0,
+    keyword TEXT NOT NULL DEFAULT '',
+    failure_threshold INTEGER NOT NULL DEFAULT 1,
+    channel TEXT NOT NULL DEFAULT '',
+    target TEXT NOT NULL DEFAULT '',
+    enabled INTEGER NOT NULL DEFAULT 1,
+    status TEXT NOT NULL DEFAULT 'new',
+    consecutive_failures INTEGER NOT NULL DEFAULT 0,
+    last_checked_at TEXT NOT NULL DEFAULT '',
+    last_status_code INTEGER NOT NULL DEFAULT 0,
+    last_response_ms INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT ''
+);
@@ -0,0 +1,12 @@
+-- slos are service level objectives for logged endpoints: the share of
+-- requests that must be answered within latency_threshold_ms, and the
+-- highest share that may fail. Either may be NULL when only the other is
+-- tracked. An endpoint ending in * covers every endpoint with that prefix.
+CREATE TABLE IF NOT EXISTS slos (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    endpoint TEXT NOT NULL UNIQUE,
+    latency_threshold_ms INTEGER,
+    latency_objective REAL,
+    max_error_rate REAL
+);
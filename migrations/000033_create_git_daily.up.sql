@@ -0,0 +1,11 @@
+-- git_daily maps each project and day to the brain record summarizing its
+-- commits, and holds the commits seen so far so later pushes and pulls for
+-- the same day add to the record instead of replacing it.
+CREATE TABLE IF NOT EXISTS git_daily (
+    project TEXT NOT NULL,
+    day TEXT NOT NULL,
+    brain_id INTEGER REFERENCES second_brain (id) ON DELETE SET NULL,
+    commits TEXT NOT NULL DEFAULT '[]',
+    updated_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (project, day)
+);
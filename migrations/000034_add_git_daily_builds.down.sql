@@ -0,0 +1 @@
+ALTER TABLE git_daily DROP COLUMN builds;
@@ -0,0 +1,3 @@
+-- builds holds the CI results appended to a project's day, alongside its
+-- commits, so either can be added without losing the other.
+ALTER TABLE git_daily ADD COLUMN builds TEXT NOT NULL DEFAULT '[]';
@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS logs_labels_delete;
+DROP INDEX IF EXISTS idx_log_labels_key_value;
+DROP TABLE IF EXISTS log_labels;
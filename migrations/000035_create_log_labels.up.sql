@@ -0,0 +1,17 @@
+-- log_labels holds the key=value labels attached to logs at ingestion, one
+-- row per label, so filtering by a label is an index lookup rather than a
+-- scan of the metadata JSON. A trigger drops a log's labels with it.
+CREATE TABLE IF NOT EXISTS log_labels (
+    log_id INTEGER NOT NULL,
+    key TEXT NOT NULL,
+    value TEXT NOT NULL,
+    PRIMARY KEY (log_id, key)
+) WITHOUT ROWID;
+
+CREATE INDEX IF NOT EXISTS idx_log_labels_key_value
+    ON log_labels (key, value, log_id);
+
+CREATE TRIGGER IF NOT EXISTS logs_labels_delete AFTER DELETE ON logs
+BEGIN
+    DELETE FROM log_labels WHERE log_id = OLD.id;
+END;
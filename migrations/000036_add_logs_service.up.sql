@@ -0,0 +1,7 @@
+-- service names the application a log came from, so the logs of several
+-- apps sharing one sbrain can be listed, counted and retained apart. It
+-- defaults from the X-Sbrain-Service header or the API key.
+ALTER TABLE logs ADD COLUMN service TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_logs_service
+    ON logs (service, occurred_at) WHERE service != '';
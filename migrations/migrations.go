@@ -0,0 +1,11 @@
+// Package migrations embeds the SQL schema migrations, numbered for
+// golang-migrate, so the server can check and apply them without the
+// migrations directory on disk.
+package migrations
+
+import "embed"
+
+// Files holds every NNNNNN_name.up.sql migration at its root.
+//
+//go:embed *.up.sql
+var Files embed.FS
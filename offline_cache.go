@@ -0,0 +1,591 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"sbrain/pkg/sbrain"
+	"sbrain/store"
+)
+
+// The offline cache is a SQLite file on the client holding a copy of the
+// server's brains plus any notes created or edited while offline. It is
+// private to the CLI, so its schema is created here rather than through the
+// server migrations.
+const cacheSchema = `
+CREATE TABLE IF NOT EXISTS notes (
+    local_id INTEGER PRIMARY KEY AUTOINCREMENT,
+    remote_id INTEGER UNIQUE,
+    created_at TEXT NOT NULL,
+    updated_at TEXT NOT NULL DEFAULT '',
+    title TEXT NOT NULL,
+    context TEXT NOT NULL,
+    project TEXT NOT NULL,
+    commits TEXT NOT NULL DEFAULT '',
+    tags TEXT NOT NULL DEFAULT '',
+    dirty INTEGER NOT NULL DEFAULT 0,
+    base_updated_at TEXT NOT NULL DEFAULT '',
+    base_version INTEGER NOT NULL DEFAULT 0,
+    local_updated_at TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS sync_state (
+    key TEXT PRIMARY KEY,
+    value TEXT NOT NULL
+);
+`
+
+// cacheUpgrades add columns to caches created by older versions of the CLI.
+// Each fails with "duplicate column" once applied, which is ignored.
+var cacheUpgrades = []string{
+	`ALTER TABLE notes ADD COLUMN base_version INTEGER NOT NULL DEFAULT 0`,
+}
+
+// cachedNote is a brain as stored in the offline cache. Dirty notes have local
+// changes not yet pushed; BaseUpdatedAt is the server updated_at they were
+// edited from, which is how a concurrent server-side edit is detected.
+// Brain.Version is the server version they were edited from, sent with the
+// push so the server can refuse it if another client got there first.
+type cachedNote struct {
+	LocalID        int64
+	RemoteID       sql.NullInt64
+	Brain          brain
+	Dirty          bool
+	BaseUpdatedAt  string
+	LocalUpdatedAt string
+}
+
+type cacheClient struct {
+	db      *sql.DB
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+func defaultCachePath() string {
+	if path := os.Getenv("SBRAIN_CACHE"); path != "" {
+		return path
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "sbrain-cache.db"
+	}
+	return filepath.Join(dir, "sbrain", "cache.db")
+}
+
+func openCache(path string) (*cacheClient, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("create cache directory: %w", err)
+	}
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, fmt.Errorf("open cache: %w", err)
+	}
+	if _, err := db.Exec(cacheSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("initialize cache: %w", err)
+	}
+	for _, upgrade := range cacheUpgrades {
+		if _, err := db.Exec(upgrade); err != nil && !strings.Contains(err.Error(), "duplicate column") {
+			db.Close()
+			return nil, fmt.Errorf("upgrade cache: %w", err)
+		}
+	}
+
+	baseURL := os.Getenv("SBRAIN_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:8080"
+	}
+	return &cacheClient{
+		db:      db,
+		baseURL: strings.TrimRight(baseURL, "/"),
+		token:   os.Getenv("SBRAIN_TOKEN"),
+		http:    &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// runNoteCommand manages notes in the offline cache:
+//
+//	sbrain note list
+//	sbrain note show <id>
+//	sbrain note add --title T --project P [--tags a,b] [text...]
+//	sbrain note edit <id> [--title T] [--project P] [--tags a,b] [text...]
+//
+// Text defaults to stdin when it is not given as arguments. Ids are local
+// cache ids, shown by "note list".
+func runNoteCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("note: expected list, show, add or edit")
+	}
+
+	c, err := openCache(defaultCachePath())
+	if err != nil {
+		return err
+	}
+	defer c.db.Close()
+
+	switch sub, rest := args[0], args[1:]; sub {
+	case "list":
+		return c.listNotes(os.Stdout)
+	case "show":
+		if len(rest) != 1 {
+			return errors.New("note show: expected a note id")
+		}
+		id, err := strconv.ParseInt(rest[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("note show: invalid id %q", rest[0])
+		}
+		n, err := c.note(id)
+		if err != nil {
+			return err
+		}
+		printNote(os.Stdout, n)
+		return nil
+	case "add", "edit":
+		return c.runNoteEdit(sub, rest)
+	default:
+		return fmt.Errorf("note: unknown subcommand %q", sub)
+	}
+}
+
+func (c *cacheClient) runNoteEdit(sub string, args []string) error {
+	var id int64
+	if sub == "edit" {
+		if len(args) == 0 {
+			return errors.New("note edit: expected a note id")
+		}
+		var err error
+		if id, err = strconv.ParseInt(args[0], 10, 64); err != nil {
+			return fmt.Errorf("note edit: invalid id %q", args[0])
+		}
+		args = args[1:]
+	}
+
+	fs := newFlagSet("note " + sub)
+	title := fs.String("title", "", "note title")
+	project := fs.String("project", "", "project the note belongs to")
+	tags := fs.String("tags", "", "comma-separated tags")
+	commits := fs.String("commits", "", "related commits")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	text := strings.Join(fs.Args(), " ")
+	if text == "" && (sub == "add" || !stdinIsTerminal()) {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("read stdin: %w", err)
+		}
+		text = strings.TrimSpace(string(data))
+	}
+
+	now := time.Now().UTC().Format(store.TimeLayout)
+	if sub == "add" {
+		if strings.TrimSpace(*title) == "" || strings.TrimSpace(*project) == "" || text == "" {
+			return errors.New("note add: --title, --project and text are required")
+		}
+		res, err := c.db.Exec(`INSERT INTO notes (created_at, title, context, project, commits, tags, dirty, local_updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, 1, ?)`, now, *title, text, *project, *commits, *tags, now)
+		if err != nil {
+			return fmt.Errorf("add note: %w", err)
+		}
+		localID, _ := res.LastInsertId()
+		fmt.Printf("added note %d (not yet synced)\n", localID)
+		return nil
+	}
+
+	n, err := c.note(id)
+	if err != nil {
+		return err
+	}
+	b := n.Brain
+	if set["title"] {
+		b.Title = *title
+	}
+	if set["project"] {
+		b.Project = *project
+	}
+	if set["tags"] {
+		b.Tags = *tags
+	}
+	if set["commits"] {
+		b.Commits = *commits
+	}
+	if text != "" {
+		b.Context = text
+	}
+	if _, err := c.db.Exec(`UPDATE notes SET title = ?, context = ?, project = ?, commits = ?, tags = ?, dirty = 1, local_updated_at = ?
+		WHERE local_id = ?`, b.Title, b.Context, b.Project, b.Commits, b.Tags, now, id); err != nil {
+		return fmt.Errorf("edit note: %w", err)
+	}
+	fmt.Printf("edited note %d (not yet synced)\n", id)
+	return nil
+}
+
+// runSyncCommand pulls server changes into the offline cache and pushes local
+// edits. Conflicting edits are settled last-write-wins unless --resolve is
+// given, in which case each conflict is decided interactively.
+func runSyncCommand(args []string) error {
+	fs := newFlagSet("sync")
+	resolve := fs.Bool("resolve", false, "ask which side wins for each conflict instead of last-write-wins")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	c, err := openCache(defaultCachePath())
+	if err != nil {
+		return err
+	}
+	defer c.db.Close()
+
+	var choose conflictResolver = lastWriteWins
+	if *resolve {
+		choose = interactiveResolver(bufio.NewReader(os.Stdin), os.Stdout)
+	}
+
+	pulled, conflicts, err := c.pull(choose)
+	if err != nil {
+		return err
+	}
+	pushed, err := c.push()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("sync complete: %d pulled, %d pushed, %d conflicts\n", pulled, pushed, conflicts)
+	return nil
+}
+
+// conflictResolver decides whether the local copy wins over a remote change.
+// remote is nil when the note was deleted on the server at remoteTime.
+type conflictResolver func(local cachedNote, remote *brain, remoteTime string) (keepLocal bool, err error)
+
+func lastWriteWins(local cachedNote, remote *brain, remoteTime string) (bool, error) {
+	return local.LocalUpdatedAt > remoteTime, nil
+}
+
+func interactiveResolver(in *bufio.Reader, out io.Writer) conflictResolver {
+	return func(local cachedNote, remote *brain, remoteTime string) (bool, error) {
+		fmt.Fprintf(out, "\nConflict on note %d (server id %d)\n", local.LocalID, local.RemoteID.Int64)
+		fmt.Fprintf(out, "--- local, edited %s\n", local.LocalUpdatedAt)
+		printNote(out, local)
+		if remote == nil {
+			fmt.Fprintf(out, "--- server: deleted %s\n", remoteTime)
+		} else {
+			fmt.Fprintf(out, "--- server, edited %s\n", remoteTime)
+			printNote(out, cachedNote{LocalID: local.LocalID, RemoteID: local.RemoteID, Brain: *remote})
+		}
+		for {
+			fmt.Fprint(out, "Keep [l]ocal or [s]erver? ")
+			line, err := in.ReadString('\n')
+			switch strings.ToLower(strings.TrimSpace(line)) {
+			case "l", "local":
+				return true, nil
+			case "s", "server":
+				return false, nil
+			}
+			if err != nil {
+				return false, fmt.Errorf("read choice: %w", err)
+			}
+		}
+	}
+}
+
+func (c *cacheClient) pull(choose conflictResolver) (pulled int, conflicts int, err error) {
+	var cursor string
+	if err := c.db.QueryRow(`SELECT value FROM sync_state WHERE key = 'cursor'`).Scan(&cursor); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, 0, fmt.Errorf("read sync cursor: %w", err)
+	}
+
+	path := "/sync"
+	if cursor != "" {
+		path += "?since=" + url.QueryEscape(cursor)
+	}
+	var changes sbrain.SyncResponse
+	if err := c.do(http.MethodGet, path, nil, &changes); err != nil {
+		return 0, 0, err
+	}
+
+	for _, remote := range changes.Brains {
+		local, found, err := c.noteByRemoteID(remote.ID)
+		if err != nil {
+			return pulled, conflicts, err
+		}
+		if found && local.Dirty && local.BaseUpdatedAt != string(remote.UpdatedAt) {
+			conflicts++
+			keepLocal, err := choose(local, &remote, string(remote.UpdatedAt))
+			if err != nil {
+				return pulled, conflicts, err
+			}
+			if keepLocal {
+				// Rebase the local edit so the push overwrites the server copy.
+				if _, err := c.db.Exec(`UPDATE notes SET base_updated_at = ?, base_version = ? WHERE local_id = ?`,
+					remote.UpdatedAt, remote.Version, local.LocalID); err != nil {
+					return pulled, conflicts, fmt.Errorf("rebase note %d: %w", local.LocalID, err)
+				}
+				continue
+			}
+		} else if found && (local.Dirty || local.Brain.UpdatedAt == remote.UpdatedAt) {
+			// Unconflicted local edits are pushed below; unchanged notes are
+			// usually our own pushes coming back.
+			continue
+		}
+		if err := c.storeRemote(remote); err != nil {
+			return pulled, conflicts, err
+		}
+		pulled++
+	}
+
+	for _, t := range changes.Deleted {
+		local, found, err := c.noteByRemoteID(t.ID)
+		if err != nil {
+			return pulled, conflicts, err
+		}
+		if !found {
+			continue
+		}
+		if local.Dirty {
+			conflicts++
+			keepLocal, err := choose(local, nil, string(t.DeletedAt))
+			if err != nil {
+				return pulled, conflicts, err
+			}
+			if keepLocal {
+				// The server copy is gone, so the local edit is pushed as a new note.
+				if _, err := c.db.Exec(`UPDATE notes SET remote_id = NULL, base_updated_at = '', base_version = 0 WHERE local_id = ?`, local.LocalID); err != nil {
+					return pulled, conflicts, fmt.Errorf("detach note %d: %w", local.LocalID, err)
+				}
+				continue
+			}
+		}
+		if _, err := c.db.Exec(`DELETE FROM notes WHERE local_id = ?`, local.LocalID); err != nil {
+			return pulled, conflicts, fmt.Errorf("delete note %d: %w", local.LocalID, err)
+		}
+		pulled++
+	}
+
+	if _, err := c.db.Exec(`INSERT INTO sync_state (key, value) VALUES ('cursor', ?)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value`, changes.Cursor); err != nil {
+		return pulled, conflicts, fmt.Errorf("save sync cursor: %w", err)
+	}
+	return pulled, conflicts, nil
+}
+
+func (c *cacheClient) push() (int, error) {
+	rows, err := c.db.Query(`SELECT local_id FROM notes WHERE dirty = 1 ORDER BY local_id`)
+	if err != nil {
+		return 0, fmt.Errorf("query pending notes: %w", err)
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("scan pending note: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("iterate pending notes: %w", err)
+	}
+
+	pushed := 0
+	for _, id := range ids {
+		n, err := c.note(id)
+		if err != nil {
+			return pushed, err
+		}
+
+		var saved brain
+		err = errNotFound
+		if n.RemoteID.Valid {
+			path := fmt.Sprintf("/brain/%d", n.RemoteID.Int64)
+			err = nil
+			if n.Brain.Version == 0 {
+				// Cached before versions were tracked: edit from the server's.
+				var current brain
+				err = c.do(http.MethodGet, path, nil, &current)
+				n.Brain.Version = current.Version
+			}
+			if err == nil {
+				err = c.do(http.MethodPut, path, n.Brain, &saved)
+			}
+		}
+		if errors.Is(err, errNotFound) {
+			// Never synced, or deleted on the server since the last pull.
+			err = c.do(http.MethodPost, "/brain", n.Brain, &saved)
+		}
+		if err != nil {
+			return pushed, fmt.Errorf("push note %d: %w", id, err)
+		}
+
+		if _, err := c.db.Exec(`UPDATE notes SET remote_id = ?, created_at = ?, updated_at = ?, dirty = 0, base_updated_at = ?,
+			base_version = ? WHERE local_id = ?`, saved.ID, saved.CreatedAt, saved.UpdatedAt, saved.UpdatedAt, saved.Version, id); err != nil {
+			return pushed, fmt.Errorf("mark note %d synced: %w", id, err)
+		}
+		pushed++
+	}
+	return pushed, nil
+}
+
+func (c *cacheClient) storeRemote(b brain) error {
+	_, err := c.db.Exec(`INSERT INTO notes (remote_id, created_at, updated_at, title, context, project, commits, tags, dirty, base_updated_at, base_version)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, 0, ?, ?)
+		ON CONFLICT (remote_id) DO UPDATE SET created_at = excluded.created_at, updated_at = excluded.updated_at,
+			title = excluded.title, context = excluded.context, project = excluded.project, commits = excluded.commits,
+			tags = excluded.tags, dirty = 0, base_updated_at = excluded.base_updated_at, base_version = excluded.base_version`,
+		b.ID, b.CreatedAt, b.UpdatedAt, b.Title, b.Context, b.Project, b.Commits, b.Tags, b.UpdatedAt, b.Version)
+	if err != nil {
+		return fmt.Errorf("store note %d: %w", b.ID, err)
+	}
+	return nil
+}
+
+const cachedNoteColumns = `local_id, remote_id, created_at, updated_at, title, context, project, commits, tags, dirty, base_updated_at,
+	base_version, local_updated_at`
+
+func scanCachedNote(row interface{ Scan(...any) error }) (cachedNote, error) {
+	var n cachedNote
+	err := row.Scan(&n.LocalID, &n.RemoteID, &n.Brain.CreatedAt, &n.Brain.UpdatedAt, &n.Brain.Title, &n.Brain.Context,
+		&n.Brain.Project, &n.Brain.Commits, &n.Brain.Tags, &n.Dirty, &n.BaseUpdatedAt,
+		&n.Brain.Version, &n.LocalUpdatedAt)
+	n.Brain.ID = n.RemoteID.Int64
+	return n, err
+}
+
+func (c *cacheClient) note(localID int64) (cachedNote, error) {
+	n, err := scanCachedNote(c.db.QueryRow(`SELECT `+cachedNoteColumns+` FROM notes WHERE local_id = ?`, localID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return n, fmt.Errorf("note %d not found in cache", localID)
+	}
+	if err != nil {
+		return n, fmt.Errorf("load note %d: %w", localID, err)
+	}
+	return n, nil
+}
+
+func (c *cacheClient) noteByRemoteID(remoteID int64) (cachedNote, bool, error) {
+	n, err := scanCachedNote(c.db.QueryRow(`SELECT `+cachedNoteColumns+` FROM notes WHERE remote_id = ?`, remoteID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return n, false, nil
+	}
+	if err != nil {
+		return n, false, fmt.Errorf("load note for server id %d: %w", remoteID, err)
+	}
+	return n, true, nil
+}
+
+func (c *cacheClient) listNotes(out io.Writer) error {
+	rows, err := c.db.Query(`SELECT ` + cachedNoteColumns + ` FROM notes ORDER BY created_at DESC, local_id DESC`)
+	if err != nil {
+		return fmt.Errorf("query notes: %w", err)
+	}
+	defer rows.Close()
+
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSERVER ID\tSTATUS\tPROJECT\tTITLE")
+	for rows.Next() {
+		n, err := scanCachedNote(rows)
+		if err != nil {
+			return fmt.Errorf("scan note: %w", err)
+		}
+		serverID, status := "-", "synced"
+		if n.RemoteID.Valid {
+			serverID = strconv.FormatInt(n.RemoteID.Int64, 10)
+		}
+		if n.Dirty {
+			status = "pending"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", n.LocalID, serverID, status, n.Brain.Project, n.Brain.Title)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterate notes: %w", err)
+	}
+	return tw.Flush()
+}
+
+func printNote(out io.Writer, n cachedNote) {
+	fmt.Fprintf(out, "# %s\nproject: %s\n", n.Brain.Title, n.Brain.Project)
+	if n.Brain.Tags != "" {
+		fmt.Fprintf(out, "tags: %s\n", n.Brain.Tags)
+	}
+	if n.Brain.Commits != "" {
+		fmt.Fprintf(out, "commits: %s\n", n.Brain.Commits)
+	}
+	fmt.Fprintf(out, "\n%s\n", n.Brain.Context)
+}
+
+var errNotFound = errors.New("not found")
+
+// do sends a JSON request to the server and decodes the JSON response into
+// out. A 404 is reported as errNotFound.
+func (c *cacheClient) do(method string, path string, body any, out any) error {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("encode request: %w", err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequest(method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s: %w (is the server reachable? notes stay in the cache until the next sync)", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return errNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		var apiErr struct {
+			Error sbrain.APIError `json:"error"`
+		}
+		if json.Unmarshal(msg, &apiErr) == nil && apiErr.Error.Message != "" {
+			text := apiErr.Error.Message
+			for _, f := range apiErr.Error.Fields {
+				text += fmt.Sprintf("; %s %s", f.Field, f.Message)
+			}
+			msg = []byte(text)
+		}
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("%s %s: decode response: %w", method, path, err)
+	}
+	return nil
+}
+
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,483 @@
+// Package client is a typed Go client for the sbrain HTTP API. It depends
+// only on the store types, not on the server, so importing it does not pull
+// in SQLite.
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"sbrain/store"
+)
+
+// Brain and Log are the records the API reads and writes.
+type (
+	Brain = store.Brain
+	Log   = store.Log
+)
+
+// Options configures a Client.
+type Options struct {
+	// Token is sent as a bearer token: an API key, SBRAIN_TOKEN or a session
+	// token from /auth/token. Empty sends no credentials.
+	Token string
+	// HTTPClient makes the requests; nil uses a client with a 30 second
+	// timeout.
+	HTTPClient *http.Client
+}
+
+// Client calls one sbrain server. It is safe for concurrent use.
+type Client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+// New returns a client for the server at baseURL, such as
+// "http://localhost:8080".
+func New(baseURL string, opts Options) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("client: invalid base URL %q", baseURL)
+	}
+	httpClient := opts.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	return &Client{baseURL: strings.TrimRight(baseURL, "/"), token: opts.Token, http: httpClient}, nil
+}
+
+// Error is an error response from the server, decoded from its
+//
+//	{"error": {"code": "...", "message": "...", "request_id": "..."}}
+//
+// body.
+type Error struct {
+	StatusCode int          `json:"-"`
+	Code       string       `json:"code"`
+	Message    string       `json:"message"`
+	RequestID  string       `json:"request_id,omitempty"`
+	Fields     []FieldError `json:"fields,omitempty"`
+	// Current is the stored record when Code is "conflict".
+	Current json.RawMessage `json:"current,omitempty"`
+}
+
+// FieldError is one invalid field of a rejected request body.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	text := fmt.Sprintf("sbrain: %d %s: %s", e.StatusCode, e.Code, e.Message)
+	for _, f := range e.Fields {
+		text += fmt.Sprintf("; %s %s", f.Field, f.Message)
+	}
+	return text
+}
+
+// IsNotFound reports whether err is a 404 from the server.
+func IsNotFound(err error) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// IsConflict reports whether err is a version conflict, in which case the
+// stored record is in the Error's Current field.
+func IsConflict(err error) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusConflict
+}
+
+// ListBrainsOptions filters ListBrains. Zero fields are ignored.
+type ListBrainsOptions struct {
+	IDs      []int64
+	Project  string
+	Tag      string
+	Pinned   *bool
+	Favorite *bool
+	// Archived is "true" for only archived records, "all" for both, and
+	// empty or "false" for unarchived records.
+	Archived string
+	// Issue is a linked Jira or Linear issue key, such as ENG-123.
+	Issue string
+}
+
+func (o ListBrainsOptions) query() url.Values {
+	q := url.Values{}
+	for _, id := range o.IDs {
+		q.Add("id", strconv.FormatInt(id, 10))
+	}
+	setString(q, "project", o.Project)
+	setString(q, "tag", o.Tag)
+	setBool(q, "pinned", o.Pinned)
+	setBool(q, "favorite", o.Favorite)
+	setString(q, "archived", o.Archived)
+	setString(q, "issue", o.Issue)
+	return q
+}
+
+// ListLogsOptions filters ListLogs and TailLogs. Zero fields are ignored.
+type ListLogsOptions struct {
+	Level      string
+	Endpoint   string
+	Method     string
+	RequestID  string
+	StatusCode int
+	BrainID    int64
+	Project    string
+	Service    string
+	// Country (an ISO code) and City match IP geolocation.
+	Country string
+	City    string
+	// Labels must all be on the log; an empty value matches any value.
+	Labels map[string]string
+	// Since and Until bound occurred_at; Since is inclusive, Until not.
+	Since time.Time
+	Until time.Time
+}
+
+func (o ListLogsOptions) query() url.Values {
+	q := url.Values{}
+	setString(q, "level", o.Level)
+	setString(q, "endpoint", o.Endpoint)
+	setString(q, "method", o.Method)
+	setString(q, "request_id", o.RequestID)
+	if o.StatusCode != 0 {
+		q.Set("status_code", strconv.Itoa(o.StatusCode))
+	}
+	if o.BrainID != 0 {
+		q.Set("brain_id", strconv.FormatInt(o.BrainID, 10))
+	}
+	setString(q, "project", o.Project)
+	setString(q, "service", o.Service)
+	setString(q, "country", o.Country)
+	setString(q, "city", o.City)
+	keys := make([]string, 0, len(o.Labels))
+	for key := range o.Labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if o.Labels[key] == "" {
+			q.Add("label", key)
+		} else {
+			q.Add("label", key+":"+o.Labels[key])
+		}
+	}
+	if !o.Since.IsZero() {
+		q.Set("since", o.Since.UTC().Format(time.RFC3339))
+	}
+	if !o.Until.IsZero() {
+		q.Set("until", o.Until.UTC().Format(time.RFC3339))
+	}
+	return q
+}
+
+func setString(q url.Values, name, value string) {
+	if value != "" {
+		q.Set(name, value)
+	}
+}
+
+func setBool(q url.Values, name string, value *bool) {
+	if value != nil {
+		q.Set(name, strconv.FormatBool(*value))
+	}
+}
+
+// CreateBrain stores a new brain from b's title, context, project, commits,
+// tags and remind_at, and returns it as persisted.
+func (c *Client) CreateBrain(ctx context.Context, b Brain) (Brain, error) {
+	var out Brain
+	err := c.do(ctx, http.MethodPost, "/brain", nil, brainBody(b, nil), &out)
+	return out, err
+}
+
+// GetBrain returns the brain with id.
+func (c *Client) GetBrain(ctx context.Context, id int64) (Brain, error) {
+	var out Brain
+	err := c.do(ctx, http.MethodGet, "/brain/"+strconv.FormatInt(id, 10), nil, nil, &out)
+	return out, err
+}
+
+// ListBrains returns the brains matching opts, pinned first and then
+// newest first.
+func (c *Client) ListBrains(ctx context.Context, opts ListBrainsOptions) ([]Brain, error) {
+	var out []Brain
+	err := c.stream(ctx, "/brain", opts.query(), func(dec *json.Decoder) error {
+		var b Brain
+		if err := dec.Decode(&b); err != nil {
+			return err
+		}
+		out = append(out, b)
+		return nil
+	})
+	return out, err
+}
+
+// UpdateBrain replaces the editable fields of the brain with b.ID. b.Version
+// must be the version it was read at; if the brain changed since, the
+// error satisfies IsConflict. The updated brain carries the new version.
+func (c *Client) UpdateBrain(ctx context.Context, b Brain) (Brain, error) {
+	var out Brain
+	err := c.do(ctx, http.MethodPut, "/brain/"+strconv.FormatInt(b.ID, 10), nil, brainBody(b, &b.Version), &out)
+	return out, err
+}
+
+// SummarizeBrain asks the server's LLM for a short summary of the brain
+// with id's context. With save, the summary is also stored on the brain,
+// changing its version.
+func (c *Client) SummarizeBrain(ctx context.Context, id int64, save bool) (string, error) {
+	var out struct {
+		Summary string `json:"summary"`
+	}
+	q := url.Values{}
+	if save {
+		q.Set("store", "true")
+	}
+	err := c.do(ctx, http.MethodPost, "/brain/"+strconv.FormatInt(id, 10)+"/summarize", q, nil, &out)
+	return out.Summary, err
+}
+
+// DeleteBrain moves the brain with id to the trash.
+func (c *Client) DeleteBrain(ctx context.Context, id int64) error {
+	return c.do(ctx, http.MethodDelete, "/brain/"+strconv.FormatInt(id, 10), nil, nil, nil)
+}
+
+// brainBody is the request body for creating or, with a version, updating
+// a brain. Server-managed fields are left out.
+func brainBody(b Brain, version *int64) map[string]any {
+	body := map[string]any{
+		"title":    b.Title,
+		"context":  b.Context,
+		"project":  b.Project,
+		"commits":  b.Commits,
+		"tags":     b.Tags,
+		"pinned":   b.Pinned,
+		"favorite": b.Favorite,
+		"archived": b.Archived,
+	}
+	if b.RemindAt != "" {
+		body["remind_at"] = b.RemindAt
+	}
+	if version != nil {
+		body["version"] = *version
+	}
+	return body
+}
+
+// CreateLog stores l and returns it as persisted. OccurredAt defaults to
+// now on the server.
+func (c *Client) CreateLog(ctx context.Context, l Log) (Log, error) {
+	l.ID, l.CreatedAt = 0, ""
+	var out Log
+	err := c.do(ctx, http.MethodPost, "/logs", nil, l, &out)
+	return out, err
+}
+
+// LogBatchResult is what the server did with a batch from CreateLogs.
+type LogBatchResult struct {
+	Stored     int     `json:"stored"`
+	SampledOut int     `json:"sampled_out"`
+	IDs        []int64 `json:"ids"`
+	// Rejected are the logs that failed validation, by index in the batch,
+	// with the reasons.
+	Rejected []struct {
+		Index  int `json:"index"`
+		Fields []struct {
+			Field   string `json:"field"`
+			Message string `json:"message"`
+		} `json:"fields"`
+	} `json:"rejected"`
+}
+
+// CreateLogs stores up to 1000 logs in one request. Invalid logs are
+// skipped and listed in the result rather than failing the batch.
+func (c *Client) CreateLogs(ctx context.Context, logs []Log) (LogBatchResult, error) {
+	batch := make([]Log, len(logs))
+	for i, l := range logs {
+		l.ID, l.CreatedAt = 0, ""
+		batch[i] = l
+	}
+	var out LogBatchResult
+	err := c.do(ctx, http.MethodPost, "/logs/batch", nil, batch, &out)
+	return out, err
+}
+
+// GetLog returns the log with id.
+func (c *Client) GetLog(ctx context.Context, id int64) (Log, error) {
+	var out Log
+	err := c.do(ctx, http.MethodGet, "/logs/"+strconv.FormatInt(id, 10), nil, nil, &out)
+	return out, err
+}
+
+// ListLogs returns the logs matching opts, most recently occurred first.
+func (c *Client) ListLogs(ctx context.Context, opts ListLogsOptions) ([]Log, error) {
+	var out []Log
+	err := c.eachLog(ctx, opts, func(l Log) error {
+		out = append(out, l)
+		return nil
+	})
+	return out, err
+}
+
+// DeleteLog deletes the log with id.
+func (c *Client) DeleteLog(ctx context.Context, id int64) error {
+	return c.do(ctx, http.MethodDelete, "/logs/"+strconv.FormatInt(id, 10), nil, nil, nil)
+}
+
+// TailLogs calls fn, oldest first, for every log matching opts that occurs
+// from opts.Since (now when zero) on, polling the server every interval
+// (2s when zero) until ctx is done or fn returns an error. Logs backfilled
+// with an occurred_at before the last poll are not seen.
+func (c *Client) TailLogs(ctx context.Context, opts ListLogsOptions, interval time.Duration, fn func(Log) error) error {
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+	if opts.Since.IsZero() {
+		opts.Since = time.Now()
+	}
+	// Since is inclusive at second precision, so each poll re-reads the
+	// latest second delivered; seen holds the ids from that second.
+	seen := map[int64]bool{}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		var batch []Log
+		if err := c.eachLog(ctx, opts, func(l Log) error {
+			if !seen[l.ID] {
+				batch = append(batch, l)
+			}
+			return nil
+		}); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		if len(batch) > 0 {
+			latest, _ := batch[0].OccurredAt.Time()
+			if !latest.Equal(opts.Since.Truncate(time.Second)) {
+				seen = map[int64]bool{}
+			}
+			for i := len(batch) - 1; i >= 0; i-- {
+				if err := fn(batch[i]); err != nil {
+					return err
+				}
+				if t, _ := batch[i].OccurredAt.Time(); t.Equal(latest) {
+					seen[batch[i].ID] = true
+				}
+			}
+			opts.Since = latest
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// eachLog streams GET /logs as NDJSON, calling fn per log without holding
+// the whole result in memory.
+func (c *Client) eachLog(ctx context.Context, opts ListLogsOptions, fn func(Log) error) error {
+	return c.stream(ctx, "/logs", opts.query(), func(dec *json.Decoder) error {
+		var l Log
+		if err := dec.Decode(&l); err != nil {
+			return err
+		}
+		return fn(l)
+	})
+}
+
+// stream requests path as NDJSON and calls next once per line.
+func (c *Client) stream(ctx context.Context, path string, query url.Values, next func(*json.Decoder) error) error {
+	resp, err := c.send(ctx, http.MethodGet, path, query, nil, "application/x-ndjson")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	dec := json.NewDecoder(bufio.NewReader(resp.Body))
+	for dec.More() {
+		if err := next(dec); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// do sends body as JSON and decodes the response into out, when not nil.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, out any) error {
+	resp, err := c.send(ctx, method, path, query, body, "application/json")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("%s %s: decode response: %w", method, path, err)
+	}
+	return nil
+}
+
+// send makes one request and returns the response when it is a 2xx, and
+// an *Error otherwise.
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, body any, accept string) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("encode request: %w", err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	var envelope struct {
+		Error *Error `json:"error"`
+	}
+	if json.Unmarshal(raw, &envelope) != nil || envelope.Error == nil {
+		envelope.Error = &Error{Code: "error", Message: strings.TrimSpace(string(raw))}
+	}
+	envelope.Error.StatusCode = resp.StatusCode
+	return nil, envelope.Error
+}
@@ -0,0 +1,203 @@
+package sbrain
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"sbrain/store"
+)
+
+// configPragmas are the SQLite settings /admin/config reports. They are read
+// from a pooled connection, so per-connection settings show what that
+// connection uses.
+var configPragmas = []string{
+	"journal_mode", "synchronous", "foreign_keys", "busy_timeout",
+	"cache_size", "page_size", "auto_vacuum", "wal_autocheckpoint",
+}
+
+// secretEnvMarkers mark SBRAIN_* variables whose values /admin/config never
+// shows. Webhook and log forwarding URLs count, since their paths are often
+// credentials.
+var secretEnvMarkers = []string{"TOKEN", "SECRET", "PASSWORD", "KEY", "WEBHOOK", "DSN", "LOG_FORWARD"}
+
+// adminConfigHandler serves GET /admin/config: the configuration the server
+// is actually running with, resolved from the environment and the database,
+// so "which DB file is it using" is one request instead of a read through the
+// startup log. Secrets are reported only as set or not.
+func (s *Server) adminConfigHandler(w http.ResponseWriter, r *http.Request) {
+	database := map[string]any{"path": s.dbPath, "driver": "sqlite3"}
+	if s.dbPath == MemoryDB {
+		database["in_memory"] = true
+	} else if s.dbPath != "" {
+		resolved := s.dbPath
+		if abs, err := filepath.Abs(s.dbPath); err == nil {
+			resolved = abs
+		}
+		database["resolved_path"] = resolved
+		info, err := os.Stat(resolved)
+		database["exists"] = err == nil
+		if err == nil {
+			database["size_bytes"] = info.Size()
+		}
+	}
+	if os.Getenv("SBRAIN_REPLICA_DIR") != "" {
+		database["driver"] = replicatedDriverName
+	}
+	pragmas := map[string]any{}
+	for _, name := range configPragmas {
+		var value any
+		if err := s.db.QueryRowContext(r.Context(), "PRAGMA "+name).Scan(&value); err != nil {
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("read PRAGMA %s: %v", name, err))
+			return
+		}
+		if b, ok := value.([]byte); ok {
+			value = string(b)
+		}
+		pragmas[name] = value
+	}
+	database["pragmas"] = pragmas
+	stats := s.db.Stats()
+	database["pool"] = map[string]any{
+		"max_open_conns": stats.MaxOpenConnections,
+		"open":           stats.OpenConnections,
+		"in_use":         stats.InUse,
+		"idle":           stats.Idle,
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"database": database,
+		"timezone": store.DisplayLocation().String(),
+		"retention": map[string]any{
+			"trash_days": int(trashRetention().Hours() / 24),
+			"logs":       s.logRetention.describe(),
+		},
+		"require_log_service": s.requireLogService,
+		"timeouts": map[string]any{
+			"request": s.timeouts.request.String(),
+			"read":    s.timeouts.read.String(),
+			"write":   s.timeouts.write.String(),
+		},
+		"auth":        s.auth.describe(),
+		"features":    s.describeFeatures(),
+		"flags":       s.features.all(),
+		"environment": redactedEnvironment(),
+	})
+}
+
+// describe reports how requests are authenticated, naming keys but never
+// showing them.
+func (a *authConfig) describe() map[string]any {
+	mode := "none"
+	switch {
+	case len(a.apiKeys) > 0 && a.oidc != nil:
+		mode = "api_keys+oidc"
+	case len(a.apiKeys) > 0:
+		mode = "api_keys"
+	case a.oidc != nil:
+		mode = "oidc"
+	}
+	keys := []map[string]any{}
+	for _, key := range a.apiKeys {
+		k := map[string]any{"name": key.name, "scopes": key.scopes}
+		if key.project != "" {
+			k["project"] = key.project
+		}
+		if key.service != "" {
+			k["service"] = key.service
+		}
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i]["name"].(string) < keys[j]["name"].(string) })
+	desc := map[string]any{"mode": mode, "api_keys": keys}
+	if a.oidc != nil {
+		desc["oidc"] = map[string]any{
+			"issuer":        a.oidc.issuer,
+			"client_id":     a.oidc.clientID,
+			"redirect_url":  a.oidc.redirectURL,
+			"allowed_users": len(a.oidc.allowed),
+		}
+	}
+	return desc
+}
+
+// describeFeatures reports which optional features are on and how they are
+// set up.
+func (s *Server) describeFeatures() map[string]any {
+	dedupLevels := make([]string, 0, len(s.dedup.levels))
+	for level := range s.dedup.levels {
+		dedupLevels = append(dedupLevels, level)
+	}
+	sort.Strings(dedupLevels)
+	samplingRules := []string{}
+	for level, rate := range s.sample.levels {
+		samplingRules = append(samplingRules, fmt.Sprintf("%s=%g", level, rate))
+	}
+	sort.Strings(samplingRules)
+	for _, e := range s.sample.endpoints {
+		path := e.path
+		if e.prefix {
+			path += "*"
+		}
+		samplingRules = append(samplingRules, fmt.Sprintf("%s=%g", path, e.rate))
+	}
+	s.scrub.mu.RLock()
+	scrubRules := len(s.scrub.rules)
+	s.scrub.mu.RUnlock()
+
+	llm := map[string]any{"enabled": s.llm != nil}
+	if s.llm != nil {
+		llm["url"], llm["model"] = s.llm.baseURL, s.llm.model
+	}
+	return map[string]any{
+		"log_dedup":     map[string]any{"enabled": len(dedupLevels) > 0, "levels": dedupLevels, "window": s.dedup.window.String()},
+		"log_sampling":  map[string]any{"enabled": len(samplingRules) > 0, "rules": samplingRules},
+		"log_scrubbing": map[string]any{"enabled": scrubRules > 0, "rules": scrubRules},
+		"geoip":         map[string]any{"enabled": s.geo != nil, "db": os.Getenv("SBRAIN_GEOIP_DB")},
+		"llm":           llm,
+		"disk_protect": map[string]any{
+			"enabled":        s.disk.protect,
+			"warn_bytes":     s.disk.warnBytes,
+			"critical_bytes": s.disk.criticalBytes,
+		},
+		"replication":      map[string]any{"enabled": os.Getenv("SBRAIN_REPLICA_DIR") != "", "dir": os.Getenv("SBRAIN_REPLICA_DIR")},
+		"notion":           map[string]any{"enabled": os.Getenv("SBRAIN_NOTION_TOKEN") != ""},
+		"git_daily":        map[string]any{"repos": os.Getenv("SBRAIN_GIT_REPOS")},
+		"jira":             map[string]any{"enabled": os.Getenv("SBRAIN_JIRA_URL") != ""},
+		"linear":           map[string]any{"enabled": os.Getenv("SBRAIN_LINEAR_API_KEY") != ""},
+		"slack":            map[string]any{"enabled": os.Getenv("SBRAIN_SLACK_SIGNING_SECRET") != ""},
+		"email_ingest":     map[string]any{"enabled": os.Getenv("SBRAIN_EMAIL_INBOUND_TOKEN") != "" || os.Getenv("SBRAIN_MAILGUN_SIGNING_KEY") != ""},
+		"smtp":             map[string]any{"enabled": os.Getenv("SBRAIN_SMTP_ADDR") != ""},
+		"brain_send":       map[string]any{"enabled": os.Getenv("SBRAIN_SMTP_ADDR") != "" && len(sendRecipients()) > 0, "recipients": len(sendRecipients())},
+		"sentry":           map[string]any{"enabled": s.sentry != nil},
+		"error_forwarding": s.forwarder.describe(),
+		"log_forwarding":   s.logForward.describe(),
+	}
+}
+
+// redactedEnvironment returns every SBRAIN_* variable that is set. Secret
+// values read "[redacted]", and passwords in URLs are masked.
+func redactedEnvironment() map[string]string {
+	env := map[string]string{}
+	for _, kv := range os.Environ() {
+		name, value, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(name, "SBRAIN_") {
+			continue
+		}
+		switch {
+		case slices.ContainsFunc(secretEnvMarkers, func(m string) bool { return strings.Contains(name, m) }):
+			value = "[redacted]"
+		case strings.Contains(value, "://"):
+			if u, err := url.Parse(value); err == nil {
+				value = u.Redacted()
+			}
+		}
+		env[name] = value
+	}
+	return env
+}
@@ -0,0 +1,371 @@
+package sbrain
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"sbrain/store"
+)
+
+// dbProgress is one step of an admin database operation.
+type dbProgress struct {
+	Step   string `json:"step"`
+	Done   int    `json:"done"`
+	Total  int    `json:"total"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// dbOperation does the work of one /admin/db endpoint, calling progress as
+// it goes, and returns the result to report.
+type dbOperation func(ctx context.Context, progress func(dbProgress)) (any, error)
+
+// runDBOperation serves an /admin/db endpoint. One operation runs at a
+// time. With Accept: application/x-ndjson each progress step is streamed as
+// a {"progress": ...} line as it happens and the stream ends with a
+// {"result": ...} or {"error": ...} line; otherwise the answer is the
+// result once the operation is done.
+func (s *Server) runDBOperation(name string, op dbOperation) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.dbOperation.TryLock() {
+			writeError(w, r, http.StatusConflict, "another database operation is running")
+			return
+		}
+		defer s.dbOperation.Unlock()
+
+		started := time.Now()
+		if !wantsNDJSON(r) {
+			result, err := op(r.Context(), func(dbProgress) {})
+			logDBOperation(name, started, err)
+			if err != nil {
+				writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("%s: %v", name, err))
+				return
+			}
+			writeJSON(w, http.StatusOK, result)
+			return
+		}
+
+		nd := newNDJSONWriter(w)
+		flush := func() {
+			if nd.flusher != nil {
+				nd.flusher.Flush()
+			}
+		}
+		result, err := op(r.Context(), func(p dbProgress) {
+			_ = nd.Write(map[string]any{"progress": p})
+			flush()
+		})
+		logDBOperation(name, started, err)
+		if err != nil {
+			_ = nd.Write(map[string]any{"error": fmt.Sprintf("%s: %v", name, err)})
+		} else {
+			_ = nd.Write(map[string]any{"result": result})
+		}
+		flush()
+	}
+}
+
+func logDBOperation(name string, started time.Time, err error) {
+	if err != nil {
+		log.Printf("admin %s failed after %s: %v", name, time.Since(started).Round(time.Millisecond), err)
+		return
+	}
+	log.Printf("admin %s done in %s", name, time.Since(started).Round(time.Millisecond))
+}
+
+// dbTables lists the database's tables, SQLite's own excepted.
+func (s *Server) dbTables(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT name FROM sqlite_master
+		WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("list tables: %w", err)
+	}
+	defer rows.Close()
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("scan table: %w", err)
+		}
+		tables = append(tables, name)
+	}
+	return tables, rows.Err()
+}
+
+// dbPages returns the database's size and its free pages.
+func (s *Server) dbPages(ctx context.Context) (sizeBytes int64, freePages int64, err error) {
+	var pageCount, pageSize int64
+	if err := s.db.QueryRowContext(ctx, `SELECT page_count, page_size, freelist_count
+		FROM pragma_page_count(), pragma_page_size(), pragma_freelist_count()`).Scan(&pageCount, &pageSize, &freePages); err != nil {
+		return 0, 0, fmt.Errorf("read page counts: %w", err)
+	}
+	return pageCount * pageSize, freePages, nil
+}
+
+// vacuumDatabase serves POST /admin/db/vacuum: VACUUM rebuilds the file,
+// returning free pages to the filesystem. Reads carry on meanwhile; writes
+// wait for it within the busy timeout.
+func (s *Server) vacuumDatabase(ctx context.Context, progress func(dbProgress)) (any, error) {
+	const total = 3
+	before, freeBefore, err := s.dbPages(ctx)
+	if err != nil {
+		return nil, err
+	}
+	progress(dbProgress{Step: "measure", Done: 1, Total: total,
+		Detail: fmt.Sprintf("%d bytes, %d free pages", before, freeBefore)})
+
+	started := time.Now()
+	if _, err := s.db.ExecContext(ctx, `VACUUM`); err != nil {
+		return nil, err
+	}
+	progress(dbProgress{Step: "vacuum", Done: 2, Total: total,
+		Detail: "took " + time.Since(started).Round(time.Millisecond).String()})
+
+	after, freeAfter, err := s.dbPages(ctx)
+	if err != nil {
+		return nil, err
+	}
+	progress(dbProgress{Step: "measure", Done: 3, Total: total,
+		Detail: fmt.Sprintf("%d bytes, %d free pages", after, freeAfter)})
+	return map[string]any{
+		"bytes_before":      before,
+		"bytes_after":       after,
+		"freed_bytes":       before - after,
+		"free_pages_before": freeBefore,
+		"free_pages_after":  freeAfter,
+		"duration_ms":       time.Since(started).Milliseconds(),
+	}, nil
+}
+
+// maxIntegrityProblems caps the problems integrity_check reports per table.
+const maxIntegrityProblems = 100
+
+// integrityCheckDatabase serves POST /admin/db/integrity-check: PRAGMA
+// quick_check over the whole file, then PRAGMA integrity_check table by
+// table, so progress can be followed on a large database.
+func (s *Server) integrityCheckDatabase(ctx context.Context, progress func(dbProgress)) (any, error) {
+	tables, err := s.dbTables(ctx)
+	if err != nil {
+		return nil, err
+	}
+	total := len(tables) + 1
+	started := time.Now()
+
+	quick, err := s.checkPragma(ctx, `PRAGMA quick_check(`+strconv.Itoa(maxIntegrityProblems)+`)`)
+	if err != nil {
+		return nil, fmt.Errorf("quick_check: %w", err)
+	}
+	progress(dbProgress{Step: "quick_check", Done: 1, Total: total, Detail: summarizeCheck(quick)})
+
+	problems := map[string][]string{}
+	for i, table := range tables {
+		found, err := s.checkPragma(ctx, fmt.Sprintf(`PRAGMA integrity_check(%q)`, table))
+		if err != nil {
+			return nil, fmt.Errorf("integrity_check %s: %w", table, err)
+		}
+		if len(found) > 0 {
+			problems[table] = found
+		}
+		progress(dbProgress{Step: "integrity_check " + table, Done: i + 2, Total: total, Detail: summarizeCheck(found)})
+	}
+	if quick == nil {
+		quick = []string{}
+	}
+	return map[string]any{
+		"ok":              len(quick) == 0 && len(problems) == 0,
+		"quick_check":     quick,
+		"integrity_check": problems,
+		"tables":          len(tables),
+		"duration_ms":     time.Since(started).Milliseconds(),
+	}, nil
+}
+
+// checkPragma runs a quick_check or integrity_check and returns the
+// problems it reports, nil when the answer is "ok".
+func (s *Server) checkPragma(ctx context.Context, query string) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var problems []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return nil, err
+		}
+		if line != "ok" {
+			problems = append(problems, line)
+		}
+	}
+	return problems, rows.Err()
+}
+
+func summarizeCheck(problems []string) string {
+	if len(problems) == 0 {
+		return "ok"
+	}
+	return fmt.Sprintf("%d problem(s)", len(problems))
+}
+
+// analyzeDatabase serves POST /admin/db/analyze: ANALYZE table by table,
+// refreshing the statistics the query planner picks indexes with, then
+// PRAGMA optimize.
+func (s *Server) analyzeDatabase(ctx context.Context, progress func(dbProgress)) (any, error) {
+	tables, err := s.dbTables(ctx)
+	if err != nil {
+		return nil, err
+	}
+	total := len(tables) + 1
+	started := time.Now()
+	for i, table := range tables {
+		if _, err := s.db.ExecContext(ctx, fmt.Sprintf(`ANALYZE %q`, table)); err != nil {
+			return nil, fmt.Errorf("analyze %s: %w", table, err)
+		}
+		progress(dbProgress{Step: "analyze " + table, Done: i + 1, Total: total})
+	}
+	if _, err := s.db.ExecContext(ctx, `PRAGMA optimize`); err != nil {
+		return nil, fmt.Errorf("optimize: %w", err)
+	}
+	progress(dbProgress{Step: "optimize", Done: total, Total: total})
+	return map[string]any{
+		"tables":      len(tables),
+		"duration_ms": time.Since(started).Milliseconds(),
+	}, nil
+}
+
+// explainQueries are the canned queries /admin/db/explain shows plans for,
+// built the way their endpoints build them from the same query string.
+var explainQueries = []struct {
+	name  string
+	build func(q url.Values) (string, []any, error)
+}{
+	{"list_brains", func(q url.Values) (string, []any, error) {
+		filter, err := parseBrainFilter(q)
+		if err != nil {
+			return "", nil, err
+		}
+		query, args := store.ListBrainsQuery(filter)
+		return query, args, nil
+	}},
+	{"list_logs", func(q url.Values) (string, []any, error) {
+		filter, err := parseLogFilter(q)
+		if err != nil {
+			return "", nil, err
+		}
+		query, args := store.ListLogsQuery(filter)
+		return query, args, nil
+	}},
+	{"log_stats", func(q url.Values) (string, []any, error) {
+		filter, err := parseLogFilter(q)
+		if err != nil {
+			return "", nil, err
+		}
+		where, args := filter.Where()
+		return `SELECT COALESCE(SUM(count), 0) FROM logs` + where, args, nil
+	}},
+}
+
+// queryPlanStep is one row of EXPLAIN QUERY PLAN.
+type queryPlanStep struct {
+	ID     int    `json:"id"`
+	Parent int    `json:"parent"`
+	Detail string `json:"detail"`
+}
+
+type queryPlan struct {
+	Query string          `json:"query"`
+	SQL   string          `json:"sql"`
+	Args  []any           `json:"args"`
+	Plan  []queryPlanStep `json:"plan"`
+	// Scans are the steps that read a whole table, the ones a missing
+	// index shows up as.
+	Scans []string `json:"scans"`
+}
+
+// explainHandler serves GET /admin/db/explain: the SQLite query plan of
+// the canned list queries, or of the one named by ?query=, for the filters
+// in the rest of the query string (as the list endpoint takes them), to see
+// which indexes a slow list uses.
+func (s *Server) explainHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	name := q.Get("query")
+	q.Del("query")
+	plans := []queryPlan{}
+	for _, canned := range explainQueries {
+		if name != "" && canned.name != name {
+			continue
+		}
+		query, args, err := canned.build(q)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		plan, err := s.explain(r.Context(), query, args)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("explain %s: %v", canned.name, err))
+			return
+		}
+		plan.Query = canned.name
+		plans = append(plans, plan)
+	}
+	if len(plans) == 0 {
+		names := make([]string, 0, len(explainQueries))
+		for _, canned := range explainQueries {
+			names = append(names, canned.name)
+		}
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("unknown query %q: expected one of %s", name, strings.Join(names, ", ")))
+		return
+	}
+	writeJSON(w, http.StatusOK, plans)
+}
+
+func (s *Server) explain(ctx context.Context, query string, args []any) (queryPlan, error) {
+	plan := queryPlan{SQL: strings.Join(strings.Fields(query), " "), Args: args, Plan: []queryPlanStep{}, Scans: []string{}}
+	if plan.Args == nil {
+		plan.Args = []any{}
+	}
+	rows, err := s.db.QueryContext(ctx, `EXPLAIN QUERY PLAN `+query, args...)
+	if err != nil {
+		return plan, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var step queryPlanStep
+		var unused int
+		if err := rows.Scan(&step.ID, &step.Parent, &unused, &step.Detail); err != nil {
+			return plan, err
+		}
+		plan.Plan = append(plan.Plan, step)
+		if strings.HasPrefix(step.Detail, "SCAN ") && !strings.Contains(step.Detail, " USING ") {
+			plan.Scans = append(plan.Scans, step.Detail)
+		}
+	}
+	return plan, rows.Err()
+}
+
+// dbOperationSpec documents an /admin/db endpoint in the OpenAPI spec.
+func dbOperationSpec(summary, operationID string, result map[string]any) map[string]any {
+	return map[string]any{
+		"post": map[string]any{
+			"summary":     summary,
+			"description": "Needs the admin scope. One database operation runs at a time. With Accept: application/x-ndjson, each step streams as a {\"progress\": {step, done, total, detail}} line and the stream ends with {\"result\": ...} or {\"error\": ...}.",
+			"operationId": operationID,
+			"responses": map[string]any{
+				"200": map[string]any{
+					"description": "The result, or the progress stream",
+					"content": map[string]any{
+						"application/json":     map[string]any{"schema": result},
+						"application/x-ndjson": map[string]any{"schema": map[string]any{"type": "string"}},
+					},
+				},
+				"409": map[string]any{"description": "Another database operation is running"},
+			},
+		},
+	}
+}
@@ -0,0 +1,402 @@
+package sbrain
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"sbrain/store"
+)
+
+// alertRule fires when more than Threshold logs matching its filters were
+// written within the last WindowMinutes. After firing it stays quiet for one
+// window so a sustained burst produces one alert, not one per minute.
+type alertRule struct {
+	ID              int64     `json:"id"`
+	CreatedAt       timestamp `json:"created_at"`
+	Name            string    `json:"name"`
+	Level           string    `json:"level"`
+	Endpoint        string    `json:"endpoint"`
+	Method          string    `json:"method"`
+	StatusCode      int       `json:"status_code"`
+	MessageContains string    `json:"message_contains"`
+	Threshold       int       `json:"threshold"`
+	WindowMinutes   int       `json:"window_minutes"`
+	Channel         string    `json:"channel"`
+	Target          string    `json:"target"`
+	Enabled         bool      `json:"enabled"`
+	IncidentNote    bool      `json:"incident_note"`
+	LastFiredAt     timestamp `json:"last_fired_at"`
+}
+
+type alertEvent struct {
+	ID             int64     `json:"id"`
+	CreatedAt      timestamp `json:"created_at"`
+	RuleID         int64     `json:"rule_id"`
+	RuleName       string    `json:"rule_name"`
+	Count          int       `json:"count"`
+	WindowStart    timestamp `json:"window_start"`
+	WindowEnd      timestamp `json:"window_end"`
+	Delivered      bool      `json:"delivered"`
+	DeliveryError  string    `json:"delivery_error"`
+	AcknowledgedAt timestamp `json:"acknowledged_at"`
+	AcknowledgedBy string    `json:"acknowledged_by"`
+	BrainID        *int64    `json:"brain_id,omitempty"`
+}
+
+const alertRuleColumns = `id, created_at, name, level, endpoint, method, status_code, message_contains,
+	threshold, window_minutes, channel, target, enabled, incident_note, last_fired_at`
+
+const alertEventColumns = `id, created_at, rule_id, rule_name, count, window_start, window_end,
+	delivered, delivery_error, acknowledged_at, acknowledged_by, brain_id`
+
+func scanAlertRule(row interface{ Scan(...any) error }) (alertRule, error) {
+	var a alertRule
+	err := row.Scan(&a.ID, &a.CreatedAt, &a.Name, &a.Level, &a.Endpoint, &a.Method, &a.StatusCode, &a.MessageContains,
+		&a.Threshold, &a.WindowMinutes, &a.Channel, &a.Target, &a.Enabled, &a.IncidentNote, &a.LastFiredAt)
+	return a, err
+}
+
+func scanAlertEvent(row interface{ Scan(...any) error }) (alertEvent, error) {
+	var e alertEvent
+	var brainID sql.NullInt64
+	err := row.Scan(&e.ID, &e.CreatedAt, &e.RuleID, &e.RuleName, &e.Count, &e.WindowStart, &e.WindowEnd,
+		&e.Delivered, &e.DeliveryError, &e.AcknowledgedAt, &e.AcknowledgedBy, &brainID)
+	if brainID.Valid {
+		e.BrainID = &brainID.Int64
+	}
+	return e, err
+}
+
+func (s *Server) listAlertRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := s.loadAlertRules(r.Context(), false)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, rules)
+}
+
+func (s *Server) createAlertRule(w http.ResponseWriter, r *http.Request) {
+	req := alertRule{Enabled: true}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("decode body: %v", err))
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	req.Target = strings.TrimSpace(req.Target)
+	req.Method = strings.ToUpper(strings.TrimSpace(req.Method))
+	switch {
+	case req.Name == "":
+		writeError(w, r, http.StatusBadRequest, "name is required")
+		return
+	case req.Threshold < 0:
+		writeError(w, r, http.StatusBadRequest, "threshold must not be negative")
+		return
+	case req.WindowMinutes < 1:
+		writeError(w, r, http.StatusBadRequest, "window_minutes must be at least 1")
+		return
+	case req.Channel != "webhook" && req.Channel != "slack" && req.Channel != "email":
+		writeError(w, r, http.StatusBadRequest, "channel must be webhook, slack or email")
+		return
+	case req.Target == "":
+		writeError(w, r, http.StatusBadRequest, "target is required")
+		return
+	}
+
+	res, err := s.db.ExecContext(r.Context(), `INSERT INTO alert_rules (name, level, endpoint, method, status_code, message_contains,
+		threshold, window_minutes, channel, target, enabled, incident_note)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, req.Name, req.Level, req.Endpoint, req.Method, req.StatusCode,
+		req.MessageContains, req.Threshold, req.WindowMinutes, req.Channel, req.Target, req.Enabled, req.IncidentNote)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("insert alert rule: %v", err))
+		return
+	}
+
+	id, _ := res.LastInsertId()
+	rule, err := scanAlertRule(s.db.QueryRowContext(r.Context(), `SELECT `+alertRuleColumns+` FROM alert_rules WHERE id = ?`, id))
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("load alert rule: %v", err))
+		return
+	}
+	s.recordAudit(r.Context(), auditCreate, "alert_rule", rule.ID, nil, rule)
+	writeJSONStatus(w, http.StatusCreated, rule)
+}
+
+// deleteAlertRule serves DELETE /admin/alerts/rules/{id}.
+func (s *Server) deleteAlertRule(w http.ResponseWriter, r *http.Request, id int64) {
+	rule, err := scanAlertRule(s.db.QueryRowContext(r.Context(), `SELECT `+alertRuleColumns+` FROM alert_rules WHERE id = ?`, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, r, http.StatusNotFound, "not found")
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("query alert rule: %v", err))
+		return
+	}
+	if _, err := s.db.ExecContext(r.Context(), `DELETE FROM alert_rules WHERE id = ?`, id); err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("delete alert rule: %v", err))
+		return
+	}
+	s.recordAudit(r.Context(), auditDelete, "alert_rule", id, rule, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) loadAlertRules(ctx context.Context, enabledOnly bool) ([]alertRule, error) {
+	query := `SELECT ` + alertRuleColumns + ` FROM alert_rules`
+	if enabledOnly {
+		query += ` WHERE enabled = 1`
+	}
+	rows, err := s.db.QueryContext(ctx, query+` ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("query alert rules: %w", err)
+	}
+	defer rows.Close()
+
+	items := []alertRule{}
+	for rows.Next() {
+		rule, err := scanAlertRule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan alert rule: %w", err)
+		}
+		items = append(items, rule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate alert rules: %w", err)
+	}
+	return items, nil
+}
+
+// alertEventsHandler lists fired alerts, newest first. ?rule_id narrows to
+// one rule and ?unacknowledged=true hides acknowledged ones.
+func (s *Server) alertEventsHandler(w http.ResponseWriter, r *http.Request) {
+	var clauses []string
+	var args []any
+	if raw := r.URL.Query().Get("rule_id"); raw != "" {
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "invalid rule_id")
+			return
+		}
+		clauses = append(clauses, "rule_id = ?")
+		args = append(args, id)
+	}
+	if r.URL.Query().Get("unacknowledged") == "true" {
+		clauses = append(clauses, "acknowledged_at = ''")
+	}
+
+	query := `SELECT ` + alertEventColumns + ` FROM alert_events`
+	if len(clauses) > 0 {
+		query += " WHERE " + strings.Join(clauses, " AND ")
+	}
+	rows, err := s.db.QueryContext(r.Context(), query+` ORDER BY id DESC`, args...)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("query alert events: %v", err))
+		return
+	}
+	defer rows.Close()
+
+	items := []alertEvent{}
+	for rows.Next() {
+		e, err := scanAlertEvent(rows)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("scan alert event: %v", err))
+			return
+		}
+		items = append(items, e)
+	}
+	if err := rows.Err(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("iterate alert events: %v", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+// ackAlertEvent serves POST /alerts/{id}/ack.
+func (s *Server) ackAlertEvent(w http.ResponseWriter, r *http.Request, id int64) {
+	before, err := scanAlertEvent(s.db.QueryRowContext(r.Context(), `SELECT `+alertEventColumns+` FROM alert_events WHERE id = ?`, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, r, http.StatusNotFound, "not found")
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("query alert event: %v", err))
+		return
+	}
+	if before.AcknowledgedAt != "" {
+		writeJSON(w, http.StatusOK, before)
+		return
+	}
+
+	after := before
+	after.AcknowledgedAt = store.NewTimestamp(time.Now())
+	after.AcknowledgedBy = actorFromContext(r.Context())
+	if _, err := s.db.ExecContext(r.Context(), `UPDATE alert_events SET acknowledged_at = ?, acknowledged_by = ? WHERE id = ?`,
+		after.AcknowledgedAt, after.AcknowledgedBy, id); err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("acknowledge alert: %v", err))
+		return
+	}
+	s.recordAudit(r.Context(), auditUpdate, "alert_event", id, before, after)
+	writeJSON(w, http.StatusOK, after)
+}
+
+// runAlertEvaluator checks every enabled rule and every heartbeat once a
+// minute.
+func (s *Server) runAlertEvaluator(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.evaluateAlerts(ctx, now.UTC())
+			s.evaluateHeartbeats(ctx, now.UTC())
+		}
+	}
+}
+
+func (s *Server) evaluateAlerts(ctx context.Context, now time.Time) {
+	rules, err := s.loadAlertRules(ctx, true)
+	if err != nil {
+		log.Printf("alert evaluator: %v", err)
+		return
+	}
+
+	for _, rule := range rules {
+		window := time.Duration(rule.WindowMinutes) * time.Minute
+		if last, ok := rule.LastFiredAt.Time(); ok && now.Sub(last) < window {
+			continue
+		}
+
+		start := now.Add(-window)
+		count, err := s.countAlertMatches(ctx, rule, start)
+		if err != nil {
+			log.Printf("alert evaluator: rule %d: %v", rule.ID, err)
+			continue
+		}
+		if count <= rule.Threshold {
+			continue
+		}
+		if err := s.fireAlert(ctx, rule, count, start, now); err != nil {
+			log.Printf("alert evaluator: rule %d: %v", rule.ID, err)
+		}
+	}
+}
+
+func (s *Server) countAlertMatches(ctx context.Context, rule alertRule, start time.Time) (int, error) {
+	where, args := alertMatchWhere(rule, start)
+	var count int
+	if err := s.db.QueryRowContext(ctx, `SELECT COALESCE(SUM(count), 0) FROM logs`+where, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("count matching logs: %w", err)
+	}
+	return count, nil
+}
+
+// alertMatchWhere selects the logs rule counts that occurred since start.
+func alertMatchWhere(rule alertRule, start time.Time) (string, []any) {
+	filter := logFilter{
+		Level:      rule.Level,
+		Endpoint:   rule.Endpoint,
+		Method:     rule.Method,
+		StatusCode: rule.StatusCode,
+		Since:      start.Format(sqliteTimeLayout),
+	}
+	where, args := filter.Where()
+	if rule.MessageContains != "" {
+		where += ` AND instr(message, ?) > 0`
+		args = append(args, rule.MessageContains)
+	}
+	return where, args
+}
+
+// fireAlert records an alert event and delivers it. The event is kept even
+// when delivery fails, with the error attached.
+func (s *Server) fireAlert(ctx context.Context, rule alertRule, count int, start time.Time, end time.Time) error {
+	e := alertEvent{
+		CreatedAt:   store.NewTimestamp(end),
+		RuleID:      rule.ID,
+		RuleName:    rule.Name,
+		Count:       count,
+		WindowStart: store.NewTimestamp(start),
+		WindowEnd:   store.NewTimestamp(end),
+	}
+	res, err := s.db.ExecContext(ctx, `INSERT INTO alert_events (created_at, rule_id, rule_name, count, window_start, window_end)
+		VALUES (?, ?, ?, ?, ?, ?)`, e.CreatedAt, e.RuleID, e.RuleName, e.Count, e.WindowStart, e.WindowEnd)
+	if err != nil {
+		return fmt.Errorf("insert alert event: %w", err)
+	}
+	e.ID, _ = res.LastInsertId()
+	if _, err := s.db.ExecContext(ctx, `UPDATE alert_rules SET last_fired_at = ? WHERE id = ?`, e.WindowEnd, rule.ID); err != nil {
+		return fmt.Errorf("update last_fired_at: %w", err)
+	}
+	if rule.IncidentNote {
+		// A failed note must not hold up the alert itself.
+		if id, err := s.createIncidentNote(rule, e, start); err != nil {
+			log.Printf("alert evaluator: rule %d: incident note: %v", rule.ID, err)
+		} else {
+			e.BrainID = &id
+		}
+	}
+
+	deliveryErr := s.deliverAlert(rule, e)
+	if deliveryErr != nil {
+		e.DeliveryError = deliveryErr.Error()
+	} else {
+		e.Delivered = true
+	}
+	if _, err := s.db.ExecContext(ctx, `UPDATE alert_events SET delivered = ?, delivery_error = ?, brain_id = ? WHERE id = ?`,
+		e.Delivered, e.DeliveryError, e.BrainID, e.ID); err != nil {
+		return fmt.Errorf("record delivery of alert %d: %w", e.ID, err)
+	}
+	s.recordAudit(withActor(ctx, "system"), auditCreate, "alert_event", e.ID, nil, e)
+
+	if deliveryErr != nil {
+		return fmt.Errorf("deliver via %s: %w", rule.Channel, deliveryErr)
+	}
+	return nil
+}
+
+func (s *Server) deliverAlert(rule alertRule, e alertEvent) error {
+	text := fmt.Sprintf("sbrain alert %q: %d matching logs between %s and %s UTC (threshold %d)",
+		rule.Name, e.Count, e.WindowStart, e.WindowEnd, rule.Threshold)
+	if e.BrainID != nil {
+		text += fmt.Sprintf("; incident note: brain record %d", *e.BrainID)
+	}
+	return s.notify(rule.Channel, rule.Target, "sbrain alert: "+rule.Name, text, map[string]any{"rule": rule, "event": e})
+}
+
+// notifyChannels are the channels alerts and other notifications go out on.
+var notifyChannels = []string{"webhook", "slack", "email"}
+
+// notify sends text over channel to target: a Slack incoming webhook, an
+// email address (with subject), or a webhook URL, which gets payload with
+// text added. Webhooks are skipped while the webhooks flag is off.
+func (s *Server) notify(channel, target, subject, text string, payload map[string]any) error {
+	switch channel {
+	case "slack":
+		return sendSlackMessage(target, text)
+	case "email":
+		return sendDigestEmail(target, subject, text)
+	case "webhook":
+		if !s.features.enabled(featureWebhooks) {
+			return errWebhooksOff
+		}
+		body := map[string]any{"text": text}
+		for k, v := range payload {
+			body[k] = v
+		}
+		return postJSONWebhook(target, body)
+	default:
+		return fmt.Errorf("unsupported channel %q", channel)
+	}
+}
@@ -0,0 +1,238 @@
+package sbrain
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiVersion is the version of the API a request is served under. v1 is
+// the API as it has always been and what unversioned requests get. v2
+// guarantees [] rather than null for empty lists, APIError bodies for every
+// error, and the response envelope on every JSON response.
+type apiVersion int
+
+const (
+	apiV1 apiVersion = 1
+	apiV2 apiVersion = 2
+
+	latestAPIVersion = apiV2
+)
+
+// apiVersionLifecycle is when a version was deprecated and when it stops
+// being served. Responses from a deprecated version carry Deprecation
+// (RFC 9745), Sunset (RFC 8594) and a Link to the successor version.
+type apiVersionLifecycle struct {
+	deprecated time.Time
+	sunset     time.Time
+}
+
+// apiVersionLifecycles lists the versions that are on their way out. v1 was
+// deprecated when v2 shipped and is served for a year after.
+var apiVersionLifecycles = map[apiVersion]apiVersionLifecycle{
+	apiV1: {
+		deprecated: time.Date(2026, time.October, 15, 0, 0, 0, 0, time.UTC),
+		sunset:     time.Date(2027, time.October, 15, 0, 0, 0, 0, time.UTC),
+	},
+}
+
+// setDeprecationHeaders marks a response served under a deprecated version.
+// path is the request's path without a version prefix.
+func setDeprecationHeaders(h http.Header, v apiVersion, path string) {
+	lifecycle, ok := apiVersionLifecycles[v]
+	if !ok {
+		return
+	}
+	h.Set("Deprecation", fmt.Sprintf("@%d", lifecycle.deprecated.Unix()))
+	h.Set("Sunset", lifecycle.sunset.Format(http.TimeFormat))
+	h.Add("Link", fmt.Sprintf(`</v%d%s>; rel="successor-version"`, latestAPIVersion, path))
+}
+
+// apiVersionMediaType is the Accept media type that selects version v
+// without a path prefix, such as application/vnd.sbrain.v2+json.
+func apiVersionMediaType(v apiVersion) string {
+	return "application/vnd.sbrain.v" + strconv.Itoa(int(v)) + "+json"
+}
+
+type apiVersionContextKey struct{}
+
+// apiVersionFrom returns the version the request is served under.
+func apiVersionFrom(ctx context.Context) apiVersion {
+	if v, ok := ctx.Value(apiVersionContextKey{}).(apiVersion); ok {
+		return v
+	}
+	return apiV1
+}
+
+// requestedAPIVersion picks the version from a /v1 or /v2 path prefix,
+// returning the path without it, or else from the Accept header. A version that does not exist is an error rather
+// than a fallback, so clients find out. Paths mux serves as they are, such
+// as OTLP's POST /v1/logs, are never taken for a prefix.
+func requestedAPIVersion(mux *http.ServeMux, r *http.Request) (v apiVersion, path string, ok bool) {
+	if _, pattern := mux.Handler(r); pattern == "" {
+		if rest, found := strings.CutPrefix(r.URL.Path, "/v"); found {
+			digits, tail, _ := strings.Cut(rest, "/")
+			if n, err := strconv.Atoi(digits); err == nil && digits[0] != '0' {
+				if n < int(apiV1) || n > int(latestAPIVersion) {
+					return 0, "", false
+				}
+				return apiVersion(n), "/" + tail, true
+			}
+		}
+	}
+	for v := apiV1; v <= latestAPIVersion; v++ {
+		if accepts(r, apiVersionMediaType(v)) {
+			return v, r.URL.Path, true
+		}
+	}
+	return apiV1, r.URL.Path, true
+}
+
+// accepts reports whether r's Accept header lists mediaType.
+func accepts(r *http.Request, mediaType string) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mt, _, err := mime.ParseMediaType(strings.TrimSpace(part)); err == nil && mt == mediaType {
+			return true
+		}
+	}
+	return false
+}
+
+// apiVersionMiddleware resolves the API version of every request, strips a
+// version prefix from the path so the middleware and routes below see the
+// same paths in every version, and reports the version served in
+// X-API-Version, with deprecation headers for old ones.
+func apiVersionMiddleware(router *versionedRouter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v, path, ok := requestedAPIVersion(router.muxes[apiV1], r)
+		if !ok {
+			writeError(w, r, http.StatusNotFound, "unknown API version; use /v1 or /v2")
+			return
+		}
+		w.Header().Set("X-API-Version", strconv.Itoa(int(v)))
+		setDeprecationHeaders(w.Header(), v, path)
+		if path != r.URL.Path {
+			r = r.Clone(r.Context())
+			r.URL.Path = path
+			r.URL.RawPath = ""
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiVersionContextKey{}, v)))
+	})
+}
+
+// listBody returns items for a JSON list response. A nil slice encodes as
+// null, which v1 has always returned for an empty list; later versions get
+// [].
+func listBody[T any](ctx context.Context, items []T) []T {
+	if items == nil && apiVersionFrom(ctx) >= apiV2 {
+		return []T{}
+	}
+	return items
+}
+
+// versionedRouter serves each request from the router of its API version.
+// Every version's router is generated from the same registry: the routes
+// every version shares, with the routes a version changes laid over them.
+type versionedRouter struct {
+	muxes    map[apiVersion]*http.ServeMux
+	handlers map[apiVersion]http.Handler
+}
+
+func newVersionedRouter(shared []route, changed map[apiVersion][]route) *versionedRouter {
+	vr := &versionedRouter{muxes: map[apiVersion]*http.ServeMux{}, handlers: map[apiVersion]http.Handler{}}
+	for v := apiV1; v <= latestAPIVersion; v++ {
+		mux := newRouter(routesForVersion(shared, changed, v))
+		vr.muxes[v] = mux
+		vr.handlers[v] = jsonMuxErrors(mux)
+	}
+	return vr
+}
+
+func (vr *versionedRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	vr.handlers[apiVersionFrom(r.Context())].ServeHTTP(w, r)
+}
+
+// routesForVersion returns the routes version v serves: shared, with every
+// change made in v or an earlier version applied in order. A change
+// replaces the route with the same pattern, or adds one; a change with a
+// nil handler removes the route.
+func routesForVersion(shared []route, changed map[apiVersion][]route, v apiVersion) []route {
+	routes := append([]route(nil), shared...)
+	for cv := apiV1; cv <= v; cv++ {
+		for _, change := range changed[cv] {
+			i := slices.IndexFunc(routes, func(rt route) bool { return rt.pattern == change.pattern })
+			switch {
+			case i < 0 && change.handler != nil:
+				routes = append(routes, change)
+			case i >= 0 && change.handler == nil:
+				routes = slices.Delete(routes, i, i+1)
+			case i >= 0:
+				routes[i] = change
+			}
+		}
+	}
+	return routes
+}
+
+// documentAPIVersions adds the versions to the OpenAPI spec: a server for
+// each prefix, and the X-API-Version, Deprecation and Sunset headers on
+// every response.
+func documentAPIVersions(spec map[string]any) map[string]any {
+	servers := []any{}
+	for v := latestAPIVersion; v >= apiV1; v-- {
+		description := fmt.Sprintf("API v%d", v)
+		if lifecycle, ok := apiVersionLifecycles[v]; ok {
+			description += fmt.Sprintf(", deprecated since %s and served until %s",
+				lifecycle.deprecated.Format(time.DateOnly), lifecycle.sunset.Format(time.DateOnly))
+		}
+		servers = append(servers, map[string]any{"url": fmt.Sprintf("/v%d", v), "description": description})
+	}
+	servers = append(servers, map[string]any{"url": "/", "description": "Unversioned paths, served as API v1"})
+	spec["servers"] = servers
+
+	components, _ := spec["components"].(map[string]any)
+	components["headers"] = map[string]any{
+		"X-API-Version": map[string]any{
+			"description": "The API version that served the request",
+			"schema":      map[string]any{"type": "integer"},
+		},
+		"Deprecation": map[string]any{
+			"description": "On responses from a deprecated version: when it was deprecated, as @ and a Unix time (RFC 9745)",
+			"schema":      map[string]any{"type": "string", "example": "@1792022400"},
+		},
+		"Sunset": map[string]any{
+			"description": "On responses from a deprecated version: when it stops being served, as an HTTP date (RFC 8594)",
+			"schema":      map[string]any{"type": "string", "example": "Fri, 15 Oct 2027 00:00:00 GMT"},
+		},
+	}
+	paths, _ := spec["paths"].(map[string]any)
+	for _, item := range paths {
+		operations, _ := item.(map[string]any)
+		for _, op := range operations {
+			operation, _ := op.(map[string]any)
+			responses, _ := operation["responses"].(map[string]any)
+			for _, resp := range responses {
+				response, ok := resp.(map[string]any)
+				if !ok {
+					continue
+				}
+				headers, _ := response["headers"].(map[string]any)
+				if headers == nil {
+					headers = map[string]any{}
+					response["headers"] = headers
+				}
+				for _, name := range []string{"X-API-Version", "Deprecation", "Sunset"} {
+					if _, ok := headers[name]; !ok {
+						headers[name] = map[string]any{"$ref": "#/components/headers/" + name}
+					}
+				}
+			}
+		}
+	}
+	return spec
+}
@@ -0,0 +1,175 @@
+package sbrain
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// APIError is the body of every error response:
+//
+//	{"error": {"code": "not_found", "message": "...", "request_id": "..."}}
+type APIError struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id,omitempty"`
+	// Fields lists every invalid field when Code is "validation_failed".
+	Fields []FieldError `json:"fields,omitempty"`
+	// Current is the record as stored when Code is "conflict" because an
+	// update was made from a stale version.
+	Current any `json:"current,omitempty"`
+}
+
+// errorCodes maps HTTP statuses to the machine-readable error codes clients
+// switch on. Statuses not listed fall back to "error".
+var errorCodes = map[int]string{
+	http.StatusBadRequest:            "bad_request",
+	http.StatusUnauthorized:          "unauthorized",
+	http.StatusForbidden:             "forbidden",
+	http.StatusNotFound:              "not_found",
+	http.StatusMethodNotAllowed:      "method_not_allowed",
+	http.StatusConflict:              "conflict",
+	http.StatusRequestEntityTooLarge: "payload_too_large",
+	http.StatusUnsupportedMediaType:  "unsupported_media_type",
+	http.StatusUnprocessableEntity:   "unprocessable_entity",
+	http.StatusPreconditionRequired:  "precondition_required",
+	http.StatusTooManyRequests:       "rate_limited",
+	http.StatusInternalServerError:   "internal",
+	http.StatusBadGateway:            "bad_gateway",
+	http.StatusServiceUnavailable:    "unavailable",
+	http.StatusGatewayTimeout:        "timeout",
+	http.StatusInsufficientStorage:   "insufficient_storage",
+}
+
+func errorCode(status int) string {
+	if code, ok := errorCodes[status]; ok {
+		return code
+	}
+	return "error"
+}
+
+// writeError replaces http.Error for API handlers: it writes status with a
+// JSON APIError body carrying the request's id.
+func writeError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	w.Header().Del("Content-Length")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	writeJSONStatus(w, status, map[string]APIError{
+		"error": {Code: errorCode(status), Message: message, RequestID: requestIDFromContext(r.Context())},
+	})
+}
+
+type requestIDContextKey struct{}
+
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// requestIDMiddleware tags every request with an id, taken from an incoming
+// X-Request-ID header or generated, and echoes it in the response so error
+// reports can be matched with server logs.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimSpace(r.Header.Get("X-Request-ID"))
+		if id == "" || len(id) > 128 {
+			b := make([]byte, 8)
+			rand.Read(b)
+			id = hex.EncodeToString(b)
+		}
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDContextKey{}, id)))
+	})
+}
+
+// jsonMuxErrors makes the 404 and 405 responses ServeMux generates itself
+// (unknown path, or a known path with the wrong method) use the APIError
+// format too.
+func jsonMuxErrors(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, pattern := mux.Handler(r); pattern == "" {
+			w = &muxErrorWriter{ResponseWriter: w, r: r}
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// muxErrorWriter swaps ServeMux's plain-text error body for an APIError.
+type muxErrorWriter struct {
+	http.ResponseWriter
+	r       *http.Request
+	swallow bool
+}
+
+func (m *muxErrorWriter) WriteHeader(status int) {
+	if status < http.StatusBadRequest {
+		m.ResponseWriter.WriteHeader(status)
+		return
+	}
+	m.swallow = true
+	m.Header().Del("Content-Length")
+	m.Header().Set("Content-Type", "application/json")
+	m.ResponseWriter.WriteHeader(status)
+	json.NewEncoder(m.ResponseWriter).Encode(map[string]APIError{
+		"error": {Code: errorCode(status), Message: strings.ToLower(http.StatusText(status)), RequestID: requestIDFromContext(m.r.Context())},
+	})
+}
+
+func (m *muxErrorWriter) Write(b []byte) (int, error) {
+	if m.swallow {
+		return len(b), nil
+	}
+	return m.ResponseWriter.Write(b)
+}
+
+// documentErrorResponses points every 4xx and 5xx response in the OpenAPI
+// spec at the Error schema, and gives every operation a default response
+// using it.
+func documentErrorResponses(spec map[string]any) map[string]any {
+	errorContent := map[string]any{
+		"application/json": map[string]any{
+			"schema": map[string]any{"$ref": "#/components/schemas/Error"},
+		},
+	}
+	paths, _ := spec["paths"].(map[string]any)
+	for _, item := range paths {
+		operations, _ := item.(map[string]any)
+		for _, op := range operations {
+			operation, _ := op.(map[string]any)
+			responses, _ := operation["responses"].(map[string]any)
+			if responses == nil {
+				continue
+			}
+			// Any operation can also fail in ways it does not list, such as
+			// 401 or 507, always with the same body.
+			if _, ok := responses["default"]; !ok {
+				responses["default"] = map[string]any{"description": "Error", "content": errorContent}
+			}
+			for status, resp := range responses {
+				response, ok := resp.(map[string]any)
+				if !ok || len(status) != 3 || status[0] < '4' {
+					continue
+				}
+				if _, ok := response["content"]; !ok {
+					response["content"] = errorContent
+				}
+			}
+		}
+	}
+	return spec
+}
+
+// writeVersionConflict answers 409 for an update made from a stale version,
+// with the current record so the client can merge and retry.
+func writeVersionConflict(w http.ResponseWriter, r *http.Request, current any) {
+	writeJSONStatus(w, http.StatusConflict, map[string]APIError{
+		"error": {
+			Code:      errorCode(http.StatusConflict),
+			Message:   "record was changed since the given version",
+			RequestID: requestIDFromContext(r.Context()),
+			Current:   current,
+		},
+	})
+}
@@ -0,0 +1,190 @@
+package sbrain
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sbrain/store"
+)
+
+// Ask limits: records sent to the LLM by default and at most, and how much
+// of each record's context is included.
+const (
+	defaultAskRecords = 5
+	maxAskRecords     = 20
+	askContextRunes   = 3000
+)
+
+const askPrompt = `You answer questions from the notes in a developer's second brain. Use only
+the notes below; if they do not contain the answer, say so. Cite the notes
+you rely on by their ids in square brackets, like [#12], right after the
+statement they support. Be concise.`
+
+// askCitationPattern finds [#id] citations in an answer.
+var askCitationPattern = regexp.MustCompile(`\[#(\d+)\]`)
+
+// askCitation is a record an answer cites.
+type askCitation struct {
+	ID    int64  `json:"id"`
+	Title string `json:"title"`
+	Path  string `json:"path"`
+}
+
+// askHandler serves POST /ask: it retrieves the records most relevant to
+// the question, sends them with it to the configured LLM and returns the
+// answer with the records it cites.
+func (s *Server) askHandler(w http.ResponseWriter, r *http.Request) {
+	if s.llm == nil {
+		writeError(w, r, http.StatusServiceUnavailable, "asking is not configured: set SBRAIN_LLM_URL")
+		return
+	}
+	var req struct {
+		Question string `json:"question"`
+		Project  string `json:"project"`
+		Limit    int    `json:"limit"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("decode body: %v", err))
+		return
+	}
+	req.Question = strings.TrimSpace(req.Question)
+	if req.Question == "" {
+		writeError(w, r, http.StatusBadRequest, "question is required")
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = defaultAskRecords
+	}
+	if req.Limit < 1 || req.Limit > maxAskRecords {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxAskRecords))
+		return
+	}
+
+	records, err := s.retrieveForQuestion(r, req.Question, strings.TrimSpace(req.Project), req.Limit)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	resp := struct {
+		Answer    string        `json:"answer"`
+		Citations []askCitation `json:"citations"`
+		Sources   []int64       `json:"sources"`
+	}{Citations: []askCitation{}, Sources: []int64{}}
+	if len(records) == 0 {
+		resp.Answer = "No records match the question."
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	var notes strings.Builder
+	byID := map[int64]brain{}
+	for _, b := range records {
+		byID[b.ID] = b
+		resp.Sources = append(resp.Sources, b.ID)
+		context := []rune(b.Context)
+		if len(context) > askContextRunes {
+			context = append(context[:askContextRunes], '…')
+		}
+		fmt.Fprintf(&notes, "[#%d] %s (project %s, %s)\n%s\n\n", b.ID, b.Title, b.Project, b.CreatedAt.Display(), string(context))
+	}
+	answer, err := s.llm.complete(r.Context(), askPrompt, "Notes:\n\n"+notes.String()+"Question: "+req.Question)
+	if err != nil {
+		writeError(w, r, http.StatusBadGateway, err.Error())
+		return
+	}
+	resp.Answer = answer
+
+	// Only records that were sent can be cited; anything else the model
+	// wrote is left in the text but not reported.
+	cited := map[int64]bool{}
+	for _, m := range askCitationPattern.FindAllStringSubmatch(answer, -1) {
+		id, _ := strconv.ParseInt(m[1], 10, 64)
+		b, ok := byID[id]
+		if !ok || cited[id] {
+			continue
+		}
+		cited[id] = true
+		resp.Citations = append(resp.Citations, askCitation{ID: id, Title: b.Title, Path: fmt.Sprintf("/brain/%d", id)})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// retrieveForQuestion returns up to limit records containing any of the
+// question's significant words, ranked like search but with each word
+// weighted by how rare it is among the candidates, so "sqlite" counts for
+// more than "error".
+func (s *Server) retrieveForQuestion(r *http.Request, question, project string, limit int) ([]brain, error) {
+	terms := tagTerms(question)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+	var clauses []string
+	var args []any
+	for _, term := range terms {
+		for _, f := range brainSearchFields {
+			clauses = append(clauses, "instr(lower("+f.column+"), ?) > 0")
+			args = append(args, term)
+		}
+	}
+	where := " WHERE (" + strings.Join(clauses, " OR ") + ")"
+	if project != "" {
+		where += " AND project = ?"
+		args = append(args, project)
+	}
+	rows, err := s.db.QueryContext(r.Context(), `SELECT `+store.BrainColumns+` FROM second_brain`+where+`
+		ORDER BY created_at DESC LIMIT ?`, append(args, searchCandidateRows)...)
+	if err != nil {
+		return nil, fmt.Errorf("retrieve records: %w", err)
+	}
+	defer rows.Close()
+
+	var candidates []brain
+	var values []map[string]string
+	df := map[string]float64{}
+	for rows.Next() {
+		var b brain
+		if err := rows.Scan(b.Fields()...); err != nil {
+			return nil, fmt.Errorf("scan brain: %w", err)
+		}
+		v := map[string]string{"title": b.Title, "tags": b.Tags, "project": b.Project, "context": b.Context}
+		for _, term := range terms {
+			if searchScore(brainSearchFields, v, []string{term}) > 0 {
+				df[term]++
+			}
+		}
+		candidates = append(candidates, b)
+		values = append(values, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate brains: %w", err)
+	}
+
+	n := float64(len(candidates))
+	scores := make([]float64, len(candidates))
+	for i := range candidates {
+		for _, term := range terms {
+			if df[term] > 0 {
+				scores[i] += searchScore(brainSearchFields, values[i], []string{term}) * math.Log(1+n/df[term])
+			}
+		}
+	}
+	order := make([]int, len(candidates))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return scores[order[a]] > scores[order[b]] })
+	if len(order) > limit {
+		order = order[:limit]
+	}
+	ranked := make([]brain, len(order))
+	for i, j := range order {
+		ranked[i] = candidates[j]
+	}
+	return ranked, nil
+}
@@ -0,0 +1,109 @@
+package sbrain
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+type attachment struct {
+	ID          int64     `json:"id"`
+	CreatedAt   timestamp `json:"created_at"`
+	BrainID     int64     `json:"brain_id"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	SizeBytes   int64     `json:"size_bytes"`
+}
+
+func (s *Server) attachmentCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	brainID, err := strconv.ParseInt(r.URL.Query().Get("brain_id"), 10, 64)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "brain_id query parameter is required")
+		return
+	}
+
+	rows, err := s.db.QueryContext(r.Context(), `SELECT id, created_at, brain_id, filename, content_type, size_bytes
+		FROM attachments WHERE brain_id = ? ORDER BY id`, brainID)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("query attachments: %v", err))
+		return
+	}
+	defer rows.Close()
+
+	items := []attachment{}
+	for rows.Next() {
+		var a attachment
+		if err := rows.Scan(&a.ID, &a.CreatedAt, &a.BrainID, &a.Filename, &a.ContentType, &a.SizeBytes); err != nil {
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("scan attachment: %v", err))
+			return
+		}
+		items = append(items, a)
+	}
+	if err := rows.Err(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("iterate attachments: %v", err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, items)
+}
+
+// getAttachment serves the raw attachment bytes.
+func (s *Server) getAttachment(w http.ResponseWriter, r *http.Request, id int64) {
+	var filename, contentType string
+	var data []byte
+	row := s.db.QueryRowContext(r.Context(), `SELECT filename, content_type, data FROM attachments WHERE id = ?`, id)
+	if err := row.Scan(&filename, &contentType, &data); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, r, http.StatusNotFound, "not found")
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("query attachment: %v", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(data)
+}
+
+func (s *Server) insertAttachment(ctx context.Context, brainID int64, filename string, contentType string, data []byte) (attachment, error) {
+	a, err := writeAttachment(ctx, s.db, brainID, filename, contentType, data)
+	if err != nil {
+		return attachment{}, err
+	}
+	s.recordAudit(ctx, auditCreate, "attachment", a.ID, nil, a)
+	return a, nil
+}
+
+// sqlWriter is what writeAttachment needs of a *sql.DB or *sql.Tx.
+type sqlWriter interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// writeAttachment stores an attachment through db, which may be a
+// transaction, without auditing it.
+func writeAttachment(ctx context.Context, db sqlWriter, brainID int64, filename string, contentType string, data []byte) (attachment, error) {
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	res, err := db.ExecContext(ctx, `INSERT INTO attachments (brain_id, filename, content_type, size_bytes, data)
+		VALUES (?, ?, ?, ?, ?)`, brainID, filename, contentType, len(data), data)
+	if err != nil {
+		return attachment{}, fmt.Errorf("insert attachment: %w", err)
+	}
+
+	id, _ := res.LastInsertId()
+	var a attachment
+	row := db.QueryRowContext(ctx, `SELECT id, created_at, brain_id, filename, content_type, size_bytes
+		FROM attachments WHERE id = ?`, id)
+	if err := row.Scan(&a.ID, &a.CreatedAt, &a.BrainID, &a.Filename, &a.ContentType, &a.SizeBytes); err != nil {
+		return attachment{}, fmt.Errorf("load attachment: %w", err)
+	}
+	return a, nil
+}
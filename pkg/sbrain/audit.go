@@ -0,0 +1,209 @@
+package sbrain
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Audit actions.
+const (
+	auditCreate = "create"
+	auditUpdate = "update"
+	auditDelete = "delete"
+)
+
+// defaultAuditLimit and maxAuditLimit bound /audit responses.
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+type auditEntry struct {
+	ID         int64           `json:"id"`
+	CreatedAt  timestamp       `json:"created_at"`
+	Actor      string          `json:"actor"`
+	Action     string          `json:"action"`
+	Resource   string          `json:"resource"`
+	ResourceID *int64          `json:"resource_id,omitempty"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	Diff       json.RawMessage `json:"diff,omitempty"`
+}
+
+type fieldChange struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+// actorFromContext names the caller for the audit trail.
+func actorFromContext(ctx context.Context) string {
+	if p, ok := principalFromContext(ctx); ok {
+		return p.Name
+	}
+	return "anonymous"
+}
+
+// withActor attributes work done outside an authenticated request (webhooks,
+// schedulers) to a named actor.
+func withActor(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, principal{Name: name, Method: "system"})
+}
+
+// recordAudit stores one mutation. before is nil for creates and after is nil
+// for deletes. Failures are logged rather than failing the mutation, which
+// has already happened.
+func (s *Server) recordAudit(ctx context.Context, action string, resource string, resourceID int64, before any, after any) {
+	beforeJSON := auditJSON(before)
+	afterJSON := auditJSON(after)
+	diff := auditJSON(auditDiff(before, after))
+
+	var id any
+	if resourceID != 0 {
+		id = resourceID
+	}
+	if _, err := s.db.ExecContext(ctx, `INSERT INTO audit_log (actor, action, resource, resource_id, before, after, diff)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, actorFromContext(ctx), action, resource, id, beforeJSON, afterJSON, diff); err != nil {
+		log.Printf("audit %s %s %d: %v", action, resource, resourceID, err)
+	}
+}
+
+func auditJSON(value any) string {
+	if value == nil || (reflect.ValueOf(value).Kind() == reflect.Map && reflect.ValueOf(value).Len() == 0) {
+		return ""
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+	return string(encoded)
+}
+
+// auditDiff returns the fields whose values differ between before and after.
+func auditDiff(before any, after any) map[string]fieldChange {
+	b := auditFields(before)
+	a := auditFields(after)
+	diff := map[string]fieldChange{}
+	for key, av := range a {
+		if bv, ok := b[key]; !ok || !reflect.DeepEqual(av, bv) {
+			diff[key] = fieldChange{Before: b[key], After: av}
+		}
+	}
+	for key, bv := range b {
+		if _, ok := a[key]; !ok {
+			diff[key] = fieldChange{Before: bv, After: nil}
+		}
+	}
+	return diff
+}
+
+func auditFields(value any) map[string]any {
+	fields := map[string]any{}
+	if value == nil {
+		return fields
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fields
+	}
+	_ = json.Unmarshal(encoded, &fields)
+	return fields
+}
+
+// auditHandler lists audit entries, newest first, filtered by actor, action,
+// resource, resource_id, since and until.
+func (s *Server) auditHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var clauses []string
+	var args []any
+	for _, field := range []string{"actor", "action", "resource"} {
+		if value := strings.TrimSpace(q.Get(field)); value != "" {
+			clauses = append(clauses, field+" = ?")
+			args = append(args, value)
+		}
+	}
+	if raw := q.Get("resource_id"); raw != "" {
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "invalid resource_id")
+			return
+		}
+		clauses = append(clauses, "resource_id = ?")
+		args = append(args, id)
+	}
+	for _, bound := range []struct{ name, op string }{{"since", ">="}, {"until", "<"}} {
+		raw := q.Get(bound.name)
+		if raw == "" {
+			continue
+		}
+		t, ok := parseTimestamp(raw)
+		if !ok {
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("invalid %s %q", bound.name, raw))
+			return
+		}
+		clauses = append(clauses, "created_at "+bound.op+" ?")
+		args = append(args, t.Format(sqliteTimeLayout))
+	}
+
+	limit := defaultAuditLimit
+	if raw := q.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxAuditLimit {
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxAuditLimit))
+			return
+		}
+		limit = n
+	}
+
+	query := `SELECT id, created_at, actor, action, resource, resource_id, before, after, diff FROM audit_log`
+	if len(clauses) > 0 {
+		query += " WHERE " + strings.Join(clauses, " AND ")
+	}
+	// One row past the page tells whether another page follows.
+	rows, err := s.db.QueryContext(r.Context(), query+` ORDER BY id DESC LIMIT ?`, append(args, limit+1)...)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("query audit log: %v", err))
+		return
+	}
+	defer rows.Close()
+
+	items := []auditEntry{}
+	for rows.Next() {
+		var e auditEntry
+		var resourceID sql.NullInt64
+		var before, after, diff string
+		if err := rows.Scan(&e.ID, &e.CreatedAt, &e.Actor, &e.Action, &e.Resource, &resourceID, &before, &after, &diff); err != nil {
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("scan audit entry: %v", err))
+			return
+		}
+		if resourceID.Valid {
+			e.ResourceID = &resourceID.Int64
+		}
+		if before != "" {
+			e.Before = json.RawMessage(before)
+		}
+		if after != "" {
+			e.After = json.RawMessage(after)
+		}
+		if diff != "" {
+			e.Diff = json.RawMessage(diff)
+		}
+		items = append(items, e)
+	}
+	if err := rows.Err(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("iterate audit log: %v", err))
+		return
+	}
+
+	setPagination(r.Context(), pagination{Limit: limit, HasMore: len(items) > limit})
+	if len(items) > limit {
+		items = items[:limit]
+	}
+	writeJSON(w, http.StatusOK, items)
+}
@@ -0,0 +1,364 @@
+package sbrain
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"sbrain/store"
+)
+
+// sessionCookieName holds the signed session token for browser logins.
+const sessionCookieName = "sbrain_session"
+
+// sessionTTL is how long tokens issued after an OAuth/OIDC login stay valid.
+const sessionTTL = 7 * 24 * time.Hour
+
+// principal is the authenticated caller of a request.
+type principal struct {
+	Name   string   `json:"name"`
+	Method string   `json:"method"`
+	Scopes []string `json:"scopes"`
+	// Project confines a project-bound key to that project's records and
+	// logs; see projectPathAllowed.
+	Project string `json:"project,omitempty"`
+	// Service is the service of the logs the key ingests, unless they or
+	// the X-Sbrain-Service header name one.
+	Service string `json:"service,omitempty"`
+}
+
+// Scopes that can be granted to API keys.
+const (
+	scopeRead     = "read"
+	scopeWrite    = "write"
+	scopeAdmin    = "admin"
+	scopeLogsOnly = "logs-only"
+	scopeCapture  = "capture"
+)
+
+// logIngestPaths are the endpoints a logs-only key may post to.
+var logIngestPaths = map[string]bool{"/logs": true, "/logs/batch": true, "/loki/api/v1/push": true, "/v1/logs": true}
+
+// isHeartbeatPing reports whether a POST to path pings a heartbeat.
+func isHeartbeatPing(path string) bool {
+	name, ok := strings.CutPrefix(path, "/heartbeats/")
+	return ok && name != "" && !strings.Contains(name, "/")
+}
+
+var knownScopes = map[string]bool{scopeRead: true, scopeWrite: true, scopeAdmin: true, scopeLogsOnly: true, scopeCapture: true}
+
+// allows reports whether the principal's scopes permit the request:
+//
+//   - admin: everything, including /admin/*
+//   - read: GET/HEAD/OPTIONS on non-admin routes, plus the Grafana datasource
+//     routes, whose queries are POSTs but never modify anything; not /quick,
+//     which creates a record even on GET
+//   - write: other methods on non-admin routes, and /quick
+//   - logs-only: pushing log entries (POST to a log ingestion endpoint) and
+//     pinging heartbeats, and nothing else
+//   - capture: clipping into the brain (POST to a capture endpoint, or
+//     /quick) and nothing else, for browser extensions and shortcuts
+//
+// A project-bound principal is further limited to projectPathAllowed.
+func (p principal) allows(r *http.Request) bool {
+	if p.Project != "" && !projectPathAllowed(r) {
+		return false
+	}
+	readOnly := (r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions ||
+		strings.HasPrefix(r.URL.Path, "/grafana/")) && r.URL.Path != quickCapturePath
+	admin := strings.HasPrefix(r.URL.Path, "/admin/")
+
+	for _, scope := range p.Scopes {
+		switch scope {
+		case scopeAdmin:
+			return true
+		case scopeRead:
+			if readOnly && !admin {
+				return true
+			}
+		case scopeWrite:
+			if !readOnly && !admin {
+				return true
+			}
+		case scopeLogsOnly:
+			if r.Method == http.MethodPost && (logIngestPaths[r.URL.Path] || isHeartbeatPing(r.URL.Path)) {
+				return true
+			}
+		case scopeCapture:
+			if (r.Method == http.MethodPost && capturePaths[r.URL.Path]) || r.URL.Path == quickCapturePath {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// projectPathAllowed reports whether a project-bound key may make the
+// request: reading and writing brain records and logs, which go through
+// the project-scoped store, and nothing that queries the database
+// directly.
+func projectPathAllowed(r *http.Request) bool {
+	path, method := r.URL.Path, r.Method
+	if method == http.MethodHead || method == http.MethodOptions {
+		method = http.MethodGet
+	}
+	id, hasID := strings.CutPrefix(path, "/brain/")
+	if !hasID {
+		id, hasID = strings.CutPrefix(path, "/logs/")
+	}
+	isID := hasID && id != "" && strings.Trim(id, "0123456789") == ""
+	switch {
+	case path == "/whoami", path == "/brain", path == "/logs":
+		return method == http.MethodGet || method == http.MethodPost
+	case logIngestPaths[path]:
+		return method == http.MethodPost
+	case isID && strings.HasPrefix(path, "/brain/"):
+		return method == http.MethodGet || method == http.MethodPut
+	case isID:
+		return method == http.MethodGet || method == http.MethodDelete
+	}
+	return false
+}
+
+type principalContextKey struct{}
+
+func principalFromContext(ctx context.Context) (principal, bool) {
+	p, ok := ctx.Value(principalContextKey{}).(principal)
+	return p, ok
+}
+
+// authConfig describes how requests are authenticated. With neither API
+// keys nor an identity provider configured every request is allowed, which
+// keeps local development friction-free.
+type authConfig struct {
+	apiKeys       map[string]apiKey
+	oidc          *oidcProvider
+	sessionSecret []byte
+}
+
+func (a *authConfig) enabled() bool {
+	return len(a.apiKeys) > 0 || a.oidc != nil
+}
+
+type apiKey struct {
+	name    string
+	scopes  []string
+	project string
+	service string
+}
+
+// loadAuthConfig reads SBRAIN_API_KEYS and the optional OIDC settings. Keys
+// are comma-separated "name:key:scope+scope:project:service" entries; the
+// name and scopes may be omitted, and a key without scopes gets admin. A key
+// with a project is bound to it; one with a service labels the logs it
+// ingests with it. The project may be left empty when a service follows.
+func loadAuthConfig() (*authConfig, error) {
+	cfg := &authConfig{apiKeys: map[string]apiKey{}}
+
+	for i, entry := range strings.Split(os.Getenv("SBRAIN_API_KEYS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.Split(entry, ":")
+		k := apiKey{name: fmt.Sprintf("key-%d", i+1)}
+		var key string
+		switch len(parts) {
+		case 1:
+			key = parts[0]
+		case 2:
+			k.name, key = parts[0], parts[1]
+		case 3, 4, 5:
+			k.name, key = parts[0], parts[1]
+			if len(parts) == 5 {
+				if k.service = strings.TrimSpace(parts[4]); !validLogService(k.service) {
+					return nil, fmt.Errorf("SBRAIN_API_KEYS: key %q has invalid service %q", k.name, k.service)
+				}
+			}
+			if len(parts) >= 4 {
+				k.project = strings.TrimSpace(parts[3])
+				if (k.project != "" || len(parts) == 4) && !projectSlugPattern.MatchString(k.project) {
+					return nil, fmt.Errorf("SBRAIN_API_KEYS: key %q has invalid project %q", k.name, k.project)
+				}
+			}
+			for _, scope := range strings.Split(parts[2], "+") {
+				if !knownScopes[scope] {
+					return nil, fmt.Errorf("SBRAIN_API_KEYS: key %q has unknown scope %q", k.name, scope)
+				}
+				k.scopes = append(k.scopes, scope)
+			}
+		default:
+			return nil, fmt.Errorf("SBRAIN_API_KEYS: malformed entry for key %d", i+1)
+		}
+		if len(k.scopes) == 0 {
+			k.scopes = []string{scopeAdmin}
+		}
+		if k.project != "" && slices.Contains(k.scopes, scopeAdmin) {
+			return nil, fmt.Errorf("SBRAIN_API_KEYS: key %q is bound to a project and cannot have the admin scope", k.name)
+		}
+		cfg.apiKeys[key] = k
+	}
+
+	if secret := os.Getenv("SBRAIN_SESSION_SECRET"); secret != "" {
+		cfg.sessionSecret = []byte(secret)
+	} else {
+		cfg.sessionSecret = make([]byte, 32)
+		if _, err := rand.Read(cfg.sessionSecret); err != nil {
+			return nil, fmt.Errorf("generate session secret: %w", err)
+		}
+	}
+
+	provider, err := loadOIDCProvider()
+	if err != nil {
+		return nil, err
+	}
+	if provider != nil {
+		if os.Getenv("SBRAIN_SESSION_SECRET") == "" {
+			log.Printf("warning: SBRAIN_SESSION_SECRET is not set; login sessions will not survive a restart")
+		}
+		cfg.oidc = provider
+	}
+
+	return cfg, nil
+}
+
+// authExempt lists routes reachable without credentials: discovery, docs,
+// the favicon and readiness probes, the login flow itself, webhooks that verify their own signatures, and
+// share links, which carry their own signed token.
+func authExempt(path string) bool {
+	switch path {
+	case "/", "/openapi", "/docs", "/favicon.ico", "/favicon.svg", "/readyz", "/healthz", "/integrations/slack/command":
+		return true
+	}
+	return strings.HasPrefix(path, "/auth/") || strings.HasPrefix(path, "/integrations/email/") ||
+		strings.HasPrefix(path, "/integrations/git/webhook/") || strings.HasPrefix(path, "/s/")
+}
+
+// authMiddleware requires a valid API key or session token on every
+// non-exempt route once authentication is configured. Credentials are read
+// from "Authorization: Bearer", "X-API-Key", or the session cookie.
+func (s *Server) authMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.auth.enabled() || authExempt(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		p, ok := s.auth.authenticate(r)
+		if !ok {
+			if s.auth.oidc != nil && r.Method == http.MethodGet && strings.Contains(r.Header.Get("Accept"), "text/html") {
+				http.Redirect(w, r, "/auth/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer realm="sbrain"`)
+			writeError(w, r, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+
+		if !p.allows(r) {
+			writeError(w, r, http.StatusForbidden, fmt.Sprintf("forbidden: %s does not have the scope for %s %s", p.Name, r.Method, r.URL.Path))
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), principalContextKey{}, p)
+		if p.Project != "" {
+			ctx = store.WithProject(ctx, p.Project)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (a *authConfig) authenticate(r *http.Request) (principal, bool) {
+	var token string
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		token = strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+	} else if key := r.Header.Get("X-API-Key"); key != "" {
+		token = key
+	} else if cookie, err := r.Cookie(sessionCookieName); err == nil {
+		token = cookie.Value
+	} else if r.URL.Path == "/calendar.ics" || r.URL.Path == quickCapturePath {
+		// Calendar apps subscribe by URL, and quick-capture links and intents
+		// may not be able to send headers either.
+		token = r.URL.Query().Get("key")
+	}
+	if token == "" {
+		return principal{}, false
+	}
+
+	for key, k := range a.apiKeys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(token)) == 1 {
+			return principal{Name: k.name, Method: "api_key", Scopes: k.scopes, Project: k.project, Service: k.service}, true
+		}
+	}
+
+	// Interactive logins are limited to SBRAIN_AUTH_ALLOWED_USERS, i.e. the
+	// owners of the instance.
+	if subject, err := a.verifySession(token); err == nil {
+		return principal{Name: subject, Method: "oidc", Scopes: []string{scopeAdmin}}, true
+	}
+	return principal{}, false
+}
+
+type sessionClaims struct {
+	Subject   string `json:"sub"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// issueSession returns a signed "payload.signature" token for subject.
+func (a *authConfig) issueSession(subject string, now time.Time) (string, time.Time) {
+	expires := now.Add(sessionTTL)
+	payload, _ := json.Marshal(sessionClaims{Subject: subject, ExpiresAt: expires.Unix()})
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + a.sign(encoded), expires
+}
+
+func (a *authConfig) verifySession(token string) (string, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok || strings.Count(token, ".") != 1 {
+		return "", errors.New("malformed session token")
+	}
+	if !hmac.Equal([]byte(signature), []byte(a.sign(encoded))) {
+		return "", errors.New("invalid session signature")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", errors.New("malformed session token")
+	}
+	var claims sessionClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", errors.New("malformed session token")
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return "", errors.New("session expired")
+	}
+	return claims.Subject, nil
+}
+
+func (a *authConfig) sign(value string) string {
+	mac := hmac.New(sha256.New, a.sessionSecret)
+	mac.Write([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// whoamiHandler reports the authenticated caller.
+func (s *Server) whoamiHandler(w http.ResponseWriter, r *http.Request) {
+	p, ok := principalFromContext(r.Context())
+	if !ok {
+		p = principal{Name: "anonymous", Method: "none", Scopes: []string{scopeAdmin}}
+	}
+	writeJSON(w, http.StatusOK, p)
+}
@@ -0,0 +1,128 @@
+package sbrain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"sbrain/store"
+)
+
+// brainBatchChanges is the body of PATCH /brain. Omitted fields are left
+// alone.
+type brainBatchChanges struct {
+	AddTags    []string `json:"add_tags"`
+	RemoveTags []string `json:"remove_tags"`
+	Project    *string  `json:"project"`
+	Archived   *bool    `json:"archived"`
+}
+
+type brainBatchResult struct {
+	DryRun  bool    `json:"dry_run"`
+	Matched int     `json:"matched"`
+	Changed int     `json:"changed"`
+	IDs     []int64 `json:"ids"`
+}
+
+// batchValidationError rejects a batch because one record would fail
+// validation once changed.
+type batchValidationError struct {
+	id     int64
+	fields []FieldError
+}
+
+func (e *batchValidationError) Error() string {
+	return fmt.Sprintf("brain %d would become invalid", e.id)
+}
+
+// batchUpdateBrains serves PATCH /brain: it applies the changes in the body
+// to every record matching the list filters in the query string, all or
+// none. ?dry_run=true reports what would change without changing it.
+func (s *Server) batchUpdateBrains(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	dryRun := q.Get("dry_run") == "true"
+	q.Del("dry_run")
+	if len(q) == 0 {
+		writeError(w, r, http.StatusBadRequest, "at least one filter is required")
+		return
+	}
+	filter, err := parseBrainFilter(q)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var req brainBatchChanges
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("decode body: %v", err))
+		return
+	}
+	if req.AddTags == nil && req.RemoveTags == nil && req.Project == nil && req.Archived == nil {
+		writeError(w, r, http.StatusBadRequest, "no changes given: set add_tags, remove_tags, project or archived")
+		return
+	}
+
+	now := store.NewTimestamp(time.Now())
+	matched, changes, err := s.brains.UpdateBrains(r.Context(), filter, func(b *brain) (bool, error) {
+		before := *b
+		req.apply(b)
+		if *b == before {
+			return false, nil
+		}
+		if errs := validateBrain(*b); len(errs) > 0 {
+			return false, &batchValidationError{id: b.ID, fields: errs}
+		}
+		b.UpdatedAt = now
+		return true, nil
+	}, dryRun)
+	if err != nil {
+		var invalid *batchValidationError
+		if errors.As(err, &invalid) {
+			for i := range invalid.fields {
+				invalid.fields[i].Message = fmt.Sprintf("brain %d: %s", invalid.id, invalid.fields[i].Message)
+			}
+			writeValidationError(w, r, invalid.fields)
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	result := brainBatchResult{DryRun: dryRun, Matched: matched, Changed: len(changes), IDs: []int64{}}
+	for _, c := range changes {
+		result.IDs = append(result.IDs, c.After.ID)
+		if !dryRun {
+			s.recordAudit(r.Context(), auditUpdate, "brain", c.After.ID, c.Before, c.After)
+		}
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// apply makes the changes to b. Tags keep their order; added tags already
+// present are not repeated.
+func (c brainBatchChanges) apply(b *brain) {
+	if c.AddTags != nil || c.RemoveTags != nil {
+		tags := splitTags(b.Tags)
+		for _, tag := range c.AddTags {
+			if tag = strings.TrimSpace(tag); tag != "" && !slices.Contains(tags, tag) {
+				tags = append(tags, tag)
+			}
+		}
+		tags = slices.DeleteFunc(tags, func(tag string) bool {
+			return slices.ContainsFunc(c.RemoveTags, func(remove string) bool { return strings.TrimSpace(remove) == tag })
+		})
+		if joined := strings.Join(tags, ","); joined != strings.Join(splitTags(b.Tags), ",") {
+			b.Tags = joined
+		}
+	}
+	if c.Project != nil {
+		b.Project = strings.TrimSpace(*c.Project)
+	}
+	if c.Archived != nil {
+		b.Archived = *c.Archived
+	}
+}
@@ -0,0 +1,253 @@
+package sbrain
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"sbrain/store"
+)
+
+// calendarEntry is a record as listed on a calendar day.
+type calendarEntry struct {
+	ID      int64  `json:"id"`
+	Title   string `json:"title"`
+	Project string `json:"project"`
+	Tags    string `json:"tags"`
+}
+
+type calendarDay struct {
+	Date    string          `json:"date"`
+	Weekday string          `json:"weekday"`
+	Count   int             `json:"count"`
+	Entries []calendarEntry `json:"entries"`
+}
+
+type brainCalendar struct {
+	Month    string        `json:"month"`
+	Previous string        `json:"previous"`
+	Next     string        `json:"next"`
+	Total    int           `json:"total"`
+	Days     []calendarDay `json:"days"`
+}
+
+// brainCalendarHandler serves GET /brain/calendar?month=2024-06 (default
+// this month): every day of the month with the records written on it, days
+// without any included, so a UI can draw a heatmap. Days are in SBRAIN_TZ,
+// and the brain list filters apply.
+func (s *Server) brainCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	loc := store.DisplayLocation()
+	month := strings.TrimSpace(q.Get("month"))
+	q.Del("month")
+	var start time.Time
+	if month == "" {
+		now := time.Now().In(loc)
+		start = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
+	} else {
+		var err error
+		if start, err = time.ParseInLocation("2006-01", month, loc); err != nil {
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("invalid month %q: expected YYYY-MM", month))
+			return
+		}
+	}
+	end := start.AddDate(0, 1, 0)
+	filter, err := parseBrainFilter(q)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	records, err := s.brainsCreatedBetween(r.Context(), filter, start, end)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	cal := brainCalendar{
+		Month:    start.Format("2006-01"),
+		Previous: start.AddDate(0, -1, 0).Format("2006-01"),
+		Next:     end.Format("2006-01"),
+		Total:    len(records),
+		Days:     []calendarDay{},
+	}
+	index := map[string]int{}
+	for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+		index[day.Format("2006-01-02")] = len(cal.Days)
+		cal.Days = append(cal.Days, calendarDay{Date: day.Format("2006-01-02"), Weekday: day.Weekday().String(), Entries: []calendarEntry{}})
+	}
+	for _, b := range records {
+		created, _ := b.CreatedAt.Time()
+		d := &cal.Days[index[created.In(loc).Format("2006-01-02")]]
+		d.Count++
+		d.Entries = append(d.Entries, calendarEntry{ID: b.ID, Title: b.Title, Project: b.Project, Tags: b.Tags})
+	}
+	writeJSON(w, http.StatusOK, cal)
+}
+
+// brainsOnDayHandler serves GET /brain/on?date=2024-06-12: the records
+// written that day in SBRAIN_TZ, in the order they were written, narrowed
+// by the brain list filters. The date is a query parameter because the
+// path segment after /brain/ belongs to record ids.
+func (s *Server) brainsOnDayHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	date := strings.TrimSpace(q.Get("date"))
+	q.Del("date")
+	day, err := time.ParseInLocation("2006-01-02", date, store.DisplayLocation())
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("invalid date %q: expected YYYY-MM-DD", date))
+		return
+	}
+	filter, err := parseBrainFilter(q)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	records, err := s.brainsCreatedBetween(r.Context(), filter, day, day.AddDate(0, 0, 1))
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"date":    day.Format("2006-01-02"),
+		"weekday": day.Weekday().String(),
+		"count":   len(records),
+		"entries": records,
+	})
+}
+
+// brainsCreatedBetween lists the records matching filter that were
+// created in [start, end), oldest first. A zero start leaves the range
+// open.
+func (s *Server) brainsCreatedBetween(ctx context.Context, filter brainFilter, start, end time.Time) ([]brain, error) {
+	if !start.IsZero() {
+		filter.CreatedSince = string(store.NewTimestamp(start))
+	}
+	filter.CreatedUntil = string(store.NewTimestamp(end))
+	records := []brain{}
+	if err := s.brains.ListBrains(ctx, filter, func(b brain) error {
+		records = append(records, b)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].CreatedAt < records[j].CreatedAt })
+	return records, nil
+}
+
+// onThisDayGroup is the records written on one earlier date with the same
+// day of the month as the requested date.
+type onThisDayGroup struct {
+	Date      string  `json:"date"`
+	MonthsAgo int     `json:"months_ago"`
+	Label     string  `json:"label"`
+	Entries   []brain `json:"entries"`
+}
+
+// onThisDayHandler serves GET /brain/onthisday: the records written on
+// today's day of the month (or ?date's) in earlier months, grouped by date,
+// most recent first, for reviewing old notes. ?every=year keeps only the
+// same date in earlier years. Dates are in SBRAIN_TZ, and the brain list
+// filters apply.
+func (s *Server) onThisDayHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	loc := store.DisplayLocation()
+	now := time.Now().In(loc)
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	if date := strings.TrimSpace(q.Get("date")); date != "" {
+		var err error
+		if day, err = time.ParseInLocation("2006-01-02", date, loc); err != nil {
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("invalid date %q: expected YYYY-MM-DD", date))
+			return
+		}
+	}
+	every := q.Get("every")
+	if every == "" {
+		every = "month"
+	}
+	if every != "month" && every != "year" {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("invalid every %q: expected month or year", every))
+		return
+	}
+	q.Del("date")
+	q.Del("every")
+	filter, err := parseBrainFilter(q)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// SQL narrows the records down to the day at each offset the zone has
+	// used; the exact day is checked below in the zone itself.
+	filter.CreatedDay, filter.DayOffsets = day.Format("02"), zoneOffsets(loc, day.Year())
+	if every == "year" {
+		filter.CreatedDay = day.Format("01-02")
+	}
+	records, err := s.brainsCreatedBetween(r.Context(), filter, time.Time{}, day)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	groups := []onThisDayGroup{}
+	index := map[string]int{}
+	for n := len(records) - 1; n >= 0; n-- {
+		created, _ := records[n].CreatedAt.Time()
+		created = created.In(loc)
+		if created.Day() != day.Day() || (every == "year" && created.Month() != day.Month()) {
+			continue
+		}
+		date := created.Format("2006-01-02")
+		i, ok := index[date]
+		if !ok {
+			months := (day.Year()-created.Year())*12 + int(day.Month()-created.Month())
+			i = len(groups)
+			index[date] = i
+			groups = append(groups, onThisDayGroup{Date: date, MonthsAgo: months, Label: monthsAgoLabel(months)})
+		}
+		groups[i].Entries = append(groups[i].Entries, records[n])
+	}
+	// Within a day, show records in the order they were written.
+	for _, g := range groups {
+		slices.Reverse(g.Entries)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"date": day.Format("2006-01-02"), "count": len(groups), "groups": groups})
+}
+
+// zoneOffsets returns the UTC offsets, as "+02:00", that loc used in
+// January and July of the years from 1970 to until, so covering both sides
+// of daylight saving time and past changes to the zone's rules.
+func zoneOffsets(loc *time.Location, until int) []string {
+	var offsets []string
+	for year := 1970; year <= until; year++ {
+		for _, month := range []time.Month{time.January, time.July} {
+			offset := time.Date(year, month, 1, 0, 0, 0, 0, loc).Format("-07:00")
+			if !slices.Contains(offsets, offset) {
+				offsets = append(offsets, offset)
+			}
+		}
+	}
+	return offsets
+}
+
+// monthsAgoLabel renders a distance in months as "1 year, 2 months ago".
+func monthsAgoLabel(months int) string {
+	plural := func(n int, unit string) string {
+		if n == 1 {
+			return "1 " + unit
+		}
+		return fmt.Sprintf("%d %ss", n, unit)
+	}
+	var parts []string
+	if years := months / 12; years > 0 {
+		parts = append(parts, plural(years, "year"))
+	}
+	if months%12 > 0 {
+		parts = append(parts, plural(months%12, "month"))
+	}
+	return strings.Join(parts, ", ") + " ago"
+}
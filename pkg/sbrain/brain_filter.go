@@ -0,0 +1,62 @@
+package sbrain
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"sbrain/store"
+)
+
+// brainFilter holds the query-string filters of the brain list.
+type brainFilter = store.BrainFilter
+
+// parseBrainFilter reads the brain list filters. Archived records are left
+// out unless archived=true (only them) or archived=all.
+func parseBrainFilter(q url.Values) (brainFilter, error) {
+	f := brainFilter{
+		Project: strings.TrimSpace(q.Get("project")),
+		Tag:     strings.TrimSpace(q.Get("tag")),
+		Issue:   strings.TrimSpace(q.Get("issue")),
+	}
+	for _, raw := range q["id"] {
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return f, fmt.Errorf("invalid id %q", raw)
+		}
+		f.IDs = append(f.IDs, id)
+	}
+	for _, flag := range []struct {
+		name string
+		dest **bool
+	}{{"pinned", &f.Pinned}, {"favorite", &f.Favorite}, {"archived", &f.Archived}} {
+		raw := q.Get(flag.name)
+		if raw == "" || (flag.name == "archived" && raw == "all") {
+			continue
+		}
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			return f, fmt.Errorf("invalid %s %q: expected true or false", flag.name, raw)
+		}
+		*flag.dest = &value
+	}
+	if q.Get("archived") == "" {
+		f.Archived = new(bool)
+	}
+	return f, nil
+}
+
+// brainFilterParameters documents the brainFilter query parameters in the
+// OpenAPI spec.
+func brainFilterParameters() []map[string]any {
+	return []map[string]any{
+		{"name": "id", "in": "query", "description": "Only these records; repeatable", "schema": map[string]any{"type": "array", "items": map[string]any{"type": "integer", "format": "int64"}}},
+		{"name": "project", "in": "query", "schema": map[string]any{"type": "string"}},
+		{"name": "tag", "in": "query", "schema": map[string]any{"type": "string"}},
+		{"name": "issue", "in": "query", "description": "Only records linked to this Jira or Linear issue key", "schema": map[string]any{"type": "string"}},
+		{"name": "pinned", "in": "query", "schema": map[string]any{"type": "boolean"}},
+		{"name": "favorite", "in": "query", "schema": map[string]any{"type": "boolean"}},
+		{"name": "archived", "in": "query", "description": "true for only archived records, all for both (default false)", "schema": map[string]any{"type": "string", "enum": []string{"false", "true", "all"}}},
+	}
+}
@@ -0,0 +1,76 @@
+package sbrain
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"sbrain/store"
+)
+
+// brainFlagHandler serves the pin, favorite and archive toggles: PUT sets the flag
+// chosen by field and DELETE clears it. Setting a flag that is already set
+// is not a change and leaves updated_at alone.
+func (s *Server) brainFlagHandler(field func(*brain) *bool, value bool) func(http.ResponseWriter, *http.Request, int64) {
+	return func(w http.ResponseWriter, r *http.Request, id int64) {
+		before, err := s.brains.GetBrain(r.Context(), id)
+		if err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				writeError(w, r, http.StatusNotFound, "not found")
+				return
+			}
+			writeError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		after := before
+		if *field(&after) == value {
+			writeJSON(w, http.StatusOK, after)
+			return
+		}
+
+		*field(&after) = value
+		after.UpdatedAt = store.NewTimestamp(time.Now())
+		if after, err = s.brains.UpdateBrain(r.Context(), after); err != nil {
+			s.writeBrainUpdateError(w, r, id, err)
+			return
+		}
+		s.recordAudit(r.Context(), auditUpdate, "brain", id, before, after)
+		writeJSON(w, http.StatusOK, after)
+	}
+}
+
+func brainPinned(b *brain) *bool   { return &b.Pinned }
+func brainFavorite(b *brain) *bool { return &b.Favorite }
+func brainArchived(b *brain) *bool { return &b.Archived }
+
+// brainFlagSpec documents a flag's PUT and DELETE toggles in the OpenAPI
+// spec.
+func brainFlagSpec(flag string) map[string]any {
+	responses := map[string]any{
+		"200": map[string]any{
+			"description": "Updated brain record",
+			"content": map[string]any{
+				"application/json": map[string]any{
+					"schema": map[string]any{"$ref": "#/components/schemas/Brain"},
+				},
+			},
+		},
+		"400": map[string]any{"description": "Invalid ID"},
+		"404": map[string]any{"description": "Not found"},
+	}
+	return map[string]any{
+		"parameters": []map[string]any{
+			{"name": "id", "in": "path", "required": true, "schema": map[string]any{"type": "integer", "format": "int64"}},
+		},
+		"put": map[string]any{
+			"summary":     "Set " + flag + " on a brain record",
+			"operationId": flag + "Brain",
+			"responses":   responses,
+		},
+		"delete": map[string]any{
+			"summary":     "Clear " + flag + " on a brain record",
+			"operationId": "un" + flag + "Brain",
+			"responses":   responses,
+		},
+	}
+}
@@ -0,0 +1,53 @@
+package sbrain
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"sbrain/store"
+)
+
+// randomBrainHandler serves GET /brain/random: one record picked at random
+// from those matching the brain list filters, for rediscovering old notes.
+// ?older_than_days=N only picks records written at least N days ago, so a
+// daily "random old note" is one request. It answers 404 when nothing
+// matches.
+func (s *Server) randomBrainHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var days int
+	if raw := q.Get("older_than_days"); raw != "" {
+		var err error
+		if days, err = strconv.Atoi(raw); err != nil || days < 0 {
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("invalid older_than_days %q: expected a non-negative integer", raw))
+			return
+		}
+	}
+	q.Del("older_than_days")
+	filter, err := parseBrainFilter(q)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if days > 0 {
+		filter.CreatedUntil = string(store.NewTimestamp(time.Now().AddDate(0, 0, -days)))
+	}
+
+	where, args := filter.Where()
+	var b brain
+	err = s.db.QueryRowContext(r.Context(), `SELECT `+store.BrainColumns+` FROM second_brain`+where+`
+		ORDER BY random() LIMIT 1`, args...).Scan(b.Fields()...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, r, http.StatusNotFound, "no record matches")
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("query brain: %v", err))
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, b)
+}
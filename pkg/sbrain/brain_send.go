@@ -0,0 +1,84 @@
+package sbrain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"sbrain/store"
+)
+
+// sendRecipients returns the addresses in SBRAIN_SEND_TO, the only ones
+// POST /brain/{id}/send will mail, so a leaked write key cannot turn the
+// server into a relay. The first is the default.
+func sendRecipients() []string {
+	var out []string
+	for _, addr := range strings.Split(os.Getenv("SBRAIN_SEND_TO"), ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			out = append(out, addr)
+		}
+	}
+	return out
+}
+
+// sendBrain serves POST /brain/{id}/send: it emails the record, rendered as
+// markdown with its front matter, to one of the SBRAIN_SEND_TO addresses
+// using the SBRAIN_SMTP_* settings. The optional body picks the address
+// with "to" and adds a "note" above the record.
+func (s *Server) sendBrain(w http.ResponseWriter, r *http.Request, id int64) {
+	recipients := sendRecipients()
+	if len(recipients) == 0 || os.Getenv("SBRAIN_SMTP_ADDR") == "" {
+		writeError(w, r, http.StatusServiceUnavailable, "sending is not configured: set SBRAIN_SEND_TO and SBRAIN_SMTP_ADDR")
+		return
+	}
+	var req struct {
+		To   string `json:"to"`
+		Note string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("decode body: %v", err))
+		return
+	}
+	to := recipients[0]
+	if req.To = strings.TrimSpace(req.To); req.To != "" {
+		to = ""
+		for _, addr := range recipients {
+			if strings.EqualFold(addr, req.To) {
+				to = addr
+			}
+		}
+		if to == "" {
+			var v validator
+			v.add("to", "must be one of the addresses in SBRAIN_SEND_TO")
+			writeValidationError(w, r, v.errors)
+			return
+		}
+	}
+
+	b, err := s.brains.GetBrain(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, r, http.StatusNotFound, "not found")
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var body strings.Builder
+	if note := strings.TrimSpace(req.Note); note != "" {
+		body.WriteString(note + "\n\n")
+	}
+	body.WriteString(renderBrainMarkdown(b))
+	fmt.Fprintf(&body, "\n-- \n%s/brain/%d\n", publicBaseURL(r), b.ID)
+	subject := "sbrain: " + b.Title
+	if err := sendDigestEmail(to, subject, body.String()); err != nil {
+		writeError(w, r, http.StatusBadGateway, fmt.Sprintf("send email: %v", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"sent_to": to, "subject": subject})
+}
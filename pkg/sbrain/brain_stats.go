@@ -0,0 +1,164 @@
+package sbrain
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type weekBucket struct {
+	WeekStart string `json:"week_start"`
+	Count     int64  `json:"count"`
+}
+
+type linkedBrain struct {
+	ID      int64  `json:"id"`
+	Title   string `json:"title"`
+	Project string `json:"project"`
+	Links   int    `json:"links"`
+}
+
+type brainStats struct {
+	Total            int64         `json:"total"`
+	ByProject        []countBucket `json:"by_project"`
+	ByTag            []countBucket `json:"by_tag"`
+	PerWeek          []weekBucket  `json:"per_week"`
+	AvgContextLength float64       `json:"avg_context_length"`
+	MostLinked       []linkedBrain `json:"most_linked"`
+}
+
+// mostLinkedLimit caps the most_linked list.
+const mostLinkedLimit = 10
+
+// brainLinkPattern matches references to other records inside a context:
+// Obsidian-style [[Title]] wiki links and /brain/{id} URLs.
+var brainLinkPattern = regexp.MustCompile(`\[\[([^\]|#]+)(?:[|#][^\]]*)?\]\]|/brain/(\d+)\b`)
+
+func (s *Server) brainStatsHandler(w http.ResponseWriter, r *http.Request) {
+	stats, err := s.computeBrainStats(r.Context())
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+func (s *Server) computeBrainStats(ctx context.Context) (brainStats, error) {
+	stats := brainStats{ByProject: []countBucket{}, PerWeek: []weekBucket{}}
+
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*), COALESCE(AVG(LENGTH(context)), 0) FROM second_brain`).
+		Scan(&stats.Total, &stats.AvgContextLength); err != nil {
+		return stats, fmt.Errorf("count brains: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT project, COUNT(*) AS c FROM second_brain
+		GROUP BY project ORDER BY c DESC, project ASC`)
+	if err != nil {
+		return stats, fmt.Errorf("group brains by project: %w", err)
+	}
+	for rows.Next() {
+		var b countBucket
+		if err := rows.Scan(&b.Key, &b.Count); err != nil {
+			rows.Close()
+			return stats, fmt.Errorf("scan project count: %w", err)
+		}
+		stats.ByProject = append(stats.ByProject, b)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return stats, fmt.Errorf("iterate project counts: %w", err)
+	}
+
+	// date(x, 'weekday 0', '-6 days') is the Monday starting x's week.
+	rows, err = s.db.QueryContext(ctx, `SELECT date(created_at, 'weekday 0', '-6 days') AS week, COUNT(*)
+		FROM second_brain GROUP BY week ORDER BY week`)
+	if err != nil {
+		return stats, fmt.Errorf("group brains by week: %w", err)
+	}
+	for rows.Next() {
+		var b weekBucket
+		if err := rows.Scan(&b.WeekStart, &b.Count); err != nil {
+			rows.Close()
+			return stats, fmt.Errorf("scan week count: %w", err)
+		}
+		stats.PerWeek = append(stats.PerWeek, b)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return stats, fmt.Errorf("iterate week counts: %w", err)
+	}
+
+	// Tags and links live inside free-text columns, so they are tallied here.
+	rows, err = s.db.QueryContext(ctx, `SELECT id, title, project, context, tags FROM second_brain`)
+	if err != nil {
+		return stats, fmt.Errorf("query brains: %w", err)
+	}
+	defer rows.Close()
+
+	tagCounts := map[string]int64{}
+	records := map[int64]*linkedBrain{}
+	idByTitle := map[string]int64{}
+	var contexts []string
+	for rows.Next() {
+		var b brain
+		if err := rows.Scan(&b.ID, &b.Title, &b.Project, &b.Context, &b.Tags); err != nil {
+			return stats, fmt.Errorf("scan brain: %w", err)
+		}
+		for _, tag := range splitTags(b.Tags) {
+			tagCounts[strings.ToLower(tag)]++
+		}
+		records[b.ID] = &linkedBrain{ID: b.ID, Title: b.Title, Project: b.Project}
+		idByTitle[strings.ToLower(strings.TrimSpace(b.Title))] = b.ID
+		contexts = append(contexts, b.Context)
+	}
+	if err := rows.Err(); err != nil {
+		return stats, fmt.Errorf("iterate brains: %w", err)
+	}
+
+	for _, context := range contexts {
+		for _, m := range brainLinkPattern.FindAllStringSubmatch(context, -1) {
+			var id int64
+			if m[2] != "" {
+				id, _ = strconv.ParseInt(m[2], 10, 64)
+			} else {
+				id = idByTitle[strings.ToLower(strings.TrimSpace(m[1]))]
+			}
+			if rec, ok := records[id]; ok {
+				rec.Links++
+			}
+		}
+	}
+
+	stats.ByTag = make([]countBucket, 0, len(tagCounts))
+	for tag, count := range tagCounts {
+		stats.ByTag = append(stats.ByTag, countBucket{Key: tag, Count: count})
+	}
+	sort.Slice(stats.ByTag, func(i, j int) bool {
+		if stats.ByTag[i].Count != stats.ByTag[j].Count {
+			return stats.ByTag[i].Count > stats.ByTag[j].Count
+		}
+		return stats.ByTag[i].Key < stats.ByTag[j].Key
+	})
+
+	stats.MostLinked = []linkedBrain{}
+	for _, rec := range records {
+		if rec.Links > 0 {
+			stats.MostLinked = append(stats.MostLinked, *rec)
+		}
+	}
+	sort.Slice(stats.MostLinked, func(i, j int) bool {
+		if stats.MostLinked[i].Links != stats.MostLinked[j].Links {
+			return stats.MostLinked[i].Links > stats.MostLinked[j].Links
+		}
+		return stats.MostLinked[i].ID < stats.MostLinked[j].ID
+	})
+	if len(stats.MostLinked) > mostLinkedLimit {
+		stats.MostLinked = stats.MostLinked[:mostLinkedLimit]
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,174 @@
+package sbrain
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"sbrain/store"
+)
+
+// defaultCalendarDays and maxCalendarDays bound how far back /calendar.ics
+// reports activity.
+const (
+	defaultCalendarDays = 90
+	maxCalendarDays     = 366
+)
+
+// icsTimeLayout is the iCalendar UTC date-time form.
+const icsTimeLayout = "20060102T150405Z"
+
+// calendarHandler serves /calendar.ics: an all-day event per day brain
+// records were created in the last ?days= days (in the display zone), and a
+// 15-minute event per reminder, or a VTODO with ?reminders=todo, so a
+// calendar app subscribed to the feed shows what is due.
+func (s *Server) calendarHandler(w http.ResponseWriter, r *http.Request) {
+	days := defaultCalendarDays
+	if raw := r.URL.Query().Get("days"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxCalendarDays {
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("days must be between 1 and %d", maxCalendarDays))
+			return
+		}
+		days = n
+	}
+	asTodo := false
+	switch r.URL.Query().Get("reminders") {
+	case "", "event":
+	case "todo":
+		asTodo = true
+	default:
+		writeError(w, r, http.StatusBadRequest, "reminders must be event or todo")
+		return
+	}
+
+	now := time.Now().UTC()
+	since := store.NewTimestamp(now.AddDate(0, 0, -days))
+	rows, err := s.db.QueryContext(r.Context(), `SELECT `+store.BrainColumns+` FROM second_brain
+		WHERE created_at >= ? OR remind_at != '' ORDER BY created_at ASC, id ASC`, since)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("query brains: %v", err))
+		return
+	}
+	defer rows.Close()
+
+	var dayOrder []string
+	activity := map[string][]brain{}
+	var reminders []brain
+	for rows.Next() {
+		var b brain
+		if err := rows.Scan(b.Fields()...); err != nil {
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("scan brain: %v", err))
+			return
+		}
+		if b.RemindAt != "" {
+			reminders = append(reminders, b)
+		}
+		created, ok := b.CreatedAt.Time()
+		if !ok || b.CreatedAt < since {
+			continue
+		}
+		day := created.In(store.DisplayLocation()).Format("20060102")
+		if _, seen := activity[day]; !seen {
+			dayOrder = append(dayOrder, day)
+		}
+		activity[day] = append(activity[day], b)
+	}
+	if err := rows.Err(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("iterate brains: %v", err))
+		return
+	}
+
+	var cal icsWriter
+	cal.line("BEGIN:VCALENDAR")
+	cal.line("VERSION:2.0")
+	cal.line("PRODID:-//sbrain//calendar//EN")
+	cal.line("CALSCALE:GREGORIAN")
+	cal.line("X-WR-CALNAME:sbrain")
+	stamp := now.Format(icsTimeLayout)
+
+	for _, day := range dayOrder {
+		brains := activity[day]
+		start, _ := time.Parse("20060102", day)
+		titles := make([]string, len(brains))
+		for i, b := range brains {
+			titles[i] = fmt.Sprintf("- %s (%s)", b.Title, b.Project)
+		}
+		summary := fmt.Sprintf("sbrain: %d note", len(brains))
+		if len(brains) != 1 {
+			summary += "s"
+		}
+		cal.line("BEGIN:VEVENT")
+		cal.line("UID:activity-" + day + "@sbrain")
+		cal.line("DTSTAMP:" + stamp)
+		cal.line("DTSTART;VALUE=DATE:" + day)
+		cal.line("DTEND;VALUE=DATE:" + start.AddDate(0, 0, 1).Format("20060102"))
+		cal.line("SUMMARY:" + icsEscape(summary))
+		cal.line("DESCRIPTION:" + icsEscape(strings.Join(titles, "\n")))
+		cal.line("TRANSP:TRANSPARENT")
+		cal.line("END:VEVENT")
+	}
+
+	for _, b := range reminders {
+		due, ok := b.RemindAt.Time()
+		if !ok {
+			continue
+		}
+		uid := fmt.Sprintf("UID:brain-%d-reminder@sbrain", b.ID)
+		summary := "SUMMARY:" + icsEscape("Follow up: "+b.Title)
+		description := "DESCRIPTION:" + icsEscape(fmt.Sprintf("%s/brain/%d\n\n%s", publicBaseURL(r), b.ID, b.Context))
+		if asTodo {
+			cal.line("BEGIN:VTODO")
+			cal.line(uid)
+			cal.line("DTSTAMP:" + stamp)
+			cal.line("DUE:" + due.Format(icsTimeLayout))
+			cal.line(summary)
+			cal.line(description)
+			cal.line("END:VTODO")
+			continue
+		}
+		cal.line("BEGIN:VEVENT")
+		cal.line(uid)
+		cal.line("DTSTAMP:" + stamp)
+		cal.line("DTSTART:" + due.Format(icsTimeLayout))
+		cal.line("DTEND:" + due.Add(15*time.Minute).Format(icsTimeLayout))
+		cal.line(summary)
+		cal.line(description)
+		cal.line("END:VEVENT")
+	}
+	cal.line("END:VCALENDAR")
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="sbrain.ics"`)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(cal.String()))
+}
+
+// icsWriter builds an iCalendar document, folding content lines longer than
+// 75 octets as RFC 5545 requires.
+type icsWriter struct {
+	strings.Builder
+}
+
+func (c *icsWriter) line(content string) {
+	// Continuation lines start with a space, leaving them 74 octets.
+	limit := 75
+	for len(content) > limit {
+		cut := limit
+		// Never split a UTF-8 sequence.
+		for cut > 0 && content[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		c.WriteString(content[:cut] + "\r\n ")
+		content = content[cut:]
+		limit = 74
+	}
+	c.WriteString(content + "\r\n")
+}
+
+// icsEscape escapes a TEXT property value.
+func icsEscape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(value)
+}
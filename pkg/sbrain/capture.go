@@ -0,0 +1,377 @@
+package sbrain
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+)
+
+// maxCapturePageBytes bounds how much of a page /capture/url reads.
+const maxCapturePageBytes = 5 << 20
+
+// errCaptureAddress is returned when a page resolves to an address the
+// server will not fetch from.
+var errCaptureAddress = errors.New("refusing to fetch from a private or loopback address")
+
+// captureClient fetches pages for /capture/url. Unless
+// SBRAIN_CAPTURE_ALLOW_PRIVATE is true it refuses loopback, private and
+// link-local addresses, checked after DNS resolution and on every redirect,
+// so a clip request cannot reach services next to the server.
+func captureClient() *http.Client {
+	allowPrivate := os.Getenv("SBRAIN_CAPTURE_ALLOW_PRIVATE") == "true"
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if !allowPrivate && (ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsUnspecified()) {
+				return errCaptureAddress
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+	return &http.Client{Timeout: 20 * time.Second, Transport: transport}
+}
+
+// captureProject is the project clipped pages are filed under unless the
+// request names one.
+func captureProject() string {
+	if project := os.Getenv("SBRAIN_CAPTURE_PROJECT"); project != "" {
+		return project
+	}
+	return "inbox"
+}
+
+// fetchReadable downloads rawURL and extracts its readable content. Plain
+// text pages are kept as they are.
+func fetchReadable(ctx context.Context, rawURL string) (readablePage, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return readablePage{}, err
+	}
+	req.Header.Set("User-Agent", "sbrain-clipper/1.0")
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,text/plain;q=0.9")
+	resp, err := captureClient().Do(req)
+	if err != nil {
+		return readablePage{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return readablePage{}, fmt.Errorf("page returned %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxCapturePageBytes))
+	if err != nil {
+		return readablePage{}, fmt.Errorf("read page: %w", err)
+	}
+	if !utf8.Valid(body) {
+		body = []byte(strings.ToValidUTF8(string(body), "�"))
+	}
+
+	final := resp.Request.URL
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	var page readablePage
+	switch mediaType {
+	case "text/html", "application/xhtml+xml", "":
+		page = extractReadable(string(body))
+	case "text/plain", "text/markdown":
+		page = readablePage{Text: strings.TrimSpace(string(body))}
+	default:
+		return readablePage{}, fmt.Errorf("cannot clip %s content", mediaType)
+	}
+
+	page.Canonical = resolveCaptureURL(final, page.Canonical)
+	if page.Title == "" {
+		page.Title = final.Host + final.Path
+	}
+	return page, nil
+}
+
+// resolveCaptureURL resolves ref against base, falling back to base when
+// ref is empty or not an http(s) URL.
+func resolveCaptureURL(base *url.URL, ref string) string {
+	if ref != "" {
+		if u, err := base.Parse(ref); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+			return u.String()
+		}
+	}
+	return base.String()
+}
+
+// captureURL serves POST /capture/url: it fetches the page at url, extracts
+// its title, canonical URL and article text and stores them as a brain
+// record tagged "clipped". url may come in a JSON body or the query string,
+// so a bookmarklet can post to it directly.
+func (s *Server) captureURL(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		URL     string `json:"url"`
+		Project string `json:"project"`
+		Tags    string `json:"tags"`
+	}
+	if r.ContentLength != 0 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("decode body: %v", err))
+			return
+		}
+	}
+	q := r.URL.Query()
+	for _, field := range []struct {
+		dest *string
+		name string
+	}{{&req.URL, "url"}, {&req.Project, "project"}, {&req.Tags, "tags"}} {
+		if *field.dest == "" {
+			*field.dest = q.Get(field.name)
+		}
+	}
+
+	target, err := url.Parse(strings.TrimSpace(req.URL))
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		writeError(w, r, http.StatusBadRequest, "url must be an absolute http or https URL")
+		return
+	}
+
+	page, err := fetchReadable(r.Context(), target.String())
+	if err != nil {
+		writeError(w, r, http.StatusBadGateway, fmt.Sprintf("fetch %s: %v", target, err))
+		return
+	}
+
+	b := clippedBrain(page.Title, page.Canonical, page.Text, req.Project, req.Tags)
+	if errs := validateBrain(b); len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+	created, err := s.insertBrain(r.Context(), b)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSONStatus(w, http.StatusCreated, created)
+}
+
+// clippedBrain builds the record for a clipped page, tagged "clipped".
+func clippedBrain(title, source, text, project, tags string) brain {
+	return sourcedBrain(title, source, text, project, append([]string{"clipped"}, splitTags(tags)...))
+}
+
+// sourcedBrain builds a record for something read elsewhere: the source
+// URL, if any, heads the context, long text is cut to fit, and the project
+// defaults to the capture project.
+func sourcedBrain(title, source, text, project string, tags []string) brain {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		title = source
+	}
+	if runes := []rune(title); len(runes) > maxTitleLength {
+		title = string(runes[:maxTitleLength-1]) + "…"
+	}
+
+	var parts []string
+	if source != "" {
+		parts = append(parts, "Source: "+source)
+	}
+	if text = strings.TrimSpace(text); text != "" {
+		parts = append(parts, text)
+	}
+	context := strings.Join(parts, "\n\n")
+	if runes := []rune(context); len(runes) > maxContextLength {
+		context = string(runes[:maxContextLength-1]) + "…"
+	}
+
+	if project = strings.TrimSpace(project); project == "" {
+		project = captureProject()
+	}
+	var tagList []string
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			tagList = append(tagList, tag)
+		}
+	}
+	return brain{Title: title, Context: context, Project: project, Tags: strings.Join(tagList, ",")}
+}
+
+// maxCaptureBodyBytes bounds a POST /capture body, screenshot included.
+const maxCaptureBodyBytes = 10 << 20
+
+// capturePaths are the endpoints browser extensions call: CORS is enabled
+// on them and a capture-scoped key may post to them.
+var capturePaths = map[string]bool{"/capture": true, "/capture/url": true}
+
+// captureCORS answers CORS preflights for the capture endpoints and marks
+// their responses readable cross-origin, so an extension or a page script
+// can post to them. Origins default to any (credentials travel in headers,
+// never cookies); SBRAIN_CAPTURE_ORIGINS narrows them to a comma-separated
+// list such as chrome-extension://abcdef. It wraps authentication, since
+// preflights carry no credentials and a 401 must be readable too.
+func captureCORS(next http.Handler) http.Handler {
+	allowed := map[string]bool{}
+	for _, origin := range strings.Split(os.Getenv("SBRAIN_CAPTURE_ORIGINS"), ",") {
+		if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); origin != "" {
+			allowed[origin] = true
+		}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if !capturePaths[r.URL.Path] || origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		switch {
+		case len(allowed) == 0:
+			h.Set("Access-Control-Allow-Origin", "*")
+		case allowed[origin]:
+			h.Set("Access-Control-Allow-Origin", origin)
+		}
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			h.Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+			h.Set("Access-Control-Allow-Headers", "Authorization, X-API-Key, Content-Type")
+			h.Set("Access-Control-Max-Age", "86400")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		h.Set("Access-Control-Expose-Headers", "X-Request-ID")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// captureRequest is the body of POST /capture. Screenshot is a base64 PNG
+// or JPEG, optionally as a data: URL as produced by
+// chrome.tabs.captureVisibleTab.
+type captureRequest struct {
+	Title      string `json:"title"`
+	URL        string `json:"url"`
+	Selection  string `json:"selection"`
+	Note       string `json:"note"`
+	Screenshot string `json:"screenshot"`
+	Project    string `json:"project"`
+	Tags       string `json:"tags"`
+}
+
+// capture serves POST /capture: it stores what a browser extension sends
+// as a brain record tagged "clipped", without fetching anything. The
+// selection is quoted under the source URL, followed by the note, and a
+// screenshot becomes an attachment.
+func (s *Server) capture(w http.ResponseWriter, r *http.Request) {
+	var req captureRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxCaptureBodyBytes)).Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("body exceeds %d bytes", maxCaptureBodyBytes))
+			return
+		}
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("decode body: %v", err))
+		return
+	}
+	req.URL = strings.TrimSpace(req.URL)
+	if req.URL == "" && strings.TrimSpace(req.Selection) == "" && strings.TrimSpace(req.Note) == "" {
+		writeError(w, r, http.StatusBadRequest, "url, selection or note is required")
+		return
+	}
+	if req.URL != "" {
+		if u, err := url.Parse(req.URL); err != nil || u.Scheme == "" {
+			writeError(w, r, http.StatusBadRequest, "url must be an absolute URL")
+			return
+		}
+	}
+
+	var screenshot []byte
+	var screenshotType string
+	if req.Screenshot != "" {
+		var err error
+		if screenshot, screenshotType, err = decodeScreenshot(req.Screenshot); err != nil {
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	var text []string
+	if selection := strings.TrimSpace(req.Selection); selection != "" {
+		text = append(text, "> "+strings.ReplaceAll(selection, "\n", "\n> "))
+	}
+	if note := strings.TrimSpace(req.Note); note != "" {
+		text = append(text, note)
+	}
+	title := req.Title
+	if strings.TrimSpace(title) == "" && req.URL == "" {
+		title = firstLine(strings.Join(text, "\n"))
+	}
+	b := clippedBrain(title, req.URL, strings.Join(text, "\n\n"), req.Project, req.Tags)
+	if errs := validateBrain(b); len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+
+	created, err := s.insertBrain(r.Context(), b)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	attachments := []attachment{}
+	if screenshot != nil {
+		ext := strings.TrimPrefix(screenshotType, "image/")
+		a, err := s.insertAttachment(r.Context(), created.ID, "screenshot."+ext, screenshotType, screenshot)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		attachments = append(attachments, a)
+	}
+	writeJSONStatus(w, http.StatusCreated, map[string]any{
+		"brain":       created,
+		"attachments": attachments,
+	})
+}
+
+// decodeScreenshot decodes a base64 image, or a data: URL holding one, and
+// returns it with its content type, checked against the image's bytes.
+func decodeScreenshot(value string) ([]byte, string, error) {
+	if rest, ok := strings.CutPrefix(value, "data:"); ok {
+		_, payload, ok := strings.Cut(rest, ",")
+		if !ok {
+			return nil, "", errors.New("screenshot: malformed data URL")
+		}
+		value = payload
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil {
+		return nil, "", fmt.Errorf("screenshot: invalid base64: %v", err)
+	}
+	contentType := http.DetectContentType(data)
+	switch contentType {
+	case "image/png", "image/jpeg", "image/webp":
+		return data, contentType, nil
+	}
+	return nil, "", fmt.Errorf("screenshot must be a PNG, JPEG or WebP image, not %s", contentType)
+}
+
+// firstLine returns the first non-empty line of text, without any quote
+// marker.
+func firstLine(text string) string {
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), ">")); line != "" {
+			return line
+		}
+	}
+	return ""
+}
@@ -0,0 +1,184 @@
+package sbrain
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"sbrain/store"
+)
+
+// ciStatuses maps the build statuses CI systems report to the three
+// POST /integrations/ci records, and ciStatusLevels those to log levels.
+var (
+	ciStatuses = map[string]string{
+		"success": "success", "succeeded": "success", "passed": "success", "ok": "success",
+		"failed": "failed", "failure": "failed", "error": "failed", "errored": "failed", "broken": "failed",
+		"canceled": "canceled", "cancelled": "canceled", "aborted": "canceled",
+	}
+	ciStatusLevels = map[string]string{"success": "info", "failed": "error", "canceled": "warn"}
+)
+
+// ciBuild is one CI result, as POST /integrations/ci accepts it and as the
+// day's record lists it.
+type ciBuild struct {
+	Pipeline        string  `json:"pipeline"`
+	Status          string  `json:"status"`
+	DurationSeconds float64 `json:"duration_seconds,omitempty"`
+	URL             string  `json:"url,omitempty"`
+	Branch          string  `json:"branch,omitempty"`
+	Commit          string  `json:"commit,omitempty"`
+	FinishedAt      string  `json:"finished_at,omitempty"`
+}
+
+// line describes b for the day's record, e.g. "deploy failed on main at
+// abc1234 after 3m12s (details)".
+func (b ciBuild) line() string {
+	line := fmt.Sprintf("%s **%s**", b.Pipeline, b.Status)
+	if b.Branch != "" {
+		line += " on `" + b.Branch + "`"
+	}
+	if b.Commit != "" {
+		line += " at `" + b.Commit[:min(len(b.Commit), 7)] + "`"
+	}
+	if b.DurationSeconds > 0 {
+		line += " after " + b.duration().String()
+	}
+	if b.URL != "" {
+		line += " ([details](" + b.URL + "))"
+	}
+	return line
+}
+
+func (b ciBuild) duration() time.Duration {
+	return time.Duration(b.DurationSeconds * float64(time.Second)).Round(time.Second)
+}
+
+// summarizeCIBuilds is the summary sentence for a day's builds.
+func summarizeCIBuilds(builds []ciBuild) string {
+	failed := 0
+	for _, b := range builds {
+		if b.Status == "failed" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Sprintf("%s, %d failed.", plural(len(builds), "build"), failed)
+	}
+	return plural(len(builds), "build") + "."
+}
+
+// ciRequest is the body of POST /integrations/ci. Journal says whether to
+// append the build to the project's record for the day; it defaults to
+// true for failed builds only.
+type ciRequest struct {
+	ciBuild
+	Project string `json:"project"`
+	Journal *bool  `json:"journal"`
+}
+
+func validateCIBuild(req *ciRequest) []FieldError {
+	var v validator
+	req.Pipeline, req.Project = strings.TrimSpace(req.Pipeline), strings.TrimSpace(req.Project)
+	if v.required("pipeline", req.Pipeline) {
+		v.maxLength("pipeline", req.Pipeline, maxTitleLength)
+	}
+	if status, ok := ciStatuses[strings.ToLower(strings.TrimSpace(req.Status))]; ok {
+		req.Status = status
+	} else {
+		v.add("status", "must be success, failed or canceled")
+	}
+	if req.DurationSeconds < 0 {
+		v.add("duration_seconds", "must not be negative")
+	}
+	if req.URL != "" && !strings.HasPrefix(req.URL, "https://") && !strings.HasPrefix(req.URL, "http://") {
+		v.add("url", "must be an http or https URL")
+	}
+	if req.FinishedAt != "" {
+		if _, err := time.Parse(time.RFC3339, req.FinishedAt); err != nil {
+			v.add("finished_at", "must be an RFC 3339 timestamp")
+		}
+	}
+	v.maxLength("project", req.Project, maxProjectLength)
+	if req.Project == "" && req.Journal != nil && *req.Journal {
+		v.add("project", "is required to append to the journal")
+	}
+	return v.errors
+}
+
+// ciHandler serves POST /integrations/ci: it stores a CI build result as a
+// log, at error level when the build failed, and appends it to the
+// project's record for the day, the one POST /integrations/git/daily keeps,
+// when journal is true or, by default, when the build failed.
+func (s *Server) ciHandler(w http.ResponseWriter, r *http.Request) {
+	var req ciRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("decode body: %v", err))
+		return
+	}
+	if errs := validateCIBuild(&req); len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+	service, ok := requestLogService(w, r)
+	if !ok {
+		return
+	}
+	build := req.ciBuild
+	finished := time.Now()
+	if build.FinishedAt != "" {
+		finished, _ = time.Parse(time.RFC3339, build.FinishedAt)
+	}
+
+	message := fmt.Sprintf("CI %s %s", build.Pipeline, build.Status)
+	if build.Branch != "" {
+		message += " on " + build.Branch
+	}
+	if build.DurationSeconds > 0 {
+		message += " after " + build.duration().String()
+	}
+	metadata, _ := json.Marshal(map[string]any{"ci": build})
+	id, err := s.insertLog(r.Context(), logEntry{
+		OccurredAt: store.NewTimestamp(finished),
+		Level:      ciStatusLevels[build.Status],
+		Message:    message,
+		Metadata:   string(metadata),
+		Project:    req.Project,
+		Service:    cmp.Or(service, "ci"),
+	})
+	if err != nil {
+		writeError(w, r, ingestErrorStatus(err), err.Error())
+		return
+	}
+
+	resp := struct {
+		LogID int64           `json:"log_id"`
+		Brain *gitDailyRecord `json:"brain,omitempty"`
+	}{LogID: id}
+	journal := build.Status == "failed"
+	if req.Journal != nil {
+		journal = *req.Journal
+	}
+	if journal && req.Project != "" {
+		local := finished.In(store.DisplayLocation())
+		day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location())
+		rec, err := s.updateGitDay(r.Context(), req.Project, day, func(entries *gitDayEntries) int {
+			entries.Builds = append(entries.Builds, build)
+			return 1
+		})
+		if err != nil {
+			if errors.Is(err, store.ErrOutOfProject) {
+				writeError(w, r, http.StatusForbidden, "forbidden: a project-bound key cannot write records of another project")
+				return
+			}
+			writeError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		resp.Brain = &rec
+	}
+	writeJSONStatus(w, http.StatusCreated, resp)
+}
@@ -0,0 +1,39 @@
+package sbrain
+
+import (
+	"net/http"
+	"time"
+)
+
+// notModified sets Last-Modified on a list response from the time its table
+// last changed and, when the request's If-Modified-Since is no older, answers
+// 304. It reports whether the response has been written.
+//
+// Stored times have one-second resolution, so while the table changed within
+// the current second Last-Modified is left off: a second write in that same
+// second would otherwise be hidden from the poller.
+func notModified(w http.ResponseWriter, r *http.Request, modified timestamp) bool {
+	t, ok := modified.Time()
+	if !ok || !t.Before(time.Now().UTC().Truncate(time.Second)) {
+		return false
+	}
+	w.Header().Set("Last-Modified", t.Format(http.TimeFormat))
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || t.After(since) {
+		return false
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// ifModifiedSinceParameter documents the If-Modified-Since request header in
+// the OpenAPI spec.
+func ifModifiedSinceParameter() map[string]any {
+	return map[string]any{
+		"name":        "If-Modified-Since",
+		"in":          "header",
+		"description": "Answer 304 when the collection has not changed since this HTTP date (the Last-Modified of an earlier response)",
+		"schema":      map[string]any{"type": "string"},
+	}
+}
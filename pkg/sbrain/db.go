@@ -0,0 +1,81 @@
+package sbrain
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// MemoryDB is the DBPath (and SBRAIN_DB) of a database that lives in memory
+// and is gone when the server closes, for integration tests and demos that
+// should not touch disk. New always migrates it.
+const MemoryDB = ":memory:"
+
+// memoryDBs numbers in-memory databases, so two servers in one process get
+// one each.
+var memoryDBs atomic.Int64
+
+// openMemoryDB opens a new, empty in-memory database. A plain ":memory:"
+// would give every pooled connection a database of its own, so it uses the
+// memdb VFS instead, whose "/"-named databases are shared by all connections
+// in the process and lock like files do.
+func openMemoryDB() (*sql.DB, error) {
+	if os.Getenv("SBRAIN_REPLICA_DIR") != "" {
+		return nil, fmt.Errorf("SBRAIN_REPLICA_DIR cannot replicate an in-memory database")
+	}
+	dsn := fmt.Sprintf("file:/sbrain-memory-%d?vfs=memdb", memoryDBs.Add(1))
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open in-memory db: %w", err)
+	}
+	if err := configureDBPool(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	// The database is freed with its last connection, so the pool must
+	// always keep one, whatever the pool settings say.
+	db.SetMaxIdleConns(2)
+	db.SetConnMaxLifetime(0)
+	db.SetConnMaxIdleTime(0)
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("ping in-memory db: %w", err)
+	}
+	log.Printf("database is in memory: nothing is written to disk and everything is lost on exit")
+	return db, nil
+}
+
+// configureDBPool applies the connection pool settings from the environment.
+// Unset variables keep database/sql's defaults.
+//
+//   - SBRAIN_DB_MAX_OPEN_CONNS: maximum open connections (0 means unlimited)
+//   - SBRAIN_DB_MAX_IDLE_CONNS: maximum idle connections kept in the pool
+//   - SBRAIN_DB_CONN_MAX_LIFETIME: how long a connection may be reused, e.g. "30m"
+func configureDBPool(db *sql.DB) error {
+	if raw := os.Getenv("SBRAIN_DB_MAX_OPEN_CONNS"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid SBRAIN_DB_MAX_OPEN_CONNS %q", raw)
+		}
+		db.SetMaxOpenConns(n)
+	}
+	if raw := os.Getenv("SBRAIN_DB_MAX_IDLE_CONNS"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid SBRAIN_DB_MAX_IDLE_CONNS %q", raw)
+		}
+		db.SetMaxIdleConns(n)
+	}
+	if raw := os.Getenv("SBRAIN_DB_CONN_MAX_LIFETIME"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < 0 {
+			return fmt.Errorf("invalid SBRAIN_DB_CONN_MAX_LIFETIME %q", raw)
+		}
+		db.SetConnMaxLifetime(d)
+	}
+	return nil
+}
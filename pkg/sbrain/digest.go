@@ -0,0 +1,204 @@
+package sbrain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"sbrain/store"
+)
+
+// sqliteTimeLayout matches the format SQLite uses for CURRENT_TIMESTAMP.
+const sqliteTimeLayout = "2006-01-02 15:04:05"
+
+// digestErrorSampleLimit caps how many error log lines are included in a
+// digest; the total count is always reported.
+const digestErrorSampleLimit = 20
+
+// errDigestSampled stops listing error logs once a digest has its sample.
+var errDigestSampled = errors.New("digest error sample full")
+
+type digest struct {
+	Period     string          `json:"period"`
+	Start      string          `json:"start"`
+	End        string          `json:"end"`
+	BrainCount int             `json:"brain_count"`
+	ErrorCount int             `json:"error_count"`
+	Brains     []brain         `json:"brains,omitempty"`
+	Projects   []projectDigest `json:"projects,omitempty"`
+	Errors     []logEntry      `json:"errors"`
+}
+
+type projectDigest struct {
+	Project string  `json:"project"`
+	Brains  []brain `json:"brains"`
+}
+
+func (s *Server) digestHandler(w http.ResponseWriter, r *http.Request) {
+	day, err := parseDigestDate(r.URL.Query().Get("date"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.serveDigest(w, r, "daily", day, day.AddDate(0, 0, 1))
+}
+
+func (s *Server) weeklyDigestHandler(w http.ResponseWriter, r *http.Request) {
+	day, err := parseDigestDate(r.URL.Query().Get("date"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Weeks start on Monday, matching ISO 8601.
+	offset := (int(day.Weekday()) + 6) % 7
+	start := day.AddDate(0, 0, -offset)
+	s.serveDigest(w, r, "weekly", start, start.AddDate(0, 0, 7))
+}
+
+func (s *Server) serveDigest(w http.ResponseWriter, r *http.Request, period string, start, end time.Time) {
+	groupBy := r.URL.Query().Get("group")
+	if groupBy != "" && groupBy != "project" {
+		writeError(w, r, http.StatusBadRequest, "group must be \"project\"")
+		return
+	}
+
+	d, err := s.buildDigest(r.Context(), period, start, end, groupBy == "project")
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	switch r.URL.Query().Get("format") {
+	case "", "json":
+		writeJSON(w, http.StatusOK, d)
+	case "markdown", "md":
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(renderDigestMarkdown(d)))
+	default:
+		writeError(w, r, http.StatusBadRequest, "format must be json or markdown")
+	}
+}
+
+func parseDigestDate(value string) (time.Time, error) {
+	if value == "" {
+		now := time.Now().UTC()
+		return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC), nil
+	}
+	day, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q: expected YYYY-MM-DD", value)
+	}
+	return day, nil
+}
+
+func (s *Server) buildDigest(ctx context.Context, period string, start, end time.Time, groupByProject bool) (digest, error) {
+	d := digest{
+		Period: period,
+		Start:  start.Format("2006-01-02"),
+		End:    end.AddDate(0, 0, -1).Format("2006-01-02"),
+		Errors: []logEntry{},
+	}
+	from := start.Format(sqliteTimeLayout)
+	to := end.Format(sqliteTimeLayout)
+
+	var brains []brain
+	if err := s.brains.ListBrains(ctx, store.BrainFilter{CreatedSince: from, CreatedUntil: to, Order: store.OldestFirst}, func(b brain) error {
+		brains = append(brains, b)
+		return nil
+	}); err != nil {
+		return d, err
+	}
+	d.BrainCount = len(brains)
+
+	if groupByProject {
+		byProject := map[string][]brain{}
+		for _, b := range brains {
+			byProject[b.Project] = append(byProject[b.Project], b)
+		}
+		for project, items := range byProject {
+			d.Projects = append(d.Projects, projectDigest{Project: project, Brains: items})
+		}
+		sort.Slice(d.Projects, func(i, j int) bool { return d.Projects[i].Project < d.Projects[j].Project })
+	} else {
+		d.Brains = brains
+	}
+
+	errorLogs := store.LogFilter{Levels: []string{"error", "fatal"}, Since: from, Until: to}
+	count, err := s.logs.CountLogs(ctx, errorLogs)
+	if err != nil {
+		return d, fmt.Errorf("count error logs: %w", err)
+	}
+	d.ErrorCount = int(count)
+	if err := s.logs.ListLogs(ctx, errorLogs, func(l logEntry) error {
+		d.Errors = append(d.Errors, l)
+		if len(d.Errors) == digestErrorSampleLimit {
+			return errDigestSampled
+		}
+		return nil
+	}); err != nil && !errors.Is(err, errDigestSampled) {
+		return d, err
+	}
+
+	return d, nil
+}
+
+func renderDigestMarkdown(d digest) string {
+	var b strings.Builder
+	if d.Period == "weekly" {
+		fmt.Fprintf(&b, "# Weekly digest — %s to %s\n\n", d.Start, d.End)
+	} else {
+		fmt.Fprintf(&b, "# Daily digest — %s\n\n", d.Start)
+	}
+	fmt.Fprintf(&b, "%d brain entries, %d error logs.\n\n", d.BrainCount, d.ErrorCount)
+
+	b.WriteString("## Brain entries\n\n")
+	if d.BrainCount == 0 {
+		b.WriteString("_Nothing recorded._\n\n")
+	}
+	writeEntries := func(items []brain, withProject bool) {
+		for _, item := range items {
+			b.WriteString("- ")
+			if withProject {
+				fmt.Fprintf(&b, "[%s] ", item.Project)
+			}
+			fmt.Fprintf(&b, "**%s** (#%d, %s)", item.Title, item.ID, item.CreatedAt.Display())
+			if item.Tags != "" {
+				fmt.Fprintf(&b, " — tags: %s", item.Tags)
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString("\n")
+	}
+	if len(d.Projects) > 0 {
+		for _, p := range d.Projects {
+			fmt.Fprintf(&b, "### %s\n\n", p.Project)
+			writeEntries(p.Brains, false)
+		}
+	} else if len(d.Brains) > 0 {
+		writeEntries(d.Brains, true)
+	}
+
+	b.WriteString("## Errors\n\n")
+	if d.ErrorCount == 0 {
+		b.WriteString("_No errors logged._\n")
+		return b.String()
+	}
+	for _, l := range d.Errors {
+		fmt.Fprintf(&b, "- `%s` %s", l.OccurredAt.Display(), l.Message)
+		if l.Endpoint != "" {
+			fmt.Fprintf(&b, " (%s %s)", l.Method, l.Endpoint)
+		}
+		b.WriteString("\n")
+	}
+	if d.ErrorCount > len(d.Errors) {
+		fmt.Fprintf(&b, "- …and %d more\n", d.ErrorCount-len(d.Errors))
+	}
+	return b.String()
+}
@@ -0,0 +1,287 @@
+package sbrain
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type digestDestination struct {
+	ID             int64     `json:"id"`
+	CreatedAt      timestamp `json:"created_at"`
+	Kind           string    `json:"kind"`
+	Target         string    `json:"target"`
+	SendAt         string    `json:"send_at"`
+	GroupByProject bool      `json:"group_by_project"`
+	Enabled        bool      `json:"enabled"`
+	LastSentOn     string    `json:"last_sent_on"`
+}
+
+type digestDeliveryResult struct {
+	DestinationID int64  `json:"destination_id"`
+	Kind          string `json:"kind"`
+	Target        string `json:"target"`
+	OK            bool   `json:"ok"`
+	Error         string `json:"error,omitempty"`
+}
+
+func (s *Server) listDigestDestinations(w http.ResponseWriter, r *http.Request) {
+	destinations, err := s.loadDigestDestinations(r.Context(), false)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, destinations)
+}
+
+func (s *Server) createDigestDestination(w http.ResponseWriter, r *http.Request) {
+	req := digestDestination{SendAt: "18:00", Enabled: true}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("decode body: %v", err))
+		return
+	}
+
+	req.Target = strings.TrimSpace(req.Target)
+	if req.Kind != "email" && req.Kind != "slack" {
+		writeError(w, r, http.StatusBadRequest, "kind must be email or slack")
+		return
+	}
+	if req.Target == "" {
+		writeError(w, r, http.StatusBadRequest, "target is required")
+		return
+	}
+	sendAt, err := time.Parse("15:04", req.SendAt)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "send_at must be HH:MM (UTC)")
+		return
+	}
+	// "9:00" parses too; store it as "09:00" like every other time.
+	req.SendAt = sendAt.Format("15:04")
+
+	res, err := s.db.ExecContext(r.Context(), `INSERT INTO digest_destinations (kind, target, send_at, group_by_project, enabled)
+		VALUES (?, ?, ?, ?, ?)`, req.Kind, req.Target, req.SendAt, req.GroupByProject, req.Enabled)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("insert digest destination: %v", err))
+		return
+	}
+
+	id, _ := res.LastInsertId()
+	var d digestDestination
+	row := s.db.QueryRowContext(r.Context(), `SELECT id, created_at, kind, target, send_at, group_by_project, enabled, last_sent_on
+		FROM digest_destinations WHERE id = ?`, id)
+	if err := row.Scan(&d.ID, &d.CreatedAt, &d.Kind, &d.Target, &d.SendAt, &d.GroupByProject, &d.Enabled, &d.LastSentOn); err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("load digest destination: %v", err))
+		return
+	}
+	s.recordAudit(r.Context(), auditCreate, "digest_destination", d.ID, nil, d)
+	writeJSONStatus(w, http.StatusCreated, d)
+}
+
+// testDigestHandler sends today's digest immediately, either to every
+// destination or to the one named by ?destination_id=.
+func (s *Server) testDigestHandler(w http.ResponseWriter, r *http.Request) {
+	var onlyID int64
+	if raw := r.URL.Query().Get("destination_id"); raw != "" {
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "invalid destination_id")
+			return
+		}
+		onlyID = id
+	}
+
+	destinations, err := s.loadDigestDestinations(r.Context(), false)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	day, _ := parseDigestDate("")
+	results := []digestDeliveryResult{}
+	for _, d := range destinations {
+		if onlyID != 0 && d.ID != onlyID {
+			continue
+		}
+		result := digestDeliveryResult{DestinationID: d.ID, Kind: d.Kind, Target: d.Target, OK: true}
+		if err := s.deliverDigest(r.Context(), d, day); err != nil {
+			result.OK = false
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	if onlyID != 0 && len(results) == 0 {
+		writeError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, results)
+}
+
+func (s *Server) loadDigestDestinations(ctx context.Context, enabledOnly bool) ([]digestDestination, error) {
+	query := `SELECT id, created_at, kind, target, send_at, group_by_project, enabled, last_sent_on
+		FROM digest_destinations`
+	if enabledOnly {
+		query += ` WHERE enabled = 1`
+	}
+	rows, err := s.db.QueryContext(ctx, query+` ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("query digest destinations: %w", err)
+	}
+	defer rows.Close()
+
+	items := []digestDestination{}
+	for rows.Next() {
+		var d digestDestination
+		if err := rows.Scan(&d.ID, &d.CreatedAt, &d.Kind, &d.Target, &d.SendAt, &d.GroupByProject, &d.Enabled, &d.LastSentOn); err != nil {
+			return nil, fmt.Errorf("scan digest destination: %w", err)
+		}
+		items = append(items, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate digest destinations: %w", err)
+	}
+	return items, nil
+}
+
+// runDigestScheduler checks once a minute for destinations whose send_at
+// time has passed today and delivers the current day's digest to them.
+func (s *Server) runDigestScheduler(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.sendDueDigests(ctx, now.UTC())
+		}
+	}
+}
+
+func (s *Server) sendDueDigests(ctx context.Context, now time.Time) {
+	destinations, err := s.loadDigestDestinations(ctx, true)
+	if err != nil {
+		log.Printf("digest scheduler: %v", err)
+		return
+	}
+
+	today := now.Format("2006-01-02")
+	clock, _ := time.Parse("15:04", now.Format("15:04"))
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	for _, d := range destinations {
+		// Compared as times, not strings: rows stored before send_at was
+		// normalized may hold "9:00".
+		sendAt, err := time.Parse("15:04", d.SendAt)
+		if err != nil || d.LastSentOn == today || clock.Before(sendAt) {
+			continue
+		}
+		if err := s.deliverDigest(ctx, d, day); err != nil {
+			log.Printf("digest scheduler: deliver to destination %d (%s): %v", d.ID, d.Kind, err)
+			continue
+		}
+		if _, err := s.db.ExecContext(ctx, `UPDATE digest_destinations SET last_sent_on = ? WHERE id = ?`, today, d.ID); err != nil {
+			log.Printf("digest scheduler: mark destination %d sent: %v", d.ID, err)
+		}
+	}
+}
+
+func (s *Server) deliverDigest(ctx context.Context, d digestDestination, day time.Time) error {
+	dg, err := s.buildDigest(ctx, "daily", day, day.AddDate(0, 0, 1), d.GroupByProject)
+	if err != nil {
+		return err
+	}
+	body := renderDigestMarkdown(dg)
+
+	switch d.Kind {
+	case "email":
+		return sendDigestEmail(d.Target, "sbrain daily digest — "+dg.Start, body)
+	case "slack":
+		return sendSlackMessage(d.Target, body)
+	default:
+		return fmt.Errorf("unsupported destination kind %q", d.Kind)
+	}
+}
+
+// sendDigestEmail delivers a plain-text message using the SMTP server in
+// SBRAIN_SMTP_ADDR (host:port). SBRAIN_SMTP_USERNAME and SBRAIN_SMTP_PASSWORD
+// enable PLAIN auth; SBRAIN_SMTP_FROM sets the sender. The subject is
+// encoded, so titles with non-ASCII text or line breaks arrive intact.
+func sendDigestEmail(to string, subject string, body string) error {
+	addr := os.Getenv("SBRAIN_SMTP_ADDR")
+	if addr == "" {
+		return errors.New("SBRAIN_SMTP_ADDR is not configured")
+	}
+	from := os.Getenv("SBRAIN_SMTP_FROM")
+	if from == "" {
+		from = "sbrain@localhost"
+	}
+
+	var auth smtp.Auth
+	if username := os.Getenv("SBRAIN_SMTP_USERNAME"); username != "" {
+		host := addr
+		if i := strings.LastIndex(addr, ":"); i >= 0 {
+			host = addr[:i]
+		}
+		auth = smtp.PlainAuth("", username, os.Getenv("SBRAIN_SMTP_PASSWORD"), host)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	return smtp.SendMail(addr, auth, from, []string{to}, msg.Bytes())
+}
+
+func sendSlackMessage(webhookURL string, text string) error {
+	payload, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(webhookURL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("post slack webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("slack webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// postJSONWebhook POSTs payload as JSON to url and expects a 2xx answer.
+func postJSONWebhook(url string, payload any) error {
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(encoded))
+	if err != nil {
+		return fmt.Errorf("post webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package sbrain
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"sbrain/store"
+)
+
+// Free-space thresholds, overridable with SBRAIN_DISK_WARN_MB and
+// SBRAIN_DISK_CRITICAL_MB.
+const (
+	defaultDiskWarnMB     = 500
+	defaultDiskCriticalMB = 100
+)
+
+// Disk states, from least to most severe.
+const (
+	diskOK       = "ok"
+	diskWarning  = "warning"
+	diskCritical = "critical"
+	diskUnknown  = "unknown"
+)
+
+// diskUsage is one sample of the database's size and its volume's space.
+type diskUsage struct {
+	State      string    `json:"state"`
+	DBBytes    int64     `json:"db_bytes"`
+	WALBytes   int64     `json:"wal_bytes"`
+	FreeBytes  uint64    `json:"free_bytes"`
+	TotalBytes uint64    `json:"total_bytes"`
+	Error      string    `json:"error,omitempty"`
+	CheckedAt  timestamp `json:"checked_at"`
+}
+
+// diskMonitor samples disk usage every minute, logs when free space crosses
+// a threshold, and with protect set refuses writes other than log ingestion
+// while space is critical.
+type diskMonitor struct {
+	path          string
+	warnBytes     uint64
+	criticalBytes uint64
+	protect       bool
+	rejected      atomic.Int64
+
+	mu   sync.Mutex
+	last diskUsage
+}
+
+func newDiskMonitor(dbPath string) (*diskMonitor, error) {
+	if dbPath != "" && dbPath != MemoryDB {
+		if abs, err := filepath.Abs(dbPath); err == nil {
+			dbPath = abs
+		}
+	}
+	m := &diskMonitor{
+		path:          dbPath,
+		warnBytes:     defaultDiskWarnMB << 20,
+		criticalBytes: defaultDiskCriticalMB << 20,
+		protect:       os.Getenv("SBRAIN_DISK_PROTECT") == "true",
+	}
+	for _, threshold := range []struct {
+		name string
+		dest *uint64
+	}{{"SBRAIN_DISK_WARN_MB", &m.warnBytes}, {"SBRAIN_DISK_CRITICAL_MB", &m.criticalBytes}} {
+		if raw := os.Getenv(threshold.name); raw != "" {
+			n, err := strconv.ParseUint(raw, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s %q", threshold.name, raw)
+			}
+			*threshold.dest = n << 20
+		}
+	}
+	if m.criticalBytes > m.warnBytes {
+		return nil, fmt.Errorf("SBRAIN_DISK_CRITICAL_MB must not exceed SBRAIN_DISK_WARN_MB")
+	}
+	m.sample()
+	return m, nil
+}
+
+// run samples once a minute.
+func (m *diskMonitor) run(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.sample()
+		}
+	}
+}
+
+// sample measures the database and its volume, records the result and logs
+// any change of state.
+func (m *diskMonitor) sample() diskUsage {
+	u := diskUsage{State: diskUnknown, CheckedAt: store.NewTimestamp(time.Now())}
+	if m.path == "" || m.path == MemoryDB {
+		u.Error = "the database path is not known"
+		if m.path == MemoryDB {
+			u.Error = "the database is in memory"
+		}
+		m.mu.Lock()
+		m.last = u
+		m.mu.Unlock()
+		return u
+	}
+	if info, err := os.Stat(m.path); err == nil {
+		u.DBBytes = info.Size()
+	}
+	if info, err := os.Stat(m.path + "-wal"); err == nil {
+		u.WALBytes = info.Size()
+	}
+	free, total, err := volumeSpace(filepath.Dir(m.path))
+	switch {
+	case err != nil:
+		u.Error = err.Error()
+	case free <= m.criticalBytes:
+		u.State = diskCritical
+	case free <= m.warnBytes:
+		u.State = diskWarning
+	default:
+		u.State = diskOK
+	}
+	u.FreeBytes, u.TotalBytes = free, total
+
+	m.mu.Lock()
+	previous := m.last.State
+	m.last = u
+	m.mu.Unlock()
+
+	if u.State != previous {
+		switch u.State {
+		case diskCritical:
+			action := ""
+			if m.protect {
+				action = "; refusing non-log writes"
+			}
+			log.Printf("warning: disk space critical: %d MB free on the database volume (threshold %d MB)%s", free>>20, m.criticalBytes>>20, action)
+		case diskWarning:
+			log.Printf("warning: disk space low: %d MB free on the database volume (threshold %d MB)", free>>20, m.warnBytes>>20)
+		case diskOK:
+			if previous != "" && previous != diskUnknown {
+				log.Printf("disk space recovered: %d MB free on the database volume", free>>20)
+			}
+		case diskUnknown:
+			log.Printf("warning: cannot measure free disk space: %s", u.Error)
+		}
+	}
+	return u
+}
+
+func (m *diskMonitor) current() diskUsage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.last
+}
+
+// protectWrites answers 507 to POST, PUT and PATCH requests other than log
+// ingestion, and to /quick, while the monitor is protecting and space is critical. Reads
+// and deletes, which are how space gets freed, always pass.
+func (m *diskMonitor) protectWrites(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m.protect && isDiskWrite(r) && m.current().State == diskCritical {
+			m.rejected.Add(1)
+			w.Header().Set("Retry-After", "300")
+			writeError(w, r, http.StatusInsufficientStorage, "disk space is critically low: only log ingestion is accepted until space is freed")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func isDiskWrite(r *http.Request) bool {
+	if r.URL.Path == quickCapturePath {
+		return true
+	}
+	switch r.Method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+	default:
+		return false
+	}
+	p := r.URL.Path
+	return !(p == "/logs" || strings.HasPrefix(p, "/logs/") || p == "/v1/logs" || strings.HasPrefix(p, "/loki/"))
+}
+
+// healthzHandler serves GET /healthz: liveness plus the latest disk sample.
+// It answers 200 even when space is low so a liveness probe does not
+// restart a server that is merely short of disk.
+func (s *Server) healthzHandler(w http.ResponseWriter, r *http.Request) {
+	disk := s.disk.current()
+	status := "ok"
+	if disk.State == diskWarning || disk.State == diskCritical {
+		status = "degraded"
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"status": status, "disk": disk})
+}
+
+// metricsHandler serves GET /metrics in the Prometheus text format.
+func (s *Server) metricsHandler(w http.ResponseWriter, r *http.Request) {
+	disk := s.disk.current()
+	state := map[string]int{diskOK: 0, diskWarning: 1, diskCritical: 2, diskUnknown: -1}[disk.State]
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	for _, m := range []struct {
+		name, kind, help string
+		value            any
+	}{
+		{"sbrain_db_size_bytes", "gauge", "Size of the SQLite database file.", disk.DBBytes},
+		{"sbrain_db_wal_size_bytes", "gauge", "Size of the SQLite write-ahead log.", disk.WALBytes},
+		{"sbrain_disk_free_bytes", "gauge", "Bytes available on the database volume.", disk.FreeBytes},
+		{"sbrain_disk_total_bytes", "gauge", "Size of the database volume.", disk.TotalBytes},
+		{"sbrain_disk_state", "gauge", "Disk state: 0 ok, 1 warning, 2 critical, -1 unknown.", state},
+		{"sbrain_disk_rejected_writes_total", "counter", "Writes refused because disk space was critical.", s.disk.rejected.Load()},
+	} {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", m.name, m.help, m.name, m.kind, m.name, m.value)
+	}
+}
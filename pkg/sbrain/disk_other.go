@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !freebsd
+
+package sbrain
+
+import "errors"
+
+// volumeSpace is not implemented on this platform; disk monitoring reports
+// the database size only.
+func volumeSpace(path string) (free, total uint64, err error) {
+	return 0, 0, errors.New("free space is not available on this platform")
+}
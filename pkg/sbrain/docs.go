@@ -0,0 +1,13 @@
+package sbrain
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+//go:embed web/docs.html
+var docsHTML []byte
+
+func (s *Server) docsHandler(w http.ResponseWriter, r *http.Request) {
+	docsAsset.ServeHTTP(w, r)
+}
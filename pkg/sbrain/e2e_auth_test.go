@@ -0,0 +1,116 @@
+package sbrain
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestAuthRequired(t *testing.T) {
+	ts := newTestServer(t)
+
+	rec := ts.do(request{method: http.MethodGet, path: "/brain", key: "-"})
+	expectError(t, rec, http.StatusUnauthorized, "unauthorized")
+	if rec.Header().Get("WWW-Authenticate") == "" {
+		t.Fatal("401 without WWW-Authenticate")
+	}
+	expectError(t, ts.do(request{method: http.MethodGet, path: "/brain", key: "wrong"}), http.StatusUnauthorized, "unauthorized")
+
+	// Health checks, the spec and the root answer without credentials.
+	for _, path := range []string{"/", "/healthz", "/readyz", "/openapi"} {
+		expect(t, ts.do(request{method: http.MethodGet, path: path, key: "-"}), http.StatusOK)
+	}
+}
+
+func TestAuthHeaders(t *testing.T) {
+	ts := newTestServer(t)
+	for name, header := range map[string]map[string]string{
+		"bearer":    {"Authorization": "Bearer " + readKey},
+		"x-api-key": {"X-API-Key": readKey},
+		"cookie":    {"Cookie": sessionCookieName + "=" + readKey},
+	} {
+		t.Run(name, func(t *testing.T) {
+			expect(t, ts.do(request{method: http.MethodGet, path: "/whoami", key: "-", header: header}), http.StatusOK)
+		})
+	}
+}
+
+func TestAuthScopes(t *testing.T) {
+	ts := newTestServer(t)
+	ts.brain(brain{})
+	brainBody := map[string]any{"title": "t", "context": "c", "project": "sbrain"}
+
+	tests := []struct {
+		name   string
+		key    string
+		method string
+		path   string
+		body   any
+		status int
+	}{
+		{"read lists", readKey, "GET", "/brain", nil, 200},
+		{"read cannot write", readKey, "POST", "/brain", brainBody, 403},
+		{"read cannot quick-capture", readKey, "GET", "/quick?text=hi", nil, 403},
+		{"read queries grafana", readKey, "POST", "/grafana/search", map[string]any{}, 200},
+		{"read cannot see admin", readKey, "GET", "/admin/config", nil, 403},
+		{"write writes", writeKey, "POST", "/brain", brainBody, 201},
+		{"write deletes", writeKey, "DELETE", "/logs/99", nil, 404},
+		{"write cannot see admin", writeKey, "GET", "/admin/flags", nil, 403},
+		{"logs-only ships logs", logsKey, "POST", "/logs", map[string]any{"message": "m"}, 201},
+		{"logs-only cannot read logs", logsKey, "GET", "/logs", nil, 403},
+		{"logs-only cannot write brains", logsKey, "POST", "/brain", brainBody, 403},
+		{"capture clips", captureKey, "POST", "/capture", map[string]any{"note": "hello"}, 201},
+		{"capture quick-captures", captureKey, "GET", "/quick?text=hi", nil, 201},
+		{"capture cannot read", captureKey, "GET", "/brain", nil, 403},
+		{"admin sees admin", adminKey, "GET", "/admin/config", nil, 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := ts.do(request{method: tt.method, path: tt.path, body: tt.body, key: tt.key})
+			if tt.status == http.StatusForbidden {
+				expectError(t, rec, http.StatusForbidden, "forbidden")
+				return
+			}
+			expect(t, rec, tt.status)
+		})
+	}
+}
+
+func TestAuthQueryKey(t *testing.T) {
+	ts := newTestServer(t)
+	// Calendar apps and quick-capture links cannot send headers.
+	expect(t, ts.do(request{method: http.MethodGet, path: "/calendar.ics?key=" + readKey, key: "-"}), http.StatusOK)
+	expect(t, ts.do(request{method: http.MethodGet, path: "/quick?text=hi&key=" + captureKey, key: "-"}), http.StatusCreated)
+	// Anywhere else a key in the URL is ignored.
+	expectError(t, ts.do(request{method: http.MethodGet, path: "/brain?key=" + readKey, key: "-"}), http.StatusUnauthorized, "unauthorized")
+}
+
+func TestProjectBoundKey(t *testing.T) {
+	ts := newTestServer(t)
+	ts.brain(brain{Title: "Theirs", Project: "other"})
+
+	created := decode[brain](t, ts.do(request{method: "POST", path: "/brain", key: projectKey,
+		body: map[string]any{"title": "Ours", "context": "c"}}), http.StatusCreated)
+	if created.Project != "team" {
+		t.Fatalf("project = %q, want the key's", created.Project)
+	}
+	expectError(t, ts.do(request{method: "POST", path: "/brain", key: projectKey,
+		body: map[string]any{"title": "Elsewhere", "context": "c", "project": "other"}}), http.StatusForbidden, "forbidden")
+
+	list := decode[[]brain](t, ts.do(request{method: "GET", path: "/brain", key: projectKey}), http.StatusOK)
+	if got := ids(list); len(got) != 1 || got[0] != created.ID {
+		t.Fatalf("list = %v, want only the project's record", got)
+	}
+	expectError(t, ts.do(request{method: "GET", path: "/brain/1", key: projectKey}), http.StatusNotFound, "not_found")
+
+	whoami := decode[principal](t, ts.do(request{method: "GET", path: "/whoami", key: projectKey}), http.StatusOK)
+	if whoami.Project != "team" {
+		t.Fatalf("whoami = %+v", whoami)
+	}
+}
+
+func TestAuthDisabled(t *testing.T) {
+	ts := newTestServer(t, "SBRAIN_API_KEYS=")
+	// Without keys or OIDC configured the API is open, for local use.
+	expect(t, ts.do(request{method: http.MethodGet, path: "/brain", key: "-"}), http.StatusOK)
+	expect(t, ts.do(request{method: http.MethodGet, path: "/admin/flags", key: "-"}), http.StatusOK)
+}
@@ -0,0 +1,565 @@
+package sbrain
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"sbrain/store"
+)
+
+func TestBrainLifecycle(t *testing.T) {
+	ts := newTestServer(t)
+
+	created := decode[brain](t, ts.post("/brain", map[string]any{
+		"title": "Retry idea", "context": "Back off on 429s", "project": "sbrain", "tags": "ideas,perf",
+	}), http.StatusCreated)
+	if created.ID == 0 || created.Version != 1 || created.Tags != "ideas,perf" {
+		t.Fatalf("created = %+v", created)
+	}
+
+	got := decode[brain](t, ts.get("/brain/1"), http.StatusOK)
+	if got.Title != "Retry idea" || got.Context != "Back off on 429s" {
+		t.Fatalf("got = %+v", got)
+	}
+
+	updated := decode[brain](t, ts.do(request{method: http.MethodPut, path: "/brain/1", body: map[string]any{
+		"title": "Retry with jitter", "context": "Back off on 429s", "project": "sbrain", "version": 1,
+	}}), http.StatusOK)
+	if updated.Title != "Retry with jitter" || updated.Version != 2 {
+		t.Fatalf("updated = %+v", updated)
+	}
+
+	expect(t, ts.do(request{method: http.MethodDelete, path: "/brain/1"}), http.StatusNoContent)
+	expectError(t, ts.get("/brain/1"), http.StatusNotFound, "not_found")
+	trash := decode[[]brain](t, ts.get("/trash"), http.StatusOK)
+	if len(trash) != 1 || trash[0].ID != 1 {
+		t.Fatalf("trash = %+v", trash)
+	}
+
+	restored := decode[brain](t, ts.post("/trash/1/restore", nil), http.StatusOK)
+	if restored.Title != "Retry with jitter" {
+		t.Fatalf("restored = %+v", restored)
+	}
+	expect(t, ts.get("/brain/1"), http.StatusOK)
+}
+
+func TestBrainCreateSuggestsTags(t *testing.T) {
+	ts := newTestServer(t)
+	ts.brain(brain{Title: "Retry budget", Context: "retry retry backoff", Tags: "retry"})
+
+	created := decode[struct {
+		brain
+		SuggestedTags []string `json:"suggested_tags"`
+	}](t, ts.post("/brain", map[string]any{"title": "Retry storms", "context": "more retry trouble", "project": "sbrain"}), http.StatusCreated)
+	if !slices.Contains(created.SuggestedTags, "retry") {
+		t.Fatalf("suggested_tags = %v, want retry among them", created.SuggestedTags)
+	}
+}
+
+func TestBrainValidation(t *testing.T) {
+	ts := newTestServer(t)
+	tests := []struct {
+		name   string
+		body   map[string]any
+		fields []string
+	}{
+		{"empty", map[string]any{}, []string{"title", "context", "project"}},
+		{"blank title", map[string]any{"title": "  ", "context": "c", "project": "p"}, []string{"title"}},
+		{"long title", map[string]any{"title": strings.Repeat("x", maxTitleLength+1), "context": "c", "project": "p"}, []string{"title"}},
+		{"project not a slug", map[string]any{"title": "t", "context": "c", "project": "my project"}, []string{"project"}},
+		{"bad tag", map[string]any{"title": "t", "context": "c", "project": "p", "tags": "ok,not ok!"}, []string{"tags"}},
+		{"too many tags", map[string]any{"title": "t", "context": "c", "project": "p", "tags": strings.Repeat("t,", maxTagCount) + "last"}, []string{"tags"}},
+		{"long summary", map[string]any{"title": "t", "context": "c", "project": "p", "summary": strings.Repeat("s", maxSummaryLength+1)}, []string{"summary"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectFields(t, ts.post("/brain", tt.body), tt.fields...)
+		})
+	}
+	if got := decode[[]brain](t, ts.get("/brain"), http.StatusOK); len(got) != 0 {
+		t.Fatalf("invalid bodies stored %d records", len(got))
+	}
+}
+
+func TestBrainUpdateVersioning(t *testing.T) {
+	ts := newTestServer(t)
+	ts.brain(brain{})
+	body := func(version any) map[string]any {
+		b := map[string]any{"title": "Edited", "context": "c", "project": "sbrain"}
+		if version != nil {
+			b["version"] = version
+		}
+		return b
+	}
+	put := func(path string, b any) *httptest.ResponseRecorder {
+		return ts.do(request{method: http.MethodPut, path: path, body: b})
+	}
+
+	expectError(t, put("/brain/1", body(nil)), http.StatusPreconditionRequired, "precondition_required")
+	expect(t, put("/brain/1", body(1)), http.StatusOK)
+
+	apiErr := expectError(t, put("/brain/1", body(1)), http.StatusConflict, "conflict")
+	current, _ := json.Marshal(apiErr.Current)
+	var stored brain
+	if err := json.Unmarshal(current, &stored); err != nil || stored.Version != 2 {
+		t.Fatalf("conflict current = %s", current)
+	}
+
+	expectError(t, put("/brain/99", body(1)), http.StatusNotFound, "not_found")
+	expectError(t, put("/brain/abc", body(1)), http.StatusBadRequest, "bad_request")
+	expectFields(t, put("/brain/1", map[string]any{"version": 2}), "title", "context", "project")
+}
+
+// TestBrainUpdateKeepsOmittedFlags checks that a PUT without pinned,
+// favorite, archived or remind_at leaves them as they were.
+func TestBrainUpdateKeepsOmittedFlags(t *testing.T) {
+	ts := newTestServer(t)
+	ts.brain(brain{Pinned: true, Favorite: true, RemindAt: "2099-01-01 09:00:00"})
+	updated := decode[brain](t, ts.do(request{method: http.MethodPut, path: "/brain/1", body: map[string]any{
+		"title": "Edited", "context": "c", "project": "sbrain", "version": 1,
+	}}), http.StatusOK)
+	if !updated.Pinned || !updated.Favorite || updated.RemindAt == "" {
+		t.Fatalf("updated = %+v", updated)
+	}
+}
+
+func TestBrainFlags(t *testing.T) {
+	ts := newTestServer(t)
+	ts.brain(brain{Title: "Plain"})
+	ts.brain(brain{Title: "Pin me"})
+
+	pinned := decode[brain](t, ts.do(request{method: http.MethodPut, path: "/brain/2/pin"}), http.StatusOK)
+	if !pinned.Pinned {
+		t.Fatalf("pinned = %+v", pinned)
+	}
+	list := decode[[]brain](t, ts.get("/brain"), http.StatusOK)
+	if got := ids(list); !slices.Equal(got, []int64{2, 1}) {
+		t.Fatalf("list order = %v, want the pinned record first", got)
+	}
+	if got := ids(decode[[]brain](t, ts.get("/brain?pinned=true"), http.StatusOK)); !slices.Equal(got, []int64{2}) {
+		t.Fatalf("pinned=true = %v", got)
+	}
+
+	expect(t, ts.do(request{method: http.MethodPut, path: "/brain/1/archive"}), http.StatusOK)
+	if got := ids(decode[[]brain](t, ts.get("/brain"), http.StatusOK)); !slices.Equal(got, []int64{2}) {
+		t.Fatalf("list with an archived record = %v", got)
+	}
+	if got := ids(decode[[]brain](t, ts.get("/brain?archived=true"), http.StatusOK)); !slices.Equal(got, []int64{1}) {
+		t.Fatalf("archived=true = %v", got)
+	}
+	if got := ids(decode[[]brain](t, ts.get("/brain?archived=all"), http.StatusOK)); len(got) != 2 {
+		t.Fatalf("archived=all = %v", got)
+	}
+
+	expectError(t, ts.do(request{method: http.MethodPut, path: "/brain/99/favorite"}), http.StatusNotFound, "not_found")
+}
+
+func TestBrainListFilters(t *testing.T) {
+	ts := newTestServer(t)
+	ts.brain(brain{Title: "A", Project: "alpha", Tags: "perf,db"})
+	ts.brain(brain{Title: "B", Project: "alpha", Tags: "ui"})
+	ts.brain(brain{Title: "C", Project: "beta", Tags: "perf"})
+
+	tests := []struct {
+		query string
+		want  []int64
+	}{
+		{"", []int64{1, 2, 3}},
+		{"?project=alpha", []int64{1, 2}},
+		{"?tag=perf", []int64{1, 3}},
+		{"?tag=perf&project=beta", []int64{3}},
+		{"?tag=nothing", []int64{}},
+		{"?id=1&id=3", []int64{1, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			// Records created within the same second have no set order.
+			got := ids(decode[[]brain](t, ts.get("/brain"+tt.query), http.StatusOK))
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("ids = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	expectError(t, ts.get("/brain?pinned=maybe"), http.StatusBadRequest, "bad_request")
+}
+
+func TestOnThisDay(t *testing.T) {
+	ts := newTestServer(t, "SBRAIN_TZ=America/New_York")
+	t.Cleanup(func() { store.SetDisplayLocation(time.UTC) })
+	for _, createdAt := range []string{
+		"2024-05-12 15:00:00", // May 12, 11:00 EDT
+		"2024-03-13 03:00:00", // March 12, 23:00 EDT
+		"2024-01-13 04:30:00", // January 12, 23:30 EST
+		"2023-06-12 12:00:00", // a year ago
+		"2024-05-13 12:00:00", // another day
+		"2024-06-12 01:00:00", // June 11, 21:00 EDT
+		"2024-06-12 12:00:00", // the day itself
+	} {
+		b := ts.brain(brain{})
+		if _, err := ts.srv.db.Exec(`UPDATE second_brain SET created_at = ? WHERE id = ?`, createdAt, b.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	type onThisDay struct {
+		Groups []onThisDayGroup `json:"groups"`
+	}
+	for every, want := range map[string][]string{
+		"month": {"2024-05-12 [1] 1 month ago", "2024-03-12 [2] 3 months ago", "2024-01-12 [3] 5 months ago", "2023-06-12 [4] 1 year ago"},
+		"year":  {"2023-06-12 [4] 1 year ago"},
+	} {
+		var got []string
+		for _, g := range decode[onThisDay](t, ts.get("/brain/onthisday?date=2024-06-12&every="+every), http.StatusOK).Groups {
+			got = append(got, fmt.Sprintf("%s %v %s", g.Date, ids(g.Entries), g.Label))
+		}
+		if !slices.Equal(got, want) {
+			t.Fatalf("every=%s: groups = %q, want %q", every, got, want)
+		}
+	}
+}
+
+func TestBrainListNDJSON(t *testing.T) {
+	ts := newTestServer(t)
+	ts.brain(brain{Title: "A"})
+	ts.brain(brain{Title: "B"})
+
+	rec := ts.do(request{method: http.MethodGet, path: "/brain", header: map[string]string{"Accept": "application/x-ndjson"}})
+	expect(t, rec, http.StatusOK)
+	if ct := rec.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	var titles []string
+	sc := bufio.NewScanner(rec.Body)
+	for sc.Scan() {
+		var b brain
+		if err := json.Unmarshal(sc.Bytes(), &b); err != nil {
+			t.Fatalf("line %q: %v", sc.Text(), err)
+		}
+		titles = append(titles, b.Title)
+	}
+	slices.Sort(titles)
+	if !slices.Equal(titles, []string{"A", "B"}) {
+		t.Fatalf("titles = %v", titles)
+	}
+}
+
+func TestBrainTemplates(t *testing.T) {
+	ts := newTestServer(t)
+	expect(t, ts.post("/templates", map[string]any{"name": "retro", "title": "Retro", "context": "## Went well\n", "project": "team", "tags": "retro"}), http.StatusCreated)
+	expectError(t, ts.post("/templates", map[string]any{"name": "retro", "title": "Again", "context": "c", "project": "team"}), http.StatusConflict, "conflict")
+
+	created := decode[brain](t, ts.post("/brain?template=retro", map[string]any{}), http.StatusCreated)
+	if created.Title != "Retro" || created.Project != "team" || created.Tags != "retro" {
+		t.Fatalf("created from template = %+v", created)
+	}
+	expectError(t, ts.post("/brain?template=nope", map[string]any{}), http.StatusBadRequest, "bad_request")
+	expectError(t, ts.get("/templates/nope"), http.StatusNotFound, "not_found")
+}
+
+func TestBrainShares(t *testing.T) {
+	ts := newTestServer(t)
+	ts.brain(brain{Title: "Shared plan", Context: "The **plan**"})
+
+	share := decode[struct {
+		ID  int64  `json:"id"`
+		URL string `json:"url"`
+	}](t, ts.post("/brain/1/share", map[string]any{}), http.StatusCreated)
+	path := share.URL[strings.Index(share.URL, "/s/"):]
+
+	page := ts.do(request{method: http.MethodGet, path: path, key: "-"})
+	expect(t, page, http.StatusOK)
+	if !strings.Contains(page.Body.String(), "Shared plan") {
+		t.Fatalf("shared page does not show the record: %.300s", page.Body)
+	}
+
+	expect(t, ts.do(request{method: http.MethodDelete, path: "/shares/1"}), http.StatusNoContent)
+	expect(t, ts.do(request{method: http.MethodGet, path: path, key: "-"}), http.StatusNotFound)
+	expectError(t, ts.post("/brain/99/share", map[string]any{}), http.StatusNotFound, "not_found")
+}
+
+func TestBrainSend(t *testing.T) {
+	expectError(t, newTestServer(t).post("/brain/1/send", nil), http.StatusServiceUnavailable, "unavailable")
+
+	addr, messages := fakeSMTP(t)
+	ts := newTestServer(t, "SBRAIN_SMTP_ADDR="+addr, "SBRAIN_SEND_TO=me@example.com, kindle@example.com")
+	ts.brain(brain{Title: "Résumé notes", Project: "jobs", Context: "Line one\nLine two"})
+
+	expectFields(t, ts.post("/brain/1/send", map[string]any{"to": "someone@else.com"}), "to")
+	expectError(t, ts.post("/brain/99/send", nil), http.StatusNotFound, "not_found")
+
+	sent := decode[map[string]string](t, ts.post("/brain/1/send", nil), http.StatusOK)
+	if sent["sent_to"] != "me@example.com" {
+		t.Fatalf("sent = %v", sent)
+	}
+	msg := <-messages
+	for _, want := range []string{"To: me@example.com", "Subject: =?utf-8?q?sbrain:_R=C3=A9sum=C3=A9_notes?=", `title: "Résumé notes"`, "Line two", "/brain/1"} {
+		if !strings.Contains(msg, want) {
+			t.Fatalf("message lacks %q:\n%s", want, msg)
+		}
+	}
+
+	expect(t, ts.post("/brain/1/send", map[string]any{"to": "Kindle@example.com", "note": "for the train"}), http.StatusOK)
+	if msg := <-messages; !strings.Contains(msg, "To: kindle@example.com") || !strings.Contains(msg, "for the train") {
+		t.Fatalf("second message:\n%s", msg)
+	}
+}
+
+func TestGitDaily(t *testing.T) {
+	expectError(t, newTestServer(t).post("/integrations/git/daily", nil), http.StatusServiceUnavailable, "unavailable")
+
+	var gotAuth, gotSince string
+	github := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/acme/api/commits" {
+			http.NotFound(w, r)
+			return
+		}
+		gotAuth, gotSince = r.Header.Get("Authorization"), r.URL.Query().Get("since")
+		w.Write([]byte(`[{"sha":"c0ffee1234","html_url":"https://github.com/acme/api/commit/c0ffee1234",
+			"commit":{"message":"Add rate limits\n\nDetails","author":{"name":"Ada","date":"2024-06-03T15:00:00Z"}}}]`))
+	}))
+	defer github.Close()
+	ts := newTestServer(t, "SBRAIN_GIT_REPOS=github:acme/api, github:acme/web=site", "SBRAIN_GITHUB_API_URL="+github.URL, "SBRAIN_GITHUB_TOKEN=gh-token")
+
+	expectFields(t, ts.post("/integrations/git/daily", map[string]any{"commits": []map[string]any{{"sha": "abc"}}}),
+		"project", "commits[0].message")
+
+	push := map[string]any{"project": "api", "date": "2024-06-03", "commits": []map[string]any{
+		{"sha": "1111111aaa", "repo": "acme/api", "author": "Grace", "message": "Fix login redirect", "timestamp": "2024-06-03T09:00:00Z"},
+	}}
+	type result struct {
+		Date    string `json:"date"`
+		Records []struct {
+			BrainID int64 `json:"brain_id"`
+			Created bool  `json:"created"`
+			Commits int   `json:"commits"`
+			Added   int   `json:"added"`
+		} `json:"records"`
+		Failed []struct {
+			Repo string `json:"repo"`
+		} `json:"failed"`
+	}
+	res := decode[result](t, ts.post("/integrations/git/daily", push), http.StatusOK)
+	if res.Date != "2024-06-03" || len(res.Records) != 1 || !res.Records[0].Created || res.Records[0].Added != 1 {
+		t.Fatalf("push = %+v", res)
+	}
+	id := res.Records[0].BrainID
+
+	// Pulling the same day adds GitHub's commit to the same record; the
+	// second repository fails and is reported.
+	res = decode[result](t, ts.post("/integrations/git/daily", map[string]any{"date": "2024-06-03"}), http.StatusOK)
+	if len(res.Records) != 1 || res.Records[0].BrainID != id || res.Records[0].Created || res.Records[0].Commits != 2 ||
+		len(res.Failed) != 1 || res.Failed[0].Repo != "github:acme/web" {
+		t.Fatalf("pull = %+v", res)
+	}
+	if gotAuth != "Bearer gh-token" || gotSince != "2024-06-03T00:00:00Z" {
+		t.Fatalf("GitHub request: auth %q, since %q", gotAuth, gotSince)
+	}
+	res = decode[result](t, ts.post("/integrations/git/daily", push), http.StatusOK)
+	if res.Records[0].Added != 0 || res.Records[0].Commits != 2 {
+		t.Fatalf("repeated push = %+v", res)
+	}
+
+	b := decode[brain](t, ts.get("/brain/"+strconv.FormatInt(id, 10)), http.StatusOK)
+	if b.Title != "api: work on 2024-06-03" || b.Tags != "git,daily" || b.Summary != "2 commits by Grace and Ada in acme/api." {
+		t.Fatalf("record = %+v", b)
+	}
+	if !strings.Contains(b.Context, "- Fix login redirect (`1111111`, Grace)\n- Add rate limits ([c0ffee1](https://github.com/acme/api/commit/c0ffee1234), Ada)") {
+		t.Fatalf("context:\n%s", b.Context)
+	}
+	var commits []gitCommit
+	if err := json.Unmarshal([]byte(b.Commits), &commits); err != nil || len(commits) != 2 || commits[1].Message != "Add rate limits\n\nDetails" {
+		t.Fatalf("commits = %s (%v)", b.Commits, err)
+	}
+	expectError(t, ts.post("/integrations/git/daily", map[string]any{"repo": "acme/none"}), http.StatusNotFound, "not_found")
+}
+
+func TestGitWebhooks(t *testing.T) {
+	ts := newTestServer(t, "SBRAIN_GITHUB_WEBHOOK_SECRET=gh-secret", "SBRAIN_GITLAB_WEBHOOK_TOKEN=gl-token",
+		"SBRAIN_GITEA_WEBHOOK_SECRET=tea-secret", "SBRAIN_GIT_REPOS=gitlab:group/app=web")
+	sign := func(secret, body string) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(body))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+	deliver := func(provider string, header map[string]string, body string) *httptest.ResponseRecorder {
+		return ts.do(request{method: http.MethodPost, path: "/integrations/git/webhook/" + provider, body: body, key: "-", header: header})
+	}
+	type result struct {
+		Event   string `json:"event"`
+		Ignored bool   `json:"ignored"`
+		Records []struct {
+			Project string `json:"project"`
+			BrainID int64  `json:"brain_id"`
+			Commits int    `json:"commits"`
+		} `json:"records"`
+	}
+
+	push := `{"ref":"refs/heads/main","repository":{"full_name":"acme/api"},"pusher":{"name":"ada"},"commits":[
+		{"id":"aaaa111","message":"Add cache","timestamp":"2024-06-03T10:00:00Z","url":"https://github.com/acme/api/commit/aaaa111","author":{"name":"Ada"}},
+		{"id":"bbbb222","message":"Tune cache","timestamp":"2024-06-04T10:00:00Z","author":{"name":"Ada"}}]}`
+	expectError(t, deliver("github", map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": "sha256=" + sign("wrong", push)}, push),
+		http.StatusUnauthorized, "unauthorized")
+	res := decode[result](t, deliver("github", map[string]string{"X-GitHub-Event": "push", "X-Hub-Signature-256": "sha256=" + sign("gh-secret", push)}, push), http.StatusOK)
+	if len(res.Records) != 2 || res.Records[0].Project != "api" || res.Records[0].Commits != 1 {
+		t.Fatalf("github push = %+v", res)
+	}
+	ping := `{"zen":"Keep it logically awesome."}`
+	if res := decode[result](t, deliver("github", map[string]string{"X-GitHub-Event": "ping", "X-Hub-Signature-256": "sha256=" + sign("gh-secret", ping)}, ping), http.StatusOK); !res.Ignored {
+		t.Fatalf("ping = %+v", res)
+	}
+
+	gitlab := `{"object_kind":"push","ref":"refs/heads/main","user_username":"grace","project":{"path_with_namespace":"group/app"},
+		"commits":[{"id":"cccc333","message":"Fix build\n","timestamp":"2024-06-03T12:00:00+02:00","author":{"name":"Grace"}}]}`
+	expectError(t, deliver("gitlab", map[string]string{"X-Gitlab-Event": "Push Hook", "X-Gitlab-Token": "nope"}, gitlab), http.StatusUnauthorized, "unauthorized")
+	res = decode[result](t, deliver("gitlab", map[string]string{"X-Gitlab-Event": "Push Hook", "X-Gitlab-Token": "gl-token"}, gitlab), http.StatusOK)
+	if len(res.Records) != 1 || res.Records[0].Project != "web" {
+		t.Fatalf("gitlab push = %+v", res)
+	}
+
+	opened := `{"action":"opened","pull_request":{"number":7,"title":"Cache","merged":false},"repository":{"full_name":"acme/api"}}`
+	if res := decode[result](t, deliver("gitea", map[string]string{"X-Gitea-Event": "pull_request", "X-Gitea-Signature": sign("tea-secret", opened)}, opened), http.StatusOK); !res.Ignored {
+		t.Fatalf("opened pull request = %+v", res)
+	}
+	merged := `{"action":"closed","pull_request":{"number":7,"title":"Cache","html_url":"https://git.example.com/acme/api/pulls/7",
+		"merged":true,"merge_commit_sha":"dddd444","merged_at":"2024-06-03T16:00:00Z","user":{"login":"ada"}},"repository":{"full_name":"acme/api"}}`
+	res = decode[result](t, deliver("gitea", map[string]string{"X-Gitea-Event": "pull_request", "X-Gitea-Signature": sign("tea-secret", merged)}, merged), http.StatusOK)
+	if len(res.Records) != 1 || res.Records[0].Commits != 2 {
+		t.Fatalf("merged pull request = %+v", res)
+	}
+	b := decode[brain](t, ts.get("/brain/"+strconv.FormatInt(res.Records[0].BrainID, 10)), http.StatusOK)
+	if b.Title != "api: work on 2024-06-03" || !strings.Contains(b.Context, "- Merged #7: Cache ([dddd444](https://git.example.com/acme/api/pulls/7), ada)") {
+		t.Fatalf("record = %+v", b)
+	}
+	expectError(t, deliver("bitbucket", nil, push), http.StatusNotFound, "not_found")
+}
+
+func TestCIBuilds(t *testing.T) {
+	ts := newTestServer(t)
+	expectFields(t, ts.post("/integrations/ci", map[string]any{"status": "exploded", "url": "ftp://ci"}), "pipeline", "status", "url")
+
+	type result struct {
+		LogID int64 `json:"log_id"`
+		Brain *struct {
+			BrainID int64 `json:"brain_id"`
+			Created bool  `json:"created"`
+		} `json:"brain"`
+	}
+	passed := decode[result](t, ts.post("/integrations/ci", map[string]any{"pipeline": "test", "status": "passed", "project": "api"}), http.StatusCreated)
+	if passed.Brain != nil {
+		t.Fatalf("a passing build was journaled: %+v", passed)
+	}
+	failed := decode[result](t, ts.post("/integrations/ci", map[string]any{"pipeline": "deploy", "status": "FAILURE", "project": "api",
+		"branch": "main", "commit": "abcdef123456", "duration_seconds": 192.4, "url": "https://ci.example.com/42", "finished_at": "2024-06-03T18:00:00Z"}), http.StatusCreated)
+	if failed.Brain == nil || !failed.Brain.Created {
+		t.Fatalf("failed build = %+v", failed)
+	}
+	l := decode[logEntry](t, ts.get("/logs/"+strconv.FormatInt(failed.LogID, 10)), http.StatusOK)
+	if l.Level != "error" || l.Message != "CI deploy failed on main after 3m12s" || l.Project != "api" || !strings.Contains(l.Metadata, `"commit":"abcdef123456"`) {
+		t.Fatalf("log = %+v", l)
+	}
+
+	// Commits for the same day join the builds on one record.
+	res := decode[struct {
+		Records []struct {
+			BrainID int64 `json:"brain_id"`
+		} `json:"records"`
+	}](t, ts.post("/integrations/git/daily", map[string]any{"project": "api", "date": "2024-06-03",
+		"commits": []map[string]any{{"sha": "abcdef123456", "author": "Ada", "message": "Deploy cache"}}}), http.StatusOK)
+	if len(res.Records) != 1 || res.Records[0].BrainID != failed.Brain.BrainID {
+		t.Fatalf("commits went to %+v, not record %d", res, failed.Brain.BrainID)
+	}
+	b := decode[brain](t, ts.get("/brain/"+strconv.FormatInt(failed.Brain.BrainID, 10)), http.StatusOK)
+	if b.Summary != "1 commit by Ada. 1 build, 1 failed." ||
+		!strings.Contains(b.Context, "## Builds\n\n- deploy **failed** on `main` at `abcdef1` after 3m12s ([details](https://ci.example.com/42))") {
+		t.Fatalf("record = %+v", b)
+	}
+}
+
+func TestBrainLogLinks(t *testing.T) {
+	ts := newTestServer(t)
+	ts.brain(brain{})
+	ts.log(logEntry{Message: "first"})
+	ts.log(logEntry{Message: "second"})
+
+	expect(t, ts.post("/brain/1/logs", map[string]any{"log_ids": []int64{1, 2}}), http.StatusOK)
+	linked := decode[[]logEntry](t, ts.get("/brain/1/logs"), http.StatusOK)
+	if len(linked) != 2 {
+		t.Fatalf("linked = %+v", linked)
+	}
+	expect(t, ts.do(request{method: http.MethodDelete, path: "/brain/1/logs/1"}), http.StatusNoContent)
+	expectError(t, ts.do(request{method: http.MethodDelete, path: "/brain/1/logs/1"}), http.StatusNotFound, "not_found")
+	if got := decode[[]logEntry](t, ts.get("/brain/1/logs"), http.StatusOK); len(got) != 1 || got[0].ID != 2 {
+		t.Fatalf("after unlinking = %+v", got)
+	}
+	expectFields(t, ts.post("/brain/1/logs", map[string]any{}), "log_ids")
+}
+
+func TestSearch(t *testing.T) {
+	ts := newTestServer(t)
+	ts.brain(brain{Title: "Retry idea", Context: "exponential backoff"})
+	ts.brain(brain{Title: "Lunch", Context: "tacos"})
+	ts.log(logEntry{Level: "error", Message: "backoff exhausted"})
+
+	results := decode[[]struct {
+		Type string `json:"type"`
+		ID   int64  `json:"id"`
+	}](t, ts.get("/search?q=backoff"), http.StatusOK)
+	var got []string
+	for _, r := range results {
+		got = append(got, r.Type)
+	}
+	slices.Sort(got)
+	if !slices.Equal(got, []string{"brain", "log"}) {
+		t.Fatalf("result types = %v", got)
+	}
+	expectError(t, ts.get("/search"), http.StatusBadRequest, "bad_request")
+}
+
+func TestEmailIngest(t *testing.T) {
+	ts := newTestServer(t, "SBRAIN_EMAIL_INBOUND_TOKEN=inbound")
+	email := map[string]any{
+		"From": "ada@example.com", "Subject": "Receipt", "TextBody": "See attached.",
+		"Attachments": []map[string]any{{"Name": "receipt.txt", "Content": "cGFpZA==", "ContentType": "text/plain"}},
+	}
+	created := decode[struct {
+		Brain       brain        `json:"brain"`
+		Attachments []attachment `json:"attachments"`
+	}](t, ts.post("/integrations/email/postmark?token=inbound", email), http.StatusCreated)
+	if created.Brain.Title != "Receipt" || len(created.Attachments) != 1 || created.Attachments[0].BrainID != created.Brain.ID {
+		t.Fatalf("created = %+v", created)
+	}
+
+	// A failed attachment leaves no brain behind for the retry to duplicate.
+	if _, err := ts.srv.db.Exec(`CREATE TRIGGER fail_attachments BEFORE INSERT ON attachments BEGIN SELECT RAISE(ABORT, 'disk full'); END`); err != nil {
+		t.Fatal(err)
+	}
+	expectError(t, ts.post("/integrations/email/postmark?token=inbound", email), http.StatusInternalServerError, "internal")
+	if got := decode[[]brain](t, ts.get("/brain"), http.StatusOK); len(got) != 1 {
+		t.Fatalf("brains = %d, want 1", len(got))
+	}
+}
+
+func TestDigestDestinations(t *testing.T) {
+	ts := newTestServer(t)
+	created := decode[digestDestination](t, ts.post("/admin/digests/destinations", map[string]any{
+		"kind": "slack", "target": "https://hooks.slack.example/x", "send_at": "9:00",
+	}), http.StatusCreated)
+	if created.SendAt != "09:00" {
+		t.Fatalf("send_at = %q, want 09:00", created.SendAt)
+	}
+	expectError(t, ts.post("/admin/digests/destinations", map[string]any{
+		"kind": "slack", "target": "https://hooks.slack.example/x", "send_at": "25:00",
+	}), http.StatusBadRequest, "bad_request")
+}
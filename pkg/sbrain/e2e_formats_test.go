@@ -0,0 +1,389 @@
+package sbrain
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestDecodeYAML(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		json string
+	}{
+		{"mapping", "title: Retry idea\ncount: 3\nratio: 0.5\nok: true\nnone: ~\n", `{"count":3,"none":null,"ok":true,"ratio":0.5,"title":"Retry idea"}`},
+		{"comments and document markers", "---\n# a brain\ntitle: t # trailing\nurl: http://x/#frag\n...\n", `{"title":"t","url":"http://x/#frag"}`},
+		{"quoted", `a: "line\none \"q\" \u00e9"` + "\nb: 'it''s # not a comment'\n\"c d\": x\n", `{"a":"line\none \"q\" é","b":"it's # not a comment","c d":"x"}`},
+		{"sequences", "tags:\n  - a\n  - b\nflat:\n- 1\n- 2\nnested:\n  - - x\n    - y\n", `{"flat":[1,2],"nested":[["x","y"]],"tags":["a","b"]}`},
+		{"sequence of mappings", "items:\n  - id: 1\n    name: a\n  - id: 2\n    name: b\n", `{"items":[{"id":1,"name":"a"},{"id":2,"name":"b"}]}`},
+		{"flow", "tags: [a, \"b, c\", 3]\nmeta: {k: v, n: null}\nempty: []\n", `{"empty":[],"meta":{"k":"v","n":null},"tags":["a","b, c",3]}`},
+		{"literal block", "context: |\n  line one\n    indented\n\n  after blank\ntitle: t\n", `{"context":"line one\n  indented\n\nafter blank\n","title":"t"}`},
+		{"folded block", "context: >-\n  one\n  two\n\n  three\n", `{"context":"one two\nthree"}`},
+		{"plain multi-line", "context: one\n  two\n  three\ntitle: t\n", `{"context":"one two three","title":"t"}`},
+		{"core schema", "a: yes\nb: 0x1F\nc: 1e3\nd: 007\ne: \"true\"\nf: -12\n", `{"a":"yes","b":31,"c":1000,"d":7,"e":"true","f":-12}`},
+		{"top-level sequence", "- 1\n- two\n", `[1,"two"]`},
+		{"empty", "# nothing\n", `null`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := decodeYAML([]byte(tt.yaml))
+			if err != nil {
+				t.Fatalf("decodeYAML: %v", err)
+			}
+			got, _ := json.Marshal(v)
+			if string(got) != tt.json {
+				t.Fatalf("got  %s\nwant %s", got, tt.json)
+			}
+		})
+	}
+
+	for name, bad := range map[string]string{
+		"tab indent":     "a:\n\tb: 1\n",
+		"duplicate key":  "a: 1\na: 2\n",
+		"anchor":         "a: &x 1\n",
+		"two documents":  "a: 1\n---\nb: 2\n",
+		"bad indent":     "a: 1\n    b: 2\nc:\n  - x\n   - y\n",
+		"unterminated":   "a: \"open\n",
+		"infinity":       "a: .inf\n",
+		"unclosed flow":  "a: [1, 2\n",
+		"complex key":    "? a\n",
+		"text after ---": "--- a\n",
+	} {
+		if v, err := decodeYAML([]byte(bad)); err == nil {
+			t.Errorf("%s: decoded to %v, want an error", name, v)
+		}
+	}
+}
+
+func TestMsgpackRoundTrip(t *testing.T) {
+	doc := `{"a":[1,-1,-33,200,70000,-70000,5000000000,1.5,true,false,null],"b":"` + strings.Repeat("x", 300) + `","c":{},"d":{"e":"é"}}`
+	encoded, err := translateJSON([]byte(doc), msgpackContentType)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	decoded, err := decodeMsgpack(encoded)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if got, _ := json.Marshal(decoded); string(got) != doc {
+		t.Fatalf("round trip = %s", got)
+	}
+
+	for name, bad := range map[string][]byte{
+		"truncated":      encoded[:len(encoded)-1],
+		"trailing bytes": append(append([]byte{}, encoded...), 0xc0),
+		"extension":      {0xd4, 0x01, 0x00},
+		"int key":        {0x81, 0x01, 0x01},
+		"huge array":     {0xdd, 0xff, 0xff, 0xff, 0xff},
+		"bad utf-8":      {0xa1, 0xff},
+		"NaN":            {0xcb, 0x7f, 0xf8, 0, 0, 0, 0, 0, 1},
+	} {
+		if v, err := decodeMsgpack(bad); err == nil {
+			t.Errorf("%s: decoded to %v, want an error", name, v)
+		}
+	}
+}
+
+func TestYAMLBodies(t *testing.T) {
+	ts := newTestServer(t)
+
+	rec := ts.do(request{method: http.MethodPost, path: "/brain", body: "title: From YAML\nproject: sbrain\ntags: ideas\ncontext: |\n  Two\n  lines\n",
+		header: map[string]string{"Content-Type": "application/yaml", "Accept": "application/yaml"}})
+	expect(t, rec, http.StatusCreated)
+	if ct := rec.Header().Get("Content-Type"); ct != yamlContentType {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	if body := rec.Body.String(); !strings.Contains(body, `title: "From YAML"`) || !strings.Contains(body, `context: "Two\nlines\n"`) {
+		t.Fatalf("body = %s", body)
+	}
+
+	// The YAML the API writes reads back as the same document.
+	doc, err := decodeYAML(rec.Body.Bytes())
+	if err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if m, _ := doc.(map[string]any); m["id"] != json.Number("1") || m["tags"] != "ideas" {
+		t.Fatalf("response = %v", doc)
+	}
+
+	apiErr := expectError(t, ts.do(request{method: http.MethodPost, path: "/brain", body: "title: [unclosed\n",
+		header: map[string]string{"Content-Type": "application/yaml"}}), http.StatusBadRequest, "bad_request")
+	if !strings.Contains(apiErr.Message, "line 1") {
+		t.Fatalf("message = %q", apiErr.Message)
+	}
+
+	// JSON stays the default, and wins ties.
+	for _, accept := range []string{"", "*/*", "application/json, application/yaml", "application/yaml;q=0.5, application/json"} {
+		rec := ts.do(request{method: http.MethodGet, path: "/brain/1", header: map[string]string{"Accept": accept}})
+		if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+			t.Fatalf("Accept %q: Content-Type = %q", accept, ct)
+		}
+	}
+}
+
+func TestMsgpackBodies(t *testing.T) {
+	ts := newTestServer(t)
+	body, err := translateJSON([]byte(`{"message":"from msgpack","level":"warn","status_code":503}`), msgpackContentType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := ts.do(request{method: http.MethodPost, path: "/logs", body: body,
+		header: map[string]string{"Content-Type": "application/x-msgpack", "Accept": "application/msgpack"}})
+	expect(t, rec, http.StatusCreated)
+	if ct := rec.Header().Get("Content-Type"); ct != msgpackContentType {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	created, err := decodeMsgpack(rec.Body.Bytes())
+	if err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if m, _ := created.(map[string]any); m["message"] != "from msgpack" || m["status_code"] != json.Number("503") {
+		t.Fatalf("created = %v", created)
+	}
+
+	// Errors are translated too, and non-JSON responses are left alone.
+	rec = ts.do(request{method: http.MethodGet, path: "/logs/99", header: map[string]string{"Accept": "application/msgpack"}})
+	if rec.Code != http.StatusNotFound || rec.Header().Get("Content-Type") != msgpackContentType {
+		t.Fatalf("status %d, Content-Type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	if rec := ts.do(request{method: http.MethodGet, path: "/logs/export", header: map[string]string{"Accept": "application/msgpack"}}); !strings.HasPrefix(rec.Body.String(), "id,") {
+		t.Fatalf("CSV was translated: %q", rec.Body)
+	}
+	expectError(t, ts.do(request{method: http.MethodPost, path: "/logs", body: []byte{0x81, 0xa1},
+		header: map[string]string{"Content-Type": "application/msgpack"}}), http.StatusBadRequest, "bad_request")
+}
+
+func TestFormBodies(t *testing.T) {
+	ts := newTestServer(t)
+
+	form := url.Values{"title": {"From a form"}, "context": {"line one\r\nline two"}, "project": {"sbrain"}, "pinned": {"on"}, "ignored": {"x"}}
+	created := decode[brain](t, ts.do(request{method: http.MethodPost, path: "/brain", body: form.Encode(),
+		header: map[string]string{"Content-Type": "application/x-www-form-urlencoded"}}), http.StatusCreated)
+	if created.Title != "From a form" || created.Context != "line one\nline two" || !created.Pinned {
+		t.Fatalf("created = %+v", created)
+	}
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	mw.WriteField("message", "from curl -F")
+	mw.WriteField("status_code", "502")
+	mw.WriteField("brain_id", "1")
+	file, _ := mw.CreateFormFile("metadata", "meta.json")
+	file.Write([]byte(`{"retry":true}`))
+	mw.Close()
+	l := decode[logEntry](t, ts.do(request{method: http.MethodPost, path: "/logs", body: buf.Bytes(),
+		header: map[string]string{"Content-Type": mw.FormDataContentType()}}), http.StatusCreated)
+	if l.Message != "from curl -F" || l.StatusCode == nil || *l.StatusCode != 502 || l.BrainID == nil || l.Metadata != `{"retry":true}` {
+		t.Fatalf("created = %+v", l)
+	}
+
+	apiErr := expectError(t, ts.do(request{method: http.MethodPost, path: "/logs", body: "message=m&status_code=abc",
+		header: map[string]string{"Content-Type": "application/x-www-form-urlencoded"}}), http.StatusBadRequest, "bad_request")
+	if !strings.Contains(apiErr.Message, "status_code") {
+		t.Fatalf("message = %q", apiErr.Message)
+	}
+	// Validation is the same as for JSON.
+	expectFields(t, ts.do(request{method: http.MethodPost, path: "/brain", body: "title=t",
+		header: map[string]string{"Content-Type": "application/x-www-form-urlencoded"}}), "context", "project")
+
+	// curl -d '{...}' labels JSON as a form.
+	fromCurl := decode[brain](t, ts.do(request{method: http.MethodPost, path: "/brain", body: ` {"title": "From curl -d", "context": "c", "project": "sbrain"}`,
+		header: map[string]string{"Content-Type": "application/x-www-form-urlencoded"}}), http.StatusCreated)
+	if fromCurl.Title != "From curl -d" || fromCurl.Project != "sbrain" {
+		t.Fatalf("created = %+v", fromCurl)
+	}
+}
+
+func TestBrainPDF(t *testing.T) {
+	ts := newTestServer(t)
+	long := strings.Repeat("A paragraph long enough to wrap across the width of the page several times over. ", 12)
+	ts.brain(brain{Title: "Release plan", Project: "launch", Tags: "release", CreatedAt: "2024-06-01 09:00:00",
+		Context: "# Steps\n\n- Ship it (soon)\n- Tell [the team](https://chat.example.com)\n\n```\ngo build ./...\n```\n\n" +
+			strings.Repeat(long+"\n\n", 12)})
+	ts.brain(brain{Title: "Retro", Project: "launch", Context: "Went **well**: café ☕", CreatedAt: "2024-06-20 09:00:00"})
+	ts.brain(brain{Title: "Elsewhere", Project: "other", Context: "x"})
+
+	rec := ts.get("/brain/1/pdf")
+	expect(t, rec, http.StatusOK)
+	if ct := rec.Header().Get("Content-Type"); ct != "application/pdf" {
+		t.Fatalf("content type = %q", ct)
+	}
+	pages, text := readPDF(t, rec.Body.Bytes())
+	if pages < 2 {
+		t.Fatalf("long record fits %d page", pages)
+	}
+	for _, want := range []string{"(Release plan)", "(Steps)", "(\x95)", `(Ship it \(soon\))`, "(Tell the team \\(https://chat.example.com\\))", "(go build ./...)"} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("page text lacks %q", want)
+		}
+	}
+
+	rec = ts.get("/export/pdf?project=launch")
+	expect(t, rec, http.StatusOK)
+	pages, text = readPDF(t, rec.Body.Bytes())
+	if first, second := strings.Index(text, "(Release plan)"), strings.Index(text, "(Retro)"); pages < 3 || first < 0 || second < first {
+		t.Fatalf("export has %d pages, titles at %d and %d", pages, first, second)
+	}
+	if !strings.Contains(text, "(Went well: caf\xe9 ?)") || strings.Contains(text, "(Elsewhere)") {
+		t.Fatalf("export text is wrong")
+	}
+	expectError(t, ts.get("/export/pdf?project=none"), http.StatusNotFound, "not_found")
+	expectError(t, ts.get("/brain/99/pdf"), http.StatusNotFound, "not_found")
+}
+
+func TestSiteExport(t *testing.T) {
+	ts := newTestServer(t)
+	ts.brain(brain{Title: "Release <plan>", Project: "Launch Q3", Tags: "release,ops", Context: "Ship <b>it</b>", CreatedAt: "2024-06-01 09:00:00"})
+	ts.brain(brain{Title: "Retro", Project: "Launch Q3", Tags: "ops", Context: "Went well", CreatedAt: "2024-06-20 09:00:00"})
+	ts.brain(brain{Title: "Elsewhere", Project: "other", Context: "x"})
+
+	rec := ts.get("/export/site?project=Launch+Q3")
+	expect(t, rec, http.StatusOK)
+	if ct := rec.Header().Get("Content-Type"); ct != "application/zip" {
+		t.Fatalf("content type = %q", ct)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	for _, f := range zr.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(r)
+		r.Close()
+		files[f.Name] = string(body)
+	}
+	for _, name := range []string{"index.html", "records/1.html", "records/2.html", "projects/launch-q3.html", "tags/ops.html", "tags/release.html", "search-index.js", "search.js", "favicon.svg"} {
+		if _, ok := files[name]; !ok {
+			t.Fatalf("site lacks %s", name)
+		}
+	}
+	if _, ok := files["records/3.html"]; ok {
+		t.Fatal("site has a record outside the filter")
+	}
+
+	index := files["index.html"]
+	if !strings.Contains(index, `href="projects/launch-q3.html"`) || !strings.Contains(index, "Release &lt;plan&gt;") {
+		t.Fatalf("index.html is wrong:\n%s", index)
+	}
+	if strings.Index(index, ">Retro<") > strings.Index(index, "Release &lt;plan&gt;") {
+		t.Fatal("index does not list the newest record first")
+	}
+	page := files["records/1.html"]
+	for _, want := range []string{"Ship &lt;b&gt;it&lt;/b&gt;", `href="../projects/launch-q3.html"`, `href="../tags/release.html"`, `src="../search-index.js"`} {
+		if !strings.Contains(page, want) {
+			t.Fatalf("records/1.html lacks %q:\n%s", want, page)
+		}
+	}
+	if tagged := files["tags/ops.html"]; !strings.Contains(tagged, "Retro") || !strings.Contains(tagged, `href="../records/1.html"`) {
+		t.Fatalf("tags/ops.html is wrong:\n%s", tagged)
+	}
+
+	var entries []siteSearchEntry
+	js := strings.TrimSuffix(strings.TrimPrefix(files["search-index.js"], "window.sbrainSearchIndex = "), ";\n")
+	if err := json.Unmarshal([]byte(js), &entries); err != nil || len(entries) != 2 || entries[1].URL != "records/1.html" || len(entries[1].Tags) != 2 {
+		t.Fatalf("search index = %+v (%v)", entries, err)
+	}
+
+	dir := t.TempDir()
+	n, err := ts.srv.ExportSite(t.Context(), brainFilter{}, dir)
+	if err != nil || n != 3 {
+		t.Fatalf("ExportSite = %d, %v", n, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "projects", "other.html")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSiteExportReadOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sbrain.db")
+	srv, err := New(Options{DBPath: path, Migrate: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := srv.brains.CreateBrain(t.Context(), brain{Title: "Kept", Context: "c", Project: "p"}); err != nil {
+		t.Fatal(err)
+	}
+	srv.Close()
+	before, _ := os.ReadFile(path)
+
+	ro, err := New(Options{DBPath: path, ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ro.Close()
+	if n, err := ro.ExportSite(t.Context(), brainFilter{}, t.TempDir()); err != nil || n != 1 {
+		t.Fatalf("ExportSite = %d, %v", n, err)
+	}
+	if _, err := ro.brains.CreateBrain(t.Context(), brain{Title: "t", Context: "c", Project: "p"}); err == nil {
+		t.Fatal("a read-only database took a write")
+	}
+	if after, _ := os.ReadFile(path); !bytes.Equal(before, after) {
+		t.Fatal("the database file changed")
+	}
+	if _, err := New(Options{DBPath: filepath.Join(t.TempDir(), "missing.db"), ReadOnly: true}); err == nil {
+		t.Fatal("a missing read-only database was created")
+	}
+}
+
+// readPDF checks that doc's cross-reference table points at its objects and
+// returns its page count and the decompressed text of its content streams.
+func readPDF(t *testing.T, doc []byte) (pages int, text string) {
+	t.Helper()
+	if !bytes.HasPrefix(doc, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(doc, []byte("%%EOF\n")) {
+		t.Fatalf("not a PDF: %.40q", doc)
+	}
+	tail := doc[bytes.LastIndex(doc, []byte("startxref\n"))+len("startxref\n"):]
+	xref, _ := strconv.Atoi(string(tail[:bytes.IndexByte(tail, '\n')]))
+	if !bytes.HasPrefix(doc[xref:], []byte("xref\n")) {
+		t.Fatalf("startxref %d does not point at the xref table", xref)
+	}
+	lines := strings.Split(string(doc[xref:]), "\n")
+	for i, line := range lines[3:] {
+		if !strings.HasSuffix(line, " n ") {
+			break
+		}
+		offset, _ := strconv.Atoi(line[:10])
+		if want := fmt.Sprintf("%d 0 obj\n", i+1); !bytes.HasPrefix(doc[offset:], []byte(want)) {
+			t.Fatalf("xref entry %d points at %.20q", i+1, doc[offset:])
+		}
+	}
+
+	var out strings.Builder
+	rest := doc
+	for {
+		start := bytes.Index(rest, []byte("stream\n"))
+		if start < 0 {
+			break
+		}
+		rest = rest[start+len("stream\n"):]
+		end := bytes.Index(rest, []byte("\nendstream"))
+		zr, err := zlib.NewReader(bytes.NewReader(rest[:end]))
+		if err != nil {
+			t.Fatalf("inflate content: %v", err)
+		}
+		content, _ := io.ReadAll(zr)
+		out.Write(content)
+		rest = rest[end+len("\nendstream"):]
+		pages++
+	}
+	if !bytes.Contains(doc, []byte(fmt.Sprintf("/Count %d", pages))) {
+		t.Fatalf("page tree does not count %d pages", pages)
+	}
+	return pages, out.String()
+}
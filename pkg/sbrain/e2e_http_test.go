@@ -0,0 +1,498 @@
+package sbrain
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMalformedBodies(t *testing.T) {
+	ts := newTestServer(t)
+	for name, body := range map[string]string{
+		"truncated":     `{"title": "t"`,
+		"not an object": `["t"]`,
+		"wrong type":    `{"title": 42, "context": "c"}`,
+		"empty":         ``,
+	} {
+		t.Run(name, func(t *testing.T) {
+			rec := ts.do(request{method: http.MethodPost, path: "/brain", body: body})
+			apiErr := expectError(t, rec, http.StatusBadRequest, "bad_request")
+			if !strings.HasPrefix(apiErr.Message, "decode body") {
+				t.Fatalf("message = %q", apiErr.Message)
+			}
+		})
+	}
+}
+
+func TestMuxErrors(t *testing.T) {
+	ts := newTestServer(t)
+
+	expectError(t, ts.get("/nope"), http.StatusNotFound, "not_found")
+
+	rec := ts.do(request{method: http.MethodPut, path: "/logs"})
+	expectError(t, rec, http.StatusMethodNotAllowed, "method_not_allowed")
+	if allow := rec.Header().Get("Allow"); !strings.Contains(allow, "POST") {
+		t.Fatalf("Allow = %q", allow)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	ts := newTestServer(t)
+	rec := ts.do(request{method: http.MethodOptions, path: "/brain/1"})
+	expect(t, rec, http.StatusNoContent)
+	if allow := rec.Header().Get("Allow"); allow != "GET, HEAD, PUT, DELETE, OPTIONS" {
+		t.Fatalf("Allow = %q", allow)
+	}
+}
+
+func TestHead(t *testing.T) {
+	ts := newTestServer(t)
+	ts.brain(brain{})
+
+	get := ts.get("/brain")
+	head := ts.do(request{method: http.MethodHead, path: "/brain"})
+	expect(t, head, http.StatusOK)
+	if head.Body.Len() != 0 {
+		t.Fatalf("HEAD sent a body: %s", head.Body)
+	}
+	if got, want := head.Header().Get("Content-Length"), strconv.Itoa(get.Body.Len()); got != want {
+		t.Fatalf("Content-Length = %q, want %q", got, want)
+	}
+	if head.Header().Get("Content-Type") != get.Header().Get("Content-Type") {
+		t.Fatalf("Content-Type = %q, want GET's %q", head.Header().Get("Content-Type"), get.Header().Get("Content-Type"))
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	ts := newTestServer(t)
+
+	rec := ts.do(request{method: http.MethodGet, path: "/brain/99", header: map[string]string{"X-Request-ID": "trace-123"}})
+	if apiErr := expectError(t, rec, http.StatusNotFound, "not_found"); apiErr.RequestID != "trace-123" {
+		t.Fatalf("request_id = %q, want the caller's", apiErr.RequestID)
+	}
+	if first, second := ts.get("/healthz").Header().Get("X-Request-ID"), ts.get("/healthz").Header().Get("X-Request-ID"); first == "" || first == second {
+		t.Fatalf("generated ids %q and %q", first, second)
+	}
+}
+
+func TestResponseContentTypes(t *testing.T) {
+	ts := newTestServer(t)
+	ts.brain(brain{})
+	ts.log(logEntry{})
+
+	tests := []struct {
+		path        string
+		accept      string
+		contentType string
+	}{
+		{"/brain", "", "application/json"},
+		{"/brain", "application/x-ndjson", ndjsonContentType},
+		{"/brain", "application/ndjson", ndjsonContentType},
+		{"/logs", "text/html, application/x-ndjson;q=0.9", ndjsonContentType},
+		{"/logs/export", "", "text/csv; charset=utf-8"},
+		{"/openapi", "", "application/json"},
+		{"/", "", "application/json"},
+		{"/", "application/json", "application/json"},
+		{"/", "text/html,application/xhtml+xml,*/*;q=0.8", "text/html; charset=utf-8"},
+		{"/docs", "", "text/html; charset=utf-8"},
+		{"/favicon.ico", "", "image/x-icon"},
+		{"/calendar.ics", "", "text/calendar; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path+" "+tt.accept, func(t *testing.T) {
+			rec := ts.do(request{method: http.MethodGet, path: tt.path, header: map[string]string{"Accept": tt.accept}})
+			expect(t, rec, http.StatusOK)
+			if ct := rec.Header().Get("Content-Type"); ct != tt.contentType {
+				t.Fatalf("Content-Type = %q, want %q", ct, tt.contentType)
+			}
+		})
+	}
+}
+
+func TestMaintenanceMode(t *testing.T) {
+	ts := newTestServer(t)
+	expect(t, ts.post("/admin/maintenance", map[string]any{"reason": "moving disks"}), http.StatusCreated)
+
+	rec := ts.get("/brain")
+	apiErr := expectError(t, rec, http.StatusServiceUnavailable, "unavailable")
+	if rec.Header().Get("Retry-After") == "" || !strings.Contains(apiErr.Message, "moving disks") {
+		t.Fatalf("Retry-After = %q, message = %q", rec.Header().Get("Retry-After"), apiErr.Message)
+	}
+	expect(t, ts.get("/healthz"), http.StatusOK)
+	expect(t, ts.get("/admin/maintenance"), http.StatusOK)
+
+	expect(t, ts.do(request{method: http.MethodDelete, path: "/admin/maintenance"}), http.StatusOK)
+	expect(t, ts.get("/brain"), http.StatusOK)
+}
+
+func TestFeatureGate(t *testing.T) {
+	expectError(t, newTestServer(t).post("/admin/seed", map[string]any{"brains": 1, "logs": 1}), http.StatusNotFound, "not_found")
+
+	ts := newTestServer(t, "SBRAIN_FLAGS=seed")
+	expect(t, ts.post("/admin/seed", map[string]any{"brains": 2, "logs": 3}), http.StatusOK)
+	if got := decode[[]brain](t, ts.get("/brain?archived=all"), http.StatusOK); len(got) != 2 {
+		t.Fatalf("seeded %d brains, want 2", len(got))
+	}
+}
+
+func TestStaticAssets(t *testing.T) {
+	ts := newTestServer(t)
+	for _, path := range []string{"/favicon.ico", "/favicon.svg", "/docs", "/"} {
+		t.Run(path, func(t *testing.T) {
+			browser := map[string]string{"Accept": "text/html"}
+			rec := ts.do(request{method: http.MethodGet, path: path, key: "-", header: browser})
+			expect(t, rec, http.StatusOK)
+			etag := rec.Header().Get("ETag")
+			if etag == "" || rec.Header().Get("Cache-Control") == "" {
+				t.Fatalf("ETag = %q, Cache-Control = %q", etag, rec.Header().Get("Cache-Control"))
+			}
+			browser["If-None-Match"] = etag
+			if rec := ts.do(request{method: http.MethodGet, path: path, key: "-", header: browser}); rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+				t.Fatalf("revalidation: status %d, %d bytes", rec.Code, rec.Body.Len())
+			}
+		})
+	}
+	if cc := ts.get("/favicon.ico").Header().Get("Cache-Control"); cc != "public, max-age=86400" {
+		t.Fatalf("favicon Cache-Control = %q", cc)
+	}
+	if body := ts.do(request{method: http.MethodGet, path: "/", header: map[string]string{"Accept": "text/html"}}).Body.String(); !strings.Contains(body, `href="/docs"`) {
+		t.Fatalf("landing page = %s", body)
+	}
+
+	// With the browser pages off, browsers get the JSON status too.
+	ts = newTestServer(t, "SBRAIN_FLAGS=ui=false")
+	rec := ts.do(request{method: http.MethodGet, path: "/", header: map[string]string{"Accept": "text/html"}})
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	s := &Server{timeouts: timeoutConfig{request: 20 * time.Millisecond}}
+	serve := func(h http.HandlerFunc, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/brain", nil)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		requestIDMiddleware(s.requestTimeout(h)).ServeHTTP(rec, req)
+		return rec
+	}
+
+	// A handler that ignores its deadline is answered for at the deadline.
+	release := make(chan struct{})
+	defer close(release)
+	started := time.Now()
+	apiErr := expectError(t, serve(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		writeJSON(w, http.StatusOK, "too late")
+	}, nil), http.StatusGatewayTimeout, "timeout")
+	if elapsed := time.Since(started); elapsed > time.Second || !strings.Contains(apiErr.Message, "20ms") {
+		t.Fatalf("answered after %s with %q", elapsed, apiErr.Message)
+	}
+
+	// One whose query was cut off reports a timeout, not its 500.
+	expectError(t, serve(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		writeError(w, r, http.StatusInternalServerError, r.Context().Err().Error())
+	}, nil), http.StatusGatewayTimeout, "timeout")
+
+	// A fast handler is untouched, headers included.
+	rec := serve(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Test", "kept")
+	}, nil)
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Test") != "kept" {
+		t.Fatalf("status %d, X-Test %q", rec.Code, rec.Header().Get("X-Test"))
+	}
+
+	// Streams take as long as they need.
+	rec = serve(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		if r.Context().Err() != nil {
+			t.Error("stream was given a deadline")
+		}
+		w.WriteHeader(http.StatusOK)
+	}, map[string]string{"Accept": ndjsonContentType})
+	expect(t, rec, http.StatusOK)
+
+	t.Setenv("SBRAIN_REQUEST_TIMEOUT", "soon")
+	if _, err := New(Options{DBPath: MemoryDB}); err == nil || !strings.Contains(err.Error(), "SBRAIN_REQUEST_TIMEOUT") {
+		t.Fatalf("New with a bad timeout: %v", err)
+	}
+}
+
+func TestRequestTimeoutInterruptsQueries(t *testing.T) {
+	ts := newTestServer(t)
+	if _, err := ts.srv.db.Exec(`INSERT INTO logs (message, metadata, response_time_ms)
+		WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 200000)
+		SELECT 'log ' || i, '{"ua":{"browser":"b' || (i % 50) || '"}}', i % 1000 FROM n`); err != nil {
+		t.Fatal(err)
+	}
+	stats := func(ctx context.Context) (*httptest.ResponseRecorder, time.Duration) {
+		rec := httptest.NewRecorder()
+		started := time.Now()
+		requestIDMiddleware(http.HandlerFunc(ts.srv.logStatsHandler)).
+			ServeHTTP(rec, httptest.NewRequestWithContext(ctx, http.MethodGet, "/logs/stats", nil))
+		return rec, time.Since(started)
+	}
+
+	rec, full := stats(t.Context())
+	expect(t, rec, http.StatusOK)
+
+	// With a deadline a tenth of that, SQLite is interrupted mid-query and
+	// the handler gives up instead of finishing the report.
+	ctx, cancel := context.WithTimeout(t.Context(), full/10)
+	defer cancel()
+	rec, cut := stats(ctx)
+	apiErr := expectError(t, rec, http.StatusInternalServerError, "internal")
+	if !strings.Contains(apiErr.Message, "interrupted") && !strings.Contains(apiErr.Message, context.DeadlineExceeded.Error()) {
+		t.Fatalf("error = %q, want an interrupted query", apiErr.Message)
+	}
+	if cut > full/2 {
+		t.Fatalf("stopped after %s, the full report takes %s", cut, full)
+	}
+
+	// The interrupted connection goes back to the pool in working order.
+	expect(t, ts.get("/logs/stats?level=error"), http.StatusOK)
+}
+
+func TestPanicRecovery(t *testing.T) {
+	events := make(chan string, 1)
+	sentry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.URL.Path != "/api/42/envelope/" || !strings.Contains(r.Header.Get("X-Sentry-Auth"), "sentry_key=pub") {
+			t.Errorf("sentry got %s with %q", r.URL.Path, r.Header.Get("X-Sentry-Auth"))
+		}
+		events <- string(body)
+	}))
+	defer sentry.Close()
+	ts := newTestServer(t, "SBRAIN_SENTRY_DSN="+strings.Replace(sentry.URL, "//", "//pub@", 1)+"/42")
+
+	serve := func(h http.HandlerFunc) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		requestIDMiddleware(ts.srv.recoverPanics(ts.srv.requestTimeout(h))).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/brain/7", nil))
+		return rec
+	}
+	rec := serve(func(w http.ResponseWriter, r *http.Request) { panic("boom") })
+	apiErr := expectError(t, rec, http.StatusInternalServerError, "internal")
+	if strings.Contains(apiErr.Message, "boom") {
+		t.Fatalf("panic leaked to the client: %q", apiErr.Message)
+	}
+
+	logs := decode[[]logEntry](t, ts.get("/logs?level=error"), http.StatusOK)
+	if len(logs) != 1 || logs[0].Message != "panic: boom" || logs[0].RequestID != apiErr.RequestID || logs[0].Endpoint != "/brain/7" {
+		t.Fatalf("logs = %+v", logs)
+	}
+	if !strings.Contains(logs[0].Metadata, "TestPanicRecovery") {
+		t.Fatalf("stack does not reach the handler: %s", logs[0].Metadata)
+	}
+
+	select {
+	case event := <-events:
+		if !strings.Contains(event, `"value":"boom"`) || !strings.Contains(event, `"in_app":true`) || !strings.Contains(event, apiErr.RequestID) {
+			t.Fatalf("sentry event = %s", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event sent to sentry")
+	}
+
+	// Once the response has started, all that is left is to cut it off.
+	defer func() {
+		if p := recover(); p != http.ErrAbortHandler {
+			t.Fatalf("recovered %v, want http.ErrAbortHandler", p)
+		}
+	}()
+	serve(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		panic("late")
+	})
+	t.Fatal("a panic after the response started was swallowed")
+}
+
+func TestEnvelope(t *testing.T) {
+	ts := newTestServer(t)
+	ts.brain(brain{})
+	ts.brain(brain{})
+
+	type envelope struct {
+		Data  json.RawMessage `json:"data"`
+		Error *APIError       `json:"error"`
+		Meta  struct {
+			RequestID  string      `json:"request_id"`
+			TookMS     *float64    `json:"took_ms"`
+			Pagination *pagination `json:"pagination"`
+		} `json:"meta"`
+	}
+
+	rec := ts.get("/brain?envelope=true")
+	list := decode[envelope](t, rec, http.StatusOK)
+	var items []brain
+	if err := json.Unmarshal(list.Data, &items); err != nil || len(items) != 2 {
+		t.Fatalf("data = %s", list.Data)
+	}
+	if list.Meta.RequestID != rec.Header().Get("X-Request-ID") || list.Meta.TookMS == nil {
+		t.Fatalf("meta = %+v", list.Meta)
+	}
+	if p := list.Meta.Pagination; p == nil || p.Count != 2 {
+		t.Fatalf("pagination = %+v", p)
+	}
+
+	rec = ts.do(request{method: http.MethodGet, path: "/audit?limit=1", header: map[string]string{"Accept": envelopeMediaType}})
+	audit := decode[envelope](t, rec, http.StatusOK)
+	if ct := rec.Header().Get("Content-Type"); ct != envelopeMediaType {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	if p := audit.Meta.Pagination; p == nil || p.Limit != 1 {
+		t.Fatalf("pagination = %+v", p)
+	}
+
+	one := decode[envelope](t, ts.get("/brain/1?envelope=1"), http.StatusOK)
+	if one.Meta.Pagination != nil || !strings.Contains(string(one.Data), `"id":1`) {
+		t.Fatalf("single record = %+v", one)
+	}
+
+	missing := decode[envelope](t, ts.get("/brain/99?envelope=true"), http.StatusNotFound)
+	if missing.Error == nil || missing.Error.Code != "not_found" || missing.Meta.RequestID == "" {
+		t.Fatalf("error = %+v", missing)
+	}
+
+	// Without asking, responses stay bare, and non-JSON bodies are never wrapped.
+	if got := decode[[]brain](t, ts.get("/brain"), http.StatusOK); len(got) != 2 {
+		t.Fatalf("bare list = %+v", got)
+	}
+	if rec := ts.get("/logs/export?envelope=true"); !strings.HasPrefix(rec.Body.String(), "id,") {
+		t.Fatalf("CSV was wrapped: %s", rec.Body)
+	}
+
+	// A last page that is exactly full has no page after it.
+	for range 2 {
+		ts.post("/brain", map[string]any{"title": "Audited", "context": "c", "project": "sbrain"})
+	}
+	for limit, more := range map[int]bool{1: true, 2: false} {
+		audit := decode[envelope](t, ts.get("/audit?envelope=1&limit="+strconv.Itoa(limit)), http.StatusOK)
+		var entries []json.RawMessage
+		json.Unmarshal(audit.Data, &entries)
+		if p := audit.Meta.Pagination; p == nil || p.HasMore != more || len(entries) != limit {
+			t.Fatalf("limit %d: %d entries, pagination = %+v", limit, len(entries), p)
+		}
+	}
+}
+
+func TestAPIVersions(t *testing.T) {
+	ts := newTestServer(t)
+
+	// v1, with or without the prefix, keeps returning null for an empty list.
+	for _, path := range []string{"/brain", "/v1/brain"} {
+		rec := ts.get(path)
+		expect(t, rec, http.StatusOK)
+		if body := strings.TrimSpace(rec.Body.String()); body != "null" || rec.Header().Get("X-API-Version") != "1" {
+			t.Fatalf("%s = %s, X-API-Version %q", path, body, rec.Header().Get("X-API-Version"))
+		}
+	}
+
+	// v2 always envelopes, and empty lists are [].
+	for _, req := range []request{
+		{method: http.MethodGet, path: "/v2/brain"},
+		{method: http.MethodGet, path: "/logs", header: map[string]string{"Accept": apiVersionMediaType(apiV2)}},
+	} {
+		rec := ts.do(req)
+		body := decode[map[string]json.RawMessage](t, rec, http.StatusOK)
+		if string(body["data"]) != "[]" || body["meta"] == nil || rec.Header().Get("X-API-Version") != "2" {
+			t.Fatalf("%s = %s", req.path, rec.Body)
+		}
+	}
+	if ct := ts.do(request{method: http.MethodGet, path: "/brain", header: map[string]string{"Accept": apiVersionMediaType(apiV2)}}).Header().Get("Content-Type"); ct != apiVersionMediaType(apiV2) {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+
+	created := decode[map[string]json.RawMessage](t, ts.post("/v2/brain", map[string]any{"title": "t", "context": "c", "project": "sbrain"}), http.StatusCreated)
+	if !strings.Contains(string(created["data"]), `"title":"t"`) {
+		t.Fatalf("created = %s", created["data"])
+	}
+
+	expectError(t, ts.get("/v2/brain/99"), http.StatusNotFound, "not_found")
+	expectError(t, ts.get("/v3/brain"), http.StatusNotFound, "not_found")
+	expectError(t, ts.do(request{method: http.MethodGet, path: "/v2/brain", key: "-"}), http.StatusUnauthorized, "unauthorized")
+
+	// OTLP's own /v1 path is not a version prefix.
+	expect(t, ts.do(request{method: http.MethodPost, path: "/v1/logs", body: map[string]any{"resourceLogs": []any{}}}), http.StatusOK)
+}
+
+func TestDeprecationHeaders(t *testing.T) {
+	ts := newTestServer(t)
+	for _, path := range []string{"/brain", "/v1/brain"} {
+		rec := ts.get(path)
+		expect(t, rec, http.StatusOK)
+		if rec.Header().Get("Deprecation") == "" || rec.Header().Get("Sunset") == "" {
+			t.Fatalf("%s: no deprecation headers: %v", path, rec.Header())
+		}
+		if link := rec.Header().Get("Link"); link != `</v2/brain>; rel="successor-version"` {
+			t.Fatalf("%s: Link = %q", path, link)
+		}
+	}
+	if rec := ts.get("/v2/brain"); rec.Header().Get("Deprecation") != "" || rec.Header().Get("Sunset") != "" {
+		t.Fatalf("v2 is marked deprecated: %v", rec.Header())
+	}
+
+	spec := decode[map[string]any](t, ts.get("/openapi"), http.StatusOK)
+	if servers, _ := spec["servers"].([]any); len(servers) != 3 {
+		t.Fatalf("servers = %v", spec["servers"])
+	}
+}
+
+func TestStartClose(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	before := runtime.NumGoroutine()
+	ts := newTestServer(t, "SBRAIN_SYSLOG_ADDR="+addr, "SBRAIN_LOG_FORWARD=file://"+filepath.Join(t.TempDir(), "forward.ndjson"),
+		"SBRAIN_ERROR_WEBHOOK_URL=http://127.0.0.1:1/hook", "SBRAIN_REMINDER_WEBHOOK=http://127.0.0.1:1/hook", "SBRAIN_LOG_RETENTION=*=30")
+	if err := ts.srv.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// A syslog client that stays connected must not hold Close up.
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("<11>1 2024-06-12T10:00:00Z host app - - - disk full\n"))
+	for deadline := time.Now().Add(5 * time.Second); len(decode[[]logEntry](t, ts.get("/logs"), http.StatusOK)) == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("syslog message not stored")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	closed := make(chan error)
+	go func() { closed <- ts.srv.Close() }()
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Fatalf("Close = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not return")
+	}
+	// Every job Start launched has returned.
+	for deadline := time.Now().Add(5 * time.Second); runtime.NumGoroutine() > before; {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<20)
+			t.Fatalf("%d goroutines left running, %d before Start:\n%s", runtime.NumGoroutine(), before, buf[:runtime.Stack(buf, true)])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
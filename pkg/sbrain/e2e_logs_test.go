@@ -0,0 +1,441 @@
+package sbrain
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"sbrain/store"
+)
+
+func TestLogLifecycle(t *testing.T) {
+	ts := newTestServer(t)
+
+	created := decode[logEntry](t, ts.post("/logs", map[string]any{
+		"level": "ERROR", "message": "payment failed", "endpoint": "/api/pay", "method": "POST",
+		"status_code": 502, "response_time_ms": 1200, "metadata": `{"order":42}`,
+	}), http.StatusCreated)
+	if created.ID == 0 || created.Level != "error" || created.CreatedAt == "" || created.OccurredAt == "" {
+		t.Fatalf("created = %+v", created)
+	}
+
+	got := decode[logEntry](t, ts.get("/logs/1"), http.StatusOK)
+	if got.Message != "payment failed" || got.StatusCode == nil || *got.StatusCode != 502 {
+		t.Fatalf("got = %+v", got)
+	}
+
+	expect(t, ts.do(request{method: http.MethodDelete, path: "/logs/1"}), http.StatusNoContent)
+	expectError(t, ts.get("/logs/1"), http.StatusNotFound, "not_found")
+	expectError(t, ts.do(request{method: http.MethodDelete, path: "/logs/1"}), http.StatusNotFound, "not_found")
+}
+
+func TestLogDefaultsAndBackfill(t *testing.T) {
+	ts := newTestServer(t)
+	created := decode[logEntry](t, ts.post("/logs", map[string]any{
+		"message": "imported", "created_at": "2024-06-12T10:00:00Z",
+	}), http.StatusCreated)
+	if created.Level != "info" {
+		t.Fatalf("level = %q, want info", created.Level)
+	}
+	if created.OccurredAt != "2024-06-12 10:00:00" {
+		t.Fatalf("occurred_at = %q, want the backfilled created_at", created.OccurredAt)
+	}
+	if created.CreatedAt == created.OccurredAt {
+		t.Fatalf("created_at was taken from the body: %+v", created)
+	}
+}
+
+func TestLogValidation(t *testing.T) {
+	ts := newTestServer(t)
+	tests := []struct {
+		name   string
+		body   map[string]any
+		fields []string
+	}{
+		{"empty", map[string]any{}, []string{"message"}},
+		{"unknown level", map[string]any{"message": "m", "level": "loud"}, []string{"level"}},
+		{"status code", map[string]any{"message": "m", "status_code": 99}, []string{"status_code"}},
+		{"negative response time", map[string]any{"message": "m", "response_time_ms": -1}, []string{"response_time_ms"}},
+		{"metadata not JSON", map[string]any{"message": "m", "metadata": "{nope"}, []string{"metadata"}},
+		{"project not a slug", map[string]any{"message": "m", "project": "a b"}, []string{"project"}},
+		{"unknown brain", map[string]any{"message": "m", "brain_id": 99}, []string{"brain_id"}},
+		{"label key", map[string]any{"message": "m", "labels": map[string]string{"a b": "x"}}, []string{"labels"}},
+		{"label value", map[string]any{"message": "m", "labels": map[string]string{"env": strings.Repeat("x", 201)}}, []string{"labels.env"}},
+		{"several", map[string]any{"level": "loud", "status_code": 700}, []string{"message", "level", "status_code"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectFields(t, ts.post("/logs", tt.body), tt.fields...)
+		})
+	}
+}
+
+func TestLogListFilters(t *testing.T) {
+	ts := newTestServer(t)
+	ts.log(logEntry{Level: "error", Message: "a", Endpoint: "/api/pay", Method: "POST", StatusCode: intPtr(500), OccurredAt: "2024-06-10 12:00:00"})
+	ts.log(logEntry{Level: "info", Message: "b", Endpoint: "/api/pay", Method: "GET", StatusCode: intPtr(200), OccurredAt: "2024-06-11 12:00:00"})
+	ts.log(logEntry{Level: "info", Message: "c", Endpoint: "/api/users", Method: "GET", StatusCode: intPtr(200), RequestID: "req-1", OccurredAt: "2024-06-12 12:00:00"})
+
+	tests := []struct {
+		query string
+		want  []int64
+	}{
+		{"", []int64{3, 2, 1}},
+		{"?level=info", []int64{3, 2}},
+		{"?endpoint=/api/pay", []int64{2, 1}},
+		{"?method=POST", []int64{1}},
+		{"?status_code=200", []int64{3, 2}},
+		{"?request_id=req-1", []int64{3}},
+		{"?since=2024-06-11", []int64{3, 2}},
+		{"?until=2024-06-11", []int64{1}},
+		{"?since=2024-06-11&until=2024-06-12", []int64{2}},
+		{"?level=fatal", []int64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got := ids(decode[[]logEntry](t, ts.get("/logs"+tt.query), http.StatusOK))
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("ids = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	for _, query := range []string{"?status_code=abc", "?since=yesterday", "?brain_id=x"} {
+		expectError(t, ts.get("/logs"+query), http.StatusBadRequest, "bad_request")
+	}
+}
+
+func TestLogLabels(t *testing.T) {
+	ts := newTestServer(t)
+	created := decode[logEntry](t, ts.post("/logs", map[string]any{
+		"message": "a", "labels": map[string]string{"service": "api", "env": "prod"},
+	}), http.StatusCreated)
+	if created.Labels["service"] != "api" || created.Labels["env"] != "prod" {
+		t.Fatalf("labels = %v", created.Labels)
+	}
+	decode[logEntry](t, ts.post("/logs", map[string]any{"message": "b", "labels": map[string]string{"service": "worker", "env": "prod"}}), http.StatusCreated)
+	decode[logEntry](t, ts.post("/logs", map[string]any{"message": "c"}), http.StatusCreated)
+
+	tests := []struct {
+		query string
+		want  []int64
+	}{
+		{"?label=service:api", []int64{1}},
+		{"?label=env:prod", []int64{2, 1}},
+		{"?label=service", []int64{2, 1}},
+		{"?label=env:prod&label=service:worker", []int64{2}},
+		{"?label=service:web", []int64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got := ids(decode[[]logEntry](t, ts.get("/logs"+tt.query), http.StatusOK))
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("ids = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	expectError(t, ts.get("/logs?label=:api"), http.StatusBadRequest, "bad_request")
+
+	result := decode[map[string]any](t, ts.post("/logs/purge?label=service:worker", nil), http.StatusOK)
+	if result["deleted"] != float64(1) {
+		t.Fatalf("purge = %v", result)
+	}
+	if got := ids(decode[[]logEntry](t, ts.get("/logs?label=service"), http.StatusOK)); !slices.Equal(got, []int64{1}) {
+		t.Fatalf("after purge = %v", got)
+	}
+}
+
+func TestLogBatch(t *testing.T) {
+	ts := newTestServer(t)
+	result := decode[logBatchResult](t, ts.post("/logs/batch", []map[string]any{
+		{"message": "first", "level": "WARN", "occurred_at": "2024-06-12T10:00:00Z"},
+		{"message": "no such level", "level": "loud"},
+		{"message": "second", "service": "api"},
+	}), http.StatusOK)
+	if result.Stored != 2 || !slices.Equal(result.IDs, []int64{1, 2}) || len(result.Rejected) != 1 {
+		t.Fatalf("result = %+v", result)
+	}
+	if r := result.Rejected[0]; r.Index != 1 || len(r.Fields) != 1 || r.Fields[0].Field != "level" {
+		t.Fatalf("rejected = %+v", result.Rejected)
+	}
+	first := decode[logEntry](t, ts.get("/logs/1"), http.StatusOK)
+	if first.Level != "warn" || first.OccurredAt != "2024-06-12 10:00:00" {
+		t.Fatalf("first = %+v", first)
+	}
+
+	expectError(t, ts.post("/logs/batch", map[string]any{"message": "not an array"}), http.StatusBadRequest, "bad_request")
+	expectError(t, ts.post("/logs/batch", make([]map[string]any, maxLogBatch+1)), http.StatusBadRequest, "bad_request")
+	expect(t, ts.do(request{method: http.MethodPost, path: "/logs/batch", body: []any{}, key: readKey}), http.StatusForbidden)
+}
+
+func TestLogPurge(t *testing.T) {
+	ts := newTestServer(t)
+	ts.log(logEntry{Level: "debug", Message: "noise", OccurredAt: "2024-01-01 00:00:00"})
+	ts.log(logEntry{Level: "debug", Message: "recent noise"})
+	ts.log(logEntry{Level: "error", Message: "keep", OccurredAt: "2024-01-01 00:00:00"})
+
+	expectError(t, ts.post("/logs/purge", nil), http.StatusBadRequest, "bad_request")
+	expectError(t, ts.post("/logs/purge?before=2024-02-01&until=2024-02-01", nil), http.StatusBadRequest, "bad_request")
+	result := decode[map[string]any](t, ts.post("/logs/purge?level=debug&before=2024-02-01", nil), http.StatusOK)
+	if result["deleted"] != float64(1) {
+		t.Fatalf("purge = %v", result)
+	}
+	if got := ids(decode[[]logEntry](t, ts.get("/logs"), http.StatusOK)); len(got) != 2 {
+		t.Fatalf("left = %v", got)
+	}
+}
+
+func TestLogExportCSV(t *testing.T) {
+	ts := newTestServer(t)
+	ts.log(logEntry{Level: "warn", Message: "quote \"this\", please"})
+
+	rec := ts.get("/logs/export")
+	expect(t, rec, http.StatusOK)
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("read CSV: %v", err)
+	}
+	if len(rows) != 2 || rows[0][0] != "id" || rows[1][slices.Index(rows[0], "message")] != `quote "this", please` {
+		t.Fatalf("rows = %q", rows)
+	}
+}
+
+func TestLogStats(t *testing.T) {
+	ts := newTestServer(t)
+	ts.log(logEntry{Level: "error", Message: "a", StatusCode: intPtr(500)})
+	ts.log(logEntry{Level: "error", Message: "b", StatusCode: intPtr(503)})
+	ts.log(logEntry{Level: "info", Message: "c", StatusCode: intPtr(200)})
+
+	type bucket struct {
+		Key   string `json:"key"`
+		Count int    `json:"count"`
+	}
+	stats := decode[struct {
+		Total         int      `json:"total"`
+		ByLevel       []bucket `json:"by_level"`
+		ByStatusClass []bucket `json:"by_status_class"`
+	}](t, ts.get("/logs/stats"), http.StatusOK)
+	if stats.Total != 3 {
+		t.Fatalf("total = %d", stats.Total)
+	}
+	if !slices.Contains(stats.ByLevel, bucket{"error", 2}) || !slices.Contains(stats.ByStatusClass, bucket{"5xx", 2}) {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
+
+func TestLogServices(t *testing.T) {
+	ts := newTestServer(t, "SBRAIN_API_KEYS=admin:"+adminKey+":admin,billing:b1ll:logs-only::billing",
+		"SBRAIN_LOG_RETENTION=api=7,*=30")
+	post := func(body map[string]any, key string, header map[string]string) logEntry {
+		t.Helper()
+		return decode[logEntry](t, ts.do(request{method: "POST", path: "/logs", body: body, key: key, header: header}), http.StatusCreated)
+	}
+	if l := post(map[string]any{"message": "a", "service": "api"}, "", nil); l.Service != "api" {
+		t.Fatalf("body service = %q", l.Service)
+	}
+	if l := post(map[string]any{"message": "b"}, "", map[string]string{"X-Sbrain-Service": "worker"}); l.Service != "worker" {
+		t.Fatalf("header service = %q", l.Service)
+	}
+	if l := post(map[string]any{"message": "c"}, "b1ll", nil); l.Service != "billing" {
+		t.Fatalf("key service = %q", l.Service)
+	}
+	if l := post(map[string]any{"message": "d", "service": "api"}, "b1ll", nil); l.Service != "api" {
+		t.Fatalf("body over key service = %q", l.Service)
+	}
+	expectFields(t, ts.post("/logs", map[string]any{"message": "e", "service": "a b"}), "service")
+
+	if got := ids(decode[[]logEntry](t, ts.get("/logs?service=api"), http.StatusOK)); !slices.Equal(got, []int64{4, 1}) {
+		t.Fatalf("service=api ids = %v", got)
+	}
+	stats := decode[logStats](t, ts.get("/logs/stats"), http.StatusOK)
+	if len(stats.ByService) != 3 || stats.ByService[0] != (countBucket{Key: "api", Count: 2}) {
+		t.Fatalf("by_service = %+v", stats.ByService)
+	}
+
+	ts.srv.requireLogService = true
+	expectFields(t, ts.post("/logs", map[string]any{"message": "f"}), "service")
+	post(map[string]any{"message": "g"}, "b1ll", nil)
+	push := map[string]any{"streams": []any{map[string]any{
+		"stream": map[string]string{"level": "info"},
+		"values": [][]string{{"1718186400000000000", "no service"}},
+	}}}
+	expectError(t, ts.post("/loki/api/v1/push", push), http.StatusBadRequest, "bad_request")
+	expect(t, ts.do(request{method: "POST", path: "/loki/api/v1/push", body: push, header: map[string]string{"X-Sbrain-Service": "edge"}}), http.StatusNoContent)
+	if got := ids(decode[[]logEntry](t, ts.get("/logs?service=edge"), http.StatusOK)); len(got) != 1 {
+		t.Fatalf("service=edge ids = %v", got)
+	}
+
+	now := time.Now()
+	old := store.NewTimestamp(now.Add(-10 * 24 * time.Hour))
+	older := store.NewTimestamp(now.Add(-40 * 24 * time.Hour))
+	ts.log(logEntry{Message: "old api", Service: "api", OccurredAt: old})
+	ts.log(logEntry{Message: "old worker", Service: "worker", OccurredAt: old})
+	ts.log(logEntry{Message: "older worker", Service: "worker", OccurredAt: older})
+	ts.log(logEntry{Message: "older unnamed", OccurredAt: older})
+	// The Loki line from 2024 goes too, under the * rule.
+	deleted, err := ts.srv.purgeExpiredLogs(now)
+	if err != nil || deleted != 4 {
+		t.Fatalf("purgeExpiredLogs = %d, %v", deleted, err)
+	}
+	left := decode[[]logEntry](t, ts.get("/logs?until="+now.Add(-24*time.Hour).Format(time.RFC3339)), http.StatusOK)
+	if len(left) != 1 || left[0].Message != "old worker" {
+		t.Fatalf("left = %+v", left)
+	}
+}
+
+func TestLokiPush(t *testing.T) {
+	ts := newTestServer(t)
+	expect(t, ts.post("/loki/api/v1/push", map[string]any{
+		"streams": []any{map[string]any{
+			"stream": map[string]string{"level": "warn", "endpoint": "/api/pay"},
+			"values": [][]string{{"1718186400000000000", "disk almost full"}},
+		}},
+	}), http.StatusNoContent)
+	logs := decode[[]logEntry](t, ts.get("/logs"), http.StatusOK)
+	if len(logs) != 1 || logs[0].Level != "warn" || logs[0].Message != "disk almost full" {
+		t.Fatalf("logs = %+v", logs)
+	}
+	expectError(t, ts.post("/loki/api/v1/push", "{not json"), http.StatusBadRequest, "bad_request")
+
+	// A snappy header claiming 256 MiB in a 5-byte body is refused, as is a
+	// block that decodes to more than its header says.
+	bomb := []byte{0x80, 0x80, 0x80, 0x80, 0x01}
+	expectError(t, ts.do(request{method: http.MethodPost, path: "/loki/api/v1/push", body: bomb, header: map[string]string{"Content-Type": "application/x-protobuf"}}), http.StatusBadRequest, "bad_request")
+	block := []byte{0x08, 0x04, 'a', 'b', 0x09, 0x02}
+	if got, err := snappyDecode(block, 8); string(got) != "abababab" || err != nil {
+		t.Fatalf("snappyDecode = %q, %v", got, err)
+	}
+	for _, bad := range [][]byte{append([]byte{0x04}, block[1:]...), block} {
+		if _, err := snappyDecode(bad, 4); err == nil {
+			t.Fatalf("snappyDecode(%x) accepted", bad)
+		}
+	}
+}
+
+func TestLogForwarding(t *testing.T) {
+	downstream := newTestServer(t)
+	relay := httptest.NewServer(downstream.srv)
+	defer relay.Close()
+	var attempts atomic.Int32
+	batches := make(chan []logEntry, 4)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) == 1 {
+			http.Error(w, "try later", http.StatusServiceUnavailable)
+			return
+		}
+		var payload struct{ Logs []logEntry }
+		json.NewDecoder(r.Body).Decode(&payload)
+		batches <- payload.Logs
+	}))
+	defer webhook.Close()
+	file := filepath.Join(t.TempDir(), "forward.ndjson")
+
+	ts := newTestServer(t, "SBRAIN_LOG_FORWARD="+strings.Join([]string{
+		"sbrain+" + strings.Replace(relay.URL, "//", "//:"+adminKey+"@", 1) + "#level=error",
+		webhook.URL + "/hook#service=api",
+		"file://" + file,
+	}, ","))
+	for _, sink := range ts.srv.logForward.sinks {
+		sink.interval, sink.retryDelay = 10*time.Millisecond, 10*time.Millisecond
+	}
+	if !strings.HasPrefix(ts.srv.logForward.sinks[0].target, "http://") {
+		t.Fatalf("sbrain sink target = %q", ts.srv.logForward.sinks[0].target)
+	}
+	ts.srv.logForward.start(t.Context(), &ts.srv.jobs)
+
+	for _, l := range []map[string]any{
+		{"level": "error", "message": "payment failed", "service": "api", "labels": map[string]string{"env": "prod"}},
+		{"level": "info", "message": "paid", "service": "api"},
+		{"level": "error", "message": "job crashed", "service": "worker"},
+	} {
+		expect(t, ts.post("/logs", l), http.StatusCreated)
+	}
+
+	select {
+	case batch := <-batches:
+		if len(batch) != 2 || batch[0].Message != "payment failed" || batch[1].Message != "paid" {
+			t.Fatalf("webhook batch = %+v", batch)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook batch not retried")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		relayed := decode[[]logEntry](t, downstream.get("/logs"), http.StatusOK)
+		data, _ := os.ReadFile(file)
+		if len(relayed) == 2 && strings.Count(string(data), "\n") == 3 {
+			if relayed[1].Message != "payment failed" || relayed[1].Service != "api" || relayed[1].Labels["env"] != "prod" {
+				t.Fatalf("relayed = %+v", relayed)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("relayed %d logs, file %q", len(relayed), data)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestErrorForwarding(t *testing.T) {
+	batches := make(chan []logEntry, 4)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct{ Logs []logEntry }
+		json.NewDecoder(r.Body).Decode(&payload)
+		batches <- payload.Logs
+	}))
+	defer webhook.Close()
+	events := make(chan string, 4)
+	sentry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		events <- string(body)
+	}))
+	defer sentry.Close()
+
+	ts := newTestServer(t, "SBRAIN_ERROR_WEBHOOK_URL="+webhook.URL, "SBRAIN_SENTRY_DSN="+strings.Replace(sentry.URL, "//", "//pub@", 1)+"/1")
+	ts.srv.forwarder.interval = 10 * time.Millisecond
+	ts.srv.spawn(t.Context(), ts.srv.forwarder.run)
+
+	for _, l := range []map[string]any{
+		{"level": "info", "message": "fine"},
+		{"level": "fatal", "message": "out of memory", "endpoint": "/api/report", "method": "GET", "status_code": 500},
+		{"level": "error", "message": "timeout talking to db"},
+	} {
+		expect(t, ts.post("/logs", l), http.StatusCreated)
+	}
+
+	var forwarded []string
+	for len(forwarded) < 2 {
+		select {
+		case batch := <-batches:
+			for _, l := range batch {
+				forwarded = append(forwarded, l.Message)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("forwarded %v, want the two errors", forwarded)
+		}
+	}
+	if !slices.Equal(forwarded, []string{"out of memory", "timeout talking to db"}) {
+		t.Fatalf("forwarded %v", forwarded)
+	}
+	for range 2 {
+		select {
+		case event := <-events:
+			if strings.Contains(event, "out of memory") && (!strings.Contains(event, `"level":"fatal"`) || !strings.Contains(event, `"status_code":"500"`)) {
+				t.Fatalf("sentry event = %s", event)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("missing sentry events")
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package sbrain
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"sbrain/store"
+)
+
+func TestHeartbeats(t *testing.T) {
+	texts := make(chan string, 4)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct{ Text string }
+		json.NewDecoder(r.Body).Decode(&payload)
+		texts <- payload.Text
+	}))
+	defer hook.Close()
+	ts := newTestServer(t)
+
+	expectFields(t, ts.do(request{method: http.MethodPut, path: "/heartbeats/backup", body: map[string]any{"interval_seconds": 5, "channel": "pager"}}),
+		"interval_seconds", "channel")
+	expectError(t, ts.post("/heartbeats/backup", nil), http.StatusNotFound, "not_found")
+	hb := decode[heartbeat](t, ts.do(request{method: http.MethodPut, path: "/heartbeats/backup",
+		body: map[string]any{"interval_seconds": 3600, "grace_seconds": 600, "channel": "webhook", "target": hook.URL}}), http.StatusCreated)
+	if hb.Status != heartbeatNew || hb.DueAt == "" {
+		t.Fatalf("created = %+v", hb)
+	}
+
+	// Cron jobs ping with a logs-only key, which cannot reconfigure anything.
+	hb = decode[heartbeat](t, ts.do(request{method: http.MethodPost, path: "/heartbeats/backup", key: logsKey}), http.StatusOK)
+	if hb.Status != heartbeatUp || hb.LastPingAt == "" {
+		t.Fatalf("after ping = %+v", hb)
+	}
+	expectError(t, ts.do(request{method: http.MethodDelete, path: "/heartbeats/backup", key: logsKey}), http.StatusForbidden, "forbidden")
+
+	// Not yet due: nothing happens.
+	ts.srv.evaluateHeartbeats(t.Context(), time.Now().UTC())
+	if got := decode[heartbeat](t, ts.get("/heartbeats/backup"), http.StatusOK); got.Status != heartbeatUp {
+		t.Fatalf("status = %q before the deadline", got.Status)
+	}
+
+	// Over an hour and ten minutes later it is down, once.
+	later := time.Now().UTC().Add(71 * time.Minute)
+	ts.srv.evaluateHeartbeats(t.Context(), later)
+	ts.srv.evaluateHeartbeats(t.Context(), later.Add(time.Minute))
+	if got := decode[heartbeat](t, ts.get("/heartbeats/backup"), http.StatusOK); got.Status != heartbeatDown || got.LastMissedAt == "" {
+		t.Fatalf("after the deadline = %+v", got)
+	}
+	logs := decode[[]logEntry](t, ts.get("/logs?level=error&endpoint=/heartbeats/backup"), http.StatusOK)
+	if len(logs) != 1 {
+		t.Fatalf("error logs = %+v", logs)
+	}
+	if text := <-texts; text != logs[0].Message {
+		t.Fatalf("alert %q, log %q", text, logs[0].Message)
+	}
+
+	// The next ping brings it back up, and says so.
+	expect(t, ts.post("/heartbeats/backup", nil), http.StatusOK)
+	if logs := decode[[]logEntry](t, ts.get("/logs?level=info&endpoint=/heartbeats/backup"), http.StatusOK); len(logs) != 1 {
+		t.Fatalf("recovery logs = %+v", logs)
+	}
+	select {
+	case <-texts:
+	case <-time.After(5 * time.Second):
+		t.Fatal("recovery was not announced")
+	}
+}
+
+func TestMonitors(t *testing.T) {
+	texts := make(chan string, 4)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload struct{ Text string }
+		json.NewDecoder(r.Body).Decode(&payload)
+		texts <- payload.Text
+	}))
+	defer hook.Close()
+	var healthy atomic.Bool
+	healthy.Store(true)
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		fmt.Fprint(w, "status: ok")
+	}))
+	defer site.Close()
+	ts := newTestServer(t)
+
+	expectFields(t, ts.post("/monitors", map[string]any{"name": "site", "url": "ftp://example.com", "interval_seconds": 10, "method": "POST"}),
+		"url", "method", "interval_seconds")
+	m := decode[monitor](t, ts.post("/monitors", map[string]any{"name": "site", "url": site.URL, "keyword": "ok",
+		"channel": "webhook", "target": hook.URL}), http.StatusCreated)
+	if m.Status != monitorNew || m.Method != http.MethodGet || m.FailureThreshold != 2 || !m.Enabled {
+		t.Fatalf("created = %+v", m)
+	}
+
+	// The first check is due at once, the next only after the interval.
+	now := time.Now().UTC()
+	ts.srv.runDueMonitors(t.Context(), now)
+	ts.srv.runDueMonitors(t.Context(), now.Add(10*time.Second))
+	m = decode[monitor](t, ts.get(fmt.Sprintf("/monitors/%d", m.ID)), http.StatusOK)
+	if m.Status != monitorUp || m.LastStatusCode != http.StatusOK || m.LastError != "" {
+		t.Fatalf("after a passing check = %+v", m)
+	}
+	logs := decode[[]logEntry](t, ts.get("/logs?level=info&endpoint="+site.URL), http.StatusOK)
+	if len(logs) != 1 || logs[0].ResponseTimeMs == nil || logs[0].StatusCode == nil || *logs[0].StatusCode != http.StatusOK {
+		t.Fatalf("check logs = %+v", logs)
+	}
+
+	// One failure is logged; the second in a row takes it down and alerts.
+	healthy.Store(false)
+	path := fmt.Sprintf("/monitors/%d/check", m.ID)
+	if m = decode[monitor](t, ts.post(path, nil), http.StatusOK); m.Status != monitorUp || m.ConsecutiveFailures != 1 {
+		t.Fatalf("after one failure = %+v", m)
+	}
+	if m = decode[monitor](t, ts.post(path, nil), http.StatusOK); m.Status != monitorDown || m.LastError != "status 503" {
+		t.Fatalf("after two failures = %+v", m)
+	}
+	if logs := decode[[]logEntry](t, ts.get("/logs?level=error&endpoint="+site.URL), http.StatusOK); len(logs) != 2 {
+		t.Fatalf("failure logs = %+v", logs)
+	}
+	if text := <-texts; !strings.Contains(text, `"site" is down: status 503`) {
+		t.Fatalf("alert = %q", text)
+	}
+	expect(t, ts.post(path, nil), http.StatusOK)
+	healthy.Store(true)
+	if m = decode[monitor](t, ts.post(path, nil), http.StatusOK); m.Status != monitorUp || m.ConsecutiveFailures != 0 {
+		t.Fatalf("after recovering = %+v", m)
+	}
+	select {
+	case text := <-texts:
+		if !strings.Contains(text, "back up") {
+			t.Fatalf("recovery alert = %q", text)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("recovery was not announced")
+	}
+
+	// A missing keyword fails the check even with a 200.
+	m = decode[monitor](t, ts.do(request{method: http.MethodPut, path: fmt.Sprintf("/monitors/%d", m.ID), body: map[string]any{"keyword": "welcome"}}), http.StatusOK)
+	if m.URL != site.URL || m.Status != monitorUp {
+		t.Fatalf("update lost fields: %+v", m)
+	}
+	if m = decode[monitor](t, ts.post(path, nil), http.StatusOK); m.LastError != `keyword "welcome" not found` {
+		t.Fatalf("keyword check = %+v", m)
+	}
+}
+
+func TestSLOReport(t *testing.T) {
+	ts := newTestServer(t)
+	now := time.Now()
+	at := func(ago time.Duration) timestamp { return store.NewTimestamp(now.Add(-ago)) }
+	// 100 requests to /api/orders in the last day, ten of them in the last
+	// hour including both slow ones; one 500 earlier.
+	for i := range 100 {
+		l := logEntry{Message: fmt.Sprintf("order %d", i), Endpoint: "/api/orders", Method: "GET", ResponseTimeMs: intPtr(100), OccurredAt: at(3 * time.Hour)}
+		if i < 10 {
+			l.OccurredAt = at(10 * time.Minute)
+		}
+		if i < 2 {
+			l.ResponseTimeMs = intPtr(900)
+		}
+		if i == 50 {
+			l.Level, l.StatusCode = "error", intPtr(500)
+		}
+		ts.log(l)
+	}
+	ts.log(logEntry{Message: "user", Endpoint: "/api/users/7", ResponseTimeMs: intPtr(50), OccurredAt: at(time.Hour)})
+	ts.log(logEntry{Level: "error", Message: "old", Endpoint: "/api/orders", ResponseTimeMs: intPtr(5000), OccurredAt: at(40 * 24 * time.Hour)})
+
+	expectFields(t, ts.post("/slos", map[string]any{"endpoint": "/api/orders", "latency_threshold_ms": 500}), "latency_objective")
+	expectFields(t, ts.post("/slos", map[string]any{"endpoint": "/api/orders"}), "max_error_rate")
+	decode[slo](t, ts.post("/slos", map[string]any{"endpoint": "/api/orders", "latency_threshold_ms": 500,
+		"latency_objective": 0.99, "max_error_rate": 0.05}), http.StatusCreated)
+	expectError(t, ts.post("/slos", map[string]any{"endpoint": "/api/orders", "max_error_rate": 0.1}), http.StatusConflict, "conflict")
+	decode[slo](t, ts.post("/slos", map[string]any{"endpoint": "/api/*", "max_error_rate": 0.001}), http.StatusCreated)
+
+	expectError(t, ts.get("/slo/report?window=month"), http.StatusBadRequest, "bad_request")
+	report := decode[sloReport](t, ts.get("/slo/report?window=30d"), http.StatusOK)
+	if report.Window != "30d" || len(report.SLOs) != 2 {
+		t.Fatalf("report = %+v", report)
+	}
+	near := func(got *float64, want float64) bool { return got != nil && math.Abs(*got-want) < 1e-9 }
+
+	prefix, orders := report.SLOs[0], report.SLOs[1]
+	if prefix.Endpoint != "/api/*" || prefix.Latency != nil || prefix.Errors.Total != 101 || prefix.Errors.Bad != 1 || prefix.Met {
+		t.Fatalf("prefix slo = %+v %+v", prefix, prefix.Errors)
+	}
+	lat := orders.Latency
+	if lat.Total != 100 || lat.Bad != 2 || !near(lat.Compliance, 0.98) || !near(lat.BurnRate, 2) ||
+		!near(lat.BurnRate1h, 20) || !near(lat.BudgetRemaining, -1) || lat.Met {
+		t.Fatalf("latency = %+v", lat)
+	}
+	errs := orders.Errors
+	if errs.Total != 100 || errs.Bad != 1 || !near(errs.BurnRate, 0.2) || !near(errs.BurnRate1h, 0) || !errs.Met || orders.Met {
+		t.Fatalf("errors = %+v, met %v", errs, orders.Met)
+	}
+
+	// The old slow error is inside a longer window.
+	report = decode[sloReport](t, ts.get("/slo/report?window=60d"), http.StatusOK)
+	if got := report.SLOs[1].Latency; got.Total != 101 || got.Bad != 3 {
+		t.Fatalf("60d latency = %+v", got)
+	}
+}
@@ -0,0 +1,236 @@
+package sbrain
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// routeCase is one request made to an endpoint by TestEveryRoute.
+type routeCase struct {
+	pattern string // the route it exercises, as registered in routes
+	method  string
+	path    string
+	body    any
+	status  int
+}
+
+// TestEveryRoute calls every registered route once, in an order where
+// later cases can rely on what earlier ones created, and checks the status.
+// A route added without a case here fails the test. Routes that depend on
+// an unconfigured integration are expected to say so rather than to work.
+func TestEveryRoute(t *testing.T) {
+	ts := newTestServer(t)
+	ts.brain(brain{Title: "Retry idea", Tags: "ideas,perf"})
+	ts.brain(brain{Title: "Scratch", Project: "scratch"})
+	ts.log(logEntry{Level: "error", Message: "boom", Endpoint: "/api/orders", Method: "GET", StatusCode: intPtr(500), ResponseTimeMs: intPtr(900)})
+	ts.log(logEntry{Level: "debug", Message: "cache miss"})
+
+	cases := []routeCase{
+		{"GET /{$}", "GET", "/", nil, 200},
+		{"GET /openapi", "GET", "/openapi", nil, 200},
+		{"GET /readyz", "GET", "/readyz", nil, 200},
+		{"GET /healthz", "GET", "/healthz", nil, 200},
+		{"GET /metrics", "GET", "/metrics", nil, 200},
+		{"GET /docs", "GET", "/docs", nil, 200},
+		{"GET /favicon.ico", "GET", "/favicon.ico", nil, 200},
+		{"GET /favicon.svg", "GET", "/favicon.svg", nil, 200},
+		{"GET /whoami", "GET", "/whoami", nil, 200},
+
+		{"POST /brain", "POST", "/brain", map[string]any{"title": "Cache plan", "context": "Warm it on deploy", "project": "sbrain"}, 201},
+		{"GET /brain", "GET", "/brain?project=sbrain", nil, 200},
+		{"GET /brain/{id}", "GET", "/brain/1", nil, 200},
+		{"PUT /brain/{id}", "PUT", "/brain/1", map[string]any{"title": "Retry idea", "context": "Back off", "project": "sbrain", "tags": "ideas,perf", "version": 1}, 200},
+		{"PATCH /brain", "PATCH", "/brain?project=scratch", map[string]any{"add_tags": []string{"old"}}, 200},
+		{"GET /brain/stats", "GET", "/brain/stats", nil, 200},
+		{"GET /brain/calendar", "GET", "/brain/calendar", nil, 200},
+		{"GET /brain/on", "GET", "/brain/on?date=2024-06-12", nil, 200},
+		{"GET /brain/onthisday", "GET", "/brain/onthisday", nil, 200},
+		{"GET /brain/random", "GET", "/brain/random", nil, 200},
+		{"POST /brain/suggest-tags", "POST", "/brain/suggest-tags", map[string]any{"title": "Retry", "context": "a perf idea"}, 200},
+		{"PUT /brain/{id}/pin", "PUT", "/brain/1/pin", nil, 200},
+		{"DELETE /brain/{id}/pin", "DELETE", "/brain/1/pin", nil, 200},
+		{"PUT /brain/{id}/favorite", "PUT", "/brain/1/favorite", nil, 200},
+		{"DELETE /brain/{id}/favorite", "DELETE", "/brain/1/favorite", nil, 200},
+		{"PUT /brain/{id}/archive", "PUT", "/brain/1/archive", nil, 200},
+		{"DELETE /brain/{id}/archive", "DELETE", "/brain/1/archive", nil, 200},
+		{"POST /brain/{id}/summarize", "POST", "/brain/1/summarize", nil, 503},
+		{"GET /brain/{id}/pdf", "GET", "/brain/1/pdf", nil, 200},
+		{"POST /brain/{id}/send", "POST", "/brain/1/send", nil, 503},
+		{"POST /brain/{id}/share", "POST", "/brain/1/share", map[string]any{}, 201},
+		{"GET /brain/{id}/shares", "GET", "/brain/1/shares", nil, 200},
+		{"DELETE /shares/{id}", "DELETE", "/shares/1", nil, 204},
+		{"GET /s/{token}", "GET", "/s/not-a-token", nil, 404},
+		{"POST /brain/{id}/logs", "POST", "/brain/1/logs", map[string]any{"log_ids": []int64{1}}, 200},
+		{"GET /brain/{id}/logs", "GET", "/brain/1/logs", nil, 200},
+		{"DELETE /brain/{id}/logs/{log_id}", "DELETE", "/brain/1/logs/1", nil, 204},
+		{"POST /brain/{id}/issues", "POST", "/brain/1/issues", map[string]any{"provider": "jira", "key": "ENG-1"}, 201},
+		{"GET /brain/{id}/issues", "GET", "/brain/1/issues", nil, 200},
+		{"DELETE /brain/{id}/issues/{issue_id}", "DELETE", "/brain/1/issues/1", nil, 204},
+
+		{"GET /search", "GET", "/search?q=retry", nil, 200},
+		{"POST /ask", "POST", "/ask", map[string]any{"question": "what did I decide about retries?"}, 503},
+		{"POST /integrations/notion/export", "POST", "/integrations/notion/export", map[string]any{}, 503},
+		{"POST /integrations/git/daily", "POST", "/integrations/git/daily", map[string]any{}, 503},
+		{"POST /integrations/ci", "POST", "/integrations/ci", map[string]any{"pipeline": "build", "status": "success"}, 201},
+		{"POST /capture", "POST", "/capture", map[string]any{"title": "Clip", "text": "hello", "url": "https://example.com"}, 201},
+		{"GET /quick", "GET", "/quick?text=hello", nil, 201},
+		{"POST /quick", "POST", "/quick?text=hello", nil, 201},
+		{"POST /capture/url", "POST", "/capture/url", map[string]any{"url": "http://127.0.0.1:1/"}, 502},
+
+		{"GET /reminders", "GET", "/reminders", nil, 200},
+		{"GET /calendar.ics", "GET", "/calendar.ics", nil, 200},
+		{"DELETE /reminders/{id}", "DELETE", "/reminders/1", nil, 404},
+		{"POST /schedules", "POST", "/schedules", map[string]any{"name": "standup", "title": "Standup", "context": "Yesterday, today, blockers", "project": "sbrain", "frequency": "daily", "at": "09:00"}, 201},
+		{"GET /schedules", "GET", "/schedules", nil, 200},
+		{"POST /schedules/{id}/run", "POST", "/schedules/1/run", nil, 201},
+		{"DELETE /schedules/{id}", "DELETE", "/schedules/1", nil, 204},
+		{"POST /templates", "POST", "/templates", map[string]any{"name": "retro", "title": "Retro {{date}}", "context": "Went well", "project": "sbrain"}, 201},
+		{"GET /templates", "GET", "/templates", nil, 200},
+		{"GET /templates/{name}", "GET", "/templates/retro", nil, 200},
+		{"DELETE /templates/{name}", "DELETE", "/templates/retro", nil, 204},
+
+		{"POST /logs", "POST", "/logs", map[string]any{"level": "warn", "message": "slow query", "endpoint": "/api/search", "method": "GET", "status_code": 200, "response_time_ms": 700}, 201},
+		{"GET /logs", "GET", "/logs?level=error", nil, 200},
+		{"GET /logs/{id}", "GET", "/logs/1", nil, 200},
+		{"GET /logs/export", "GET", "/logs/export", nil, 200},
+		{"GET /logs/stats", "GET", "/logs/stats", nil, 200},
+		{"GET /logs/slow", "GET", "/logs/slow", nil, 200},
+		{"POST /logs/batch", "POST", "/logs/batch", []map[string]any{{"level": "info", "message": "shipped"}}, 200},
+		{"POST /logs/purge", "POST", "/logs/purge?level=debug", nil, 200},
+		{"DELETE /logs/{id}", "DELETE", "/logs/1", nil, 204},
+		{"POST /loki/api/v1/push", "POST", "/loki/api/v1/push", map[string]any{"streams": []any{map[string]any{"stream": map[string]string{"level": "info"}, "values": [][]string{{"1700000000000000000", "from loki"}}}}}, 204},
+		{"POST /v1/logs", "POST", "/v1/logs", map[string]any{"resourceLogs": []any{}}, 200},
+		{"GET /digest", "GET", "/digest", nil, 200},
+		{"GET /digest/weekly", "GET", "/digest/weekly", nil, 200},
+
+		{"GET /admin/digests/destinations", "GET", "/admin/digests/destinations", nil, 200},
+		{"POST /admin/digests/destinations", "POST", "/admin/digests/destinations", map[string]any{"kind": "bogus"}, 400},
+		{"POST /admin/digests/test", "POST", "/admin/digests/test", map[string]any{}, 200},
+		{"POST /admin/alerts/rules", "POST", "/admin/alerts/rules", map[string]any{"name": "errors", "level": "error", "threshold": 5, "window_minutes": 10, "channel": "webhook", "target": "https://example.com/hook"}, 201},
+		{"GET /admin/alerts/rules", "GET", "/admin/alerts/rules", nil, 200},
+		{"DELETE /admin/alerts/rules/{id}", "DELETE", "/admin/alerts/rules/1", nil, 204},
+		{"PUT /heartbeats/{name}", "PUT", "/heartbeats/nightly-backup", map[string]any{"interval_seconds": 86400}, 201},
+		{"POST /heartbeats/{name}", "POST", "/heartbeats/nightly-backup", nil, 200},
+		{"GET /heartbeats", "GET", "/heartbeats", nil, 200},
+		{"GET /heartbeats/{name}", "GET", "/heartbeats/nightly-backup", nil, 200},
+		{"DELETE /heartbeats/{name}", "DELETE", "/heartbeats/nightly-backup", nil, 204},
+		{"POST /monitors", "POST", "/monitors", map[string]any{"name": "api", "url": "http://127.0.0.1:1/healthz"}, 201},
+		{"GET /monitors", "GET", "/monitors", nil, 200},
+		{"GET /monitors/{id}", "GET", "/monitors/1", nil, 200},
+		{"PUT /monitors/{id}", "PUT", "/monitors/1", map[string]any{"interval_seconds": 300}, 200},
+		{"POST /monitors/{id}/check", "POST", "/monitors/1/check", nil, 200},
+		{"DELETE /monitors/{id}", "DELETE", "/monitors/1", nil, 204},
+		{"POST /slos", "POST", "/slos", map[string]any{"endpoint": "/api/orders", "max_error_rate": 0.01}, 201},
+		{"GET /slos", "GET", "/slos", nil, 200},
+		{"PUT /slos/{id}", "PUT", "/slos/1", map[string]any{"latency_threshold_ms": 300, "latency_objective": 0.99}, 200},
+		{"GET /slo/report", "GET", "/slo/report?window=7d", nil, 200},
+		{"DELETE /slos/{id}", "DELETE", "/slos/1", nil, 204},
+		{"GET /alerts", "GET", "/alerts", nil, 200},
+		{"POST /alerts/{id}/ack", "POST", "/alerts/99/ack", nil, 404},
+		{"POST /admin/scrub/rules", "POST", "/admin/scrub/rules", map[string]any{"name": "emails", "preset": "email"}, 201},
+		{"GET /admin/scrub/rules", "GET", "/admin/scrub/rules", nil, 200},
+		{"POST /admin/scrub/test", "POST", "/admin/scrub/test", map[string]any{"message": "mail ada@example.com"}, 200},
+		{"DELETE /admin/scrub/rules/{id}", "DELETE", "/admin/scrub/rules/1", nil, 204},
+		{"GET /admin/config", "GET", "/admin/config", nil, 200},
+		{"GET /admin/flags", "GET", "/admin/flags", nil, 200},
+		{"PUT /admin/flags/{name}", "PUT", "/admin/flags/webhooks", map[string]any{"enabled": false}, 200},
+		{"DELETE /admin/flags/{name}", "DELETE", "/admin/flags/webhooks", nil, 200},
+		{"GET /admin/maintenance", "GET", "/admin/maintenance", nil, 200},
+		{"POST /admin/maintenance", "POST", "/admin/maintenance", map[string]any{"reason": "test", "duration": "1m"}, 201},
+		{"DELETE /admin/maintenance", "DELETE", "/admin/maintenance", nil, 200},
+		{"POST /admin/db/vacuum", "POST", "/admin/db/vacuum", nil, 200},
+		{"POST /admin/db/integrity-check", "POST", "/admin/db/integrity-check", nil, 200},
+		{"POST /admin/db/analyze", "POST", "/admin/db/analyze", nil, 200},
+		{"GET /admin/db/explain", "GET", "/admin/db/explain", nil, 200},
+		{"POST /admin/seed", "POST", "/admin/seed", nil, 404},
+
+		{"GET /grafana/{$}", "GET", "/grafana/", nil, 200},
+		{"POST /grafana/search", "POST", "/grafana/search", map[string]any{}, 200},
+		{"POST /grafana/metrics", "POST", "/grafana/metrics", map[string]any{}, 200},
+		{"POST /grafana/query", "POST", "/grafana/query", map[string]any{
+			"range":   map[string]string{"from": "2020-01-01T00:00:00Z", "to": "2099-01-01T00:00:00Z"},
+			"targets": []any{map[string]string{"target": "requests"}},
+		}, 200},
+		{"POST /grafana/annotations", "POST", "/grafana/annotations", map[string]any{}, 200},
+		{"POST /grafana/tag-keys", "POST", "/grafana/tag-keys", map[string]any{}, 200},
+		{"POST /grafana/tag-values", "POST", "/grafana/tag-values", map[string]any{"key": "level"}, 200},
+
+		{"POST /integrations/slack/command", "POST", "/integrations/slack/command", "text=hi", 404},
+		{"POST /integrations/email/{provider}", "POST", "/integrations/email/generic", map[string]any{}, 404},
+		{"POST /integrations/git/webhook/{provider}", "POST", "/integrations/git/webhook/github", map[string]any{}, 404},
+		{"GET /attachments", "GET", "/attachments?brain_id=1", nil, 200},
+		{"GET /attachments/{id}", "GET", "/attachments/99", nil, 404},
+		{"GET /export/markdown", "GET", "/export/markdown", nil, 200},
+		{"GET /export/pdf", "GET", "/export/pdf", nil, 200},
+		{"GET /export/site", "GET", "/export/site", nil, 200},
+		{"POST /import/markdown", "POST", "/import/markdown", "not a zip", 400},
+		{"POST /import/readwise", "POST", "/import/readwise", map[string]any{"results": []any{}}, 200},
+		{"POST /import/pocket", "POST", "/import/pocket", "url,title\nhttps://example.com/a,A\n", 200},
+
+		{"GET /auth/login", "GET", "/auth/login", nil, 404},
+		{"GET /auth/callback", "GET", "/auth/callback", nil, 404},
+		{"/auth/logout", "POST", "/auth/logout", nil, 200},
+		{"POST /auth/token", "POST", "/auth/token", map[string]any{}, 404},
+
+		{"GET /audit", "GET", "/audit", nil, 200},
+		{"GET /sync", "GET", "/sync", nil, 200},
+		{"DELETE /brain/{id}", "DELETE", "/brain/2", nil, 204},
+		{"GET /trash", "GET", "/trash", nil, 200},
+		{"POST /trash/{id}/restore", "POST", "/trash/2/restore", nil, 200},
+	}
+
+	covered := map[string]bool{}
+	for _, c := range cases {
+		covered[c.pattern] = true
+	}
+	for v := apiV1; v <= latestAPIVersion; v++ {
+		for _, rt := range routesForVersion(ts.srv.routes(), ts.srv.versionedRoutes(), v) {
+			if !covered[rt.pattern] {
+				t.Errorf("route %q of v%d has no case in TestEveryRoute", rt.pattern, v)
+			}
+		}
+	}
+
+	for _, c := range cases {
+		rec := ts.do(request{method: c.method, path: c.path, body: c.body})
+		if rec.Code != c.status {
+			t.Errorf("%s %s: status = %d, want %d; body: %.300s", c.method, c.path, rec.Code, c.status, rec.Body)
+			continue
+		}
+		if rec.Code >= 400 && strings.HasPrefix(rec.Header().Get("Content-Type"), "application/json") {
+			var body map[string]APIError
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body["error"].Code == "" {
+				t.Errorf("%s %s: error body is not an APIError: %.300s", c.method, c.path, rec.Body)
+			}
+		}
+		if rec.Code != http.StatusNoContent && rec.Header().Get("Content-Type") == "" {
+			t.Errorf("%s %s: no Content-Type", c.method, c.path)
+		}
+	}
+}
+
+func TestRoutesForVersion(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request) {}
+	shared := []route{{"GET /a", h}, {"GET /b", h}, {"GET /c", h}}
+	changed := map[apiVersion][]route{
+		apiV2: {{"GET /b", nil}, {"GET /d", h}},
+	}
+	patterns := func(v apiVersion) string {
+		var out []string
+		for _, rt := range routesForVersion(shared, changed, v) {
+			out = append(out, rt.pattern)
+		}
+		return strings.Join(out, ",")
+	}
+	if got := patterns(apiV1); got != "GET /a,GET /b,GET /c" {
+		t.Fatalf("v1 = %s", got)
+	}
+	if got := patterns(apiV2); got != "GET /a,GET /c,GET /d" {
+		t.Fatalf("v2 = %s", got)
+	}
+	if len(shared) != 3 {
+		t.Fatalf("shared routes were modified: %v", shared)
+	}
+}
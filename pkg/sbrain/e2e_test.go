@@ -0,0 +1,291 @@
+package sbrain
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"strings"
+	"testing"
+
+	"sbrain/store"
+)
+
+// The end-to-end tests run requests through the whole handler stack (request
+// ids, maintenance gate, auth, routing) of a Server on a fresh in-memory
+// database, so every test starts from an empty, fully migrated schema and
+// nothing it writes outlives it.
+
+// Keys every test server accepts, one per scope.
+const (
+	adminKey   = "test-admin-key"
+	readKey    = "test-read-key"
+	writeKey   = "test-write-key"
+	logsKey    = "test-logs-key"
+	captureKey = "test-capture-key"
+	projectKey = "test-project-key"
+)
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	if !testing.Verbose() {
+		log.SetOutput(io.Discard)
+	}
+	os.Exit(m.Run())
+}
+
+// testServer is a Server under test with helpers for calling it.
+type testServer struct {
+	t   *testing.T
+	srv *Server
+}
+
+// newTestServer starts a Server on a new in-memory database. Every SBRAIN_*
+// variable of the environment is cleared for the test; env sets others, as
+// "NAME=value" pairs, before the server reads them.
+func newTestServer(t *testing.T, env ...string) *testServer {
+	t.Helper()
+	for _, kv := range os.Environ() {
+		if name, _, _ := strings.Cut(kv, "="); strings.HasPrefix(name, "SBRAIN_") {
+			t.Setenv(name, "")
+		}
+	}
+	t.Setenv("SBRAIN_API_KEYS", strings.Join([]string{
+		"admin:" + adminKey + ":admin",
+		"reader:" + readKey + ":read",
+		"writer:" + writeKey + ":read+write",
+		"shipper:" + logsKey + ":logs-only",
+		"clipper:" + captureKey + ":capture",
+		"team:" + projectKey + ":read+write:team",
+	}, ","))
+	for _, kv := range env {
+		name, value, _ := strings.Cut(kv, "=")
+		t.Setenv(name, value)
+	}
+	srv, err := New(Options{DBPath: MemoryDB})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	return &testServer{t: t, srv: srv}
+}
+
+// request is one call to the test server. Body is sent as it is when it is
+// a string or []byte and as JSON otherwise.
+type request struct {
+	method string
+	path   string
+	body   any
+	key    string
+	header map[string]string
+}
+
+// do sends req with the admin key unless it names another; key "-" sends no
+// credentials.
+func (ts *testServer) do(req request) *httptest.ResponseRecorder {
+	ts.t.Helper()
+	var body io.Reader
+	switch b := req.body.(type) {
+	case nil:
+	case string:
+		body = strings.NewReader(b)
+	case []byte:
+		body = bytes.NewReader(b)
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			ts.t.Fatalf("encode body: %v", err)
+		}
+		body = bytes.NewReader(data)
+	}
+	r := httptest.NewRequest(req.method, req.path, body)
+	switch req.key {
+	case "":
+		r.Header.Set("Authorization", "Bearer "+adminKey)
+	case "-":
+	default:
+		r.Header.Set("Authorization", "Bearer "+req.key)
+	}
+	if req.body != nil {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	for name, value := range req.header {
+		r.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+	ts.srv.ServeHTTP(rec, r)
+	return rec
+}
+
+func (ts *testServer) get(path string) *httptest.ResponseRecorder {
+	ts.t.Helper()
+	return ts.do(request{method: http.MethodGet, path: path})
+}
+
+func (ts *testServer) post(path string, body any) *httptest.ResponseRecorder {
+	ts.t.Helper()
+	return ts.do(request{method: http.MethodPost, path: path, body: body})
+}
+
+// expect fails the test unless rec has status, showing the body when not.
+func expect(t *testing.T, rec *httptest.ResponseRecorder, status int) {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("status = %d, want %d; body: %s", rec.Code, status, rec.Body)
+	}
+}
+
+// decode expects status and decodes the JSON body into a T.
+func decode[T any](t *testing.T, rec *httptest.ResponseRecorder, status int) T {
+	t.Helper()
+	expect(t, rec, status)
+	var v T
+	if err := json.Unmarshal(rec.Body.Bytes(), &v); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body, err)
+	}
+	return v
+}
+
+// expectError checks that rec is an APIError with status and code, and
+// returns it.
+func expectError(t *testing.T, rec *httptest.ResponseRecorder, status int, code string) APIError {
+	t.Helper()
+	body := decode[map[string]APIError](t, rec, status)
+	apiErr, ok := body["error"]
+	if !ok {
+		t.Fatalf("body has no error: %s", rec.Body)
+	}
+	if apiErr.Code != code {
+		t.Fatalf("error code = %q, want %q; body: %s", apiErr.Code, code, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("error Content-Type = %q, want application/json", ct)
+	}
+	if apiErr.RequestID == "" || apiErr.RequestID != rec.Header().Get("X-Request-ID") {
+		t.Fatalf("error request_id = %q, X-Request-ID = %q", apiErr.RequestID, rec.Header().Get("X-Request-ID"))
+	}
+	return apiErr
+}
+
+// expectFields checks that rec is a validation error naming exactly fields.
+func expectFields(t *testing.T, rec *httptest.ResponseRecorder, fields ...string) {
+	t.Helper()
+	apiErr := expectError(t, rec, http.StatusBadRequest, "validation_failed")
+	var got []string
+	for _, f := range apiErr.Fields {
+		got = append(got, f.Field)
+	}
+	if strings.Join(got, ",") != strings.Join(fields, ",") {
+		t.Fatalf("invalid fields = %v, want %v", got, fields)
+	}
+}
+
+// Fixtures are written through the stores rather than the API, so a test's
+// setup cannot fail on the behavior it is testing.
+
+func (ts *testServer) brain(b brain) brain {
+	ts.t.Helper()
+	if b.Title == "" {
+		b.Title = "Retry idea"
+	}
+	if b.Context == "" {
+		b.Context = "Back off on 429s with jitter"
+	}
+	if b.Project == "" {
+		b.Project = "sbrain"
+	}
+	created, err := ts.srv.Brains().CreateBrain(context.Background(), b)
+	if err != nil {
+		ts.t.Fatalf("create brain fixture: %v", err)
+	}
+	return created
+}
+
+func (ts *testServer) log(l logEntry) logEntry {
+	ts.t.Helper()
+	if l.Level == "" {
+		l.Level = "info"
+	}
+	if l.Message == "" {
+		l.Message = "request served"
+	}
+	id, err := ts.srv.Logs().CreateLog(context.Background(), l)
+	if err != nil {
+		ts.t.Fatalf("create log fixture: %v", err)
+	}
+	created, err := ts.srv.Logs().GetLog(context.Background(), id)
+	if err != nil {
+		ts.t.Fatalf("load log fixture: %v", err)
+	}
+	return created
+}
+
+func intPtr(n int) *int { return &n }
+
+// ids returns the ids of records, in order.
+func ids[T interface{ brain | logEntry }](records []T) []int64 {
+	out := make([]int64, 0, len(records))
+	for _, r := range records {
+		switch r := any(r).(type) {
+		case store.Brain:
+			out = append(out, r.ID)
+		case store.Log:
+			out = append(out, r.ID)
+		}
+	}
+	return out
+}
+
+// fakeSMTP accepts mail on a local port, for SBRAIN_SMTP_ADDR, and hands
+// each message's headers and body to the returned channel.
+func fakeSMTP(t *testing.T) (addr string, messages <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	out := make(chan string, 8)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				tp := textproto.NewConn(conn)
+				tp.PrintfLine("220 fake ESMTP")
+				for {
+					line, err := tp.ReadLine()
+					if err != nil {
+						return
+					}
+					switch verb, _, _ := strings.Cut(strings.ToUpper(line), " "); verb {
+					case "DATA":
+						tp.PrintfLine("354 go ahead")
+						data, err := tp.ReadDotBytes()
+						if err != nil {
+							return
+						}
+						out <- string(data)
+						tp.PrintfLine("250 queued")
+					case "QUIT":
+						tp.PrintfLine("221 bye")
+						return
+					default:
+						tp.PrintfLine("250 ok")
+					}
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String(), out
+}
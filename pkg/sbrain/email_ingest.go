@@ -0,0 +1,268 @@
+package sbrain
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"sbrain/store"
+)
+
+// maxInboundEmailBytes bounds the size of an inbound email webhook,
+// attachments included.
+const maxInboundEmailBytes = 32 << 20
+
+type inboundEmail struct {
+	From        string
+	Subject     string
+	Text        string
+	HTML        string
+	Attachments []inboundAttachment
+}
+
+type inboundAttachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+var htmlTagPattern = regexp.MustCompile(`(?s)<[^>]*>`)
+
+// emailIngestHandler accepts inbound-email webhooks at
+// /integrations/email/{mailgun|sendgrid|postmark}?token=... and stores each
+// email as a brain record with its attachments.
+func (s *Server) emailIngestHandler(w http.ResponseWriter, r *http.Request) {
+	expected := os.Getenv("SBRAIN_EMAIL_INBOUND_TOKEN")
+	if expected == "" {
+		writeError(w, r, http.StatusNotFound, "email ingestion is not configured")
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(r.URL.Query().Get("token")), []byte(expected)) != 1 {
+		writeError(w, r, http.StatusUnauthorized, "invalid token")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxInboundEmailBytes)
+
+	var email inboundEmail
+	var err error
+	switch provider := r.PathValue("provider"); provider {
+	case "mailgun":
+		email, err = parseMailgunEmail(r)
+	case "sendgrid":
+		email, err = parseSendGridEmail(r)
+	case "postmark":
+		email, err = parsePostmarkEmail(r)
+	default:
+		writeError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx := withActor(r.Context(), "email:"+email.From)
+	b, attachments, err := s.storeInboundEmail(ctx, email)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.recordAudit(ctx, auditCreate, "brain", b.ID, nil, b)
+	for _, a := range attachments {
+		s.recordAudit(ctx, auditCreate, "attachment", a.ID, nil, a)
+	}
+
+	writeJSONStatus(w, http.StatusCreated, map[string]any{
+		"brain":       b,
+		"attachments": attachments,
+	})
+}
+
+// storeInboundEmail stores an email's brain and attachments in one
+// transaction, so a failure leaves no half-ingested record for the
+// provider's retry to duplicate.
+func (s *Server) storeInboundEmail(ctx context.Context, email inboundEmail) (brain, []attachment, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return brain{}, nil, fmt.Errorf("begin email ingest: %w", err)
+	}
+	defer tx.Rollback()
+
+	req := emailToBrain(email)
+	res, err := tx.ExecContext(ctx, `INSERT INTO second_brain (title, context, project, tags, updated_at)
+		VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)`, req.Title, req.Context, req.Project, req.Tags)
+	if err != nil {
+		return brain{}, nil, fmt.Errorf("insert brain: %w", err)
+	}
+	id, _ := res.LastInsertId()
+	var b brain
+	if err := tx.QueryRowContext(ctx, `SELECT `+store.BrainColumns+` FROM second_brain WHERE id = ?`, id).Scan(b.Fields()...); err != nil {
+		return brain{}, nil, fmt.Errorf("load brain: %w", err)
+	}
+
+	attachments := []attachment{}
+	for _, a := range email.Attachments {
+		stored, err := writeAttachment(ctx, tx, b.ID, a.Filename, a.ContentType, a.Data)
+		if err != nil {
+			return brain{}, nil, err
+		}
+		attachments = append(attachments, stored)
+	}
+	if err := tx.Commit(); err != nil {
+		return brain{}, nil, fmt.Errorf("commit email ingest: %w", err)
+	}
+	return b, attachments, nil
+}
+
+func emailToBrain(email inboundEmail) brain {
+	project := os.Getenv("SBRAIN_EMAIL_DEFAULT_PROJECT")
+	if project == "" {
+		project = "inbox"
+	}
+
+	title := strings.TrimSpace(email.Subject)
+	if title == "" {
+		title = "(no subject)"
+	}
+
+	body := strings.TrimSpace(email.Text)
+	if body == "" && email.HTML != "" {
+		body = strings.TrimSpace(html.UnescapeString(htmlTagPattern.ReplaceAllString(email.HTML, "")))
+	}
+
+	context := body
+	if email.From != "" {
+		context = "From: " + email.From + "\n\n" + body
+	}
+	if strings.TrimSpace(context) == "" {
+		context = title
+	}
+
+	return brain{Title: title, Context: context, Project: project, Tags: "email"}
+}
+
+// parseFormEmail reads the multipart (or urlencoded) form shared by the
+// Mailgun and SendGrid webhooks; every uploaded file is an attachment.
+func parseFormEmail(r *http.Request, textField string, htmlField string) (inboundEmail, error) {
+	if err := r.ParseMultipartForm(maxInboundEmailBytes); err != nil {
+		if !errors.Is(err, http.ErrNotMultipart) {
+			return inboundEmail{}, fmt.Errorf("parse form: %v", err)
+		}
+		if err := r.ParseForm(); err != nil {
+			return inboundEmail{}, fmt.Errorf("parse form: %v", err)
+		}
+	}
+
+	email := inboundEmail{
+		From:    r.FormValue("from"),
+		Subject: r.FormValue("subject"),
+		Text:    r.FormValue(textField),
+		HTML:    r.FormValue(htmlField),
+	}
+	if r.MultipartForm == nil {
+		return email, nil
+	}
+
+	fields := make([]string, 0, len(r.MultipartForm.File))
+	for field := range r.MultipartForm.File {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		for _, header := range r.MultipartForm.File[field] {
+			f, err := header.Open()
+			if err != nil {
+				return inboundEmail{}, fmt.Errorf("open attachment %q: %v", header.Filename, err)
+			}
+			data, err := io.ReadAll(f)
+			f.Close()
+			if err != nil {
+				return inboundEmail{}, fmt.Errorf("read attachment %q: %v", header.Filename, err)
+			}
+			email.Attachments = append(email.Attachments, inboundAttachment{
+				Filename:    header.Filename,
+				ContentType: header.Header.Get("Content-Type"),
+				Data:        data,
+			})
+		}
+	}
+	return email, nil
+}
+
+// parseMailgunEmail handles Mailgun's routes "forward" action. When
+// SBRAIN_MAILGUN_SIGNING_KEY is set the webhook signature is verified too.
+func parseMailgunEmail(r *http.Request) (inboundEmail, error) {
+	email, err := parseFormEmail(r, "body-plain", "body-html")
+	if err != nil {
+		return email, err
+	}
+
+	if key := os.Getenv("SBRAIN_MAILGUN_SIGNING_KEY"); key != "" {
+		mac := hmac.New(sha256.New, []byte(key))
+		mac.Write([]byte(r.FormValue("timestamp") + r.FormValue("token")))
+		expected := hex.EncodeToString(mac.Sum(nil))
+		if !hmac.Equal([]byte(expected), []byte(r.FormValue("signature"))) {
+			return email, errors.New("invalid mailgun signature")
+		}
+	}
+	if email.From == "" {
+		email.From = r.FormValue("sender")
+	}
+	return email, nil
+}
+
+// parseSendGridEmail handles SendGrid's Inbound Parse webhook.
+func parseSendGridEmail(r *http.Request) (inboundEmail, error) {
+	return parseFormEmail(r, "text", "html")
+}
+
+// parsePostmarkEmail handles Postmark's JSON inbound webhook.
+func parsePostmarkEmail(r *http.Request) (inboundEmail, error) {
+	var payload struct {
+		From        string `json:"From"`
+		Subject     string `json:"Subject"`
+		TextBody    string `json:"TextBody"`
+		HtmlBody    string `json:"HtmlBody"`
+		Attachments []struct {
+			Name        string `json:"Name"`
+			Content     string `json:"Content"`
+			ContentType string `json:"ContentType"`
+		} `json:"Attachments"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		return inboundEmail{}, fmt.Errorf("decode body: %v", err)
+	}
+
+	email := inboundEmail{
+		From:    payload.From,
+		Subject: payload.Subject,
+		Text:    payload.TextBody,
+		HTML:    payload.HtmlBody,
+	}
+	for _, a := range payload.Attachments {
+		data, err := base64.StdEncoding.DecodeString(a.Content)
+		if err != nil {
+			return inboundEmail{}, fmt.Errorf("decode attachment %q: %v", a.Name, err)
+		}
+		email.Attachments = append(email.Attachments, inboundAttachment{
+			Filename:    a.Name,
+			ContentType: a.ContentType,
+			Data:        data,
+		})
+	}
+	return email, nil
+}
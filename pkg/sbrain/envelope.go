@@ -0,0 +1,186 @@
+package sbrain
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envelopeMediaType is the vendor media type that asks for enveloped
+// responses, as an alternative to ?envelope=true.
+const envelopeMediaType = "application/vnd.sbrain+json"
+
+// envelopeMeta is the metadata an enveloped response carries next to its
+// data (or error).
+type envelopeMeta struct {
+	RequestID  string      `json:"request_id"`
+	TookMS     float64     `json:"took_ms"`
+	Pagination *pagination `json:"pagination,omitempty"`
+}
+
+// pagination describes a list response. Count is filled in for every JSON
+// array; handlers that cap their results with a limit report it with
+// setPagination so clients can tell a full page from the end.
+type pagination struct {
+	Count   int    `json:"count"`
+	Limit   int    `json:"limit,omitempty"`
+	HasMore bool   `json:"has_more"`
+	Cursor  string `json:"cursor,omitempty"`
+}
+
+type envelopeContextKey struct{}
+
+// setPagination records pagination details for the envelope, when the
+// request asked for one. Count is taken from the response itself.
+func setPagination(ctx context.Context, p pagination) {
+	if meta, ok := ctx.Value(envelopeContextKey{}).(*envelopeMeta); ok {
+		meta.Pagination = &p
+	}
+}
+
+// wantsEnvelope reports whether r gets an enveloped response: because it
+// asked, or because v2 always envelopes. contentType is the media type the
+// response is labelled with when the request asked for a vendor one, and
+// empty to keep application/json.
+func wantsEnvelope(r *http.Request) (want bool, contentType string) {
+	if accepts(r, envelopeMediaType) {
+		return true, envelopeMediaType
+	}
+	if v := apiVersionFrom(r.Context()); v >= apiV2 {
+		if accepts(r, apiVersionMediaType(v)) {
+			return true, apiVersionMediaType(v)
+		}
+		return true, ""
+	}
+	on, _ := strconv.ParseBool(r.URL.Query().Get("envelope"))
+	return on, ""
+}
+
+// envelopeMiddleware wraps JSON responses in {"data": ..., "meta": ...} (or
+// {"error": ..., "meta": ...}) for clients that opt in, leaving the bare
+// arrays and objects everyone else gets alone. Responses that are not JSON,
+// such as NDJSON streams, CSV and HTML, pass through unchanged.
+func envelopeMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		want, contentType := wantsEnvelope(r)
+		w.Header().Add("Vary", "Accept")
+		if !want {
+			next.ServeHTTP(w, r)
+			return
+		}
+		meta := &envelopeMeta{RequestID: requestIDFromContext(r.Context())}
+		ew := &envelopeWriter{
+			ResponseWriter: w,
+			meta:           meta,
+			contentType:    contentType,
+			strictErrors:   apiVersionFrom(r.Context()) >= apiV2,
+			started:        time.Now(),
+		}
+		next.ServeHTTP(ew, r.WithContext(context.WithValue(r.Context(), envelopeContextKey{}, meta)))
+		ew.finish()
+	})
+}
+
+// envelopeWriter holds back a JSON response until the handler returns so it
+// can be wrapped; anything else is written straight through.
+type envelopeWriter struct {
+	http.ResponseWriter
+	meta        *envelopeMeta
+	contentType string
+	// strictErrors turns error responses that are not an APIError, such as
+	// plain-text ones, into one, as v2 promises.
+	strictErrors bool
+	started      time.Time
+
+	status    int
+	buffering bool
+	buf       bytes.Buffer
+}
+
+func (e *envelopeWriter) WriteHeader(status int) {
+	if e.status != 0 {
+		return
+	}
+	e.status = status
+	mediaType, _, _ := mime.ParseMediaType(e.Header().Get("Content-Type"))
+	isJSON := mediaType == "application/json"
+	if (isJSON || e.strictErrors && status >= http.StatusBadRequest) && status != http.StatusNoContent && status != http.StatusNotModified {
+		e.buffering = true
+		return
+	}
+	e.ResponseWriter.WriteHeader(status)
+}
+
+func (e *envelopeWriter) Write(b []byte) (int, error) {
+	if e.status == 0 {
+		e.WriteHeader(http.StatusOK)
+	}
+	if e.buffering {
+		return e.buf.Write(b)
+	}
+	return e.ResponseWriter.Write(b)
+}
+
+func (e *envelopeWriter) Unwrap() http.ResponseWriter { return e.ResponseWriter }
+
+func (e *envelopeWriter) Flush() {
+	if e.buffering {
+		return
+	}
+	if f, ok := e.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (e *envelopeWriter) finish() {
+	if !e.buffering {
+		return
+	}
+	body := bytes.TrimSpace(e.buf.Bytes())
+	e.meta.TookMS = float64(time.Since(e.started).Microseconds()) / 1000
+
+	var envelope map[string]any
+	if e.status >= http.StatusBadRequest {
+		// Errors are already {"error": ...}; the envelope adds meta beside it.
+		var apiErr map[string]json.RawMessage
+		if json.Unmarshal(body, &apiErr) == nil && apiErr["error"] != nil {
+			envelope = map[string]any{"error": apiErr["error"], "meta": e.meta}
+		} else if e.strictErrors {
+			message := strings.TrimSpace(string(body))
+			if message == "" {
+				message = strings.ToLower(http.StatusText(e.status))
+			}
+			envelope = map[string]any{
+				"error": APIError{Code: errorCode(e.status), Message: message, RequestID: e.meta.RequestID},
+				"meta":  e.meta,
+			}
+			e.Header().Set("Content-Type", "application/json")
+		}
+	} else if json.Valid(body) {
+		var items []json.RawMessage
+		if json.Unmarshal(body, &items) == nil {
+			if e.meta.Pagination == nil {
+				e.meta.Pagination = &pagination{}
+			}
+			e.meta.Pagination.Count = len(items)
+		}
+		envelope = map[string]any{"data": json.RawMessage(body), "meta": e.meta}
+	}
+	out, err := json.Marshal(envelope)
+	if envelope == nil || err != nil {
+		e.ResponseWriter.WriteHeader(e.status)
+		e.ResponseWriter.Write(e.buf.Bytes())
+		return
+	}
+	if e.contentType != "" {
+		e.Header().Set("Content-Type", e.contentType)
+	}
+	e.Header().Del("Content-Length")
+	e.ResponseWriter.WriteHeader(e.status)
+	e.ResponseWriter.Write(append(out, '\n'))
+}
@@ -0,0 +1,174 @@
+package sbrain
+
+import (
+	"context"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	errorForwardQueue    = 1000
+	errorForwardBatch    = 50
+	errorForwardInterval = 5 * time.Second
+)
+
+// errorForwarder relays error logs stored by POST /logs to Sentry and/or a
+// webhook, so sbrain can stay the system of record while an alerting stack
+// hears about errors. Logs are queued as they are stored and sent in batches
+// in the background; when the queue is full, because the destination is
+// down or slow, new ones are dropped and counted rather than holding up
+// ingestion.
+//
+//   - SBRAIN_SENTRY_DSN: send each log as a Sentry event
+//   - SBRAIN_ERROR_WEBHOOK_URL: POST each batch as {"logs": [...]}
+//   - SBRAIN_ERROR_FORWARD_LEVELS: the levels forwarded (default "error,fatal")
+type errorForwarder struct {
+	sentry  *sentryClient
+	webhook string
+	levels  map[string]bool
+	// webhooksEnabled reports whether the webhooks flag is on.
+	webhooksEnabled func() bool
+
+	queue    chan logEntry
+	dropped  atomic.Int64
+	interval time.Duration
+}
+
+// loadErrorForwarder returns nil when there is nowhere to forward to.
+func loadErrorForwarder(sentry *sentryClient, webhooksEnabled func() bool) *errorForwarder {
+	webhook := strings.TrimSpace(os.Getenv("SBRAIN_ERROR_WEBHOOK_URL"))
+	if sentry == nil && webhook == "" {
+		return nil
+	}
+	levels := map[string]bool{}
+	for _, level := range strings.Split(os.Getenv("SBRAIN_ERROR_FORWARD_LEVELS"), ",") {
+		if level = strings.ToLower(strings.TrimSpace(level)); level != "" {
+			levels[level] = true
+		}
+	}
+	if len(levels) == 0 {
+		levels = map[string]bool{"error": true, "fatal": true}
+	}
+	return &errorForwarder{
+		sentry:          sentry,
+		webhook:         webhook,
+		levels:          levels,
+		webhooksEnabled: webhooksEnabled,
+		queue:           make(chan logEntry, errorForwardQueue),
+		interval:        errorForwardInterval,
+	}
+}
+
+// describe reports where error logs are forwarded, for /admin/config.
+func (f *errorForwarder) describe() map[string]any {
+	if f == nil {
+		return map[string]any{"enabled": false}
+	}
+	levels := make([]string, 0, len(f.levels))
+	for level := range f.levels {
+		levels = append(levels, level)
+	}
+	sort.Strings(levels)
+	return map[string]any{"enabled": true, "sentry": f.sentry != nil, "webhook": f.webhook != "", "levels": levels, "queued": len(f.queue)}
+}
+
+// enqueue queues l when its level is forwarded. It never blocks.
+func (f *errorForwarder) enqueue(l logEntry) {
+	if f == nil || !f.levels[l.Level] {
+		return
+	}
+	select {
+	case f.queue <- l:
+	default:
+		f.dropped.Add(1)
+	}
+}
+
+// run sends queued logs in batches of up to errorForwardBatch, at least
+// every interval while any are waiting.
+func (f *errorForwarder) run(ctx context.Context) {
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+	var batch []logEntry
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case l := <-f.queue:
+			batch = append(batch, l)
+			if len(batch) < errorForwardBatch {
+				continue
+			}
+		case <-ticker.C:
+			if n := f.dropped.Swap(0); n > 0 {
+				log.Printf("warning: error forwarding queue full, dropped %d logs", n)
+			}
+			if len(batch) == 0 {
+				continue
+			}
+		}
+		f.send(batch)
+		batch = nil
+	}
+}
+
+// send delivers one batch. Failures are logged; the batch is not retried.
+func (f *errorForwarder) send(batch []logEntry) {
+	if f.webhook != "" && f.webhooksEnabled() {
+		if err := postJSONWebhook(f.webhook, map[string]any{"source": "sbrain", "logs": batch}); err != nil {
+			log.Printf("warning: forward %d error logs: %v", len(batch), err)
+		}
+	}
+	if f.sentry == nil {
+		return
+	}
+	// Sentry takes one event per envelope.
+	for _, l := range batch {
+		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		err := f.sentry.send(ctx, sentryEventForLog(l))
+		cancel()
+		if err != nil {
+			log.Printf("warning: forward log %d: %v", l.ID, err)
+		}
+	}
+}
+
+// sentryEventForLog turns a stored log into a Sentry event, with its
+// request details as tags so Sentry can group and search on them.
+func sentryEventForLog(l logEntry) sentryEvent {
+	event := newSentryEvent(l.Level, l.Message)
+	if t, ok := l.OccurredAt.Time(); ok {
+		event.Timestamp = t.UTC().Format(time.RFC3339Nano)
+	}
+	event.Logger = "sbrain.logs"
+	event.Tags = map[string]string{"log_id": strconv.FormatInt(l.ID, 10)}
+	for name, value := range map[string]string{"endpoint": l.Endpoint, "method": l.Method, "request_id": l.RequestID, "project": l.Project} {
+		if value != "" {
+			event.Tags[name] = value
+		}
+	}
+	if l.StatusCode != nil {
+		event.Tags["status_code"] = strconv.Itoa(*l.StatusCode)
+	}
+	if l.Endpoint != "" {
+		event.Request = &sentryRequest{URL: l.Endpoint, Method: l.Method}
+		if l.UserAgent != "" {
+			event.Request.Headers = map[string]string{"User-Agent": l.UserAgent}
+		}
+	}
+	if l.Metadata != "" {
+		event.Extra = map[string]any{"metadata": l.Metadata}
+	}
+	if l.Count > 1 {
+		if event.Extra == nil {
+			event.Extra = map[string]any{}
+		}
+		event.Extra["count"] = l.Count
+	}
+	return event
+}
@@ -0,0 +1,312 @@
+package sbrain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"sbrain/store"
+)
+
+// Feature flags gate experimental subsystems so they can ship dark and be
+// turned on or off without a redeploy.
+const (
+	featureLLM      = "llm"
+	featureWebhooks = "webhooks"
+	featureUI       = "ui"
+	featureSeed     = "seed"
+)
+
+// featureFlagDef is a flag the server knows. A new experimental subsystem
+// registers one with Default false so it ships dark.
+type featureFlagDef struct {
+	Name        string
+	Description string
+	Default     bool
+}
+
+var featureFlagDefs = []featureFlagDef{
+	{featureLLM, "Summaries and questions answered by the configured LLM", true},
+	{featureWebhooks, "Outbound webhooks for reminders, alert rules and error forwarding", true},
+	{featureUI, "The browser pages: the landing page at /, /docs and shared records at /s/{token}", true},
+	{featureSeed, "POST /admin/seed, which fills the database with fake data for development", false},
+}
+
+func featureFlagDefFor(name string) (featureFlagDef, bool) {
+	for _, def := range featureFlagDefs {
+		if def.Name == name {
+			return def, true
+		}
+	}
+	return featureFlagDef{}, false
+}
+
+// featureFlag is a flag as /admin/flags reports it: where each layer
+// stands and the outcome. An override set through the API wins over
+// SBRAIN_FLAGS, which wins over the default.
+type featureFlag struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Default     bool      `json:"default"`
+	Env         *bool     `json:"env"`
+	Override    *bool     `json:"override"`
+	UpdatedAt   timestamp `json:"updated_at,omitempty"`
+	Enabled     bool      `json:"enabled"`
+}
+
+// featureFlags holds the SBRAIN_FLAGS settings and the overrides loaded from
+// the feature_flags table.
+type featureFlags struct {
+	mu        sync.RWMutex
+	env       map[string]bool
+	overrides map[string]featureOverride
+}
+
+type featureOverride struct {
+	id        int64
+	enabled   bool
+	updatedAt timestamp
+}
+
+// loadFeatureFlagEnv reads SBRAIN_FLAGS, comma-separated name=true or
+// name=false settings (a bare name turns the flag on), such as
+// "webhooks=false,ui".
+func loadFeatureFlagEnv() (map[string]bool, error) {
+	env := map[string]bool{}
+	for _, setting := range strings.Split(os.Getenv("SBRAIN_FLAGS"), ",") {
+		setting = strings.TrimSpace(setting)
+		if setting == "" {
+			continue
+		}
+		name, raw, hasValue := strings.Cut(setting, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := featureFlagDefFor(name); !ok {
+			return nil, fmt.Errorf("invalid SBRAIN_FLAGS setting %q: unknown flag %q", setting, name)
+		}
+		on := true
+		if hasValue {
+			var err error
+			if on, err = strconv.ParseBool(strings.TrimSpace(raw)); err != nil {
+				return nil, fmt.Errorf("invalid SBRAIN_FLAGS setting %q: expected name=true or name=false", setting)
+			}
+		}
+		env[name] = on
+	}
+	return env, nil
+}
+
+// reloadFeatureFlags reads the overrides from the database. It runs after a
+// change has been saved, so it does not stop when the request is cancelled.
+func (s *Server) reloadFeatureFlags() error {
+	rows, err := s.db.QueryContext(context.Background(), `SELECT id, name, enabled, updated_at FROM feature_flags`)
+	if err != nil {
+		return fmt.Errorf("query feature flags: %w", err)
+	}
+	defer rows.Close()
+	overrides := map[string]featureOverride{}
+	for rows.Next() {
+		var name string
+		var o featureOverride
+		if err := rows.Scan(&o.id, &name, &o.enabled, &o.updatedAt); err != nil {
+			return fmt.Errorf("scan feature flag: %w", err)
+		}
+		overrides[name] = o
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterate feature flags: %w", err)
+	}
+	s.features.mu.Lock()
+	s.features.overrides = overrides
+	s.features.mu.Unlock()
+	return nil
+}
+
+// enabled reports whether the named flag is on.
+func (f *featureFlags) enabled(name string) bool {
+	return f.get(name).Enabled
+}
+
+func (f *featureFlags) get(name string) featureFlag {
+	def, _ := featureFlagDefFor(name)
+	flag := featureFlag{Name: def.Name, Description: def.Description, Default: def.Default, Enabled: def.Default}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if on, ok := f.env[name]; ok {
+		flag.Env, flag.Enabled = &on, on
+	}
+	if o, ok := f.overrides[name]; ok {
+		on := o.enabled
+		flag.Override, flag.Enabled, flag.UpdatedAt = &on, on, o.updatedAt
+	}
+	return flag
+}
+
+func (f *featureFlags) all() []featureFlag {
+	flags := make([]featureFlag, 0, len(featureFlagDefs))
+	for _, def := range featureFlagDefs {
+		flags = append(flags, f.get(def.Name))
+	}
+	return flags
+}
+
+// featureGated answers 404 in place of h while the named flag is off, so a
+// dark feature looks absent.
+func (s *Server) featureGated(name string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.features.enabled(name) {
+			writeError(w, r, http.StatusNotFound, fmt.Sprintf("not found: turned off by the %s feature flag", name))
+			return
+		}
+		h(w, r)
+	}
+}
+
+// errWebhooksOff is the delivery error of webhooks skipped while the
+// webhooks flag is off.
+var errWebhooksOff = errors.New("webhooks are turned off by the webhooks feature flag")
+
+func (s *Server) listFeatureFlags(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.features.all())
+}
+
+// setFeatureFlag serves PUT /admin/flags/{name}: {"enabled": bool} sets an
+// override that takes effect at once and survives restarts.
+func (s *Server) setFeatureFlag(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if _, ok := featureFlagDefFor(name); !ok {
+		writeError(w, r, http.StatusNotFound, fmt.Sprintf("unknown feature flag %q", name))
+		return
+	}
+	var req struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("decode body: %v", err))
+		return
+	}
+	if req.Enabled == nil {
+		writeValidationError(w, r, []FieldError{{Field: "enabled", Message: "is required"}})
+		return
+	}
+
+	before := s.features.get(name)
+	if _, err := s.db.ExecContext(r.Context(), `INSERT INTO feature_flags (name, enabled, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET enabled = excluded.enabled, updated_at = excluded.updated_at`,
+		name, *req.Enabled, store.NewTimestamp(time.Now())); err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("save feature flag: %v", err))
+		return
+	}
+	if err := s.reloadFeatureFlags(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	after := s.features.get(name)
+	s.recordAudit(r.Context(), auditUpdate, "feature_flag", s.features.overrideID(name), before, after)
+	writeJSON(w, http.StatusOK, after)
+}
+
+// clearFeatureFlag serves DELETE /admin/flags/{name}, dropping the override
+// so the flag follows SBRAIN_FLAGS or its default again.
+func (s *Server) clearFeatureFlag(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if _, ok := featureFlagDefFor(name); !ok {
+		writeError(w, r, http.StatusNotFound, fmt.Sprintf("unknown feature flag %q", name))
+		return
+	}
+	before := s.features.get(name)
+	id := s.features.overrideID(name)
+	res, err := s.db.ExecContext(r.Context(), `DELETE FROM feature_flags WHERE name = ?`, name)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("delete feature flag: %v", err))
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		writeError(w, r, http.StatusNotFound, fmt.Sprintf("feature flag %q has no override", name))
+		return
+	}
+	if err := s.reloadFeatureFlags(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	after := s.features.get(name)
+	s.recordAudit(r.Context(), auditUpdate, "feature_flag", id, before, after)
+	writeJSON(w, http.StatusOK, after)
+}
+
+func (f *featureFlags) overrideID(name string) int64 {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.overrides[name].id
+}
+
+// featureFlagListSpec documents GET /admin/flags in the OpenAPI spec.
+func featureFlagListSpec() map[string]any {
+	return map[string]any{
+		"get": map[string]any{
+			"summary":     "List the feature flags with their default, SBRAIN_FLAGS setting, override and outcome",
+			"operationId": "listFeatureFlags",
+			"responses": map[string]any{
+				"200": map[string]any{
+					"description": "The flags",
+					"content": map[string]any{"application/json": map[string]any{"schema": map[string]any{
+						"type": "array", "items": map[string]any{"$ref": "#/components/schemas/FeatureFlag"},
+					}}},
+				},
+			},
+		},
+	}
+}
+
+// featureFlagSpec documents PUT and DELETE /admin/flags/{name} in the
+// OpenAPI spec.
+func featureFlagSpec() map[string]any {
+	flag := map[string]any{"application/json": map[string]any{"schema": map[string]any{"$ref": "#/components/schemas/FeatureFlag"}}}
+	name := []map[string]any{{
+		"name": "name", "in": "path", "required": true,
+		"schema": map[string]any{"type": "string", "enum": featureFlagNames()},
+	}}
+	return map[string]any{
+		"put": map[string]any{
+			"summary":     "Override a feature flag; takes effect at once and survives restarts",
+			"operationId": "setFeatureFlag",
+			"parameters":  name,
+			"requestBody": map[string]any{
+				"required": true,
+				"content": map[string]any{"application/json": map[string]any{"schema": map[string]any{
+					"type":       "object",
+					"required":   []string{"enabled"},
+					"properties": map[string]any{"enabled": map[string]any{"type": "boolean"}},
+				}}},
+			},
+			"responses": map[string]any{
+				"200": map[string]any{"description": "The flag", "content": flag},
+				"400": map[string]any{"description": "enabled is missing"},
+				"404": map[string]any{"description": "No such flag"},
+			},
+		},
+		"delete": map[string]any{
+			"summary":     "Drop a feature flag's override, so it follows SBRAIN_FLAGS or its default",
+			"operationId": "clearFeatureFlag",
+			"parameters":  name,
+			"responses": map[string]any{
+				"200": map[string]any{"description": "The flag", "content": flag},
+				"404": map[string]any{"description": "No such flag, or it has no override"},
+			},
+		},
+	}
+}
+
+func featureFlagNames() []string {
+	names := make([]string, 0, len(featureFlagDefs))
+	for _, def := range featureFlagDefs {
+		names = append(names, def.Name)
+	}
+	return names
+}
@@ -0,0 +1,137 @@
+package sbrain
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// maxFormBodyBytes caps a form-encoded or multipart create body, files
+// included.
+const maxFormBodyBytes = 10 << 20
+
+// decodeCreateBody decodes the body of a create request into v, a pointer
+// to a struct with json tags. JSON is decoded as it is everywhere else, as
+// is a URL-encoded body that is a JSON object; a URL-encoded or multipart
+// form, as HTML forms and curl -F send, has fields named like the JSON
+// ones, and in a multipart form a file stands for its contents (curl -F
+// context=@notes.md). Form values are converted to each field's type, with
+// a checkbox's "on" as true, and empty ones are left out.
+func decodeCreateBody(w http.ResponseWriter, r *http.Request, v any) error {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/x-www-form-urlencoded" && mediaType != "multipart/form-data" {
+		return json.NewDecoder(r.Body).Decode(v)
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxFormBodyBytes)
+	var err error
+	if mediaType == "multipart/form-data" {
+		err = r.ParseMultipartForm(maxFormBodyBytes)
+	} else {
+		// curl -d sends JSON as a URL-encoded form unless told otherwise, and
+		// no form starts with "{", so such a body is decoded as JSON.
+		var body []byte
+		if body, err = io.ReadAll(r.Body); err != nil {
+			return fmt.Errorf("read form: %v", err)
+		}
+		if bytes.HasPrefix(bytes.TrimLeft(body, " \t\r\n"), []byte("{")) {
+			return json.NewDecoder(bytes.NewReader(body)).Decode(v)
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		err = r.ParseForm()
+	}
+	if err != nil {
+		return fmt.Errorf("read form: %v", err)
+	}
+	fields := map[string]any{}
+	t := reflect.TypeOf(v).Elem()
+	for i := range t.NumField() {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		raw, ok, err := formValue(r, name)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		value, err := convertFormValue(f.Type, raw)
+		if err != nil {
+			return fmt.Errorf("field %s: %v", name, err)
+		}
+		fields[name] = value
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// formValue returns the value of a form field, from the body or, in a
+// multipart form, an uploaded file. ok is false when it is missing or
+// empty.
+func formValue(r *http.Request, name string) (value string, ok bool, err error) {
+	if value = r.PostForm.Get(name); value != "" {
+		return value, true, nil
+	}
+	if r.MultipartForm == nil || len(r.MultipartForm.File[name]) == 0 {
+		return "", false, nil
+	}
+	f, err := r.MultipartForm.File[name][0].Open()
+	if err != nil {
+		return "", false, fmt.Errorf("read %q form file: %v", name, err)
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return "", false, fmt.Errorf("read %q form file: %v", name, err)
+	}
+	return string(data), len(data) > 0, nil
+}
+
+// convertFormValue gives a form value the JSON type of a field of type t.
+func convertFormValue(t reflect.Type, raw string) (any, error) {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.String {
+		// Browsers send a textarea's line breaks as CRLF.
+		return strings.ReplaceAll(raw, "\r\n", "\n"), nil
+	}
+	raw = strings.TrimSpace(raw)
+	switch t.Kind() {
+	case reflect.Bool:
+		if raw == "on" {
+			return true, nil
+		}
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, errors.New("must be true or false")
+		}
+		return b, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, errors.New("must be an integer")
+		}
+		return n, nil
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, errors.New("must be a number")
+		}
+		return n, nil
+	}
+	return raw, nil
+}
@@ -0,0 +1,201 @@
+package sbrain
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Request and response bodies are JSON by default; YAML and MessagePack are
+// translated to and from it at the edge, so handlers only ever see JSON.
+const (
+	yamlContentType    = "application/yaml"
+	msgpackContentType = "application/msgpack"
+)
+
+// maxTranslatedBodyBytes caps a YAML or MessagePack request body, which is
+// read whole to be translated.
+const maxTranslatedBodyBytes = 10 << 20
+
+// bodyFormat names the media type a YAML or MessagePack media type or one of
+// its aliases stands for, and "" for anything else.
+func bodyFormat(mediaType string) string {
+	switch mediaType {
+	case yamlContentType, "application/x-yaml", "text/yaml", "text/x-yaml":
+		return yamlContentType
+	case msgpackContentType, "application/x-msgpack", "application/vnd.msgpack":
+		return msgpackContentType
+	}
+	return ""
+}
+
+// negotiatedFormat returns the media type to translate JSON responses to:
+// YAML or MessagePack when the Accept header prefers one of them over JSON,
+// and "" to leave responses as they are.
+func negotiatedFormat(r *http.Request) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if raw, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(raw, 64); err != nil {
+				continue
+			}
+		}
+		format := bodyFormat(mediaType)
+		if format == "" && mediaType != "application/json" && mediaType != "*/*" && !strings.HasSuffix(mediaType, "+json") {
+			continue
+		}
+		if q > bestQ {
+			best, bestQ = format, q
+		}
+	}
+	return best
+}
+
+// translateResponses re-encodes JSON responses as YAML or MessagePack for
+// clients that ask for them with Accept. Anything else, such as NDJSON
+// streams and CSV, passes through.
+func translateResponses(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		format := negotiatedFormat(r)
+		if format == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		tw := &translatingWriter{ResponseWriter: w, format: format}
+		next.ServeHTTP(tw, r)
+		tw.finish()
+	})
+}
+
+// translatingWriter holds back a JSON response until the handler returns,
+// then writes it in format.
+type translatingWriter struct {
+	http.ResponseWriter
+	format    string
+	status    int
+	buffering bool
+	buf       bytes.Buffer
+}
+
+func (t *translatingWriter) WriteHeader(status int) {
+	if t.status != 0 {
+		return
+	}
+	t.status = status
+	mediaType, _, _ := mime.ParseMediaType(t.Header().Get("Content-Type"))
+	if (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")) && status != http.StatusNoContent && status != http.StatusNotModified {
+		t.buffering = true
+		return
+	}
+	t.ResponseWriter.WriteHeader(status)
+}
+
+func (t *translatingWriter) Write(b []byte) (int, error) {
+	if t.status == 0 {
+		t.WriteHeader(http.StatusOK)
+	}
+	if t.buffering {
+		return t.buf.Write(b)
+	}
+	return t.ResponseWriter.Write(b)
+}
+
+func (t *translatingWriter) Unwrap() http.ResponseWriter { return t.ResponseWriter }
+
+func (t *translatingWriter) Flush() {
+	if t.buffering {
+		return
+	}
+	if f, ok := t.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (t *translatingWriter) finish() {
+	if !t.buffering {
+		return
+	}
+	out, err := translateJSON(t.buf.Bytes(), t.format)
+	if err != nil {
+		// Not JSON after all; send it as it came.
+		t.ResponseWriter.WriteHeader(t.status)
+		t.ResponseWriter.Write(t.buf.Bytes())
+		return
+	}
+	t.Header().Set("Content-Type", t.format)
+	t.Header().Del("Content-Length")
+	t.ResponseWriter.WriteHeader(t.status)
+	t.ResponseWriter.Write(out)
+}
+
+// translateJSON re-encodes a JSON document as YAML or MessagePack.
+func translateJSON(data []byte, format string) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	if format == msgpackContentType {
+		return encodeMsgpack(nil, doc)
+	}
+	var buf bytes.Buffer
+	if err := encodeYAML(&buf, doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// translateRequestBodies turns YAML and MessagePack request bodies into
+// the JSON handlers decode, answering 400 for one that does not parse. It
+// runs after authentication, so only callers with a key get a body parsed.
+func translateRequestBodies(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		format := bodyFormat(mediaType)
+		if format == "" || r.Body == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxTranslatedBodyBytes))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeError(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("body exceeds %d bytes", tooLarge.Limit))
+				return
+			}
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("read body: %v", err))
+			return
+		}
+		var doc any
+		if format == yamlContentType {
+			doc, err = decodeYAML(data)
+		} else {
+			doc, err = decodeMsgpack(data)
+		}
+		if err == nil {
+			data, err = json.Marshal(doc)
+		}
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("decode body: %v", err))
+			return
+		}
+		r = r.Clone(r.Context())
+		r.Body = io.NopCloser(bytes.NewReader(data))
+		r.ContentLength = int64(len(data))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Del("Content-Length")
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,302 @@
+package sbrain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"strings"
+)
+
+// geoIP looks client IPs up in a MaxMind DB file (GeoLite2-City or
+// GeoLite2-Country, or any database with the same layout), read whole into
+// memory by loadGeoIP.
+type geoIP struct {
+	buf        []byte
+	data       []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	ipv4Start  uint
+}
+
+// geoLocation is what enrichment stores under metadata's "geo" key.
+type geoLocation struct {
+	Country string `json:"country,omitempty"`
+	City    string `json:"city,omitempty"`
+}
+
+var mmdbMetadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// loadGeoIP opens the database named by SBRAIN_GEOIP_DB; enrichment is off
+// (nil) when it is unset.
+func loadGeoIP() (*geoIP, error) {
+	path := os.Getenv("SBRAIN_GEOIP_DB")
+	if path == "" {
+		return nil, nil
+	}
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read SBRAIN_GEOIP_DB: %w", err)
+	}
+	g, err := parseGeoIP(buf)
+	if err != nil {
+		return nil, fmt.Errorf("SBRAIN_GEOIP_DB %s: %w", path, err)
+	}
+	return g, nil
+}
+
+func parseGeoIP(buf []byte) (*geoIP, error) {
+	at := bytes.LastIndex(buf, mmdbMetadataMarker)
+	if at < 0 {
+		return nil, errors.New("not a MaxMind DB file: metadata marker not found")
+	}
+	metaStart := at + len(mmdbMetadataMarker)
+	raw, _, err := mmdbDecoder{buf[metaStart:]}.decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("decode metadata: %w", err)
+	}
+	meta, ok := raw.(map[string]any)
+	if !ok {
+		return nil, errors.New("metadata is not a map")
+	}
+	uintField := func(name string) uint {
+		v, _ := meta[name].(uint64)
+		return uint(v)
+	}
+	g := &geoIP{
+		nodeCount:  uintField("node_count"),
+		recordSize: uintField("record_size"),
+		ipVersion:  uintField("ip_version"),
+	}
+	if g.recordSize != 24 && g.recordSize != 28 && g.recordSize != 32 {
+		return nil, fmt.Errorf("unsupported record size %d", g.recordSize)
+	}
+	if g.ipVersion != 4 && g.ipVersion != 6 {
+		return nil, fmt.Errorf("unsupported ip version %d", g.ipVersion)
+	}
+	treeSize := g.nodeCount * g.recordSize / 4
+	if treeSize+16 > uint(at) {
+		return nil, errors.New("search tree is larger than the file")
+	}
+	g.buf = buf[:treeSize]
+	g.data = buf[treeSize+16 : at]
+
+	// IPv4 addresses live under ::/96 in an IPv6 tree; find that node once.
+	if g.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < g.nodeCount; i++ {
+			node = g.record(node, 0)
+		}
+		g.ipv4Start = node
+	}
+	return g, nil
+}
+
+// record returns the left (bit 0) or right (bit 1) record of node.
+func (g *geoIP) record(node, bit uint) uint {
+	switch g.recordSize {
+	case 24:
+		b := g.buf[node*6+bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		b := g.buf[node*7:]
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(g.buf[node*8+bit*4:]))
+	}
+}
+
+// lookup returns the location of ip, or false when the database has none.
+func (g *geoIP) lookup(ip net.IP) (geoLocation, bool) {
+	node := uint(0)
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+		if g.ipVersion == 6 {
+			node = g.ipv4Start
+		}
+	} else if g.ipVersion == 4 {
+		return geoLocation{}, false
+	}
+	for i := 0; i < len(ip)*8 && node < g.nodeCount; i++ {
+		node = g.record(node, uint(ip[i/8]>>(7-i%8))&1)
+	}
+	if node <= g.nodeCount {
+		return geoLocation{}, false
+	}
+	raw, _, err := mmdbDecoder{g.data}.decode(node-g.nodeCount-16, 0)
+	if err != nil {
+		return geoLocation{}, false
+	}
+	record, _ := raw.(map[string]any)
+	loc := geoLocation{
+		Country: mmdbString(record, "country", "iso_code"),
+		City:    mmdbString(record, "city", "names", "en"),
+	}
+	return loc, loc.Country != "" || loc.City != ""
+}
+
+// mmdbString follows path through nested maps to a string.
+func mmdbString(v any, path ...string) string {
+	for _, key := range path {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return ""
+		}
+		v = m[key]
+	}
+	s, _ := v.(string)
+	return s
+}
+
+// enrich adds l's location under metadata's "geo" key.
+func (g *geoIP) enrich(l *logEntry) {
+	ip := net.ParseIP(strings.TrimSpace(l.IP))
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() {
+		return
+	}
+	if loc, ok := g.lookup(ip); ok {
+		addLogMetadata(l, "geo", loc)
+	}
+}
+
+// mmdbDecoder reads the MaxMind DB data section format.
+type mmdbDecoder struct {
+	buf []byte
+}
+
+var errMMDBCorrupt = errors.New("corrupt MaxMind DB data")
+
+// decode returns the value at offset and the offset after it. depth guards
+// against pointer and nesting loops in a corrupt file.
+func (d mmdbDecoder) decode(offset uint, depth int) (any, uint, error) {
+	if depth > 32 || offset >= uint(len(d.buf)) {
+		return nil, 0, errMMDBCorrupt
+	}
+	ctrl := d.buf[offset]
+	offset++
+	typ := uint(ctrl >> 5)
+	if typ == 1 {
+		target, next, err := d.pointer(ctrl, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		v, _, err := d.decode(target, depth+1)
+		return v, next, err
+	}
+	if typ == 0 {
+		if offset >= uint(len(d.buf)) {
+			return nil, 0, errMMDBCorrupt
+		}
+		typ = 7 + uint(d.buf[offset])
+		offset++
+	}
+	size := uint(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if offset+n > uint(len(d.buf)) {
+			return nil, 0, errMMDBCorrupt
+		}
+		extra := uint(0)
+		for _, b := range d.buf[offset : offset+n] {
+			extra = extra<<8 | uint(b)
+		}
+		size = []uint{29, 285, 65821}[n-1] + extra
+		offset += n
+	}
+
+	switch typ {
+	case 7: // map
+		m := make(map[string]any, size)
+		for range size {
+			key, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			k, ok := key.(string)
+			if !ok {
+				return nil, 0, errMMDBCorrupt
+			}
+			var v any
+			if v, offset, err = d.decode(next, depth+1); err != nil {
+				return nil, 0, err
+			}
+			m[k] = v
+		}
+		return m, offset, nil
+	case 11: // array
+		a := make([]any, 0, size)
+		for range size {
+			v, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, v)
+			offset = next
+		}
+		return a, offset, nil
+	case 14: // boolean: the value is the size
+		return size != 0, offset, nil
+	}
+
+	if offset+size > uint(len(d.buf)) {
+		return nil, 0, errMMDBCorrupt
+	}
+	b := d.buf[offset : offset+size]
+	offset += size
+	switch typ {
+	case 2: // UTF-8 string
+		return string(b), offset, nil
+	case 3: // double
+		if size != 8 {
+			return nil, 0, errMMDBCorrupt
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), offset, nil
+	case 4: // bytes
+		return append([]byte(nil), b...), offset, nil
+	case 5, 6, 9: // uint16, uint32, uint64
+		v := uint64(0)
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		return v, offset, nil
+	case 8: // int32
+		v := uint32(0)
+		for _, c := range b {
+			v = v<<8 | uint32(c)
+		}
+		return int64(int32(v)), offset, nil
+	case 10: // uint128, kept as big-endian bytes
+		return append([]byte(nil), b...), offset, nil
+	case 15: // float
+		if size != 4 {
+			return nil, 0, errMMDBCorrupt
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), offset, nil
+	}
+	return nil, 0, fmt.Errorf("%w: unknown type %d", errMMDBCorrupt, typ)
+}
+
+// pointer decodes a pointer whose control byte is ctrl, returning its target
+// offset in the data section and the offset after the pointer.
+func (d mmdbDecoder) pointer(ctrl byte, offset uint) (uint, uint, error) {
+	n := uint(ctrl>>3)&0x3 + 1
+	if offset+n > uint(len(d.buf)) {
+		return 0, 0, errMMDBCorrupt
+	}
+	v := uint(0)
+	if n < 4 {
+		v = uint(ctrl & 0x7)
+	}
+	for _, b := range d.buf[offset : offset+n] {
+		v = v<<8 | uint(b)
+	}
+	v += []uint{0, 2048, 526336, 0}[n-1]
+	return v, offset + n, nil
+}
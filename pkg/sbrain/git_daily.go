@@ -0,0 +1,540 @@
+package sbrain
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"sbrain/store"
+)
+
+// maxGitDailyCommits caps the commits one request may push or one pull may
+// fetch from a repository for a day.
+const maxGitDailyCommits = 1000
+
+// gitCommit is one commit of a day's work. It is what POST
+// /integrations/git/daily accepts and what the record's commits field holds,
+// as a JSON array.
+type gitCommit struct {
+	SHA       string `json:"sha"`
+	Repo      string `json:"repo,omitempty"`
+	Author    string `json:"author,omitempty"`
+	Message   string `json:"message"`
+	URL       string `json:"url,omitempty"`
+	Timestamp string `json:"timestamp,omitempty"`
+}
+
+// gitRepo is a repository SBRAIN_GIT_REPOS names, whose commits are pulled
+// into project.
+type gitRepo struct {
+	Provider string `json:"provider"`
+	Name     string `json:"name"`
+	Project  string `json:"project"`
+}
+
+// loadGitRepos reads SBRAIN_GIT_REPOS, a comma-separated list of
+// provider:owner/name entries, github, gitlab or gitea, each optionally
+// followed by =project. The project defaults to the repository's name.
+func loadGitRepos() ([]gitRepo, error) {
+	var repos []gitRepo
+	for _, entry := range strings.Split(os.Getenv("SBRAIN_GIT_REPOS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		spec, project, _ := strings.Cut(entry, "=")
+		provider, name, ok := strings.Cut(spec, ":")
+		name = strings.Trim(strings.TrimSpace(name), "/")
+		if !ok || (provider != "github" && provider != "gitlab" && provider != "gitea") || !strings.Contains(name, "/") {
+			return nil, fmt.Errorf("SBRAIN_GIT_REPOS: invalid entry %q: expected github:, gitlab: or gitea: and owner/name, optionally =project", entry)
+		}
+		if project = strings.TrimSpace(project); project == "" {
+			project = path.Base(name)
+		}
+		repos = append(repos, gitRepo{Provider: provider, Name: name, Project: project})
+	}
+	return repos, nil
+}
+
+// gitDailyRequest is the body of POST /integrations/git/daily. With commits
+// they are recorded under project; without, the configured repositories
+// (those of repo or project when given) are asked for the day's commits.
+type gitDailyRequest struct {
+	Project string      `json:"project"`
+	Date    string      `json:"date"`
+	Repo    string      `json:"repo"`
+	Commits []gitCommit `json:"commits"`
+}
+
+type gitDailyRecord struct {
+	Project string `json:"project"`
+	BrainID int64  `json:"brain_id"`
+	Created bool   `json:"created"`
+	Commits int    `json:"commits"`
+	Added   int    `json:"added"`
+}
+
+type gitDailyFailure struct {
+	Repo  string `json:"repo"`
+	Error string `json:"error"`
+}
+
+type gitDailyResult struct {
+	Date    string            `json:"date"`
+	Records []gitDailyRecord  `json:"records"`
+	Failed  []gitDailyFailure `json:"failed"`
+}
+
+// gitDaily serves POST /integrations/git/daily: it creates or updates one
+// brain record per project and day summarizing the day's commits, either
+// those in the body or those pulled from GitHub, GitLab and Gitea for the
+// repositories in SBRAIN_GIT_REPOS. Commits already on the record are
+// skipped, so the same day can be pushed or pulled again as it goes on.
+func (s *Server) gitDaily(w http.ResponseWriter, r *http.Request) {
+	var req gitDailyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("decode body: %v", err))
+		return
+	}
+	loc := store.DisplayLocation()
+	day := time.Now().In(loc)
+	if req.Date != "" {
+		var err error
+		if day, err = time.ParseInLocation("2006-01-02", req.Date, loc); err != nil {
+			writeValidationError(w, r, []FieldError{{Field: "date", Message: "must be a date as YYYY-MM-DD"}})
+			return
+		}
+	}
+	day = time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, loc)
+	result := gitDailyResult{Date: day.Format("2006-01-02"), Records: []gitDailyRecord{}, Failed: []gitDailyFailure{}}
+
+	byProject := map[string][]gitCommit{}
+	if len(req.Commits) > 0 {
+		if errs := validateGitDaily(&req); len(errs) > 0 {
+			writeValidationError(w, r, errs)
+			return
+		}
+		byProject[req.Project] = req.Commits
+	} else {
+		repos, err := loadGitRepos()
+		if err != nil {
+			writeError(w, r, http.StatusServiceUnavailable, err.Error())
+			return
+		}
+		if len(repos) == 0 {
+			writeError(w, r, http.StatusServiceUnavailable, "no commits in the body and no repositories to pull from: set SBRAIN_GIT_REPOS")
+			return
+		}
+		var pull []gitRepo
+		for _, repo := range repos {
+			if (req.Repo == "" || req.Repo == repo.Name) && (req.Project == "" || req.Project == repo.Project) {
+				pull = append(pull, repo)
+			}
+		}
+		if len(pull) == 0 {
+			writeError(w, r, http.StatusNotFound, "no configured repository matches repo and project")
+			return
+		}
+		for _, repo := range pull {
+			commits, err := fetchGitCommits(r.Context(), repo, day, day.AddDate(0, 0, 1))
+			if err != nil {
+				result.Failed = append(result.Failed, gitDailyFailure{Repo: repo.Provider + ":" + repo.Name, Error: err.Error()})
+				continue
+			}
+			byProject[repo.Project] = append(byProject[repo.Project], commits...)
+		}
+	}
+
+	projects := make([]string, 0, len(byProject))
+	for project := range byProject {
+		projects = append(projects, project)
+	}
+	sort.Strings(projects)
+	for _, project := range projects {
+		if len(byProject[project]) == 0 {
+			continue
+		}
+		rec, err := s.recordGitDay(r.Context(), project, day, byProject[project])
+		if err != nil {
+			if errors.Is(err, store.ErrOutOfProject) {
+				writeError(w, r, http.StatusForbidden, "forbidden: a project-bound key cannot write records of another project")
+				return
+			}
+			writeError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		result.Records = append(result.Records, rec)
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func validateGitDaily(req *gitDailyRequest) []FieldError {
+	var v validator
+	req.Project = strings.TrimSpace(req.Project)
+	if v.required("project", req.Project) {
+		v.maxLength("project", req.Project, maxProjectLength)
+	}
+	if len(req.Commits) > maxGitDailyCommits {
+		v.add("commits", "must hold at most %d commits", maxGitDailyCommits)
+	}
+	for i := range req.Commits {
+		c := &req.Commits[i]
+		c.SHA, c.Message = strings.TrimSpace(c.SHA), strings.TrimSpace(c.Message)
+		if c.SHA == "" {
+			v.add(fmt.Sprintf("commits[%d].sha", i), "is required")
+		}
+		if c.Message == "" {
+			v.add(fmt.Sprintf("commits[%d].message", i), "is required")
+		}
+	}
+	return v.errors
+}
+
+// gitDayEntries is what a project's day holds: its commits, and the CI
+// builds appended to it.
+type gitDayEntries struct {
+	Commits []gitCommit
+	Builds  []ciBuild
+}
+
+// recordGitDay adds commits to the record of project's day, skipping those
+// it already lists.
+func (s *Server) recordGitDay(ctx context.Context, project string, day time.Time, commits []gitCommit) (gitDailyRecord, error) {
+	return s.updateGitDay(ctx, project, day, func(entries *gitDayEntries) int {
+		seen := map[string]bool{}
+		for _, c := range entries.Commits {
+			seen[c.Repo+"@"+c.SHA] = true
+		}
+		added := 0
+		for _, c := range commits {
+			if key := c.Repo + "@" + c.SHA; !seen[key] {
+				seen[key] = true
+				entries.Commits = append(entries.Commits, c)
+				added++
+			}
+		}
+		return added
+	})
+}
+
+// updateGitDay applies change, which reports how many entries it added, to
+// the record of project's day, creating the record and its git_daily row
+// the first time. The context and summary are rewritten from all of the
+// day's entries whenever one is added.
+func (s *Server) updateGitDay(ctx context.Context, project string, day time.Time, change func(*gitDayEntries) int) (gitDailyRecord, error) {
+	date := day.Format("2006-01-02")
+	rec := gitDailyRecord{Project: project}
+	var brainID sql.NullInt64
+	storedCommits, storedBuilds := "[]", "[]"
+	err := s.db.QueryRowContext(ctx, `SELECT brain_id, commits, builds FROM git_daily WHERE project = ? AND day = ?`, project, date).
+		Scan(&brainID, &storedCommits, &storedBuilds)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return rec, fmt.Errorf("query git_daily: %w", err)
+	}
+	var entries gitDayEntries
+	if err := json.Unmarshal([]byte(storedCommits), &entries.Commits); err != nil {
+		return rec, fmt.Errorf("decode git_daily commits: %w", err)
+	}
+	if err := json.Unmarshal([]byte(storedBuilds), &entries.Builds); err != nil {
+		return rec, fmt.Errorf("decode git_daily builds: %w", err)
+	}
+	rec.Added = change(&entries)
+	all := entries.Commits
+	sort.SliceStable(all, func(i, j int) bool {
+		ti, erri := time.Parse(time.RFC3339, all[i].Timestamp)
+		tj, errj := time.Parse(time.RFC3339, all[j].Timestamp)
+		if erri != nil || errj != nil {
+			return all[i].Timestamp < all[j].Timestamp
+		}
+		return ti.Before(tj)
+	})
+	rec.Commits = len(all)
+
+	var before brain
+	exists := false
+	if brainID.Valid {
+		before, err = s.brains.GetBrain(ctx, brainID.Int64)
+		switch {
+		case err == nil:
+			exists = true
+		case !errors.Is(err, store.ErrNotFound):
+			return rec, err
+		}
+	}
+	if exists && rec.Added == 0 {
+		rec.BrainID = before.ID
+		return rec, nil
+	}
+
+	if all == nil {
+		all = []gitCommit{}
+	}
+	if entries.Builds == nil {
+		entries.Builds = []ciBuild{}
+	}
+	commits, err := json.Marshal(all)
+	if err != nil {
+		return rec, err
+	}
+	builds, err := json.Marshal(entries.Builds)
+	if err != nil {
+		return rec, err
+	}
+	summary, text := renderGitDay(entries)
+	if exists {
+		after := before
+		after.Context, after.Summary, after.Commits = text, summary, string(commits)
+		after.UpdatedAt = store.NewTimestamp(time.Now())
+		if after, err = s.brains.UpdateBrain(ctx, after); err != nil {
+			return rec, err
+		}
+		s.recordAudit(ctx, auditUpdate, "brain", after.ID, before, after)
+		rec.BrainID = after.ID
+	} else {
+		b, err := s.insertBrain(ctx, brain{
+			Title:   fmt.Sprintf("%s: work on %s", project, date),
+			Context: text,
+			Summary: summary,
+			Project: project,
+			Commits: string(commits),
+			Tags:    "git,daily",
+		})
+		if err != nil {
+			return rec, err
+		}
+		rec.BrainID, rec.Created = b.ID, true
+	}
+
+	if _, err := s.db.ExecContext(ctx, `INSERT INTO git_daily (project, day, brain_id, commits, builds, updated_at) VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (project, day) DO UPDATE SET brain_id = excluded.brain_id, commits = excluded.commits, builds = excluded.builds,
+		updated_at = excluded.updated_at`,
+		project, date, rec.BrainID, string(commits), string(builds), store.NewTimestamp(time.Now())); err != nil {
+		return rec, fmt.Errorf("record git_daily: %w", err)
+	}
+	return rec, nil
+}
+
+// renderGitDay writes a day's entries as a one-line summary and a markdown
+// context listing the commits by repository, each by the first line of its
+// message, and then the builds.
+func renderGitDay(entries gitDayEntries) (summary, text string) {
+	commits := entries.Commits
+	var repos, authors []string
+	byRepo := map[string][]gitCommit{}
+	seenAuthor := map[string]bool{}
+	for _, c := range commits {
+		if _, ok := byRepo[c.Repo]; !ok {
+			repos = append(repos, c.Repo)
+		}
+		byRepo[c.Repo] = append(byRepo[c.Repo], c)
+		if c.Author != "" && !seenAuthor[c.Author] {
+			seenAuthor[c.Author] = true
+			authors = append(authors, c.Author)
+		}
+	}
+	sort.Strings(repos)
+
+	var parts []string
+	if len(commits) > 0 {
+		line := plural(len(commits), "commit")
+		if len(authors) > 0 {
+			line += " by " + joinAnd(authors)
+		}
+		if named := slices.DeleteFunc(slices.Clone(repos), func(r string) bool { return r == "" }); len(named) > 0 {
+			line += " in " + joinAnd(named)
+		}
+		parts = append(parts, line+".")
+	}
+	if len(entries.Builds) > 0 {
+		parts = append(parts, summarizeCIBuilds(entries.Builds))
+	}
+	summary = strings.Join(parts, " ")
+
+	var out strings.Builder
+	out.WriteString(summary + "\n")
+	for _, repo := range repos {
+		out.WriteString("\n")
+		if len(repos) > 1 || repo != "" {
+			name := repo
+			if name == "" {
+				name = "Other"
+			}
+			fmt.Fprintf(&out, "## %s\n\n", name)
+		}
+		for _, c := range byRepo[repo] {
+			subject, _, _ := strings.Cut(c.Message, "\n")
+			short := c.SHA[:min(len(c.SHA), 7)]
+			ref := "`" + short + "`"
+			if c.URL != "" {
+				ref = "[" + short + "](" + c.URL + ")"
+			}
+			fmt.Fprintf(&out, "- %s (%s", strings.TrimSpace(subject), ref)
+			if c.Author != "" {
+				fmt.Fprintf(&out, ", %s", c.Author)
+			}
+			out.WriteString(")\n")
+		}
+	}
+	if len(entries.Builds) > 0 {
+		out.WriteString("\n## Builds\n\n")
+		for _, b := range entries.Builds {
+			out.WriteString("- " + b.line() + "\n")
+		}
+	}
+	return summary, out.String()
+}
+
+// plural formats n with noun, adding an s unless n is 1.
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+func joinAnd(items []string) string {
+	if len(items) < 2 {
+		return strings.Join(items, "")
+	}
+	return strings.Join(items[:len(items)-1], ", ") + " and " + items[len(items)-1]
+}
+
+var gitClient = &http.Client{Timeout: 30 * time.Second}
+
+// fetchGitCommits asks GitHub, GitLab or Gitea for the commits to repo's
+// default branch between since and until, following pages up to
+// maxGitDailyCommits. SBRAIN_GITHUB_TOKEN, SBRAIN_GITLAB_TOKEN and
+// SBRAIN_GITEA_TOKEN authenticate the requests; SBRAIN_GITHUB_API_URL and
+// SBRAIN_GITLAB_URL point them at a self-hosted instance, and
+// SBRAIN_GITEA_URL, which Gitea needs, at the instance.
+func fetchGitCommits(ctx context.Context, repo gitRepo, since, until time.Time) ([]gitCommit, error) {
+	// Gitea caps pages at 50 items by default; the others allow 100.
+	perPage := 100
+	if repo.Provider == "gitea" {
+		perPage = 50
+	}
+	var commits []gitCommit
+	for page := 1; len(commits) < maxGitDailyCommits; page++ {
+		var (
+			endpoint string
+			header   = http.Header{}
+		)
+		q := url.Values{"since": {since.UTC().Format(time.RFC3339)}, "until": {until.UTC().Format(time.RFC3339)},
+			"per_page": {fmt.Sprint(perPage)}, "page": {fmt.Sprint(page)}}
+		switch repo.Provider {
+		case "github":
+			base := cmp.Or(os.Getenv("SBRAIN_GITHUB_API_URL"), "https://api.github.com")
+			endpoint = strings.TrimRight(base, "/") + "/repos/" + repo.Name + "/commits?" + q.Encode()
+			header.Set("Accept", "application/vnd.github+json")
+			if token := os.Getenv("SBRAIN_GITHUB_TOKEN"); token != "" {
+				header.Set("Authorization", "Bearer "+token)
+			}
+		case "gitlab":
+			base := cmp.Or(os.Getenv("SBRAIN_GITLAB_URL"), "https://gitlab.com")
+			endpoint = strings.TrimRight(base, "/") + "/api/v4/projects/" + url.PathEscape(repo.Name) + "/repository/commits?" + q.Encode()
+			if token := os.Getenv("SBRAIN_GITLAB_TOKEN"); token != "" {
+				header.Set("PRIVATE-TOKEN", token)
+			}
+		case "gitea":
+			base := os.Getenv("SBRAIN_GITEA_URL")
+			if base == "" {
+				return nil, errors.New("SBRAIN_GITEA_URL is not set")
+			}
+			q.Set("limit", q.Get("per_page"))
+			q.Del("per_page")
+			endpoint = strings.TrimRight(base, "/") + "/api/v1/repos/" + repo.Name + "/commits?" + q.Encode()
+			if token := os.Getenv("SBRAIN_GITEA_TOKEN"); token != "" {
+				header.Set("Authorization", "token "+token)
+			}
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header = header
+		resp, err := gitClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("%s returned %s: %s", repo.Provider, resp.Status, strings.TrimSpace(string(body[:min(len(body), 300)])))
+		}
+
+		n, err := decodeGitCommits(repo, body, &commits)
+		if err != nil {
+			return nil, fmt.Errorf("decode %s commits: %w", repo.Provider, err)
+		}
+		if n < perPage {
+			break
+		}
+	}
+	if len(commits) > maxGitDailyCommits {
+		commits = commits[:maxGitDailyCommits]
+	}
+	return commits, nil
+}
+
+// decodeGitCommits appends the commits of one page of a GitHub, GitLab or
+// Gitea response to commits and returns how many the page held. Gitea
+// answers in GitHub's format.
+func decodeGitCommits(repo gitRepo, body []byte, commits *[]gitCommit) (int, error) {
+	if repo.Provider != "gitlab" {
+		var page []struct {
+			SHA     string `json:"sha"`
+			HTMLURL string `json:"html_url"`
+			Commit  struct {
+				Message string `json:"message"`
+				Author  struct {
+					Name string `json:"name"`
+					Date string `json:"date"`
+				} `json:"author"`
+			} `json:"commit"`
+		}
+		if err := json.Unmarshal(body, &page); err != nil {
+			return 0, err
+		}
+		for _, c := range page {
+			*commits = append(*commits, gitCommit{SHA: c.SHA, Repo: repo.Name, Author: c.Commit.Author.Name,
+				Message: strings.TrimSpace(c.Commit.Message), URL: c.HTMLURL, Timestamp: c.Commit.Author.Date})
+		}
+		return len(page), nil
+	}
+	var page []struct {
+		ID         string `json:"id"`
+		Message    string `json:"message"`
+		AuthorName string `json:"author_name"`
+		CreatedAt  string `json:"created_at"`
+		WebURL     string `json:"web_url"`
+		AuthoredAt string `json:"authored_date"`
+	}
+	if err := json.Unmarshal(body, &page); err != nil {
+		return 0, err
+	}
+	for _, c := range page {
+		ts := c.AuthoredAt
+		if ts == "" {
+			ts = c.CreatedAt
+		}
+		*commits = append(*commits, gitCommit{SHA: c.ID, Repo: repo.Name, Author: c.AuthorName,
+			Message: strings.TrimSpace(c.Message), URL: c.WebURL, Timestamp: ts})
+	}
+	return len(page), nil
+}
@@ -0,0 +1,288 @@
+package sbrain
+
+import (
+	"cmp"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"sbrain/store"
+)
+
+// maxGitWebhookBytes bounds a webhook payload; GitHub's own limit is 25 MB.
+const maxGitWebhookBytes = 25 << 20
+
+// gitWebhookResult is the answer to a webhook delivery: the daily records
+// it wrote, or ignored for events that carry no commits.
+type gitWebhookResult struct {
+	Event   string           `json:"event"`
+	Ignored bool             `json:"ignored,omitempty"`
+	Records []gitDailyRecord `json:"records"`
+}
+
+// gitWebhookHandler serves POST /integrations/git/webhook/{github|gitlab|gitea}.
+// Push events add their commits, and merged pull or merge requests their
+// merge commit, to the daily record of the repository's project, as POST
+// /integrations/git/daily does; other events are acknowledged and ignored.
+// Deliveries must be signed with SBRAIN_GITHUB_WEBHOOK_SECRET or
+// SBRAIN_GITEA_WEBHOOK_SECRET, or carry SBRAIN_GITLAB_WEBHOOK_TOKEN.
+func (s *Server) gitWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	provider := r.PathValue("provider")
+	var secret, event string
+	switch provider {
+	case "github":
+		secret, event = os.Getenv("SBRAIN_GITHUB_WEBHOOK_SECRET"), r.Header.Get("X-GitHub-Event")
+	case "gitlab":
+		secret, event = os.Getenv("SBRAIN_GITLAB_WEBHOOK_TOKEN"), r.Header.Get("X-Gitlab-Event")
+	case "gitea":
+		secret, event = os.Getenv("SBRAIN_GITEA_WEBHOOK_SECRET"), r.Header.Get("X-Gitea-Event")
+	default:
+		writeError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+	if secret == "" {
+		writeError(w, r, http.StatusNotFound, provider+" webhooks are not configured")
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxGitWebhookBytes))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("read body: %v", err))
+		return
+	}
+	if err := verifyGitWebhook(provider, secret, r.Header, body); err != nil {
+		writeError(w, r, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	repo, actor, commits, err := parseGitWebhook(provider, event, body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	result := gitWebhookResult{Event: event, Records: []gitDailyRecord{}}
+	if len(commits) == 0 {
+		result.Ignored = true
+		writeJSON(w, http.StatusOK, result)
+		return
+	}
+
+	repos, err := loadGitRepos()
+	if err != nil {
+		writeError(w, r, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	project := gitRepoProject(repos, repo)
+	ctx := withActor(r.Context(), provider+":"+actor)
+	for _, day := range groupCommitsByDay(commits) {
+		rec, err := s.recordGitDay(ctx, project, day.day, day.commits)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		result.Records = append(result.Records, rec)
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// verifyGitWebhook checks a delivery's signature: an HMAC-SHA256 of the
+// body in X-Hub-Signature-256 (GitHub, "sha256=" and hex) or
+// X-Gitea-Signature (hex), or for GitLab the shared token in
+// X-Gitlab-Token.
+func verifyGitWebhook(provider, secret string, header http.Header, body []byte) error {
+	if provider == "gitlab" {
+		if subtle.ConstantTimeCompare([]byte(header.Get("X-Gitlab-Token")), []byte(secret)) != 1 {
+			return errors.New("invalid gitlab token")
+		}
+		return nil
+	}
+	signature := header.Get("X-Gitea-Signature")
+	if provider == "github" {
+		var ok bool
+		if signature, ok = strings.CutPrefix(header.Get("X-Hub-Signature-256"), "sha256="); !ok {
+			return errors.New("missing github signature")
+		}
+	}
+	got, err := hex.DecodeString(signature)
+	if err != nil || signature == "" {
+		return fmt.Errorf("missing or malformed %s signature", provider)
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return fmt.Errorf("invalid %s signature", provider)
+	}
+	return nil
+}
+
+// gitWebhookPush is a push event. GitHub, GitLab and Gitea agree on the
+// commits; they name the repository differently.
+type gitWebhookPush struct {
+	Ref        string `json:"ref"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+	Project struct {
+		PathWithNamespace string `json:"path_with_namespace"`
+	} `json:"project"`
+	Pusher struct {
+		Name     string `json:"name"`
+		Login    string `json:"login"`
+		Username string `json:"username"`
+	} `json:"pusher"`
+	UserUsername string `json:"user_username"`
+	Commits      []struct {
+		ID        string `json:"id"`
+		Message   string `json:"message"`
+		Timestamp string `json:"timestamp"`
+		URL       string `json:"url"`
+		Author    struct {
+			Name string `json:"name"`
+		} `json:"author"`
+	} `json:"commits"`
+}
+
+// gitWebhookPull is a GitHub or Gitea pull_request event.
+type gitWebhookPull struct {
+	Action      string `json:"action"`
+	PullRequest struct {
+		Number         int    `json:"number"`
+		Title          string `json:"title"`
+		HTMLURL        string `json:"html_url"`
+		Merged         bool   `json:"merged"`
+		MergeCommitSHA string `json:"merge_commit_sha"`
+		MergedAt       string `json:"merged_at"`
+		MergedBy       struct {
+			Login string `json:"login"`
+		} `json:"merged_by"`
+		User struct {
+			Login string `json:"login"`
+		} `json:"user"`
+	} `json:"pull_request"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+}
+
+// gitWebhookMergeRequest is a GitLab "Merge Request Hook" event.
+type gitWebhookMergeRequest struct {
+	User struct {
+		Username string `json:"username"`
+	} `json:"user"`
+	Project struct {
+		PathWithNamespace string `json:"path_with_namespace"`
+	} `json:"project"`
+	ObjectAttributes struct {
+		IID            int    `json:"iid"`
+		Title          string `json:"title"`
+		URL            string `json:"url"`
+		Action         string `json:"action"`
+		MergeCommitSHA string `json:"merge_commit_sha"`
+		UpdatedAt      string `json:"updated_at"`
+	} `json:"object_attributes"`
+}
+
+// parseGitWebhook normalizes a push or merged pull/merge request event into
+// the repository, who triggered it and its commits. Other events, tag
+// pushes and pull requests that were not merged come back without commits.
+func parseGitWebhook(provider, event string, body []byte) (repo, actor string, commits []gitCommit, err error) {
+	switch {
+	case event == "push" || event == "Push Hook":
+		var p gitWebhookPush
+		if err := json.Unmarshal(body, &p); err != nil {
+			return "", "", nil, fmt.Errorf("decode push event: %w", err)
+		}
+		if strings.HasPrefix(p.Ref, "refs/tags/") {
+			return "", "", nil, nil
+		}
+		repo = cmp.Or(p.Repository.FullName, p.Project.PathWithNamespace)
+		actor = cmp.Or(p.Pusher.Login, p.Pusher.Username, p.Pusher.Name, p.UserUsername)
+		for _, c := range p.Commits {
+			commits = append(commits, gitCommit{SHA: c.ID, Repo: repo, Author: c.Author.Name,
+				Message: strings.TrimSpace(c.Message), URL: c.URL, Timestamp: c.Timestamp})
+		}
+	case event == "pull_request" && provider != "gitlab":
+		var p gitWebhookPull
+		if err := json.Unmarshal(body, &p); err != nil {
+			return "", "", nil, fmt.Errorf("decode pull_request event: %w", err)
+		}
+		pr := p.PullRequest
+		if p.Action != "closed" || !pr.Merged || pr.MergeCommitSHA == "" {
+			return "", "", nil, nil
+		}
+		repo, actor = p.Repository.FullName, cmp.Or(pr.MergedBy.Login, pr.User.Login)
+		commits = append(commits, gitCommit{SHA: pr.MergeCommitSHA, Repo: repo, Author: pr.User.Login,
+			Message: fmt.Sprintf("Merged #%d: %s", pr.Number, pr.Title), URL: pr.HTMLURL, Timestamp: pr.MergedAt})
+	case event == "Merge Request Hook" && provider == "gitlab":
+		var m gitWebhookMergeRequest
+		if err := json.Unmarshal(body, &m); err != nil {
+			return "", "", nil, fmt.Errorf("decode merge request event: %w", err)
+		}
+		mr := m.ObjectAttributes
+		if mr.Action != "merge" || mr.MergeCommitSHA == "" {
+			return "", "", nil, nil
+		}
+		repo, actor = m.Project.PathWithNamespace, m.User.Username
+		commits = append(commits, gitCommit{SHA: mr.MergeCommitSHA, Repo: repo, Author: m.User.Username,
+			Message: fmt.Sprintf("Merged !%d: %s", mr.IID, mr.Title), URL: mr.URL, Timestamp: gitlabTimestamp(mr.UpdatedAt)})
+	}
+	return repo, actor, commits, nil
+}
+
+// gitlabTimestamp converts the "2024-06-03 09:00:00 UTC" GitLab uses in
+// merge request events to RFC 3339, leaving other forms as they are.
+func gitlabTimestamp(value string) string {
+	if t, err := time.Parse("2006-01-02 15:04:05 MST", value); err == nil {
+		return t.UTC().Format(time.RFC3339)
+	}
+	return value
+}
+
+// gitRepoProject is the project SBRAIN_GIT_REPOS maps repo to, or the
+// repository's name.
+func gitRepoProject(repos []gitRepo, repo string) string {
+	for _, r := range repos {
+		if strings.EqualFold(r.Name, repo) {
+			return r.Project
+		}
+	}
+	return path.Base(repo)
+}
+
+type gitDay struct {
+	day     time.Time
+	commits []gitCommit
+}
+
+// groupCommitsByDay splits commits by the day, in SBRAIN_TZ, they were
+// made; commits without a readable timestamp count as today's.
+func groupCommitsByDay(commits []gitCommit) []gitDay {
+	loc := store.DisplayLocation()
+	byDay := map[time.Time][]gitCommit{}
+	for _, c := range commits {
+		t, err := time.Parse(time.RFC3339, c.Timestamp)
+		if err != nil {
+			t = time.Now()
+		}
+		t = t.In(loc)
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+		byDay[day] = append(byDay[day], c)
+	}
+	days := make([]gitDay, 0, len(byDay))
+	for day, c := range byDay {
+		days = append(days, gitDay{day: day, commits: c})
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].day.Before(days[j].day) })
+	return days
+}
@@ -0,0 +1,368 @@
+package sbrain
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The /grafana/ routes implement the Grafana JSON (SimpleJSON) datasource
+// protocol on top of the log stats queries: point a JSON datasource at
+// $BASE_URL/grafana to chart request volume, error rate and latency.
+
+// grafanaSeries lists the time series targets returned by /grafana/search.
+var grafanaSeries = []string{
+	"requests",
+	"errors",
+	"error_rate",
+	"response_time_avg",
+	"response_time_p50",
+	"response_time_p95",
+	"response_time_p99",
+}
+
+// grafanaTables maps table targets to the column they group logs by.
+var grafanaTables = map[string]string{
+	"by_level":        `level`,
+	"by_endpoint":     `COALESCE(endpoint, '')`,
+	"by_status_class": statusClassExpr,
+}
+
+// grafanaTagKeys are the log columns offered as ad hoc filters.
+var grafanaTagKeys = []string{"level", "endpoint", "method", "status_code"}
+
+type grafanaRange struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+type grafanaQuery struct {
+	Range         grafanaRange `json:"range"`
+	IntervalMs    int64        `json:"intervalMs"`
+	MaxDataPoints int64        `json:"maxDataPoints"`
+	Targets       []struct {
+		Target  string            `json:"target"`
+		RefID   string            `json:"refId"`
+		Type    string            `json:"type"`
+		Data    map[string]string `json:"data"`
+		Payload map[string]string `json:"payload"`
+	} `json:"targets"`
+	AdhocFilters []struct {
+		Key      string `json:"key"`
+		Operator string `json:"operator"`
+		Value    string `json:"value"`
+	} `json:"adhocFilters"`
+}
+
+type grafanaTimeSeries struct {
+	Target     string       `json:"target"`
+	Datapoints [][2]float64 `json:"datapoints"`
+}
+
+type grafanaColumn struct {
+	Text string `json:"text"`
+	Type string `json:"type"`
+}
+
+type grafanaTable struct {
+	Type    string          `json:"type"`
+	Columns []grafanaColumn `json:"columns"`
+	Rows    [][]any         `json:"rows"`
+}
+
+// grafanaTestHandler answers Grafana's "Save & test", which expects a 200
+// from the datasource root.
+func (s *Server) grafanaTestHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (s *Server) grafanaSearchHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, append(append([]string{}, grafanaSeries...), "by_level", "by_endpoint", "by_status_class"))
+}
+
+func (s *Server) grafanaTagKeysHandler(w http.ResponseWriter, r *http.Request) {
+	keys := make([]map[string]string, 0, len(grafanaTagKeys))
+	for _, key := range grafanaTagKeys {
+		keys = append(keys, map[string]string{"type": "string", "text": key})
+	}
+	writeJSON(w, http.StatusOK, keys)
+}
+
+func (s *Server) grafanaQueryHandler(w http.ResponseWriter, r *http.Request) {
+	var q grafanaQuery
+	if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("decode body: %v", err))
+		return
+	}
+	if q.Range.From.IsZero() || q.Range.To.IsZero() {
+		writeError(w, r, http.StatusBadRequest, "range.from and range.to are required")
+		return
+	}
+
+	step := q.IntervalMs / 1000
+	if step < 1 && q.MaxDataPoints > 0 {
+		step = int64(q.Range.To.Sub(q.Range.From).Seconds()) / q.MaxDataPoints
+	}
+	if step < 1 {
+		step = 60
+	}
+
+	results := []any{}
+	for _, t := range q.Targets {
+		filter := logFilter{
+			Since: q.Range.From.UTC().Format(sqliteTimeLayout),
+			Until: q.Range.To.UTC().Format(sqliteTimeLayout),
+		}
+		for key, value := range t.Data {
+			applyGrafanaFilter(&filter, key, value)
+		}
+		for key, value := range t.Payload {
+			applyGrafanaFilter(&filter, key, value)
+		}
+		for _, f := range q.AdhocFilters {
+			if f.Operator == "" || f.Operator == "=" {
+				applyGrafanaFilter(&filter, f.Key, f.Value)
+			}
+		}
+
+		if expr, ok := grafanaTables[t.Target]; ok {
+			where, args := filter.Where()
+			buckets, err := s.countBuckets(r.Context(), expr, where, args)
+			if err != nil {
+				writeError(w, r, http.StatusInternalServerError, err.Error())
+				return
+			}
+			table := grafanaTable{
+				Type:    "table",
+				Columns: []grafanaColumn{{Text: strings.TrimPrefix(t.Target, "by_"), Type: "string"}, {Text: "count", Type: "number"}},
+				Rows:    [][]any{},
+			}
+			for _, b := range buckets {
+				table.Rows = append(table.Rows, []any{b.Key, b.Count})
+			}
+			results = append(results, table)
+			continue
+		}
+
+		series, err := s.grafanaSeries(r.Context(), t.Target, filter, step)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		results = append(results, series)
+	}
+
+	writeJSON(w, http.StatusOK, results)
+}
+
+func applyGrafanaFilter(f *logFilter, key string, value string) {
+	switch key {
+	case "level":
+		f.Level = value
+	case "endpoint":
+		f.Endpoint = value
+	case "method":
+		f.Method = strings.ToUpper(value)
+	case "status_code":
+		f.StatusCode, _ = strconv.Atoi(value)
+	}
+}
+
+// grafanaSeries computes one time series target in buckets of step seconds.
+func (s *Server) grafanaSeries(ctx context.Context, target string, filter logFilter, step int64) (grafanaTimeSeries, error) {
+	series := grafanaTimeSeries{Target: target, Datapoints: [][2]float64{}}
+	where, args := filter.Where()
+	bucketExpr := `(CAST(strftime('%s', occurred_at) AS INTEGER) / ?) * ?`
+	bucketArgs := append([]any{step, step}, args...)
+
+	if strings.HasPrefix(target, "response_time_p") {
+		rank, err := strconv.ParseFloat(strings.TrimPrefix(target, "response_time_p"), 64)
+		if err != nil || rank <= 0 || rank > 100 {
+			return series, fmt.Errorf("unknown target %q", target)
+		}
+		return s.grafanaPercentileSeries(ctx, series, bucketExpr, bucketArgs, where, rank/100)
+	}
+
+	var valueExpr string
+	switch target {
+	case "requests":
+		valueExpr = `SUM(count)`
+	case "errors":
+		valueExpr = `SUM(CASE WHEN level IN ('error', 'fatal') THEN count ELSE 0 END)`
+	case "error_rate":
+		valueExpr = `1.0 * SUM(CASE WHEN level IN ('error', 'fatal') THEN count ELSE 0 END) / SUM(count)`
+	case "response_time_avg":
+		valueExpr = `AVG(response_time_ms)`
+	default:
+		return series, fmt.Errorf("unknown target %q", target)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT `+bucketExpr+` AS b, `+valueExpr+`
+		FROM logs`+where+` GROUP BY b ORDER BY b`, bucketArgs...)
+	if err != nil {
+		return series, fmt.Errorf("query %s: %w", target, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var bucket int64
+		var value sql.NullFloat64
+		if err := rows.Scan(&bucket, &value); err != nil {
+			return series, fmt.Errorf("scan %s: %w", target, err)
+		}
+		if value.Valid {
+			series.Datapoints = append(series.Datapoints, [2]float64{value.Float64, float64(bucket * 1000)})
+		}
+	}
+	return series, rows.Err()
+}
+
+// grafanaPercentileSeries computes a nearest-rank percentile of
+// response_time_ms per bucket, the same definition latencyPercentiles uses.
+func (s *Server) grafanaPercentileSeries(ctx context.Context, series grafanaTimeSeries, bucketExpr string, bucketArgs []any, where string, rank float64) (grafanaTimeSeries, error) {
+	clause := " WHERE response_time_ms IS NOT NULL"
+	if where != "" {
+		clause = where + " AND response_time_ms IS NOT NULL"
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT `+bucketExpr+` AS b, response_time_ms
+		FROM logs`+clause+` ORDER BY b, response_time_ms`, bucketArgs...)
+	if err != nil {
+		return series, fmt.Errorf("query %s: %w", series.Target, err)
+	}
+	defer rows.Close()
+
+	var bucket int64 = -1
+	var values []int64
+	flush := func() {
+		if len(values) == 0 {
+			return
+		}
+		i := int(math.Ceil(rank*float64(len(values)))) - 1
+		if i < 0 {
+			i = 0
+		}
+		series.Datapoints = append(series.Datapoints, [2]float64{float64(values[i]), float64(bucket * 1000)})
+		values = values[:0]
+	}
+	for rows.Next() {
+		var b, value int64
+		if err := rows.Scan(&b, &value); err != nil {
+			return series, fmt.Errorf("scan %s: %w", series.Target, err)
+		}
+		if b != bucket {
+			flush()
+			bucket = b
+		}
+		values = append(values, value)
+	}
+	flush()
+	return series, rows.Err()
+}
+
+// grafanaAnnotationsHandler marks fired alerts on graphs. An annotation query
+// of "errors" marks individual error and fatal logs instead.
+func (s *Server) grafanaAnnotationsHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Range      grafanaRange   `json:"range"`
+		Annotation map[string]any `json:"annotation"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("decode body: %v", err))
+		return
+	}
+	from := req.Range.From.UTC().Format(sqliteTimeLayout)
+	to := req.Range.To.UTC().Format(sqliteTimeLayout)
+	query, _ := req.Annotation["query"].(string)
+
+	var rows *sql.Rows
+	var err error
+	if strings.TrimSpace(query) == "errors" {
+		rows, err = s.db.QueryContext(r.Context(), `SELECT occurred_at, level, message, COALESCE(endpoint, '')
+			FROM logs WHERE level IN ('error', 'fatal') AND occurred_at >= ? AND occurred_at < ?
+			ORDER BY occurred_at LIMIT 1000`, from, to)
+	} else {
+		rows, err = s.db.QueryContext(r.Context(), `SELECT created_at, 'alert', rule_name || ': ' || count || ' matching logs',
+			CASE WHEN acknowledged_at = '' THEN 'unacknowledged' ELSE 'acknowledged' END
+			FROM alert_events WHERE created_at >= ? AND created_at < ? ORDER BY created_at`, from, to)
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("query annotations: %v", err))
+		return
+	}
+	defer rows.Close()
+
+	annotations := []map[string]any{}
+	for rows.Next() {
+		var createdAt, title, text, tag string
+		if err := rows.Scan(&createdAt, &title, &text, &tag); err != nil {
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("scan annotation: %v", err))
+			return
+		}
+		t, _ := parseTimestamp(createdAt)
+		tags := []string{title}
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+		annotations = append(annotations, map[string]any{
+			"annotation": req.Annotation,
+			"time":       t.UnixMilli(),
+			"title":      title,
+			"text":       text,
+			"tags":       tags,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("iterate annotations: %v", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, annotations)
+}
+
+func (s *Server) grafanaTagValuesHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Key string `json:"key"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("decode body: %v", err))
+		return
+	}
+	known := false
+	for _, key := range grafanaTagKeys {
+		known = known || key == req.Key
+	}
+	if !known {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("unknown tag key %q", req.Key))
+		return
+	}
+
+	// The key is one of grafanaTagKeys, so it is safe to use as a column name.
+	rows, err := s.db.QueryContext(r.Context(), `SELECT DISTINCT CAST(`+req.Key+` AS TEXT) FROM logs
+		WHERE `+req.Key+` IS NOT NULL AND `+req.Key+` != '' LIMIT 1000`)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("query tag values: %v", err))
+		return
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("scan tag value: %v", err))
+			return
+		}
+		values = append(values, v)
+	}
+	sort.Strings(values)
+	out := make([]map[string]string, 0, len(values))
+	for _, v := range values {
+		out = append(out, map[string]string{"text": v})
+	}
+	writeJSON(w, http.StatusOK, out)
+}
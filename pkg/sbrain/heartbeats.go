@@ -0,0 +1,287 @@
+package sbrain
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"sbrain/store"
+)
+
+// Heartbeat states: new until the first ping, then up, and down once a ping
+// is overdue, until the next one.
+const (
+	heartbeatNew  = "new"
+	heartbeatUp   = "up"
+	heartbeatDown = "down"
+)
+
+var heartbeatNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// heartbeat is a dead man's switch: a cron job or worker pings it at
+// POST /heartbeats/{name} at least every IntervalSeconds, and when a ping is
+// more than GraceSeconds late the heartbeat goes down, an error log is
+// written and, with a Channel, an alert is sent to Target.
+type heartbeat struct {
+	ID              int64     `json:"id"`
+	CreatedAt       timestamp `json:"created_at"`
+	Name            string    `json:"name"`
+	IntervalSeconds int       `json:"interval_seconds"`
+	GraceSeconds    int       `json:"grace_seconds"`
+	Channel         string    `json:"channel"`
+	Target          string    `json:"target"`
+	Status          string    `json:"status"`
+	LastPingAt      timestamp `json:"last_ping_at"`
+	LastMissedAt    timestamp `json:"last_missed_at"`
+	// DueAt is when the heartbeat goes down without another ping.
+	DueAt timestamp `json:"due_at"`
+}
+
+const heartbeatColumns = `id, created_at, name, interval_seconds, grace_seconds, channel, target,
+	status, last_ping_at, last_missed_at`
+
+func scanHeartbeat(row interface{ Scan(...any) error }) (heartbeat, error) {
+	var h heartbeat
+	err := row.Scan(&h.ID, &h.CreatedAt, &h.Name, &h.IntervalSeconds, &h.GraceSeconds, &h.Channel, &h.Target,
+		&h.Status, &h.LastPingAt, &h.LastMissedAt)
+	if err == nil {
+		if due, ok := h.due(); ok {
+			h.DueAt = store.NewTimestamp(due)
+		}
+	}
+	return h, err
+}
+
+// due returns when the heartbeat goes down: its interval and grace after
+// the last ping or, before the first, after it was created.
+func (h heartbeat) due() (time.Time, bool) {
+	from, ok := h.LastPingAt.Time()
+	if !ok {
+		from, ok = h.CreatedAt.Time()
+	}
+	if !ok {
+		return time.Time{}, false
+	}
+	return from.Add(time.Duration(h.IntervalSeconds+h.GraceSeconds) * time.Second), true
+}
+
+func (s *Server) loadHeartbeat(ctx context.Context, name string) (heartbeat, error) {
+	return scanHeartbeat(s.db.QueryRowContext(ctx, `SELECT `+heartbeatColumns+` FROM heartbeats WHERE name = ?`, name))
+}
+
+// listHeartbeats serves GET /heartbeats.
+func (s *Server) listHeartbeats(w http.ResponseWriter, r *http.Request) {
+	rows, err := s.db.QueryContext(r.Context(), `SELECT `+heartbeatColumns+` FROM heartbeats ORDER BY name`)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("query heartbeats: %v", err))
+		return
+	}
+	defer rows.Close()
+	items := []heartbeat{}
+	for rows.Next() {
+		h, err := scanHeartbeat(rows)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("scan heartbeat: %v", err))
+			return
+		}
+		items = append(items, h)
+	}
+	if err := rows.Err(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("iterate heartbeats: %v", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+// getHeartbeat serves GET /heartbeats/{name}.
+func (s *Server) getHeartbeat(w http.ResponseWriter, r *http.Request) {
+	h, err := s.loadHeartbeat(r.Context(), r.PathValue("name"))
+	if err != nil {
+		writeHeartbeatLoadError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, h)
+}
+
+// putHeartbeat serves PUT /heartbeats/{name}, creating the heartbeat or
+// changing its interval and alerting. Its state and pings are kept.
+func (s *Server) putHeartbeat(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	var req heartbeat
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("decode body: %v", err))
+		return
+	}
+	req.Channel = strings.TrimSpace(req.Channel)
+	req.Target = strings.TrimSpace(req.Target)
+
+	var v validator
+	if !heartbeatNamePattern.MatchString(name) {
+		v.add("name", "must be 1 to 64 letters, digits, dots, dashes or underscores")
+	}
+	if req.IntervalSeconds < 60 {
+		v.add("interval_seconds", "must be at least 60")
+	}
+	if req.GraceSeconds < 0 {
+		v.add("grace_seconds", "must not be negative")
+	}
+	if req.Channel != "" && !slices.Contains(notifyChannels, req.Channel) {
+		v.add("channel", "must be webhook, slack or email, or empty to only log")
+	} else if req.Channel != "" && req.Target == "" {
+		v.add("target", "is required with a channel")
+	}
+	if len(v.errors) > 0 {
+		writeValidationError(w, r, v.errors)
+		return
+	}
+
+	before, err := s.loadHeartbeat(r.Context(), name)
+	exists := err == nil
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("query heartbeat: %v", err))
+		return
+	}
+	if _, err := s.db.ExecContext(r.Context(), `INSERT INTO heartbeats (name, interval_seconds, grace_seconds, channel, target)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET interval_seconds = excluded.interval_seconds,
+			grace_seconds = excluded.grace_seconds, channel = excluded.channel, target = excluded.target`,
+		name, req.IntervalSeconds, req.GraceSeconds, req.Channel, req.Target); err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("save heartbeat: %v", err))
+		return
+	}
+	after, err := s.loadHeartbeat(r.Context(), name)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("load heartbeat: %v", err))
+		return
+	}
+	if exists {
+		s.recordAudit(r.Context(), auditUpdate, "heartbeat", after.ID, before, after)
+		writeJSON(w, http.StatusOK, after)
+		return
+	}
+	s.recordAudit(r.Context(), auditCreate, "heartbeat", after.ID, nil, after)
+	writeJSONStatus(w, http.StatusCreated, after)
+}
+
+// deleteHeartbeat serves DELETE /heartbeats/{name}.
+func (s *Server) deleteHeartbeat(w http.ResponseWriter, r *http.Request) {
+	h, err := s.loadHeartbeat(r.Context(), r.PathValue("name"))
+	if err != nil {
+		writeHeartbeatLoadError(w, r, err)
+		return
+	}
+	if _, err := s.db.ExecContext(r.Context(), `DELETE FROM heartbeats WHERE id = ?`, h.ID); err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("delete heartbeat: %v", err))
+		return
+	}
+	s.recordAudit(r.Context(), auditDelete, "heartbeat", h.ID, h, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// pingHeartbeat serves POST /heartbeats/{name}, what a job calls each time
+// it runs. A ping to a heartbeat that is down brings it back up, which is
+// logged and announced like the miss was.
+func (s *Server) pingHeartbeat(w http.ResponseWriter, r *http.Request) {
+	h, err := s.loadHeartbeat(r.Context(), r.PathValue("name"))
+	if err != nil {
+		writeHeartbeatLoadError(w, r, err)
+		return
+	}
+	now := time.Now()
+	wasDown := h.Status == heartbeatDown
+	h.LastPingAt, h.Status = store.NewTimestamp(now), heartbeatUp
+	if _, err := s.db.ExecContext(r.Context(), `UPDATE heartbeats SET last_ping_at = ?, status = ? WHERE id = ?`,
+		h.LastPingAt, h.Status, h.ID); err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("record ping: %v", err))
+		return
+	}
+	if due, ok := h.due(); ok {
+		h.DueAt = store.NewTimestamp(due)
+	}
+	if wasDown {
+		missed, _ := h.LastMissedAt.Time()
+		text := fmt.Sprintf("sbrain heartbeat %q is back up after %s down", h.Name, now.Sub(missed).Round(time.Second))
+		s.recordHeartbeatChange(h, "info", text)
+	}
+	writeJSON(w, http.StatusOK, h)
+}
+
+func writeHeartbeatLoadError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, r, http.StatusNotFound, "no such heartbeat; create it with PUT /heartbeats/{name}")
+		return
+	}
+	writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("query heartbeat: %v", err))
+}
+
+// evaluateHeartbeats marks every heartbeat whose ping is overdue as down.
+// It runs with the alert rules, once a minute.
+func (s *Server) evaluateHeartbeats(ctx context.Context, now time.Time) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+heartbeatColumns+` FROM heartbeats WHERE status != ?`, heartbeatDown)
+	if err != nil {
+		log.Printf("heartbeats: %v", err)
+		return
+	}
+	var overdue []heartbeat
+	for rows.Next() {
+		h, err := scanHeartbeat(rows)
+		if err != nil {
+			log.Printf("heartbeats: scan: %v", err)
+			continue
+		}
+		if due, ok := h.due(); ok && now.After(due) {
+			overdue = append(overdue, h)
+		}
+	}
+	rows.Close()
+
+	for _, h := range overdue {
+		h.Status, h.LastMissedAt = heartbeatDown, store.NewTimestamp(now)
+		res, err := s.db.ExecContext(ctx, `UPDATE heartbeats SET status = ?, last_missed_at = ? WHERE id = ? AND status != ?`,
+			h.Status, h.LastMissedAt, h.ID, heartbeatDown)
+		if err != nil {
+			log.Printf("heartbeats: %s: %v", h.Name, err)
+			continue
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			continue // pinged or deleted meanwhile
+		}
+		since := "it was created"
+		if h.LastPingAt != "" {
+			since = "the last ping at " + h.LastPingAt.Display()
+		}
+		text := fmt.Sprintf("sbrain heartbeat %q missed: no ping since %s (expected every %s)",
+			h.Name, since, time.Duration(h.IntervalSeconds)*time.Second)
+		s.recordHeartbeatChange(h, "error", text)
+	}
+}
+
+// recordHeartbeatChange logs a heartbeat going down or coming back up and
+// announces it on the heartbeat's channel, if it has one.
+func (s *Server) recordHeartbeatChange(h heartbeat, level, text string) {
+	metadata, _ := json.Marshal(map[string]any{"heartbeat": h.Name, "status": h.Status, "last_ping_at": h.LastPingAt})
+	if _, err := s.insertLog(context.Background(), logEntry{
+		Level:    level,
+		Message:  text,
+		Endpoint: "/heartbeats/" + h.Name,
+		Method:   http.MethodPost,
+		Metadata: string(metadata),
+		Service:  internalLogService,
+	}); err != nil {
+		log.Printf("heartbeats: %s: store log: %v", h.Name, err)
+	}
+	if h.Channel == "" {
+		return
+	}
+	if err := s.notify(h.Channel, h.Target, "sbrain heartbeat "+h.Name+" is "+h.Status, text, map[string]any{"heartbeat": h}); err != nil {
+		log.Printf("heartbeats: %s: deliver via %s: %v", h.Name, h.Channel, err)
+	}
+}
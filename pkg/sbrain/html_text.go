@@ -0,0 +1,303 @@
+package sbrain
+
+import (
+	"html"
+	"strings"
+)
+
+// htmlToken is one piece of an HTML document: text, or a start or end tag
+// with its lowercased name and attributes.
+type htmlToken struct {
+	text  string
+	tag   string
+	end   bool
+	attrs map[string]string
+}
+
+// htmlRawTextTags hold text that is not markup, which the tokenizer skips
+// to their end tag.
+var htmlRawTextTags = map[string]bool{"script": true, "style": true, "textarea": true, "title": true}
+
+// tokenizeHTML splits a document into tokens, dropping comments, doctypes
+// and processing instructions. It is forgiving rather than complete: enough
+// to pull the readable text out of real-world pages without a parser
+// dependency.
+func tokenizeHTML(doc string) []htmlToken {
+	var tokens []htmlToken
+	for len(doc) > 0 {
+		lt := strings.IndexByte(doc, '<')
+		if lt < 0 {
+			tokens = append(tokens, htmlToken{text: doc})
+			break
+		}
+		if lt > 0 {
+			tokens = append(tokens, htmlToken{text: doc[:lt]})
+			doc = doc[lt:]
+		}
+		switch {
+		case strings.HasPrefix(doc, "<!--"):
+			end := strings.Index(doc[4:], "-->")
+			if end < 0 {
+				return tokens
+			}
+			doc = doc[4+end+3:]
+			continue
+		case strings.HasPrefix(doc, "<!"), strings.HasPrefix(doc, "<?"):
+			end := strings.IndexByte(doc, '>')
+			if end < 0 {
+				return tokens
+			}
+			doc = doc[end+1:]
+			continue
+		}
+
+		tok, rest, ok := parseHTMLTag(doc)
+		if !ok {
+			// A stray '<' is text.
+			tokens = append(tokens, htmlToken{text: "<"})
+			doc = doc[1:]
+			continue
+		}
+		tokens = append(tokens, tok)
+		doc = rest
+		if !tok.end && htmlRawTextTags[tok.tag] {
+			closing := strings.Index(strings.ToLower(doc), "</"+tok.tag)
+			if closing < 0 {
+				closing = len(doc)
+			}
+			tokens = append(tokens, htmlToken{text: doc[:closing]})
+			doc = doc[closing:]
+		}
+	}
+	return tokens
+}
+
+// parseHTMLTag reads the tag at the start of doc, which begins with '<'.
+func parseHTMLTag(doc string) (htmlToken, string, bool) {
+	i := 1
+	tok := htmlToken{}
+	if i < len(doc) && doc[i] == '/' {
+		tok.end = true
+		i++
+	}
+	start := i
+	for i < len(doc) && (isASCIILetter(doc[i]) || (i > start && (doc[i] >= '0' && doc[i] <= '9' || doc[i] == '-' || doc[i] == ':'))) {
+		i++
+	}
+	if i == start {
+		return tok, doc, false
+	}
+	tok.tag = strings.ToLower(doc[start:i])
+	tok.attrs = map[string]string{}
+
+	for i < len(doc) {
+		for i < len(doc) && (isHTMLSpace(doc[i]) || doc[i] == '/') {
+			i++
+		}
+		if i >= len(doc) {
+			break
+		}
+		if doc[i] == '>' {
+			return tok, doc[i+1:], true
+		}
+		nameStart := i
+		for i < len(doc) && !isHTMLSpace(doc[i]) && doc[i] != '=' && doc[i] != '>' && doc[i] != '/' {
+			i++
+		}
+		name := strings.ToLower(doc[nameStart:i])
+		for i < len(doc) && isHTMLSpace(doc[i]) {
+			i++
+		}
+		value := ""
+		if i < len(doc) && doc[i] == '=' {
+			i++
+			for i < len(doc) && isHTMLSpace(doc[i]) {
+				i++
+			}
+			if i < len(doc) && (doc[i] == '"' || doc[i] == '\'') {
+				quote := doc[i]
+				end := strings.IndexByte(doc[i+1:], quote)
+				if end < 0 {
+					return tok, doc, false
+				}
+				value = doc[i+1 : i+1+end]
+				i += end + 2
+			} else {
+				valueStart := i
+				for i < len(doc) && !isHTMLSpace(doc[i]) && doc[i] != '>' {
+					i++
+				}
+				value = doc[valueStart:i]
+			}
+		}
+		if name != "" {
+			tok.attrs[name] = html.UnescapeString(value)
+		}
+	}
+	return tok, doc, false
+}
+
+func isASCIILetter(c byte) bool { return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' }
+func isHTMLSpace(c byte) bool   { return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' }
+
+// readablePage is what extractReadable finds in a page.
+type readablePage struct {
+	Title     string
+	Canonical string
+	Text      string
+}
+
+// htmlSkipTags enclose page furniture rather than content.
+var htmlSkipTags = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true, "svg": true, "iframe": true,
+	"nav": true, "header": true, "footer": true, "aside": true, "form": true, "button": true, "select": true,
+	"textarea": true, "title": true, "head": true,
+}
+
+// htmlBlockTags break the text into paragraphs.
+var htmlBlockTags = map[string]bool{
+	"p": true, "div": true, "section": true, "article": true, "main": true, "br": true, "hr": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "li": true, "ul": true, "ol": true,
+	"blockquote": true, "pre": true, "table": true, "tr": true, "figure": true, "figcaption": true, "dt": true, "dd": true,
+}
+
+// extractReadable pulls the title, canonical URL and article text out of an
+// HTML page. The text comes from the first <article>, else <main>, else the
+// whole body, leaving out navigation, headers, footers, forms and scripts.
+func extractReadable(doc string) readablePage {
+	tokens := tokenizeHTML(doc)
+	page := readablePage{}
+
+	var ogTitle, ogURL, firstH1 string
+	for i, tok := range tokens {
+		if tok.end {
+			continue
+		}
+		switch tok.tag {
+		case "title":
+			if page.Title == "" && i+1 < len(tokens) && tokens[i+1].tag == "" {
+				page.Title = cleanHTMLText(tokens[i+1].text)
+			}
+		case "meta":
+			switch strings.ToLower(tok.attrs["property"]) {
+			case "og:title":
+				ogTitle = strings.TrimSpace(tok.attrs["content"])
+			case "og:url":
+				ogURL = strings.TrimSpace(tok.attrs["content"])
+			}
+		case "link":
+			for _, rel := range strings.Fields(strings.ToLower(tok.attrs["rel"])) {
+				if rel == "canonical" && page.Canonical == "" {
+					page.Canonical = strings.TrimSpace(tok.attrs["href"])
+				}
+			}
+		case "h1":
+			if firstH1 == "" {
+				firstH1 = cleanHTMLText(collectHTMLText(tokens[i+1:], "h1"))
+			}
+		}
+	}
+	if ogTitle != "" {
+		page.Title = ogTitle
+	}
+	if page.Title == "" {
+		page.Title = firstH1
+	}
+	if page.Canonical == "" {
+		page.Canonical = ogURL
+	}
+
+	for _, container := range []string{"article", "main"} {
+		if at := indexHTMLStart(tokens, container); at >= 0 {
+			page.Text = collectHTMLText(tokens[at+1:], container)
+			return page
+		}
+	}
+	page.Text = collectHTMLText(tokens, "")
+	return page
+}
+
+func indexHTMLStart(tokens []htmlToken, tag string) int {
+	for i, tok := range tokens {
+		if tok.tag == tag && !tok.end {
+			return i
+		}
+	}
+	return -1
+}
+
+// collectHTMLText renders tokens as plain text paragraphs, stopping at the
+// end tag closing until (or at the end when until is empty).
+func collectHTMLText(tokens []htmlToken, until string) string {
+	var paragraphs []string
+	var current strings.Builder
+	flush := func() {
+		if text := cleanHTMLText(current.String()); text != "" {
+			paragraphs = append(paragraphs, text)
+		}
+		current.Reset()
+	}
+
+	depth := 0
+	skip, skipDepth := "", 0
+	for _, tok := range tokens {
+		switch {
+		case tok.tag == "":
+			if skip == "" {
+				current.WriteString(tok.text)
+			}
+		case skip != "":
+			if tok.tag == skip {
+				if tok.end {
+					skipDepth--
+				} else {
+					skipDepth++
+				}
+				if skipDepth == 0 {
+					skip = ""
+				}
+			}
+		case htmlSkipTags[tok.tag] && !tok.end:
+			skip, skipDepth = tok.tag, 1
+		case until != "" && tok.tag == until:
+			if tok.end {
+				if depth == 0 {
+					flush()
+					return joinHTMLParagraphs(paragraphs)
+				}
+				depth--
+			} else {
+				depth++
+			}
+		case htmlBlockTags[tok.tag]:
+			flush()
+			if tok.tag == "li" && !tok.end {
+				current.WriteString("- ")
+			}
+		}
+	}
+	flush()
+	return joinHTMLParagraphs(paragraphs)
+}
+
+// joinHTMLParagraphs separates paragraphs with blank lines, keeping the
+// items of a list on consecutive lines.
+func joinHTMLParagraphs(paragraphs []string) string {
+	var out strings.Builder
+	for i, p := range paragraphs {
+		if i > 0 {
+			if strings.HasPrefix(p, "- ") && strings.HasPrefix(paragraphs[i-1], "- ") {
+				out.WriteString("\n")
+			} else {
+				out.WriteString("\n\n")
+			}
+		}
+		out.WriteString(p)
+	}
+	return out.String()
+}
+
+// cleanHTMLText decodes entities and collapses whitespace.
+func cleanHTMLText(s string) string {
+	return strings.Join(strings.Fields(html.UnescapeString(s)), " ")
+}
@@ -0,0 +1,119 @@
+package sbrain
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Limits on what an incident note summarizes and links.
+const (
+	incidentEndpointLimit = 10
+	incidentSampleLimit   = 5
+	incidentLinkLimit     = 500
+)
+
+// defaultIncidentProject files incident notes when SBRAIN_INCIDENT_PROJECT
+// is unset.
+const defaultIncidentProject = "incidents"
+
+// createIncidentNote writes a draft brain record summarizing the logs that
+// made rule fire as event e (the affected endpoints, counts and the most
+// common messages), links those logs to it, and returns its id.
+func (s *Server) createIncidentNote(rule alertRule, e alertEvent, start time.Time) (int64, error) {
+	ctx := withActor(context.Background(), "system")
+	where, args := alertMatchWhere(rule, start)
+
+	endpoints, err := s.incidentCounts(ctx, `COALESCE(NULLIF(endpoint, ''), '(none)')`, where, args, incidentEndpointLimit)
+	if err != nil {
+		return 0, err
+	}
+	samples, err := s.incidentCounts(ctx, `message`, where, args, incidentSampleLimit)
+	if err != nil {
+		return 0, err
+	}
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "Draft opened automatically by alert rule %q: %d matching logs between %s and %s (threshold %d).\n",
+		rule.Name, e.Count, e.WindowStart.Display(), e.WindowEnd.Display(), rule.Threshold)
+	body.WriteString("\n## Endpoints\n\n")
+	for _, c := range endpoints {
+		fmt.Fprintf(&body, "- %s: %d\n", c.Key, c.Count)
+	}
+	body.WriteString("\n## Sample messages\n\n")
+	for _, c := range samples {
+		fmt.Fprintf(&body, "- (%d×) %s\n", c.Count, strings.Join(strings.Fields(c.Key), " "))
+	}
+	body.WriteString("\n## Impact\n\n\n## Cause\n\n\n## Follow-up\n\n")
+
+	project := os.Getenv("SBRAIN_INCIDENT_PROJECT")
+	if project == "" {
+		project = defaultIncidentProject
+	}
+	b, err := s.brains.CreateBrain(ctx, brain{
+		Title:   fmt.Sprintf("Incident: %s (%s)", rule.Name, e.WindowEnd.Display()),
+		Context: body.String(),
+		Project: project,
+		Tags:    "incident,draft",
+	})
+	if err != nil {
+		return 0, err
+	}
+	s.recordAudit(ctx, auditCreate, "brain", b.ID, nil, b)
+
+	ids, err := s.incidentLogIDs(ctx, where, args)
+	if err != nil {
+		return b.ID, err
+	}
+	if _, err := s.logs.LinkLogs(ctx, &b.ID, ids); err != nil {
+		return b.ID, err
+	}
+	return b.ID, nil
+}
+
+// incidentCounts groups the logs matching where by expr, most frequent
+// first.
+func (s *Server) incidentCounts(ctx context.Context, expr, where string, args []any, limit int) ([]countBucket, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+expr+` AS k, SUM(count) AS c FROM logs`+where+`
+		GROUP BY k ORDER BY c DESC, k ASC LIMIT ?`, append(append([]any{}, args...), limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("group incident logs: %w", err)
+	}
+	defer rows.Close()
+
+	var buckets []countBucket
+	for rows.Next() {
+		var b countBucket
+		if err := rows.Scan(&b.Key, &b.Count); err != nil {
+			return nil, fmt.Errorf("scan incident group: %w", err)
+		}
+		buckets = append(buckets, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate incident groups: %w", err)
+	}
+	return buckets, nil
+}
+
+// incidentLogIDs returns the most recent logs matching where that are not
+// already linked to another record.
+func (s *Server) incidentLogIDs(ctx context.Context, where string, args []any) ([]int64, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id FROM logs`+where+` AND brain_id IS NULL
+		ORDER BY occurred_at DESC, id DESC LIMIT ?`, append(append([]any{}, args...), incidentLinkLimit)...)
+	if err != nil {
+		return nil, fmt.Errorf("select incident logs: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scan incident log: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,370 @@
+package sbrain
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"sbrain/store"
+)
+
+// issueKeyPattern matches Jira and Linear issue keys: a team or project
+// key, a dash and a number.
+var issueKeyPattern = regexp.MustCompile(`^[A-Z][A-Z0-9_]*-[0-9]+$`)
+
+// errIssueNotFound is returned by an issue provider that does not know the
+// key.
+var errIssueNotFound = errors.New("issue not found")
+
+// defaultIssueCacheTTL is how long a fetched title and status are shown
+// before GET /brain/{id}/issues fetches them again.
+const defaultIssueCacheTTL = 15 * time.Minute
+
+// brainIssue is an issue linked to a brain record, with the title, status
+// and URL last fetched from its provider (empty until then).
+type brainIssue struct {
+	ID        int64     `json:"id"`
+	CreatedAt timestamp `json:"created_at"`
+	BrainID   int64     `json:"brain_id"`
+	Provider  string    `json:"provider"`
+	Key       string    `json:"key"`
+	Title     string    `json:"title"`
+	Status    string    `json:"status"`
+	URL       string    `json:"url"`
+	FetchedAt timestamp `json:"fetched_at"`
+}
+
+const brainIssueColumns = `id, created_at, brain_id, provider, key, title, status, url, fetched_at`
+
+func scanBrainIssue(row interface{ Scan(...any) error }) (brainIssue, error) {
+	var i brainIssue
+	err := row.Scan(&i.ID, &i.CreatedAt, &i.BrainID, &i.Provider, &i.Key, &i.Title, &i.Status, &i.URL, &i.FetchedAt)
+	return i, err
+}
+
+// issueDetails is what a provider reports about an issue.
+type issueDetails struct {
+	title, status, url string
+}
+
+// issueProvider fetches issues from Jira or Linear.
+type issueProvider interface {
+	fetch(ctx context.Context, key string) (issueDetails, error)
+}
+
+// loadIssueProvider returns the configured client for provider, or nil when
+// its API token is not set. Jira reads SBRAIN_JIRA_URL (the site, such as
+// https://acme.atlassian.net) and SBRAIN_JIRA_TOKEN, sent with
+// SBRAIN_JIRA_EMAIL as basic auth on Jira Cloud or as a bearer personal
+// access token without it. Linear reads SBRAIN_LINEAR_API_KEY.
+func loadIssueProvider(provider string) issueProvider {
+	client := &http.Client{Timeout: 15 * time.Second}
+	switch provider {
+	case "jira":
+		site := strings.TrimRight(strings.TrimSpace(os.Getenv("SBRAIN_JIRA_URL")), "/")
+		token := os.Getenv("SBRAIN_JIRA_TOKEN")
+		if site == "" || token == "" {
+			return nil
+		}
+		return &jiraClient{site: site, email: os.Getenv("SBRAIN_JIRA_EMAIL"), token: token, client: client}
+	case "linear":
+		key := os.Getenv("SBRAIN_LINEAR_API_KEY")
+		if key == "" {
+			return nil
+		}
+		apiURL := strings.TrimSpace(os.Getenv("SBRAIN_LINEAR_API_URL"))
+		if apiURL == "" {
+			apiURL = "https://api.linear.app/graphql"
+		}
+		return &linearClient{apiURL: apiURL, apiKey: key, client: client}
+	}
+	return nil
+}
+
+// issueCacheTTL reads SBRAIN_ISSUE_CACHE_TTL, a duration such as 1h.
+func issueCacheTTL() time.Duration {
+	if d, err := time.ParseDuration(os.Getenv("SBRAIN_ISSUE_CACHE_TTL")); err == nil && d >= 0 {
+		return d
+	}
+	return defaultIssueCacheTTL
+}
+
+type jiraClient struct {
+	site, email, token string
+	client             *http.Client
+}
+
+func (c *jiraClient) fetch(ctx context.Context, key string) (issueDetails, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.site+"/rest/api/2/issue/"+url.PathEscape(key)+"?fields=summary,status", nil)
+	if err != nil {
+		return issueDetails{}, err
+	}
+	if c.email != "" {
+		req.SetBasicAuth(c.email, c.token)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	req.Header.Set("Accept", "application/json")
+	var issue struct {
+		Fields struct {
+			Summary string `json:"summary"`
+			Status  struct {
+				Name string `json:"name"`
+			} `json:"status"`
+		} `json:"fields"`
+	}
+	if err := doIssueRequest(c.client, req, &issue); err != nil {
+		return issueDetails{}, fmt.Errorf("jira: %w", err)
+	}
+	return issueDetails{title: issue.Fields.Summary, status: issue.Fields.Status.Name, url: c.site + "/browse/" + key}, nil
+}
+
+type linearClient struct {
+	apiURL, apiKey string
+	client         *http.Client
+}
+
+func (c *linearClient) fetch(ctx context.Context, key string) (issueDetails, error) {
+	payload, err := json.Marshal(map[string]any{
+		"query":     `query($id: String!) { issue(id: $id) { title url state { name } } }`,
+		"variables": map[string]string{"id": key},
+	})
+	if err != nil {
+		return issueDetails{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.apiURL, bytes.NewReader(payload))
+	if err != nil {
+		return issueDetails{}, err
+	}
+	req.Header.Set("Authorization", c.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+	var resp struct {
+		Data struct {
+			Issue *struct {
+				Title string `json:"title"`
+				URL   string `json:"url"`
+				State struct {
+					Name string `json:"name"`
+				} `json:"state"`
+			} `json:"issue"`
+		} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := doIssueRequest(c.client, req, &resp); err != nil {
+		return issueDetails{}, fmt.Errorf("linear: %w", err)
+	}
+	if resp.Data.Issue == nil {
+		if len(resp.Errors) > 0 && !strings.Contains(strings.ToLower(resp.Errors[0].Message), "not found") {
+			return issueDetails{}, fmt.Errorf("linear: %s", resp.Errors[0].Message)
+		}
+		return issueDetails{}, errIssueNotFound
+	}
+	return issueDetails{title: resp.Data.Issue.Title, status: resp.Data.Issue.State.Name, url: resp.Data.Issue.URL}, nil
+}
+
+// doIssueRequest sends req and decodes the JSON response into out,
+// reporting a 404 as errIssueNotFound.
+func doIssueRequest(client *http.Client, req *http.Request, out any) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return errIssueNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// loadBrainIssues returns the issues linked to a record, oldest link
+// first.
+func (s *Server) loadBrainIssues(ctx context.Context, brainID int64) ([]brainIssue, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+brainIssueColumns+` FROM brain_issues WHERE brain_id = ? ORDER BY id`, brainID)
+	if err != nil {
+		return nil, fmt.Errorf("query issues: %w", err)
+	}
+	defer rows.Close()
+	issues := []brainIssue{}
+	for rows.Next() {
+		i, err := scanBrainIssue(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan issue: %w", err)
+		}
+		issues = append(issues, i)
+	}
+	return issues, rows.Err()
+}
+
+// refreshIssue fetches the issue from its provider and caches the result.
+// A provider without a token leaves the issue as it is.
+func (s *Server) refreshIssue(ctx context.Context, i *brainIssue) error {
+	provider := loadIssueProvider(i.Provider)
+	if provider == nil {
+		return nil
+	}
+	details, err := provider.fetch(ctx, i.Key)
+	if err != nil {
+		return err
+	}
+	i.Title, i.Status, i.URL = details.title, details.status, details.url
+	i.FetchedAt = store.NewTimestamp(time.Now())
+	_, err = s.db.ExecContext(ctx, `UPDATE brain_issues SET title = ?, status = ?, url = ?, fetched_at = ? WHERE id = ?`,
+		i.Title, i.Status, i.URL, i.FetchedAt, i.ID)
+	return err
+}
+
+// listBrainIssues serves GET /brain/{id}/issues. Issues fetched longer ago
+// than SBRAIN_ISSUE_CACHE_TTL (default 15m), or all of them with
+// ?refresh=true, are fetched again first; a failed fetch keeps the cached
+// values.
+func (s *Server) listBrainIssues(w http.ResponseWriter, r *http.Request, id int64) {
+	if !s.brainExists(w, r, id) {
+		return
+	}
+	issues, err := s.loadBrainIssues(r.Context(), id)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	refresh, ttl := r.URL.Query().Get("refresh") == "true", issueCacheTTL()
+	for n := range issues {
+		fetched, ok := issues[n].FetchedAt.Time()
+		if !refresh && ok && time.Since(fetched) < ttl {
+			continue
+		}
+		if err := s.refreshIssue(r.Context(), &issues[n]); err != nil {
+			log.Printf("refresh issue %s %s: %v", issues[n].Provider, issues[n].Key, err)
+		}
+	}
+	writeJSON(w, http.StatusOK, issues)
+}
+
+// linkBrainIssue serves POST /brain/{id}/issues, linking the record to an
+// issue by provider and key and fetching its title and status. An issue
+// the provider does not know is refused; when the provider is unreachable
+// or has no token the link is kept and fetched later.
+func (s *Server) linkBrainIssue(w http.ResponseWriter, r *http.Request, id int64) {
+	var req struct {
+		Provider string `json:"provider"`
+		Key      string `json:"key"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("decode body: %v", err))
+		return
+	}
+	req.Provider = strings.ToLower(strings.TrimSpace(req.Provider))
+	req.Key = strings.ToUpper(strings.TrimSpace(req.Key))
+	var errs []FieldError
+	if req.Provider != "jira" && req.Provider != "linear" {
+		errs = append(errs, FieldError{Field: "provider", Message: "must be jira or linear"})
+	}
+	if !issueKeyPattern.MatchString(req.Key) {
+		errs = append(errs, FieldError{Field: "key", Message: "must be an issue key such as ENG-123"})
+	}
+	if len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+	if !s.brainExists(w, r, id) {
+		return
+	}
+
+	var exists bool
+	if err := s.db.QueryRowContext(r.Context(), `SELECT EXISTS (SELECT 1 FROM brain_issues WHERE brain_id = ? AND provider = ? AND key = ?)`,
+		id, req.Provider, req.Key).Scan(&exists); err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("query issue: %v", err))
+		return
+	}
+	if exists {
+		writeError(w, r, http.StatusConflict, fmt.Sprintf("%s %s is already linked", req.Provider, req.Key))
+		return
+	}
+
+	issue := brainIssue{BrainID: id, Provider: req.Provider, Key: req.Key}
+	var details issueDetails
+	if provider := loadIssueProvider(req.Provider); provider != nil {
+		var err error
+		details, err = provider.fetch(r.Context(), req.Key)
+		switch {
+		case errors.Is(err, errIssueNotFound):
+			writeValidationError(w, r, []FieldError{{Field: "key", Message: fmt.Sprintf("%s has no issue %s", req.Provider, req.Key)}})
+			return
+		case err != nil:
+			log.Printf("fetch issue %s %s: %v", req.Provider, req.Key, err)
+		default:
+			issue.FetchedAt = store.NewTimestamp(time.Now())
+		}
+	}
+	issue.Title, issue.Status, issue.URL = details.title, details.status, details.url
+
+	issue.CreatedAt = store.NewTimestamp(time.Now())
+	res, err := s.db.ExecContext(r.Context(), `INSERT INTO brain_issues (created_at, brain_id, provider, key, title, status, url, fetched_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, issue.CreatedAt, id, issue.Provider, issue.Key, issue.Title, issue.Status, issue.URL, issue.FetchedAt)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("insert issue: %v", err))
+		return
+	}
+	issue.ID, _ = res.LastInsertId()
+	s.recordAudit(r.Context(), auditCreate, "brain_issue", issue.ID, nil, issue)
+	writeJSONStatus(w, http.StatusCreated, issue)
+}
+
+// unlinkBrainIssue serves DELETE /brain/{id}/issues/{issue_id}.
+func (s *Server) unlinkBrainIssue(w http.ResponseWriter, r *http.Request, id int64) {
+	issueID, err := strconv.ParseInt(r.PathValue("issue_id"), 10, 64)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid issue_id")
+		return
+	}
+	issue, err := scanBrainIssue(s.db.QueryRowContext(r.Context(), `SELECT `+brainIssueColumns+` FROM brain_issues WHERE id = ? AND brain_id = ?`, issueID, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, r, http.StatusNotFound, "issue is not linked to this record")
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("query issue: %v", err))
+		return
+	}
+	if _, err := s.db.ExecContext(r.Context(), `DELETE FROM brain_issues WHERE id = ?`, issueID); err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("delete issue: %v", err))
+		return
+	}
+	s.recordAudit(r.Context(), auditDelete, "brain_issue", issueID, issue, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// brainIssueSchema documents a linked issue.
+func brainIssueSchema() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"id":         map[string]any{"type": "integer", "format": "int64"},
+			"created_at": map[string]any{"type": "string", "format": "date-time"},
+			"brain_id":   map[string]any{"type": "integer", "format": "int64"},
+			"provider":   map[string]any{"type": "string", "enum": []string{"jira", "linear"}},
+			"key":        map[string]any{"type": "string", "example": "ENG-123"},
+			"title":      map[string]any{"type": "string", "description": "Cached from the provider; empty until fetched"},
+			"status":     map[string]any{"type": "string"},
+			"url":        map[string]any{"type": "string"},
+			"fetched_at": map[string]any{"type": "string", "format": "date-time", "description": "When title and status were fetched; empty if never"},
+		},
+	}
+}
@@ -0,0 +1,95 @@
+package sbrain
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// defaultLLMModel is used when SBRAIN_LLM_MODEL is unset.
+const defaultLLMModel = "gpt-4o-mini"
+
+// llmClient calls an OpenAI-compatible chat completions API: OpenAI
+// itself, or a local server such as Ollama or llama.cpp that speaks the
+// same protocol.
+type llmClient struct {
+	baseURL string
+	apiKey  string
+	model   string
+	client  *http.Client
+}
+
+// loadLLM reads SBRAIN_LLM_URL (the API base, such as
+// https://api.openai.com/v1), SBRAIN_LLM_API_KEY and SBRAIN_LLM_MODEL. The
+// LLM features are off (nil) when the URL is unset.
+func loadLLM() *llmClient {
+	baseURL := strings.TrimRight(strings.TrimSpace(os.Getenv("SBRAIN_LLM_URL")), "/")
+	if baseURL == "" {
+		return nil
+	}
+	model := strings.TrimSpace(os.Getenv("SBRAIN_LLM_MODEL"))
+	if model == "" {
+		model = defaultLLMModel
+	}
+	return &llmClient{
+		baseURL: baseURL,
+		apiKey:  os.Getenv("SBRAIN_LLM_API_KEY"),
+		model:   model,
+		client:  &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// complete sends a system instruction and a user message and returns the
+// model's reply.
+func (c *llmClient) complete(ctx context.Context, system, user string) (string, error) {
+	payload, err := json.Marshal(map[string]any{
+		"model": c.model,
+		"messages": []map[string]string{
+			{"role": "system", "content": system},
+			{"role": "user", "content": user},
+		},
+		"temperature": 0.2,
+	})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"/chat/completions", bytes.NewReader(payload))
+	if err != nil {
+		return "", fmt.Errorf("build LLM request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("call LLM: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("LLM returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var out struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("decode LLM response: %w", err)
+	}
+	if len(out.Choices) == 0 || strings.TrimSpace(out.Choices[0].Message.Content) == "" {
+		return "", fmt.Errorf("LLM returned no answer")
+	}
+	return strings.TrimSpace(out.Choices[0].Message.Content), nil
+}
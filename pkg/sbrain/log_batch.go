@@ -0,0 +1,75 @@
+package sbrain
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+const (
+	// maxLogBatch bounds the logs in one POST /logs/batch.
+	maxLogBatch      = 1000
+	maxLogBatchBytes = 16 << 20
+)
+
+// logBatchRejection is a log of a batch that failed validation, by its
+// index in the request.
+type logBatchRejection struct {
+	Index  int          `json:"index"`
+	Fields []FieldError `json:"fields"`
+}
+
+type logBatchResult struct {
+	// Stored counts the logs written, including those collapsed into an
+	// earlier one; SampledOut those log sampling dropped.
+	Stored     int                 `json:"stored"`
+	SampledOut int                 `json:"sampled_out"`
+	IDs        []int64             `json:"ids"`
+	Rejected   []logBatchRejection `json:"rejected"`
+}
+
+// logBatchHandler serves POST /logs/batch: a JSON array of logs, each
+// handled as POST /logs would, for agents that ship many lines at once.
+// Invalid logs are reported by index and skipped rather than failing the
+// batch, since resending it would not fix them.
+func (s *Server) logBatchHandler(w http.ResponseWriter, r *http.Request) {
+	var batch []logEntry
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxLogBatchBytes)).Decode(&batch); err != nil {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("decode body: %v", err))
+		return
+	}
+	if len(batch) > maxLogBatch {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("a batch holds at most %d logs", maxLogBatch))
+		return
+	}
+
+	result := logBatchResult{IDs: []int64{}, Rejected: []logBatchRejection{}}
+	for i, req := range batch {
+		errs, err := s.prepareLog(r, &req)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if len(errs) > 0 {
+			result.Rejected = append(result.Rejected, logBatchRejection{Index: i, Fields: errs})
+			continue
+		}
+		id, err := s.insertLog(r.Context(), req)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("%v (%d of the batch stored before the failure)", err, result.Stored))
+			return
+		}
+		if id == 0 {
+			result.SampledOut++
+			continue
+		}
+		result.Stored++
+		result.IDs = append(result.IDs, id)
+		if s.forwarder != nil {
+			if l, err := s.logs.GetLog(r.Context(), id); err == nil {
+				s.forwarder.enqueue(l)
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,47 @@
+package sbrain
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// defaultLogDedupWindow is how long after a log was last seen an identical
+// one is still folded into it, overridable with SBRAIN_LOG_DEDUP_WINDOW.
+const defaultLogDedupWindow = 5 * time.Minute
+
+// logDedup is the log deduplication setting: which levels collapse
+// identical consecutive logs into one row, and within what window.
+type logDedup struct {
+	levels map[string]bool
+	window time.Duration
+}
+
+// loadLogDedup reads SBRAIN_LOG_DEDUP, a comma-separated list of levels or
+// "all", and SBRAIN_LOG_DEDUP_WINDOW. Deduplication is off by default.
+func loadLogDedup() (logDedup, error) {
+	d := logDedup{levels: map[string]bool{}, window: defaultLogDedupWindow}
+	for _, level := range strings.Split(os.Getenv("SBRAIN_LOG_DEDUP"), ",") {
+		level = strings.ToLower(strings.TrimSpace(level))
+		switch {
+		case level == "":
+		case level == "all":
+			for l := range logLevels {
+				d.levels[l] = true
+			}
+		case logLevels[level]:
+			d.levels[level] = true
+		default:
+			return d, fmt.Errorf("invalid SBRAIN_LOG_DEDUP level %q", level)
+		}
+	}
+	if raw := os.Getenv("SBRAIN_LOG_DEDUP_WINDOW"); raw != "" {
+		window, err := time.ParseDuration(raw)
+		if err != nil || window <= 0 {
+			return d, fmt.Errorf("invalid SBRAIN_LOG_DEDUP_WINDOW %q", raw)
+		}
+		d.window = window
+	}
+	return d, nil
+}
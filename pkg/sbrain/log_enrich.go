@@ -0,0 +1,38 @@
+package sbrain
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// enrichLog adds what can be derived from l's IP and user agent to its
+// metadata: the "geo" location when SBRAIN_GEOIP_DB is set, and the parsed
+// "ua" user agent.
+func (s *Server) enrichLog(l *logEntry) {
+	if s.geo != nil {
+		s.geo.enrich(l)
+	}
+	if ua, ok := parseUserAgent(l.UserAgent); ok {
+		addLogMetadata(l, "ua", ua)
+	}
+}
+
+// addLogMetadata sets key in l's metadata. Only empty or JSON object
+// metadata is changed, and a key the client sent itself is kept.
+func addLogMetadata(l *logEntry, key string, value any) {
+	metadata := map[string]any{}
+	if strings.TrimSpace(l.Metadata) != "" {
+		if err := json.Unmarshal([]byte(l.Metadata), &metadata); err != nil || metadata == nil {
+			return
+		}
+	}
+	if _, ok := metadata[key]; ok {
+		return
+	}
+	metadata[key] = value
+	encoded, err := json.Marshal(metadata)
+	if err != nil {
+		return
+	}
+	l.Metadata = string(encoded)
+}
@@ -0,0 +1,101 @@
+package sbrain
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// logExportFlushEvery controls how many CSV rows are buffered before they
+// are flushed to the client.
+const logExportFlushEvery = 500
+
+// logExportHandler streams logs matching the list filters as CSV, one row at
+// a time, so large exports never sit in memory.
+func (s *Server) logExportHandler(w http.ResponseWriter, r *http.Request) {
+	if format := r.URL.Query().Get("format"); format != "" && format != "csv" {
+		writeError(w, r, http.StatusBadRequest, "format must be csv")
+		return
+	}
+
+	filter, err := parseLogFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	where, args := filter.Where()
+	rows, err := s.db.QueryContext(r.Context(), `SELECT id, created_at, occurred_at, level, message, COALESCE(endpoint, ''),
+		COALESCE(method, ''), COALESCE(ip, ''), COALESCE(user_agent, ''), COALESCE(request_id, ''),
+		status_code, response_time_ms, metadata, brain_id, count, COALESCE(last_seen_at, ''), sample_rate
+		FROM logs`+where+` ORDER BY occurred_at DESC, id DESC`, args...)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("query logs: %v", err))
+		return
+	}
+	defer rows.Close()
+
+	filename := fmt.Sprintf("sbrain-logs-%s.csv", time.Now().UTC().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+
+	flusher, _ := w.(http.Flusher)
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"id", "created_at", "occurred_at", "level", "message", "endpoint", "method", "ip", "user_agent",
+		"request_id", "status_code", "response_time_ms", "metadata", "brain_id", "count", "last_seen_at", "sample_rate"})
+
+	record := make([]string, 17)
+	for n := 1; rows.Next(); n++ {
+		var l logEntry
+		var statusCode, responseMs, brainID sql.NullInt64
+		var sampleRate sql.NullFloat64
+		if err := rows.Scan(&l.ID, &l.CreatedAt, &l.OccurredAt, &l.Level, &l.Message, &l.Endpoint, &l.Method, &l.IP,
+			&l.UserAgent, &l.RequestID, &statusCode, &responseMs, &l.Metadata, &brainID, &l.Count, &l.LastSeenAt, &sampleRate); err != nil {
+			// Headers are already sent, so the best we can do is stop.
+			return
+		}
+
+		record[0] = strconv.FormatInt(l.ID, 10)
+		record[1] = l.CreatedAt.Display()
+		record[2] = l.OccurredAt.Display()
+		record[3] = l.Level
+		record[4] = l.Message
+		record[5] = l.Endpoint
+		record[6] = l.Method
+		record[7] = l.IP
+		record[8] = l.UserAgent
+		record[9] = l.RequestID
+		record[10] = nullIntString(statusCode)
+		record[11] = nullIntString(responseMs)
+		record[12] = l.Metadata
+		record[13] = nullIntString(brainID)
+		record[14] = strconv.FormatInt(l.Count, 10)
+		record[15] = l.LastSeenAt.Display()
+		record[16] = ""
+		if sampleRate.Valid {
+			record[16] = strconv.FormatFloat(sampleRate.Float64, 'g', -1, 64)
+		}
+		if err := cw.Write(record); err != nil {
+			return
+		}
+
+		if n%logExportFlushEvery == 0 {
+			cw.Flush()
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+	}
+	cw.Flush()
+}
+
+func nullIntString(v sql.NullInt64) string {
+	if !v.Valid {
+		return ""
+	}
+	return strconv.FormatInt(v.Int64, 10)
+}
@@ -0,0 +1,85 @@
+package sbrain
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"sbrain/store"
+)
+
+// logFilter holds the query-string filters shared by the log list and
+// export endpoints.
+type logFilter = store.LogFilter
+
+func parseLogFilter(q url.Values) (logFilter, error) {
+	f := logFilter{
+		Level:     strings.TrimSpace(q.Get("level")),
+		Endpoint:  strings.TrimSpace(q.Get("endpoint")),
+		Method:    strings.ToUpper(strings.TrimSpace(q.Get("method"))),
+		RequestID: strings.TrimSpace(q.Get("request_id")),
+		Project:   strings.TrimSpace(q.Get("project")),
+		Service:   strings.TrimSpace(q.Get("service")),
+		Country:   strings.ToUpper(strings.TrimSpace(q.Get("country"))),
+		City:      strings.TrimSpace(q.Get("city")),
+	}
+
+	if raw := q.Get("status_code"); raw != "" {
+		code, err := strconv.Atoi(raw)
+		if err != nil {
+			return f, fmt.Errorf("invalid status_code %q", raw)
+		}
+		f.StatusCode = code
+	}
+	if raw := q.Get("brain_id"); raw != "" {
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return f, fmt.Errorf("invalid brain_id %q", raw)
+		}
+		f.BrainID = id
+	}
+	for _, raw := range q["label"] {
+		key, value, _ := strings.Cut(strings.TrimSpace(raw), ":")
+		if !validLabelKey(key) {
+			return f, fmt.Errorf("invalid label %q: expected key or key:value", raw)
+		}
+		f.Labels = append(f.Labels, store.LogLabel{Key: key, Value: value})
+	}
+	for _, bound := range []struct {
+		name string
+		dest *string
+	}{{"since", &f.Since}, {"until", &f.Until}} {
+		raw := q.Get(bound.name)
+		if raw == "" {
+			continue
+		}
+		t, ok := parseTimestamp(raw)
+		if !ok {
+			return f, fmt.Errorf("invalid %s %q: expected RFC 3339 or YYYY-MM-DD", bound.name, raw)
+		}
+		*bound.dest = t.Format(sqliteTimeLayout)
+	}
+
+	return f, nil
+}
+
+// logFilterParameters documents the logFilter query parameters in the
+// OpenAPI spec.
+func logFilterParameters() []map[string]any {
+	return []map[string]any{
+		{"name": "level", "in": "query", "schema": map[string]any{"type": "string"}},
+		{"name": "endpoint", "in": "query", "schema": map[string]any{"type": "string"}},
+		{"name": "method", "in": "query", "schema": map[string]any{"type": "string"}},
+		{"name": "request_id", "in": "query", "schema": map[string]any{"type": "string"}},
+		{"name": "status_code", "in": "query", "schema": map[string]any{"type": "integer"}},
+		{"name": "brain_id", "in": "query", "description": "Logs linked to this brain record", "schema": map[string]any{"type": "integer", "format": "int64"}},
+		{"name": "project", "in": "query", "description": "Logs of this project", "schema": map[string]any{"type": "string"}},
+		{"name": "service", "in": "query", "description": "Logs of this service", "schema": map[string]any{"type": "string"}},
+		{"name": "country", "in": "query", "description": "ISO country code from IP geolocation", "schema": map[string]any{"type": "string"}},
+		{"name": "city", "in": "query", "description": "City from IP geolocation, ignoring case", "schema": map[string]any{"type": "string"}},
+		{"name": "label", "in": "query", "description": "Logs carrying this label, as key:value or just key; repeat to require several", "schema": map[string]any{"type": "array", "items": map[string]any{"type": "string"}}, "style": "form", "explode": true},
+		{"name": "since", "in": "query", "description": "Inclusive lower bound on occurred_at (RFC 3339 or YYYY-MM-DD)", "schema": map[string]any{"type": "string"}},
+		{"name": "until", "in": "query", "description": "Exclusive upper bound on occurred_at (RFC 3339 or YYYY-MM-DD)", "schema": map[string]any{"type": "string"}},
+	}
+}
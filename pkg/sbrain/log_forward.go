@@ -0,0 +1,310 @@
+package sbrain
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"sbrain/store"
+)
+
+const (
+	logForwardQueue      = 10000
+	logForwardBatch      = 100
+	logForwardInterval   = 2 * time.Second
+	logForwardRetry      = time.Second
+	logForwardMaxBackoff = 5 * time.Minute
+)
+
+// logForwarder relays ingested logs to downstream sinks, so sbrain can act
+// as a small log router. SBRAIN_LOG_FORWARD lists the sinks as
+// comma-separated URLs whose fragment, if any, is a log filter in the
+// GET /logs query syntax:
+//
+//   - sbrain+https://:KEY@host: POST each log to another sbrain's /logs
+//   - https://host/path: POST batches as {"source": "sbrain", "logs": [...]}
+//   - file:///path: append each log to the file as a line of JSON
+//
+// Each sink has its own queue. A failed delivery is retried, backing off up
+// to logForwardMaxBackoff, while new logs wait in the queue; once it is
+// full they are dropped and counted rather than holding up ingestion.
+type logForwarder struct {
+	sinks []*logSink
+}
+
+type logSink struct {
+	// target is the sink's URL without credentials, for logs and
+	// /admin/config.
+	target string
+	filter logFilter
+	// deliver sends a batch and returns how many of its logs, from the
+	// start, were delivered.
+	deliver func(batch []logEntry) (int, error)
+
+	queue      chan logEntry
+	dropped    atomic.Int64
+	interval   time.Duration
+	retryDelay time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	lastError string
+}
+
+// loadLogForwarder returns nil when SBRAIN_LOG_FORWARD is unset.
+func loadLogForwarder() (*logForwarder, error) {
+	var f logForwarder
+	for _, raw := range strings.Split(os.Getenv("SBRAIN_LOG_FORWARD"), ",") {
+		if raw = strings.TrimSpace(raw); raw == "" {
+			continue
+		}
+		sink, err := parseLogSink(raw)
+		if err != nil {
+			return nil, fmt.Errorf("SBRAIN_LOG_FORWARD: %w", err)
+		}
+		f.sinks = append(f.sinks, sink)
+	}
+	if len(f.sinks) == 0 {
+		return nil, nil
+	}
+	return &f, nil
+}
+
+func parseLogSink(raw string) (*logSink, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sink: %w", err)
+	}
+	query, err := url.ParseQuery(u.Fragment)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter %q: %w", u.Fragment, err)
+	}
+	filter, err := parseLogFilter(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter %q: %w", u.Fragment, err)
+	}
+	u.Fragment = ""
+
+	sink := &logSink{filter: filter, queue: make(chan logEntry, logForwardQueue), interval: logForwardInterval, retryDelay: logForwardRetry}
+	switch u.Scheme {
+	case "file":
+		if u.Path == "" {
+			return nil, fmt.Errorf("file sink %q has no path", raw)
+		}
+		sink.target, sink.deliver = "file://"+u.Path, appendLogFile(u.Path)
+	case "http", "https":
+		// Only the host is shown: webhook paths are often credentials.
+		target := u.String()
+		sink.target, sink.deliver = u.Scheme+"://"+u.Host, func(batch []logEntry) (int, error) {
+			if err := postJSONWebhook(target, map[string]any{"source": "sbrain", "logs": batch}); err != nil {
+				return 0, err
+			}
+			return len(batch), nil
+		}
+	case "sbrain+http", "sbrain+https":
+		var key string
+		if u.User != nil {
+			key, _ = u.User.Password()
+			if key == "" {
+				key = u.User.Username()
+			}
+		}
+		u.Scheme, u.User = strings.TrimPrefix(u.Scheme, "sbrain+"), nil
+		u.Path = strings.TrimRight(u.Path, "/") + "/logs"
+		sink.target, sink.deliver = u.String(), postToSbrain(u.String(), key)
+	default:
+		return nil, fmt.Errorf("sink %q must be a sbrain+https://, https:// or file:// URL", u.Redacted())
+	}
+	return sink, nil
+}
+
+// describe lists the sinks and how they are doing, for /admin/config.
+func (f *logForwarder) describe() map[string]any {
+	if f == nil {
+		return map[string]any{"enabled": false}
+	}
+	sinks := make([]map[string]any, 0, len(f.sinks))
+	for _, sink := range f.sinks {
+		sink.mu.Lock()
+		desc := map[string]any{"target": sink.target, "queued": len(sink.queue), "failures": sink.failures}
+		if sink.lastError != "" {
+			desc["last_error"] = sink.lastError
+		}
+		sink.mu.Unlock()
+		sinks = append(sinks, desc)
+	}
+	return map[string]any{"enabled": true, "sinks": sinks}
+}
+
+// start runs every sink's delivery loop until ctx is done, tracking them
+// in jobs.
+func (f *logForwarder) start(ctx context.Context, jobs *sync.WaitGroup) {
+	if f == nil {
+		return
+	}
+	for _, sink := range f.sinks {
+		jobs.Add(1)
+		go func() {
+			defer jobs.Done()
+			sink.run(ctx)
+		}()
+	}
+}
+
+// enqueue queues the log stored as id for every sink whose filter it
+// matches. It never blocks.
+func (f *logForwarder) enqueue(ctx context.Context, l logEntry, id int64) {
+	if f == nil || id == 0 {
+		return
+	}
+	l.ID, l.Count, l.CreatedAt = id, 1, store.NewTimestamp(time.Now())
+	if l.OccurredAt == "" {
+		l.OccurredAt = l.CreatedAt
+	}
+	if project, ok := store.ProjectFromContext(ctx); ok {
+		l.Project = project
+	}
+	for _, sink := range f.sinks {
+		if !sink.filter.Matches(l) {
+			continue
+		}
+		select {
+		case sink.queue <- l:
+		default:
+			sink.dropped.Add(1)
+		}
+	}
+}
+
+// run sends queued logs in batches of up to logForwardBatch, at least every
+// interval while any are waiting, retrying a failed batch until it goes
+// through.
+func (s *logSink) run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	var batch []logEntry
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case l := <-s.queue:
+			batch = append(batch, l)
+			if len(batch) < logForwardBatch {
+				continue
+			}
+		case <-ticker.C:
+			if n := s.dropped.Swap(0); n > 0 {
+				log.Printf("warning: log forwarding to %s: queue full, dropped %d logs", s.target, n)
+			}
+			if len(batch) == 0 {
+				continue
+			}
+		}
+		s.send(ctx, batch)
+		batch = nil
+	}
+}
+
+// send delivers batch, backing off between attempts, until it goes through
+// or ctx is done.
+func (s *logSink) send(ctx context.Context, batch []logEntry) {
+	delay := s.retryDelay
+	for {
+		sent, err := s.deliver(batch)
+		batch = batch[sent:]
+		s.mu.Lock()
+		if err == nil {
+			s.failures, s.lastError = 0, ""
+		} else {
+			s.failures++
+			s.lastError = err.Error()
+		}
+		failures := s.failures
+		s.mu.Unlock()
+		if err == nil {
+			return
+		}
+		log.Printf("warning: log forwarding to %s failed (%d in a row), retrying %d logs in %s: %v", s.target, failures, len(batch), delay, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, logForwardMaxBackoff)
+	}
+}
+
+// appendLogFile appends batches to the file at path as JSON lines. The file
+// is opened for each batch, so it can be rotated underneath.
+func appendLogFile(path string) func([]logEntry) (int, error) {
+	return func(batch []logEntry) (int, error) {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		for _, l := range batch {
+			if err := enc.Encode(l); err != nil {
+				return 0, err
+			}
+		}
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			return 0, err
+		}
+		_, err = file.Write(buf.Bytes())
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return 0, err
+		}
+		return len(batch), nil
+	}
+}
+
+// postToSbrain posts each log of a batch to another sbrain's POST /logs
+// with key. Logs it rejects as invalid are skipped, since retrying cannot
+// fix them; other failures stop the batch there.
+func postToSbrain(endpoint, key string) func([]logEntry) (int, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	return func(batch []logEntry) (int, error) {
+		for i, l := range batch {
+			// The id, brain and deduplication count only mean something here.
+			l.ID, l.CreatedAt, l.BrainID, l.Count, l.LastSeenAt = 0, "", nil, 0, ""
+			body, err := json.Marshal(l)
+			if err != nil {
+				return i, err
+			}
+			req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+			if err != nil {
+				return i, err
+			}
+			req.Header.Set("Content-Type", "application/json")
+			if key != "" {
+				req.Header.Set("Authorization", "Bearer "+key)
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				return i, err
+			}
+			detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+			resp.Body.Close()
+			switch {
+			case resp.StatusCode < 300:
+			case resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnprocessableEntity:
+				log.Printf("warning: log forwarding to %s: log %d rejected, skipping it: %s", endpoint, batch[i].ID, bytes.TrimSpace(detail))
+			default:
+				return i, fmt.Errorf("%s answered %s", endpoint, resp.Status)
+			}
+		}
+		return len(batch), nil
+	}
+}
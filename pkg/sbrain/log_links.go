@@ -0,0 +1,103 @@
+package sbrain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"sbrain/store"
+)
+
+// brainLogs serves GET /brain/{id}/logs: the logs linked to a brain record,
+// narrowed by the usual log filters.
+func (s *Server) brainLogs(w http.ResponseWriter, r *http.Request, id int64) {
+	if !s.brainExists(w, r, id) {
+		return
+	}
+	filter, err := parseLogFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	filter.BrainID = id
+
+	items := []logEntry{}
+	if err := s.logs.ListLogs(r.Context(), filter, func(l logEntry) error {
+		items = append(items, l)
+		return nil
+	}); err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+// linkBrainLogs serves POST /brain/{id}/logs, linking existing logs to the
+// record. A log already linked elsewhere moves to this record.
+func (s *Server) linkBrainLogs(w http.ResponseWriter, r *http.Request, id int64) {
+	var req struct {
+		LogIDs []int64 `json:"log_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("decode body: %v", err))
+		return
+	}
+	if len(req.LogIDs) == 0 {
+		writeValidationError(w, r, []FieldError{{Field: "log_ids", Message: "is required"}})
+		return
+	}
+	if !s.brainExists(w, r, id) {
+		return
+	}
+
+	n, err := s.logs.LinkLogs(r.Context(), &id, req.LogIDs)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int64{"linked": n})
+}
+
+// unlinkBrainLog serves DELETE /brain/{id}/logs/{log_id}.
+func (s *Server) unlinkBrainLog(w http.ResponseWriter, r *http.Request, id int64) {
+	logID, err := strconv.ParseInt(r.PathValue("log_id"), 10, 64)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "invalid log_id")
+		return
+	}
+	l, err := s.logs.GetLog(r.Context(), logID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, r, http.StatusNotFound, "not found")
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if l.BrainID == nil || *l.BrainID != id {
+		writeError(w, r, http.StatusNotFound, "log is not linked to this record")
+		return
+	}
+
+	if _, err := s.logs.LinkLogs(r.Context(), nil, []int64{logID}); err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// brainExists answers 404 (or 500) and returns false unless the brain record
+// with id exists.
+func (s *Server) brainExists(w http.ResponseWriter, r *http.Request, id int64) bool {
+	if _, err := s.brains.GetBrain(r.Context(), id); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, r, http.StatusNotFound, "not found")
+			return false
+		}
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	return true
+}
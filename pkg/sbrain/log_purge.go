@@ -0,0 +1,69 @@
+package sbrain
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"sbrain/store"
+)
+
+// logPurgeBatchSize caps the rows deleted per transaction by POST
+// /logs/purge, so ingestion is not blocked behind one long write.
+const logPurgeBatchSize = 1000
+
+func (s *Server) deleteLog(w http.ResponseWriter, r *http.Request, id int64) {
+	l, err := s.logs.GetLog(r.Context(), id)
+	if err == nil {
+		err = s.logs.DeleteLog(r.Context(), id)
+	}
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, r, http.StatusNotFound, "not found")
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.recordAudit(r.Context(), auditDelete, "log", id, l, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// logPurgeHandler deletes every log matching the list filters, plus before
+// (an alias for until). At least one filter is required so a bare request
+// cannot empty the table.
+func (s *Server) logPurgeHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter, err := parseLogFilter(q)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if raw := q.Get("before"); raw != "" {
+		if filter.Until != "" {
+			writeError(w, r, http.StatusBadRequest, "use before or until, not both")
+			return
+		}
+		t, ok := parseTimestamp(raw)
+		if !ok {
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("invalid before %q: expected RFC 3339 or YYYY-MM-DD", raw))
+			return
+		}
+		filter.Until = t.Format(sqliteTimeLayout)
+	}
+	if filter.IsZero() {
+		writeError(w, r, http.StatusBadRequest, "at least one filter is required")
+		return
+	}
+
+	deleted, err := s.logs.PurgeLogs(r.Context(), filter, logPurgeBatchSize)
+	if deleted > 0 {
+		s.recordAudit(r.Context(), auditPurge, "logs", 0, nil, map[string]any{"filter": r.URL.RawQuery, "deleted": deleted})
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("%v (%d deleted before the failure)", err, deleted))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]int64{"deleted": deleted})
+}
@@ -0,0 +1,81 @@
+package sbrain
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// logSampling keeps a fraction of the logs at some levels or endpoints and
+// drops the rest at ingestion.
+type logSampling struct {
+	levels    map[string]float64
+	endpoints []endpointSampleRate
+}
+
+// endpointSampleRate is one endpoint rule: an exact path, or a prefix when
+// written with a trailing "*".
+type endpointSampleRate struct {
+	path   string
+	prefix bool
+	rate   float64
+}
+
+// loadLogSampling reads SBRAIN_LOG_SAMPLING, comma-separated rules of
+// level=rate or /endpoint=rate (with an optional trailing * for a prefix),
+// such as "debug=0.1,/healthz=0.01,/api/*=0.5". Rates are between 0 and 1.
+func loadLogSampling() (logSampling, error) {
+	ls := logSampling{levels: map[string]float64{}}
+	for _, rule := range strings.Split(os.Getenv("SBRAIN_LOG_SAMPLING"), ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		key, raw, ok := strings.Cut(rule, "=")
+		key = strings.TrimSpace(key)
+		rate, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+		if !ok || err != nil || rate < 0 || rate > 1 {
+			return ls, fmt.Errorf("invalid SBRAIN_LOG_SAMPLING rule %q: expected level=rate or /endpoint=rate with a rate from 0 to 1", rule)
+		}
+		switch {
+		case strings.HasPrefix(key, "/"):
+			path, prefix := strings.CutSuffix(key, "*")
+			ls.endpoints = append(ls.endpoints, endpointSampleRate{path: path, prefix: prefix, rate: rate})
+		case logLevels[strings.ToLower(key)]:
+			ls.levels[strings.ToLower(key)] = rate
+		default:
+			return ls, fmt.Errorf("invalid SBRAIN_LOG_SAMPLING rule %q: %q is neither a level nor an endpoint", rule, key)
+		}
+	}
+	return ls, nil
+}
+
+// rate returns the fraction of logs like l to keep. The first endpoint
+// rule matching l's endpoint wins over its level's rule; logs neither
+// covers are all kept.
+func (ls logSampling) rate(l logEntry) float64 {
+	for _, e := range ls.endpoints {
+		if l.Endpoint == e.path || (e.prefix && strings.HasPrefix(l.Endpoint, e.path)) {
+			return e.rate
+		}
+	}
+	if rate, ok := ls.levels[l.Level]; ok {
+		return rate
+	}
+	return 1
+}
+
+// sample decides whether to keep l, marking a kept log with its rate.
+func (ls logSampling) sample(l *logEntry) bool {
+	rate := ls.rate(*l)
+	if rate >= 1 {
+		return true
+	}
+	if rand.Float64() >= rate {
+		return false
+	}
+	l.Sampled, l.SampleRate = true, rate
+	return true
+}
@@ -0,0 +1,152 @@
+package sbrain
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// logServiceHeader names the service of the logs a request ingests when
+// the logs themselves do not.
+const logServiceHeader = "X-Sbrain-Service"
+
+// internalLogService is the service of the logs sbrain writes itself:
+// heartbeat changes, monitor checks and recovered panics.
+const internalLogService = "sbrain"
+
+// errLogServiceRequired is returned by insertLog for a log without a
+// service when Options.RequireLogService is set.
+var errLogServiceRequired = errors.New("service is required: name it in the log, the X-Sbrain-Service header or the API key")
+
+// ingestErrorStatus is the status for a failed insertLog: 400 for a log
+// without a required service, 500 otherwise.
+func ingestErrorStatus(err error) int {
+	if errors.Is(err, errLogServiceRequired) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// defaultLogService is the service of logs r ingests that name none: the
+// X-Sbrain-Service header, or else the API key's service.
+func defaultLogService(r *http.Request) string {
+	p, _ := principalFromContext(r.Context())
+	return cmp.Or(strings.TrimSpace(r.Header.Get(logServiceHeader)), p.Service)
+}
+
+// requestLogService is defaultLogService for the ingestion endpoints other
+// than POST /logs, answering 400 when the header names an invalid service.
+func requestLogService(w http.ResponseWriter, r *http.Request) (string, bool) {
+	service := defaultLogService(r)
+	if service != "" && !validLogService(service) {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("invalid service %q", service))
+		return "", false
+	}
+	return service, true
+}
+
+// logRetention is how long logs are kept, per service, as
+// SBRAIN_LOG_RETENTION sets it: comma-separated "service=days" rules and
+// an optional "*=days" for every other service, including logs with none.
+// Logs of services without a rule are kept until purged by hand.
+type logRetention struct {
+	services    map[string]int
+	defaultDays int
+}
+
+func loadLogRetention() (logRetention, error) {
+	ret := logRetention{services: map[string]int{}}
+	for _, rule := range strings.Split(os.Getenv("SBRAIN_LOG_RETENTION"), ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		service, raw, ok := strings.Cut(rule, "=")
+		service = strings.TrimSpace(service)
+		days, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(raw), "d"))
+		if !ok || err != nil || days <= 0 {
+			return ret, fmt.Errorf("SBRAIN_LOG_RETENTION: rule %q must be service=days with days above 0", rule)
+		}
+		switch {
+		case service == "*":
+			ret.defaultDays = days
+		case validLogService(service):
+			ret.services[service] = days
+		default:
+			return ret, fmt.Errorf("SBRAIN_LOG_RETENTION: invalid service %q", service)
+		}
+	}
+	return ret, nil
+}
+
+func (ret logRetention) enabled() bool {
+	return len(ret.services) > 0 || ret.defaultDays > 0
+}
+
+func (ret logRetention) describe() map[string]any {
+	desc := map[string]any{"services": ret.services}
+	if ret.defaultDays > 0 {
+		desc["default_days"] = ret.defaultDays
+	}
+	return desc
+}
+
+// runLogRetention purges expired logs every hour.
+func (s *Server) runLogRetention(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.purgeExpiredLogs(time.Now()); err != nil {
+			log.Printf("log retention: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeExpiredLogs deletes the logs that occurred longer ago than their
+// service's retention allows and returns how many it deleted.
+func (s *Server) purgeExpiredLogs(now time.Time) (int64, error) {
+	ctx := withActor(context.Background(), "system")
+	services := make([]string, 0, len(s.logRetention.services))
+	for service := range s.logRetention.services {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+
+	var total int64
+	purge := func(filter logFilter, days int) error {
+		filter.Until = now.UTC().Add(-time.Duration(days) * 24 * time.Hour).Format(sqliteTimeLayout)
+		deleted, err := s.logs.PurgeLogs(ctx, filter, logPurgeBatchSize)
+		total += deleted
+		if deleted > 0 {
+			s.recordAudit(ctx, auditPurge, "logs", 0, nil, map[string]any{
+				"service": cmp.Or(filter.Service, "*"), "retention_days": days, "deleted": deleted,
+			})
+		}
+		return err
+	}
+	for _, service := range services {
+		if err := purge(logFilter{Service: service}, s.logRetention.services[service]); err != nil {
+			return total, fmt.Errorf("purge %s logs: %w", service, err)
+		}
+	}
+	if s.logRetention.defaultDays > 0 {
+		if err := purge(logFilter{ExcludeServices: services}, s.logRetention.defaultDays); err != nil {
+			return total, fmt.Errorf("purge logs: %w", err)
+		}
+	}
+	return total, nil
+}
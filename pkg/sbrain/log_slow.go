@@ -0,0 +1,159 @@
+package sbrain
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"sbrain/store"
+)
+
+// responseTimeBuckets are the lower bounds, in ms, of the response-time
+// histogram, matching the response_time_bucket column.
+var responseTimeBuckets = []int64{0, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+const (
+	defaultSlowThresholdMs = 500
+	defaultSlowWindow      = 24 * time.Hour
+	defaultSlowLimit       = 20
+)
+
+// histogramBucket counts responses with ge <= response_time_ms < lt. The last
+// bucket has no upper bound.
+type histogramBucket struct {
+	GE    int64  `json:"ge"`
+	LT    *int64 `json:"lt"`
+	Count int64  `json:"count"`
+}
+
+type slowEndpoint struct {
+	Endpoint  string            `json:"endpoint"`
+	Slow      int64             `json:"slow"`
+	SlowRatio float64           `json:"slow_ratio"`
+	Max       int64             `json:"max"`
+	Latency   latencySummary    `json:"response_time_ms"`
+	Histogram []histogramBucket `json:"histogram"`
+}
+
+type slowReport struct {
+	Since       timestamp      `json:"since"`
+	ThresholdMs int64          `json:"threshold_ms"`
+	Endpoints   []slowEndpoint `json:"endpoints"`
+}
+
+// slowLogsHandler serves GET /logs/slow: endpoints that served at least one
+// request in threshold ms or more within window, those with the most slow
+// requests first.
+func (s *Server) slowLogsHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	threshold := int64(defaultSlowThresholdMs)
+	if raw := q.Get("threshold"); raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n < 0 {
+			writeError(w, r, http.StatusBadRequest, "threshold must be a non-negative number of milliseconds")
+			return
+		}
+		threshold = n
+	}
+	window := defaultSlowWindow
+	if raw := q.Get("window"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			writeError(w, r, http.StatusBadRequest, "window must be a positive duration such as 24h")
+			return
+		}
+		window = d
+	}
+	limit := defaultSlowLimit
+	if raw := q.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			writeError(w, r, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		limit = n
+	}
+
+	report, err := s.slowReport(r.Context(), store.NewTimestamp(time.Now().Add(-window)), threshold, limit)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+func (s *Server) slowReport(ctx context.Context, since timestamp, threshold int64, limit int) (slowReport, error) {
+	report := slowReport{Since: since, ThresholdMs: threshold, Endpoints: []slowEndpoint{}}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT COALESCE(endpoint, ''), COUNT(*),
+		SUM(CASE WHEN response_time_ms >= ? THEN 1 ELSE 0 END) AS slow, MAX(response_time_ms)
+		FROM logs WHERE occurred_at >= ? AND response_time_ms IS NOT NULL
+		GROUP BY 1 HAVING slow > 0 ORDER BY slow DESC, MAX(response_time_ms) DESC LIMIT ?`, threshold, since, limit)
+	if err != nil {
+		return report, fmt.Errorf("group slow logs: %w", err)
+	}
+	defer rows.Close()
+
+	var totals []int64
+	for rows.Next() {
+		var e slowEndpoint
+		var total int64
+		if err := rows.Scan(&e.Endpoint, &total, &e.Slow, &e.Max); err != nil {
+			return report, fmt.Errorf("scan slow endpoint: %w", err)
+		}
+		e.SlowRatio = float64(e.Slow) / float64(total)
+		report.Endpoints = append(report.Endpoints, e)
+		totals = append(totals, total)
+	}
+	if err := rows.Err(); err != nil {
+		return report, fmt.Errorf("iterate slow endpoints: %w", err)
+	}
+	rows.Close()
+
+	for i := range report.Endpoints {
+		e := &report.Endpoints[i]
+		where, args := ` WHERE occurred_at >= ? AND COALESCE(endpoint, '') = ?`, []any{since, e.Endpoint}
+		if e.Latency, err = s.latencyPercentiles(ctx, where, args); err != nil {
+			return report, err
+		}
+		if e.Histogram, err = s.responseTimeHistogram(ctx, where, args); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// responseTimeHistogram counts the logs matching where per
+// response_time_bucket, including empty buckets so every histogram has the
+// same shape.
+func (s *Server) responseTimeHistogram(ctx context.Context, where string, args []any) ([]histogramBucket, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT response_time_bucket, COUNT(*) FROM logs`+where+`
+		AND response_time_bucket IS NOT NULL GROUP BY response_time_bucket`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("bucket response times: %w", err)
+	}
+	defer rows.Close()
+
+	counts := map[int64]int64{}
+	for rows.Next() {
+		var bucket, count int64
+		if err := rows.Scan(&bucket, &count); err != nil {
+			return nil, fmt.Errorf("scan response time bucket: %w", err)
+		}
+		counts[bucket] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate response time buckets: %w", err)
+	}
+
+	histogram := make([]histogramBucket, len(responseTimeBuckets))
+	for i, ge := range responseTimeBuckets {
+		histogram[i] = histogramBucket{GE: ge, Count: counts[ge]}
+		if i+1 < len(responseTimeBuckets) {
+			histogram[i].LT = &responseTimeBuckets[i+1]
+		}
+	}
+	return histogram, nil
+}
@@ -0,0 +1,200 @@
+package sbrain
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+)
+
+type countBucket struct {
+	Key   string `json:"key"`
+	Count int64  `json:"count"`
+}
+
+type timeBucket struct {
+	Bucket string `json:"bucket"`
+	Count  int64  `json:"count"`
+	Errors int64  `json:"errors"`
+}
+
+type latencySummary struct {
+	Count int64    `json:"count"`
+	Avg   *float64 `json:"avg"`
+	P50   *int64   `json:"p50"`
+	P95   *int64   `json:"p95"`
+	P99   *int64   `json:"p99"`
+}
+
+type logStats struct {
+	Total          int64          `json:"total"`
+	ByLevel        []countBucket  `json:"by_level"`
+	ByService      []countBucket  `json:"by_service"`
+	ByEndpoint     []countBucket  `json:"by_endpoint"`
+	ByStatusClass  []countBucket  `json:"by_status_class"`
+	ByBrowser      []countBucket  `json:"by_browser"`
+	ByOS           []countBucket  `json:"by_os"`
+	ByDevice       []countBucket  `json:"by_device"`
+	ByTime         []timeBucket   `json:"by_time"`
+	ResponseTimeMs latencySummary `json:"response_time_ms"`
+}
+
+// timeBucketFormats maps the ?bucket= values to SQLite strftime formats.
+var timeBucketFormats = map[string]string{
+	"hour": "%Y-%m-%d %H:00",
+	"day":  "%Y-%m-%d",
+}
+
+// logStatsHandler aggregates logs matching the list filters. Grouping and
+// percentile selection are done in SQL so the rows never leave the database.
+func (s *Server) logStatsHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseLogFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	bucket := r.URL.Query().Get("bucket")
+	if bucket == "" {
+		bucket = "hour"
+	}
+	bucketFormat, ok := timeBucketFormats[bucket]
+	if !ok {
+		writeError(w, r, http.StatusBadRequest, "bucket must be hour or day")
+		return
+	}
+
+	stats, err := s.computeLogStats(r.Context(), filter, bucketFormat)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+func (s *Server) computeLogStats(ctx context.Context, filter logFilter, bucketFormat string) (logStats, error) {
+	where, args := filter.Where()
+	stats := logStats{}
+
+	if err := s.db.QueryRowContext(ctx, `SELECT COALESCE(SUM(count), 0) FROM logs`+where, args...).Scan(&stats.Total); err != nil {
+		return stats, fmt.Errorf("count logs: %w", err)
+	}
+
+	var err error
+	if stats.ByLevel, err = s.countBuckets(ctx, `level`, where, args); err != nil {
+		return stats, err
+	}
+	if stats.ByService, err = s.countBuckets(ctx, `service`, where, args); err != nil {
+		return stats, err
+	}
+	if stats.ByEndpoint, err = s.countBuckets(ctx, `COALESCE(endpoint, '')`, where, args); err != nil {
+		return stats, err
+	}
+	if stats.ByStatusClass, err = s.countBuckets(ctx, statusClassExpr, where, args); err != nil {
+		return stats, err
+	}
+	if stats.ByBrowser, err = s.countBuckets(ctx, metadataExpr("$.ua.browser"), where, args); err != nil {
+		return stats, err
+	}
+	if stats.ByOS, err = s.countBuckets(ctx, metadataExpr("$.ua.os"), where, args); err != nil {
+		return stats, err
+	}
+	if stats.ByDevice, err = s.countBuckets(ctx, metadataExpr("$.ua.device"), where, args); err != nil {
+		return stats, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT strftime(?, occurred_at) AS bucket, SUM(count),
+		SUM(CASE WHEN level IN ('error', 'fatal') THEN count ELSE 0 END)
+		FROM logs`+where+` GROUP BY bucket ORDER BY bucket`, append([]any{bucketFormat}, args...)...)
+	if err != nil {
+		return stats, fmt.Errorf("bucket logs: %w", err)
+	}
+	defer rows.Close()
+
+	stats.ByTime = []timeBucket{}
+	for rows.Next() {
+		var b timeBucket
+		var bucket sql.NullString
+		if err := rows.Scan(&bucket, &b.Count, &b.Errors); err != nil {
+			return stats, fmt.Errorf("scan bucket: %w", err)
+		}
+		b.Bucket = bucket.String
+		stats.ByTime = append(stats.ByTime, b)
+	}
+	if err := rows.Err(); err != nil {
+		return stats, fmt.Errorf("iterate buckets: %w", err)
+	}
+
+	stats.ResponseTimeMs, err = s.latencyPercentiles(ctx, where, args)
+	return stats, err
+}
+
+// statusClassExpr buckets status codes into "2xx", "4xx", ... and "none".
+const statusClassExpr = `CASE WHEN status_code IS NULL THEN 'none'
+	ELSE CAST(status_code / 100 AS TEXT) || 'xx' END`
+
+// metadataExpr extracts the JSON path from metadata as text, or an empty
+// string when it is missing or the metadata is not JSON.
+func metadataExpr(path string) string {
+	return `COALESCE(json_extract(CASE WHEN json_valid(metadata) THEN metadata END, '` + path + `'), '')`
+}
+
+func (s *Server) countBuckets(ctx context.Context, expr string, where string, args []any) ([]countBucket, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+expr+` AS k, SUM(count) AS c FROM logs`+where+`
+		GROUP BY k ORDER BY c DESC, k ASC`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("group logs: %w", err)
+	}
+	defer rows.Close()
+
+	buckets := []countBucket{}
+	for rows.Next() {
+		var b countBucket
+		if err := rows.Scan(&b.Key, &b.Count); err != nil {
+			return nil, fmt.Errorf("scan group: %w", err)
+		}
+		buckets = append(buckets, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate groups: %w", err)
+	}
+	return buckets, nil
+}
+
+// latencyPercentiles computes nearest-rank p50/p95/p99 of response_time_ms by
+// letting SQLite sort and seek to each rank.
+func (s *Server) latencyPercentiles(ctx context.Context, where string, args []any) (latencySummary, error) {
+	clause := " WHERE response_time_ms IS NOT NULL"
+	if where != "" {
+		clause = where + " AND response_time_ms IS NOT NULL"
+	}
+
+	var summary latencySummary
+	var avg sql.NullFloat64
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*), AVG(response_time_ms) FROM logs`+clause, args...).Scan(&summary.Count, &avg); err != nil {
+		return summary, fmt.Errorf("summarize response times: %w", err)
+	}
+	if summary.Count == 0 {
+		return summary, nil
+	}
+	if avg.Valid {
+		summary.Avg = &avg.Float64
+	}
+
+	for _, p := range []struct {
+		rank float64
+		dest **int64
+	}{{0.50, &summary.P50}, {0.95, &summary.P95}, {0.99, &summary.P99}} {
+		offset := int64(math.Ceil(p.rank*float64(summary.Count))) - 1
+		if offset < 0 {
+			offset = 0
+		}
+		var value int64
+		if err := s.db.QueryRowContext(ctx, `SELECT response_time_ms FROM logs`+clause+`
+			ORDER BY response_time_ms LIMIT 1 OFFSET ?`, append(append([]any{}, args...), offset)...).Scan(&value); err != nil {
+			return summary, fmt.Errorf("select percentile: %w", err)
+		}
+		*p.dest = &value
+	}
+	return summary, nil
+}
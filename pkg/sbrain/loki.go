@@ -0,0 +1,290 @@
+package sbrain
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"sbrain/store"
+)
+
+const (
+	// maxLokiPushBytes bounds a push request body before decompression, and
+	// maxLokiDecodedBytes after it.
+	maxLokiPushBytes    = 10 << 20
+	maxLokiDecodedBytes = 10 * maxLokiPushBytes
+)
+
+// lokiEntry is one log line from a push request, with its stream's labels.
+type lokiEntry struct {
+	Labels             map[string]string
+	Timestamp          time.Time
+	Line               string
+	StructuredMetadata map[string]string
+}
+
+// lokiPushHandler implements Loki's POST /loki/api/v1/push so Promtail,
+// Grafana Agent and other Loki clients can ship logs here unmodified. Both
+// encodings Loki accepts are supported: snappy-compressed protobuf (the
+// clients' default) and JSON, optionally gzipped.
+func (s *Server) lokiPushHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxLokiPushBytes))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("read body: %v", err))
+		return
+	}
+
+	var entries []lokiEntry
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			if body, err = gunzip(body); err != nil {
+				writeError(w, r, http.StatusBadRequest, fmt.Sprintf("decompress body: %v", err))
+				return
+			}
+		}
+		entries, err = parseLokiJSON(body)
+	} else {
+		var raw []byte
+		if raw, err = snappyDecode(body, maxLokiDecodedBytes); err == nil {
+			entries, err = parseLokiProtobuf(raw)
+		}
+	}
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("decode push request: %v", err))
+		return
+	}
+
+	ip, _, _ := net.SplitHostPort(r.RemoteAddr)
+	service, ok := requestLogService(w, r)
+	if !ok {
+		return
+	}
+	for _, e := range entries {
+		metadata := map[string]any{
+			"labels":    e.Labels,
+			"timestamp": e.Timestamp.UTC().Format(time.RFC3339Nano),
+		}
+		if len(e.StructuredMetadata) > 0 {
+			metadata["structured_metadata"] = e.StructuredMetadata
+		}
+		encoded, _ := json.Marshal(metadata)
+
+		level := "info"
+		for _, key := range []string{"level", "severity", "detected_level", "lvl"} {
+			if v := firstNonEmpty(e.StructuredMetadata[key], e.Labels[key]); v != "" {
+				level = normalizeLevel(v)
+				break
+			}
+		}
+
+		if _, err := s.insertLog(r.Context(), logEntry{
+			OccurredAt: store.NewTimestamp(e.Timestamp),
+			Level:      level,
+			Message:    e.Line,
+			IP:         ip,
+			UserAgent:  r.UserAgent(),
+			Metadata:   string(encoded),
+			Service:    lokiService(e.Labels, service),
+			Labels:     e.Labels,
+		}); err != nil {
+			writeError(w, r, ingestErrorStatus(err), err.Error())
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// lokiService is the first of a stream's service_name, service, app and
+// job labels that can name a service, or else fallback.
+func lokiService(labels map[string]string, fallback string) string {
+	for _, key := range []string{"service_name", "service", "app", "job"} {
+		if validLogService(labels[key]) {
+			return labels[key]
+		}
+	}
+	return fallback
+}
+
+func parseLokiJSON(body []byte) ([]lokiEntry, error) {
+	var req struct {
+		Streams []struct {
+			Stream map[string]string `json:"stream"`
+			Values [][]any           `json:"values"`
+		} `json:"streams"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+
+	var entries []lokiEntry
+	for _, stream := range req.Streams {
+		for _, value := range stream.Values {
+			if len(value) < 2 {
+				return nil, errors.New("each value must be [timestamp, line]")
+			}
+			tsText, _ := value[0].(string)
+			line, ok := value[1].(string)
+			ns, err := strconv.ParseInt(tsText, 10, 64)
+			if err != nil || !ok {
+				return nil, fmt.Errorf("invalid value [%v, %v]", value[0], value[1])
+			}
+			e := lokiEntry{Labels: stream.Stream, Timestamp: time.Unix(0, ns), Line: line}
+			if len(value) > 2 {
+				if fields, ok := value[2].(map[string]any); ok {
+					e.StructuredMetadata = map[string]string{}
+					for k, v := range fields {
+						e.StructuredMetadata[k] = fmt.Sprint(v)
+					}
+				}
+			}
+			entries = append(entries, e)
+		}
+	}
+	return entries, nil
+}
+
+// parseLokiProtobuf decodes logproto.PushRequest:
+//
+//	PushRequest  { repeated Stream streams = 1; }
+//	Stream       { string labels = 1; repeated Entry entries = 2; }
+//	Entry        { Timestamp timestamp = 1; string line = 2; repeated LabelPair structuredMetadata = 3; }
+//	LabelPair    { string name = 1; string value = 2; }
+func parseLokiProtobuf(raw []byte) ([]lokiEntry, error) {
+	var entries []lokiEntry
+	err := protoFields(raw, func(stream protoField) error {
+		if stream.Number != 1 || stream.WireType != protoBytes {
+			return nil
+		}
+		var labels map[string]string
+		var streamEntries []lokiEntry
+		err := protoFields(stream.Bytes, func(f protoField) error {
+			switch {
+			case f.Number == 1 && f.WireType == protoBytes:
+				var err error
+				labels, err = parseLabelSet(f.String())
+				return err
+			case f.Number == 2 && f.WireType == protoBytes:
+				e, err := parseLokiProtoEntry(f.Bytes)
+				if err != nil {
+					return err
+				}
+				streamEntries = append(streamEntries, e)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, e := range streamEntries {
+			e.Labels = labels
+			entries = append(entries, e)
+		}
+		return nil
+	})
+	return entries, err
+}
+
+func parseLokiProtoEntry(b []byte) (lokiEntry, error) {
+	var e lokiEntry
+	var seconds, nanos int64
+	err := protoFields(b, func(f protoField) error {
+		switch {
+		case f.Number == 1 && f.WireType == protoBytes:
+			return protoFields(f.Bytes, func(ts protoField) error {
+				switch ts.Number {
+				case 1:
+					seconds = int64(ts.Uint)
+				case 2:
+					nanos = int64(ts.Uint)
+				}
+				return nil
+			})
+		case f.Number == 2 && f.WireType == protoBytes:
+			e.Line = f.String()
+		case f.Number == 3 && f.WireType == protoBytes:
+			var name, value string
+			err := protoFields(f.Bytes, func(p protoField) error {
+				switch p.Number {
+				case 1:
+					name = p.String()
+				case 2:
+					value = p.String()
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			if e.StructuredMetadata == nil {
+				e.StructuredMetadata = map[string]string{}
+			}
+			e.StructuredMetadata[name] = value
+		}
+		return nil
+	})
+	e.Timestamp = time.Unix(seconds, nanos)
+	return e, err
+}
+
+// parseLabelSet parses a Prometheus label set such as
+// {job="api", level="error"}.
+func parseLabelSet(text string) (map[string]string, error) {
+	labels := map[string]string{}
+	text = strings.TrimSpace(text)
+	if !strings.HasPrefix(text, "{") || !strings.HasSuffix(text, "}") {
+		return nil, fmt.Errorf("malformed label set %q", text)
+	}
+	rest := strings.TrimSpace(text[1 : len(text)-1])
+	for rest != "" {
+		name, tail, ok := strings.Cut(rest, "=")
+		if !ok {
+			return nil, fmt.Errorf("malformed label set %q", text)
+		}
+		tail = strings.TrimSpace(tail)
+		value, err := strconv.QuotedPrefix(tail)
+		if err != nil {
+			return nil, fmt.Errorf("malformed label value in %q", text)
+		}
+		labels[strings.TrimSpace(name)], _ = strconv.Unquote(value)
+		rest = strings.TrimPrefix(strings.TrimSpace(tail[len(value):]), ",")
+		rest = strings.TrimSpace(rest)
+	}
+	return labels, nil
+}
+
+// normalizeLevel maps the level spellings used by common log shippers onto
+// the levels used in the logs table.
+func normalizeLevel(level string) string {
+	switch l := strings.ToLower(strings.TrimSpace(level)); l {
+	case "warning":
+		return "warn"
+	case "err", "eror":
+		return "error"
+	case "critical", "crit", "emerg", "emergency", "alert", "panic":
+		return "fatal"
+	case "trace", "dbug":
+		return "debug"
+	case "":
+		return "info"
+	default:
+		return l
+	}
+}
+
+func gunzip(b []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(io.LimitReader(zr, maxLokiDecodedBytes))
+}
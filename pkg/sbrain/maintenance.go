@@ -0,0 +1,288 @@
+package sbrain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"sbrain/store"
+)
+
+// Maintenance windows without an operation end on their own after
+// defaultMaintenanceDuration unless the request says otherwise, so a backup
+// script that dies halfway does not leave the API down.
+const (
+	defaultMaintenanceDuration = 30 * time.Minute
+	maxMaintenanceDuration     = 24 * time.Hour
+	// maintenanceRetryAfter is the Retry-After given while an operation,
+	// whose end is not known in advance, runs.
+	maintenanceRetryAfter = 30
+)
+
+// maintenanceOperations are the jobs POST /admin/maintenance can run inside
+// a window that closes when they finish.
+var maintenanceOperations = map[string]func(s *Server, ctx context.Context) (string, error){
+	"backup":  (*Server).backupDatabase,
+	"migrate": (*Server).migrateDatabase,
+}
+
+// maintenanceState is what /admin/maintenance reports.
+type maintenanceState struct {
+	Active    bool      `json:"active"`
+	Reason    string    `json:"reason,omitempty"`
+	Operation string    `json:"operation,omitempty"`
+	StartedAt timestamp `json:"started_at,omitempty"`
+	// Until is when a window without an operation closes by itself.
+	Until timestamp `json:"until,omitempty"`
+	// Last is the outcome of the most recent operation.
+	Last *maintenanceResult `json:"last,omitempty"`
+}
+
+type maintenanceResult struct {
+	Operation  string    `json:"operation"`
+	StartedAt  timestamp `json:"started_at"`
+	FinishedAt timestamp `json:"finished_at"`
+	OK         bool      `json:"ok"`
+	Detail     string    `json:"detail,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// maintenance holds the current window. window counts windows, so the
+// timer of one that was closed early cannot close the next.
+type maintenance struct {
+	mu     sync.Mutex
+	state  maintenanceState
+	window int
+}
+
+func (m *maintenance) current() maintenanceState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state
+}
+
+// begin opens a window, failing if one is already open.
+func (m *maintenance) begin(reason, operation string, until time.Time) (maintenanceState, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.state.Active {
+		return m.state, 0, errors.New("maintenance mode is already on")
+	}
+	m.window++
+	m.state = maintenanceState{
+		Active:    true,
+		Reason:    reason,
+		Operation: operation,
+		StartedAt: store.NewTimestamp(time.Now()),
+		Last:      m.state.Last,
+	}
+	if !until.IsZero() {
+		m.state.Until = store.NewTimestamp(until)
+	}
+	return m.state, m.window, nil
+}
+
+// end closes window if it is still the open one, recording result when
+// given.
+func (m *maintenance) end(window int, result *maintenanceResult) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.state.Active || m.window != window {
+		return
+	}
+	last := m.state.Last
+	if result != nil {
+		last = result
+	}
+	m.state = maintenanceState{Last: last}
+	log.Printf("maintenance mode off")
+}
+
+// retryAfter is the Retry-After, in seconds, for a request refused now.
+func (st maintenanceState) retryAfter() int {
+	if until, ok := st.Until.Time(); ok {
+		if secs := int(time.Until(until).Seconds()) + 1; secs > 0 {
+			return secs
+		}
+		return 1
+	}
+	return maintenanceRetryAfter
+}
+
+// maintenanceGate answers 503 with Retry-After to everything but the admin
+// endpoints and the health checks while maintenance mode is on.
+func (s *Server) maintenanceGate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if st := s.maintenance.current(); st.Active && !maintenanceExempt(r.URL.Path) {
+			w.Header().Set("Retry-After", strconv.Itoa(st.retryAfter()))
+			message := "the API is down for maintenance"
+			if st.Reason != "" {
+				message += ": " + st.Reason
+			}
+			writeError(w, r, http.StatusServiceUnavailable, message)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func maintenanceExempt(path string) bool {
+	switch path {
+	case "/readyz", "/healthz", "/metrics":
+		return true
+	}
+	return strings.HasPrefix(path, "/admin/")
+}
+
+func (s *Server) getMaintenance(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.maintenance.current())
+}
+
+// startMaintenance serves POST /admin/maintenance. With an operation
+// ("backup" or "migrate") the server runs it and leaves maintenance mode
+// when it finishes; without one the window lasts until DELETE
+// /admin/maintenance or the duration runs out.
+func (s *Server) startMaintenance(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Reason    string `json:"reason"`
+		Operation string `json:"operation"`
+		Duration  string `json:"duration"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("decode body: %v", err))
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	var errs []FieldError
+	run, known := maintenanceOperations[req.Operation]
+	if req.Operation != "" && !known {
+		errs = append(errs, FieldError{Field: "operation", Message: "must be backup or migrate"})
+	}
+	duration := defaultMaintenanceDuration
+	if req.Duration != "" {
+		d, err := time.ParseDuration(req.Duration)
+		switch {
+		case req.Operation != "":
+			errs = append(errs, FieldError{Field: "duration", Message: "cannot be set with an operation, which ends the window itself"})
+		case err != nil || d <= 0 || d > maxMaintenanceDuration:
+			errs = append(errs, FieldError{Field: "duration", Message: fmt.Sprintf("must be a positive duration of at most %s, such as 15m", maxMaintenanceDuration)})
+		default:
+			duration = d
+		}
+	}
+	if len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+	if req.Reason == "" {
+		req.Reason = req.Operation
+	}
+
+	var until time.Time
+	if req.Operation == "" {
+		until = time.Now().Add(duration)
+	}
+	st, window, err := s.maintenance.begin(req.Reason, req.Operation, until)
+	if err != nil {
+		writeError(w, r, http.StatusConflict, err.Error())
+		return
+	}
+	log.Printf("maintenance mode on: %q", req.Reason)
+	s.recordAudit(r.Context(), auditCreate, "maintenance", 0, nil, st)
+
+	if req.Operation == "" {
+		time.AfterFunc(duration, func() { s.maintenance.end(window, nil) })
+		writeJSONStatus(w, http.StatusCreated, st)
+		return
+	}
+	// Close waits for the operation rather than closing the database under it.
+	s.jobs.Add(1)
+	go func() {
+		defer s.jobs.Done()
+		result := &maintenanceResult{Operation: req.Operation, StartedAt: st.StartedAt}
+		detail, err := run(s, context.Background())
+		result.FinishedAt, result.OK, result.Detail = store.NewTimestamp(time.Now()), err == nil, detail
+		if err != nil {
+			result.Error = err.Error()
+			log.Printf("maintenance %s: %v", req.Operation, err)
+		}
+		s.maintenance.end(window, result)
+	}()
+	writeJSONStatus(w, http.StatusAccepted, st)
+}
+
+// stopMaintenance serves DELETE /admin/maintenance, closing a window opened
+// without an operation. An operation's window closes when it finishes.
+func (s *Server) stopMaintenance(w http.ResponseWriter, r *http.Request) {
+	s.maintenance.mu.Lock()
+	st, window := s.maintenance.state, s.maintenance.window
+	s.maintenance.mu.Unlock()
+	switch {
+	case !st.Active:
+		writeError(w, r, http.StatusConflict, "maintenance mode is not on")
+		return
+	case st.Operation != "":
+		writeError(w, r, http.StatusConflict, fmt.Sprintf("the %s operation is running; maintenance mode ends when it finishes", st.Operation))
+		return
+	}
+	s.maintenance.end(window, nil)
+	s.recordAudit(r.Context(), auditDelete, "maintenance", 0, st, nil)
+	writeJSON(w, http.StatusOK, s.maintenance.current())
+}
+
+// backupDatabase writes a consistent copy of the database with VACUUM INTO
+// to SBRAIN_BACKUP_DIR, or next to the database when that is unset.
+func (s *Server) backupDatabase(ctx context.Context) (string, error) {
+	dir := os.Getenv("SBRAIN_BACKUP_DIR")
+	if dir == "" {
+		switch s.dbPath {
+		case "":
+			return "", errors.New("set SBRAIN_BACKUP_DIR: the database path is not known")
+		case MemoryDB:
+			return "", errors.New("set SBRAIN_BACKUP_DIR: the database is in memory")
+		}
+		dir = filepath.Dir(s.dbPath)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("create backup directory: %w", err)
+	}
+	path := filepath.Join(dir, "sbrain-"+time.Now().UTC().Format("20060102T150405Z")+".db")
+	if _, err := s.db.ExecContext(ctx, `VACUUM INTO ?`, path); err != nil {
+		return "", fmt.Errorf("vacuum into %s: %w", path, err)
+	}
+	return "wrote " + path, nil
+}
+
+// migrateDatabase applies the bundled migrations the database lacks and
+// re-runs the self-test, so /readyz reflects the new schema.
+func (s *Server) migrateDatabase(ctx context.Context) (string, error) {
+	before, err := trackedMigration(ctx, s.db)
+	if err != nil {
+		return "", err
+	}
+	if err := applyMigrations(ctx, s.db); err != nil {
+		return "", err
+	}
+	after, err := trackedMigration(ctx, s.db)
+	if err != nil {
+		return "", err
+	}
+	result := runSelfTest(ctx, s.db)
+	s.ready.mu.Lock()
+	s.ready.result = result
+	s.ready.mu.Unlock()
+	logSelfTest(result)
+	if after == before {
+		return fmt.Sprintf("already at version %d", after), nil
+	}
+	return fmt.Sprintf("migrated from version %d to %d", before, after), nil
+}
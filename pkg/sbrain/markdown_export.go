@@ -0,0 +1,158 @@
+package sbrain
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"sbrain/store"
+)
+
+// markdownExportHandler streams a zip with one markdown file per brain record,
+// grouped into a folder per project. Each file starts with YAML front matter
+// that Obsidian understands.
+func (s *Server) markdownExportHandler(w http.ResponseWriter, r *http.Request) {
+	// Headers go out with the first record, so a query that fails at once
+	// still answers with an error rather than an empty archive.
+	var zw *zip.Writer
+	start := func() {
+		filename := fmt.Sprintf("sbrain-export-%s.zip", time.Now().UTC().Format("20060102"))
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		w.WriteHeader(http.StatusOK)
+		zw = zip.NewWriter(w)
+	}
+	used := map[string]bool{}
+	err := s.brains.ListBrains(r.Context(), store.BrainFilter{Order: store.OldestFirst}, func(b brain) error {
+		if zw == nil {
+			start()
+		}
+		name := markdownExportPath(b, used)
+		fw, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     name,
+			Method:   zip.Deflate,
+			Modified: parseSQLiteTime(string(b.CreatedAt)),
+		})
+		if err != nil {
+			return err
+		}
+		_, err = fw.Write([]byte(renderBrainMarkdown(b)))
+		return err
+	})
+	switch {
+	case err != nil && zw == nil:
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	case err != nil:
+		// Headers are already sent; abort the archive so the client sees a
+		// truncated download rather than a silently incomplete one.
+		return
+	case zw == nil:
+		start()
+	}
+	_ = zw.Close()
+}
+
+// markdownExportPath returns a unique "project/title.md" path for b.
+func markdownExportPath(b brain, used map[string]bool) string {
+	dir := sanitizeFilename(b.Project)
+	if dir == "" {
+		dir = "untitled"
+	}
+	base := sanitizeFilename(b.Title)
+	if base == "" {
+		base = fmt.Sprintf("brain-%d", b.ID)
+	}
+
+	name := path.Join(dir, base+".md")
+	if used[strings.ToLower(name)] {
+		name = path.Join(dir, fmt.Sprintf("%s (%d).md", base, b.ID))
+	}
+	used[strings.ToLower(name)] = true
+	return name
+}
+
+// sanitizeFilename strips characters that are invalid in file names on
+// common filesystems or that Obsidian treats specially in links.
+func sanitizeFilename(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|', '#', '^', '[', ']':
+			return '-'
+		}
+		if r < 0x20 {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.Trim(strings.TrimSpace(name), ".")
+	if len([]rune(name)) > 100 {
+		name = string([]rune(name)[:100])
+	}
+	return name
+}
+
+func renderBrainMarkdown(b brain) string {
+	var out strings.Builder
+	out.WriteString("---\n")
+	fmt.Fprintf(&out, "id: %d\n", b.ID)
+	fmt.Fprintf(&out, "title: %s\n", yamlString(b.Title))
+	fmt.Fprintf(&out, "project: %s\n", yamlString(b.Project))
+	fmt.Fprintf(&out, "created_at: %s\n", yamlString(b.CreatedAt.Display()))
+	tags := splitTags(b.Tags)
+	if len(tags) == 0 {
+		out.WriteString("tags: []\n")
+	} else {
+		out.WriteString("tags:\n")
+		for _, tag := range tags {
+			fmt.Fprintf(&out, "  - %s\n", yamlString(tag))
+		}
+	}
+	fmt.Fprintf(&out, "commits: %s\n", yamlString(b.Commits))
+	out.WriteString("---\n\n")
+	out.WriteString(b.Context)
+	if !strings.HasSuffix(b.Context, "\n") {
+		out.WriteString("\n")
+	}
+	return out.String()
+}
+
+// yamlString quotes s as a YAML double-quoted scalar; JSON string syntax is
+// a valid subset.
+func yamlString(s string) string {
+	quoted, _ := json.Marshal(s)
+	return string(quoted)
+}
+
+// splitTags parses the comma-separated tags column.
+func splitTags(tags string) []string {
+	var out []string
+	for _, tag := range strings.Split(tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			out = append(out, tag)
+		}
+	}
+	return out
+}
+
+func parseSQLiteTime(value string) time.Time {
+	if t, ok := parseTimestamp(value); ok {
+		return t
+	}
+	return time.Now().UTC()
+}
+
+// parseTimestamp accepts SQLite's CURRENT_TIMESTAMP format, RFC 3339 and
+// bare dates. Values without a zone are UTC.
+func parseTimestamp(value string) (time.Time, bool) {
+	for _, layout := range []string{sqliteTimeLayout, time.RFC3339, "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, strings.TrimSpace(value)); err == nil {
+			return t.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
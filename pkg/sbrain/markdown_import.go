@@ -0,0 +1,240 @@
+package sbrain
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"sbrain/store"
+)
+
+// maxMarkdownImportBytes bounds the size of an uploaded vault archive.
+const maxMarkdownImportBytes = 64 << 20
+
+type importResult struct {
+	Created []int64  `json:"created"`
+	Skipped []string `json:"skipped"`
+	Errors  []string `json:"errors"`
+}
+
+// markdownImportHandler accepts a zip of markdown files (raw body or a
+// multipart "file" field) and creates a brain record per file. Front matter
+// fields win; otherwise the top-level folder becomes the project and the file
+// name the title. Files whose title and day match an existing record are
+// skipped.
+func (s *Server) markdownImportHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxMarkdownImportBytes)
+	data, err := readUpload(r, "file")
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("open zip: %v", err))
+		return
+	}
+
+	result := importResult{Created: []int64{}, Skipped: []string{}, Errors: []string{}}
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || !strings.EqualFold(path.Ext(f.Name), ".md") || isHiddenPath(f.Name) {
+			continue
+		}
+
+		b, err := readMarkdownZipEntry(f)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", f.Name, err))
+			continue
+		}
+
+		var exists bool
+		if err := s.db.QueryRowContext(r.Context(), `SELECT EXISTS (SELECT 1 FROM second_brain
+			WHERE title = ? AND date(created_at) = date(?))`, b.Title, b.CreatedAt).Scan(&exists); err != nil {
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("check duplicate: %v", err))
+			return
+		}
+		if exists {
+			result.Skipped = append(result.Skipped, f.Name)
+			continue
+		}
+
+		b.UpdatedAt = store.NewTimestamp(time.Now())
+		res, err := s.db.ExecContext(r.Context(), `INSERT INTO second_brain (created_at, updated_at, title, context, project, commits, tags)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`, b.CreatedAt, b.UpdatedAt, b.Title, b.Context, b.Project, b.Commits, b.Tags)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("insert brain: %v", err))
+			return
+		}
+		id, _ := res.LastInsertId()
+		b.ID = id
+		s.recordAudit(r.Context(), auditCreate, "brain", id, nil, b)
+		result.Created = append(result.Created, id)
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// readUpload returns the request payload from either a multipart field or
+// the raw body.
+func readUpload(r *http.Request, field string) ([]byte, error) {
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		f, _, err := r.FormFile(field)
+		if err != nil {
+			return nil, fmt.Errorf("read %q form file: %v", field, err)
+		}
+		defer f.Close()
+		return io.ReadAll(f)
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read body: %v", err)
+	}
+	if len(data) == 0 {
+		return nil, errors.New("request body is empty")
+	}
+	return data, nil
+}
+
+func isHiddenPath(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") || part == "__MACOSX" {
+			return true
+		}
+	}
+	return false
+}
+
+func readMarkdownZipEntry(f *zip.File) (brain, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return brain{}, err
+	}
+	defer rc.Close()
+
+	raw, err := io.ReadAll(rc)
+	if err != nil {
+		return brain{}, err
+	}
+
+	meta, body := parseFrontMatter(string(raw))
+	b := brain{
+		Title:   firstNonEmpty(meta["title"]...),
+		Context: strings.TrimSpace(body),
+		Project: firstNonEmpty(meta["project"]...),
+		Commits: strings.Join(meta["commits"], ","),
+		Tags:    strings.Join(meta["tags"], ","),
+	}
+
+	if b.Title == "" {
+		b.Title = strings.TrimSuffix(path.Base(f.Name), path.Ext(f.Name))
+	}
+	if b.Project == "" {
+		if dir, _, ok := strings.Cut(f.Name, "/"); ok {
+			b.Project = dir
+		} else {
+			b.Project = "imported"
+		}
+	}
+	if b.Context == "" {
+		b.Context = b.Title
+	}
+
+	created, ok := parseTimestamp(firstNonEmpty(append(meta["created_at"], append(meta["created"], meta["date"]...)...)...))
+	if !ok {
+		created = f.Modified
+	}
+	b.CreatedAt = store.NewTimestamp(created)
+	return b, nil
+}
+
+// parseFrontMatter extracts a leading YAML front matter block. Only the
+// subset Obsidian writes is understood: scalars, inline lists and block
+// lists. Every value is returned as a list.
+func parseFrontMatter(doc string) (map[string][]string, string) {
+	meta := map[string][]string{}
+	doc = strings.TrimPrefix(doc, "\ufeff")
+	if !strings.HasPrefix(doc, "---\n") && !strings.HasPrefix(doc, "---\r\n") {
+		return meta, doc
+	}
+
+	lines := strings.Split(doc, "\n")
+	end := -1
+	for i := 1; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) == "---" {
+			end = i
+			break
+		}
+	}
+	if end < 0 {
+		return meta, doc
+	}
+
+	var currentKey string
+	for _, line := range lines[1:end] {
+		line = strings.TrimRight(line, "\r")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "- ") && currentKey != "" {
+			meta[currentKey] = append(meta[currentKey], normalizeFrontMatterValue(currentKey, trimmed[2:]))
+			continue
+		}
+
+		key, value, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			continue
+		}
+		currentKey = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		switch {
+		case value == "" || value == "[]":
+			meta[currentKey] = nil
+		case strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]"):
+			for _, item := range strings.Split(value[1:len(value)-1], ",") {
+				if item = normalizeFrontMatterValue(currentKey, item); item != "" {
+					meta[currentKey] = append(meta[currentKey], item)
+				}
+			}
+		default:
+			meta[currentKey] = []string{normalizeFrontMatterValue(currentKey, value)}
+		}
+	}
+
+	return meta, strings.Join(lines[end+1:], "\n")
+}
+
+func normalizeFrontMatterValue(key string, value string) string {
+	value = strings.TrimSpace(value)
+	switch {
+	case strings.HasPrefix(value, `"`):
+		var decoded string
+		if err := json.Unmarshal([]byte(value), &decoded); err == nil {
+			value = decoded
+		}
+	case strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'") && len(value) >= 2:
+		value = strings.ReplaceAll(value[1:len(value)-1], "''", "'")
+	}
+	if key == "tags" {
+		value = strings.TrimPrefix(value, "#")
+	}
+	return value
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,104 @@
+package sbrain
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sbrain/migrations"
+)
+
+// applyMigrations brings db up to the latest embedded migration. Progress is
+// kept in schema_migrations in golang-migrate's layout, so the migrate CLI
+// and this code can take turns on the same database. Each migration runs in
+// a transaction together with its version bump.
+func applyMigrations(ctx context.Context, db *sql.DB) error {
+	current, err := trackedMigration(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	names, err := fs.Glob(migrations.Files, "*.up.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+	applied := 0
+	for _, name := range names {
+		prefix, _, _ := strings.Cut(name, "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return fmt.Errorf("migration %s: unnumbered", name)
+		}
+		if version <= current {
+			continue
+		}
+		script, err := migrations.Files.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, string(script)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %s: %w", path.Base(name), err)
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM schema_migrations`); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, dirty) VALUES (?, 0)`, version); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		applied++
+		current = version
+	}
+	if applied > 0 {
+		log.Printf("migrations: applied %d, now at version %d", applied, current)
+	}
+	return nil
+}
+
+// trackedMigration returns the version recorded in schema_migrations,
+// creating the table for a new database. A database that already has tables
+// but no schema_migrations was migrated some other way, and guessing its
+// version could replay migrations over it, so that is an error.
+func trackedMigration(ctx context.Context, db *sql.DB) (int, error) {
+	var version int
+	var dirty bool
+	err := db.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	switch {
+	case err == nil && dirty:
+		return 0, fmt.Errorf("migrations: version %d is dirty: fix it and run `migrate force` first", version)
+	case err == nil:
+		return version, nil
+	case errors.Is(err, sql.ErrNoRows):
+		return 0, nil
+	case !strings.Contains(err.Error(), "no such table"):
+		return 0, fmt.Errorf("read schema_migrations: %w", err)
+	}
+
+	var tables int
+	if err := db.QueryRowContext(ctx, `SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'`).Scan(&tables); err != nil {
+		return 0, err
+	}
+	if tables > 0 {
+		return 0, errors.New("migrations: the database has tables but no schema_migrations; migrate it with `migrate force <version>` first")
+	}
+	_, err = db.ExecContext(ctx, `CREATE TABLE schema_migrations (version uint64, dirty bool);
+		CREATE UNIQUE INDEX version_unique ON schema_migrations (version)`)
+	return 0, err
+}
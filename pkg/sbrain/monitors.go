@@ -0,0 +1,426 @@
+package sbrain
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"sbrain/store"
+)
+
+// Monitor states: new until the first check, up while checks pass, and down
+// once FailureThreshold checks in a row have failed, until one passes.
+const (
+	monitorNew  = "new"
+	monitorUp   = "up"
+	monitorDown = "down"
+)
+
+const (
+	// monitorTick is how often the checker looks for monitors that are due.
+	monitorTick = 15 * time.Second
+	// monitorConcurrency bounds how many checks run at once.
+	monitorConcurrency = 8
+	// monitorBodyLimit is how much of a response is searched for Keyword.
+	monitorBodyLimit   = 1 << 20
+	minMonitorInterval = 30
+	maxMonitorTimeout  = 60
+)
+
+// monitorClient makes the checks. Connections are not reused, so every
+// response time includes connecting, as a visitor's would.
+var monitorClient = &http.Client{Transport: &http.Transport{
+	Proxy:             http.ProxyFromEnvironment,
+	DisableKeepAlives: true,
+}}
+
+// monitor is a URL the uptime checker requests every IntervalSeconds. A
+// check passes when the response arrives within TimeoutSeconds with
+// ExpectedStatus, or any status below 400 when that is 0, and contains
+// Keyword when one is set. Every check is written to the logs table with
+// its response time; after FailureThreshold failures in a row the monitor
+// goes down and, with a Channel, an alert is sent to Target.
+type monitor struct {
+	ID                  int64     `json:"id"`
+	CreatedAt           timestamp `json:"created_at"`
+	Name                string    `json:"name"`
+	URL                 string    `json:"url"`
+	Method              string    `json:"method"`
+	IntervalSeconds     int       `json:"interval_seconds"`
+	TimeoutSeconds      int       `json:"timeout_seconds"`
+	ExpectedStatus      int       `json:"expected_status"`
+	Keyword             string    `json:"keyword"`
+	FailureThreshold    int       `json:"failure_threshold"`
+	Channel             string    `json:"channel"`
+	Target              string    `json:"target"`
+	Enabled             bool      `json:"enabled"`
+	Status              string    `json:"status"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	LastCheckedAt       timestamp `json:"last_checked_at"`
+	LastStatusCode      int       `json:"last_status_code"`
+	LastResponseMs      int       `json:"last_response_ms"`
+	LastError           string    `json:"last_error"`
+}
+
+const monitorColumns = `id, created_at, name, url, method, interval_seconds, timeout_seconds, expected_status, keyword,
+	failure_threshold, channel, target, enabled, status, consecutive_failures, last_checked_at, last_status_code,
+	last_response_ms, last_error`
+
+func scanMonitor(row interface{ Scan(...any) error }) (monitor, error) {
+	var m monitor
+	err := row.Scan(&m.ID, &m.CreatedAt, &m.Name, &m.URL, &m.Method, &m.IntervalSeconds, &m.TimeoutSeconds, &m.ExpectedStatus,
+		&m.Keyword, &m.FailureThreshold, &m.Channel, &m.Target, &m.Enabled, &m.Status, &m.ConsecutiveFailures,
+		&m.LastCheckedAt, &m.LastStatusCode, &m.LastResponseMs, &m.LastError)
+	return m, err
+}
+
+func (s *Server) loadMonitor(ctx context.Context, id int64) (monitor, error) {
+	return scanMonitor(s.db.QueryRowContext(ctx, `SELECT `+monitorColumns+` FROM monitors WHERE id = ?`, id))
+}
+
+func (s *Server) loadMonitors(ctx context.Context, enabledOnly bool) ([]monitor, error) {
+	query := `SELECT ` + monitorColumns + ` FROM monitors`
+	if enabledOnly {
+		query += ` WHERE enabled = 1`
+	}
+	rows, err := s.db.QueryContext(ctx, query+` ORDER BY name, id`)
+	if err != nil {
+		return nil, fmt.Errorf("query monitors: %w", err)
+	}
+	defer rows.Close()
+
+	items := []monitor{}
+	for rows.Next() {
+		m, err := scanMonitor(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan monitor: %w", err)
+		}
+		items = append(items, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate monitors: %w", err)
+	}
+	return items, nil
+}
+
+// validateMonitor normalizes m and reports what is wrong with it.
+func validateMonitor(m *monitor) []FieldError {
+	m.Name = strings.TrimSpace(m.Name)
+	m.URL = strings.TrimSpace(m.URL)
+	m.Method = strings.ToUpper(strings.TrimSpace(m.Method))
+	m.Channel = strings.TrimSpace(m.Channel)
+	m.Target = strings.TrimSpace(m.Target)
+
+	var v validator
+	if v.required("name", m.Name) {
+		v.maxLength("name", m.Name, maxTitleLength)
+	}
+	if v.required("url", m.URL) {
+		if u, err := url.Parse(m.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			v.add("url", "must be an absolute http or https URL")
+		}
+	}
+	if m.Method != http.MethodGet && m.Method != http.MethodHead {
+		v.add("method", "must be GET or HEAD")
+	}
+	if m.IntervalSeconds < minMonitorInterval {
+		v.add("interval_seconds", "must be at least %d", minMonitorInterval)
+	}
+	if m.TimeoutSeconds < 1 || m.TimeoutSeconds > maxMonitorTimeout {
+		v.add("timeout_seconds", "must be between 1 and %d", maxMonitorTimeout)
+	} else if m.TimeoutSeconds >= m.IntervalSeconds && m.IntervalSeconds >= minMonitorInterval {
+		v.add("timeout_seconds", "must be less than interval_seconds")
+	}
+	if m.ExpectedStatus != 0 && (m.ExpectedStatus < 100 || m.ExpectedStatus > 599) {
+		v.add("expected_status", "must be an HTTP status, or 0 for any below 400")
+	}
+	if m.Keyword != "" && m.Method == http.MethodHead {
+		v.add("keyword", "needs method GET; a HEAD response has no body")
+	}
+	if m.FailureThreshold < 1 {
+		v.add("failure_threshold", "must be at least 1")
+	}
+	if m.Channel != "" && !slices.Contains(notifyChannels, m.Channel) {
+		v.add("channel", "must be webhook, slack or email, or empty to only log")
+	} else if m.Channel != "" && m.Target == "" {
+		v.add("target", "is required with a channel")
+	}
+	return v.errors
+}
+
+// listMonitors serves GET /monitors.
+func (s *Server) listMonitors(w http.ResponseWriter, r *http.Request) {
+	items, err := s.loadMonitors(r.Context(), false)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+// createMonitor serves POST /monitors. The first check runs on the
+// checker's next tick.
+func (s *Server) createMonitor(w http.ResponseWriter, r *http.Request) {
+	req := monitor{Method: http.MethodGet, IntervalSeconds: 60, TimeoutSeconds: 10, FailureThreshold: 2, Enabled: true}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("decode body: %v", err))
+		return
+	}
+	if errs := validateMonitor(&req); len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+
+	res, err := s.db.ExecContext(r.Context(), `INSERT INTO monitors (name, url, method, interval_seconds, timeout_seconds,
+		expected_status, keyword, failure_threshold, channel, target, enabled)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, req.Name, req.URL, req.Method, req.IntervalSeconds, req.TimeoutSeconds,
+		req.ExpectedStatus, req.Keyword, req.FailureThreshold, req.Channel, req.Target, req.Enabled)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("insert monitor: %v", err))
+		return
+	}
+	id, _ := res.LastInsertId()
+	m, err := s.loadMonitor(r.Context(), id)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("load monitor: %v", err))
+		return
+	}
+	s.recordAudit(r.Context(), auditCreate, "monitor", m.ID, nil, m)
+	writeJSONStatus(w, http.StatusCreated, m)
+}
+
+// getMonitor serves GET /monitors/{id}.
+func (s *Server) getMonitor(w http.ResponseWriter, r *http.Request, id int64) {
+	m, err := s.loadMonitor(r.Context(), id)
+	if err != nil {
+		writeMonitorLoadError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, m)
+}
+
+// updateMonitor serves PUT /monitors/{id}. Fields left out of the body keep
+// their values; the monitor's state and last check are kept too.
+func (s *Server) updateMonitor(w http.ResponseWriter, r *http.Request, id int64) {
+	before, err := s.loadMonitor(r.Context(), id)
+	if err != nil {
+		writeMonitorLoadError(w, r, err)
+		return
+	}
+	req := before
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("decode body: %v", err))
+		return
+	}
+	if errs := validateMonitor(&req); len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+	if _, err := s.db.ExecContext(r.Context(), `UPDATE monitors SET name = ?, url = ?, method = ?, interval_seconds = ?,
+		timeout_seconds = ?, expected_status = ?, keyword = ?, failure_threshold = ?, channel = ?, target = ?, enabled = ?
+		WHERE id = ?`, req.Name, req.URL, req.Method, req.IntervalSeconds, req.TimeoutSeconds, req.ExpectedStatus, req.Keyword,
+		req.FailureThreshold, req.Channel, req.Target, req.Enabled, id); err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("update monitor: %v", err))
+		return
+	}
+	after, err := s.loadMonitor(r.Context(), id)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("load monitor: %v", err))
+		return
+	}
+	s.recordAudit(r.Context(), auditUpdate, "monitor", id, before, after)
+	writeJSON(w, http.StatusOK, after)
+}
+
+// deleteMonitor serves DELETE /monitors/{id}. The logs of its checks are
+// kept.
+func (s *Server) deleteMonitor(w http.ResponseWriter, r *http.Request, id int64) {
+	m, err := s.loadMonitor(r.Context(), id)
+	if err != nil {
+		writeMonitorLoadError(w, r, err)
+		return
+	}
+	if _, err := s.db.ExecContext(r.Context(), `DELETE FROM monitors WHERE id = ?`, id); err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("delete monitor: %v", err))
+		return
+	}
+	s.recordAudit(r.Context(), auditDelete, "monitor", id, m, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkMonitorNow serves POST /monitors/{id}/check, running a check right
+// away, even on a disabled monitor, and answering with the result.
+func (s *Server) checkMonitorNow(w http.ResponseWriter, r *http.Request, id int64) {
+	m, err := s.loadMonitor(r.Context(), id)
+	if err != nil {
+		writeMonitorLoadError(w, r, err)
+		return
+	}
+	m, err = s.checkMonitor(r.Context(), m, time.Now())
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, m)
+}
+
+func writeMonitorLoadError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+	writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("query monitor: %v", err))
+}
+
+// runMonitorScheduler checks every monitorTick for monitors whose interval
+// has passed since their last check and checks them, a few at a time.
+func (s *Server) runMonitorScheduler(ctx context.Context) {
+	ticker := time.NewTicker(monitorTick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.runDueMonitors(ctx, now)
+		}
+	}
+}
+
+func (s *Server) runDueMonitors(ctx context.Context, now time.Time) {
+	monitors, err := s.loadMonitors(ctx, true)
+	if err != nil {
+		log.Printf("monitors: %v", err)
+		return
+	}
+	sem := make(chan struct{}, monitorConcurrency)
+	var wg sync.WaitGroup
+	for _, m := range monitors {
+		if last, ok := m.LastCheckedAt.Time(); ok && now.Sub(last) < time.Duration(m.IntervalSeconds)*time.Second {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			if _, err := s.checkMonitor(ctx, m, now); err != nil {
+				log.Printf("monitors: %s: %v", m.Name, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// monitorResult is the outcome of one request to a monitored URL. Err is
+// empty when the check passed.
+type monitorResult struct {
+	StatusCode int
+	ResponseMs int
+	Err        string
+}
+
+// probe requests m's URL and judges the response.
+func probe(ctx context.Context, m monitor) monitorResult {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(m.TimeoutSeconds)*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, m.Method, m.URL, nil)
+	if err != nil {
+		return monitorResult{Err: err.Error()}
+	}
+	req.Header.Set("User-Agent", "sbrain-monitor/1.0")
+
+	start := time.Now()
+	resp, err := monitorClient.Do(req)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return monitorResult{ResponseMs: int(time.Since(start).Milliseconds()), Err: fmt.Sprintf("no response within %ds", m.TimeoutSeconds)}
+		}
+		return monitorResult{ResponseMs: int(time.Since(start).Milliseconds()), Err: err.Error()}
+	}
+	defer resp.Body.Close()
+	var body []byte
+	if m.Keyword != "" {
+		body, err = io.ReadAll(io.LimitReader(resp.Body, monitorBodyLimit))
+	}
+	res := monitorResult{StatusCode: resp.StatusCode, ResponseMs: int(time.Since(start).Milliseconds())}
+	switch {
+	case err != nil:
+		res.Err = fmt.Sprintf("read body: %v", err)
+	case m.ExpectedStatus != 0 && resp.StatusCode != m.ExpectedStatus:
+		res.Err = fmt.Sprintf("status %d, expected %d", resp.StatusCode, m.ExpectedStatus)
+	case m.ExpectedStatus == 0 && resp.StatusCode >= 400:
+		res.Err = fmt.Sprintf("status %d", resp.StatusCode)
+	case m.Keyword != "" && !strings.Contains(string(body), m.Keyword):
+		res.Err = fmt.Sprintf("keyword %q not found", m.Keyword)
+	}
+	return res
+}
+
+// checkMonitor probes m, stores the result on the monitor and as a log, and
+// alerts when the monitor goes down or comes back up. It returns the
+// monitor as updated.
+func (s *Server) checkMonitor(ctx context.Context, m monitor, now time.Time) (monitor, error) {
+	res := probe(ctx, m)
+	wasDown := m.Status == monitorDown
+	if res.Err == "" {
+		m.Status, m.ConsecutiveFailures = monitorUp, 0
+	} else {
+		m.ConsecutiveFailures++
+		if m.ConsecutiveFailures >= m.FailureThreshold {
+			m.Status = monitorDown
+		}
+	}
+	m.LastCheckedAt, m.LastStatusCode, m.LastResponseMs, m.LastError = store.NewTimestamp(now), res.StatusCode, res.ResponseMs, res.Err
+	if _, err := s.db.ExecContext(ctx, `UPDATE monitors SET status = ?, consecutive_failures = ?, last_checked_at = ?,
+		last_status_code = ?, last_response_ms = ?, last_error = ? WHERE id = ?`,
+		m.Status, m.ConsecutiveFailures, m.LastCheckedAt, m.LastStatusCode, m.LastResponseMs, m.LastError, m.ID); err != nil {
+		return m, fmt.Errorf("record check: %w", err)
+	}
+
+	l := logEntry{Level: "info", Endpoint: m.URL, Method: m.Method, ResponseTimeMs: &res.ResponseMs, Service: internalLogService}
+	if res.StatusCode != 0 {
+		l.StatusCode = &res.StatusCode
+	}
+	if res.Err == "" {
+		l.Message = fmt.Sprintf("monitor %q up: %d in %dms", m.Name, res.StatusCode, res.ResponseMs)
+	} else {
+		l.Level = "error"
+		l.Message = fmt.Sprintf("monitor %q check failed: %s", m.Name, res.Err)
+	}
+	metadata, _ := json.Marshal(map[string]any{"monitor_id": m.ID, "monitor": m.Name, "status": m.Status})
+	l.Metadata = string(metadata)
+	if _, err := s.insertLog(ctx, l); err != nil {
+		log.Printf("monitors: %s: store log: %v", m.Name, err)
+	}
+
+	switch {
+	case !wasDown && m.Status == monitorDown:
+		s.announceMonitor(m, fmt.Sprintf("sbrain monitor %q is down: %s (%d failed checks of %s)",
+			m.Name, res.Err, m.ConsecutiveFailures, m.URL))
+	case wasDown && m.Status == monitorUp:
+		s.announceMonitor(m, fmt.Sprintf("sbrain monitor %q is back up: %d in %dms from %s",
+			m.Name, res.StatusCode, res.ResponseMs, m.URL))
+	}
+	return m, nil
+}
+
+// announceMonitor sends text on the monitor's channel, if it has one.
+func (s *Server) announceMonitor(m monitor, text string) {
+	if m.Channel == "" {
+		return
+	}
+	if err := s.notify(m.Channel, m.Target, "sbrain monitor "+m.Name+" is "+m.Status, text, map[string]any{"monitor": m}); err != nil {
+		log.Printf("monitors: %s: deliver via %s: %v", m.Name, m.Channel, err)
+	}
+}
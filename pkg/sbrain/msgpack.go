@@ -0,0 +1,298 @@
+package sbrain
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+)
+
+// MessagePack support covers the values JSON has, so a body can be carried
+// in either: nil, booleans, integers, floats, strings, arrays and maps with
+// string keys. Binary strings are accepted as strings when they hold UTF-8;
+// extension types are rejected.
+
+// maxMsgpackDepth bounds how deeply arrays and maps may nest in a decoded
+// body.
+const maxMsgpackDepth = 100
+
+// encodeMsgpack appends the MessagePack encoding of v, a value as
+// encoding/json decodes it with UseNumber. Map keys are sorted so equal
+// values encode identically.
+func encodeMsgpack(b []byte, v any) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return append(b, 0xc0), nil
+	case bool:
+		if v {
+			return append(b, 0xc3), nil
+		}
+		return append(b, 0xc2), nil
+	case json.Number:
+		if n, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			return appendMsgpackInt(b, n), nil
+		}
+		if n, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			return binary.BigEndian.AppendUint64(append(b, 0xcf), n), nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return nil, err
+		}
+		return binary.BigEndian.AppendUint64(append(b, 0xcb), math.Float64bits(f)), nil
+	case float64:
+		return binary.BigEndian.AppendUint64(append(b, 0xcb), math.Float64bits(v)), nil
+	case string:
+		n := len(v)
+		switch {
+		case n < 32:
+			b = append(b, 0xa0|byte(n))
+		case n <= math.MaxUint8:
+			b = append(b, 0xd9, byte(n))
+		case n <= math.MaxUint16:
+			b = binary.BigEndian.AppendUint16(append(b, 0xda), uint16(n))
+		default:
+			b = binary.BigEndian.AppendUint32(append(b, 0xdb), uint32(n))
+		}
+		return append(b, v...), nil
+	case []any:
+		b = appendMsgpackHeader(b, len(v), 0x90, 0xdc)
+		var err error
+		for _, item := range v {
+			if b, err = encodeMsgpack(b, item); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		b = appendMsgpackHeader(b, len(v), 0x80, 0xde)
+		var err error
+		for _, k := range keys {
+			if b, err = encodeMsgpack(b, k); err != nil {
+				return nil, err
+			}
+			if b, err = encodeMsgpack(b, v[k]); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("msgpack: cannot encode %T", v)
+}
+
+func appendMsgpackInt(b []byte, n int64) []byte {
+	switch {
+	case n >= 0 && n <= 127:
+		return append(b, byte(n))
+	case n < 0 && n >= -32:
+		return append(b, byte(n))
+	case n >= math.MinInt8 && n <= math.MaxInt8:
+		return append(b, 0xd0, byte(n))
+	case n >= math.MinInt16 && n <= math.MaxInt16:
+		return binary.BigEndian.AppendUint16(append(b, 0xd1), uint16(n))
+	case n >= math.MinInt32 && n <= math.MaxInt32:
+		return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(n))
+	}
+	return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(n))
+}
+
+// appendMsgpackHeader writes the length of an array or map: fix is the
+// fixarray or fixmap prefix and wide the 16-bit form, followed by the 32-bit
+// one.
+func appendMsgpackHeader(b []byte, n int, fix, wide byte) []byte {
+	switch {
+	case n < 16:
+		return append(b, fix|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, wide), uint16(n))
+	}
+	return binary.BigEndian.AppendUint32(append(b, wide+1), uint32(n))
+}
+
+// decodeMsgpack decodes one MessagePack value from data into the values
+// encoding/json decodes to, with numbers as json.Number. Trailing bytes are
+// an error.
+func decodeMsgpack(data []byte) (any, error) {
+	d := &msgpackDecoder{data: data}
+	v, err := d.value(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(d.data) {
+		return nil, fmt.Errorf("msgpack: %d bytes after the value", len(d.data)-d.pos)
+	}
+	return v, nil
+}
+
+var errMsgpackShort = errors.New("msgpack: unexpected end of data")
+
+type msgpackDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *msgpackDecoder) take(n int) ([]byte, error) {
+	if n < 0 || n > len(d.data)-d.pos {
+		return nil, errMsgpackShort
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+// uint reads a big-endian unsigned integer of size bytes.
+func (d *msgpackDecoder) uint(size int) (uint64, error) {
+	b, err := d.take(size)
+	if err != nil {
+		return 0, err
+	}
+	var n uint64
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+	return n, nil
+}
+
+func (d *msgpackDecoder) value(depth int) (any, error) {
+	if depth > maxMsgpackDepth {
+		return nil, fmt.Errorf("msgpack: nested more than %d levels", maxMsgpackDepth)
+	}
+	tag, err := d.take(1)
+	if err != nil {
+		return nil, err
+	}
+	c := tag[0]
+	switch {
+	case c <= 0x7f:
+		return json.Number(strconv.Itoa(int(c))), nil
+	case c >= 0xe0:
+		return json.Number(strconv.Itoa(int(int8(c)))), nil
+	case c&0xf0 == 0x80:
+		return d.mapOf(int(c&0x0f), depth)
+	case c&0xf0 == 0x90:
+		return d.arrayOf(int(c&0x0f), depth)
+	case c&0xe0 == 0xa0:
+		return d.str(int(c & 0x1f))
+	}
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6, 0xd9, 0xda, 0xdb:
+		size := map[byte]int{0xc4: 1, 0xc5: 2, 0xc6: 4, 0xd9: 1, 0xda: 2, 0xdb: 4}[c]
+		n, err := d.uint(size)
+		if err != nil {
+			return nil, err
+		}
+		return d.str(int(n))
+	case 0xca:
+		n, err := d.uint(4)
+		if err != nil {
+			return nil, err
+		}
+		return msgpackFloat(float64(math.Float32frombits(uint32(n))))
+	case 0xcb:
+		n, err := d.uint(8)
+		if err != nil {
+			return nil, err
+		}
+		return msgpackFloat(math.Float64frombits(n))
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		n, err := d.uint(1 << (c - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		return json.Number(strconv.FormatUint(n, 10)), nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (c - 0xd0)
+		n, err := d.uint(size)
+		if err != nil {
+			return nil, err
+		}
+		// Sign-extend from the encoded width.
+		shift := 64 - 8*size
+		return json.Number(strconv.FormatInt(int64(n<<shift)>>shift, 10)), nil
+	case 0xdc, 0xdd:
+		n, err := d.uint(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.arrayOf(int(n), depth)
+	case 0xde, 0xdf:
+		n, err := d.uint(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.mapOf(int(n), depth)
+	}
+	return nil, fmt.Errorf("msgpack: unsupported type 0x%02x (extension types have no JSON equivalent)", c)
+}
+
+func (d *msgpackDecoder) str(n int) (any, error) {
+	b, err := d.take(n)
+	if err != nil {
+		return nil, err
+	}
+	if !utf8.Valid(b) {
+		return nil, errors.New("msgpack: string is not valid UTF-8")
+	}
+	return string(b), nil
+}
+
+func (d *msgpackDecoder) arrayOf(n, depth int) (any, error) {
+	// Every element takes at least a byte, which bounds n by what is left.
+	if n > len(d.data)-d.pos {
+		return nil, errMsgpackShort
+	}
+	items := make([]any, n)
+	for i := range items {
+		v, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		items[i] = v
+	}
+	return items, nil
+}
+
+func (d *msgpackDecoder) mapOf(n, depth int) (any, error) {
+	if n > (len(d.data)-d.pos)/2 {
+		return nil, errMsgpackShort
+	}
+	m := make(map[string]any, n)
+	for range n {
+		k, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("msgpack: map key %v is not a string", k)
+		}
+		v, err := d.value(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		m[key] = v
+	}
+	return m, nil
+}
+
+func msgpackFloat(f float64) (any, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil, fmt.Errorf("msgpack: %v cannot be represented in JSON", f)
+	}
+	return json.Number(strconv.FormatFloat(f, 'g', -1, 64)), nil
+}
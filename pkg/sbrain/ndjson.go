@@ -0,0 +1,54 @@
+package sbrain
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+const ndjsonContentType = "application/x-ndjson"
+
+// ndjsonFlushEvery controls how many lines are buffered before flushing.
+const ndjsonFlushEvery = 100
+
+// wantsNDJSON reports whether the client asked for newline-delimited JSON
+// via the Accept header.
+func wantsNDJSON(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		if mediaType == ndjsonContentType || mediaType == "application/ndjson" {
+			return true
+		}
+	}
+	return false
+}
+
+// ndjsonWriter streams one JSON document per line. Once created the status
+// line has been sent, so errors can only end the stream early.
+type ndjsonWriter struct {
+	enc     *json.Encoder
+	flusher http.Flusher
+	count   int
+}
+
+func newNDJSONWriter(w http.ResponseWriter) *ndjsonWriter {
+	w.Header().Set("Content-Type", ndjsonContentType)
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	return &ndjsonWriter{enc: json.NewEncoder(w), flusher: flusher}
+}
+
+func (n *ndjsonWriter) Write(value any) error {
+	if err := n.enc.Encode(value); err != nil {
+		return err
+	}
+	n.count++
+	if n.flusher != nil && n.count%ndjsonFlushEvery == 0 {
+		n.flusher.Flush()
+	}
+	return nil
+}
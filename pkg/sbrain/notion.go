@@ -0,0 +1,322 @@
+package sbrain
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"sbrain/store"
+)
+
+// Notion API limits: characters in one rich text object and blocks in one
+// request.
+const (
+	notionTextLimit  = 2000
+	notionBlockLimit = 100
+	notionVersion    = "2022-06-28"
+)
+
+// notionConfig is the Notion integration: an internal integration token,
+// the database records are exported to, and the names of the properties
+// title, tags and project map to.
+type notionConfig struct {
+	token      string
+	databaseID string
+	apiURL     string
+	titleProp  string
+	tagsProp   string
+	projProp   string
+	client     *http.Client
+}
+
+// loadNotionConfig reads SBRAIN_NOTION_TOKEN and SBRAIN_NOTION_DATABASE_ID,
+// and optionally SBRAIN_NOTION_TITLE_PROPERTY (default Name),
+// SBRAIN_NOTION_TAGS_PROPERTY (Tags, a multi-select) and
+// SBRAIN_NOTION_PROJECT_PROPERTY (Project, a select). It returns nil when
+// the integration is not configured.
+func loadNotionConfig() *notionConfig {
+	token, databaseID := os.Getenv("SBRAIN_NOTION_TOKEN"), os.Getenv("SBRAIN_NOTION_DATABASE_ID")
+	if token == "" || databaseID == "" {
+		return nil
+	}
+	env := func(name, fallback string) string {
+		if v := strings.TrimSpace(os.Getenv(name)); v != "" {
+			return v
+		}
+		return fallback
+	}
+	return &notionConfig{
+		token:      token,
+		databaseID: databaseID,
+		apiURL:     strings.TrimRight(env("SBRAIN_NOTION_API_URL", "https://api.notion.com/v1"), "/"),
+		titleProp:  env("SBRAIN_NOTION_TITLE_PROPERTY", "Name"),
+		tagsProp:   env("SBRAIN_NOTION_TAGS_PROPERTY", "Tags"),
+		projProp:   env("SBRAIN_NOTION_PROJECT_PROPERTY", "Project"),
+		client:     &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// notionExportResult reports what an export did. Failed records are left
+// for the next export to retry.
+type notionExportResult struct {
+	DryRun    bool                `json:"dry_run"`
+	Created   []int64             `json:"created"`
+	Updated   []int64             `json:"updated"`
+	Unchanged int                 `json:"unchanged"`
+	Failed    []notionExportError `json:"failed"`
+}
+
+type notionExportError struct {
+	ID    int64  `json:"id"`
+	Error string `json:"error"`
+}
+
+// notionExport serves POST /integrations/notion/export: it pushes the
+// records matching the brain list filters to the Notion database, creating
+// a page for each new record and rewriting the page of each record changed
+// since its last export. ?full=true rewrites every page, and ?dry_run=true
+// only reports what would be pushed.
+func (s *Server) notionExport(w http.ResponseWriter, r *http.Request) {
+	cfg := loadNotionConfig()
+	if cfg == nil {
+		writeError(w, r, http.StatusServiceUnavailable, "Notion is not configured: set SBRAIN_NOTION_TOKEN and SBRAIN_NOTION_DATABASE_ID")
+		return
+	}
+	q := r.URL.Query()
+	dryRun, full := q.Get("dry_run") == "true", q.Get("full") == "true"
+	q.Del("dry_run")
+	q.Del("full")
+	filter, err := parseBrainFilter(q)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var records []brain
+	if err := s.brains.ListBrains(r.Context(), filter, func(b brain) error {
+		records = append(records, b)
+		return nil
+	}); err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	result := notionExportResult{DryRun: dryRun, Created: []int64{}, Updated: []int64{}, Failed: []notionExportError{}}
+	for _, b := range records {
+		var pageID string
+		var version int64
+		err := s.db.QueryRowContext(r.Context(), `SELECT page_id, version FROM notion_pages WHERE brain_id = ?`, b.ID).Scan(&pageID, &version)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("query notion page: %v", err))
+			return
+		}
+		switch {
+		case pageID != "" && version == b.Version && !full:
+			result.Unchanged++
+			continue
+		case dryRun && pageID == "":
+			result.Created = append(result.Created, b.ID)
+			continue
+		case dryRun:
+			result.Updated = append(result.Updated, b.ID)
+			continue
+		}
+
+		created := pageID == ""
+		if created {
+			pageID, err = cfg.createPage(r.Context(), b)
+		} else {
+			err = cfg.updatePage(r.Context(), pageID, b)
+		}
+		if err != nil {
+			result.Failed = append(result.Failed, notionExportError{ID: b.ID, Error: err.Error()})
+			if r.Context().Err() != nil {
+				break
+			}
+			continue
+		}
+		if created {
+			result.Created = append(result.Created, b.ID)
+		} else {
+			result.Updated = append(result.Updated, b.ID)
+		}
+		if _, err := s.db.ExecContext(r.Context(), `INSERT INTO notion_pages (brain_id, page_id, version, exported_at) VALUES (?, ?, ?, ?)
+			ON CONFLICT (brain_id) DO UPDATE SET page_id = excluded.page_id, version = excluded.version, exported_at = excluded.exported_at`,
+			b.ID, pageID, b.Version, store.NewTimestamp(time.Now())); err != nil {
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("record notion page: %v", err))
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// properties maps a record to the database's title, tags and project
+// properties.
+func (c *notionConfig) properties(b brain) map[string]any {
+	tags := []map[string]string{}
+	for _, tag := range splitTags(b.Tags) {
+		tags = append(tags, map[string]string{"name": tag})
+	}
+	return map[string]any{
+		c.titleProp: map[string]any{"title": notionText(b.Title)},
+		c.tagsProp:  map[string]any{"multi_select": tags},
+		c.projProp:  map[string]any{"select": map[string]string{"name": b.Project}},
+	}
+}
+
+// notionBlocks renders a record's context as paragraphs, followed by its
+// commits.
+func notionBlocks(b brain) []map[string]any {
+	var blocks []map[string]any
+	paragraph := func(text string) {
+		blocks = append(blocks, map[string]any{
+			"object":    "block",
+			"type":      "paragraph",
+			"paragraph": map[string]any{"rich_text": notionText(text)},
+		})
+	}
+	for _, p := range strings.Split(strings.ReplaceAll(b.Context, "\r\n", "\n"), "\n\n") {
+		if p = strings.TrimSpace(p); p != "" {
+			paragraph(p)
+		}
+	}
+	if strings.TrimSpace(b.Commits) != "" {
+		paragraph("Commits: " + b.Commits)
+	}
+	return blocks
+}
+
+// notionText splits text into rich text objects within Notion's length
+// limit.
+func notionText(text string) []map[string]any {
+	runes := []rune(text)
+	out := []map[string]any{}
+	for len(runes) > 0 {
+		n := min(len(runes), notionTextLimit)
+		out = append(out, map[string]any{"type": "text", "text": map[string]string{"content": string(runes[:n])}})
+		runes = runes[n:]
+	}
+	return out
+}
+
+// createPage adds a page for b to the database and returns its id.
+func (c *notionConfig) createPage(ctx context.Context, b brain) (string, error) {
+	blocks := notionBlocks(b)
+	first := blocks[:min(len(blocks), notionBlockLimit)]
+	var page struct {
+		ID string `json:"id"`
+	}
+	if err := c.call(ctx, http.MethodPost, "/pages", map[string]any{
+		"parent":     map[string]string{"database_id": c.databaseID},
+		"properties": c.properties(b),
+		"children":   first,
+	}, &page); err != nil {
+		return "", err
+	}
+	return page.ID, c.appendBlocks(ctx, page.ID, blocks[len(first):])
+}
+
+// updatePage rewrites the properties and content of the page for b.
+func (c *notionConfig) updatePage(ctx context.Context, pageID string, b brain) error {
+	if err := c.call(ctx, http.MethodPatch, "/pages/"+pageID, map[string]any{"properties": c.properties(b)}, nil); err != nil {
+		return err
+	}
+	cursor := ""
+	for {
+		path := "/blocks/" + pageID + "/children?page_size=100"
+		if cursor != "" {
+			path += "&start_cursor=" + cursor
+		}
+		var children struct {
+			Results []struct {
+				ID string `json:"id"`
+			} `json:"results"`
+			HasMore    bool   `json:"has_more"`
+			NextCursor string `json:"next_cursor"`
+		}
+		if err := c.call(ctx, http.MethodGet, path, nil, &children); err != nil {
+			return err
+		}
+		for _, child := range children.Results {
+			if err := c.call(ctx, http.MethodDelete, "/blocks/"+child.ID, nil, nil); err != nil {
+				return err
+			}
+		}
+		if !children.HasMore {
+			break
+		}
+		cursor = children.NextCursor
+	}
+	return c.appendBlocks(ctx, pageID, notionBlocks(b))
+}
+
+func (c *notionConfig) appendBlocks(ctx context.Context, pageID string, blocks []map[string]any) error {
+	for len(blocks) > 0 {
+		n := min(len(blocks), notionBlockLimit)
+		if err := c.call(ctx, http.MethodPatch, "/blocks/"+pageID+"/children", map[string]any{"children": blocks[:n]}, nil); err != nil {
+			return err
+		}
+		blocks = blocks[n:]
+	}
+	return nil
+}
+
+// call makes one Notion API request, waiting out a rate limit once.
+func (c *notionConfig) call(ctx context.Context, method, path string, body any, out any) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, c.apiURL+path, bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+c.token)
+		req.Header.Set("Notion-Version", notionVersion)
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return fmt.Errorf("notion %s %s: %w", method, path, err)
+		}
+		if resp.StatusCode == http.StatusTooManyRequests && attempt == 0 {
+			resp.Body.Close()
+			wait, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+			select {
+			case <-time.After(time.Duration(max(wait, 1)) * time.Second):
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			var apiErr struct {
+				Message string `json:"message"`
+			}
+			raw, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+			if json.Unmarshal(raw, &apiErr) != nil || apiErr.Message == "" {
+				apiErr.Message = strings.TrimSpace(string(raw))
+			}
+			return fmt.Errorf("notion %s %s returned %s: %s", method, path, resp.Status, apiErr.Message)
+		}
+		if out == nil {
+			return nil
+		}
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+}
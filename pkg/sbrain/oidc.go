@@ -0,0 +1,508 @@
+package sbrain
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// githubIssuer selects GitHub's OAuth flow. GitHub does not issue OIDC ID
+// tokens for user logins, so identities come from its user API instead.
+const githubIssuer = "https://github.com"
+
+const oauthStateCookieName = "sbrain_oauth_state"
+
+// oidcProvider is an OAuth2/OIDC identity provider configured via
+// SBRAIN_OIDC_ISSUER, SBRAIN_OIDC_CLIENT_ID, SBRAIN_OIDC_CLIENT_SECRET and
+// SBRAIN_AUTH_ALLOWED_USERS.
+type oidcProvider struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	redirectURL  string
+	allowed      map[string]bool
+	client       *http.Client
+
+	authorizationEndpoint string
+	tokenEndpoint         string
+	jwksURI               string
+
+	mu   sync.Mutex
+	keys map[string]crypto.PublicKey
+}
+
+func loadOIDCProvider() (*oidcProvider, error) {
+	issuer := strings.TrimRight(os.Getenv("SBRAIN_OIDC_ISSUER"), "/")
+	if issuer == "" {
+		return nil, nil
+	}
+
+	p := &oidcProvider{
+		issuer:       issuer,
+		clientID:     os.Getenv("SBRAIN_OIDC_CLIENT_ID"),
+		clientSecret: os.Getenv("SBRAIN_OIDC_CLIENT_SECRET"),
+		redirectURL:  os.Getenv("SBRAIN_OIDC_REDIRECT_URL"),
+		allowed:      map[string]bool{},
+		client:       &http.Client{Timeout: 10 * time.Second},
+	}
+	if p.clientID == "" || p.clientSecret == "" {
+		return nil, errors.New("SBRAIN_OIDC_CLIENT_ID and SBRAIN_OIDC_CLIENT_SECRET are required when SBRAIN_OIDC_ISSUER is set")
+	}
+	for _, user := range strings.Split(os.Getenv("SBRAIN_AUTH_ALLOWED_USERS"), ",") {
+		if user = strings.ToLower(strings.TrimSpace(user)); user != "" {
+			p.allowed[user] = true
+		}
+	}
+	if len(p.allowed) == 0 {
+		return nil, errors.New("SBRAIN_AUTH_ALLOWED_USERS is required when SBRAIN_OIDC_ISSUER is set; list the emails or GitHub logins allowed to sign in")
+	}
+
+	if issuer == githubIssuer {
+		p.authorizationEndpoint = "https://github.com/login/oauth/authorize"
+		p.tokenEndpoint = "https://github.com/login/oauth/access_token"
+		return p, nil
+	}
+
+	var discovery struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		JWKSURI               string `json:"jwks_uri"`
+	}
+	if err := p.getJSON(issuer+"/.well-known/openid-configuration", "", &discovery); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	if strings.TrimRight(discovery.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("oidc discovery: issuer mismatch %q", discovery.Issuer)
+	}
+	p.authorizationEndpoint = discovery.AuthorizationEndpoint
+	p.tokenEndpoint = discovery.TokenEndpoint
+	p.jwksURI = discovery.JWKSURI
+	return p, nil
+}
+
+func (p *oidcProvider) redirectURI(r *http.Request) string {
+	if p.redirectURL != "" {
+		return p.redirectURL
+	}
+	return publicBaseURL(r) + "/auth/callback"
+}
+
+// loginHandler starts the authorization-code flow (with PKCE) for the web UI.
+func (s *Server) loginHandler(w http.ResponseWriter, r *http.Request) {
+	p := s.auth.oidc
+	if p == nil {
+		writeError(w, r, http.StatusNotFound, "login is not configured")
+		return
+	}
+
+	state := randomToken()
+	verifier := randomToken()
+	challenge := sha256.Sum256([]byte(verifier))
+
+	next := r.URL.Query().Get("next")
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") {
+		next = "/"
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthStateCookieName,
+		Value:    state + "|" + verifier + "|" + next,
+		Path:     "/auth/",
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	params := url.Values{
+		"client_id":    {p.clientID},
+		"redirect_uri": {p.redirectURI(r)},
+		"state":        {state},
+	}
+	if p.issuer == githubIssuer {
+		params.Set("scope", "read:user user:email")
+	} else {
+		params.Set("response_type", "code")
+		params.Set("scope", "openid email profile")
+		params.Set("nonce", state)
+		params.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+		params.Set("code_challenge_method", "S256")
+	}
+	http.Redirect(w, r, p.authorizationEndpoint+"?"+params.Encode(), http.StatusFound)
+}
+
+// callbackHandler completes the login, sets the session cookie and sends the
+// browser back to where it started.
+func (s *Server) callbackHandler(w http.ResponseWriter, r *http.Request) {
+	p := s.auth.oidc
+	if p == nil {
+		writeError(w, r, http.StatusNotFound, "login is not configured")
+		return
+	}
+
+	cookie, err := r.Cookie(oauthStateCookieName)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "missing login state; start again at /auth/login")
+		return
+	}
+	parts := strings.SplitN(cookie.Value, "|", 3)
+	if len(parts) != 3 || r.URL.Query().Get("state") != parts[0] {
+		writeError(w, r, http.StatusBadRequest, "login state mismatch")
+		return
+	}
+	if errText := r.URL.Query().Get("error"); errText != "" {
+		writeError(w, r, http.StatusUnauthorized, "login failed: "+errText)
+		return
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {r.URL.Query().Get("code")},
+		"redirect_uri":  {p.redirectURI(r)},
+		"client_id":     {p.clientID},
+		"client_secret": {p.clientSecret},
+	}
+	if p.issuer != githubIssuer {
+		form.Set("code_verifier", parts[1])
+	}
+	var tokens struct {
+		AccessToken string `json:"access_token"`
+		IDToken     string `json:"id_token"`
+		Error       string `json:"error"`
+	}
+	if err := p.postForm(p.tokenEndpoint, form, &tokens); err != nil {
+		writeError(w, r, http.StatusBadGateway, fmt.Sprintf("exchange code: %v", err))
+		return
+	}
+	if tokens.Error != "" {
+		writeError(w, r, http.StatusUnauthorized, "exchange code: "+tokens.Error)
+		return
+	}
+
+	var subject string
+	if p.issuer == githubIssuer {
+		subject, err = p.githubIdentity(tokens.AccessToken)
+	} else {
+		subject, err = p.verifyIDToken(tokens.IDToken, parts[0])
+	}
+	if err != nil {
+		writeError(w, r, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	token, expires := s.auth.issueSession(subject, time.Now())
+	http.SetCookie(w, &http.Cookie{Name: oauthStateCookieName, Value: "", Path: "/auth/", MaxAge: -1})
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, parts[2], http.StatusFound)
+}
+
+func (s *Server) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{Name: sessionCookieName, Value: "", Path: "/", MaxAge: -1})
+	writeJSON(w, http.StatusOK, map[string]any{"status": "logged out"})
+}
+
+// logoutOperation documents /auth/logout, which answers every method.
+func logoutOperation(operationID string) map[string]any {
+	return map[string]any{
+		"summary":     "Clear the session cookie",
+		"operationId": operationID,
+		"security":    []map[string]any{},
+		"responses": map[string]any{
+			"200": map[string]any{
+				"description": "Logged out",
+				"content": map[string]any{
+					"application/json": map[string]any{
+						"schema": map[string]any{"$ref": "#/components/schemas/Status"},
+					},
+				},
+			},
+		},
+	}
+}
+
+// tokenExchangeHandler lets API clients trade a provider credential for an
+// sbrain bearer token: an OIDC ID token, or a GitHub access token.
+func (s *Server) tokenExchangeHandler(w http.ResponseWriter, r *http.Request) {
+	p := s.auth.oidc
+	if p == nil {
+		writeError(w, r, http.StatusNotFound, "token exchange is not configured")
+		return
+	}
+
+	var req struct {
+		IDToken     string `json:"id_token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("decode body: %v", err))
+		return
+	}
+
+	var subject string
+	var err error
+	switch {
+	case p.issuer == githubIssuer && req.AccessToken != "":
+		subject, err = p.githubIdentity(req.AccessToken)
+	case p.issuer != githubIssuer && req.IDToken != "":
+		subject, err = p.verifyIDToken(req.IDToken, "")
+	default:
+		writeError(w, r, http.StatusBadRequest, "id_token (OIDC) or access_token (GitHub) is required")
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	token, expires := s.auth.issueSession(subject, time.Now())
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_at":   expires.UTC().Format(time.RFC3339),
+		"subject":      subject,
+	})
+}
+
+func (p *oidcProvider) authorize(subject string) (string, error) {
+	subject = strings.ToLower(subject)
+	if !p.allowed[subject] {
+		return "", fmt.Errorf("%s is not allowed to sign in", subject)
+	}
+	return subject, nil
+}
+
+func (p *oidcProvider) githubIdentity(accessToken string) (string, error) {
+	var user struct {
+		Login string `json:"login"`
+	}
+	if err := p.getJSON("https://api.github.com/user", accessToken, &user); err != nil {
+		return "", fmt.Errorf("github user: %w", err)
+	}
+	if user.Login == "" {
+		return "", errors.New("github user: empty login")
+	}
+	return p.authorize(user.Login)
+}
+
+// verifyIDToken checks the signature (RS256 or ES256 against the provider's
+// JWKS), issuer, audience, expiry and, when given, nonce of an ID token and
+// returns the allowed email it identifies.
+func (p *oidcProvider) verifyIDToken(raw string, nonce string) (string, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return "", errors.New("malformed id token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return "", err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", errors.New("malformed id token signature")
+	}
+	key, err := p.publicKey(header.Kid)
+	if err != nil {
+		return "", err
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if header.Alg != "RS256" || rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], signature) != nil {
+			return "", errors.New("invalid id token signature")
+		}
+	case *ecdsa.PublicKey:
+		if header.Alg != "ES256" || len(signature) != 64 {
+			return "", errors.New("invalid id token signature")
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(k, digest[:], r, s) {
+			return "", errors.New("invalid id token signature")
+		}
+	default:
+		return "", errors.New("unsupported id token key")
+	}
+
+	var claims struct {
+		Issuer        string          `json:"iss"`
+		Audience      json.RawMessage `json:"aud"`
+		ExpiresAt     int64           `json:"exp"`
+		Nonce         string          `json:"nonce"`
+		Email         string          `json:"email"`
+		EmailVerified *bool           `json:"email_verified"`
+	}
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return "", err
+	}
+	if strings.TrimRight(claims.Issuer, "/") != p.issuer {
+		return "", errors.New("id token issuer mismatch")
+	}
+	if !audienceContains(claims.Audience, p.clientID) {
+		return "", errors.New("id token audience mismatch")
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return "", errors.New("id token expired")
+	}
+	if nonce != "" && claims.Nonce != nonce {
+		return "", errors.New("id token nonce mismatch")
+	}
+	if claims.Email == "" || (claims.EmailVerified != nil && !*claims.EmailVerified) {
+		return "", errors.New("id token has no verified email")
+	}
+	return p.authorize(claims.Email)
+}
+
+// publicKey returns the JWKS key for kid, refetching the key set once when
+// the kid is unknown (providers rotate keys).
+func (p *oidcProvider) publicKey(kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := p.getJSON(p.jwksURI, "", &set); err != nil {
+		return nil, fmt.Errorf("fetch jwks: %w", err)
+	}
+
+	p.keys = map[string]crypto.PublicKey{}
+	for _, k := range set.Keys {
+		switch k.Kty {
+		case "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(k.N)
+			e, errE := base64.RawURLEncoding.DecodeString(k.E)
+			if errN != nil || errE != nil {
+				continue
+			}
+			p.keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "EC":
+			if k.Crv != "P-256" {
+				continue
+			}
+			x, errX := base64.RawURLEncoding.DecodeString(k.X)
+			y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+			if errX != nil || errY != nil {
+				continue
+			}
+			p.keys[k.Kid] = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		}
+	}
+
+	key, ok := p.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown id token key %q", kid)
+	}
+	return key, nil
+}
+
+func (p *oidcProvider) getJSON(endpoint string, bearer string, dest any) error {
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	return p.do(req, dest)
+}
+
+func (p *oidcProvider) postForm(endpoint string, form url.Values, dest any) error {
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	return p.do(req, dest)
+}
+
+func (p *oidcProvider) do(req *http.Request, dest any) error {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s returned %s", req.URL.Host, resp.Status)
+	}
+	return json.Unmarshal(body, dest)
+}
+
+func decodeJWTPart(part string, dest any) error {
+	raw, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return errors.New("malformed id token")
+	}
+	if err := json.Unmarshal(raw, dest); err != nil {
+		return errors.New("malformed id token")
+	}
+	return nil
+}
+
+func audienceContains(raw json.RawMessage, clientID string) bool {
+	var single string
+	if json.Unmarshal(raw, &single) == nil {
+		return single == clientID
+	}
+	var many []string
+	if json.Unmarshal(raw, &many) == nil {
+		for _, aud := range many {
+			if aud == clientID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func randomToken() string {
+	b := make([]byte, 24)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,483 @@
+package sbrain
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"sbrain/store"
+)
+
+// otlpRecord is one OpenTelemetry log record together with the resource and
+// instrumentation scope it was reported under.
+type otlpRecord struct {
+	Resource       map[string]any
+	ScopeName      string
+	ScopeVersion   string
+	TimeUnixNano   uint64
+	SeverityNumber int
+	SeverityText   string
+	Body           any
+	Attributes     map[string]any
+	TraceID        string
+	SpanID         string
+}
+
+// otlpLogsHandler implements the OTLP/HTTP logs endpoint (POST /v1/logs) for
+// both the binary protobuf and JSON encodings, optionally gzipped, so an
+// OpenTelemetry collector or SDK exporter can use sbrain as a log sink.
+func (s *Server) otlpLogsHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxLokiPushBytes))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("read body: %v", err))
+		return
+	}
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		if body, err = gunzip(body); err != nil {
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("decompress body: %v", err))
+			return
+		}
+	}
+
+	isJSON := strings.HasPrefix(r.Header.Get("Content-Type"), "application/json")
+	var records []otlpRecord
+	if isJSON {
+		records, err = parseOTLPJSON(body)
+	} else {
+		records, err = parseOTLPProtobuf(body)
+	}
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("decode export request: %v", err))
+		return
+	}
+
+	peer, _, _ := net.SplitHostPort(r.RemoteAddr)
+	service, ok := requestLogService(w, r)
+	if !ok {
+		return
+	}
+	for _, rec := range records {
+		e := otlpToLogEntry(rec, peer)
+		e.Service = cmp.Or(e.Service, service)
+		if _, err := s.insertLog(r.Context(), e); err != nil {
+			writeError(w, r, ingestErrorStatus(err), err.Error())
+			return
+		}
+	}
+
+	// An empty ExportLogsServiceResponse signals full success.
+	if isJSON {
+		writeJSON(w, http.StatusOK, map[string]any{})
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.WriteHeader(http.StatusOK)
+}
+
+// otlpToLogEntry maps a record onto the logs table. Well-known HTTP semantic
+// convention attributes fill the matching columns and the resource's
+// service.name the service; everything else, including the resource
+// attributes, is kept in metadata.
+func otlpToLogEntry(rec otlpRecord, peer string) logEntry {
+	attr := func(keys ...string) string {
+		for _, key := range keys {
+			if v, ok := rec.Attributes[key]; ok {
+				return fmt.Sprint(v)
+			}
+		}
+		return ""
+	}
+
+	e := logEntry{
+		Level:     otlpLevel(rec.SeverityNumber, rec.SeverityText),
+		Endpoint:  attr("url.path", "http.route", "http.target"),
+		Method:    strings.ToUpper(attr("http.request.method", "http.method")),
+		IP:        firstNonEmpty(attr("client.address", "net.peer.ip"), peer),
+		UserAgent: attr("user_agent.original", "http.user_agent"),
+		RequestID: firstNonEmpty(attr("request_id", "http.request.id"), rec.TraceID),
+	}
+	if rec.TimeUnixNano > 0 {
+		e.OccurredAt = store.NewTimestamp(time.Unix(0, int64(rec.TimeUnixNano)))
+	}
+	if code, err := strconv.Atoi(attr("http.response.status_code", "http.status_code")); err == nil {
+		e.StatusCode = &code
+	}
+	if service, ok := rec.Resource["service.name"].(string); ok && validLogService(service) {
+		e.Service = service
+	}
+
+	switch body := rec.Body.(type) {
+	case string:
+		e.Message = body
+	case nil:
+		e.Message = "(empty log record)"
+	default:
+		encoded, _ := json.Marshal(body)
+		e.Message = string(encoded)
+	}
+
+	metadata := map[string]any{"resource": rec.Resource}
+	if len(rec.Attributes) > 0 {
+		metadata["attributes"] = rec.Attributes
+	}
+	if rec.ScopeName != "" {
+		metadata["scope"] = map[string]string{"name": rec.ScopeName, "version": rec.ScopeVersion}
+	}
+	if rec.TimeUnixNano > 0 {
+		metadata["timestamp"] = time.Unix(0, int64(rec.TimeUnixNano)).UTC().Format(time.RFC3339Nano)
+	}
+	if rec.SeverityText != "" {
+		metadata["severity_text"] = rec.SeverityText
+	}
+	if rec.TraceID != "" {
+		metadata["trace_id"] = rec.TraceID
+	}
+	if rec.SpanID != "" {
+		metadata["span_id"] = rec.SpanID
+	}
+	encoded, _ := json.Marshal(metadata)
+	e.Metadata = string(encoded)
+	return e
+}
+
+// otlpLevel maps an OTLP severity number (1-24, four per level) to a log
+// level, falling back to the severity text.
+func otlpLevel(number int, text string) string {
+	switch {
+	case number >= 21:
+		return "fatal"
+	case number >= 17:
+		return "error"
+	case number >= 13:
+		return "warn"
+	case number >= 9:
+		return "info"
+	case number >= 1:
+		return "debug"
+	}
+	return normalizeLevel(text)
+}
+
+func parseOTLPJSON(body []byte) ([]otlpRecord, error) {
+	type keyValue struct {
+		Key   string          `json:"key"`
+		Value json.RawMessage `json:"value"`
+	}
+	var req struct {
+		ResourceLogs []struct {
+			Resource struct {
+				Attributes []keyValue `json:"attributes"`
+			} `json:"resource"`
+			ScopeLogs []struct {
+				Scope struct {
+					Name    string `json:"name"`
+					Version string `json:"version"`
+				} `json:"scope"`
+				LogRecords []struct {
+					TimeUnixNano         json.Number     `json:"timeUnixNano"`
+					ObservedTimeUnixNano json.Number     `json:"observedTimeUnixNano"`
+					SeverityNumber       int             `json:"severityNumber"`
+					SeverityText         string          `json:"severityText"`
+					Body                 json.RawMessage `json:"body"`
+					Attributes           []keyValue      `json:"attributes"`
+					TraceID              string          `json:"traceId"`
+					SpanID               string          `json:"spanId"`
+				} `json:"logRecords"`
+			} `json:"scopeLogs"`
+		} `json:"resourceLogs"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+
+	attributes := func(kvs []keyValue) (map[string]any, error) {
+		out := map[string]any{}
+		for _, kv := range kvs {
+			v, err := otlpJSONValue(kv.Value)
+			if err != nil {
+				return nil, fmt.Errorf("attribute %q: %w", kv.Key, err)
+			}
+			out[kv.Key] = v
+		}
+		return out, nil
+	}
+
+	var records []otlpRecord
+	for _, rl := range req.ResourceLogs {
+		resource, err := attributes(rl.Resource.Attributes)
+		if err != nil {
+			return nil, err
+		}
+		for _, sl := range rl.ScopeLogs {
+			for _, lr := range sl.LogRecords {
+				rec := otlpRecord{
+					Resource:       resource,
+					ScopeName:      sl.Scope.Name,
+					ScopeVersion:   sl.Scope.Version,
+					SeverityNumber: lr.SeverityNumber,
+					SeverityText:   lr.SeverityText,
+					TraceID:        strings.ToLower(lr.TraceID),
+					SpanID:         strings.ToLower(lr.SpanID),
+				}
+				ts := lr.TimeUnixNano
+				if ts == "" || ts == "0" {
+					ts = lr.ObservedTimeUnixNano
+				}
+				if ts != "" {
+					if rec.TimeUnixNano, err = strconv.ParseUint(ts.String(), 10, 64); err != nil {
+						return nil, fmt.Errorf("invalid timeUnixNano %q", ts)
+					}
+				}
+				if rec.Body, err = otlpJSONValue(lr.Body); err != nil {
+					return nil, fmt.Errorf("body: %w", err)
+				}
+				if rec.Attributes, err = attributes(lr.Attributes); err != nil {
+					return nil, err
+				}
+				records = append(records, rec)
+			}
+		}
+	}
+	return records, nil
+}
+
+// otlpJSONValue converts an AnyValue in its JSON form ({"stringValue": ...},
+// {"intValue": "42"}, {"kvlistValue": {"values": [...]}}, ...) to a plain Go
+// value.
+func otlpJSONValue(raw json.RawMessage) (any, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var v struct {
+		StringValue *string          `json:"stringValue"`
+		BoolValue   *bool            `json:"boolValue"`
+		IntValue    *json.Number     `json:"intValue"`
+		DoubleValue *float64         `json:"doubleValue"`
+		BytesValue  *string          `json:"bytesValue"`
+		ArrayValue  *json.RawMessage `json:"arrayValue"`
+		KvlistValue *json.RawMessage `json:"kvlistValue"`
+	}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case v.StringValue != nil:
+		return *v.StringValue, nil
+	case v.BoolValue != nil:
+		return *v.BoolValue, nil
+	case v.IntValue != nil:
+		return v.IntValue.Int64()
+	case v.DoubleValue != nil:
+		return *v.DoubleValue, nil
+	case v.BytesValue != nil:
+		return *v.BytesValue, nil
+	case v.ArrayValue != nil:
+		var arr struct {
+			Values []json.RawMessage `json:"values"`
+		}
+		if err := json.Unmarshal(*v.ArrayValue, &arr); err != nil {
+			return nil, err
+		}
+		out := []any{}
+		for _, item := range arr.Values {
+			value, err := otlpJSONValue(item)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, value)
+		}
+		return out, nil
+	case v.KvlistValue != nil:
+		var list struct {
+			Values []struct {
+				Key   string          `json:"key"`
+				Value json.RawMessage `json:"value"`
+			} `json:"values"`
+		}
+		if err := json.Unmarshal(*v.KvlistValue, &list); err != nil {
+			return nil, err
+		}
+		out := map[string]any{}
+		for _, kv := range list.Values {
+			value, err := otlpJSONValue(kv.Value)
+			if err != nil {
+				return nil, err
+			}
+			out[kv.Key] = value
+		}
+		return out, nil
+	}
+	return nil, nil
+}
+
+// parseOTLPProtobuf decodes ExportLogsServiceRequest:
+//
+//	ExportLogsServiceRequest { repeated ResourceLogs resource_logs = 1; }
+//	ResourceLogs  { Resource resource = 1; repeated ScopeLogs scope_logs = 2; }
+//	Resource      { repeated KeyValue attributes = 1; }
+//	ScopeLogs     { InstrumentationScope scope = 1; repeated LogRecord log_records = 2; }
+//	InstrumentationScope { string name = 1; string version = 2; }
+//	LogRecord     { fixed64 time_unix_nano = 1; int32 severity_number = 2; string severity_text = 3;
+//	                AnyValue body = 5; repeated KeyValue attributes = 6; bytes trace_id = 9;
+//	                bytes span_id = 10; fixed64 observed_time_unix_nano = 11; }
+func parseOTLPProtobuf(body []byte) ([]otlpRecord, error) {
+	var records []otlpRecord
+	err := protoFields(body, func(rl protoField) error {
+		if rl.Number != 1 || rl.WireType != protoBytes {
+			return nil
+		}
+		resource := map[string]any{}
+		var scopeLogs [][]byte
+		err := protoFields(rl.Bytes, func(f protoField) error {
+			switch {
+			case f.Number == 1 && f.WireType == protoBytes:
+				return protoFields(f.Bytes, func(a protoField) error {
+					if a.Number == 1 && a.WireType == protoBytes {
+						return otlpProtoKeyValue(a.Bytes, resource)
+					}
+					return nil
+				})
+			case f.Number == 2 && f.WireType == protoBytes:
+				scopeLogs = append(scopeLogs, f.Bytes)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, sl := range scopeLogs {
+			var scopeName, scopeVersion string
+			err := protoFields(sl, func(f protoField) error {
+				switch {
+				case f.Number == 1 && f.WireType == protoBytes:
+					return protoFields(f.Bytes, func(sf protoField) error {
+						switch sf.Number {
+						case 1:
+							scopeName = sf.String()
+						case 2:
+							scopeVersion = sf.String()
+						}
+						return nil
+					})
+				case f.Number == 2 && f.WireType == protoBytes:
+					rec, err := parseOTLPProtoRecord(f.Bytes)
+					if err != nil {
+						return err
+					}
+					rec.Resource, rec.ScopeName, rec.ScopeVersion = resource, scopeName, scopeVersion
+					records = append(records, rec)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return records, err
+}
+
+func parseOTLPProtoRecord(b []byte) (otlpRecord, error) {
+	rec := otlpRecord{Attributes: map[string]any{}}
+	var observed uint64
+	err := protoFields(b, func(f protoField) error {
+		var err error
+		switch f.Number {
+		case 1:
+			rec.TimeUnixNano = f.Uint
+		case 2:
+			rec.SeverityNumber = int(f.Uint)
+		case 3:
+			rec.SeverityText = f.String()
+		case 5:
+			rec.Body, err = otlpProtoValue(f.Bytes)
+		case 6:
+			err = otlpProtoKeyValue(f.Bytes, rec.Attributes)
+		case 9:
+			rec.TraceID = hex.EncodeToString(f.Bytes)
+		case 10:
+			rec.SpanID = hex.EncodeToString(f.Bytes)
+		case 11:
+			observed = f.Uint
+		}
+		return err
+	})
+	if rec.TimeUnixNano == 0 {
+		rec.TimeUnixNano = observed
+	}
+	return rec, err
+}
+
+func otlpProtoKeyValue(b []byte, into map[string]any) error {
+	var key string
+	var value any
+	err := protoFields(b, func(f protoField) error {
+		var err error
+		switch f.Number {
+		case 1:
+			key = f.String()
+		case 2:
+			value, err = otlpProtoValue(f.Bytes)
+		}
+		return err
+	})
+	if err == nil {
+		into[key] = value
+	}
+	return err
+}
+
+// otlpProtoValue decodes an AnyValue oneof.
+func otlpProtoValue(b []byte) (any, error) {
+	var value any
+	err := protoFields(b, func(f protoField) error {
+		switch f.Number {
+		case 1:
+			value = f.String()
+		case 2:
+			value = f.Uint != 0
+		case 3:
+			value = int64(f.Uint)
+		case 4:
+			value = math.Float64frombits(f.Uint)
+		case 5, 6:
+			var items []any
+			kv := map[string]any{}
+			err := protoFields(f.Bytes, func(item protoField) error {
+				if item.Number != 1 {
+					return nil
+				}
+				if f.Number == 6 {
+					return otlpProtoKeyValue(item.Bytes, kv)
+				}
+				v, err := otlpProtoValue(item.Bytes)
+				items = append(items, v)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			if f.Number == 6 {
+				value = kv
+			} else {
+				value = items
+			}
+		case 7:
+			value = base64.StdEncoding.EncodeToString(f.Bytes)
+		}
+		return nil
+	})
+	return value, err
+}
@@ -0,0 +1,258 @@
+package sbrain
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// A minimal PDF writer for exporting records: A4 pages of text in the
+// standard Type 1 fonts, which every reader has, so nothing is embedded.
+// Text is encoded as WinAnsi; characters outside it print as "?".
+
+const (
+	pdfPageWidth  = 595.28
+	pdfPageHeight = 841.89
+	pdfMargin     = 56.0
+	// pdfFooter is the space kept free at the bottom for page numbers.
+	pdfFooter = 24.0
+)
+
+// pdfFont is one of the standard fonts with its glyph widths, in thousandths
+// of the font size, for ' ' through '~'. Fixed-pitch fonts set fixed instead.
+type pdfFont struct {
+	resource string
+	base     string
+	widths   *[95]int
+	fixed    int
+}
+
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+var helveticaBoldWidths = [95]int{
+	278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+	975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+	333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+	611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+}
+
+var (
+	pdfRegular = &pdfFont{resource: "F1", base: "Helvetica", widths: &helveticaWidths}
+	pdfBold    = &pdfFont{resource: "F2", base: "Helvetica-Bold", widths: &helveticaBoldWidths}
+	pdfItalic  = &pdfFont{resource: "F3", base: "Helvetica-Oblique", widths: &helveticaWidths}
+	pdfMono    = &pdfFont{resource: "F4", base: "Courier", fixed: 600}
+	pdfFonts   = []*pdfFont{pdfRegular, pdfBold, pdfItalic, pdfMono}
+)
+
+// width returns how wide s is set in f at size points.
+func (f *pdfFont) width(s string, size float64) float64 {
+	total := 0
+	for _, r := range s {
+		switch {
+		case f.fixed > 0:
+			total += f.fixed
+		case r >= ' ' && r <= '~':
+			total += f.widths[r-' ']
+		default:
+			total += 556
+		}
+	}
+	return float64(total) * size / 1000
+}
+
+// winAnsi maps the characters of WinAnsiEncoding outside Latin-1.
+var winAnsi = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87, 'ˆ': 0x88,
+	'‰': 0x89, 'Š': 0x8a, '‹': 0x8b, 'Œ': 0x8c, 'Ž': 0x8e, '‘': 0x91, '’': 0x92, '“': 0x93,
+	'”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '˜': 0x98, '™': 0x99, 'š': 0x9a, '›': 0x9b,
+	'œ': 0x9c, 'ž': 0x9e, 'Ÿ': 0x9f,
+}
+
+// pdfString encodes s as a PDF literal string in WinAnsiEncoding.
+func pdfString(s string) string {
+	var out strings.Builder
+	out.WriteByte('(')
+	for _, r := range s {
+		var c byte
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			out.WriteByte('\\')
+			c = byte(r)
+		case r >= ' ' && r <= '~', r >= 0xa0 && r <= 0xff:
+			c = byte(r)
+		case winAnsi[r] != 0:
+			c = winAnsi[r]
+		default:
+			c = '?'
+		}
+		out.WriteByte(c)
+	}
+	out.WriteByte(')')
+	return out.String()
+}
+
+// pdfWriter lays text out top to bottom, starting a page when one is full.
+type pdfWriter struct {
+	title string
+	pages []*bytes.Buffer
+	page  *bytes.Buffer
+	// y is the baseline of the last line written on the page.
+	y float64
+}
+
+func newPDFWriter(title string) *pdfWriter {
+	return &pdfWriter{title: title}
+}
+
+func (p *pdfWriter) newPage() {
+	p.page = &bytes.Buffer{}
+	p.pages = append(p.pages, p.page)
+	p.y = pdfPageHeight - pdfMargin
+}
+
+// space moves down by h, starting a new page when there is not room for h.
+func (p *pdfWriter) space(h float64) {
+	if p.page == nil || p.y-h < pdfMargin+pdfFooter {
+		p.newPage()
+	}
+	p.y -= h
+}
+
+// gap leaves h of vertical space unless the page is still empty.
+func (p *pdfWriter) gap(h float64) {
+	if p.page != nil && p.y < pdfPageHeight-pdfMargin {
+		p.y -= h
+	}
+}
+
+func (p *pdfWriter) textAt(f *pdfFont, size, x, y float64, s string) {
+	fmt.Fprintf(p.page, "BT /%s %.1f Tf %.2f %.2f Td %s Tj ET\n", f.resource, size, x, y, pdfString(s))
+}
+
+// paragraph writes s wrapped to the text width less indent, with lead
+// between baselines.
+func (p *pdfWriter) paragraph(f *pdfFont, size, indent float64, s string) {
+	for _, line := range wrapPDFText(f, size, pdfPageWidth-2*pdfMargin-indent, s) {
+		p.space(size * 1.35)
+		p.textAt(f, size, pdfMargin+indent, p.y, line)
+	}
+}
+
+// bullet writes marker in the indent before the first line of s.
+func (p *pdfWriter) bullet(f *pdfFont, size, indent float64, marker, s string) {
+	lines := wrapPDFText(f, size, pdfPageWidth-2*pdfMargin-indent, s)
+	for i, line := range lines {
+		p.space(size * 1.35)
+		if i == 0 {
+			p.textAt(f, size, pdfMargin+indent-f.width(marker+" ", size), p.y, marker)
+		}
+		p.textAt(f, size, pdfMargin+indent, p.y, line)
+	}
+}
+
+// rule draws a thin horizontal line across the text width.
+func (p *pdfWriter) rule() {
+	p.space(8)
+	fmt.Fprintf(p.page, "0.75 G 0.5 w %.2f %.2f m %.2f %.2f l S 0 G\n", pdfMargin, p.y, pdfPageWidth-pdfMargin, p.y)
+	p.y -= 6
+}
+
+// wrapPDFText breaks s into lines no wider than width, between words where
+// it can and inside a word that is wider than a line on its own.
+func wrapPDFText(f *pdfFont, size, width float64, s string) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(s) {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if f.width(candidate, size) <= width {
+			line = candidate
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+		line = word
+		for f.width(line, size) > width {
+			runes := []rune(line)
+			n := len(runes) - 1
+			for n > 1 && f.width(string(runes[:n]), size) > width {
+				n--
+			}
+			lines = append(lines, string(runes[:n]))
+			line = string(runes[n:])
+		}
+	}
+	if line != "" || len(lines) == 0 {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// bytes assembles the document, numbering the pages in their footers.
+func (p *pdfWriter) bytes(created time.Time) []byte {
+	if len(p.pages) == 0 {
+		p.newPage()
+	}
+	for i, page := range p.pages {
+		label := fmt.Sprintf("%d / %d", i+1, len(p.pages))
+		fmt.Fprintf(page, "0.5 g BT /%s 8.0 Tf %.2f %.2f Td %s Tj ET 0 g\n", pdfRegular.resource,
+			(pdfPageWidth-pdfRegular.width(label, 8))/2, pdfMargin/2, pdfString(label))
+	}
+
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+	// Objects: 1 catalog, 2 page tree, 3 info, then the fonts, then a page
+	// and its contents for each page.
+	firstFont := 4
+	firstPage := firstFont + len(pdfFonts)
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	kids := make([]string, len(p.pages))
+	for i := range p.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPage+2*i)
+	}
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(p.pages)))
+	object(fmt.Sprintf("<< /Title %s /Producer (sbrain) /CreationDate (D:%s) >>",
+		pdfString(p.title), created.UTC().Format("20060102150405Z")))
+	fonts := make([]string, len(pdfFonts))
+	for i, f := range pdfFonts {
+		object(fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", f.base))
+		fonts[i] = fmt.Sprintf("/%s %d 0 R", f.resource, firstFont+i)
+	}
+	for i, page := range p.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << %s >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, strings.Join(fonts, " "), firstPage+2*i+1))
+		var stream bytes.Buffer
+		zw := zlib.NewWriter(&stream)
+		zw.Write(page.Bytes())
+		zw.Close()
+		object(fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", stream.Len(), stream.Bytes()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info 3 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
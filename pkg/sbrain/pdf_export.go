@@ -0,0 +1,212 @@
+package sbrain
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"sbrain/store"
+)
+
+// maxPDFExportRecords caps GET /export/pdf, which builds the whole document
+// in memory.
+const maxPDFExportRecords = 500
+
+// brainPDF serves GET /brain/{id}/pdf: the record as a PDF document, its
+// context rendered from markdown.
+func (s *Server) brainPDF(w http.ResponseWriter, r *http.Request, id int64) {
+	b, err := s.brains.GetBrain(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, r, http.StatusNotFound, "not found")
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	name := sanitizeFilename(b.Title)
+	if name == "" {
+		name = fmt.Sprintf("brain-%d", b.ID)
+	}
+	writePDF(w, name+".pdf", renderBrainsPDF(b.Title, []brain{b}))
+}
+
+// pdfExportHandler serves GET /export/pdf: every record matching the brain
+// list filters in one document, oldest first, each starting on a new page.
+func (s *Server) pdfExportHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseBrainFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	var items []brain
+	if err := s.brains.ListBrains(r.Context(), filter, func(b brain) error {
+		items = append(items, b)
+		return nil
+	}); err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if len(items) == 0 {
+		writeError(w, r, http.StatusNotFound, "no records match the filters")
+		return
+	}
+	if len(items) > maxPDFExportRecords {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("%d records match; narrow the filters to at most %d", len(items), maxPDFExportRecords))
+		return
+	}
+	// The list puts pinned and recent records first; a document reads
+	// better in the order they were written.
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].CreatedAt != items[j].CreatedAt {
+			return items[i].CreatedAt < items[j].CreatedAt
+		}
+		return items[i].ID < items[j].ID
+	})
+	title := "sbrain export"
+	if filter.Project != "" {
+		title += " — " + filter.Project
+	}
+	writePDF(w, fmt.Sprintf("sbrain-export-%s.pdf", time.Now().UTC().Format("20060102")), renderBrainsPDF(title, items))
+}
+
+func writePDF(w http.ResponseWriter, filename string, doc []byte) {
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+	w.Write(doc)
+}
+
+// renderBrainsPDF lays out each record on its own pages: the title, a line
+// of project, tags and date, the summary if there is one, and the context.
+func renderBrainsPDF(title string, items []brain) []byte {
+	p := newPDFWriter(title)
+	for _, b := range items {
+		p.newPage()
+		p.paragraph(pdfBold, 18, 0, b.Title)
+		var meta []string
+		if b.Project != "" {
+			meta = append(meta, b.Project)
+		}
+		if tags := splitTags(b.Tags); len(tags) > 0 {
+			meta = append(meta, "#"+strings.Join(tags, " #"))
+		}
+		meta = append(meta, b.CreatedAt.Display())
+		p.gap(2)
+		p.paragraph(pdfItalic, 9, 0, strings.Join(meta, "  ·  "))
+		if b.Summary != "" {
+			p.gap(8)
+			p.paragraph(pdfItalic, 10.5, 12, b.Summary)
+		}
+		p.rule()
+		renderMarkdownPDF(p, b.Context)
+	}
+	return p.bytes(time.Now())
+}
+
+var (
+	pdfHeadingPattern  = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	pdfBulletPattern   = regexp.MustCompile(`^(\s*)[-*+]\s+(.*)$`)
+	pdfNumberedPattern = regexp.MustCompile(`^(\s*)(\d+[.)])\s+(.*)$`)
+	pdfRulePattern     = regexp.MustCompile(`^\s*(?:(?:-\s*){3,}|(?:\*\s*){3,}|(?:_\s*){3,})$`)
+	pdfLinkPattern     = regexp.MustCompile(`!?\[([^\]]*)\]\(([^)\s]+)[^)]*\)`)
+	pdfEmphasisPattern = regexp.MustCompile("\\*\\*|__|`")
+)
+
+// renderMarkdownPDF writes the block structure of markdown: headings,
+// paragraphs, lists, quotes, rules and code blocks. Inline markup is reduced
+// to plain text, with link targets in parentheses.
+func renderMarkdownPDF(p *pdfWriter, markdown string) {
+	const size = 10.5
+	var para []string
+	flush := func() {
+		if len(para) > 0 {
+			p.gap(size * 0.5)
+			p.paragraph(pdfRegular, size, 0, pdfInline(strings.Join(para, " ")))
+			para = nil
+		}
+	}
+	inCode := false
+	for _, line := range strings.Split(strings.ReplaceAll(markdown, "\r\n", "\n"), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			flush()
+			if !inCode {
+				p.gap(size * 0.5)
+			}
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			code := strings.ReplaceAll(line, "\t", "    ")
+			// Courier is 0.6 em wide, so this many characters fit a line.
+			perLine := int(math.Floor((pdfPageWidth - 2*pdfMargin - 8) / (9 * 0.6)))
+			for {
+				p.space(9 * 1.3)
+				chunk := []rune(code)
+				if len(chunk) > perLine {
+					chunk = chunk[:perLine]
+				}
+				p.textAt(pdfMono, 9, pdfMargin+8, p.y, string(chunk))
+				code = string([]rune(code)[len(chunk):])
+				if code == "" {
+					break
+				}
+			}
+			continue
+		}
+
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			flush()
+		case pdfRulePattern.MatchString(line):
+			flush()
+			p.rule()
+		case pdfHeadingPattern.MatchString(trimmed):
+			flush()
+			m := pdfHeadingPattern.FindStringSubmatch(trimmed)
+			headingSize := map[int]float64{1: 16, 2: 13.5}[len(m[1])]
+			if headingSize == 0 {
+				headingSize = 11.5
+			}
+			p.gap(headingSize * 0.6)
+			p.paragraph(pdfBold, headingSize, 0, pdfInline(strings.TrimRight(m[2], "# ")))
+		case pdfBulletPattern.MatchString(line):
+			flush()
+			m := pdfBulletPattern.FindStringSubmatch(line)
+			p.bullet(pdfRegular, size, 14+pdfListIndent(m[1]), "•", pdfInline(m[2]))
+		case pdfNumberedPattern.MatchString(line):
+			flush()
+			m := pdfNumberedPattern.FindStringSubmatch(line)
+			p.bullet(pdfRegular, size, 18+pdfListIndent(m[1]), m[2], pdfInline(m[3]))
+		case strings.HasPrefix(trimmed, ">"):
+			flush()
+			p.paragraph(pdfItalic, size, 14, pdfInline(strings.TrimSpace(strings.TrimLeft(trimmed, "> "))))
+		default:
+			para = append(para, trimmed)
+		}
+	}
+	flush()
+}
+
+// pdfListIndent is the extra indent of a nested list item.
+func pdfListIndent(leading string) float64 {
+	return float64(len(strings.ReplaceAll(leading, "\t", "  "))/2) * 14
+}
+
+// pdfInline reduces inline markdown to plain text.
+func pdfInline(s string) string {
+	s = pdfLinkPattern.ReplaceAllStringFunc(s, func(link string) string {
+		m := pdfLinkPattern.FindStringSubmatch(link)
+		if m[1] == "" || m[1] == m[2] {
+			return m[2]
+		}
+		return m[1] + " (" + m[2] + ")"
+	})
+	return pdfEmphasisPattern.ReplaceAllString(s, "")
+}
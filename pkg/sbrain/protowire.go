@@ -0,0 +1,164 @@
+package sbrain
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// The push endpoints for Loki and OTLP receive protocol buffers. Rather than
+// pulling in generated code for a handful of messages, protoFields walks the
+// wire format directly; callers pick out the field numbers they need.
+
+// Protocol buffer wire types.
+const (
+	protoVarint  = 0
+	protoFixed64 = 1
+	protoBytes   = 2
+	protoFixed32 = 5
+)
+
+// protoField is one field of an encoded message. Varint and fixed-width
+// values are in Uint; length-delimited values (strings, bytes, nested
+// messages, packed repeated fields) are in Bytes.
+type protoField struct {
+	Number   int
+	WireType int
+	Uint     uint64
+	Bytes    []byte
+}
+
+func (f protoField) String() string { return string(f.Bytes) }
+
+// protoFields calls fn for every field of the encoded message b, in order.
+func protoFields(b []byte, fn func(protoField) error) error {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errors.New("protobuf: malformed field key")
+		}
+		b = b[n:]
+
+		f := protoField{Number: int(key >> 3), WireType: int(key & 7)}
+		switch f.WireType {
+		case protoVarint:
+			f.Uint, n = binary.Uvarint(b)
+			if n <= 0 {
+				return errors.New("protobuf: malformed varint")
+			}
+			b = b[n:]
+		case protoFixed64:
+			if len(b) < 8 {
+				return errors.New("protobuf: truncated fixed64")
+			}
+			f.Uint, b = binary.LittleEndian.Uint64(b), b[8:]
+		case protoFixed32:
+			if len(b) < 4 {
+				return errors.New("protobuf: truncated fixed32")
+			}
+			f.Uint, b = uint64(binary.LittleEndian.Uint32(b)), b[4:]
+		case protoBytes:
+			length, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < length {
+				return errors.New("protobuf: truncated length-delimited field")
+			}
+			f.Bytes, b = b[n:n+int(length)], b[n+int(length):]
+		default:
+			return fmt.Errorf("protobuf: unsupported wire type %d", f.WireType)
+		}
+
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// snappyMaxExpansion bounds how many bytes a snappy block decodes to per
+// byte of input: the densest element, a copy with a 2-byte offset, turns 3
+// bytes into 64.
+const snappyMaxExpansion = 64/3 + 1
+
+// snappyDecode decodes a snappy block (not the framed stream format), as
+// used by Prometheus remote write and the Loki push API. Blocks that say
+// they decode to more than limit bytes, or to more than their size allows,
+// are rejected before anything is allocated for them.
+func snappyDecode(src []byte, limit int) ([]byte, error) {
+	length, n := binary.Uvarint(src)
+	if n <= 0 || length > uint64(len(src)-n)*snappyMaxExpansion {
+		return nil, errors.New("snappy: invalid length header")
+	}
+	if length > uint64(limit) {
+		return nil, fmt.Errorf("snappy: decoded length %d exceeds %d bytes", length, limit)
+	}
+	src = src[n:]
+	dst := make([]byte, 0, length)
+
+	for len(src) > 0 {
+		tag := src[0]
+		var size, offset int
+		switch tag & 3 {
+		case 0: // literal
+			size = int(tag>>2) + 1
+			src = src[1:]
+			if size > 60 {
+				extra := size - 60
+				if len(src) < extra {
+					return nil, errors.New("snappy: truncated literal length")
+				}
+				size = 0
+				for i := extra - 1; i >= 0; i-- {
+					size = size<<8 | int(src[i])
+				}
+				size++
+				src = src[extra:]
+			}
+			if size > len(src) {
+				return nil, errors.New("snappy: truncated literal")
+			}
+			if uint64(len(dst)+size) > length {
+				return nil, errors.New("snappy: decoded length mismatch")
+			}
+			dst = append(dst, src[:size]...)
+			src = src[size:]
+			continue
+		case 1: // copy, 1-byte offset
+			if len(src) < 2 {
+				return nil, errors.New("snappy: truncated copy")
+			}
+			size = 4 + int(tag>>2&7)
+			offset = int(tag&0xe0)<<3 | int(src[1])
+			src = src[2:]
+		case 2: // copy, 2-byte offset
+			if len(src) < 3 {
+				return nil, errors.New("snappy: truncated copy")
+			}
+			size = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint16(src[1:]))
+			src = src[3:]
+		case 3: // copy, 4-byte offset
+			if len(src) < 5 {
+				return nil, errors.New("snappy: truncated copy")
+			}
+			size = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint32(src[1:]))
+			src = src[5:]
+		}
+		if offset <= 0 || offset > len(dst) {
+			return nil, errors.New("snappy: invalid copy offset")
+		}
+		if uint64(len(dst)+size) > length {
+			return nil, errors.New("snappy: decoded length mismatch")
+		}
+		// Copies may overlap their own output, so go byte by byte.
+		start := len(dst) - offset
+		for i := 0; i < size; i++ {
+			dst = append(dst, dst[start+i])
+		}
+	}
+
+	if uint64(len(dst)) != length {
+		return nil, errors.New("snappy: decoded length mismatch")
+	}
+	return dst, nil
+}
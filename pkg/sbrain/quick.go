@@ -0,0 +1,102 @@
+package sbrain
+
+import (
+	_ "embed"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+//go:embed web/quick.html
+var quickHTML string
+
+var quickTemplate = template.Must(template.New("quick").Parse(quickHTML))
+
+// quickCapturePath is GET/POST /quick. It creates a record even on GET,
+// so scopes and disk protection treat it as a write whatever the method.
+const quickCapturePath = "/quick"
+
+// quickCapture serves GET and POST /quick for iOS Shortcuts, Android
+// intents and plain links: text, project and tags come from the query
+// string or a form body, the first line of text becomes the title, and the
+// answer is a tiny confirmation page (JSON when the client asks for it).
+func (s *Server) quickCapture(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		s.quickReply(w, r, http.StatusBadRequest, brain{}, "could not read the form: "+err.Error())
+		return
+	}
+	text := strings.TrimSpace(strings.ReplaceAll(r.Form.Get("text"), "\r\n", "\n"))
+	if text == "" {
+		s.quickReply(w, r, http.StatusBadRequest, brain{}, "text is required")
+		return
+	}
+	project := strings.TrimSpace(r.Form.Get("project"))
+	if project == "" {
+		project = captureProject()
+	}
+	title := strings.TrimSpace(r.Form.Get("title"))
+	if title == "" {
+		title = firstLine(text)
+	}
+	if runes := []rune(title); len(runes) > maxTitleLength {
+		title = string(runes[:maxTitleLength-1]) + "…"
+	}
+
+	b := brain{Title: title, Context: text, Project: project, Tags: strings.Join(splitTags(r.Form.Get("tags")), ",")}
+	if errs := validateBrain(b); len(errs) > 0 {
+		if wantsJSON(r) {
+			writeValidationError(w, r, errs)
+			return
+		}
+		s.quickReply(w, r, http.StatusBadRequest, brain{}, errs[0].Field+" "+errs[0].Message)
+		return
+	}
+	created, err := s.insertBrain(r.Context(), b)
+	if err != nil {
+		s.quickReply(w, r, http.StatusInternalServerError, brain{}, err.Error())
+		return
+	}
+	s.quickReply(w, r, http.StatusCreated, created, "")
+}
+
+// quickReply answers /quick with the created record or an error message,
+// as JSON or the confirmation page.
+func (s *Server) quickReply(w http.ResponseWriter, r *http.Request, status int, b brain, message string) {
+	if wantsJSON(r) {
+		if message != "" {
+			writeError(w, r, status, message)
+			return
+		}
+		writeJSONStatus(w, status, b)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	_ = quickTemplate.Execute(w, struct {
+		ID      int64
+		Title   string
+		Project string
+		Error   string
+	}{b.ID, b.Title, b.Project, message})
+}
+
+// wantsJSON reports whether the client prefers JSON to HTML.
+func wantsJSON(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "application/json") && !strings.Contains(accept, "text/html")
+}
+
+// quickCaptureResponses documents the answers of GET and POST /quick in the
+// OpenAPI spec.
+func quickCaptureResponses() map[string]any {
+	return map[string]any{
+		"201": map[string]any{
+			"description": "Created brain record",
+			"content": map[string]any{
+				"text/html":        map[string]any{"schema": map[string]any{"type": "string"}},
+				"application/json": map[string]any{"schema": map[string]any{"$ref": "#/components/schemas/Brain"}},
+			},
+		},
+		"400": map[string]any{"description": "No text, or an invalid field"},
+	}
+}
@@ -0,0 +1,481 @@
+package sbrain
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"sbrain/store"
+)
+
+// maxReadingImportBytes bounds the size of an uploaded Readwise or Pocket
+// export.
+const maxReadingImportBytes = 64 << 20
+
+// readingItem is one book, article or saved page from a read-later export,
+// before it becomes a brain record.
+type readingItem struct {
+	title   string
+	source  string
+	text    string
+	tags    []string
+	created time.Time
+}
+
+// importReadwise serves POST /import/readwise. It accepts the Readwise CSV
+// export or the JSON of the export API and creates a record per book or
+// article holding all of its highlights, tagged "readwise".
+func (s *Server) importReadwise(w http.ResponseWriter, r *http.Request) {
+	s.importReading(w, r, "readwise", parseReadwiseExport)
+}
+
+// importPocket serves POST /import/pocket. It accepts Pocket's HTML export
+// (ril_export.html) or its CSV export, zipped or not, and creates a record
+// per saved page, tagged "pocket".
+func (s *Server) importPocket(w http.ResponseWriter, r *http.Request) {
+	s.importReading(w, r, "pocket", parsePocketExport)
+}
+
+// importReading creates a record for every item parse finds in the upload,
+// in ?project (default the capture project) and tagged with tag and ?tags.
+// Items whose source URL is already the source of a record are skipped, as
+// are items without a URL whose title matches a record with the same tag,
+// so an export can be imported again as it grows.
+func (s *Server) importReading(w http.ResponseWriter, r *http.Request, tag string, parse func([]byte) ([]readingItem, error)) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxReadingImportBytes)
+	data, err := readUpload(r, "file")
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	items, err := parse(data)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	q := r.URL.Query()
+	result := importResult{Created: []int64{}, Skipped: []string{}, Errors: []string{}}
+	for _, item := range items {
+		name := firstNonEmpty(item.source, item.title)
+		tags, seen := []string{tag}, map[string]bool{tag: true}
+		for _, t := range append(splitTags(q.Get("tags")), item.tags...) {
+			if t = importTag(t); t != "" && !seen[t] && len(tags) < maxTagCount {
+				seen[t] = true
+				tags = append(tags, t)
+			}
+		}
+		b := sourcedBrain(item.title, item.source, item.text, q.Get("project"), tags)
+		if errs := validateBrain(b); len(errs) > 0 {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %s", name, errs[0].Message))
+			continue
+		}
+
+		var exists bool
+		if item.source != "" {
+			err = s.db.QueryRowContext(r.Context(), `SELECT EXISTS (SELECT 1 FROM second_brain WHERE context = ? OR substr(context, 1, ?) = ?)`,
+				"Source: "+item.source, len("Source: "+item.source+"\n"), "Source: "+item.source+"\n").Scan(&exists)
+		} else {
+			err = s.db.QueryRowContext(r.Context(), `SELECT EXISTS (SELECT 1 FROM second_brain WHERE title = ? AND ',' || tags || ',' LIKE ?)`,
+				b.Title, "%,"+tag+",%").Scan(&exists)
+		}
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("check duplicate: %v", err))
+			return
+		}
+		if exists {
+			result.Skipped = append(result.Skipped, name)
+			continue
+		}
+
+		now := time.Now()
+		if item.created.IsZero() || item.created.After(now) {
+			item.created = now
+		}
+		b.CreatedAt, b.UpdatedAt = store.NewTimestamp(item.created), store.NewTimestamp(now)
+		res, err := s.db.ExecContext(r.Context(), `INSERT INTO second_brain (created_at, updated_at, title, context, project, commits, tags)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`, b.CreatedAt, b.UpdatedAt, b.Title, b.Context, b.Project, b.Commits, b.Tags)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("insert brain: %v", err))
+			return
+		}
+		id, _ := res.LastInsertId()
+		b.ID = id
+		s.recordAudit(r.Context(), auditCreate, "brain", id, nil, b)
+		result.Created = append(result.Created, id)
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// importTag turns a tag from another service into a valid brain tag:
+// lowercased, spaces as dashes and other punctuation dropped.
+func importTag(tag string) string {
+	var b strings.Builder
+	for _, c := range strings.ToLower(strings.TrimSpace(tag)) {
+		switch {
+		case c >= 'a' && c <= 'z', c >= '0' && c <= '9', c == '_', c == '/':
+			b.WriteRune(c)
+		case c == '-', c == ' ':
+			b.WriteByte('-')
+		}
+	}
+	out := strings.TrimLeft(b.String(), "_/-")
+	return out[:min(len(out), maxTagLength)]
+}
+
+// readwiseHighlight is one highlight, with the note added to it.
+type readwiseHighlight struct {
+	text    string
+	note    string
+	tags    []string
+	created time.Time
+}
+
+// parseReadwiseExport reads either export format, grouping highlights by
+// book.
+func parseReadwiseExport(data []byte) ([]readingItem, error) {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		return parseReadwiseJSON(trimmed)
+	}
+	return parseReadwiseCSV(data)
+}
+
+// parseReadwiseJSON reads the results of GET /api/v2/export, either as the
+// whole response or as the list of books.
+func parseReadwiseJSON(data []byte) ([]readingItem, error) {
+	type tagJSON struct {
+		Name string `json:"name"`
+	}
+	var books []struct {
+		Title         string    `json:"title"`
+		ReadableTitle string    `json:"readable_title"`
+		Author        string    `json:"author"`
+		SourceURL     string    `json:"source_url"`
+		UniqueURL     string    `json:"unique_url"`
+		BookTags      []tagJSON `json:"book_tags"`
+		DocumentNote  string    `json:"document_note"`
+		Highlights    []struct {
+			Text          string    `json:"text"`
+			Note          string    `json:"note"`
+			HighlightedAt string    `json:"highlighted_at"`
+			CreatedAt     string    `json:"created_at"`
+			Tags          []tagJSON `json:"tags"`
+			IsDiscard     bool      `json:"is_discard"`
+		} `json:"highlights"`
+	}
+	if data[0] == '{' {
+		var page struct {
+			Results json.RawMessage `json:"results"`
+		}
+		if err := json.Unmarshal(data, &page); err != nil {
+			return nil, fmt.Errorf("decode Readwise export: %v", err)
+		}
+		if page.Results == nil {
+			return nil, errors.New(`decode Readwise export: expected a "results" list of books`)
+		}
+		data = page.Results
+	}
+	if err := json.Unmarshal(data, &books); err != nil {
+		return nil, fmt.Errorf("decode Readwise export: %v", err)
+	}
+
+	items := make([]readingItem, 0, len(books))
+	for _, book := range books {
+		var tags []string
+		for _, t := range book.BookTags {
+			tags = append(tags, t.Name)
+		}
+		var highlights []readwiseHighlight
+		for _, h := range book.Highlights {
+			if h.IsDiscard {
+				continue
+			}
+			created, _ := parseTimestamp(firstNonEmpty(h.HighlightedAt, h.CreatedAt))
+			hl := readwiseHighlight{text: h.Text, note: h.Note, created: created}
+			for _, t := range h.Tags {
+				hl.tags = append(hl.tags, t.Name)
+			}
+			highlights = append(highlights, hl)
+		}
+		items = append(items, readwiseItem(firstNonEmpty(book.ReadableTitle, book.Title), book.Author,
+			firstNonEmpty(book.SourceURL, book.UniqueURL), book.DocumentNote, tags, highlights))
+	}
+	return items, nil
+}
+
+// parseReadwiseCSV reads the CSV export, whose columns include Highlight,
+// Book Title, Book Author, Note, Tags, Highlighted at and Document tags.
+func parseReadwiseCSV(data []byte) ([]readingItem, error) {
+	rows, col, err := readCSVExport(data)
+	if err != nil {
+		return nil, fmt.Errorf("read Readwise CSV: %v", err)
+	}
+	if _, ok := col["highlight"]; !ok {
+		return nil, errors.New(`read Readwise CSV: missing "Highlight" column`)
+	}
+
+	type book struct {
+		title, author, source string
+		tags                  []string
+		highlights            []readwiseHighlight
+	}
+	var order []string
+	books := map[string]*book{}
+	for _, row := range rows {
+		title, author := row.get(col, "book title"), row.get(col, "book author")
+		key := title + "\x00" + author
+		bk := books[key]
+		if bk == nil {
+			bk = &book{title: title, author: author, source: firstNonEmpty(row.get(col, "url"), row.get(col, "source url"))}
+			bk.tags = splitCSVTags(row.get(col, "document tags"))
+			books[key] = bk
+			order = append(order, key)
+		}
+		created, _ := readwiseCSVTime(row.get(col, "highlighted at"))
+		bk.highlights = append(bk.highlights, readwiseHighlight{
+			text:    row.get(col, "highlight"),
+			note:    row.get(col, "note"),
+			tags:    splitCSVTags(row.get(col, "tags")),
+			created: created,
+		})
+	}
+
+	items := make([]readingItem, 0, len(order))
+	for _, key := range order {
+		bk := books[key]
+		items = append(items, readwiseItem(bk.title, bk.author, bk.source, "", bk.tags, bk.highlights))
+	}
+	return items, nil
+}
+
+// readwiseCSVTime parses the CSV export's "2023-01-15 10:20:30.123456+00:00"
+// timestamps as well as the usual layouts.
+func readwiseCSVTime(value string) (time.Time, bool) {
+	if t, err := time.Parse("2006-01-02 15:04:05.999999-07:00", strings.TrimSpace(value)); err == nil {
+		return t.UTC(), true
+	}
+	return parseTimestamp(value)
+}
+
+// readwiseItem renders a book as the author, its note and its highlights
+// as quotes, each followed by its note. The record is dated by the first
+// highlight and carries the tags of the book and of every highlight.
+func readwiseItem(title, author, source, note string, tags []string, highlights []readwiseHighlight) readingItem {
+	item := readingItem{title: title, source: source, tags: tags}
+	var parts []string
+	if author = strings.TrimSpace(author); author != "" {
+		parts = append(parts, "By "+author)
+	}
+	if note = strings.TrimSpace(note); note != "" {
+		parts = append(parts, note)
+	}
+	for _, h := range highlights {
+		text := strings.TrimSpace(h.text)
+		if text == "" {
+			continue
+		}
+		quote := "> " + strings.ReplaceAll(text, "\n", "\n> ")
+		if n := strings.TrimSpace(h.note); n != "" {
+			quote += "\n\n" + n
+		}
+		parts = append(parts, quote)
+		item.tags = append(item.tags, h.tags...)
+		if !h.created.IsZero() && (item.created.IsZero() || h.created.Before(item.created)) {
+			item.created = h.created
+		}
+	}
+	item.text = strings.Join(parts, "\n\n")
+	return item
+}
+
+// parsePocketExport reads ril_export.html, a CSV export, or a zip of CSV
+// parts as Pocket now sends.
+func parsePocketExport(data []byte) ([]readingItem, error) {
+	if bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, fmt.Errorf("open zip: %v", err)
+		}
+		var items []readingItem
+		for _, f := range zr.File {
+			if f.FileInfo().IsDir() || !strings.EqualFold(path.Ext(f.Name), ".csv") || isHiddenPath(f.Name) {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", f.Name, err)
+			}
+			part, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", f.Name, err)
+			}
+			partItems, err := parsePocketCSV(part)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", f.Name, err)
+			}
+			items = append(items, partItems...)
+		}
+		return items, nil
+	}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '<' {
+		return parsePocketHTML(string(data)), nil
+	}
+	return parsePocketCSV(data)
+}
+
+// parsePocketHTML reads the links of ril_export.html, whose tags and
+// time_added attributes carry the saved page's tags and save time.
+func parsePocketHTML(doc string) []readingItem {
+	var items []readingItem
+	var current *readingItem
+	var title strings.Builder
+	for _, tok := range tokenizeHTML(doc) {
+		switch {
+		case tok.tag == "a" && !tok.end:
+			current = &readingItem{source: strings.TrimSpace(tok.attrs["href"]), tags: splitCSVTags(tok.attrs["tags"])}
+			if secs, err := strconv.ParseInt(tok.attrs["time_added"], 10, 64); err == nil {
+				current.created = time.Unix(secs, 0).UTC()
+			}
+			title.Reset()
+		case tok.tag == "a" && tok.end && current != nil:
+			current.title = cleanHTMLText(title.String())
+			if current.source != "" {
+				items = append(items, *current)
+			}
+			current = nil
+		case tok.tag == "" && current != nil:
+			title.WriteString(tok.text)
+		}
+	}
+	return items
+}
+
+// parsePocketCSV reads the CSV export: title, url, time_added, tags
+// (separated by |) and status.
+func parsePocketCSV(data []byte) ([]readingItem, error) {
+	rows, col, err := readCSVExport(data)
+	if err != nil {
+		return nil, fmt.Errorf("read Pocket CSV: %v", err)
+	}
+	if _, ok := col["url"]; !ok {
+		return nil, errors.New(`read Pocket CSV: missing "url" column`)
+	}
+	var items []readingItem
+	for _, row := range rows {
+		item := readingItem{title: row.get(col, "title"), source: strings.TrimSpace(row.get(col, "url"))}
+		if item.source == "" {
+			continue
+		}
+		for _, t := range strings.Split(row.get(col, "tags"), "|") {
+			if t = strings.TrimSpace(t); t != "" {
+				item.tags = append(item.tags, t)
+			}
+		}
+		if secs, err := strconv.ParseInt(row.get(col, "time_added"), 10, 64); err == nil {
+			item.created = time.Unix(secs, 0).UTC()
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// csvRow is a record of a CSV export, read by column name.
+type csvRow []string
+
+func (r csvRow) get(col map[string]int, name string) string {
+	if i, ok := col[name]; ok && i < len(r) {
+		return r[i]
+	}
+	return ""
+}
+
+// readCSVExport reads a CSV file with a header row, returning the rows
+// after it and the index of each lowercased column name.
+func readCSVExport(data []byte) ([]csvRow, map[string]int, error) {
+	cr := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\ufeff"))))
+	cr.FieldsPerRecord = -1
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil, errors.New("file is empty")
+	}
+	col := map[string]int{}
+	for i, name := range records[0] {
+		col[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	rows := make([]csvRow, 0, len(records)-1)
+	for _, rec := range records[1:] {
+		rows = append(rows, rec)
+	}
+	return rows, col, nil
+}
+
+// splitCSVTags splits a comma-separated tag list, as both exports write
+// it inside one field.
+func splitCSVTags(value string) []string {
+	var tags []string
+	for _, t := range strings.Split(value, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// readingImportOperation documents POST /import/readwise and
+// /import/pocket, which differ only in the formats they accept.
+func readingImportOperation(summary, description, operationID string, types ...string) map[string]any {
+	content := map[string]any{
+		"multipart/form-data": map[string]any{
+			"schema": map[string]any{
+				"type":       "object",
+				"properties": map[string]any{"file": map[string]any{"type": "string", "format": "binary"}},
+			},
+		},
+	}
+	for _, t := range types {
+		content[t] = map[string]any{"schema": map[string]any{"type": "string"}}
+	}
+	return map[string]any{
+		"summary":     summary,
+		"description": description,
+		"operationId": operationID,
+		"parameters": []map[string]any{
+			{"name": "project", "in": "query", "description": "Defaults to SBRAIN_CAPTURE_PROJECT or inbox", "schema": map[string]any{"type": "string"}},
+			{"name": "tags", "in": "query", "description": "Comma-separated tags added to every record", "schema": map[string]any{"type": "string"}},
+		},
+		"requestBody": map[string]any{"required": true, "content": content},
+		"responses": map[string]any{
+			"200": map[string]any{
+				"description": "Import summary; skipped lists the sources already in the brain",
+				"content": map[string]any{
+					"application/json": map[string]any{
+						"schema": map[string]any{
+							"type": "object",
+							"properties": map[string]any{
+								"created": map[string]any{"type": "array", "items": map[string]any{"type": "integer", "format": "int64"}},
+								"skipped": map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+								"errors":  map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+							},
+						},
+					},
+				},
+			},
+			"400": map[string]any{"description": "Unreadable export"},
+			"500": map[string]any{"description": "Server error"},
+		},
+	}
+}
@@ -0,0 +1,162 @@
+package sbrain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+// handlerPanic is a recovered panic with the stack of the goroutine that
+// panicked, captured where it was recovered so it survives being re-panicked
+// on another goroutine, as requestTimeout does.
+type handlerPanic struct {
+	value  any
+	stack  []byte
+	frames []runtime.Frame
+}
+
+// capturePanic records p with the current stack. It must be called from the
+// deferred function that recovered p.
+func capturePanic(p any) *handlerPanic {
+	if hp, ok := p.(*handlerPanic); ok {
+		return hp
+	}
+	hp := &handlerPanic{value: p, stack: debug.Stack()}
+	pcs := make([]uintptr, 64)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(1, pcs)])
+	// Frames up to runtime.gopanic are the deferred function's own.
+	sawPanic := false
+	for {
+		f, more := frames.Next()
+		if sawPanic {
+			hp.frames = append(hp.frames, f)
+		} else if f.Function == "runtime.gopanic" {
+			sawPanic = true
+		}
+		if !more {
+			break
+		}
+	}
+	return hp
+}
+
+// recoverPanics turns a panicking handler into a 500 APIError instead of a
+// dropped connection, and stores the panic with its stack in the logs
+// table, and in Sentry when SBRAIN_SENTRY_DSN is set, so it can be found
+// later. A panic after the response has started can only end it early.
+func (s *Server) recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &recoveryWriter{ResponseWriter: w}
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				panic(p)
+			}
+			s.reportPanic(r, capturePanic(p))
+			if rw.wroteHeader {
+				panic(http.ErrAbortHandler)
+			}
+			writeError(w, r, http.StatusInternalServerError, "internal server error")
+		}()
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// reportPanic logs a recovered panic, stores it as an error log and sends it
+// to Sentry when that is configured.
+func (s *Server) reportPanic(r *http.Request, hp *handlerPanic) {
+	message := fmt.Sprintf("panic: %v", hp.value)
+	requestID := requestIDFromContext(r.Context())
+	log.Printf("%s %s: %s [request %s]\n%s", r.Method, r.URL.Path, message, requestID, hp.stack)
+
+	metadata, _ := json.Marshal(map[string]string{"panic": fmt.Sprint(hp.value), "stack": string(hp.stack)})
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	status := http.StatusInternalServerError
+	if _, err := s.insertLog(context.Background(), logEntry{
+		Level:      "error",
+		Message:    message,
+		Endpoint:   r.URL.Path,
+		Method:     r.Method,
+		IP:         ip,
+		UserAgent:  r.UserAgent(),
+		RequestID:  requestID,
+		StatusCode: &status,
+		Metadata:   string(metadata),
+		Service:    internalLogService,
+	}); err != nil {
+		log.Printf("warning: could not store panic log: %v", err)
+	}
+
+	if s.sentry == nil {
+		return
+	}
+	event := newSentryEvent("fatal", "")
+	event.Exception = &sentryExceptions{Values: []sentryException{{
+		Type:       fmt.Sprintf("%T", hp.value),
+		Value:      fmt.Sprint(hp.value),
+		Stacktrace: sentryStack(hp.frames),
+	}}}
+	event.Request = &sentryRequest{URL: r.URL.String(), Method: r.Method, Headers: map[string]string{"User-Agent": r.UserAgent()}}
+	event.Tags = map[string]string{"request_id": requestID}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+		defer cancel()
+		if err := s.sentry.send(ctx, event); err != nil {
+			log.Printf("warning: %v", err)
+		}
+	}()
+}
+
+// sentryStack converts frames, newest first, to a Sentry stack trace.
+func sentryStack(frames []runtime.Frame) *sentryStacktrace {
+	st := &sentryStacktrace{Frames: []sentryFrame{}}
+	for i := len(frames) - 1; i >= 0; i-- {
+		f := frames[i]
+		st.Frames = append(st.Frames, sentryFrame{
+			Function: f.Function,
+			Filename: f.File,
+			Lineno:   f.Line,
+			InApp:    strings.HasPrefix(f.Function, "sbrain/") || strings.HasPrefix(f.Function, "main."),
+		})
+	}
+	return st
+}
+
+// recoveryWriter notes whether the response has started, after which a
+// panic can no longer be answered with a 500.
+type recoveryWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (rw *recoveryWriter) WriteHeader(status int) {
+	rw.wroteHeader = true
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *recoveryWriter) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	return rw.ResponseWriter.Write(b)
+}
+
+func (rw *recoveryWriter) Unwrap() http.ResponseWriter { return rw.ResponseWriter }
+
+func (rw *recoveryWriter) Flush() {
+	rw.wroteHeader = true
+	if f, ok := rw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
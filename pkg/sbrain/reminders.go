@@ -0,0 +1,185 @@
+package sbrain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"sbrain/store"
+)
+
+// reminder is a brain whose remind_at has passed (or falls before the
+// requested bound). Status is "overdue" when remind_at is before today in the
+// display zone, "due" when it is earlier today and "upcoming" when it is
+// still ahead.
+type reminder struct {
+	brain
+	Status string `json:"status"`
+}
+
+// listReminders serves GET /reminders. until (default now) bounds remind_at,
+// so a future until also lists what is coming up.
+func (s *Server) listReminders(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	until := now
+	if raw := r.URL.Query().Get("until"); raw != "" {
+		t, ok := parseTimestamp(raw)
+		if !ok {
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("invalid until %q: expected RFC 3339 or YYYY-MM-DD", raw))
+			return
+		}
+		until = t
+	}
+
+	rows, err := s.db.QueryContext(r.Context(), `SELECT `+store.BrainColumns+` FROM second_brain
+		WHERE remind_at != '' AND remind_at <= ? ORDER BY remind_at ASC, id ASC`, store.NewTimestamp(until))
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("query reminders: %v", err))
+		return
+	}
+	defer rows.Close()
+
+	local := now.In(store.DisplayLocation())
+	today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location())
+	items := []reminder{}
+	for rows.Next() {
+		var item reminder
+		if err := rows.Scan(item.Fields()...); err != nil {
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("scan reminder: %v", err))
+			return
+		}
+		remindAt, _ := item.RemindAt.Time()
+		switch {
+		case remindAt.Before(today):
+			item.Status = "overdue"
+		case !remindAt.After(now):
+			item.Status = "due"
+		default:
+			item.Status = "upcoming"
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("iterate reminders: %v", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+// clearReminder serves DELETE /reminders/{id}, marking a follow-up as done by
+// clearing the record's remind_at.
+func (s *Server) clearReminder(w http.ResponseWriter, r *http.Request, id int64) {
+	before, err := s.brains.GetBrain(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, r, http.StatusNotFound, "not found")
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if before.RemindAt == "" {
+		writeError(w, r, http.StatusNotFound, "no reminder set")
+		return
+	}
+
+	after := before
+	after.RemindAt = ""
+	after.UpdatedAt = store.NewTimestamp(time.Now())
+	if after, err = s.brains.UpdateBrain(r.Context(), after); err != nil {
+		s.writeBrainUpdateError(w, r, id, err)
+		return
+	}
+	s.recordAudit(r.Context(), auditUpdate, "brain", id, before, after)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// reminderTargets returns the destinations due reminders are sent to:
+// SBRAIN_REMINDER_WEBHOOK (a JSON POST) and SBRAIN_REMINDER_EMAIL (using the
+// SBRAIN_SMTP_* settings).
+func reminderTargets() (webhook string, email string) {
+	return os.Getenv("SBRAIN_REMINDER_WEBHOOK"), os.Getenv("SBRAIN_REMINDER_EMAIL")
+}
+
+// runReminderNotifier checks once a minute for reminders that came due and
+// have not been delivered yet.
+func (s *Server) runReminderNotifier(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.sendDueReminders(ctx, now.UTC())
+		}
+	}
+}
+
+func (s *Server) sendDueReminders(ctx context.Context, now time.Time) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+store.BrainColumns+` FROM second_brain
+		WHERE remind_at != '' AND remind_at <= ? AND reminded_at = '' ORDER BY remind_at ASC, id ASC`, store.NewTimestamp(now))
+	if err != nil {
+		log.Printf("reminder notifier: query due reminders: %v", err)
+		return
+	}
+	var due []brain
+	for rows.Next() {
+		var b brain
+		if err := rows.Scan(b.Fields()...); err != nil {
+			rows.Close()
+			log.Printf("reminder notifier: scan reminder: %v", err)
+			return
+		}
+		due = append(due, b)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		log.Printf("reminder notifier: iterate reminders: %v", err)
+		return
+	}
+
+	for _, b := range due {
+		if err := s.deliverReminder(b); err != nil {
+			// Left undelivered, so the next tick tries again.
+			log.Printf("reminder notifier: brain %d: %v", b.ID, err)
+			continue
+		}
+		// Matching remind_at keeps a reminder rescheduled meanwhile armed.
+		if _, err := s.db.ExecContext(ctx, `UPDATE second_brain SET reminded_at = ? WHERE id = ? AND remind_at = ?`,
+			store.NewTimestamp(now), b.ID, b.RemindAt); err != nil {
+			log.Printf("reminder notifier: mark brain %d reminded: %v", b.ID, err)
+		}
+	}
+}
+
+// deliverReminder sends b to the reminder targets. While the webhooks flag
+// is off the webhook is skipped, and a reminder with no other target stays
+// undelivered until the flag is back on.
+func (s *Server) deliverReminder(b brain) error {
+	text := fmt.Sprintf("sbrain reminder: %q (brain %d, project %s) was due %s", b.Title, b.ID, b.Project, b.RemindAt.Display())
+
+	webhook, email := reminderTargets()
+	if webhook != "" && !s.features.enabled(featureWebhooks) {
+		if email == "" {
+			return errWebhooksOff
+		}
+		webhook = ""
+	}
+	if webhook != "" {
+		if err := postJSONWebhook(webhook, map[string]any{"brain": b, "text": text}); err != nil {
+			return err
+		}
+	}
+	if email != "" {
+		if err := sendDigestEmail(email, "sbrain reminder: "+b.Title, text+"\n\n"+b.Context); err != nil {
+			return fmt.Errorf("send email: %w", err)
+		}
+	}
+	return nil
+}
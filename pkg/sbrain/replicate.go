@@ -0,0 +1,420 @@
+package sbrain
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	sqlite3 "github.com/mattn/go-sqlite3"
+)
+
+// replicatedDriverName is a sqlite3 driver whose connections run in WAL mode
+// with automatic checkpoints disabled, so the replicator decides when WAL
+// frames are folded back into the database file.
+const replicatedDriverName = "sqlite3_replicated"
+
+const (
+	walHeaderSize      = 32
+	walFrameHeaderSize = 24
+
+	// defaultReplicaCheckpointBytes is how large the WAL may grow before the
+	// replicator checkpoints it and starts a new WAL segment.
+	defaultReplicaCheckpointBytes = 4 << 20
+)
+
+func init() {
+	sql.Register(replicatedDriverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			_, err := conn.Exec("PRAGMA journal_mode = WAL; PRAGMA wal_autocheckpoint = 0;", nil)
+			return err
+		},
+	})
+}
+
+// replicator continuously copies committed WAL frames into a replica
+// directory laid out as:
+//
+//	<dir>/generations/<generation>/snapshot.db
+//	<dir>/generations/<generation>/wal/00000000.wal
+//	<dir>/generations/<generation>/wal/00000001.wal
+//	...
+//
+// A generation starts with a byte-for-byte copy of the database file taken
+// right after a checkpoint. Each WAL segment holds the frames written between
+// two checkpoints. If continuity is ever lost (for example another process
+// checkpointed frames that were not yet copied) a new generation is started.
+type replicator struct {
+	db              *sql.DB
+	dbPath          string
+	dir             string
+	interval        time.Duration
+	checkpointBytes int64
+
+	generation string
+	index      int
+	offset     int64
+	salt       []byte
+	doneSalt   []byte
+	bigEndian  bool
+	sum        [2]uint32
+}
+
+func newReplicator(db *sql.DB, dbPath string, dir string) (*replicator, error) {
+	interval := time.Second
+	if raw := os.Getenv("SBRAIN_REPLICA_INTERVAL"); raw != "" {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid SBRAIN_REPLICA_INTERVAL %q", raw)
+		}
+		interval = d
+	}
+
+	return &replicator{
+		db:              db,
+		dbPath:          dbPath,
+		dir:             dir,
+		interval:        interval,
+		checkpointBytes: defaultReplicaCheckpointBytes,
+	}, nil
+}
+
+func (r *replicator) run(ctx context.Context) {
+	log.Printf("replicating %q to %q every %s", r.dbPath, r.dir, r.interval)
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.sync(); err != nil {
+			log.Printf("replicate: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *replicator) sync() error {
+	if r.generation == "" {
+		return r.startGeneration()
+	}
+	if err := r.copyFrames(); err != nil {
+		return err
+	}
+	if r.salt != nil && r.offset-walHeaderSize >= r.checkpointBytes {
+		return r.checkpoint()
+	}
+	return nil
+}
+
+// startGeneration checkpoints the WAL into the database file and snapshots
+// the file. With automatic checkpoints disabled the file does not change
+// again until the replicator's next checkpoint, so a plain copy is
+// consistent.
+func (r *replicator) startGeneration() error {
+	var busy, logFrames, checkpointed int
+	if err := r.db.QueryRow(`PRAGMA wal_checkpoint(RESTART)`).Scan(&busy, &logFrames, &checkpointed); err != nil {
+		return fmt.Errorf("checkpoint before snapshot: %w", err)
+	}
+	if busy != 0 {
+		return errors.New("checkpoint before snapshot: database busy, will retry")
+	}
+
+	generation := time.Now().UTC().Format("20060102T150405.000000000Z")
+	genDir := filepath.Join(r.dir, "generations", generation)
+	if err := os.MkdirAll(filepath.Join(genDir, "wal"), 0o755); err != nil {
+		return fmt.Errorf("create generation: %w", err)
+	}
+	if err := copyFile(r.dbPath, filepath.Join(genDir, "snapshot.db")); err != nil {
+		return fmt.Errorf("snapshot database: %w", err)
+	}
+
+	header, _ := readWALHeader(r.dbPath + "-wal")
+	r.generation = generation
+	r.index = 0
+	r.offset = 0
+	r.salt = nil
+	r.doneSalt = nil
+	if header != nil {
+		r.doneSalt = header[16:24]
+	}
+	log.Printf("replicate: started generation %s", generation)
+	return nil
+}
+
+// copyFrames appends every newly committed frame of the current WAL to the
+// current segment. Frames are validated with the WAL checksum chain and only
+// whole transactions (up to the last commit frame) are copied, so a frame
+// torn by a concurrent writer is never shipped.
+func (r *replicator) copyFrames() error {
+	data, err := os.ReadFile(r.dbPath + "-wal")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("read wal: %w", err)
+	}
+	if len(data) < walHeaderSize {
+		return nil
+	}
+
+	header := data[:walHeaderSize]
+	salt := header[16:24]
+	if bytes.Equal(salt, r.doneSalt) {
+		return nil
+	}
+	if r.salt != nil && !bytes.Equal(salt, r.salt) {
+		log.Printf("replicate: wal restarted outside the replicator; starting a new generation")
+		r.generation = ""
+		return r.startGeneration()
+	}
+
+	if r.salt == nil {
+		magic := binary.BigEndian.Uint32(header[0:4])
+		if magic != 0x377f0682 && magic != 0x377f0683 {
+			return fmt.Errorf("read wal: bad magic %#x", magic)
+		}
+		r.bigEndian = magic == 0x377f0683
+		r.sum = walChecksum(r.bigEndian, header[:24], [2]uint32{})
+		if r.sum[0] != binary.BigEndian.Uint32(header[24:28]) || r.sum[1] != binary.BigEndian.Uint32(header[28:32]) {
+			// The header is still being written.
+			return nil
+		}
+		r.salt = append([]byte(nil), salt...)
+		r.offset = 0
+	}
+
+	pageSize := int64(binary.BigEndian.Uint32(header[8:12]))
+	frameSize := walFrameHeaderSize + pageSize
+	start := r.offset
+	if start == 0 {
+		start = walHeaderSize
+	}
+
+	sum := r.sum
+	commitEnd, commitSum := int64(-1), sum
+	for pos := start; pos+frameSize <= int64(len(data)); pos += frameSize {
+		frame := data[pos : pos+frameSize]
+		if !bytes.Equal(frame[8:16], salt) {
+			break
+		}
+		sum = walChecksum(r.bigEndian, frame[:8], sum)
+		sum = walChecksum(r.bigEndian, frame[walFrameHeaderSize:], sum)
+		if sum[0] != binary.BigEndian.Uint32(frame[16:20]) || sum[1] != binary.BigEndian.Uint32(frame[20:24]) {
+			break
+		}
+		if binary.BigEndian.Uint32(frame[4:8]) != 0 {
+			commitEnd, commitSum = pos+frameSize, sum
+		}
+	}
+	if commitEnd < 0 {
+		return nil
+	}
+
+	segment := filepath.Join(r.dir, "generations", r.generation, "wal", fmt.Sprintf("%08d.wal", r.index))
+	f, err := os.OpenFile(segment, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("open wal segment: %w", err)
+	}
+	if _, err := f.Write(data[r.offset:commitEnd]); err != nil {
+		f.Close()
+		return fmt.Errorf("write wal segment: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("sync wal segment: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close wal segment: %w", err)
+	}
+
+	r.offset = commitEnd
+	r.sum = commitSum
+	return nil
+}
+
+// checkpoint folds the WAL into the database file and moves on to the next
+// segment. SQLite reports how many frames the WAL held; if that is more than
+// were copied, frames slipped in after the last copy and the replica can no
+// longer be replayed, so a new generation is started.
+func (r *replicator) checkpoint() error {
+	if err := r.copyFrames(); err != nil {
+		return err
+	}
+
+	var busy, logFrames, checkpointed int
+	if err := r.db.QueryRow(`PRAGMA wal_checkpoint(RESTART)`).Scan(&busy, &logFrames, &checkpointed); err != nil {
+		return fmt.Errorf("checkpoint: %w", err)
+	}
+	if busy != 0 {
+		return nil
+	}
+
+	header, err := readWALHeader(r.dbPath + "-wal")
+	if err != nil {
+		return fmt.Errorf("checkpoint: %w", err)
+	}
+	pageSize := int64(binary.BigEndian.Uint32(header[8:12]))
+	copied := (r.offset - walHeaderSize) / (walFrameHeaderSize + pageSize)
+	if int64(logFrames) != copied {
+		log.Printf("replicate: %d wal frames checkpointed but %d copied; starting a new generation", logFrames, copied)
+		r.generation = ""
+		return r.startGeneration()
+	}
+
+	r.doneSalt = r.salt
+	r.salt = nil
+	r.offset = 0
+	r.index++
+	return nil
+}
+
+// walChecksum continues the SQLite WAL checksum over data.
+func walChecksum(bigEndian bool, data []byte, sum [2]uint32) [2]uint32 {
+	order := binary.ByteOrder(binary.LittleEndian)
+	if bigEndian {
+		order = binary.BigEndian
+	}
+	s0, s1 := sum[0], sum[1]
+	for i := 0; i+8 <= len(data); i += 8 {
+		s0 += order.Uint32(data[i:]) + s1
+		s1 += order.Uint32(data[i+4:]) + s0
+	}
+	return [2]uint32{s0, s1}
+}
+
+func readWALHeader(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	header := make([]byte, walHeaderSize)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := dst + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
+
+// RestoreReplica rebuilds a database file at output from the latest
+// generation in a replica directory written under SBRAIN_REPLICA_DIR: the snapshot is copied and each WAL
+// segment is replayed in order by letting SQLite checkpoint it.
+func RestoreReplica(from string, output string) error {
+	entries, err := os.ReadDir(filepath.Join(from, "generations"))
+	if err != nil {
+		return fmt.Errorf("list generations: %w", err)
+	}
+	var generations []string
+	for _, e := range entries {
+		if e.IsDir() {
+			generations = append(generations, e.Name())
+		}
+	}
+	if len(generations) == 0 {
+		return fmt.Errorf("no generations found in %q", from)
+	}
+	sort.Strings(generations)
+	genDir := filepath.Join(from, "generations", generations[len(generations)-1])
+
+	tmp := output + ".restoring"
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		os.Remove(tmp + suffix)
+	}
+	if err := copyFile(filepath.Join(genDir, "snapshot.db"), tmp); err != nil {
+		return fmt.Errorf("copy snapshot: %w", err)
+	}
+
+	segments, err := filepath.Glob(filepath.Join(genDir, "wal", "*.wal"))
+	if err != nil {
+		return fmt.Errorf("list wal segments: %w", err)
+	}
+	sort.Strings(segments)
+	for _, segment := range segments {
+		if err := copyFile(segment, tmp+"-wal"); err != nil {
+			return fmt.Errorf("stage %s: %w", filepath.Base(segment), err)
+		}
+		if err := checkpointFile(tmp); err != nil {
+			return fmt.Errorf("replay %s: %w", filepath.Base(segment), err)
+		}
+	}
+
+	db, err := sql.Open("sqlite3", tmp)
+	if err != nil {
+		return err
+	}
+	var result string
+	err = db.QueryRow(`PRAGMA integrity_check`).Scan(&result)
+	db.Close()
+	if err != nil {
+		return fmt.Errorf("integrity check: %w", err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("integrity check failed: %s", result)
+	}
+
+	// A leftover WAL next to the output would be replayed on top of the
+	// restored file, so it has to go too.
+	for _, suffix := range []string{"-wal", "-shm"} {
+		os.Remove(tmp + suffix)
+		os.Remove(output + suffix)
+	}
+	if err := os.Rename(tmp, output); err != nil {
+		return err
+	}
+	log.Printf("restored generation %s (%d wal segments) to %q", generations[len(generations)-1], len(segments), output)
+	return nil
+}
+
+func checkpointFile(path string) error {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var busy, logFrames, checkpointed int
+	if err := db.QueryRow(`PRAGMA wal_checkpoint(TRUNCATE)`).Scan(&busy, &logFrames, &checkpointed); err != nil {
+		return err
+	}
+	if busy != 0 {
+		return errors.New("database busy")
+	}
+	return nil
+}
@@ -0,0 +1,271 @@
+package sbrain
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// route is one entry in the route registry: a ServeMux pattern with its
+// method, such as "GET /brain/{id}", and the handler serving it.
+type route struct {
+	pattern string
+	handler http.HandlerFunc
+}
+
+// routes is the registry every endpoint is registered from. HEAD and OPTIONS
+// handlers are derived from it by newRouter, so adding a route here is all it
+// takes for both to stay accurate.
+func (s *Server) routes() []route {
+	return []route{
+		{"GET /{$}", s.rootHandler},
+		{"GET /openapi", s.openAPISpecHandler},
+		{"GET /readyz", s.readyzHandler},
+		{"GET /healthz", s.healthzHandler},
+		{"GET /metrics", s.metricsHandler},
+		{"GET /docs", s.featureGated(featureUI, s.docsHandler)},
+		{"GET /favicon.ico", faviconICOAsset.ServeHTTP},
+		{"GET /favicon.svg", faviconSVGAsset.ServeHTTP},
+		{"GET /brain", s.getBrains},
+		{"POST /brain", s.createBrain},
+		{"PATCH /brain", s.batchUpdateBrains},
+		{"GET /brain/{id}", withID(s.getBrainByID)},
+		{"PUT /brain/{id}", withID(s.updateBrain)},
+		{"DELETE /brain/{id}", withID(s.deleteBrain)},
+		{"GET /brain/stats", s.brainStatsHandler},
+		{"GET /brain/calendar", s.brainCalendarHandler},
+		{"GET /brain/on", s.brainsOnDayHandler},
+		{"GET /brain/onthisday", s.onThisDayHandler},
+		{"GET /brain/random", s.randomBrainHandler},
+		{"POST /brain/suggest-tags", s.suggestTagsHandler},
+		{"PUT /brain/{id}/pin", withID(s.brainFlagHandler(brainPinned, true))},
+		{"DELETE /brain/{id}/pin", withID(s.brainFlagHandler(brainPinned, false))},
+		{"PUT /brain/{id}/favorite", withID(s.brainFlagHandler(brainFavorite, true))},
+		{"DELETE /brain/{id}/favorite", withID(s.brainFlagHandler(brainFavorite, false))},
+		{"PUT /brain/{id}/archive", withID(s.brainFlagHandler(brainArchived, true))},
+		{"DELETE /brain/{id}/archive", withID(s.brainFlagHandler(brainArchived, false))},
+		{"POST /brain/{id}/summarize", s.featureGated(featureLLM, withID(s.summarizeBrain))},
+		{"GET /brain/{id}/pdf", withID(s.brainPDF)},
+		{"POST /brain/{id}/send", withID(s.sendBrain)},
+		{"POST /brain/{id}/share", withID(s.createBrainShare)},
+		{"GET /brain/{id}/shares", withID(s.listBrainShares)},
+		{"GET /brain/{id}/logs", withID(s.brainLogs)},
+		{"POST /brain/{id}/logs", withID(s.linkBrainLogs)},
+		{"DELETE /brain/{id}/logs/{log_id}", withID(s.unlinkBrainLog)},
+		{"GET /brain/{id}/issues", withID(s.listBrainIssues)},
+		{"POST /brain/{id}/issues", withID(s.linkBrainIssue)},
+		{"DELETE /brain/{id}/issues/{issue_id}", withID(s.unlinkBrainIssue)},
+		{"DELETE /shares/{id}", withID(s.revokeBrainShare)},
+		{"GET /s/{token}", s.featureGated(featureUI, s.sharedBrainHandler)},
+		{"GET /search", s.searchHandler},
+		{"POST /ask", s.featureGated(featureLLM, s.askHandler)},
+		{"POST /integrations/notion/export", s.notionExport},
+		{"POST /integrations/git/daily", s.gitDaily},
+		{"POST /integrations/ci", s.ciHandler},
+		{"POST /capture", s.capture},
+		{"GET /quick", s.quickCapture},
+		{"POST /quick", s.quickCapture},
+		{"POST /capture/url", s.captureURL},
+		{"GET /reminders", s.listReminders},
+		{"GET /calendar.ics", s.calendarHandler},
+		{"DELETE /reminders/{id}", withID(s.clearReminder)},
+		{"GET /schedules", s.listBrainSchedules},
+		{"POST /schedules", s.createBrainSchedule},
+		{"DELETE /schedules/{id}", withID(s.deleteBrainSchedule)},
+		{"POST /schedules/{id}/run", withID(s.runBrainSchedule)},
+		{"GET /templates", s.listTemplates},
+		{"POST /templates", s.createTemplate},
+		{"GET /templates/{name}", s.getTemplate},
+		{"DELETE /templates/{name}", s.deleteTemplate},
+		{"GET /logs", s.getLogs},
+		{"POST /logs", s.createLog},
+		{"POST /logs/batch", s.logBatchHandler},
+		{"GET /logs/{id}", withID(s.getLogByID)},
+		{"DELETE /logs/{id}", withID(s.deleteLog)},
+		{"POST /logs/purge", s.logPurgeHandler},
+		{"GET /logs/export", s.logExportHandler},
+		{"GET /logs/stats", s.logStatsHandler},
+		{"GET /logs/slow", s.slowLogsHandler},
+		{"POST /loki/api/v1/push", s.lokiPushHandler},
+		{"POST /v1/logs", s.otlpLogsHandler},
+		{"GET /digest", s.digestHandler},
+		{"GET /digest/weekly", s.weeklyDigestHandler},
+		{"GET /admin/digests/destinations", s.listDigestDestinations},
+		{"POST /admin/digests/destinations", s.createDigestDestination},
+		{"POST /admin/digests/test", s.testDigestHandler},
+		{"GET /admin/alerts/rules", s.listAlertRules},
+		{"POST /admin/alerts/rules", s.createAlertRule},
+		{"DELETE /admin/alerts/rules/{id}", withID(s.deleteAlertRule)},
+		{"GET /admin/scrub/rules", s.listScrubRules},
+		{"POST /admin/scrub/rules", s.createScrubRule},
+		{"DELETE /admin/scrub/rules/{id}", withID(s.deleteScrubRule)},
+		{"POST /admin/scrub/test", s.testScrubRule},
+		{"GET /admin/config", s.adminConfigHandler},
+		{"GET /admin/flags", s.listFeatureFlags},
+		{"PUT /admin/flags/{name}", s.setFeatureFlag},
+		{"DELETE /admin/flags/{name}", s.clearFeatureFlag},
+		{"GET /admin/maintenance", s.getMaintenance},
+		{"POST /admin/maintenance", s.startMaintenance},
+		{"DELETE /admin/maintenance", s.stopMaintenance},
+		{"POST /admin/db/vacuum", s.runDBOperation("vacuum", s.vacuumDatabase)},
+		{"POST /admin/db/integrity-check", s.runDBOperation("integrity check", s.integrityCheckDatabase)},
+		{"POST /admin/db/analyze", s.runDBOperation("analyze", s.analyzeDatabase)},
+		{"GET /admin/db/explain", s.explainHandler},
+		{"POST /admin/seed", s.featureGated(featureSeed, s.seedHandler)},
+		{"GET /heartbeats", s.listHeartbeats},
+		{"GET /heartbeats/{name}", s.getHeartbeat},
+		{"PUT /heartbeats/{name}", s.putHeartbeat},
+		{"POST /heartbeats/{name}", s.pingHeartbeat},
+		{"DELETE /heartbeats/{name}", s.deleteHeartbeat},
+		{"GET /monitors", s.listMonitors},
+		{"POST /monitors", s.createMonitor},
+		{"GET /monitors/{id}", withID(s.getMonitor)},
+		{"PUT /monitors/{id}", withID(s.updateMonitor)},
+		{"DELETE /monitors/{id}", withID(s.deleteMonitor)},
+		{"POST /monitors/{id}/check", withID(s.checkMonitorNow)},
+		{"GET /slos", s.listSLOs},
+		{"POST /slos", s.createSLO},
+		{"PUT /slos/{id}", withID(s.updateSLO)},
+		{"DELETE /slos/{id}", withID(s.deleteSLO)},
+		{"GET /slo/report", s.sloReportHandler},
+		{"GET /alerts", s.alertEventsHandler},
+		{"POST /alerts/{id}/ack", withID(s.ackAlertEvent)},
+		{"GET /grafana/{$}", s.grafanaTestHandler},
+		{"POST /grafana/search", s.grafanaSearchHandler},
+		{"POST /grafana/metrics", s.grafanaSearchHandler},
+		{"POST /grafana/query", s.grafanaQueryHandler},
+		{"POST /grafana/annotations", s.grafanaAnnotationsHandler},
+		{"POST /grafana/tag-keys", s.grafanaTagKeysHandler},
+		{"POST /grafana/tag-values", s.grafanaTagValuesHandler},
+		{"POST /integrations/slack/command", s.slackCommandHandler},
+		{"POST /integrations/email/{provider}", s.emailIngestHandler},
+		{"POST /integrations/git/webhook/{provider}", s.gitWebhookHandler},
+		{"GET /attachments", s.attachmentCollectionHandler},
+		{"GET /attachments/{id}", withID(s.getAttachment)},
+		{"GET /export/markdown", s.markdownExportHandler},
+		{"GET /export/pdf", s.pdfExportHandler},
+		{"GET /export/site", s.siteExportHandler},
+		{"GET /auth/login", s.loginHandler},
+		{"GET /auth/callback", s.callbackHandler},
+		{"/auth/logout", s.logoutHandler},
+		{"POST /auth/token", s.tokenExchangeHandler},
+		{"GET /whoami", s.whoamiHandler},
+		{"POST /import/markdown", s.markdownImportHandler},
+		{"POST /import/readwise", s.importReadwise},
+		{"POST /import/pocket", s.importPocket},
+		{"GET /audit", s.auditHandler},
+		{"GET /trash", s.trashCollectionHandler},
+		{"POST /trash/{id}/restore", withID(s.restoreBrain)},
+		{"GET /sync", s.syncHandler},
+	}
+}
+
+// versionedRoutes lists the routes that change in an API version, on top
+// of routes(). Each replaces the route with the same pattern from that
+// version on, adds one, or, with a nil handler, removes one, leaving older
+// versions as they were; breaking changes to an endpoint land here.
+func (s *Server) versionedRoutes() map[apiVersion][]route {
+	return map[apiVersion][]route{}
+}
+
+// methodOrder is the order methods are listed in Allow headers.
+var methodOrder = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+	http.MethodPatch, http.MethodDelete, http.MethodOptions,
+}
+
+// newRouter registers routes on a ServeMux. GET handlers also serve HEAD
+// (ServeMux routes HEAD to GET patterns), with the body counted rather than
+// sent, and every path gets an OPTIONS handler listing its methods. Patterns
+// without a method already accept every method and are registered as they
+// are.
+func newRouter(routes []route) *http.ServeMux {
+	mux := http.NewServeMux()
+	methods := map[string][]string{}
+	var paths []string
+	for _, rt := range routes {
+		method, path, ok := strings.Cut(rt.pattern, " ")
+		if !ok {
+			mux.HandleFunc(rt.pattern, rt.handler)
+			continue
+		}
+		if _, seen := methods[path]; !seen {
+			paths = append(paths, path)
+		}
+		methods[path] = append(methods[path], method)
+		if method == http.MethodGet {
+			methods[path] = append(methods[path], http.MethodHead)
+			mux.HandleFunc(rt.pattern, headHandler(rt.handler))
+			continue
+		}
+		mux.HandleFunc(rt.pattern, rt.handler)
+	}
+
+	for _, path := range paths {
+		allowed := append(methods[path], http.MethodOptions)
+		mux.HandleFunc(http.MethodOptions+" "+path, optionsHandler(allowed))
+	}
+	return mux
+}
+
+// optionsHandler answers OPTIONS with the methods a path supports.
+func optionsHandler(methods []string) http.HandlerFunc {
+	sorted := slices.Clone(methods)
+	slices.SortFunc(sorted, func(a, b string) int {
+		return slices.Index(methodOrder, a) - slices.Index(methodOrder, b)
+	})
+	allow := strings.Join(sorted, ", ")
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", allow)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// headHandler wraps a GET handler so that for HEAD requests the body is
+// discarded but counted, and Content-Length matches what GET would have sent.
+// net/http leaves Content-Length off HEAD responses it did not see a body for.
+func headHandler(get http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			get(w, r)
+			return
+		}
+		hw := &headResponseWriter{ResponseWriter: w}
+		get(hw, r)
+		hw.finish()
+	}
+}
+
+// headResponseWriter holds back the status line until the handler returns,
+// since Content-Length is only known once the whole body has been counted.
+type headResponseWriter struct {
+	http.ResponseWriter
+	status int
+	length int64
+}
+
+func (h *headResponseWriter) WriteHeader(status int) {
+	if h.status == 0 {
+		h.status = status
+	}
+}
+
+func (h *headResponseWriter) Write(b []byte) (int, error) {
+	if h.status == 0 {
+		h.status = http.StatusOK
+	}
+	h.length += int64(len(b))
+	return len(b), nil
+}
+
+func (h *headResponseWriter) finish() {
+	if h.status == 0 {
+		h.status = http.StatusOK
+	}
+	bodyAllowed := h.status >= http.StatusOK && h.status != http.StatusNoContent && h.status != http.StatusNotModified
+	if bodyAllowed && h.Header().Get("Content-Length") == "" {
+		h.Header().Set("Content-Length", strconv.FormatInt(h.length, 10))
+	}
+	h.ResponseWriter.WriteHeader(h.status)
+}
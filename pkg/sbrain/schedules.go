@@ -0,0 +1,283 @@
+package sbrain
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"sbrain/store"
+)
+
+// brainSchedule creates a brain record on a recurring schedule, such as a
+// weekly review every Monday morning. At and Weekday are read in the
+// display zone (SBRAIN_TZ).
+type brainSchedule struct {
+	ID          int64     `json:"id"`
+	CreatedAt   timestamp `json:"created_at"`
+	Name        string    `json:"name"`
+	Template    string    `json:"template"`
+	Title       string    `json:"title"`
+	Context     string    `json:"context"`
+	Project     string    `json:"project"`
+	Tags        string    `json:"tags"`
+	Frequency   string    `json:"frequency"`
+	Weekday     string    `json:"weekday"`
+	DayOfMonth  int       `json:"day_of_month"`
+	At          string    `json:"at"`
+	Enabled     bool      `json:"enabled"`
+	LastRunOn   string    `json:"last_run_on"`
+	LastBrainID *int64    `json:"last_brain_id,omitempty"`
+}
+
+const brainScheduleColumns = `id, created_at, name, template, title, context, project, tags, frequency, weekday,
+	day_of_month, at, enabled, last_run_on, last_brain_id`
+
+func scanBrainSchedule(row interface{ Scan(...any) error }) (brainSchedule, error) {
+	var sc brainSchedule
+	err := row.Scan(&sc.ID, &sc.CreatedAt, &sc.Name, &sc.Template, &sc.Title, &sc.Context, &sc.Project, &sc.Tags, &sc.Frequency,
+		&sc.Weekday, &sc.DayOfMonth, &sc.At, &sc.Enabled, &sc.LastRunOn, &sc.LastBrainID)
+	return sc, err
+}
+
+// dueOn reports whether the schedule should have run by local, a time in the
+// display zone, and has not run that day yet.
+func (sc brainSchedule) dueOn(local time.Time) bool {
+	if sc.LastRunOn == local.Format("2006-01-02") || local.Format("15:04") < sc.At {
+		return false
+	}
+	switch sc.Frequency {
+	case "daily":
+		return true
+	case "weekly":
+		return strings.EqualFold(local.Weekday().String(), sc.Weekday)
+	case "monthly":
+		return local.Day() == sc.DayOfMonth
+	}
+	return false
+}
+
+func (s *Server) loadBrainSchedules(ctx context.Context, enabledOnly bool) ([]brainSchedule, error) {
+	query := `SELECT ` + brainScheduleColumns + ` FROM brain_schedules`
+	if enabledOnly {
+		query += ` WHERE enabled = 1`
+	}
+	rows, err := s.db.QueryContext(ctx, query+` ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("query schedules: %w", err)
+	}
+	defer rows.Close()
+
+	items := []brainSchedule{}
+	for rows.Next() {
+		sc, err := scanBrainSchedule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan schedule: %w", err)
+		}
+		items = append(items, sc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate schedules: %w", err)
+	}
+	return items, nil
+}
+
+func (s *Server) listBrainSchedules(w http.ResponseWriter, r *http.Request) {
+	schedules, err := s.loadBrainSchedules(r.Context(), false)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, schedules)
+}
+
+func (s *Server) createBrainSchedule(w http.ResponseWriter, r *http.Request) {
+	req := brainSchedule{At: "08:00", Enabled: true}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("decode body: %v", err))
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	req.Template = strings.TrimSpace(req.Template)
+	req.Weekday = strings.ToLower(strings.TrimSpace(req.Weekday))
+
+	var v validator
+	if v.required("name", req.Name) {
+		v.maxLength("name", req.Name, maxTitleLength)
+	}
+	v.maxLength("title", req.Title, maxTitleLength)
+	v.maxLength("context", req.Context, maxContextLength)
+	if req.Template == "" {
+		v.required("title", req.Title)
+		v.required("context", req.Context)
+	}
+	if req.Template != "" {
+		t, err := s.loadTemplate(r.Context(), req.Template)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			v.add("template", "unknown template %q", req.Template)
+		case err != nil:
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("query template: %v", err))
+			return
+		case req.Title == "" && strings.Contains(t.Title, "{{title}}"):
+			v.add("title", "is required by template %q", req.Template)
+		}
+	}
+	switch req.Frequency {
+	case "daily":
+	case "weekly":
+		if !isWeekday(req.Weekday) {
+			v.add("weekday", "must be a day of the week, such as monday")
+		}
+	case "monthly":
+		// Capped at 28 so every month has the day.
+		if req.DayOfMonth < 1 || req.DayOfMonth > 28 {
+			v.add("day_of_month", "must be between 1 and 28")
+		}
+	default:
+		v.add("frequency", "must be daily, weekly or monthly")
+	}
+	if _, err := time.Parse("15:04", req.At); err != nil {
+		v.add("at", "must be HH:MM")
+	}
+	if len(v.errors) > 0 {
+		writeValidationError(w, r, v.errors)
+		return
+	}
+
+	res, err := s.db.ExecContext(r.Context(), `INSERT INTO brain_schedules (name, template, title, context, project, tags, frequency,
+		weekday, day_of_month, at, enabled)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, req.Name, req.Template, req.Title, req.Context, req.Project, req.Tags, req.Frequency,
+		req.Weekday, req.DayOfMonth, req.At, req.Enabled)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("insert schedule: %v", err))
+		return
+	}
+
+	id, _ := res.LastInsertId()
+	sc, err := scanBrainSchedule(s.db.QueryRowContext(r.Context(), `SELECT `+brainScheduleColumns+` FROM brain_schedules WHERE id = ?`, id))
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("load schedule: %v", err))
+		return
+	}
+	s.recordAudit(r.Context(), auditCreate, "schedule", sc.ID, nil, sc)
+	writeJSONStatus(w, http.StatusCreated, sc)
+}
+
+// deleteBrainSchedule serves DELETE /schedules/{id}. Records it already
+// created are kept.
+func (s *Server) deleteBrainSchedule(w http.ResponseWriter, r *http.Request, id int64) {
+	sc, err := scanBrainSchedule(s.db.QueryRowContext(r.Context(), `SELECT `+brainScheduleColumns+` FROM brain_schedules WHERE id = ?`, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, r, http.StatusNotFound, "not found")
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("query schedule: %v", err))
+		return
+	}
+	if _, err := s.db.ExecContext(r.Context(), `DELETE FROM brain_schedules WHERE id = ?`, id); err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("delete schedule: %v", err))
+		return
+	}
+	s.recordAudit(r.Context(), auditDelete, "schedule", id, sc, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// runBrainSchedule serves POST /schedules/{id}/run, creating the schedule's
+// record now regardless of when it is next due.
+func (s *Server) runBrainSchedule(w http.ResponseWriter, r *http.Request, id int64) {
+	sc, err := scanBrainSchedule(s.db.QueryRowContext(r.Context(), `SELECT `+brainScheduleColumns+` FROM brain_schedules WHERE id = ?`, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, r, http.StatusNotFound, "not found")
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("query schedule: %v", err))
+		return
+	}
+	b, err := s.createScheduledBrain(r.Context(), sc, time.Now())
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSONStatus(w, http.StatusCreated, b)
+}
+
+// runBrainScheduler checks once a minute for schedules that are due today
+// and creates their records. A day the server is down for the whole time
+// after a schedule's at is skipped rather than caught up later.
+func (s *Server) runBrainScheduler(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.runDueSchedules(ctx, now)
+		}
+	}
+}
+
+func (s *Server) runDueSchedules(ctx context.Context, now time.Time) {
+	schedules, err := s.loadBrainSchedules(ctx, true)
+	if err != nil {
+		log.Printf("brain scheduler: %v", err)
+		return
+	}
+
+	local := now.In(store.DisplayLocation())
+	for _, sc := range schedules {
+		if !sc.dueOn(local) {
+			continue
+		}
+		if _, err := s.createScheduledBrain(withActor(context.Background(), "system"), sc, now); err != nil {
+			log.Printf("brain scheduler: schedule %d: %v", sc.ID, err)
+		}
+	}
+}
+
+// createScheduledBrain creates the record for one run of sc: its title,
+// context, project and tags, with placeholders such as {{week}} expanded,
+// completed from its template. The run is recorded so the scheduler does not repeat it
+// the same day.
+func (s *Server) createScheduledBrain(ctx context.Context, sc brainSchedule, now time.Time) (brain, error) {
+	b := brainTemplate{Title: sc.Title, Context: sc.Context, Project: sc.Project, Tags: sc.Tags}.apply(brain{}, now)
+	if sc.Template != "" {
+		t, err := s.loadTemplate(ctx, sc.Template)
+		if err != nil {
+			return brain{}, fmt.Errorf("load template %q: %w", sc.Template, err)
+		}
+		b = t.apply(b, now)
+	}
+	if errs := validateBrain(b); len(errs) > 0 {
+		return brain{}, fmt.Errorf("invalid record: %s %s", errs[0].Field, errs[0].Message)
+	}
+
+	created, err := s.insertBrain(ctx, b)
+	if err != nil {
+		return brain{}, err
+	}
+	today := now.In(store.DisplayLocation()).Format("2006-01-02")
+	if _, err := s.db.ExecContext(ctx, `UPDATE brain_schedules SET last_run_on = ?, last_brain_id = ? WHERE id = ?`,
+		today, created.ID, sc.ID); err != nil {
+		return created, fmt.Errorf("record run: %w", err)
+	}
+	return created, nil
+}
+
+func isWeekday(name string) bool {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.EqualFold(day.String(), name) {
+			return true
+		}
+	}
+	return false
+}
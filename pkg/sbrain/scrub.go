@@ -0,0 +1,378 @@
+package sbrain
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// scrubRule redacts matching text from log messages and metadata before
+// they are stored. Exactly one of Preset, Pattern and Field is set.
+type scrubRule struct {
+	ID        int64     `json:"id"`
+	CreatedAt timestamp `json:"created_at"`
+	Name      string    `json:"name"`
+	// Preset is a built-in pattern: email, bearer_token or ip.
+	Preset string `json:"preset"`
+	// Pattern is a regular expression (RE2 syntax).
+	Pattern string `json:"pattern"`
+	// Field is a metadata key, matched case-insensitively at any depth,
+	// whose value is replaced whole. "ip" and "user_agent" also replace the
+	// log's own column.
+	Field string `json:"field"`
+	// Replacement defaults to the preset's placeholder or "[REDACTED]".
+	Replacement string `json:"replacement"`
+	Enabled     bool   `json:"enabled"`
+}
+
+const scrubRuleColumns = `id, created_at, name, preset, pattern, field, replacement, enabled`
+
+func scanScrubRule(row interface{ Scan(...any) error }) (scrubRule, error) {
+	var rule scrubRule
+	err := row.Scan(&rule.ID, &rule.CreatedAt, &rule.Name, &rule.Preset, &rule.Pattern, &rule.Field, &rule.Replacement, &rule.Enabled)
+	return rule, err
+}
+
+// scrubPreset is a built-in pattern. valid, when set, vets each match so
+// the pattern can stay loose.
+type scrubPreset struct {
+	re          *regexp.Regexp
+	replacement string
+	valid       func(match string) bool
+}
+
+var scrubPresets = map[string]scrubPreset{
+	"email": {
+		re:          regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`),
+		replacement: "[email]",
+	},
+	"bearer_token": {
+		re:          regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9._~+/-]+=*`),
+		replacement: "Bearer [token]",
+	},
+	"ip": {
+		re:          regexp.MustCompile(`\b\d{1,3}(?:\.\d{1,3}){3}\b|[0-9A-Fa-f]{0,4}(?::[0-9A-Fa-f]{0,4}){2,7}`),
+		replacement: "[ip]",
+		valid: func(match string) bool {
+			if net.ParseIP(match) == nil {
+				return false
+			}
+			// "::" and "::1"-like fragments turn up in code (std::map) and
+			// timestamps, so IPv6 needs at least two groups.
+			if strings.Contains(match, ":") {
+				groups := 0
+				for _, g := range strings.Split(match, ":") {
+					if g != "" {
+						groups++
+					}
+				}
+				return groups >= 2
+			}
+			return true
+		},
+	},
+}
+
+// compiledScrubRule is a rule ready to apply.
+type compiledScrubRule struct {
+	re          *regexp.Regexp
+	valid       func(string) bool
+	field       string
+	replacement string
+}
+
+func compileScrubRule(rule scrubRule) (compiledScrubRule, error) {
+	set := 0
+	for _, v := range []string{rule.Preset, rule.Pattern, rule.Field} {
+		if v != "" {
+			set++
+		}
+	}
+	if set != 1 {
+		return compiledScrubRule{}, errors.New("exactly one of preset, pattern and field is required")
+	}
+	c := compiledScrubRule{replacement: rule.Replacement}
+	switch {
+	case rule.Preset != "":
+		p, ok := scrubPresets[rule.Preset]
+		if !ok {
+			return c, fmt.Errorf("unknown preset %q: expected email, bearer_token or ip", rule.Preset)
+		}
+		c.re, c.valid = p.re, p.valid
+		if c.replacement == "" {
+			c.replacement = p.replacement
+		}
+	case rule.Pattern != "":
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return c, fmt.Errorf("invalid pattern: %v", err)
+		}
+		c.re = re
+	default:
+		c.field = strings.ToLower(rule.Field)
+	}
+	if c.replacement == "" {
+		c.replacement = "[REDACTED]"
+	}
+	return c, nil
+}
+
+// scrubber holds the enabled rules, compiled, so ingestion does not query
+// them per log. It is reloaded whenever a rule is added or removed.
+type scrubber struct {
+	mu    sync.RWMutex
+	rules []compiledScrubRule
+}
+
+// reloadScrubRules recompiles the enabled rules. Like reloadFeatureFlags it
+// runs after a change has been saved and ignores the request context.
+func (s *Server) reloadScrubRules() error {
+	rules, err := s.loadScrubRules(context.Background(), true)
+	if err != nil {
+		return err
+	}
+	compiled := make([]compiledScrubRule, 0, len(rules))
+	for _, rule := range rules {
+		c, err := compileScrubRule(rule)
+		if err != nil {
+			return fmt.Errorf("scrub rule %d: %w", rule.ID, err)
+		}
+		compiled = append(compiled, c)
+	}
+	s.scrub.mu.Lock()
+	s.scrub.rules = compiled
+	s.scrub.mu.Unlock()
+	return nil
+}
+
+func (sc *scrubber) current() []compiledScrubRule {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	return sc.rules
+}
+
+// scrubLog applies rules to l's message and metadata, and to its ip
+// column (so the ip preset covers the client address as well), returning
+// how many values were redacted. ip and user_agent field rules replace
+// those columns.
+func scrubLog(l *logEntry, rules []compiledScrubRule) int {
+	if len(rules) == 0 {
+		return 0
+	}
+	n := 0
+	l.Message = scrubText(l.Message, rules, &n)
+	l.Metadata = scrubMetadata(l.Metadata, rules, &n)
+	l.IP = scrubText(l.IP, rules, &n)
+	for _, rule := range rules {
+		switch {
+		case rule.field == "ip" && l.IP != "":
+			l.IP, n = rule.replacement, n+1
+		case rule.field == "user_agent" && l.UserAgent != "":
+			l.UserAgent, n = rule.replacement, n+1
+		}
+	}
+	return n
+}
+
+// scrubText applies the pattern rules to text.
+func scrubText(text string, rules []compiledScrubRule, n *int) string {
+	for _, rule := range rules {
+		if rule.re == nil {
+			continue
+		}
+		text = rule.re.ReplaceAllStringFunc(text, func(match string) string {
+			if rule.valid != nil && !rule.valid(match) {
+				return match
+			}
+			*n++
+			return rule.replacement
+		})
+	}
+	return text
+}
+
+// scrubMetadata applies field rules to JSON metadata and pattern rules to
+// its string values, so replacements cannot break the JSON. Metadata that
+// is not JSON is scrubbed as plain text.
+func scrubMetadata(metadata string, rules []compiledScrubRule, n *int) string {
+	if strings.TrimSpace(metadata) == "" {
+		return metadata
+	}
+	var doc any
+	if err := json.Unmarshal([]byte(metadata), &doc); err != nil {
+		return scrubText(metadata, rules, n)
+	}
+	before := *n
+	doc = scrubJSON(doc, rules, n)
+	if *n == before {
+		return metadata
+	}
+	encoded, err := json.Marshal(doc)
+	if err != nil {
+		return metadata
+	}
+	return string(encoded)
+}
+
+func scrubJSON(v any, rules []compiledScrubRule, n *int) any {
+	switch v := v.(type) {
+	case map[string]any:
+	keys:
+		for k, value := range v {
+			for _, rule := range rules {
+				if rule.field != "" && strings.EqualFold(k, rule.field) {
+					v[k] = rule.replacement
+					*n++
+					continue keys
+				}
+			}
+			v[k] = scrubJSON(value, rules, n)
+		}
+		return v
+	case []any:
+		for i, item := range v {
+			v[i] = scrubJSON(item, rules, n)
+		}
+		return v
+	case string:
+		return scrubText(v, rules, n)
+	}
+	return v
+}
+
+func (s *Server) loadScrubRules(ctx context.Context, enabledOnly bool) ([]scrubRule, error) {
+	query := `SELECT ` + scrubRuleColumns + ` FROM scrub_rules`
+	if enabledOnly {
+		query += ` WHERE enabled = 1`
+	}
+	rows, err := s.db.QueryContext(ctx, query+` ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("query scrub rules: %w", err)
+	}
+	defer rows.Close()
+
+	items := []scrubRule{}
+	for rows.Next() {
+		rule, err := scanScrubRule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan scrub rule: %w", err)
+		}
+		items = append(items, rule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate scrub rules: %w", err)
+	}
+	return items, nil
+}
+
+func (s *Server) listScrubRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := s.loadScrubRules(r.Context(), false)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, rules)
+}
+
+func (s *Server) createScrubRule(w http.ResponseWriter, r *http.Request) {
+	req := scrubRule{Enabled: true}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("decode body: %v", err))
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	req.Preset = strings.TrimSpace(req.Preset)
+	req.Field = strings.TrimSpace(req.Field)
+	if req.Name == "" {
+		writeError(w, r, http.StatusBadRequest, "name is required")
+		return
+	}
+	if _, err := compileScrubRule(req); err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	res, err := s.db.ExecContext(r.Context(), `INSERT INTO scrub_rules (name, preset, pattern, field, replacement, enabled)
+		VALUES (?, ?, ?, ?, ?, ?)`, req.Name, req.Preset, req.Pattern, req.Field, req.Replacement, req.Enabled)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("insert scrub rule: %v", err))
+		return
+	}
+	id, _ := res.LastInsertId()
+	rule, err := scanScrubRule(s.db.QueryRowContext(r.Context(), `SELECT `+scrubRuleColumns+` FROM scrub_rules WHERE id = ?`, id))
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("load scrub rule: %v", err))
+		return
+	}
+	if err := s.reloadScrubRules(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.recordAudit(r.Context(), auditCreate, "scrub_rule", rule.ID, nil, rule)
+	writeJSONStatus(w, http.StatusCreated, rule)
+}
+
+// deleteScrubRule serves DELETE /admin/scrub/rules/{id}.
+func (s *Server) deleteScrubRule(w http.ResponseWriter, r *http.Request, id int64) {
+	rule, err := scanScrubRule(s.db.QueryRowContext(r.Context(), `SELECT `+scrubRuleColumns+` FROM scrub_rules WHERE id = ?`, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, r, http.StatusNotFound, "not found")
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("query scrub rule: %v", err))
+		return
+	}
+	if _, err := s.db.ExecContext(r.Context(), `DELETE FROM scrub_rules WHERE id = ?`, id); err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("delete scrub rule: %v", err))
+		return
+	}
+	if err := s.reloadScrubRules(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	s.recordAudit(r.Context(), auditDelete, "scrub_rule", id, rule, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// testScrubRule serves POST /admin/scrub/test: it scrubs a sample log with
+// the given rule, or with the enabled rules when none is given, and returns
+// the result without storing anything.
+func (s *Server) testScrubRule(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Rule      *scrubRule `json:"rule"`
+		Message   string     `json:"message"`
+		Metadata  string     `json:"metadata"`
+		IP        string     `json:"ip"`
+		UserAgent string     `json:"user_agent"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("decode body: %v", err))
+		return
+	}
+	rules := s.scrub.current()
+	if req.Rule != nil {
+		c, err := compileScrubRule(*req.Rule)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		rules = []compiledScrubRule{c}
+	}
+	l := logEntry{Message: req.Message, Metadata: req.Metadata, IP: req.IP, UserAgent: req.UserAgent}
+	n := scrubLog(&l, rules)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"message":    l.Message,
+		"metadata":   l.Metadata,
+		"ip":         l.IP,
+		"user_agent": l.UserAgent,
+		"redactions": n,
+	})
+}
@@ -0,0 +1,243 @@
+package sbrain
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"sbrain/store"
+)
+
+// Search limits: results returned, and candidate rows scored per resource.
+// Candidates are the most recent matches, so a very common term favours
+// recent records over exhaustive ranking.
+const (
+	defaultSearchLimit  = 20
+	maxSearchLimit      = 100
+	searchCandidateRows = 1000
+	searchSnippetRunes  = 160
+)
+
+// searchResult is one hit from /search. Type says which resource it is and
+// Path where to fetch it.
+type searchResult struct {
+	Type      string    `json:"type"`
+	ID        int64     `json:"id"`
+	Path      string    `json:"path"`
+	Score     float64   `json:"score"`
+	Title     string    `json:"title"`
+	Snippet   string    `json:"snippet"`
+	CreatedAt timestamp `json:"created_at"`
+}
+
+// searchField is a text field a term can match in, weighted by how telling
+// a match there is.
+type searchField struct {
+	column string
+	weight float64
+}
+
+var (
+	brainSearchFields = []searchField{{"title", 3}, {"tags", 2}, {"project", 2}, {"context", 1}}
+	logSearchFields   = []searchField{{"message", 2}, {"endpoint", 1}, {"metadata", 1}}
+)
+
+// searchHandler serves GET /search?q=: records and logs containing every
+// whitespace-separated term (case-insensitively), best first.
+func (s *Server) searchHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	terms := strings.Fields(strings.ToLower(q.Get("q")))
+	if len(terms) == 0 {
+		writeError(w, r, http.StatusBadRequest, "q is required")
+		return
+	}
+	limit := defaultSearchLimit
+	if raw := q.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxSearchLimit {
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxSearchLimit))
+			return
+		}
+		limit = n
+	}
+	kind := q.Get("type")
+	if kind != "" && kind != "brain" && kind != "log" {
+		writeError(w, r, http.StatusBadRequest, "type must be brain or log")
+		return
+	}
+
+	results := []searchResult{}
+	if kind == "" || kind == "brain" {
+		brains, err := s.searchBrains(r, terms)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		results = append(results, brains...)
+	}
+	if kind == "" || kind == "log" {
+		logs, err := s.searchLogs(r, terms)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		results = append(results, logs...)
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].CreatedAt > results[j].CreatedAt
+	})
+	setPagination(r.Context(), pagination{Limit: limit, HasMore: len(results) > limit})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
+func (s *Server) searchBrains(r *http.Request, terms []string) ([]searchResult, error) {
+	where, args := searchWhere(brainSearchFields, terms)
+	rows, err := s.db.QueryContext(r.Context(), `SELECT `+store.BrainColumns+` FROM second_brain`+where+`
+		ORDER BY created_at DESC LIMIT ?`, append(args, searchCandidateRows)...)
+	if err != nil {
+		return nil, fmt.Errorf("search brains: %w", err)
+	}
+	defer rows.Close()
+
+	var results []searchResult
+	for rows.Next() {
+		var b brain
+		if err := rows.Scan(b.Fields()...); err != nil {
+			return nil, fmt.Errorf("scan brain: %w", err)
+		}
+		values := map[string]string{"title": b.Title, "tags": b.Tags, "project": b.Project, "context": b.Context}
+		results = append(results, searchResult{
+			Type:      "brain",
+			ID:        b.ID,
+			Path:      fmt.Sprintf("/brain/%d", b.ID),
+			Score:     searchScore(brainSearchFields, values, terms),
+			Title:     b.Title,
+			Snippet:   brainSnippet(b, terms),
+			CreatedAt: b.CreatedAt,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate brains: %w", err)
+	}
+	return results, nil
+}
+
+func (s *Server) searchLogs(r *http.Request, terms []string) ([]searchResult, error) {
+	where, args := searchWhere(logSearchFields, terms)
+	rows, err := s.db.QueryContext(r.Context(), `SELECT id, occurred_at, level, message, endpoint, metadata FROM logs`+where+`
+		ORDER BY occurred_at DESC, id DESC LIMIT ?`, append(args, searchCandidateRows)...)
+	if err != nil {
+		return nil, fmt.Errorf("search logs: %w", err)
+	}
+	defer rows.Close()
+
+	var results []searchResult
+	for rows.Next() {
+		var l logEntry
+		if err := rows.Scan(&l.ID, &l.OccurredAt, &l.Level, &l.Message, &l.Endpoint, &l.Metadata); err != nil {
+			return nil, fmt.Errorf("scan log: %w", err)
+		}
+		values := map[string]string{"message": l.Message, "endpoint": l.Endpoint, "metadata": l.Metadata}
+		title := strings.ToUpper(l.Level)
+		if l.Endpoint != "" {
+			title += " " + l.Endpoint
+		}
+		snippet := searchSnippet(l.Message, terms)
+		if snippet == "" {
+			snippet = searchSnippet(l.Metadata, terms)
+		}
+		results = append(results, searchResult{
+			Type:      "log",
+			ID:        l.ID,
+			Path:      fmt.Sprintf("/logs/%d", l.ID),
+			Score:     searchScore(logSearchFields, values, terms),
+			Title:     title,
+			Snippet:   snippet,
+			CreatedAt: l.OccurredAt,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate logs: %w", err)
+	}
+	return results, nil
+}
+
+// brainSnippet prefers a record's summary to an excerpt of its context.
+func brainSnippet(b brain, terms []string) string {
+	if b.Summary != "" {
+		return b.Summary
+	}
+	return searchSnippet(b.Context, terms)
+}
+
+// searchWhere requires every term to appear in at least one of fields.
+func searchWhere(fields []searchField, terms []string) (string, []any) {
+	var clauses []string
+	var args []any
+	for _, term := range terms {
+		var either []string
+		for _, f := range fields {
+			either = append(either, "instr(lower("+f.column+"), ?) > 0")
+			args = append(args, term)
+		}
+		clauses = append(clauses, "("+strings.Join(either, " OR ")+")")
+	}
+	return " WHERE " + strings.Join(clauses, " AND "), args
+}
+
+// searchScore sums, over terms and fields, the field weight times the
+// number of occurrences, damped so one long field cannot dominate.
+func searchScore(fields []searchField, values map[string]string, terms []string) float64 {
+	var score float64
+	for _, f := range fields {
+		value := strings.ToLower(values[f.column])
+		for _, term := range terms {
+			if n := strings.Count(value, term); n > 0 {
+				score += f.weight * (1 + float64(n-1)/float64(n+1))
+			}
+		}
+	}
+	return score
+}
+
+// searchSnippet returns up to searchSnippetRunes runes of text around the
+// first term found in it, or "" when none is.
+func searchSnippet(text string, terms []string) string {
+	lower := strings.ToLower(text)
+	at := -1
+	for _, term := range terms {
+		if i := strings.Index(lower, term); i >= 0 && (at < 0 || i < at) {
+			at = i
+		}
+	}
+	if at < 0 {
+		return ""
+	}
+	if len(lower) != len(text) {
+		// Lowercasing changed byte offsets; start from the beginning.
+		at = 0
+	}
+
+	runes := []rune(text)
+	center := utf8.RuneCountInString(text[:at])
+	start := max(center-searchSnippetRunes/3, 0)
+	end := min(start+searchSnippetRunes, len(runes))
+	snippet := strings.Join(strings.Fields(string(runes[start:end])), " ")
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(runes) {
+		snippet += "…"
+	}
+	return snippet
+}
@@ -0,0 +1,377 @@
+package sbrain
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"time"
+
+	"sbrain/store"
+)
+
+// Seeding writes in transactions of seedBatchSize rows; one transaction per
+// row would make 100,000 logs take minutes.
+const (
+	seedBatchSize   = 5000
+	maxSeedBrains   = 100_000
+	maxSeedLogs     = 1_000_000
+	defaultSeedDays = 90
+)
+
+// SeedOptions says what Seed generates.
+type SeedOptions struct {
+	Brains int
+	Logs   int
+	// Project puts every record in one project; empty spreads them over a
+	// handful of made-up ones.
+	Project string
+	// Days is how far back created_at and occurred_at reach; 0 means 90.
+	Days int
+	// Seed makes the data repeatable: the same seed and counts give the same
+	// records.
+	Seed uint64
+	// Progress, if set, is called after each batch.
+	Progress func(step string, done, total int)
+}
+
+// SeedResult reports what Seed wrote.
+type SeedResult struct {
+	Brains       int    `json:"brains"`
+	Logs         int    `json:"logs"`
+	FirstBrainID int64  `json:"first_brain_id,omitempty"`
+	FirstLogID   int64  `json:"first_log_id,omitempty"`
+	Since        string `json:"since"`
+	Took         string `json:"took"`
+}
+
+var (
+	seedProjects  = []string{"sbrain", "billing", "mobile-app", "infra", "website", "data-pipeline"}
+	seedTags      = []string{"bug", "idea", "todo", "meeting", "research", "perf", "security", "release", "design", "oncall", "docs", "refactor"}
+	seedSubjects  = []string{"cache", "login flow", "retry policy", "search index", "webhook delivery", "billing export", "rate limiter", "migration", "dashboard", "deploy pipeline", "session store", "image upload"}
+	seedVerbs     = []string{"Investigate", "Fix", "Sketch", "Review", "Speed up", "Document", "Rethink", "Test", "Clean up", "Ship"}
+	seedSentences = []string{
+		"The p99 latency doubled after the last deploy.",
+		"Users on older app versions still hit the legacy endpoint.",
+		"We could batch these writes instead of doing one per request.",
+		"The staging database is out of date, so repro there first.",
+		"Ask the platform team whether the limit is per key or per IP.",
+		"An index on (project, created_at) should cover the list query.",
+		"Retries need jitter or they all land at the same second.",
+		"The error only shows up when the payload is over 1 MB.",
+		"Feature flag it and turn it on for internal users first.",
+		"Timeouts are 30s upstream but 10s at the load balancer.",
+		"Logs show the job started twice within the same minute.",
+		"Keep the old column until every reader has been migrated.",
+	}
+	seedEndpoints = []string{"/api/users", "/api/users/{id}", "/api/orders", "/api/orders/{id}", "/api/search", "/api/login", "/api/logout", "/api/upload", "/api/export", "/healthz"}
+	seedMethods   = []string{"GET", "GET", "GET", "GET", "POST", "POST", "PUT", "DELETE"}
+	seedAgents    = []string{
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 14_5) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Safari/605.1.15",
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0 Safari/537.36",
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148",
+		"curl/8.7.1",
+		"okhttp/4.12.0",
+		"Go-http-client/2.0",
+	}
+	// seedLevels weighs the levels the way production logs usually are.
+	seedLevels = []struct {
+		level  string
+		weight int
+	}{{"debug", 15}, {"info", 70}, {"warn", 10}, {"error", 5}}
+)
+
+// Seed fills the database with made-up but plausible brain records and
+// logs, for developing the UI and trying pagination and search at volume.
+// It writes straight to the database, bypassing validation, dedup, sampling
+// and webhooks.
+func (s *Server) Seed(ctx context.Context, opts SeedOptions) (SeedResult, error) {
+	if opts.Brains < 0 || opts.Logs < 0 || opts.Days < 0 {
+		return SeedResult{}, errors.New("seed: counts and days must not be negative")
+	}
+	if opts.Days == 0 {
+		opts.Days = defaultSeedDays
+	}
+	progress := opts.Progress
+	if progress == nil {
+		progress = func(string, int, int) {}
+	}
+	rng := rand.New(rand.NewPCG(opts.Seed, 0x5b7a1f))
+	now := time.Now().UTC().Truncate(time.Second)
+	since := now.Add(-time.Duration(opts.Days) * 24 * time.Hour)
+	started := time.Now()
+	result := SeedResult{Since: string(store.NewTimestamp(since))}
+
+	brainIDs := make([]int64, 0, opts.Brains)
+	err := seedBatches(ctx, s.db, opts.Brains, `INSERT INTO second_brain
+		(created_at, updated_at, title, context, project, commits, tags, pinned, favorite, archived)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, func(stmt *sql.Stmt) error {
+		created := seedTime(rng, since, now)
+		updated := created
+		if rng.IntN(3) == 0 {
+			updated = seedTime(rng, created, now)
+		}
+		res, err := stmt.ExecContext(ctx, store.NewTimestamp(created), store.NewTimestamp(updated),
+			seedTitle(rng), seedContext(rng), seedProject(rng, opts.Project), seedCommits(rng), seedTagList(rng),
+			rng.IntN(20) == 0, rng.IntN(10) == 0, rng.IntN(12) == 0)
+		if err != nil {
+			return fmt.Errorf("insert brain: %w", err)
+		}
+		id, err := res.LastInsertId()
+		brainIDs = append(brainIDs, id)
+		return err
+	}, func(done int) { progress("brains", done, opts.Brains) })
+	if err != nil {
+		return SeedResult{}, err
+	}
+	result.Brains = len(brainIDs)
+	if len(brainIDs) > 0 {
+		result.FirstBrainID = brainIDs[0]
+	}
+
+	logged := 0
+	err = seedBatches(ctx, s.db, opts.Logs, `INSERT INTO logs
+		(created_at, occurred_at, level, message, endpoint, method, ip, user_agent, request_id,
+		status_code, response_time_ms, metadata, brain_id, project)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, func(stmt *sql.Stmt) error {
+		l := seedLog(rng, since, now)
+		if len(brainIDs) > 0 && rng.IntN(10) == 0 {
+			id := brainIDs[rng.IntN(len(brainIDs))]
+			l.BrainID = &id
+		}
+		res, err := stmt.ExecContext(ctx, l.OccurredAt, l.OccurredAt, l.Level, l.Message, l.Endpoint, l.Method, l.IP,
+			l.UserAgent, l.RequestID, *l.StatusCode, *l.ResponseTimeMs, l.Metadata, l.BrainID, seedProject(rng, opts.Project))
+		if err != nil {
+			return fmt.Errorf("insert log: %w", err)
+		}
+		if logged == 0 {
+			result.FirstLogID, _ = res.LastInsertId()
+		}
+		logged++
+		return nil
+	}, func(done int) { progress("logs", done, opts.Logs) })
+	if err != nil {
+		return SeedResult{}, err
+	}
+	result.Logs = logged
+	result.Took = time.Since(started).Round(time.Millisecond).String()
+	return result, nil
+}
+
+// seedBatches prepares query and calls insert n times, committing every
+// seedBatchSize rows and reporting after each commit.
+func seedBatches(ctx context.Context, db *sql.DB, n int, query string, insert func(*sql.Stmt) error, done func(int)) error {
+	for start := 0; start < n; start += seedBatchSize {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("begin: %w", err)
+		}
+		stmt, err := tx.PrepareContext(ctx, query)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("prepare: %w", err)
+		}
+		end := min(start+seedBatchSize, n)
+		for range end - start {
+			if err := insert(stmt); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("commit: %w", err)
+		}
+		done(end)
+	}
+	return nil
+}
+
+// seedTime picks a moment between from and to, busier on weekday working
+// hours the way real traffic is.
+func seedTime(rng *rand.Rand, from, to time.Time) time.Time {
+	span := to.Sub(from)
+	if span <= 0 {
+		return from
+	}
+	for {
+		t := from.Add(time.Duration(rng.Int64N(int64(span))))
+		quiet := t.Weekday() == time.Saturday || t.Weekday() == time.Sunday || t.Hour() < 8 || t.Hour() >= 19
+		if !quiet || rng.IntN(4) == 0 {
+			return t
+		}
+	}
+}
+
+func seedProject(rng *rand.Rand, project string) string {
+	if project != "" {
+		return project
+	}
+	return seedProjects[rng.IntN(len(seedProjects))]
+}
+
+func seedTitle(rng *rand.Rand) string {
+	return seedVerbs[rng.IntN(len(seedVerbs))] + " " + seedSubjects[rng.IntN(len(seedSubjects))]
+}
+
+func seedContext(rng *rand.Rand) string {
+	paragraphs := make([]string, 1+rng.IntN(4))
+	for i := range paragraphs {
+		sentences := make([]string, 1+rng.IntN(4))
+		for j := range sentences {
+			sentences[j] = seedSentences[rng.IntN(len(seedSentences))]
+		}
+		paragraphs[i] = strings.Join(sentences, " ")
+	}
+	return strings.Join(paragraphs, "\n\n")
+}
+
+func seedCommits(rng *rand.Rand) string {
+	if rng.IntN(3) != 0 {
+		return ""
+	}
+	commits := make([]string, 1+rng.IntN(3))
+	for i := range commits {
+		commits[i] = fmt.Sprintf("%07x", rng.Uint32()&0xfffffff)
+	}
+	return strings.Join(commits, ",")
+}
+
+func seedTagList(rng *rand.Rand) string {
+	tags := make([]string, 0, 3)
+	for _, i := range rng.Perm(len(seedTags))[:rng.IntN(4)] {
+		tags = append(tags, seedTags[i])
+	}
+	return strings.Join(tags, ",")
+}
+
+func seedLog(rng *rand.Rand, since, now time.Time) store.Log {
+	level, n := "", rng.IntN(100)
+	for _, l := range seedLevels {
+		if level, n = l.level, n-l.weight; n < 0 {
+			break
+		}
+	}
+	endpoint := seedEndpoints[rng.IntN(len(seedEndpoints))]
+	method := seedMethods[rng.IntN(len(seedMethods))]
+	status := 200
+	switch level {
+	case "warn":
+		status = []int{400, 401, 404, 409, 429}[rng.IntN(5)]
+	case "error":
+		status = []int{500, 502, 503, 504}[rng.IntN(4)]
+	default:
+		if method == "POST" {
+			status = 201
+		} else if method == "DELETE" {
+			status = 204
+		}
+	}
+	// Response times are log-normal around 40ms, with errors slower.
+	responseMs := int(math.Exp(3.7 + rng.NormFloat64()*0.9))
+	if level == "error" {
+		responseMs *= 5
+	}
+	message := fmt.Sprintf("%s %s %d", method, endpoint, status)
+	if level == "error" || level == "warn" {
+		message += ": " + seedSentences[rng.IntN(len(seedSentences))]
+	}
+	metadata, _ := json.Marshal(map[string]any{"region": []string{"us-east-1", "eu-west-1", "ap-south-1"}[rng.IntN(3)], "seed": true})
+	return store.Log{
+		OccurredAt:     store.NewTimestamp(seedTime(rng, since, now)),
+		Level:          level,
+		Message:        message,
+		Endpoint:       endpoint,
+		Method:         method,
+		IP:             fmt.Sprintf("203.0.113.%d", 1+rng.IntN(254)),
+		UserAgent:      seedAgents[rng.IntN(len(seedAgents))],
+		RequestID:      fmt.Sprintf("req-%016x", rng.Uint64()),
+		StatusCode:     &status,
+		ResponseTimeMs: &responseMs,
+		Metadata:       string(metadata),
+	}
+}
+
+// seedHandler serves POST /admin/seed, which exists only while the seed
+// feature flag is on (SBRAIN_FLAGS=seed), so a production server cannot be
+// filled with fake data by accident.
+func (s *Server) seedHandler(w http.ResponseWriter, r *http.Request) {
+	req := SeedOptions{Brains: 100, Logs: 1000}
+	var body struct {
+		Brains  *int   `json:"brains"`
+		Logs    *int   `json:"logs"`
+		Project string `json:"project"`
+		Days    int    `json:"days"`
+		Seed    uint64 `json:"seed"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("decode body: %v", err))
+			return
+		}
+	}
+	if body.Brains != nil {
+		req.Brains = *body.Brains
+	}
+	if body.Logs != nil {
+		req.Logs = *body.Logs
+	}
+	req.Project, req.Days, req.Seed = strings.TrimSpace(body.Project), body.Days, body.Seed
+	var errs []FieldError
+	if req.Brains < 0 || req.Brains > maxSeedBrains {
+		errs = append(errs, FieldError{Field: "brains", Message: fmt.Sprintf("must be between 0 and %d", maxSeedBrains)})
+	}
+	if req.Logs < 0 || req.Logs > maxSeedLogs {
+		errs = append(errs, FieldError{Field: "logs", Message: fmt.Sprintf("must be between 0 and %d", maxSeedLogs)})
+	}
+	if req.Days < 0 || req.Days > 3650 {
+		errs = append(errs, FieldError{Field: "days", Message: "must be between 0 and 3650; 0 means 90"})
+	}
+	if len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+	s.runDBOperation("seed", func(ctx context.Context, progress func(dbProgress)) (any, error) {
+		req.Progress = func(step string, done, total int) {
+			progress(dbProgress{Step: step, Done: done, Total: total})
+		}
+		return s.Seed(ctx, req)
+	})(w, r)
+}
+
+// seedSpec documents POST /admin/seed in the OpenAPI spec.
+func seedSpec() map[string]any {
+	spec := dbOperationSpec("Fill the database with fake brain records and logs for development", "seedDatabase", map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"brains":         map[string]any{"type": "integer"},
+			"logs":           map[string]any{"type": "integer"},
+			"first_brain_id": map[string]any{"type": "integer"},
+			"first_log_id":   map[string]any{"type": "integer"},
+			"since":          map[string]any{"type": "string"},
+			"took":           map[string]any{"type": "string"},
+		},
+	})
+	post := spec["post"].(map[string]any)
+	post["description"] = "Exists only while the seed feature flag is on (SBRAIN_FLAGS=seed). " + post["description"].(string)
+	post["requestBody"] = map[string]any{
+		"content": map[string]any{"application/json": map[string]any{"schema": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"brains":  map[string]any{"type": "integer", "default": 100, "maximum": maxSeedBrains},
+				"logs":    map[string]any{"type": "integer", "default": 1000, "maximum": maxSeedLogs},
+				"project": map[string]any{"type": "string", "description": "Put everything in this project instead of several made-up ones"},
+				"days":    map[string]any{"type": "integer", "default": defaultSeedDays, "description": "How far back the timestamps reach"},
+				"seed":    map[string]any{"type": "integer", "description": "Random seed; the same seed gives the same data"},
+			},
+		}}},
+	}
+	responses := post["responses"].(map[string]any)
+	responses["400"] = map[string]any{"description": "Invalid counts"}
+	responses["404"] = map[string]any{"description": "The seed feature flag is off"}
+	return spec
+}
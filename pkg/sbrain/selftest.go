@@ -0,0 +1,270 @@
+package sbrain
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"sbrain/migrations"
+	"sbrain/store"
+)
+
+// selfTestCheck is one startup check reported by /readyz.
+type selfTestCheck struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type selfTestResult struct {
+	Ready     bool            `json:"ready"`
+	CheckedAt timestamp       `json:"checked_at"`
+	Checks    []selfTestCheck `json:"checks"`
+}
+
+// readiness holds the latest self-test result. A failed result is re-checked
+// when /readyz is asked, so the server turns ready once migrations are run
+// without a restart.
+type readiness struct {
+	mu     sync.Mutex
+	result selfTestResult
+}
+
+// runSelfTest checks that the database has every table and column the
+// migrations define, that the migrations are applied and clean, and that
+// the database accepts writes.
+func runSelfTest(ctx context.Context, db *sql.DB) selfTestResult {
+	result := selfTestResult{Ready: true, CheckedAt: store.NewTimestamp(time.Now())}
+	add := func(name string, err error, detail string) {
+		c := selfTestCheck{Name: name, OK: err == nil, Detail: detail}
+		if err != nil {
+			c.Detail = err.Error()
+			result.Ready = false
+		}
+		result.Checks = append(result.Checks, c)
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		add("database", err, "")
+		return result
+	}
+	add("database", nil, "")
+
+	latest, err := latestMigration()
+	if err != nil {
+		add("migrations", err, "")
+	} else {
+		detail, err := checkMigrationVersion(ctx, db, latest)
+		add("migrations", err, detail)
+	}
+	add("schema", verifySchema(ctx, db), "")
+	add("write", checkWritable(ctx, db), "")
+	return result
+}
+
+// latestMigration returns the highest embedded migration version.
+func latestMigration() (int, error) {
+	names, err := fs.Glob(migrations.Files, "*.up.sql")
+	if err != nil {
+		return 0, err
+	}
+	latest := 0
+	for _, name := range names {
+		version, _, _ := strings.Cut(path.Base(name), "_")
+		n, err := strconv.Atoi(version)
+		if err != nil {
+			return 0, fmt.Errorf("migration %s: unnumbered", name)
+		}
+		latest = max(latest, n)
+	}
+	return latest, nil
+}
+
+// checkMigrationVersion compares golang-migrate's schema_migrations with the
+// latest embedded migration. Databases migrated some other way have no
+// schema_migrations and rely on the schema check alone.
+func checkMigrationVersion(ctx context.Context, db *sql.DB, latest int) (string, error) {
+	var version int
+	var dirty bool
+	err := db.QueryRowContext(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	switch {
+	case err != nil && strings.Contains(err.Error(), "no such table"):
+		return "not tracked (no schema_migrations table)", nil
+	case errors.Is(err, sql.ErrNoRows):
+		return "", fmt.Errorf("no migrations applied; expected version %d", latest)
+	case err != nil:
+		return "", fmt.Errorf("read schema_migrations: %w", err)
+	case dirty:
+		return "", fmt.Errorf("version %d is dirty: a migration failed part-way and needs fixing before `migrate force`", version)
+	case version < latest:
+		return "", fmt.Errorf("at version %d, expected %d: run `migrate up`", version, latest)
+	case version > latest:
+		return fmt.Sprintf("version %d is newer than this build (%d)", version, latest), nil
+	}
+	return fmt.Sprintf("version %d", version), nil
+}
+
+// verifySchema reports every table and column the embedded migrations create
+// that db lacks. Extra tables and columns are fine.
+func verifySchema(ctx context.Context, db *sql.DB) error {
+	expected, err := expectedSchema(ctx)
+	if err != nil {
+		return fmt.Errorf("build expected schema: %w", err)
+	}
+	actual, err := schemaColumns(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	var missing []string
+	for table, columns := range expected {
+		have, ok := actual[table]
+		if !ok {
+			missing = append(missing, "table "+table)
+			continue
+		}
+		for _, column := range columns {
+			if !slices.Contains(have, column) {
+				missing = append(missing, "column "+table+"."+column)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("missing %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// expectedSchema applies the embedded migrations, the ones this build was
+// made with, in order to a fresh in-memory database and returns its tables
+// and columns, so the expectation never drifts from the migrations.
+func expectedSchema(ctx context.Context) (map[string][]string, error) {
+	mem, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		return nil, err
+	}
+	defer mem.Close()
+	// Every connection to :memory: is a separate database.
+	mem.SetMaxOpenConns(1)
+
+	names, err := fs.Glob(migrations.Files, "*.up.sql")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		script, err := migrations.Files.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := mem.ExecContext(ctx, string(script)); err != nil {
+			return nil, fmt.Errorf("%s: %w", path.Base(name), err)
+		}
+	}
+	return schemaColumns(ctx, mem)
+}
+
+// schemaColumns lists the columns of every user table in db.
+func schemaColumns(ctx context.Context, db *sql.DB) (map[string][]string, error) {
+	rows, err := db.QueryContext(ctx, `SELECT name FROM sqlite_master
+		WHERE type = 'table' AND name NOT LIKE 'sqlite_%' AND name != 'schema_migrations'`)
+	if err != nil {
+		return nil, fmt.Errorf("list tables: %w", err)
+	}
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan table: %w", err)
+		}
+		tables = append(tables, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list tables: %w", err)
+	}
+
+	schema := make(map[string][]string, len(tables))
+	for _, table := range tables {
+		// table_xinfo, unlike table_info, includes generated columns.
+		rows, err := db.QueryContext(ctx, `SELECT name FROM pragma_table_xinfo(?)`, table)
+		if err != nil {
+			return nil, fmt.Errorf("list columns of %s: %w", table, err)
+		}
+		var columns []string
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("scan column of %s: %w", table, err)
+			}
+			columns = append(columns, name)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("list columns of %s: %w", table, err)
+		}
+		schema[table] = columns
+	}
+	return schema, nil
+}
+
+// checkWritable inserts and deletes a sentinel row in table_modified, which
+// has no triggers, to prove the database file accepts writes.
+func checkWritable(ctx context.Context, db *sql.DB) error {
+	const sentinel = "_selftest"
+	if _, err := db.ExecContext(ctx, `INSERT OR REPLACE INTO table_modified (table_name, updated_at) VALUES (?, CURRENT_TIMESTAMP)`, sentinel); err != nil {
+		return fmt.Errorf("insert sentinel row: %w", err)
+	}
+	if _, err := db.ExecContext(ctx, `DELETE FROM table_modified WHERE table_name = ?`, sentinel); err != nil {
+		return fmt.Errorf("delete sentinel row: %w", err)
+	}
+	return nil
+}
+
+// logSelfTest writes the outcome of a self-test to the server log.
+func logSelfTest(result selfTestResult) {
+	for _, c := range result.Checks {
+		switch {
+		case !c.OK:
+			log.Printf("self-test: %s FAILED: %s", c.Name, c.Detail)
+		case c.Detail != "":
+			log.Printf("self-test: %s ok (%s)", c.Name, c.Detail)
+		}
+	}
+	if result.Ready {
+		log.Printf("self-test: ready")
+	} else {
+		log.Printf("warning: self-test failed; /readyz answers 503 until the problems above are fixed")
+	}
+}
+
+// readyzHandler serves GET /readyz: 200 with the self-test checks when the
+// server is ready, 503 when any failed.
+func (s *Server) readyzHandler(w http.ResponseWriter, r *http.Request) {
+	s.ready.mu.Lock()
+	if !s.ready.result.Ready {
+		s.ready.result = runSelfTest(r.Context(), s.db)
+	}
+	result := s.ready.result
+	s.ready.mu.Unlock()
+
+	status := http.StatusOK
+	if !result.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSONStatus(w, status, result)
+}
@@ -0,0 +1,142 @@
+package sbrain
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// sentryClient sends events to Sentry, or anything that speaks its envelope
+// protocol such as GlitchTip, over the DSN from SBRAIN_SENTRY_DSN.
+type sentryClient struct {
+	dsn      string
+	endpoint string
+	key      string
+	client   *http.Client
+}
+
+// sentryEvent is the part of Sentry's event payload sbrain fills in.
+type sentryEvent struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   string            `json:"timestamp"`
+	Level       string            `json:"level"`
+	Platform    string            `json:"platform"`
+	Logger      string            `json:"logger,omitempty"`
+	Message     string            `json:"message,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	Exception   *sentryExceptions `json:"exception,omitempty"`
+	Request     *sentryRequest    `json:"request,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Extra       map[string]any    `json:"extra,omitempty"`
+}
+
+type sentryExceptions struct {
+	Values []sentryException `json:"values"`
+}
+
+type sentryException struct {
+	Type       string            `json:"type"`
+	Value      string            `json:"value"`
+	Stacktrace *sentryStacktrace `json:"stacktrace,omitempty"`
+}
+
+type sentryStacktrace struct {
+	Frames []sentryFrame `json:"frames"`
+}
+
+// sentryFrame is one stack frame. Sentry lists frames oldest first.
+type sentryFrame struct {
+	Function string `json:"function"`
+	Filename string `json:"filename"`
+	Lineno   int    `json:"lineno"`
+	InApp    bool   `json:"in_app"`
+}
+
+type sentryRequest struct {
+	URL     string            `json:"url"`
+	Method  string            `json:"method"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// loadSentry reads SBRAIN_SENTRY_DSN, such as
+// https://<key>@o1.ingest.sentry.io/<project>. Forwarding is off (nil) when
+// it is unset.
+func loadSentry() (*sentryClient, error) {
+	dsn := strings.TrimSpace(os.Getenv("SBRAIN_SENTRY_DSN"))
+	if dsn == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(dsn)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.User == nil || u.User.Username() == "" {
+		return nil, fmt.Errorf("invalid SBRAIN_SENTRY_DSN: expected https://<key>@<host>/<project>")
+	}
+	path := strings.Trim(u.Path, "/")
+	prefix, project := "", path
+	if i := strings.LastIndex(path, "/"); i >= 0 {
+		prefix, project = "/"+path[:i], path[i+1:]
+	}
+	if project == "" {
+		return nil, fmt.Errorf("invalid SBRAIN_SENTRY_DSN: no project id")
+	}
+	return &sentryClient{
+		dsn:      dsn,
+		endpoint: fmt.Sprintf("%s://%s%s/api/%s/envelope/", u.Scheme, u.Host, prefix, project),
+		key:      u.User.Username(),
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// newSentryEvent starts an event with a fresh id, the current time and the
+// environment from SBRAIN_SENTRY_ENVIRONMENT.
+func newSentryEvent(level, message string) sentryEvent {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return sentryEvent{
+		EventID:     hex.EncodeToString(id),
+		Timestamp:   time.Now().UTC().Format(time.RFC3339Nano),
+		Level:       level,
+		Platform:    "go",
+		Logger:      "sbrain",
+		Message:     message,
+		Environment: os.Getenv("SBRAIN_SENTRY_ENVIRONMENT"),
+	}
+}
+
+// send posts event in an envelope, one event per envelope as the protocol
+// requires.
+func (c *sentryClient) send(ctx context.Context, event sentryEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	var body bytes.Buffer
+	header, _ := json.Marshal(map[string]string{"event_id": event.EventID, "dsn": c.dsn, "sent_at": time.Now().UTC().Format(time.RFC3339Nano)})
+	body.Write(header)
+	fmt.Fprintf(&body, "\n{\"type\":\"event\",\"length\":%d}\n", len(payload))
+	body.Write(payload)
+	body.WriteByte('\n')
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-sentry-envelope")
+	req.Header.Set("X-Sentry-Auth", fmt.Sprintf("Sentry sentry_version=7, sentry_client=sbrain/1.0, sentry_key=%s", c.key))
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("send to sentry: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("send to sentry: %s", resp.Status)
+	}
+	return nil
+}
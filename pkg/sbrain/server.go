@@ -0,0 +1,4604 @@
+// Package sbrain is the sbrain HTTP API as a library. New returns a Server
+// that is an http.Handler, so other Go programs can embed the second brain
+// in-process instead of running the sbrain binary next to them.
+package sbrain
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	_ "time/tzdata"
+
+	"sbrain/store"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Brain, Log and Timestamp are the store types the API reads and writes,
+// re-exported for embedders using Server.Brains and Server.Logs.
+type (
+	Brain     = store.Brain
+	Log       = store.Log
+	Timestamp = store.Timestamp
+)
+
+type brain = store.Brain
+
+type logEntry = store.Log
+
+type timestamp = store.Timestamp
+
+// Options configures a Server. Settings without a field here are read from
+// the SBRAIN_* environment variables documented in the README, exactly as
+// the sbrain binary does.
+type Options struct {
+	// DBPath is the SQLite database file. New opens it unless DB is set, and
+	// disk monitoring and SBRAIN_REPLICA_DIR use it either way. MemoryDB
+	// serves a fresh database held in memory.
+	DBPath string
+	// DB is an already open go-sqlite3 database to serve instead of opening
+	// DBPath. The caller keeps it and closes it after the Server.
+	DB *sql.DB
+	// Migrate applies the bundled migrations the database lacks before
+	// serving, recording them in schema_migrations as golang-migrate does.
+	Migrate bool
+	// RequireLogService rejects logs that name no service, neither in the
+	// log nor through the X-Sbrain-Service header or the API key. The sbrain
+	// binary sets it in production.
+	RequireLogService bool
+	// ReadOnly opens DBPath read-only, without replication, for commands
+	// that only read the database, such as a site export from a copy or a
+	// restored replica. It implies SkipSelfTest.
+	ReadOnly bool
+	// SkipSelfTest leaves out the startup self-test, whose write check
+	// touches the database, for commands that do not serve requests.
+	SkipSelfTest bool
+}
+
+// Server is the sbrain API. It serves requests as soon as New returns;
+// Start runs the background jobs.
+type Server struct {
+	db                *sql.DB
+	ownDB             bool
+	dbPath            string
+	brains            store.BrainStore
+	logs              store.LogStore
+	sqlite            *store.SQLite
+	auth              *authConfig
+	ready             readiness
+	disk              *diskMonitor
+	dedup             logDedup
+	sample            logSampling
+	logRetention      logRetention
+	requireLogService bool
+	scrub             scrubber
+	features          featureFlags
+	maintenance       maintenance
+	dbOperation       sync.Mutex
+	geo               *geoIP
+	llm               *llmClient
+	sentry            *sentryClient
+	forwarder         *errorForwarder
+	logForward        *logForwarder
+	timeouts          timeoutConfig
+	handler           http.Handler
+	// stop cancels the jobs Start launched, which jobs tracks.
+	stop context.CancelFunc
+	jobs sync.WaitGroup
+}
+
+// New opens the database, runs the startup self-test and returns the API.
+// A failed self-test is logged and reported by /readyz, not returned, so a
+// server with a drifted schema still starts and explains itself.
+func New(opts Options) (*Server, error) {
+	if opts.DB == nil && opts.DBPath == "" {
+		return nil, errors.New("sbrain: Options needs DBPath or DB")
+	}
+	s := &Server{db: opts.DB, dbPath: opts.DBPath, requireLogService: opts.RequireLogService}
+	if s.db == nil {
+		db, err := openDB(opts.DBPath, opts.ReadOnly)
+		if err != nil {
+			return nil, err
+		}
+		s.db, s.ownDB = db, true
+	} else if os.Getenv("SBRAIN_REPLICA_DIR") != "" {
+		return nil, errors.New("sbrain: SBRAIN_REPLICA_DIR needs New to open the database from DBPath")
+	}
+	fail := func(err error) (*Server, error) {
+		if s.ownDB {
+			s.db.Close()
+		}
+		return nil, err
+	}
+
+	if tz := os.Getenv("SBRAIN_TZ"); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return fail(fmt.Errorf("invalid SBRAIN_TZ %q: %w", tz, err))
+		}
+		store.SetDisplayLocation(loc)
+	}
+
+	auth, err := loadAuthConfig()
+	if err != nil {
+		return fail(fmt.Errorf("auth config: %w", err))
+	}
+	s.auth = auth
+
+	// An in-memory database starts empty every time, so it always needs
+	// the schema.
+	if opts.ReadOnly && opts.Migrate {
+		return fail(errors.New("sbrain: a read-only database cannot be migrated"))
+	}
+	if opts.Migrate || (opts.DB == nil && opts.DBPath == MemoryDB) {
+		if err := applyMigrations(context.Background(), s.db); err != nil {
+			return fail(err)
+		}
+	}
+
+	// The self-test runs before the store prepares its statements, so schema
+	// drift that stops those is explained in the log rather than only as a
+	// prepare error.
+	if !opts.ReadOnly && !opts.SkipSelfTest {
+		s.ready.result = runSelfTest(context.Background(), s.db)
+		logSelfTest(s.ready.result)
+	}
+
+	sqlStore, err := store.NewSQLite(s.db)
+	if err != nil {
+		return fail(fmt.Errorf("open store: %w", err))
+	}
+	// Requests from project-bound API keys carry their project in the
+	// context, which the scoped store enforces.
+	scoped := store.ProjectScoped{Brains: sqlStore, Logs: sqlStore}
+	s.sqlite, s.brains, s.logs = sqlStore, scoped, scoped
+
+	if s.dedup, err = loadLogDedup(); err != nil {
+		sqlStore.Close()
+		return fail(err)
+	}
+	if s.sample, err = loadLogSampling(); err != nil {
+		sqlStore.Close()
+		return fail(err)
+	}
+	if s.logRetention, err = loadLogRetention(); err != nil {
+		sqlStore.Close()
+		return fail(err)
+	}
+	s.llm = loadLLM()
+	if s.geo, err = loadGeoIP(); err != nil {
+		sqlStore.Close()
+		return fail(err)
+	}
+	// Scrub rules live in the database; without the table (a failed
+	// self-test) logs are stored unscrubbed, so that is logged loudly.
+	if err := s.reloadScrubRules(); err != nil {
+		log.Printf("warning: log scrubbing disabled: %v", err)
+	}
+	if s.features.env, err = loadFeatureFlagEnv(); err != nil {
+		sqlStore.Close()
+		return fail(err)
+	}
+	// Without the table, flags follow SBRAIN_FLAGS and their defaults.
+	if err := s.reloadFeatureFlags(); err != nil {
+		log.Printf("warning: feature flag overrides not loaded: %v", err)
+	}
+	if s.disk, err = newDiskMonitor(s.dbPath); err != nil {
+		sqlStore.Close()
+		return fail(err)
+	}
+	if s.timeouts, err = loadTimeouts(); err != nil {
+		sqlStore.Close()
+		return fail(err)
+	}
+	if s.sentry, err = loadSentry(); err != nil {
+		sqlStore.Close()
+		return fail(err)
+	}
+	s.forwarder = loadErrorForwarder(s.sentry, func() bool { return s.features.enabled(featureWebhooks) })
+	if s.logForward, err = loadLogForwarder(); err != nil {
+		sqlStore.Close()
+		return fail(err)
+	}
+
+	router := newVersionedRouter(s.routes(), s.versionedRoutes())
+	s.handler = requestIDMiddleware(apiVersionMiddleware(router, translateResponses(envelopeMiddleware(s.recoverPanics(s.requestTimeout(captureCORS(s.maintenanceGate(s.authMiddleware(translateRequestBodies(s.disk.protectWrites(router)))))))))))
+	return s, nil
+}
+
+// openDB opens the database file at dbPath, through the replicating driver
+// when SBRAIN_REPLICA_DIR is set, and logs whether the file had to be
+// created so a lost volume is noticed. A read-only database must exist and
+// is never replicated.
+func openDB(dbPath string, readOnly bool) (*sql.DB, error) {
+	if dbPath == MemoryDB {
+		return openMemoryDB()
+	}
+	if readOnly {
+		db, err := sql.Open("sqlite3", "file:"+dbPath+"?mode=ro")
+		if err != nil {
+			return nil, fmt.Errorf("open db: %w", err)
+		}
+		if err := db.Ping(); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("open %s read-only: %w", dbPath, err)
+		}
+		return db, nil
+	}
+	absDBPath, err := filepath.Abs(dbPath)
+	if err != nil {
+		log.Printf("warning: could not resolve absolute DB path for %q: %v", dbPath, err)
+		absDBPath = dbPath
+	}
+	log.Printf("database path configured: %q (resolved: %q)", dbPath, absDBPath)
+
+	dbWasMissing := false
+	info, err := os.Stat(absDBPath)
+	switch {
+	case err == nil:
+		log.Printf("database file exists at startup: %q (%d bytes)", absDBPath, info.Size())
+	case os.IsNotExist(err):
+		dbWasMissing = true
+		log.Printf("warning: database file does not exist at startup: %q (a new database may be created)", absDBPath)
+	default:
+		log.Printf("warning: unable to inspect database file %q: %v", absDBPath, err)
+	}
+
+	driverName := "sqlite3"
+	if os.Getenv("SBRAIN_REPLICA_DIR") != "" {
+		driverName = replicatedDriverName
+	}
+	db, err := sql.Open(driverName, dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("open db: %w", err)
+	}
+	if err := configureDBPool(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("ping db: %w", err)
+	}
+	if dbWasMissing {
+		if info, err := os.Stat(absDBPath); err == nil {
+			log.Printf("warning: database file was created during startup: %q (%d bytes)", absDBPath, info.Size())
+		}
+	}
+	return db, nil
+}
+
+// ServeHTTP serves the API, including authentication.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
+// Start launches the background jobs: disk sampling, digests, trash
+// purging, alert evaluation, scheduled brains, reminders, and log
+// retention, replication, the syslog listener, and error and log
+// forwarding when configured. They run until ctx is done or Close is
+// called.
+func (s *Server) Start(ctx context.Context) error {
+	ctx, s.stop = context.WithCancel(ctx)
+	if dir := os.Getenv("SBRAIN_REPLICA_DIR"); dir != "" {
+		rep, err := newReplicator(s.db, s.dbPath, dir)
+		if err != nil {
+			return err
+		}
+		s.spawn(ctx, rep.run)
+	}
+	if addr := os.Getenv("SBRAIN_SYSLOG_ADDR"); addr != "" {
+		if err := s.startSyslogListener(ctx, addr); err != nil {
+			return err
+		}
+	}
+	s.spawn(ctx, s.disk.run)
+	s.spawn(ctx, s.runDigestScheduler)
+	s.spawn(ctx, s.runTrashPurger)
+	if s.logRetention.enabled() {
+		s.spawn(ctx, s.runLogRetention)
+	}
+	s.spawn(ctx, s.runAlertEvaluator)
+	s.spawn(ctx, s.runBrainScheduler)
+	s.spawn(ctx, s.runMonitorScheduler)
+	if webhook, email := reminderTargets(); webhook != "" || email != "" {
+		s.spawn(ctx, s.runReminderNotifier)
+	}
+	if s.forwarder != nil {
+		s.spawn(ctx, s.forwarder.run)
+	}
+	s.logForward.start(ctx, &s.jobs)
+	return nil
+}
+
+// spawn runs job in its own goroutine, which Close waits for.
+func (s *Server) spawn(ctx context.Context, job func(context.Context)) {
+	s.jobs.Add(1)
+	go func() {
+		defer s.jobs.Done()
+		job(ctx)
+	}()
+}
+
+// Brains returns the brain store, for reading and writing records without
+// going through HTTP.
+func (s *Server) Brains() store.BrainStore {
+	return s.brains
+}
+
+// Logs returns the log store.
+func (s *Server) Logs() store.LogStore {
+	return s.logs
+}
+
+// Close stops the background jobs and waits for them to return, then
+// releases the store's prepared statements and, when New opened it, the
+// database.
+func (s *Server) Close() error {
+	if s.stop != nil {
+		s.stop()
+	}
+	s.jobs.Wait()
+	err := s.sqlite.Close()
+	if s.ownDB {
+		err = errors.Join(err, s.db.Close())
+	}
+	return err
+}
+
+func (s *Server) openAPISpecHandler(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" || format == "json" {
+		writeJSON(w, http.StatusOK, openAPISpec())
+		return
+	}
+	var buf bytes.Buffer
+	if err := WriteOpenAPI(&buf, format); err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write(buf.Bytes())
+}
+
+// WriteOpenAPI writes the API's OpenAPI document as "json" or "yaml", for
+// generating clients without a running server.
+func WriteOpenAPI(w io.Writer, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(openAPISpec())
+	case "yaml":
+		return encodeYAML(w, openAPISpec())
+	}
+	return fmt.Errorf("invalid format %q: expected json or yaml", format)
+}
+
+func openAPISpec() map[string]any {
+	spec := map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "sbrain API",
+			"version":     "1.0.0",
+			"description": "Responses are bare JSON. Add ?envelope=true, or send Accept: " + envelopeMediaType + ", to get every JSON response wrapped as an Envelope with the request id, timing and pagination details. Paths are served by API v1; prefix them with /v2, or send Accept: application/vnd.sbrain.v2+json, for v2, where empty lists are [], every error is an Error object and every JSON response is an Envelope. Every JSON body can also be sent as application/yaml or application/msgpack, and every JSON response requested in either with Accept.",
+		},
+		"paths": map[string]any{
+			"/": map[string]any{
+				"get": map[string]any{
+					"summary":     "Service status, or a landing page for browsers",
+					"description": "Answers {\"status\":\"ok\"} unless the Accept header asks for text/html, as browsers do; then, with the ui flag on, a landing page linking to the docs.",
+					"operationId": "getStatus",
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "The service is up",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{"$ref": "#/components/schemas/Status"},
+								},
+								"text/html": map[string]any{
+									"schema": map[string]any{"type": "string"},
+								},
+							},
+						},
+					},
+				},
+			},
+			"/openapi": map[string]any{
+				"get": map[string]any{
+					"summary":     "Get OpenAPI schema for the service",
+					"operationId": "getOpenAPI",
+					"parameters": []map[string]any{
+						{"name": "format", "in": "query", "description": "yaml for the document as YAML, e.g. for openapi-generator", "schema": map[string]any{"type": "string", "enum": []string{"json", "yaml"}, "default": "json"}},
+					},
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "OpenAPI document",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{"type": "object"},
+								},
+								"application/yaml": map[string]any{
+									"schema": map[string]any{"type": "string"},
+								},
+							},
+						},
+					},
+				},
+			},
+			"/docs": map[string]any{
+				"get": map[string]any{
+					"summary":     "Interactive API documentation (Swagger UI)",
+					"operationId": "getDocs",
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "HTML documentation page",
+							"content": map[string]any{
+								"text/html": map[string]any{
+									"schema": map[string]any{"type": "string"},
+								},
+							},
+						},
+					},
+				},
+			},
+			"/favicon.ico": map[string]any{
+				"get": faviconOperation("getFaviconICO", "image/x-icon"),
+			},
+			"/favicon.svg": map[string]any{
+				"get": faviconOperation("getFaviconSVG", "image/svg+xml"),
+			},
+			"/brain": map[string]any{
+				"get": map[string]any{
+					"summary":     "List brain records, pinned first",
+					"operationId": "listBrains",
+					"parameters":  append(brainFilterParameters(), ifModifiedSinceParameter()),
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "List of brain records",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{
+										"type":  "array",
+										"items": map[string]any{"$ref": "#/components/schemas/Brain"},
+									},
+								},
+								"application/x-ndjson": map[string]any{
+									"schema": map[string]any{"$ref": "#/components/schemas/Brain"},
+								},
+							},
+						},
+						"304": map[string]any{"description": "Not modified since If-Modified-Since"},
+					},
+				},
+				"post": map[string]any{
+					"summary":     "Create a brain record",
+					"operationId": "createBrain",
+					"parameters": []map[string]any{
+						{"name": "template", "in": "query", "description": "Name of a template to pre-fill empty fields from", "schema": map[string]any{"type": "string"}},
+					},
+					"requestBody": map[string]any{
+						"required": true,
+						"content": map[string]any{
+							"application/json": map[string]any{
+								"schema": map[string]any{"$ref": "#/components/schemas/BrainCreate"},
+							},
+							"application/x-www-form-urlencoded": map[string]any{
+								"schema": map[string]any{"$ref": "#/components/schemas/BrainCreate"},
+							},
+							"multipart/form-data": map[string]any{
+								"schema": map[string]any{"$ref": "#/components/schemas/BrainCreate"},
+							},
+						},
+					},
+					"responses": map[string]any{
+						"201": map[string]any{
+							"description": "Created brain record; one created without tags carries suggested_tags",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{
+										"allOf": []map[string]any{
+											{"$ref": "#/components/schemas/Brain"},
+											{
+												"type": "object",
+												"properties": map[string]any{
+													"suggested_tags": map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+												},
+											},
+										},
+									},
+								},
+							},
+						},
+						"400": map[string]any{"description": "Bad request"},
+						"500": map[string]any{"description": "Server error"},
+					},
+				},
+				"patch": map[string]any{
+					"summary":     "Change every brain record matching the list filters",
+					"description": "Applies the changes in one transaction; at least one filter is required. With dry_run=true nothing is changed and the response says what would be.",
+					"operationId": "batchUpdateBrains",
+					"parameters": append(brainFilterParameters(),
+						map[string]any{"name": "dry_run", "in": "query", "schema": map[string]any{"type": "boolean"}}),
+					"requestBody": map[string]any{
+						"required": true,
+						"content": map[string]any{
+							"application/json": map[string]any{
+								"schema": map[string]any{
+									"type": "object",
+									"properties": map[string]any{
+										"add_tags":    map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+										"remove_tags": map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+										"project":     map[string]any{"type": "string"},
+										"archived":    map[string]any{"type": "boolean"},
+									},
+								},
+							},
+						},
+					},
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Records matched and changed",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{
+										"type": "object",
+										"properties": map[string]any{
+											"dry_run": map[string]any{"type": "boolean"},
+											"matched": map[string]any{"type": "integer"},
+											"changed": map[string]any{"type": "integer"},
+											"ids":     map[string]any{"type": "array", "items": map[string]any{"type": "integer", "format": "int64"}},
+										},
+									},
+								},
+							},
+						},
+						"400": map[string]any{"description": "No filter, no changes, or a record would become invalid"},
+					},
+				},
+			},
+			"/brain/{id}": map[string]any{
+				"parameters": []map[string]any{
+					{
+						"name":     "id",
+						"in":       "path",
+						"required": true,
+						"schema": map[string]any{
+							"type":   "integer",
+							"format": "int64",
+						},
+					},
+				},
+				"get": map[string]any{
+					"summary":     "Get a brain record by ID",
+					"operationId": "getBrainById",
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Brain record with its linked issues",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{"$ref": "#/components/schemas/BrainWithIssues"},
+								},
+							},
+						},
+						"400": map[string]any{"description": "Invalid ID"},
+						"404": map[string]any{"description": "Not found"},
+						"500": map[string]any{"description": "Server error"},
+					},
+				},
+				"put": map[string]any{
+					"summary":     "Replace the editable fields of a brain record",
+					"operationId": "updateBrain",
+					"requestBody": map[string]any{
+						"required": true,
+						"content": map[string]any{
+							"application/json": map[string]any{
+								"schema": map[string]any{"$ref": "#/components/schemas/BrainUpdate"},
+							},
+						},
+					},
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Updated brain record",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{"$ref": "#/components/schemas/Brain"},
+								},
+							},
+						},
+						"400": map[string]any{"description": "Bad request"},
+						"404": map[string]any{"description": "Not found"},
+						"409": map[string]any{"description": "Stale version; the error carries the current record"},
+						"428": map[string]any{"description": "Missing version"},
+						"500": map[string]any{"description": "Server error"},
+					},
+				},
+				"delete": map[string]any{
+					"summary":     "Move a brain record to the trash",
+					"operationId": "deleteBrain",
+					"responses": map[string]any{
+						"204": map[string]any{"description": "Moved to trash"},
+						"400": map[string]any{"description": "Invalid ID"},
+						"404": map[string]any{"description": "Not found"},
+						"500": map[string]any{"description": "Server error"},
+					},
+				},
+			},
+			"/logs": map[string]any{
+				"get": map[string]any{
+					"summary":     "List all logs",
+					"operationId": "listLogs",
+					"parameters":  append(logFilterParameters(), ifModifiedSinceParameter()),
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "List of logs",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{
+										"type":  "array",
+										"items": map[string]any{"$ref": "#/components/schemas/LogEntry"},
+									},
+								},
+								"application/x-ndjson": map[string]any{
+									"schema": map[string]any{"$ref": "#/components/schemas/LogEntry"},
+								},
+							},
+						},
+						"304": map[string]any{"description": "Not modified since If-Modified-Since"},
+					},
+				},
+				"post": map[string]any{
+					"summary":     "Create a log",
+					"operationId": "createLog",
+					"requestBody": map[string]any{
+						"required": true,
+						"content": map[string]any{
+							"application/json": map[string]any{
+								"schema": map[string]any{"$ref": "#/components/schemas/LogCreate"},
+							},
+							"application/x-www-form-urlencoded": map[string]any{
+								"schema": map[string]any{"$ref": "#/components/schemas/LogCreate"},
+							},
+							"multipart/form-data": map[string]any{
+								"schema": map[string]any{"$ref": "#/components/schemas/LogCreate"},
+							},
+						},
+					},
+					"responses": map[string]any{
+						"201": map[string]any{
+							"description": "Created log, or the earlier log it was collapsed into",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{"$ref": "#/components/schemas/LogEntry"},
+								},
+							},
+						},
+						"202": map[string]any{
+							"description": "Accepted but not stored: dropped by log sampling",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{
+										"type": "object",
+										"properties": map[string]any{
+											"stored": map[string]any{"type": "boolean"},
+											"reason": map[string]any{"type": "string"},
+										},
+									},
+								},
+							},
+						},
+						"400": map[string]any{"description": "Bad request"},
+						"500": map[string]any{"description": "Server error"},
+					},
+				},
+			},
+			"/logs/{id}": map[string]any{
+				"parameters": []map[string]any{
+					{
+						"name":     "id",
+						"in":       "path",
+						"required": true,
+						"schema": map[string]any{
+							"type":   "integer",
+							"format": "int64",
+						},
+					},
+				},
+				"get": map[string]any{
+					"summary":     "Get a log by ID",
+					"operationId": "getLogById",
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Log entry",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{"$ref": "#/components/schemas/LogEntry"},
+								},
+							},
+						},
+						"400": map[string]any{"description": "Invalid ID"},
+						"404": map[string]any{"description": "Not found"},
+						"500": map[string]any{"description": "Server error"},
+					},
+				},
+				"delete": map[string]any{
+					"summary":     "Delete a log",
+					"operationId": "deleteLog",
+					"responses": map[string]any{
+						"204": map[string]any{"description": "Deleted"},
+						"400": map[string]any{"description": "Invalid ID"},
+						"404": map[string]any{"description": "Not found"},
+						"500": map[string]any{"description": "Server error"},
+					},
+				},
+			},
+			"/digest": map[string]any{
+				"get": map[string]any{
+					"summary":     "Daily digest of brain entries and error logs",
+					"operationId": "getDailyDigest",
+					"parameters": []map[string]any{
+						{"name": "date", "in": "query", "schema": map[string]any{"type": "string", "format": "date"}, "description": "Day to summarize (YYYY-MM-DD, UTC); defaults to today"},
+						{"name": "group", "in": "query", "schema": map[string]any{"type": "string", "enum": []string{"project"}}},
+						{"name": "format", "in": "query", "schema": map[string]any{"type": "string", "enum": []string{"json", "markdown"}}},
+					},
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Digest",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{"$ref": "#/components/schemas/Digest"},
+								},
+								"text/markdown": map[string]any{
+									"schema": map[string]any{"type": "string"},
+								},
+							},
+						},
+						"400": map[string]any{"description": "Invalid parameters"},
+						"500": map[string]any{"description": "Server error"},
+					},
+				},
+			},
+			"/digest/weekly": map[string]any{
+				"get": map[string]any{
+					"summary":     "Weekly digest (Monday to Sunday) of brain entries and error logs",
+					"operationId": "getWeeklyDigest",
+					"parameters": []map[string]any{
+						{"name": "date", "in": "query", "schema": map[string]any{"type": "string", "format": "date"}, "description": "Any day within the week to summarize; defaults to today"},
+						{"name": "group", "in": "query", "schema": map[string]any{"type": "string", "enum": []string{"project"}}},
+						{"name": "format", "in": "query", "schema": map[string]any{"type": "string", "enum": []string{"json", "markdown"}}},
+					},
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Digest",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{"$ref": "#/components/schemas/Digest"},
+								},
+								"text/markdown": map[string]any{
+									"schema": map[string]any{"type": "string"},
+								},
+							},
+						},
+						"400": map[string]any{"description": "Invalid parameters"},
+						"500": map[string]any{"description": "Server error"},
+					},
+				},
+			},
+			"/admin/digests/destinations": map[string]any{
+				"get": map[string]any{
+					"summary":     "List digest delivery destinations",
+					"operationId": "listDigestDestinations",
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "List of destinations",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{
+										"type":  "array",
+										"items": map[string]any{"$ref": "#/components/schemas/DigestDestination"},
+									},
+								},
+							},
+						},
+						"500": map[string]any{"description": "Server error"},
+					},
+				},
+				"post": map[string]any{
+					"summary":     "Create a digest delivery destination",
+					"operationId": "createDigestDestination",
+					"requestBody": map[string]any{
+						"required": true,
+						"content": map[string]any{
+							"application/json": map[string]any{
+								"schema": map[string]any{"$ref": "#/components/schemas/DigestDestinationCreate"},
+							},
+						},
+					},
+					"responses": map[string]any{
+						"201": map[string]any{
+							"description": "Created destination",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{"$ref": "#/components/schemas/DigestDestination"},
+								},
+							},
+						},
+						"400": map[string]any{"description": "Bad request"},
+						"500": map[string]any{"description": "Server error"},
+					},
+				},
+			},
+			"/admin/digests/test": map[string]any{
+				"post": map[string]any{
+					"summary":     "Send today's digest immediately",
+					"operationId": "testDigestDelivery",
+					"parameters": []map[string]any{
+						{"name": "destination_id", "in": "query", "schema": map[string]any{"type": "integer", "format": "int64"}},
+					},
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Delivery result per destination",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{
+										"type": "array",
+										"items": map[string]any{
+											"type": "object",
+											"properties": map[string]any{
+												"destination_id": map[string]any{"type": "integer", "format": "int64"},
+												"kind":           map[string]any{"type": "string"},
+												"target":         map[string]any{"type": "string"},
+												"ok":             map[string]any{"type": "boolean"},
+												"error":          map[string]any{"type": "string"},
+											},
+										},
+									},
+								},
+							},
+						},
+						"400": map[string]any{"description": "Invalid destination_id"},
+						"404": map[string]any{"description": "Destination not found"},
+						"500": map[string]any{"description": "Server error"},
+					},
+				},
+			},
+			"/integrations/slack/command": map[string]any{
+				"post": map[string]any{
+					"summary":     "Slack slash command receiver (\"remember <note> [#project]\")",
+					"operationId": "slackCommand",
+					"parameters": []map[string]any{
+						{"name": "X-Slack-Signature", "in": "header", "required": true, "schema": map[string]any{"type": "string"}},
+						{"name": "X-Slack-Request-Timestamp", "in": "header", "required": true, "schema": map[string]any{"type": "string"}},
+					},
+					"requestBody": map[string]any{
+						"required": true,
+						"content": map[string]any{
+							"application/x-www-form-urlencoded": map[string]any{
+								"schema": map[string]any{
+									"type": "object",
+									"properties": map[string]any{
+										"command":   map[string]any{"type": "string"},
+										"text":      map[string]any{"type": "string"},
+										"user_name": map[string]any{"type": "string"},
+									},
+								},
+							},
+						},
+					},
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Slack message reply",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{"type": "object"},
+								},
+							},
+						},
+						"401": map[string]any{"description": "Invalid or missing signature"},
+						"404": map[string]any{"description": "Slack integration not configured"},
+					},
+				},
+			},
+			"/integrations/email/{provider}": map[string]any{
+				"parameters": []map[string]any{
+					{"name": "provider", "in": "path", "required": true, "schema": map[string]any{"type": "string", "enum": []string{"mailgun", "sendgrid", "postmark"}}},
+					{"name": "token", "in": "query", "required": true, "schema": map[string]any{"type": "string"}},
+				},
+				"post": map[string]any{
+					"summary":     "Inbound email webhook; stores the email as a brain record",
+					"operationId": "ingestEmail",
+					"requestBody": map[string]any{
+						"required": true,
+						"content": map[string]any{
+							"multipart/form-data": map[string]any{
+								"schema": map[string]any{"type": "object"},
+							},
+							"application/json": map[string]any{
+								"schema": map[string]any{"type": "object"},
+							},
+						},
+					},
+					"responses": map[string]any{
+						"201": map[string]any{
+							"description": "Created brain record and stored attachments",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{
+										"type": "object",
+										"properties": map[string]any{
+											"brain": map[string]any{"$ref": "#/components/schemas/Brain"},
+											"attachments": map[string]any{
+												"type":  "array",
+												"items": map[string]any{"$ref": "#/components/schemas/Attachment"},
+											},
+										},
+									},
+								},
+							},
+						},
+						"400": map[string]any{"description": "Bad request"},
+						"401": map[string]any{"description": "Invalid token"},
+						"404": map[string]any{"description": "Unknown provider or ingestion not configured"},
+						"500": map[string]any{"description": "Server error"},
+					},
+				},
+			},
+			"/integrations/git/webhook/{provider}": map[string]any{
+				"parameters": []map[string]any{
+					{"name": "provider", "in": "path", "required": true, "schema": map[string]any{"type": "string", "enum": []string{"github", "gitlab", "gitea"}}},
+				},
+				"post": map[string]any{
+					"summary":     "GitHub, GitLab or Gitea webhook; adds pushed and merged commits to the daily records",
+					"description": "Push events, and pull or merge requests when they are merged, add their commits to the record of the repository's project for the day each was made, as POST /integrations/git/daily does. The project is the one SBRAIN_GIT_REPOS gives the repository, or its name. Deliveries are verified against SBRAIN_GITHUB_WEBHOOK_SECRET (X-Hub-Signature-256), SBRAIN_GITEA_WEBHOOK_SECRET (X-Gitea-Signature) or SBRAIN_GITLAB_WEBHOOK_TOKEN (X-Gitlab-Token); other events are acknowledged and ignored.",
+					"operationId": "gitWebhook",
+					"requestBody": map[string]any{
+						"required": true,
+						"content": map[string]any{
+							"application/json": map[string]any{"schema": map[string]any{"type": "object"}},
+						},
+					},
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "The daily records written, or ignored",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{
+										"type": "object",
+										"properties": map[string]any{
+											"event":   map[string]any{"type": "string"},
+											"ignored": map[string]any{"type": "boolean"},
+											"records": map[string]any{"type": "array", "items": map[string]any{"type": "object"}},
+										},
+									},
+								},
+							},
+						},
+						"400": map[string]any{"description": "Malformed payload"},
+						"401": map[string]any{"description": "Invalid signature or token"},
+						"404": map[string]any{"description": "Unknown provider or webhooks not configured"},
+					},
+				},
+			},
+			"/attachments": map[string]any{
+				"get": map[string]any{
+					"summary":     "List attachments for a brain record",
+					"operationId": "listAttachments",
+					"parameters": []map[string]any{
+						{"name": "brain_id", "in": "query", "required": true, "schema": map[string]any{"type": "integer", "format": "int64"}},
+					},
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Attachment metadata",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{
+										"type":  "array",
+										"items": map[string]any{"$ref": "#/components/schemas/Attachment"},
+									},
+								},
+							},
+						},
+						"400": map[string]any{"description": "Missing brain_id"},
+						"500": map[string]any{"description": "Server error"},
+					},
+				},
+			},
+			"/attachments/{id}": map[string]any{
+				"parameters": []map[string]any{
+					{
+						"name":     "id",
+						"in":       "path",
+						"required": true,
+						"schema": map[string]any{
+							"type":   "integer",
+							"format": "int64",
+						},
+					},
+				},
+				"get": map[string]any{
+					"summary":     "Download an attachment",
+					"operationId": "getAttachment",
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Raw attachment bytes",
+							"content": map[string]any{
+								"application/octet-stream": map[string]any{
+									"schema": map[string]any{"type": "string", "format": "binary"},
+								},
+							},
+						},
+						"400": map[string]any{"description": "Invalid ID"},
+						"404": map[string]any{"description": "Not found"},
+						"500": map[string]any{"description": "Server error"},
+					},
+				},
+			},
+			"/export/markdown": map[string]any{
+				"get": map[string]any{
+					"summary":     "Export all brain records as a zip of Obsidian-compatible markdown files",
+					"operationId": "exportMarkdown",
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Zip archive with one markdown file per record, grouped by project",
+							"content": map[string]any{
+								"application/zip": map[string]any{
+									"schema": map[string]any{"type": "string", "format": "binary"},
+								},
+							},
+						},
+						"500": map[string]any{"description": "Server error"},
+					},
+				},
+			},
+			"/export/pdf": map[string]any{
+				"get": map[string]any{
+					"summary":     "Export the brain records matching the list filters as one PDF",
+					"description": "Records are in the order they were written, each starting on a new page, their context rendered from markdown. At most 500 records.",
+					"operationId": "exportPDF",
+					"parameters":  brainFilterParameters(),
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "PDF document",
+							"content": map[string]any{
+								"application/pdf": map[string]any{"schema": map[string]any{"type": "string", "format": "binary"}},
+							},
+						},
+						"400": map[string]any{"description": "Invalid filter, or more than 500 records match"},
+						"404": map[string]any{"description": "No records match"},
+					},
+				},
+			},
+			"/export/site": map[string]any{
+				"get": map[string]any{
+					"summary":     "Export the brain records matching the list filters as a static HTML site",
+					"description": "A zip of index.html, a page per record, project and tag, and a search index the pages query in the browser. Links are relative, so it can be unpacked onto any static host as a read-only mirror. `sbrain export-site` writes the same files to a directory.",
+					"operationId": "exportSite",
+					"parameters":  brainFilterParameters(),
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Zip of the site",
+							"content": map[string]any{
+								"application/zip": map[string]any{"schema": map[string]any{"type": "string", "format": "binary"}},
+							},
+						},
+						"400": map[string]any{"description": "Invalid filter"},
+					},
+				},
+			},
+			"/import/markdown": map[string]any{
+				"post": map[string]any{
+					"summary":     "Import a zip of markdown files with front matter as brain records",
+					"operationId": "importMarkdown",
+					"requestBody": map[string]any{
+						"required": true,
+						"content": map[string]any{
+							"application/zip": map[string]any{
+								"schema": map[string]any{"type": "string", "format": "binary"},
+							},
+							"multipart/form-data": map[string]any{
+								"schema": map[string]any{
+									"type": "object",
+									"properties": map[string]any{
+										"file": map[string]any{"type": "string", "format": "binary"},
+									},
+								},
+							},
+						},
+					},
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Import summary",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{
+										"type": "object",
+										"properties": map[string]any{
+											"created": map[string]any{"type": "array", "items": map[string]any{"type": "integer", "format": "int64"}},
+											"skipped": map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+											"errors":  map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+										},
+									},
+								},
+							},
+						},
+						"400": map[string]any{"description": "Bad request"},
+						"500": map[string]any{"description": "Server error"},
+					},
+				},
+			},
+			"/import/readwise": map[string]any{
+				"post": readingImportOperation("Import Readwise highlights as brain records",
+					"Accepts the Readwise CSV export or the JSON of its export API and creates one record per book or article, with its highlights quoted, tagged readwise. Sources already in the brain are skipped.",
+					"importReadwise", "text/csv", "application/json"),
+			},
+			"/import/pocket": map[string]any{
+				"post": readingImportOperation("Import Pocket saves as brain records",
+					"Accepts Pocket's ril_export.html, its CSV export or the zip it comes in, and creates one record per saved page, tagged pocket. URLs already in the brain are skipped.",
+					"importPocket", "text/html", "text/csv", "application/zip"),
+			},
+			"/logs/export": map[string]any{
+				"get": map[string]any{
+					"summary":     "Export logs as CSV using the list filters",
+					"operationId": "exportLogs",
+					"parameters": append([]map[string]any{
+						{"name": "format", "in": "query", "schema": map[string]any{"type": "string", "enum": []string{"csv"}, "default": "csv"}},
+					}, logFilterParameters()...),
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "CSV stream",
+							"content": map[string]any{
+								"text/csv": map[string]any{
+									"schema": map[string]any{"type": "string"},
+								},
+							},
+						},
+						"400": map[string]any{"description": "Invalid filter"},
+						"500": map[string]any{"description": "Server error"},
+					},
+				},
+			},
+			"/logs/stats": map[string]any{
+				"get": map[string]any{
+					"summary":     "Aggregate log counts and response-time percentiles",
+					"operationId": "getLogStats",
+					"parameters": append([]map[string]any{
+						{"name": "bucket", "in": "query", "schema": map[string]any{"type": "string", "enum": []string{"hour", "day"}, "default": "hour"}},
+					}, logFilterParameters()...),
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Log statistics",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{"$ref": "#/components/schemas/LogStats"},
+								},
+							},
+						},
+						"400": map[string]any{"description": "Invalid filter"},
+						"500": map[string]any{"description": "Server error"},
+					},
+				},
+			},
+			"/brain/stats": map[string]any{
+				"get": map[string]any{
+					"summary":     "Knowledge base statistics",
+					"operationId": "getBrainStats",
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Brain statistics",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{"$ref": "#/components/schemas/BrainStats"},
+								},
+							},
+						},
+						"500": map[string]any{"description": "Server error"},
+					},
+				},
+			},
+			"/brain/calendar": map[string]any{
+				"get": map[string]any{
+					"summary":     "Records written on each day of a month",
+					"description": "Every day of the month is listed, with a count and the records created that day in SBRAIN_TZ, so the result can be drawn as a heatmap. The brain list filters apply.",
+					"operationId": "getBrainCalendar",
+					"parameters": append([]map[string]any{
+						{"name": "month", "in": "query", "description": "YYYY-MM; defaults to this month", "schema": map[string]any{"type": "string", "example": "2024-06"}},
+					}, brainFilterParameters()...),
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Days of the month",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{
+										"type": "object",
+										"properties": map[string]any{
+											"month":    map[string]any{"type": "string"},
+											"previous": map[string]any{"type": "string", "description": "The month before, for navigation"},
+											"next":     map[string]any{"type": "string", "description": "The month after"},
+											"total":    map[string]any{"type": "integer"},
+											"days": map[string]any{
+												"type": "array",
+												"items": map[string]any{
+													"type": "object",
+													"properties": map[string]any{
+														"date":    map[string]any{"type": "string", "format": "date"},
+														"weekday": map[string]any{"type": "string"},
+														"count":   map[string]any{"type": "integer"},
+														"entries": map[string]any{
+															"type": "array",
+															"items": map[string]any{
+																"type": "object",
+																"properties": map[string]any{
+																	"id":      map[string]any{"type": "integer", "format": "int64"},
+																	"title":   map[string]any{"type": "string"},
+																	"project": map[string]any{"type": "string"},
+																	"tags":    map[string]any{"type": "string"},
+																},
+															},
+														},
+													},
+												},
+											},
+										},
+									},
+								},
+							},
+						},
+						"400": map[string]any{"description": "Invalid month or filter"},
+					},
+				},
+			},
+			"/brain/on": map[string]any{
+				"get": map[string]any{
+					"summary":     "Records written on one day",
+					"description": "The records created on the date in SBRAIN_TZ, oldest first. The brain list filters apply.",
+					"operationId": "getBrainsOnDay",
+					"parameters": append([]map[string]any{
+						{"name": "date", "in": "query", "required": true, "schema": map[string]any{"type": "string", "format": "date", "example": "2024-06-12"}},
+					}, brainFilterParameters()...),
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "The day's records",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{
+										"type": "object",
+										"properties": map[string]any{
+											"date":    map[string]any{"type": "string", "format": "date"},
+											"weekday": map[string]any{"type": "string"},
+											"count":   map[string]any{"type": "integer"},
+											"entries": map[string]any{"type": "array", "items": map[string]any{"$ref": "#/components/schemas/Brain"}},
+										},
+									},
+								},
+							},
+						},
+						"400": map[string]any{"description": "Invalid date or filter"},
+					},
+				},
+			},
+			"/brain/random": map[string]any{
+				"get": map[string]any{
+					"summary":     "A random brain record",
+					"description": "Picks one record at random from those matching the brain list filters.",
+					"operationId": "getRandomBrain",
+					"parameters": append([]map[string]any{
+						{"name": "older_than_days", "in": "query", "description": "Only records written at least this many days ago", "schema": map[string]any{"type": "integer", "minimum": 0}},
+					}, brainFilterParameters()...),
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Brain record",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{"$ref": "#/components/schemas/Brain"},
+								},
+							},
+						},
+						"400": map[string]any{"description": "Invalid filter"},
+						"404": map[string]any{"description": "No record matches"},
+					},
+				},
+			},
+			"/brain/onthisday": map[string]any{
+				"get": map[string]any{
+					"summary":     "Records written on this day in earlier months or years",
+					"description": "Groups the records created on the same day of the month as the date (today in SBRAIN_TZ by default), most recent first. The brain list filters apply.",
+					"operationId": "getBrainsOnThisDay",
+					"parameters": append([]map[string]any{
+						{"name": "date", "in": "query", "description": "Defaults to today", "schema": map[string]any{"type": "string", "format": "date"}},
+						{"name": "every", "in": "query", "description": "month (default) or year for anniversaries only", "schema": map[string]any{"type": "string", "enum": []string{"month", "year"}}},
+					}, brainFilterParameters()...),
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Earlier dates with their records",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{
+										"type": "object",
+										"properties": map[string]any{
+											"date":  map[string]any{"type": "string", "format": "date"},
+											"count": map[string]any{"type": "integer", "description": "Number of groups"},
+											"groups": map[string]any{
+												"type": "array",
+												"items": map[string]any{
+													"type": "object",
+													"properties": map[string]any{
+														"date":       map[string]any{"type": "string", "format": "date"},
+														"months_ago": map[string]any{"type": "integer"},
+														"label":      map[string]any{"type": "string", "example": "1 year, 2 months ago"},
+														"entries":    map[string]any{"type": "array", "items": map[string]any{"$ref": "#/components/schemas/Brain"}},
+													},
+												},
+											},
+										},
+									},
+								},
+							},
+						},
+						"400": map[string]any{"description": "Invalid date, every or filter"},
+					},
+				},
+			},
+			"/auth/login": map[string]any{
+				"get": map[string]any{
+					"summary":     "Start an OAuth2/OIDC browser login",
+					"operationId": "login",
+					"security":    []map[string]any{},
+					"parameters": []map[string]any{
+						{"name": "next", "in": "query", "schema": map[string]any{"type": "string"}, "description": "Local path to return to after login"},
+					},
+					"responses": map[string]any{
+						"302": map[string]any{"description": "Redirect to the identity provider"},
+						"404": map[string]any{"description": "Login not configured"},
+					},
+				},
+			},
+			"/auth/callback": map[string]any{
+				"get": map[string]any{
+					"summary":     "OAuth2/OIDC redirect target; sets the session cookie",
+					"operationId": "loginCallback",
+					"security":    []map[string]any{},
+					"responses": map[string]any{
+						"302": map[string]any{"description": "Logged in; redirect to the original page"},
+						"400": map[string]any{"description": "Missing or mismatched login state"},
+						"404": map[string]any{"description": "Login not configured"},
+						"401": map[string]any{"description": "Login rejected"},
+						"502": map[string]any{"description": "Identity provider error"},
+					},
+				},
+			},
+			"/auth/logout": map[string]any{
+				"get":  logoutOperation("logout"),
+				"post": logoutOperation("logoutPost"),
+			},
+			"/auth/token": map[string]any{
+				"post": map[string]any{
+					"summary":     "Exchange an OIDC ID token or GitHub access token for an sbrain bearer token",
+					"operationId": "exchangeToken",
+					"security":    []map[string]any{},
+					"requestBody": map[string]any{
+						"required": true,
+						"content": map[string]any{
+							"application/json": map[string]any{
+								"schema": map[string]any{
+									"type": "object",
+									"properties": map[string]any{
+										"id_token":     map[string]any{"type": "string"},
+										"access_token": map[string]any{"type": "string"},
+									},
+								},
+							},
+						},
+					},
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Issued token",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{
+										"type": "object",
+										"properties": map[string]any{
+											"access_token": map[string]any{"type": "string"},
+											"token_type":   map[string]any{"type": "string"},
+											"expires_at":   map[string]any{"type": "string", "format": "date-time"},
+											"subject":      map[string]any{"type": "string"},
+										},
+									},
+								},
+							},
+						},
+						"400": map[string]any{"description": "Bad request"},
+						"401": map[string]any{"description": "Credential rejected"},
+						"404": map[string]any{"description": "Token exchange not configured"},
+					},
+				},
+			},
+			"/whoami": map[string]any{
+				"get": map[string]any{
+					"summary":     "Describe the authenticated caller",
+					"operationId": "whoami",
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Caller identity",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{
+										"type": "object",
+										"properties": map[string]any{
+											"name":    map[string]any{"type": "string"},
+											"method":  map[string]any{"type": "string", "enum": []string{"api_key", "oidc", "none"}},
+											"scopes":  map[string]any{"type": "array", "items": map[string]any{"type": "string", "enum": []string{"read", "write", "admin", "logs-only", "capture"}}},
+											"project": map[string]any{"type": "string", "description": "Project a project-bound key is confined to"},
+										},
+									},
+								},
+							},
+						},
+						"401": map[string]any{"description": "Unauthorized"},
+					},
+				},
+			},
+			"/audit": map[string]any{
+				"get": map[string]any{
+					"summary":     "List audit log entries for create/update/delete operations, newest first",
+					"operationId": "listAudit",
+					"parameters": []map[string]any{
+						{"name": "actor", "in": "query", "schema": map[string]any{"type": "string"}},
+						{"name": "action", "in": "query", "schema": map[string]any{"type": "string", "enum": []string{"create", "update", "delete", "restore", "purge"}}},
+						{"name": "resource", "in": "query", "schema": map[string]any{"type": "string"}, "description": "brain, attachment or digest_destination"},
+						{"name": "resource_id", "in": "query", "schema": map[string]any{"type": "integer", "format": "int64"}},
+						{"name": "since", "in": "query", "schema": map[string]any{"type": "string"}, "description": "Inclusive lower bound (RFC3339 or YYYY-MM-DD)"},
+						{"name": "until", "in": "query", "schema": map[string]any{"type": "string"}, "description": "Exclusive upper bound (RFC3339 or YYYY-MM-DD)"},
+						{"name": "limit", "in": "query", "schema": map[string]any{"type": "integer", "minimum": 1, "maximum": maxAuditLimit, "default": defaultAuditLimit}},
+					},
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Audit entries",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{
+										"type":  "array",
+										"items": map[string]any{"$ref": "#/components/schemas/AuditEntry"},
+									},
+								},
+							},
+						},
+						"400": map[string]any{"description": "Invalid filter"},
+					},
+				},
+			},
+			"/trash": map[string]any{
+				"get": map[string]any{
+					"summary":     "List deleted brain records that can still be restored",
+					"operationId": "listTrash",
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Trashed brain records, most recently deleted first",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{
+										"type":  "array",
+										"items": map[string]any{"$ref": "#/components/schemas/TrashedBrain"},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			"/trash/{id}/restore": map[string]any{
+				"parameters": []map[string]any{
+					{"name": "id", "in": "path", "required": true, "schema": map[string]any{"type": "integer", "format": "int64"}},
+				},
+				"post": map[string]any{
+					"summary":     "Restore a deleted brain record under its original ID",
+					"operationId": "restoreBrain",
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Restored brain record",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{"$ref": "#/components/schemas/Brain"},
+								},
+							},
+						},
+						"400": map[string]any{"description": "Invalid ID"},
+						"404": map[string]any{"description": "Not in the trash"},
+					},
+				},
+			},
+			"/sync": map[string]any{
+				"get": map[string]any{
+					"summary":     "List brain records changed or deleted since a timestamp or cursor",
+					"operationId": "syncBrains",
+					"parameters": []map[string]any{
+						{"name": "since", "in": "query", "schema": map[string]any{"type": "string"}, "description": "Inclusive lower bound: a previous cursor, RFC3339 timestamp or YYYY-MM-DD. Omit for a full snapshot."},
+					},
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Changes since the given point",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{"$ref": "#/components/schemas/SyncResponse"},
+								},
+							},
+						},
+						"400": map[string]any{"description": "Invalid since"},
+					},
+				},
+			},
+			"/admin/alerts/rules": map[string]any{
+				"get": map[string]any{
+					"summary":     "List alert rules",
+					"operationId": "listAlertRules",
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Alert rules",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{
+										"type":  "array",
+										"items": map[string]any{"$ref": "#/components/schemas/AlertRule"},
+									},
+								},
+							},
+						},
+						"500": map[string]any{"description": "Server error"},
+					},
+				},
+				"post": map[string]any{
+					"summary":     "Create an alert rule that fires when more than threshold matching logs arrive within window_minutes",
+					"operationId": "createAlertRule",
+					"requestBody": map[string]any{
+						"required": true,
+						"content": map[string]any{
+							"application/json": map[string]any{
+								"schema": map[string]any{"$ref": "#/components/schemas/AlertRule"},
+							},
+						},
+					},
+					"responses": map[string]any{
+						"201": map[string]any{
+							"description": "Created rule",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{"$ref": "#/components/schemas/AlertRule"},
+								},
+							},
+						},
+						"400": map[string]any{"description": "Bad request"},
+						"500": map[string]any{"description": "Server error"},
+					},
+				},
+			},
+			"/admin/alerts/rules/{id}": map[string]any{
+				"parameters": []map[string]any{
+					{"name": "id", "in": "path", "required": true, "schema": map[string]any{"type": "integer", "format": "int64"}},
+				},
+				"delete": map[string]any{
+					"summary":     "Delete an alert rule",
+					"operationId": "deleteAlertRule",
+					"responses": map[string]any{
+						"204": map[string]any{"description": "Deleted"},
+						"404": map[string]any{"description": "Not found"},
+					},
+				},
+			},
+			"/heartbeats": map[string]any{
+				"get": map[string]any{
+					"summary":     "List heartbeats with their state and when each is next due",
+					"operationId": "listHeartbeats",
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Heartbeats, by name",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{
+										"type":  "array",
+										"items": map[string]any{"$ref": "#/components/schemas/Heartbeat"},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			"/heartbeats/{name}": map[string]any{
+				"parameters": []map[string]any{
+					{"name": "name", "in": "path", "required": true, "schema": map[string]any{"type": "string"}},
+				},
+				"get": map[string]any{
+					"summary":     "Get a heartbeat",
+					"operationId": "getHeartbeat",
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "The heartbeat",
+							"content": map[string]any{
+								"application/json": map[string]any{"schema": map[string]any{"$ref": "#/components/schemas/Heartbeat"}},
+							},
+						},
+						"404": map[string]any{"description": "No such heartbeat"},
+					},
+				},
+				"put": map[string]any{
+					"summary":     "Create a heartbeat or change its interval and alerting",
+					"description": "The heartbeat goes down, with an error log and an alert on its channel, when no ping arrives within interval_seconds plus grace_seconds of the last one (or of its creation).",
+					"operationId": "putHeartbeat",
+					"requestBody": map[string]any{
+						"required": true,
+						"content": map[string]any{
+							"application/json": map[string]any{
+								"schema": map[string]any{
+									"type":     "object",
+									"required": []string{"interval_seconds"},
+									"properties": map[string]any{
+										"interval_seconds": map[string]any{"type": "integer", "minimum": 60},
+										"grace_seconds":    map[string]any{"type": "integer", "minimum": 0},
+										"channel":          map[string]any{"type": "string", "enum": []string{"", "webhook", "slack", "email"}},
+										"target":           map[string]any{"type": "string", "description": "Webhook URL, Slack incoming webhook or email address"},
+									},
+								},
+							},
+						},
+					},
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Updated heartbeat",
+							"content": map[string]any{
+								"application/json": map[string]any{"schema": map[string]any{"$ref": "#/components/schemas/Heartbeat"}},
+							},
+						},
+						"201": map[string]any{
+							"description": "Created heartbeat",
+							"content": map[string]any{
+								"application/json": map[string]any{"schema": map[string]any{"$ref": "#/components/schemas/Heartbeat"}},
+							},
+						},
+						"400": map[string]any{"description": "Invalid field"},
+					},
+				},
+				"post": map[string]any{
+					"summary":     "Ping a heartbeat",
+					"description": "What a job calls each time it runs; allowed to logs-only keys. A ping to a heartbeat that is down brings it back up.",
+					"operationId": "pingHeartbeat",
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "The heartbeat, up",
+							"content": map[string]any{
+								"application/json": map[string]any{"schema": map[string]any{"$ref": "#/components/schemas/Heartbeat"}},
+							},
+						},
+						"404": map[string]any{"description": "No such heartbeat"},
+					},
+				},
+				"delete": map[string]any{
+					"summary":     "Delete a heartbeat",
+					"operationId": "deleteHeartbeat",
+					"responses": map[string]any{
+						"204": map[string]any{"description": "Deleted"},
+						"404": map[string]any{"description": "No such heartbeat"},
+					},
+				},
+			},
+			"/monitors": map[string]any{
+				"get": map[string]any{
+					"summary":     "List uptime monitors with their state and last check",
+					"operationId": "listMonitors",
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Monitors, by name",
+							"content": map[string]any{
+								"application/json": map[string]any{"schema": map[string]any{"type": "array", "items": map[string]any{"$ref": "#/components/schemas/Monitor"}}},
+							},
+						},
+					},
+				},
+				"post": map[string]any{
+					"summary":     "Create an uptime monitor",
+					"description": "The URL is requested every interval_seconds. Each check is stored as a log (info when it passes, error when it fails) with its response time, and after failure_threshold failures in a row the monitor goes down and an alert is sent on its channel.",
+					"operationId": "createMonitor",
+					"requestBody": map[string]any{
+						"required": true,
+						"content": map[string]any{
+							"application/json": map[string]any{"schema": map[string]any{"$ref": "#/components/schemas/MonitorInput"}},
+						},
+					},
+					"responses": map[string]any{
+						"201": map[string]any{
+							"description": "Created monitor",
+							"content": map[string]any{
+								"application/json": map[string]any{"schema": map[string]any{"$ref": "#/components/schemas/Monitor"}},
+							},
+						},
+						"400": map[string]any{"description": "Invalid field"},
+					},
+				},
+			},
+			"/monitors/{id}": map[string]any{
+				"parameters": []map[string]any{
+					{"name": "id", "in": "path", "required": true, "schema": map[string]any{"type": "integer", "format": "int64"}},
+				},
+				"get": map[string]any{
+					"summary":     "Get an uptime monitor",
+					"operationId": "getMonitor",
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "The monitor",
+							"content": map[string]any{
+								"application/json": map[string]any{"schema": map[string]any{"$ref": "#/components/schemas/Monitor"}},
+							},
+						},
+						"404": map[string]any{"description": "Not found"},
+					},
+				},
+				"put": map[string]any{
+					"summary":     "Change an uptime monitor; fields left out keep their values",
+					"operationId": "updateMonitor",
+					"requestBody": map[string]any{
+						"required": true,
+						"content": map[string]any{
+							"application/json": map[string]any{"schema": map[string]any{"$ref": "#/components/schemas/MonitorInput"}},
+						},
+					},
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Updated monitor",
+							"content": map[string]any{
+								"application/json": map[string]any{"schema": map[string]any{"$ref": "#/components/schemas/Monitor"}},
+							},
+						},
+						"400": map[string]any{"description": "Invalid field"},
+						"404": map[string]any{"description": "Not found"},
+					},
+				},
+				"delete": map[string]any{
+					"summary":     "Delete an uptime monitor; the logs of its checks are kept",
+					"operationId": "deleteMonitor",
+					"responses": map[string]any{
+						"204": map[string]any{"description": "Deleted"},
+						"404": map[string]any{"description": "Not found"},
+					},
+				},
+			},
+			"/monitors/{id}/check": map[string]any{
+				"post": map[string]any{
+					"summary":     "Check a monitor now, even a disabled one",
+					"operationId": "checkMonitor",
+					"parameters": []map[string]any{
+						{"name": "id", "in": "path", "required": true, "schema": map[string]any{"type": "integer", "format": "int64"}},
+					},
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "The monitor with the check's result",
+							"content": map[string]any{
+								"application/json": map[string]any{"schema": map[string]any{"$ref": "#/components/schemas/Monitor"}},
+							},
+						},
+						"404": map[string]any{"description": "Not found"},
+					},
+				},
+			},
+			"/slos": map[string]any{
+				"get": map[string]any{
+					"summary":     "List service level objectives",
+					"operationId": "listSLOs",
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "SLOs, by endpoint",
+							"content": map[string]any{
+								"application/json": map[string]any{"schema": map[string]any{"type": "array", "items": map[string]any{"$ref": "#/components/schemas/SLO"}}},
+							},
+						},
+					},
+				},
+				"post": map[string]any{
+					"summary":     "Define latency and/or error-rate objectives for a logged endpoint",
+					"operationId": "createSLO",
+					"requestBody": map[string]any{
+						"required": true,
+						"content": map[string]any{
+							"application/json": map[string]any{"schema": map[string]any{"$ref": "#/components/schemas/SLO"}},
+						},
+					},
+					"responses": map[string]any{
+						"201": map[string]any{
+							"description": "Created SLO",
+							"content": map[string]any{
+								"application/json": map[string]any{"schema": map[string]any{"$ref": "#/components/schemas/SLO"}},
+							},
+						},
+						"400": map[string]any{"description": "Invalid field"},
+						"409": map[string]any{"description": "The endpoint already has an SLO"},
+					},
+				},
+			},
+			"/slos/{id}": map[string]any{
+				"parameters": []map[string]any{
+					{"name": "id", "in": "path", "required": true, "schema": map[string]any{"type": "integer", "format": "int64"}},
+				},
+				"put": map[string]any{
+					"summary":     "Replace an SLO's objectives",
+					"operationId": "updateSLO",
+					"requestBody": map[string]any{
+						"required": true,
+						"content": map[string]any{
+							"application/json": map[string]any{"schema": map[string]any{"$ref": "#/components/schemas/SLO"}},
+						},
+					},
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Updated SLO",
+							"content": map[string]any{
+								"application/json": map[string]any{"schema": map[string]any{"$ref": "#/components/schemas/SLO"}},
+							},
+						},
+						"400": map[string]any{"description": "Invalid field"},
+						"404": map[string]any{"description": "Not found"},
+						"409": map[string]any{"description": "The endpoint already has an SLO"},
+					},
+				},
+				"delete": map[string]any{
+					"summary":     "Delete an SLO",
+					"operationId": "deleteSLO",
+					"responses": map[string]any{
+						"204": map[string]any{"description": "Deleted"},
+						"404": map[string]any{"description": "Not found"},
+					},
+				},
+			},
+			"/slo/report": map[string]any{
+				"get": map[string]any{
+					"summary":     "Compliance and error budget burn of every SLO, from the logs",
+					"description": "For each SLO, how many requests in the window met each objective, the burn rate of its error budget over the window and over the last hour (1 spends exactly the budget; more runs out early), and the share of the budget left.",
+					"operationId": "sloReport",
+					"parameters": []map[string]any{
+						{"name": "window", "in": "query", "schema": map[string]any{"type": "string", "default": "30d"}, "description": "Days such as 30d, or a duration such as 12h"},
+					},
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "The report",
+							"content": map[string]any{
+								"application/json": map[string]any{"schema": map[string]any{"$ref": "#/components/schemas/SLOReport"}},
+							},
+						},
+						"400": map[string]any{"description": "Invalid window"},
+					},
+				},
+			},
+			"/alerts": map[string]any{
+				"get": map[string]any{
+					"summary":     "List fired alerts, newest first",
+					"operationId": "listAlerts",
+					"parameters": []map[string]any{
+						{"name": "rule_id", "in": "query", "schema": map[string]any{"type": "integer", "format": "int64"}},
+						{"name": "unacknowledged", "in": "query", "schema": map[string]any{"type": "boolean"}},
+					},
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Alert events",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{
+										"type":  "array",
+										"items": map[string]any{"$ref": "#/components/schemas/AlertEvent"},
+									},
+								},
+							},
+						},
+						"400": map[string]any{"description": "Bad request"},
+					},
+				},
+			},
+			"/alerts/{id}/ack": map[string]any{
+				"parameters": []map[string]any{
+					{"name": "id", "in": "path", "required": true, "schema": map[string]any{"type": "integer", "format": "int64"}},
+				},
+				"post": map[string]any{
+					"summary":     "Acknowledge a fired alert",
+					"operationId": "acknowledgeAlert",
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Acknowledged alert",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{"$ref": "#/components/schemas/AlertEvent"},
+								},
+							},
+						},
+						"404": map[string]any{"description": "Not found"},
+					},
+				},
+			},
+			"/loki/api/v1/push": map[string]any{
+				"post": map[string]any{
+					"summary":     "Loki-compatible log push; each line becomes a log entry with its stream labels in metadata",
+					"operationId": "lokiPush",
+					"requestBody": map[string]any{
+						"required": true,
+						"content": map[string]any{
+							"application/x-protobuf": map[string]any{
+								"schema": map[string]any{"type": "string", "format": "binary", "description": "Snappy-compressed logproto.PushRequest"},
+							},
+							"application/json": map[string]any{
+								"schema": map[string]any{
+									"type": "object",
+									"properties": map[string]any{
+										"streams": map[string]any{
+											"type": "array",
+											"items": map[string]any{
+												"type": "object",
+												"properties": map[string]any{
+													"stream": map[string]any{"type": "object", "additionalProperties": map[string]any{"type": "string"}},
+													"values": map[string]any{
+														"type":        "array",
+														"description": "[unix_nanoseconds, line] or [unix_nanoseconds, line, structured_metadata]",
+														"items":       map[string]any{"type": "array", "items": map[string]any{}},
+													},
+												},
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+					"responses": map[string]any{
+						"204": map[string]any{"description": "Accepted"},
+						"400": map[string]any{"description": "Malformed push request"},
+					},
+				},
+			},
+			"/v1/logs": map[string]any{
+				"post": map[string]any{
+					"summary":     "OTLP/HTTP logs export (ExportLogsServiceRequest); each log record becomes a log entry",
+					"operationId": "otlpExportLogs",
+					"requestBody": map[string]any{
+						"required": true,
+						"content": map[string]any{
+							"application/x-protobuf": map[string]any{
+								"schema": map[string]any{"type": "string", "format": "binary"},
+							},
+							"application/json": map[string]any{
+								"schema": map[string]any{"type": "object", "description": "OTLP JSON encoding of ExportLogsServiceRequest"},
+							},
+						},
+					},
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Empty ExportLogsServiceResponse",
+							"content": map[string]any{
+								"application/x-protobuf": map[string]any{
+									"schema": map[string]any{"type": "string", "format": "binary"},
+								},
+								"application/json": map[string]any{
+									"schema": map[string]any{"type": "object"},
+								},
+							},
+						},
+						"400": map[string]any{"description": "Malformed export request"},
+					},
+				},
+			},
+			"/grafana/": map[string]any{
+				"get": map[string]any{
+					"summary":     "Grafana JSON datasource: connection test",
+					"operationId": "grafanaTest",
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "The datasource is reachable",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{"$ref": "#/components/schemas/Status"},
+								},
+							},
+						},
+					},
+				},
+			},
+			"/grafana/metrics": map[string]any{
+				"post": map[string]any{
+					"summary":     "Grafana JSON datasource: list the metric targets (same as /grafana/search)",
+					"operationId": "grafanaMetrics",
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Target names",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+								},
+							},
+						},
+					},
+				},
+			},
+			"/grafana/tag-keys": map[string]any{
+				"post": map[string]any{
+					"summary":     "Grafana JSON datasource: ad hoc filter keys",
+					"operationId": "grafanaTagKeys",
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Filter keys",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{"type": "array", "items": map[string]any{"$ref": "#/components/schemas/GrafanaTag"}},
+								},
+							},
+						},
+					},
+				},
+			},
+			"/grafana/tag-values": map[string]any{
+				"post": map[string]any{
+					"summary":     "Grafana JSON datasource: values seen for an ad hoc filter key",
+					"operationId": "grafanaTagValues",
+					"requestBody": map[string]any{
+						"required": true,
+						"content": map[string]any{
+							"application/json": map[string]any{
+								"schema": map[string]any{
+									"type":       "object",
+									"properties": map[string]any{"key": map[string]any{"type": "string"}},
+									"required":   []string{"key"},
+								},
+							},
+						},
+					},
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Filter values",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{"type": "array", "items": map[string]any{"$ref": "#/components/schemas/GrafanaTag"}},
+								},
+							},
+						},
+					},
+				},
+			},
+			"/grafana/search": map[string]any{
+				"post": map[string]any{
+					"summary":     "Grafana JSON datasource: list the metric targets",
+					"operationId": "grafanaSearch",
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Target names",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+								},
+							},
+						},
+					},
+				},
+			},
+			"/grafana/query": map[string]any{
+				"post": map[string]any{
+					"summary":     "Grafana JSON datasource: time series (requests, errors, error_rate, response_time_*) and tables (by_level, by_endpoint, by_status_class) over logs",
+					"operationId": "grafanaQuery",
+					"requestBody": map[string]any{
+						"required": true,
+						"content": map[string]any{
+							"application/json": map[string]any{
+								"schema": map[string]any{"type": "object", "description": "Grafana query request: range, intervalMs, maxDataPoints, targets, adhocFilters"},
+							},
+						},
+					},
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "One time series ({target, datapoints: [[value, unix_ms]]}) or table ({type, columns, rows}) per target",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{"type": "array", "items": map[string]any{"type": "object"}},
+								},
+							},
+						},
+						"400": map[string]any{"description": "Malformed request or unknown target"},
+					},
+				},
+			},
+			"/grafana/annotations": map[string]any{
+				"post": map[string]any{
+					"summary":     "Grafana JSON datasource: fired alerts in the range, or error logs when the annotation query is \"errors\"",
+					"operationId": "grafanaAnnotations",
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Annotations",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{
+										"type": "array",
+										"items": map[string]any{
+											"type": "object",
+											"properties": map[string]any{
+												"time":       map[string]any{"type": "integer", "format": "int64", "description": "Unix milliseconds"},
+												"title":      map[string]any{"type": "string"},
+												"text":       map[string]any{"type": "string"},
+												"tags":       map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+												"annotation": map[string]any{"type": "object"},
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			"/logs/batch": map[string]any{
+				"post": map[string]any{
+					"summary":     "Create many logs",
+					"description": "Each log is handled as POST /logs would. Invalid ones are reported by index and skipped; the others are stored. At most 1000 logs per batch.",
+					"operationId": "createLogBatch",
+					"requestBody": map[string]any{
+						"required": true,
+						"content": map[string]any{
+							"application/json": map[string]any{
+								"schema": map[string]any{"type": "array", "maxItems": 1000, "items": map[string]any{"$ref": "#/components/schemas/LogCreate"}},
+							},
+						},
+					},
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "What became of the batch",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{
+										"type": "object",
+										"properties": map[string]any{
+											"stored":      map[string]any{"type": "integer"},
+											"sampled_out": map[string]any{"type": "integer"},
+											"ids":         map[string]any{"type": "array", "items": map[string]any{"type": "integer", "format": "int64"}},
+											"rejected": map[string]any{
+												"type": "array",
+												"items": map[string]any{
+													"type": "object",
+													"properties": map[string]any{
+														"index":  map[string]any{"type": "integer"},
+														"fields": map[string]any{"type": "array", "items": map[string]any{"$ref": "#/components/schemas/FieldError"}},
+													},
+												},
+											},
+										},
+									},
+								},
+							},
+						},
+						"400": map[string]any{"description": "Not a JSON array, or too many logs"},
+						"500": map[string]any{"description": "Server error"},
+					},
+				},
+			},
+			"/logs/purge": map[string]any{
+				"post": map[string]any{
+					"summary":     "Delete logs matching filters",
+					"description": "Deletes in batches of 1000 rows per transaction. At least one filter is required.",
+					"operationId": "purgeLogs",
+					"parameters": append(logFilterParameters(),
+						map[string]any{"name": "before", "in": "query", "description": "Alias for until", "schema": map[string]any{"type": "string"}},
+					),
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Number of logs deleted",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{
+										"type":       "object",
+										"properties": map[string]any{"deleted": map[string]any{"type": "integer"}},
+									},
+								},
+							},
+						},
+						"400": map[string]any{"description": "Invalid or missing filter"},
+						"500": map[string]any{"description": "Server error"},
+					},
+				},
+			},
+			"/templates": map[string]any{
+				"get": map[string]any{
+					"summary":     "List brain templates",
+					"operationId": "listTemplates",
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Templates",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{"type": "array", "items": map[string]any{"$ref": "#/components/schemas/BrainTemplate"}},
+								},
+							},
+						},
+					},
+				},
+				"post": map[string]any{
+					"summary":     "Create a brain template",
+					"operationId": "createTemplate",
+					"requestBody": map[string]any{
+						"required": true,
+						"content": map[string]any{
+							"application/json": map[string]any{
+								"schema": map[string]any{"$ref": "#/components/schemas/BrainTemplate"},
+							},
+						},
+					},
+					"responses": map[string]any{
+						"201": map[string]any{
+							"description": "Created template",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{"$ref": "#/components/schemas/BrainTemplate"},
+								},
+							},
+						},
+						"400": map[string]any{"description": "Invalid template"},
+						"409": map[string]any{"description": "Name already taken"},
+					},
+				},
+			},
+			"/templates/{name}": map[string]any{
+				"parameters": []map[string]any{
+					{"name": "name", "in": "path", "required": true, "schema": map[string]any{"type": "string"}},
+				},
+				"get": map[string]any{
+					"summary":     "Get a brain template",
+					"operationId": "getTemplate",
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Template",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{"$ref": "#/components/schemas/BrainTemplate"},
+								},
+							},
+						},
+						"404": map[string]any{"description": "Not found"},
+					},
+				},
+				"delete": map[string]any{
+					"summary":     "Delete a brain template",
+					"operationId": "deleteTemplate",
+					"responses": map[string]any{
+						"204": map[string]any{"description": "Deleted"},
+						"404": map[string]any{"description": "Not found"},
+					},
+				},
+			},
+			"/reminders": map[string]any{
+				"get": map[string]any{
+					"summary":     "List due and overdue reminders",
+					"operationId": "listReminders",
+					"parameters": []map[string]any{
+						{"name": "until", "in": "query", "description": "Upper bound on remind_at (default now); a future value includes upcoming reminders", "schema": map[string]any{"type": "string"}},
+					},
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Brains with remind_at up to until, soonest first, each with a status of overdue, due or upcoming",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{"type": "array", "items": map[string]any{"$ref": "#/components/schemas/Brain"}},
+								},
+							},
+						},
+						"400": map[string]any{"description": "Invalid until"},
+					},
+				},
+			},
+			"/reminders/{id}": map[string]any{
+				"delete": map[string]any{
+					"summary":     "Clear a record's reminder",
+					"operationId": "clearReminder",
+					"parameters": []map[string]any{
+						{"name": "id", "in": "path", "required": true, "schema": map[string]any{"type": "integer", "format": "int64"}},
+					},
+					"responses": map[string]any{
+						"204": map[string]any{"description": "Reminder cleared"},
+						"404": map[string]any{"description": "No such record, or no reminder set"},
+					},
+				},
+			},
+			"/schedules": map[string]any{
+				"get": map[string]any{
+					"summary":     "List recurring brain schedules",
+					"operationId": "listSchedules",
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Schedules",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{"type": "array", "items": map[string]any{"$ref": "#/components/schemas/BrainSchedule"}},
+								},
+							},
+						},
+					},
+				},
+				"post": map[string]any{
+					"summary":     "Create a recurring brain schedule",
+					"operationId": "createSchedule",
+					"requestBody": map[string]any{
+						"required": true,
+						"content": map[string]any{
+							"application/json": map[string]any{
+								"schema": map[string]any{"$ref": "#/components/schemas/BrainSchedule"},
+							},
+						},
+					},
+					"responses": map[string]any{
+						"201": map[string]any{
+							"description": "Created schedule",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{"$ref": "#/components/schemas/BrainSchedule"},
+								},
+							},
+						},
+						"400": map[string]any{"description": "Invalid schedule"},
+					},
+				},
+			},
+			"/schedules/{id}": map[string]any{
+				"delete": map[string]any{
+					"summary":     "Delete a schedule, keeping the records it created",
+					"operationId": "deleteSchedule",
+					"parameters": []map[string]any{
+						{"name": "id", "in": "path", "required": true, "schema": map[string]any{"type": "integer", "format": "int64"}},
+					},
+					"responses": map[string]any{
+						"204": map[string]any{"description": "Deleted"},
+						"404": map[string]any{"description": "Not found"},
+					},
+				},
+			},
+			"/schedules/{id}/run": map[string]any{
+				"post": map[string]any{
+					"summary":     "Create a schedule's record now",
+					"operationId": "runSchedule",
+					"parameters": []map[string]any{
+						{"name": "id", "in": "path", "required": true, "schema": map[string]any{"type": "integer", "format": "int64"}},
+					},
+					"responses": map[string]any{
+						"201": map[string]any{
+							"description": "Created brain",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{"$ref": "#/components/schemas/Brain"},
+								},
+							},
+						},
+						"404": map[string]any{"description": "Not found"},
+					},
+				},
+			},
+			"/brain/{id}/pin":      brainFlagSpec("pin"),
+			"/brain/{id}/favorite": brainFlagSpec("favorite"),
+			"/brain/{id}/archive":  brainFlagSpec("archive"),
+			"/brain/{id}/pdf": map[string]any{
+				"get": map[string]any{
+					"summary":     "A brain record as a PDF, its context rendered from markdown",
+					"operationId": "getBrainPDF",
+					"parameters": []map[string]any{
+						{"name": "id", "in": "path", "required": true, "schema": map[string]any{"type": "integer", "format": "int64"}},
+					},
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "PDF document",
+							"content": map[string]any{
+								"application/pdf": map[string]any{"schema": map[string]any{"type": "string", "format": "binary"}},
+							},
+						},
+						"404": map[string]any{"description": "Not found"},
+					},
+				},
+			},
+			"/brain/{id}/send": map[string]any{
+				"post": map[string]any{
+					"summary":     "Email a brain record to one of the SBRAIN_SEND_TO addresses",
+					"description": "The record is sent as markdown with its front matter, through the SBRAIN_SMTP_* server.",
+					"operationId": "sendBrain",
+					"parameters": []map[string]any{
+						{"name": "id", "in": "path", "required": true, "schema": map[string]any{"type": "integer", "format": "int64"}},
+					},
+					"requestBody": map[string]any{
+						"required": false,
+						"content": map[string]any{
+							"application/json": map[string]any{
+								"schema": map[string]any{
+									"type": "object",
+									"properties": map[string]any{
+										"to":   map[string]any{"type": "string", "description": "One of the SBRAIN_SEND_TO addresses; the first by default"},
+										"note": map[string]any{"type": "string", "description": "Text added above the record"},
+									},
+								},
+							},
+						},
+					},
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Sent",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{
+										"type": "object",
+										"properties": map[string]any{
+											"sent_to": map[string]any{"type": "string"},
+											"subject": map[string]any{"type": "string"},
+										},
+									},
+								},
+							},
+						},
+						"400": map[string]any{"description": "Address not in SBRAIN_SEND_TO"},
+						"404": map[string]any{"description": "Not found"},
+						"502": map[string]any{"description": "The SMTP server refused the message"},
+						"503": map[string]any{"description": "SBRAIN_SEND_TO or SBRAIN_SMTP_ADDR is not set"},
+					},
+				},
+			},
+			"/brain/{id}/share": map[string]any{
+				"post": map[string]any{
+					"summary":     "Create a public read-only link to a brain record",
+					"operationId": "shareBrain",
+					"parameters": []map[string]any{
+						{"name": "id", "in": "path", "required": true, "schema": map[string]any{"type": "integer", "format": "int64"}},
+					},
+					"requestBody": map[string]any{
+						"required": false,
+						"content": map[string]any{
+							"application/json": map[string]any{
+								"schema": map[string]any{
+									"type": "object",
+									"properties": map[string]any{
+										"expires_in": map[string]any{"type": "string", "description": "Lifetime as a Go duration, such as 72h; omit for a link that lasts until revoked"},
+									},
+								},
+							},
+						},
+					},
+					"responses": map[string]any{
+						"201": map[string]any{
+							"description": "Share, including its url",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{"$ref": "#/components/schemas/BrainShare"},
+								},
+							},
+						},
+						"400": map[string]any{"description": "Invalid expires_in"},
+						"404": map[string]any{"description": "Not found"},
+					},
+				},
+			},
+			"/brain/{id}/shares": map[string]any{
+				"get": map[string]any{
+					"summary":     "List a brain record's share links",
+					"operationId": "listBrainShares",
+					"parameters": []map[string]any{
+						{"name": "id", "in": "path", "required": true, "schema": map[string]any{"type": "integer", "format": "int64"}},
+					},
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Shares, newest first, without urls",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{"type": "array", "items": map[string]any{"$ref": "#/components/schemas/BrainShare"}},
+								},
+							},
+						},
+					},
+				},
+			},
+			"/shares/{id}": map[string]any{
+				"delete": map[string]any{
+					"summary":     "Revoke a share link",
+					"operationId": "revokeShare",
+					"parameters": []map[string]any{
+						{"name": "id", "in": "path", "required": true, "schema": map[string]any{"type": "integer", "format": "int64"}},
+					},
+					"responses": map[string]any{
+						"204": map[string]any{"description": "Revoked"},
+						"404": map[string]any{"description": "Not found"},
+					},
+				},
+			},
+			"/s/{token}": map[string]any{
+				"get": map[string]any{
+					"summary":     "View a shared brain record",
+					"description": "Public: no credentials needed. Invalid, expired and revoked links answer 404.",
+					"operationId": "viewSharedBrain",
+					"security":    []map[string]any{},
+					"parameters": []map[string]any{
+						{"name": "token", "in": "path", "required": true, "schema": map[string]any{"type": "string"}},
+					},
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Rendered record",
+							"content":     map[string]any{"text/html": map[string]any{}},
+						},
+						"404": map[string]any{"description": "Not found"},
+					},
+				},
+			},
+			"/calendar.ics": map[string]any{
+				"get": map[string]any{
+					"summary":     "iCalendar feed of brain activity and reminders",
+					"description": "Calendar apps that cannot send headers may pass the API key as ?key=.",
+					"operationId": "getCalendar",
+					"parameters": []map[string]any{
+						{"name": "days", "in": "query", "description": "Days of activity to include (default 90, at most 366)", "schema": map[string]any{"type": "integer"}},
+						{"name": "reminders", "in": "query", "description": "Emit reminders as event (default) or todo", "schema": map[string]any{"type": "string", "enum": []string{"event", "todo"}}},
+						{"name": "key", "in": "query", "description": "API key, for subscriptions", "schema": map[string]any{"type": "string"}},
+					},
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "iCalendar document",
+							"content":     map[string]any{"text/calendar": map[string]any{}},
+						},
+						"400": map[string]any{"description": "Invalid days or reminders"},
+					},
+				},
+			},
+			"/search": map[string]any{
+				"get": map[string]any{
+					"summary":     "Search brain records and logs",
+					"description": "Returns records and logs containing every term in q (case-insensitive), best match first.",
+					"operationId": "search",
+					"parameters": []map[string]any{
+						{"name": "q", "in": "query", "required": true, "description": "Whitespace-separated terms", "schema": map[string]any{"type": "string"}},
+						{"name": "type", "in": "query", "description": "Only search one resource", "schema": map[string]any{"type": "string", "enum": []string{"brain", "log"}}},
+						{"name": "limit", "in": "query", "description": "Maximum results (default 20, at most 100)", "schema": map[string]any{"type": "integer"}},
+					},
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Matches",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{
+										"type": "array",
+										"items": map[string]any{
+											"type": "object",
+											"properties": map[string]any{
+												"type":       map[string]any{"type": "string", "enum": []string{"brain", "log"}},
+												"id":         map[string]any{"type": "integer"},
+												"path":       map[string]any{"type": "string"},
+												"score":      map[string]any{"type": "number"},
+												"title":      map[string]any{"type": "string"},
+												"snippet":    map[string]any{"type": "string"},
+												"created_at": map[string]any{"type": "string", "format": "date-time"},
+											},
+										},
+									},
+								},
+							},
+						},
+						"400": map[string]any{"description": "Missing q or invalid type or limit"},
+					},
+				},
+			},
+			"/logs/slow": map[string]any{
+				"get": map[string]any{
+					"summary":     "Endpoints with slow requests, with response-time percentiles and histograms",
+					"operationId": "getSlowLogs",
+					"parameters": []map[string]any{
+						{"name": "threshold", "in": "query", "description": "Slow-request threshold in ms (default 500)", "schema": map[string]any{"type": "integer"}},
+						{"name": "window", "in": "query", "description": "How far back to look, as a Go duration (default 24h)", "schema": map[string]any{"type": "string"}},
+						{"name": "limit", "in": "query", "description": "Maximum endpoints (default 20)", "schema": map[string]any{"type": "integer"}},
+					},
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Slow-request report",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{"$ref": "#/components/schemas/SlowReport"},
+								},
+							},
+						},
+						"400": map[string]any{"description": "Invalid threshold, window or limit"},
+					},
+				},
+			},
+			"/brain/{id}/logs": map[string]any{
+				"get": map[string]any{
+					"summary":     "List logs linked to a brain record",
+					"operationId": "listBrainLogs",
+					"parameters": append([]map[string]any{
+						{"name": "id", "in": "path", "required": true, "schema": map[string]any{"type": "integer", "format": "int64"}},
+					}, logFilterParameters()...),
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Linked logs, most recent first",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{"type": "array", "items": map[string]any{"$ref": "#/components/schemas/LogEntry"}},
+								},
+							},
+						},
+						"400": map[string]any{"description": "Invalid filter"},
+						"404": map[string]any{"description": "Not found"},
+					},
+				},
+				"post": map[string]any{
+					"summary":     "Link existing logs to a brain record",
+					"operationId": "linkBrainLogs",
+					"parameters": []map[string]any{
+						{"name": "id", "in": "path", "required": true, "schema": map[string]any{"type": "integer", "format": "int64"}},
+					},
+					"requestBody": map[string]any{
+						"required": true,
+						"content": map[string]any{
+							"application/json": map[string]any{
+								"schema": map[string]any{
+									"type":     "object",
+									"required": []string{"log_ids"},
+									"properties": map[string]any{
+										"log_ids": map[string]any{"type": "array", "items": map[string]any{"type": "integer", "format": "int64"}},
+									},
+								},
+							},
+						},
+					},
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Number of logs linked",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{
+										"type":       "object",
+										"properties": map[string]any{"linked": map[string]any{"type": "integer", "format": "int64"}},
+									},
+								},
+							},
+						},
+						"400": map[string]any{"description": "Missing log_ids"},
+						"404": map[string]any{"description": "Not found"},
+					},
+				},
+			},
+			"/brain/{id}/logs/{log_id}": map[string]any{
+				"delete": map[string]any{
+					"summary":     "Unlink a log from a brain record",
+					"operationId": "unlinkBrainLog",
+					"parameters": []map[string]any{
+						{"name": "id", "in": "path", "required": true, "schema": map[string]any{"type": "integer", "format": "int64"}},
+						{"name": "log_id", "in": "path", "required": true, "schema": map[string]any{"type": "integer", "format": "int64"}},
+					},
+					"responses": map[string]any{
+						"204": map[string]any{"description": "Unlinked"},
+						"404": map[string]any{"description": "Log not found or not linked to this record"},
+					},
+				},
+			},
+			"/brain/{id}/issues": map[string]any{
+				"parameters": []map[string]any{
+					{"name": "id", "in": "path", "required": true, "schema": map[string]any{"type": "integer", "format": "int64"}},
+				},
+				"get": map[string]any{
+					"summary":     "List the Jira and Linear issues linked to a brain record",
+					"description": "Issues fetched longer ago than SBRAIN_ISSUE_CACHE_TTL (default 15m) are fetched again first; a failed fetch keeps the cached title and status.",
+					"operationId": "listBrainIssues",
+					"parameters": []map[string]any{
+						{"name": "refresh", "in": "query", "description": "Fetch every issue again", "schema": map[string]any{"type": "boolean"}},
+					},
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Linked issues",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{"type": "array", "items": map[string]any{"$ref": "#/components/schemas/BrainIssue"}},
+								},
+							},
+						},
+						"404": map[string]any{"description": "Brain record not found"},
+					},
+				},
+				"post": map[string]any{
+					"summary":     "Link a brain record to a Jira or Linear issue",
+					"description": "Fetches the issue's title and status when the provider's token is configured. An issue the provider does not know is refused; when it is unreachable the link is kept and fetched later.",
+					"operationId": "linkBrainIssue",
+					"requestBody": map[string]any{
+						"required": true,
+						"content": map[string]any{
+							"application/json": map[string]any{
+								"schema": map[string]any{
+									"type":     "object",
+									"required": []string{"provider", "key"},
+									"properties": map[string]any{
+										"provider": map[string]any{"type": "string", "enum": []string{"jira", "linear"}},
+										"key":      map[string]any{"type": "string", "example": "ENG-123"},
+									},
+								},
+							},
+						},
+					},
+					"responses": map[string]any{
+						"201": map[string]any{
+							"description": "Linked issue",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{"$ref": "#/components/schemas/BrainIssue"},
+								},
+							},
+						},
+						"404": map[string]any{"description": "Brain record not found"},
+						"409": map[string]any{"description": "Issue already linked"},
+						"400": map[string]any{"description": "Invalid provider or key, or no such issue"},
+					},
+				},
+			},
+			"/brain/{id}/issues/{issue_id}": map[string]any{
+				"delete": map[string]any{
+					"summary":     "Unlink an issue from a brain record",
+					"operationId": "unlinkBrainIssue",
+					"parameters": []map[string]any{
+						{"name": "id", "in": "path", "required": true, "schema": map[string]any{"type": "integer", "format": "int64"}},
+						{"name": "issue_id", "in": "path", "required": true, "schema": map[string]any{"type": "integer", "format": "int64"}},
+					},
+					"responses": map[string]any{
+						"204": map[string]any{"description": "Unlinked"},
+						"404": map[string]any{"description": "Issue not linked to this record"},
+					},
+				},
+			},
+			"/readyz": map[string]any{
+				"get": map[string]any{
+					"summary":     "Readiness: startup self-test of the schema, migrations and write access",
+					"operationId": "getReadiness",
+					"security":    []map[string]any{},
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Ready",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{"$ref": "#/components/schemas/SelfTest"},
+								},
+							},
+						},
+						"503": map[string]any{
+							"description": "A check failed",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{"$ref": "#/components/schemas/SelfTest"},
+								},
+							},
+						},
+					},
+				},
+			},
+			"/healthz": map[string]any{
+				"get": map[string]any{
+					"summary":     "Liveness and disk usage: database size and free space on its volume",
+					"operationId": "getHealth",
+					"security":    []map[string]any{},
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Alive; status is degraded while free space is below a threshold",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{
+										"type": "object",
+										"properties": map[string]any{
+											"status": map[string]any{"type": "string", "enum": []string{"ok", "degraded"}},
+											"disk":   map[string]any{"$ref": "#/components/schemas/DiskUsage"},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			"/metrics": map[string]any{
+				"get": map[string]any{
+					"summary":     "Prometheus metrics: database size, free disk space and writes refused for lack of space",
+					"operationId": "getMetrics",
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Metrics in the Prometheus text format",
+							"content": map[string]any{
+								"text/plain": map[string]any{"schema": map[string]any{"type": "string"}},
+							},
+						},
+					},
+				},
+			},
+			"/admin/scrub/rules": map[string]any{
+				"get": map[string]any{
+					"summary":     "List log scrub rules",
+					"operationId": "listScrubRules",
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Scrub rules",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{
+										"type":  "array",
+										"items": map[string]any{"$ref": "#/components/schemas/ScrubRule"},
+									},
+								},
+							},
+						},
+						"500": map[string]any{"description": "Server error"},
+					},
+				},
+				"post": map[string]any{
+					"summary":     "Create a rule that redacts matching text from logs before they are stored",
+					"operationId": "createScrubRule",
+					"requestBody": map[string]any{
+						"required": true,
+						"content": map[string]any{
+							"application/json": map[string]any{
+								"schema": map[string]any{"$ref": "#/components/schemas/ScrubRule"},
+							},
+						},
+					},
+					"responses": map[string]any{
+						"201": map[string]any{
+							"description": "Created rule",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{"$ref": "#/components/schemas/ScrubRule"},
+								},
+							},
+						},
+						"400": map[string]any{"description": "Bad request"},
+						"500": map[string]any{"description": "Server error"},
+					},
+				},
+			},
+			"/admin/scrub/rules/{id}": map[string]any{
+				"parameters": []map[string]any{
+					{"name": "id", "in": "path", "required": true, "schema": map[string]any{"type": "integer", "format": "int64"}},
+				},
+				"delete": map[string]any{
+					"summary":     "Delete a scrub rule",
+					"operationId": "deleteScrubRule",
+					"responses": map[string]any{
+						"204": map[string]any{"description": "Deleted"},
+						"404": map[string]any{"description": "Not found"},
+					},
+				},
+			},
+			"/admin/scrub/test": map[string]any{
+				"post": map[string]any{
+					"summary":     "Scrub a sample log with a rule, or with the enabled rules when none is given, without storing it",
+					"operationId": "testScrubRule",
+					"requestBody": map[string]any{
+						"required": true,
+						"content": map[string]any{
+							"application/json": map[string]any{
+								"schema": map[string]any{
+									"type": "object",
+									"properties": map[string]any{
+										"rule":       map[string]any{"$ref": "#/components/schemas/ScrubRule"},
+										"message":    map[string]any{"type": "string"},
+										"metadata":   map[string]any{"type": "string"},
+										"ip":         map[string]any{"type": "string"},
+										"user_agent": map[string]any{"type": "string"},
+									},
+								},
+							},
+						},
+					},
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "The scrubbed sample",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{
+										"type": "object",
+										"properties": map[string]any{
+											"message":    map[string]any{"type": "string"},
+											"metadata":   map[string]any{"type": "string"},
+											"ip":         map[string]any{"type": "string"},
+											"user_agent": map[string]any{"type": "string"},
+											"redactions": map[string]any{"type": "integer", "description": "How many values were replaced"},
+										},
+									},
+								},
+							},
+						},
+						"400": map[string]any{"description": "Invalid rule"},
+					},
+				},
+			},
+			"/brain/suggest-tags": map[string]any{
+				"post": map[string]any{
+					"summary":     "Suggest tags for text from the tags of similar records, falling back to its keywords",
+					"operationId": "suggestTags",
+					"parameters": []map[string]any{
+						{"name": "limit", "in": "query", "schema": map[string]any{"type": "integer", "minimum": 1, "maximum": 20, "default": 5}},
+					},
+					"requestBody": map[string]any{
+						"required": true,
+						"content": map[string]any{
+							"application/json": map[string]any{
+								"schema": map[string]any{
+									"type":        "object",
+									"description": "Raw text, a record's fields, or both",
+									"properties": map[string]any{
+										"text":    map[string]any{"type": "string"},
+										"title":   map[string]any{"type": "string"},
+										"project": map[string]any{"type": "string"},
+										"context": map[string]any{"type": "string"},
+									},
+								},
+							},
+						},
+					},
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Suggested tags, best first",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{
+										"type": "object",
+										"properties": map[string]any{
+											"tags": map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+										},
+									},
+								},
+							},
+						},
+						"400": map[string]any{"description": "No text, or invalid limit"},
+					},
+				},
+			},
+			"/brain/{id}/summarize": map[string]any{
+				"parameters": []map[string]any{
+					{"name": "id", "in": "path", "required": true, "schema": map[string]any{"type": "integer", "format": "int64"}},
+				},
+				"post": map[string]any{
+					"summary":     "Generate a short summary of a record's context with the configured LLM",
+					"description": "Requires SBRAIN_LLM_URL, an OpenAI-compatible API. With store=true the summary is saved on the record, which is returned with its new version.",
+					"operationId": "summarizeBrain",
+					"parameters": []map[string]any{
+						{"name": "store", "in": "query", "schema": map[string]any{"type": "boolean", "default": false}},
+					},
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "The summary",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{
+										"type":     "object",
+										"required": []string{"summary"},
+										"properties": map[string]any{
+											"summary": map[string]any{"type": "string"},
+											"brain":   map[string]any{"$ref": "#/components/schemas/Brain"},
+										},
+									},
+								},
+							},
+						},
+						"400": map[string]any{"description": "Invalid store, or the record has no context"},
+						"404": map[string]any{"description": "Not found"},
+						"502": map[string]any{"description": "The LLM call failed"},
+						"503": map[string]any{"description": "No LLM configured"},
+					},
+				},
+			},
+			"/ask": map[string]any{
+				"post": map[string]any{
+					"summary":     "Answer a question from the brain records most relevant to it, citing them",
+					"description": "Retrieves the records sharing the most (and rarest) words with the question and sends them with it to the LLM configured by SBRAIN_LLM_URL.",
+					"operationId": "ask",
+					"requestBody": map[string]any{
+						"required": true,
+						"content": map[string]any{
+							"application/json": map[string]any{
+								"schema": map[string]any{
+									"type":     "object",
+									"required": []string{"question"},
+									"properties": map[string]any{
+										"question": map[string]any{"type": "string"},
+										"project":  map[string]any{"type": "string", "description": "Only use records in this project"},
+										"limit":    map[string]any{"type": "integer", "minimum": 1, "maximum": 20, "default": 5, "description": "How many records to send to the LLM"},
+									},
+								},
+							},
+						},
+					},
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "The answer",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{
+										"type": "object",
+										"properties": map[string]any{
+											"answer": map[string]any{"type": "string", "description": "Cites records inline as [#id]"},
+											"citations": map[string]any{
+												"type": "array",
+												"items": map[string]any{
+													"type": "object",
+													"properties": map[string]any{
+														"id":    map[string]any{"type": "integer", "format": "int64"},
+														"title": map[string]any{"type": "string"},
+														"path":  map[string]any{"type": "string"},
+													},
+												},
+											},
+											"sources": map[string]any{"type": "array", "description": "Ids of every record sent to the LLM", "items": map[string]any{"type": "integer", "format": "int64"}},
+										},
+									},
+								},
+							},
+						},
+						"400": map[string]any{"description": "No question, or invalid limit"},
+						"502": map[string]any{"description": "The LLM call failed"},
+						"503": map[string]any{"description": "No LLM configured"},
+					},
+				},
+			},
+			"/capture/url": map[string]any{
+				"post": map[string]any{
+					"summary":     "Clip a web page into a brain record tagged clipped",
+					"description": "Fetches the page server-side and stores its title, canonical URL and article text. The fields may be sent as a JSON body or as query parameters.",
+					"operationId": "captureURL",
+					"parameters": []map[string]any{
+						{"name": "url", "in": "query", "schema": map[string]any{"type": "string", "format": "uri"}},
+						{"name": "project", "in": "query", "schema": map[string]any{"type": "string"}},
+						{"name": "tags", "in": "query", "description": "Comma-separated tags added to clipped", "schema": map[string]any{"type": "string"}},
+					},
+					"requestBody": map[string]any{
+						"content": map[string]any{
+							"application/json": map[string]any{
+								"schema": map[string]any{
+									"type": "object",
+									"properties": map[string]any{
+										"url":     map[string]any{"type": "string", "format": "uri"},
+										"project": map[string]any{"type": "string", "description": "Defaults to SBRAIN_CAPTURE_PROJECT or inbox"},
+										"tags":    map[string]any{"type": "string", "description": "Comma-separated tags added to clipped"},
+									},
+								},
+							},
+						},
+					},
+					"responses": map[string]any{
+						"201": map[string]any{
+							"description": "Created brain record",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{"$ref": "#/components/schemas/Brain"},
+								},
+							},
+						},
+						"400": map[string]any{"description": "Missing or invalid url"},
+						"502": map[string]any{"description": "The page could not be fetched or is not HTML or text"},
+					},
+				},
+			},
+			"/capture": map[string]any{
+				"post": map[string]any{
+					"summary":     "Clip a selection, note or screenshot from a browser extension into a brain record tagged clipped",
+					"description": "CORS is enabled for this endpoint. A key with the capture scope may call it and nothing else.",
+					"operationId": "capture",
+					"requestBody": map[string]any{
+						"required": true,
+						"content": map[string]any{
+							"application/json": map[string]any{
+								"schema": map[string]any{
+									"type":        "object",
+									"description": "At least one of url, selection and note is required",
+									"properties": map[string]any{
+										"title":      map[string]any{"type": "string"},
+										"url":        map[string]any{"type": "string", "format": "uri"},
+										"selection":  map[string]any{"type": "string", "description": "Selected text, quoted in the context"},
+										"note":       map[string]any{"type": "string"},
+										"screenshot": map[string]any{"type": "string", "description": "Base64 PNG, JPEG or WebP image, or a data: URL holding one; stored as an attachment"},
+										"project":    map[string]any{"type": "string", "description": "Defaults to SBRAIN_CAPTURE_PROJECT or inbox"},
+										"tags":       map[string]any{"type": "string", "description": "Comma-separated tags added to clipped"},
+									},
+								},
+							},
+						},
+					},
+					"responses": map[string]any{
+						"201": map[string]any{
+							"description": "Created brain record and screenshot attachment",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{
+										"type": "object",
+										"properties": map[string]any{
+											"brain":       map[string]any{"$ref": "#/components/schemas/Brain"},
+											"attachments": map[string]any{"type": "array", "items": map[string]any{"$ref": "#/components/schemas/Attachment"}},
+										},
+									},
+								},
+							},
+						},
+						"400": map[string]any{"description": "Nothing to capture, or an invalid url or screenshot"},
+						"413": map[string]any{"description": "Body larger than 10 MiB"},
+					},
+				},
+			},
+			"/quick": map[string]any{
+				"parameters": []map[string]any{
+					{"name": "text", "in": "query", "description": "The note; its first line becomes the title", "schema": map[string]any{"type": "string"}},
+					{"name": "title", "in": "query", "schema": map[string]any{"type": "string"}},
+					{"name": "project", "in": "query", "description": "Defaults to SBRAIN_CAPTURE_PROJECT or inbox", "schema": map[string]any{"type": "string"}},
+					{"name": "tags", "in": "query", "description": "Comma-separated tags", "schema": map[string]any{"type": "string"}},
+					{"name": "key", "in": "query", "description": "API key, for clients that cannot send headers", "schema": map[string]any{"type": "string"}},
+				},
+				"get": map[string]any{
+					"summary":     "Quick-capture a note from a link, shortcut or intent",
+					"description": "Creates a record even though it is a GET, so it needs the write or capture scope. Answers a small HTML confirmation page unless the client accepts only JSON.",
+					"operationId": "quickCapture",
+					"responses":   quickCaptureResponses(),
+				},
+				"post": map[string]any{
+					"summary":     "Quick-capture a note from a form post",
+					"operationId": "quickCapturePost",
+					"requestBody": map[string]any{
+						"content": map[string]any{
+							"application/x-www-form-urlencoded": map[string]any{
+								"schema": map[string]any{
+									"type": "object",
+									"properties": map[string]any{
+										"text":    map[string]any{"type": "string"},
+										"title":   map[string]any{"type": "string"},
+										"project": map[string]any{"type": "string"},
+										"tags":    map[string]any{"type": "string"},
+									},
+								},
+							},
+						},
+					},
+					"responses": quickCaptureResponses(),
+				},
+			},
+			"/integrations/notion/export": map[string]any{
+				"post": map[string]any{
+					"summary":     "Export brain records to a Notion database",
+					"description": "Pushes the records matching the list filters to the database in SBRAIN_NOTION_DATABASE_ID, mapping title, tags and project to properties. Records already exported are only rewritten when they changed since, unless full=true.",
+					"operationId": "notionExport",
+					"parameters": append(brainFilterParameters(),
+						map[string]any{"name": "full", "in": "query", "description": "Rewrite every matching page, changed or not", "schema": map[string]any{"type": "boolean"}},
+						map[string]any{"name": "dry_run", "in": "query", "schema": map[string]any{"type": "boolean"}}),
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Records created, updated, unchanged and failed; failed ones are retried by the next export",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{
+										"type": "object",
+										"properties": map[string]any{
+											"dry_run":   map[string]any{"type": "boolean"},
+											"created":   map[string]any{"type": "array", "items": map[string]any{"type": "integer"}},
+											"updated":   map[string]any{"type": "array", "items": map[string]any{"type": "integer"}},
+											"unchanged": map[string]any{"type": "integer"},
+											"failed": map[string]any{
+												"type": "array",
+												"items": map[string]any{
+													"type": "object",
+													"properties": map[string]any{
+														"id":    map[string]any{"type": "integer"},
+														"error": map[string]any{"type": "string"},
+													},
+												},
+											},
+										},
+									},
+								},
+							},
+						},
+						"400": map[string]any{"description": "Invalid filter"},
+						"503": map[string]any{"description": "Notion is not configured"},
+					},
+				},
+			},
+			"/integrations/git/daily": map[string]any{
+				"post": map[string]any{
+					"summary":     "Summarize a day of commits into a per-project brain record",
+					"description": "Creates or updates one record per project and day, tagged git and daily, whose context lists the day's commits by repository and whose commits field holds them as a JSON array of GitCommit. With commits in the body they are recorded under project; without, the repositories in SBRAIN_GIT_REPOS (only those of repo or project when given) are asked for the day's commits on GitHub or GitLab. Commits already recorded for the day are skipped.",
+					"operationId": "gitDaily",
+					"requestBody": map[string]any{
+						"content": map[string]any{
+							"application/json": map[string]any{
+								"schema": map[string]any{
+									"type": "object",
+									"properties": map[string]any{
+										"project": map[string]any{"type": "string", "description": "Required with commits"},
+										"date":    map[string]any{"type": "string", "format": "date", "description": "The day, in SBRAIN_TZ; default today"},
+										"repo":    map[string]any{"type": "string", "description": "Only pull this configured repository, as owner/name"},
+										"commits": map[string]any{"type": "array", "maxItems": maxGitDailyCommits, "items": map[string]any{"$ref": "#/components/schemas/GitCommit"}},
+									},
+								},
+							},
+						},
+					},
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "The records written and the repositories that could not be pulled",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{
+										"type": "object",
+										"properties": map[string]any{
+											"date": map[string]any{"type": "string", "format": "date"},
+											"records": map[string]any{
+												"type": "array",
+												"items": map[string]any{
+													"type": "object",
+													"properties": map[string]any{
+														"project":  map[string]any{"type": "string"},
+														"brain_id": map[string]any{"type": "integer"},
+														"created":  map[string]any{"type": "boolean"},
+														"commits":  map[string]any{"type": "integer", "description": "Commits on the record"},
+														"added":    map[string]any{"type": "integer", "description": "Commits this request added"},
+													},
+												},
+											},
+											"failed": map[string]any{
+												"type": "array",
+												"items": map[string]any{
+													"type": "object",
+													"properties": map[string]any{
+														"repo":  map[string]any{"type": "string"},
+														"error": map[string]any{"type": "string"},
+													},
+												},
+											},
+										},
+									},
+								},
+							},
+						},
+						"400": map[string]any{"description": "Malformed body or invalid fields"},
+						"404": map[string]any{"description": "No configured repository matches repo and project"},
+						"503": map[string]any{"description": "No commits in the body and SBRAIN_GIT_REPOS is not set"},
+					},
+				},
+			},
+			"/integrations/ci": map[string]any{
+				"post": map[string]any{
+					"summary":     "Record a CI build result as a log and in the project's daily record",
+					"description": "Stores the result as a log (info for success, error for failed, warn for canceled) with the build in metadata.ci. With journal true, or by default when the build failed, it is also appended to the project's record for the day of finished_at, the record POST /integrations/git/daily keeps.",
+					"operationId": "recordCIBuild",
+					"requestBody": map[string]any{
+						"required": true,
+						"content": map[string]any{
+							"application/json": map[string]any{
+								"schema": map[string]any{
+									"type":     "object",
+									"required": []string{"pipeline", "status"},
+									"properties": map[string]any{
+										"pipeline":         map[string]any{"type": "string"},
+										"status":           map[string]any{"type": "string", "description": "success, failed or canceled; common synonyms such as passed, failure and cancelled are accepted"},
+										"duration_seconds": map[string]any{"type": "number"},
+										"url":              map[string]any{"type": "string", "format": "uri"},
+										"branch":           map[string]any{"type": "string"},
+										"commit":           map[string]any{"type": "string"},
+										"finished_at":      map[string]any{"type": "string", "format": "date-time", "description": "Default now"},
+										"project":          map[string]any{"type": "string", "description": "Required to append to the daily record"},
+										"journal":          map[string]any{"type": "boolean", "description": "Append to the daily record; default true for failed builds"},
+									},
+								},
+							},
+						},
+					},
+					"responses": map[string]any{
+						"201": map[string]any{
+							"description": "The log stored and, when journaled, the daily record",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{
+										"type": "object",
+										"properties": map[string]any{
+											"log_id": map[string]any{"type": "integer"},
+											"brain": map[string]any{
+												"type": "object",
+												"properties": map[string]any{
+													"project":  map[string]any{"type": "string"},
+													"brain_id": map[string]any{"type": "integer"},
+													"created":  map[string]any{"type": "boolean"},
+												},
+											},
+										},
+									},
+								},
+							},
+						},
+						"400": map[string]any{"description": "Malformed body or invalid fields"},
+					},
+				},
+			},
+			"/admin/config": map[string]any{
+				"get": map[string]any{
+					"summary":     "Show the effective runtime configuration, with secrets redacted",
+					"description": "The resolved database path and SQLite pragmas, timezone, retention, authentication mode, optional features and every SBRAIN_* variable that is set. Secret values read [redacted]. Needs the admin scope.",
+					"operationId": "getAdminConfig",
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "The configuration",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{
+										"type": "object",
+										"properties": map[string]any{
+											"database":    map[string]any{"type": "object", "description": "path, resolved_path, exists, size_bytes, driver, pragmas and pool"},
+											"timezone":    map[string]any{"type": "string"},
+											"retention":   map[string]any{"type": "object"},
+											"auth":        map[string]any{"type": "object", "description": "mode, the API key names with their scopes and projects, and the OIDC issuer"},
+											"features":    map[string]any{"type": "object", "description": "Each optional feature with enabled and its settings"},
+											"environment": map[string]any{"type": "object", "additionalProperties": map[string]any{"type": "string"}},
+										},
+									},
+								},
+							},
+						},
+						"403": map[string]any{"description": "The key lacks the admin scope"},
+					},
+				},
+			},
+			"/admin/flags":        featureFlagListSpec(),
+			"/admin/flags/{name}": featureFlagSpec(),
+			"/admin/maintenance": map[string]any{
+				"get": map[string]any{
+					"summary":     "Show whether maintenance mode is on, and the outcome of the last operation",
+					"operationId": "getMaintenance",
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "The maintenance state",
+							"content":     map[string]any{"application/json": map[string]any{"schema": map[string]any{"$ref": "#/components/schemas/Maintenance"}}},
+						},
+					},
+				},
+				"post": map[string]any{
+					"summary":     "Turn on maintenance mode: every route but /admin/* and the health checks answers 503 with Retry-After",
+					"description": "With an operation (backup writes a VACUUM INTO copy to SBRAIN_BACKUP_DIR; migrate applies the bundled migrations) the server runs it and turns maintenance mode off when it finishes. Without one, the window lasts until DELETE /admin/maintenance or until duration (default 30m) runs out.",
+					"operationId": "startMaintenance",
+					"requestBody": map[string]any{
+						"required": true,
+						"content": map[string]any{
+							"application/json": map[string]any{
+								"schema": map[string]any{
+									"type": "object",
+									"properties": map[string]any{
+										"reason":    map[string]any{"type": "string"},
+										"operation": map[string]any{"type": "string", "enum": []string{"backup", "migrate"}},
+										"duration":  map[string]any{"type": "string", "description": "How long a window without an operation lasts, such as 15m; at most 24h"},
+									},
+								},
+							},
+						},
+					},
+					"responses": map[string]any{
+						"201": map[string]any{
+							"description": "Maintenance mode is on until DELETE or the duration runs out",
+							"content":     map[string]any{"application/json": map[string]any{"schema": map[string]any{"$ref": "#/components/schemas/Maintenance"}}},
+						},
+						"202": map[string]any{
+							"description": "The operation is running; maintenance mode ends when it finishes",
+							"content":     map[string]any{"application/json": map[string]any{"schema": map[string]any{"$ref": "#/components/schemas/Maintenance"}}},
+						},
+						"409": map[string]any{"description": "Maintenance mode is already on"},
+					},
+				},
+				"delete": map[string]any{
+					"summary":     "Turn maintenance mode off",
+					"operationId": "stopMaintenance",
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "Maintenance mode is off",
+							"content":     map[string]any{"application/json": map[string]any{"schema": map[string]any{"$ref": "#/components/schemas/Maintenance"}}},
+						},
+						"409": map[string]any{"description": "Maintenance mode is not on, or an operation is running"},
+					},
+				},
+			},
+			"/admin/db/vacuum": dbOperationSpec("Run VACUUM, returning free pages to the filesystem", "vacuumDatabase", map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"bytes_before":      map[string]any{"type": "integer"},
+					"bytes_after":       map[string]any{"type": "integer"},
+					"freed_bytes":       map[string]any{"type": "integer"},
+					"free_pages_before": map[string]any{"type": "integer"},
+					"free_pages_after":  map[string]any{"type": "integer"},
+					"duration_ms":       map[string]any{"type": "integer"},
+				},
+			}),
+			"/admin/db/integrity-check": dbOperationSpec("Run PRAGMA quick_check, then PRAGMA integrity_check table by table", "integrityCheckDatabase", map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"ok":              map[string]any{"type": "boolean"},
+					"quick_check":     map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "Problems quick_check found"},
+					"integrity_check": map[string]any{"type": "object", "additionalProperties": map[string]any{"type": "array", "items": map[string]any{"type": "string"}}, "description": "Problems integrity_check found, by table"},
+					"tables":          map[string]any{"type": "integer"},
+					"duration_ms":     map[string]any{"type": "integer"},
+				},
+			}),
+			"/admin/db/analyze": dbOperationSpec("Run ANALYZE table by table, then PRAGMA optimize, refreshing query planner statistics", "analyzeDatabase", map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"tables":      map[string]any{"type": "integer"},
+					"duration_ms": map[string]any{"type": "integer"},
+				},
+			}),
+			"/admin/db/explain": map[string]any{
+				"get": map[string]any{
+					"summary":     "Show the SQLite query plans of the canned list queries",
+					"description": "Plans list_brains, list_logs and log_stats, or only the one named by query, for the filters in the rest of the query string as the list endpoints take them. scans lists the steps that read a whole table. Needs the admin scope.",
+					"operationId": "explainQueries",
+					"parameters": []map[string]any{
+						{"name": "query", "in": "query", "schema": map[string]any{"type": "string", "enum": []string{"list_brains", "list_logs", "log_stats"}}},
+					},
+					"responses": map[string]any{
+						"200": map[string]any{
+							"description": "One plan per query",
+							"content": map[string]any{
+								"application/json": map[string]any{
+									"schema": map[string]any{
+										"type": "array",
+										"items": map[string]any{
+											"type": "object",
+											"properties": map[string]any{
+												"query": map[string]any{"type": "string"},
+												"sql":   map[string]any{"type": "string"},
+												"args":  map[string]any{"type": "array", "items": map[string]any{}},
+												"plan": map[string]any{"type": "array", "items": map[string]any{
+													"type": "object",
+													"properties": map[string]any{
+														"id":     map[string]any{"type": "integer"},
+														"parent": map[string]any{"type": "integer"},
+														"detail": map[string]any{"type": "string"},
+													},
+												}},
+												"scans": map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+											},
+										},
+									},
+								},
+							},
+						},
+						"400": map[string]any{"description": "Unknown query or invalid filter"},
+					},
+				},
+			},
+			"/admin/seed": seedSpec(),
+		},
+		"security": []map[string]any{
+			{"bearerAuth": []string{}},
+			{"apiKeyAuth": []string{}},
+			{},
+		},
+		"components": map[string]any{
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "API key from SBRAIN_API_KEYS or a token from /auth/token",
+				},
+				"apiKeyAuth": map[string]any{
+					"type": "apiKey",
+					"in":   "header",
+					"name": "X-API-Key",
+				},
+			},
+			"schemas": map[string]any{
+				"Brain": map[string]any{
+					"type": "object",
+					"required": []string{
+						"id",
+						"created_at",
+						"updated_at",
+						"title",
+						"context",
+						"project",
+						"commits",
+						"tags",
+					},
+					"properties": map[string]any{
+						"id":         map[string]any{"type": "integer", "format": "int64"},
+						"created_at": map[string]any{"type": "string", "format": "date-time", "description": "timestamp"},
+						"updated_at": map[string]any{"type": "string", "format": "date-time", "description": "timestamp of the last change, maintained by the server"},
+						"title":      map[string]any{"type": "string"},
+						"context":    map[string]any{"type": "string"},
+						"project":    map[string]any{"type": "string"},
+						"commits":    map[string]any{"type": "string"},
+						"tags":       map[string]any{"type": "string"},
+						"remind_at":  map[string]any{"type": "string", "description": "timestamp the record comes due as a reminder, empty for none"},
+						"pinned":     map[string]any{"type": "boolean", "description": "pinned records are listed first"},
+						"favorite":   map[string]any{"type": "boolean"},
+						"archived":   map[string]any{"type": "boolean"},
+						"version":    map[string]any{"type": "integer", "format": "int64", "description": "Incremented on every write"},
+						"summary":    map[string]any{"type": "string", "description": "Short digest of the context, usually from POST /brain/{id}/summarize"},
+					},
+				},
+				"BrainCreate": map[string]any{
+					"type": "object",
+					"required": []string{
+						"title",
+						"context",
+						"project",
+					},
+					"properties": map[string]any{
+						"title":     map[string]any{"type": "string"},
+						"context":   map[string]any{"type": "string"},
+						"project":   map[string]any{"type": "string"},
+						"commits":   map[string]any{"type": "string"},
+						"tags":      map[string]any{"type": "string"},
+						"remind_at": map[string]any{"type": "string", "format": "date-time", "description": "When to be reminded"},
+						"pinned":    map[string]any{"type": "boolean"},
+						"favorite":  map[string]any{"type": "boolean"},
+						"archived":  map[string]any{"type": "boolean"},
+						"summary":   map[string]any{"type": "string", "maxLength": 2000},
+					},
+				},
+				"BrainUpdate": map[string]any{
+					"type": "object",
+					"required": []string{
+						"title",
+						"context",
+						"project",
+						"version",
+					},
+					"properties": map[string]any{
+						"title":     map[string]any{"type": "string"},
+						"context":   map[string]any{"type": "string"},
+						"project":   map[string]any{"type": "string"},
+						"commits":   map[string]any{"type": "string"},
+						"tags":      map[string]any{"type": "string"},
+						"remind_at": map[string]any{"type": "string", "format": "date-time", "description": "Omit to keep the current reminder"},
+						"pinned":    map[string]any{"type": "boolean", "description": "Omit to keep the current value"},
+						"favorite":  map[string]any{"type": "boolean", "description": "Omit to keep the current value"},
+						"archived":  map[string]any{"type": "boolean", "description": "Omit to keep the current value"},
+						"summary":   map[string]any{"type": "string", "maxLength": 2000, "description": "Omit to keep the current summary, or to clear it when the context changes"},
+						"version":   map[string]any{"type": "integer", "format": "int64", "description": "The version the edit was made from"},
+					},
+				},
+				"LogEntry": map[string]any{
+					"type": "object",
+					"required": []string{
+						"id",
+						"created_at",
+						"level",
+						"message",
+						"endpoint",
+						"method",
+						"ip",
+						"user_agent",
+						"request_id",
+						"metadata",
+					},
+					"properties": map[string]any{
+						"id":               map[string]any{"type": "integer", "format": "int64"},
+						"created_at":       map[string]any{"type": "string", "format": "date-time", "description": "When the entry was stored (set by the server)"},
+						"occurred_at":      map[string]any{"type": "string", "format": "date-time", "description": "When the event happened; defaults to created_at. Used for ordering and the since/until filters"},
+						"level":            map[string]any{"type": "string"},
+						"message":          map[string]any{"type": "string"},
+						"endpoint":         map[string]any{"type": "string"},
+						"method":           map[string]any{"type": "string"},
+						"ip":               map[string]any{"type": "string"},
+						"user_agent":       map[string]any{"type": "string"},
+						"request_id":       map[string]any{"type": "string"},
+						"status_code":      map[string]any{"type": "integer", "format": "int32", "nullable": true},
+						"response_time_ms": map[string]any{"type": "integer", "format": "int32", "nullable": true},
+						"metadata":         map[string]any{"type": "string"},
+						"brain_id":         map[string]any{"type": "integer", "format": "int64", "description": "Brain record this log is linked to"},
+						"count":            map[string]any{"type": "integer", "format": "int64", "description": "Identical consecutive logs this row stands for (log deduplication)"},
+						"last_seen_at":     map[string]any{"type": "string", "format": "date-time", "description": "When the last of them occurred; absent while count is 1"},
+						"sampled":          map[string]any{"type": "boolean", "description": "Kept by ingestion sampling"},
+						"sample_rate":      map[string]any{"type": "number", "description": "Fraction of such logs sampling keeps, when sampled"},
+						"project":          map[string]any{"type": "string", "description": "Project the log belongs to; always the key's project for project-bound keys"},
+						"service":          map[string]any{"type": "string", "description": "Application the log came from"},
+						"labels":           map[string]any{"type": "object", "additionalProperties": map[string]any{"type": "string"}, "description": "Labels attached at ingestion"},
+					},
+				},
+				"LogCreate": map[string]any{
+					"type": "object",
+					"required": []string{
+						"message",
+					},
+					"properties": map[string]any{
+						"level":            map[string]any{"type": "string", "default": "info"},
+						"message":          map[string]any{"type": "string"},
+						"endpoint":         map[string]any{"type": "string"},
+						"method":           map[string]any{"type": "string"},
+						"ip":               map[string]any{"type": "string"},
+						"user_agent":       map[string]any{"type": "string"},
+						"request_id":       map[string]any{"type": "string"},
+						"status_code":      map[string]any{"type": "integer", "format": "int32", "nullable": true},
+						"response_time_ms": map[string]any{"type": "integer", "format": "int32", "nullable": true},
+						"metadata":         map[string]any{"type": "string"},
+						"brain_id":         map[string]any{"type": "integer", "format": "int64", "description": "Link the log to this brain record"},
+						"service":          map[string]any{"type": "string", "description": "Application the log came from; defaults to the X-Sbrain-Service header, then the API key's service, and is required in production"},
+						"labels":           map[string]any{"type": "object", "additionalProperties": map[string]any{"type": "string"}, "maxProperties": 20, "description": "key=value labels to filter by with ?label=key:value, such as service or env"},
+					},
+				},
+				"Digest": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"period":      map[string]any{"type": "string", "enum": []string{"daily", "weekly"}},
+						"start":       map[string]any{"type": "string", "format": "date"},
+						"end":         map[string]any{"type": "string", "format": "date"},
+						"brain_count": map[string]any{"type": "integer"},
+						"error_count": map[string]any{"type": "integer"},
+						"brains": map[string]any{
+							"type":  "array",
+							"items": map[string]any{"$ref": "#/components/schemas/Brain"},
+						},
+						"projects": map[string]any{
+							"type": "array",
+							"items": map[string]any{
+								"type": "object",
+								"properties": map[string]any{
+									"project": map[string]any{"type": "string"},
+									"brains": map[string]any{
+										"type":  "array",
+										"items": map[string]any{"$ref": "#/components/schemas/Brain"},
+									},
+								},
+							},
+						},
+						"errors": map[string]any{
+							"type":  "array",
+							"items": map[string]any{"$ref": "#/components/schemas/LogEntry"},
+						},
+					},
+				},
+				"DigestDestination": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"id":               map[string]any{"type": "integer", "format": "int64"},
+						"created_at":       map[string]any{"type": "string", "format": "date-time", "description": "timestamp"},
+						"kind":             map[string]any{"type": "string", "enum": []string{"email", "slack"}},
+						"target":           map[string]any{"type": "string", "description": "email address or Slack webhook URL"},
+						"send_at":          map[string]any{"type": "string", "description": "HH:MM (UTC)"},
+						"group_by_project": map[string]any{"type": "boolean"},
+						"enabled":          map[string]any{"type": "boolean"},
+						"last_sent_on":     map[string]any{"type": "string"},
+					},
+				},
+				"DigestDestinationCreate": map[string]any{
+					"type": "object",
+					"required": []string{
+						"kind",
+						"target",
+					},
+					"properties": map[string]any{
+						"kind":             map[string]any{"type": "string", "enum": []string{"email", "slack"}},
+						"target":           map[string]any{"type": "string"},
+						"send_at":          map[string]any{"type": "string", "default": "18:00"},
+						"group_by_project": map[string]any{"type": "boolean", "default": false},
+						"enabled":          map[string]any{"type": "boolean", "default": true},
+					},
+				},
+				"Attachment": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"id":           map[string]any{"type": "integer", "format": "int64"},
+						"created_at":   map[string]any{"type": "string", "format": "date-time", "description": "timestamp"},
+						"brain_id":     map[string]any{"type": "integer", "format": "int64"},
+						"filename":     map[string]any{"type": "string"},
+						"content_type": map[string]any{"type": "string"},
+						"size_bytes":   map[string]any{"type": "integer", "format": "int64"},
+					},
+				},
+				"CountBucket": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"key":   map[string]any{"type": "string"},
+						"count": map[string]any{"type": "integer", "format": "int64"},
+					},
+				},
+				"LogStats": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"total":           map[string]any{"type": "integer", "format": "int64"},
+						"by_level":        map[string]any{"type": "array", "items": map[string]any{"$ref": "#/components/schemas/CountBucket"}},
+						"by_service":      map[string]any{"type": "array", "items": map[string]any{"$ref": "#/components/schemas/CountBucket"}},
+						"by_endpoint":     map[string]any{"type": "array", "items": map[string]any{"$ref": "#/components/schemas/CountBucket"}},
+						"by_status_class": map[string]any{"type": "array", "items": map[string]any{"$ref": "#/components/schemas/CountBucket"}},
+						"by_browser":      map[string]any{"type": "array", "description": "From the parsed user agent; logs without one count under an empty key", "items": map[string]any{"$ref": "#/components/schemas/CountBucket"}},
+						"by_os":           map[string]any{"type": "array", "items": map[string]any{"$ref": "#/components/schemas/CountBucket"}},
+						"by_device":       map[string]any{"type": "array", "description": "desktop, mobile, tablet, bot or other", "items": map[string]any{"$ref": "#/components/schemas/CountBucket"}},
+						"by_time": map[string]any{
+							"type": "array",
+							"items": map[string]any{
+								"type": "object",
+								"properties": map[string]any{
+									"bucket": map[string]any{"type": "string"},
+									"count":  map[string]any{"type": "integer", "format": "int64"},
+									"errors": map[string]any{"type": "integer", "format": "int64"},
+								},
+							},
+						},
+						"response_time_ms": map[string]any{
+							"type": "object",
+							"properties": map[string]any{
+								"count": map[string]any{"type": "integer", "format": "int64"},
+								"avg":   map[string]any{"type": "number", "nullable": true},
+								"p50":   map[string]any{"type": "integer", "nullable": true},
+								"p95":   map[string]any{"type": "integer", "nullable": true},
+								"p99":   map[string]any{"type": "integer", "nullable": true},
+							},
+						},
+					},
+				},
+				"BrainStats": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"total":      map[string]any{"type": "integer", "format": "int64"},
+						"by_project": map[string]any{"type": "array", "items": map[string]any{"$ref": "#/components/schemas/CountBucket"}},
+						"by_tag":     map[string]any{"type": "array", "items": map[string]any{"$ref": "#/components/schemas/CountBucket"}},
+						"per_week": map[string]any{
+							"type": "array",
+							"items": map[string]any{
+								"type": "object",
+								"properties": map[string]any{
+									"week_start": map[string]any{"type": "string", "format": "date"},
+									"count":      map[string]any{"type": "integer", "format": "int64"},
+								},
+							},
+						},
+						"avg_context_length": map[string]any{"type": "number"},
+						"most_linked": map[string]any{
+							"type": "array",
+							"items": map[string]any{
+								"type": "object",
+								"properties": map[string]any{
+									"id":      map[string]any{"type": "integer", "format": "int64"},
+									"title":   map[string]any{"type": "string"},
+									"project": map[string]any{"type": "string"},
+									"links":   map[string]any{"type": "integer"},
+								},
+							},
+						},
+					},
+				},
+				"AuditEntry": map[string]any{
+					"type":     "object",
+					"required": []string{"id", "created_at", "actor", "action", "resource"},
+					"properties": map[string]any{
+						"id":          map[string]any{"type": "integer", "format": "int64"},
+						"created_at":  map[string]any{"type": "string", "format": "date-time"},
+						"actor":       map[string]any{"type": "string"},
+						"action":      map[string]any{"type": "string", "enum": []string{"create", "update", "delete", "restore", "purge"}},
+						"resource":    map[string]any{"type": "string"},
+						"resource_id": map[string]any{"type": "integer", "format": "int64"},
+						"before":      map[string]any{"type": "object", "description": "Resource before the change; absent for creates"},
+						"after":       map[string]any{"type": "object", "description": "Resource after the change; absent for deletes"},
+						"diff":        map[string]any{"type": "object", "description": "Changed fields mapped to {before, after}"},
+					},
+				},
+				"TrashedBrain": map[string]any{
+					"allOf": []map[string]any{
+						{"$ref": "#/components/schemas/Brain"},
+						{
+							"type": "object",
+							"properties": map[string]any{
+								"deleted_at": map[string]any{"type": "string", "format": "date-time"},
+								"deleted_by": map[string]any{"type": "string"},
+								"purge_at":   map[string]any{"type": "string", "format": "date-time", "description": "When the record is permanently removed"},
+							},
+						},
+					},
+				},
+				"SyncResponse": map[string]any{
+					"type":     "object",
+					"required": []string{"brains", "deleted", "cursor"},
+					"properties": map[string]any{
+						"brains": map[string]any{"type": "array", "items": map[string]any{"$ref": "#/components/schemas/Brain"}},
+						"deleted": map[string]any{
+							"type": "array",
+							"items": map[string]any{
+								"type": "object",
+								"properties": map[string]any{
+									"id":         map[string]any{"type": "integer", "format": "int64"},
+									"deleted_at": map[string]any{"type": "string", "format": "date-time"},
+								},
+							},
+						},
+						"cursor": map[string]any{"type": "string", "format": "date-time", "description": "Pass as since on the next call"},
+					},
+				},
+				"AlertRule": map[string]any{
+					"type":     "object",
+					"required": []string{"name", "threshold", "window_minutes", "channel", "target"},
+					"properties": map[string]any{
+						"id":               map[string]any{"type": "integer", "format": "int64", "readOnly": true},
+						"created_at":       map[string]any{"type": "string", "format": "date-time", "readOnly": true},
+						"name":             map[string]any{"type": "string"},
+						"level":            map[string]any{"type": "string", "description": "Only count logs with this level"},
+						"endpoint":         map[string]any{"type": "string", "description": "Only count logs for this endpoint"},
+						"method":           map[string]any{"type": "string"},
+						"status_code":      map[string]any{"type": "integer"},
+						"message_contains": map[string]any{"type": "string"},
+						"threshold":        map[string]any{"type": "integer", "description": "Fire when more than this many logs match"},
+						"window_minutes":   map[string]any{"type": "integer", "minimum": 1},
+						"channel":          map[string]any{"type": "string", "enum": []string{"webhook", "slack", "email"}},
+						"target":           map[string]any{"type": "string", "description": "Webhook URL, Slack incoming webhook URL, or email address"},
+						"enabled":          map[string]any{"type": "boolean", "default": true},
+						"incident_note":    map[string]any{"type": "boolean", "default": false, "description": "Open a draft incident note in the incidents project each time the rule fires"},
+						"last_fired_at":    map[string]any{"type": "string", "format": "date-time", "readOnly": true},
+					},
+				},
+				"Heartbeat": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"id":               map[string]any{"type": "integer", "format": "int64"},
+						"created_at":       map[string]any{"type": "string", "format": "date-time"},
+						"name":             map[string]any{"type": "string"},
+						"interval_seconds": map[string]any{"type": "integer"},
+						"grace_seconds":    map[string]any{"type": "integer"},
+						"channel":          map[string]any{"type": "string"},
+						"target":           map[string]any{"type": "string"},
+						"status":           map[string]any{"type": "string", "enum": []string{"new", "up", "down"}},
+						"last_ping_at":     map[string]any{"type": "string"},
+						"last_missed_at":   map[string]any{"type": "string"},
+						"due_at":           map[string]any{"type": "string", "description": "When the heartbeat goes down without another ping"},
+					},
+				},
+				"MonitorInput": map[string]any{
+					"type":     "object",
+					"required": []string{"name", "url"},
+					"properties": map[string]any{
+						"name":              map[string]any{"type": "string"},
+						"url":               map[string]any{"type": "string", "description": "Absolute http or https URL"},
+						"method":            map[string]any{"type": "string", "enum": []string{"GET", "HEAD"}, "default": "GET"},
+						"interval_seconds":  map[string]any{"type": "integer", "minimum": 30, "default": 60},
+						"timeout_seconds":   map[string]any{"type": "integer", "minimum": 1, "maximum": 60, "default": 10},
+						"expected_status":   map[string]any{"type": "integer", "default": 0, "description": "The status a passing check gets; 0 accepts any below 400"},
+						"keyword":           map[string]any{"type": "string", "description": "Text the response body must contain"},
+						"failure_threshold": map[string]any{"type": "integer", "minimum": 1, "default": 2, "description": "Failed checks in a row before the monitor goes down"},
+						"channel":           map[string]any{"type": "string", "enum": []string{"", "webhook", "slack", "email"}},
+						"target":            map[string]any{"type": "string", "description": "Webhook URL, Slack incoming webhook or email address"},
+						"enabled":           map[string]any{"type": "boolean", "default": true},
+					},
+				},
+				"Monitor": map[string]any{
+					"allOf": []map[string]any{
+						{"$ref": "#/components/schemas/MonitorInput"},
+						{
+							"type": "object",
+							"properties": map[string]any{
+								"id":                   map[string]any{"type": "integer", "format": "int64"},
+								"created_at":           map[string]any{"type": "string", "format": "date-time"},
+								"status":               map[string]any{"type": "string", "enum": []string{"new", "up", "down"}},
+								"consecutive_failures": map[string]any{"type": "integer"},
+								"last_checked_at":      map[string]any{"type": "string"},
+								"last_status_code":     map[string]any{"type": "integer", "description": "0 when the last check got no response"},
+								"last_response_ms":     map[string]any{"type": "integer"},
+								"last_error":           map[string]any{"type": "string", "description": "Why the last check failed; empty when it passed"},
+							},
+						},
+					},
+				},
+				"SLO": map[string]any{
+					"type":     "object",
+					"required": []string{"endpoint"},
+					"properties": map[string]any{
+						"id":                   map[string]any{"type": "integer", "format": "int64", "readOnly": true},
+						"created_at":           map[string]any{"type": "string", "format": "date-time", "readOnly": true},
+						"endpoint":             map[string]any{"type": "string", "description": "A logged endpoint; ending in * covers every endpoint with that prefix"},
+						"latency_threshold_ms": map[string]any{"type": "integer", "nullable": true},
+						"latency_objective":    map[string]any{"type": "number", "nullable": true, "description": "Share of requests that must take at most latency_threshold_ms, such as 0.99"},
+						"max_error_rate":       map[string]any{"type": "number", "nullable": true, "description": "Share of requests that may fail (error or fatal level, or a 5xx), such as 0.001"},
+					},
+				},
+				"SLOCompliance": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"objective":        map[string]any{"type": "number", "description": "Share of requests that must be good"},
+						"total":            map[string]any{"type": "integer"},
+						"bad":              map[string]any{"type": "integer"},
+						"compliance":       map[string]any{"type": "number", "nullable": true},
+						"burn_rate":        map[string]any{"type": "number", "nullable": true},
+						"burn_rate_1h":     map[string]any{"type": "number", "nullable": true},
+						"budget_remaining": map[string]any{"type": "number", "nullable": true, "description": "Share of the error budget left; negative once overspent"},
+						"met":              map[string]any{"type": "boolean"},
+					},
+				},
+				"SLOReport": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"window": map[string]any{"type": "string"},
+						"since":  map[string]any{"type": "string", "format": "date-time"},
+						"until":  map[string]any{"type": "string", "format": "date-time"},
+						"slos": map[string]any{
+							"type": "array",
+							"items": map[string]any{
+								"allOf": []map[string]any{
+									{"$ref": "#/components/schemas/SLO"},
+									{
+										"type": "object",
+										"properties": map[string]any{
+											"latency": map[string]any{"$ref": "#/components/schemas/SLOCompliance"},
+											"errors":  map[string]any{"$ref": "#/components/schemas/SLOCompliance"},
+											"met":     map[string]any{"type": "boolean"},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+				"GitCommit": map[string]any{
+					"type":     "object",
+					"required": []string{"sha", "message"},
+					"properties": map[string]any{
+						"sha":       map[string]any{"type": "string"},
+						"repo":      map[string]any{"type": "string", "description": "owner/name"},
+						"author":    map[string]any{"type": "string"},
+						"message":   map[string]any{"type": "string"},
+						"url":       map[string]any{"type": "string", "format": "uri"},
+						"timestamp": map[string]any{"type": "string", "format": "date-time"},
+					},
+				},
+				"AlertEvent": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"id":              map[string]any{"type": "integer", "format": "int64"},
+						"created_at":      map[string]any{"type": "string", "format": "date-time"},
+						"rule_id":         map[string]any{"type": "integer", "format": "int64"},
+						"rule_name":       map[string]any{"type": "string"},
+						"count":           map[string]any{"type": "integer"},
+						"window_start":    map[string]any{"type": "string", "format": "date-time"},
+						"window_end":      map[string]any{"type": "string", "format": "date-time"},
+						"delivered":       map[string]any{"type": "boolean"},
+						"delivery_error":  map[string]any{"type": "string"},
+						"acknowledged_at": map[string]any{"type": "string", "format": "date-time"},
+						"acknowledged_by": map[string]any{"type": "string"},
+						"brain_id":        map[string]any{"type": "integer", "format": "int64", "description": "Incident note opened for this event"},
+					},
+				},
+				"Error": map[string]any{
+					"type":       "object",
+					"required":   []string{"error"},
+					"properties": map[string]any{"error": map[string]any{"$ref": "#/components/schemas/APIError"}},
+				},
+				"APIError": map[string]any{
+					"type":     "object",
+					"required": []string{"code", "message"},
+					"properties": map[string]any{
+						"code":       map[string]any{"type": "string", "description": "Machine-readable code such as not_found, bad_request, unauthorized, forbidden, method_not_allowed or internal"},
+						"message":    map[string]any{"type": "string"},
+						"request_id": map[string]any{"type": "string", "description": "Also returned in the X-Request-ID response header"},
+						"fields": map[string]any{
+							"type":        "array",
+							"description": "Every invalid field, when code is validation_failed",
+							"items":       map[string]any{"$ref": "#/components/schemas/FieldError"},
+						},
+						"current": map[string]any{"type": "object", "description": "The record as stored, when code is conflict because an update was made from a stale version"},
+					},
+				},
+				"FieldError": map[string]any{
+					"type":     "object",
+					"required": []string{"field", "message"},
+					"properties": map[string]any{
+						"field":   map[string]any{"type": "string"},
+						"message": map[string]any{"type": "string"},
+					},
+				},
+				"Status": map[string]any{
+					"type":       "object",
+					"properties": map[string]any{"status": map[string]any{"type": "string"}},
+				},
+				"GrafanaTag": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"text": map[string]any{"type": "string"},
+						"type": map[string]any{"type": "string"},
+					},
+				},
+				"BrainTemplate": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"id":          map[string]any{"type": "integer", "format": "int64", "readOnly": true},
+						"created_at":  map[string]any{"type": "string", "format": "date-time", "readOnly": true},
+						"name":        map[string]any{"type": "string", "description": "URL-safe slug used in ?template="},
+						"description": map[string]any{"type": "string"},
+						"title":       map[string]any{"type": "string", "description": "May contain {{title}}, {{date}}, {{week}} and {{project}}"},
+						"context":     map[string]any{"type": "string", "description": "May contain {{title}}, {{date}}, {{week}} and {{project}}"},
+						"project":     map[string]any{"type": "string"},
+						"tags":        map[string]any{"type": "string"},
+					},
+					"required": []string{"name"},
+				},
+				"BrainSchedule": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"id":            map[string]any{"type": "integer", "format": "int64", "readOnly": true},
+						"created_at":    map[string]any{"type": "string", "format": "date-time", "readOnly": true},
+						"name":          map[string]any{"type": "string"},
+						"template":      map[string]any{"type": "string", "description": "Template completing the record; optional when title and context are set"},
+						"title":         map[string]any{"type": "string", "description": "May contain {{date}}, {{week}} and {{project}}"},
+						"context":       map[string]any{"type": "string"},
+						"project":       map[string]any{"type": "string"},
+						"tags":          map[string]any{"type": "string"},
+						"frequency":     map[string]any{"type": "string", "enum": []string{"daily", "weekly", "monthly"}},
+						"weekday":       map[string]any{"type": "string", "description": "Day of the week for weekly schedules, such as monday"},
+						"day_of_month":  map[string]any{"type": "integer", "minimum": 1, "maximum": 28, "description": "Day for monthly schedules"},
+						"at":            map[string]any{"type": "string", "description": "HH:MM in SBRAIN_TZ (default 08:00)"},
+						"enabled":       map[string]any{"type": "boolean"},
+						"last_run_on":   map[string]any{"type": "string", "readOnly": true},
+						"last_brain_id": map[string]any{"type": "integer", "format": "int64", "readOnly": true},
+					},
+					"required": []string{"name", "frequency"},
+				},
+				"BrainShare": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"id":         map[string]any{"type": "integer", "format": "int64"},
+						"created_at": map[string]any{"type": "string", "format": "date-time"},
+						"created_by": map[string]any{"type": "string"},
+						"brain_id":   map[string]any{"type": "integer", "format": "int64"},
+						"expires_at": map[string]any{"type": "string", "description": "timestamp, empty for no expiry"},
+						"revoked_at": map[string]any{"type": "string", "description": "timestamp, empty while active"},
+						"url":        map[string]any{"type": "string", "description": "Public link; only returned on creation"},
+					},
+				},
+				"SlowReport": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"since":        map[string]any{"type": "string", "format": "date-time"},
+						"threshold_ms": map[string]any{"type": "integer"},
+						"endpoints": map[string]any{
+							"type": "array",
+							"items": map[string]any{
+								"type": "object",
+								"properties": map[string]any{
+									"endpoint":   map[string]any{"type": "string"},
+									"slow":       map[string]any{"type": "integer", "format": "int64"},
+									"slow_ratio": map[string]any{"type": "number"},
+									"max":        map[string]any{"type": "integer"},
+									"response_time_ms": map[string]any{
+										"type": "object",
+										"properties": map[string]any{
+											"count": map[string]any{"type": "integer", "format": "int64"},
+											"avg":   map[string]any{"type": "number", "nullable": true},
+											"p50":   map[string]any{"type": "integer", "nullable": true},
+											"p95":   map[string]any{"type": "integer", "nullable": true},
+											"p99":   map[string]any{"type": "integer", "nullable": true},
+										},
+									},
+									"histogram": map[string]any{
+										"type": "array",
+										"items": map[string]any{
+											"type": "object",
+											"properties": map[string]any{
+												"ge":    map[string]any{"type": "integer"},
+												"lt":    map[string]any{"type": "integer", "nullable": true},
+												"count": map[string]any{"type": "integer", "format": "int64"},
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+				"SelfTest": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"ready":      map[string]any{"type": "boolean"},
+						"checked_at": map[string]any{"type": "string", "format": "date-time"},
+						"checks": map[string]any{
+							"type": "array",
+							"items": map[string]any{
+								"type": "object",
+								"properties": map[string]any{
+									"name":   map[string]any{"type": "string", "enum": []string{"database", "migrations", "schema", "write"}},
+									"ok":     map[string]any{"type": "boolean"},
+									"detail": map[string]any{"type": "string"},
+								},
+							},
+						},
+					},
+				},
+				"DiskUsage": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"state":       map[string]any{"type": "string", "enum": []string{"ok", "warning", "critical", "unknown"}},
+						"db_bytes":    map[string]any{"type": "integer"},
+						"wal_bytes":   map[string]any{"type": "integer"},
+						"free_bytes":  map[string]any{"type": "integer"},
+						"total_bytes": map[string]any{"type": "integer"},
+						"error":       map[string]any{"type": "string"},
+						"checked_at":  map[string]any{"type": "string", "format": "date-time"},
+					},
+				},
+				"ScrubRule": map[string]any{
+					"type":        "object",
+					"description": "Exactly one of preset, pattern and field is set",
+					"required":    []string{"name"},
+					"properties": map[string]any{
+						"id":          map[string]any{"type": "integer", "format": "int64", "readOnly": true},
+						"created_at":  map[string]any{"type": "string", "format": "date-time", "readOnly": true},
+						"name":        map[string]any{"type": "string"},
+						"preset":      map[string]any{"type": "string", "enum": []string{"", "email", "bearer_token", "ip"}, "description": "Built-in pattern; ip also covers the log's ip column"},
+						"pattern":     map[string]any{"type": "string", "description": "Regular expression (RE2 syntax) applied to message and metadata values"},
+						"field":       map[string]any{"type": "string", "description": "Metadata key, at any depth and in any case, whose value is replaced; ip and user_agent also replace those columns"},
+						"replacement": map[string]any{"type": "string", "description": "Defaults to the preset's placeholder, e.g. [email], or [REDACTED]"},
+						"enabled":     map[string]any{"type": "boolean", "default": true},
+					},
+				},
+				"BrainIssue": brainIssueSchema(),
+				"BrainWithIssues": map[string]any{
+					"allOf": []map[string]any{
+						{"$ref": "#/components/schemas/Brain"},
+						{
+							"type": "object",
+							"properties": map[string]any{
+								"issues": map[string]any{"type": "array", "items": map[string]any{"$ref": "#/components/schemas/BrainIssue"}, "description": "Linked Jira and Linear issues, as last fetched"},
+							},
+						},
+					},
+				},
+				"FeatureFlag": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"name":        map[string]any{"type": "string"},
+						"description": map[string]any{"type": "string"},
+						"default":     map[string]any{"type": "boolean"},
+						"env":         map[string]any{"type": "boolean", "nullable": true, "description": "The SBRAIN_FLAGS setting, if any"},
+						"override":    map[string]any{"type": "boolean", "nullable": true, "description": "The override set through /admin/flags, if any; wins over env and default"},
+						"updated_at":  map[string]any{"type": "string", "format": "date-time"},
+						"enabled":     map[string]any{"type": "boolean", "description": "Whether the flag is on"},
+					},
+				},
+				"Maintenance": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"active":     map[string]any{"type": "boolean"},
+						"reason":     map[string]any{"type": "string"},
+						"operation":  map[string]any{"type": "string"},
+						"started_at": map[string]any{"type": "string", "format": "date-time"},
+						"until":      map[string]any{"type": "string", "format": "date-time", "description": "When a window without an operation ends by itself"},
+						"last": map[string]any{
+							"type":        "object",
+							"description": "The outcome of the most recent operation",
+							"properties": map[string]any{
+								"operation":   map[string]any{"type": "string"},
+								"started_at":  map[string]any{"type": "string", "format": "date-time"},
+								"finished_at": map[string]any{"type": "string", "format": "date-time"},
+								"ok":          map[string]any{"type": "boolean"},
+								"detail":      map[string]any{"type": "string"},
+								"error":       map[string]any{"type": "string"},
+							},
+						},
+					},
+				},
+				"Envelope": map[string]any{
+					"type":        "object",
+					"description": "The shape of every JSON response when the request has ?envelope=true or Accept: " + envelopeMediaType + ": the usual body under data (or error), with meta beside it",
+					"properties": map[string]any{
+						"data":  map[string]any{"description": "The response body as it is without the envelope"},
+						"error": map[string]any{"$ref": "#/components/schemas/APIError"},
+						"meta": map[string]any{
+							"type": "object",
+							"properties": map[string]any{
+								"request_id": map[string]any{"type": "string"},
+								"took_ms":    map[string]any{"type": "number", "description": "Time spent serving the request"},
+								"pagination": map[string]any{
+									"type":        "object",
+									"description": "For lists: the number of items, and the limit, whether more matched and the next cursor where the endpoint has them",
+									"properties": map[string]any{
+										"count":    map[string]any{"type": "integer"},
+										"limit":    map[string]any{"type": "integer"},
+										"has_more": map[string]any{"type": "boolean"},
+										"cursor":   map[string]any{"type": "string"},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	return documentAPIVersions(documentErrorResponses(spec))
+}
+
+func (s *Server) getBrains(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseBrainFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	modified, err := s.brains.BrainsModifiedAt(r.Context())
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if notModified(w, r, modified) {
+		return
+	}
+
+	if wantsNDJSON(r) {
+		stream := newNDJSONWriter(w)
+		_ = s.brains.ListBrains(r.Context(), filter, func(b brain) error { return stream.Write(b) })
+		return
+	}
+
+	var items []brain
+	if err := s.brains.ListBrains(r.Context(), filter, func(b brain) error {
+		items = append(items, b)
+		return nil
+	}); err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, listBody(r.Context(), items))
+}
+
+func (s *Server) getBrainByID(w http.ResponseWriter, r *http.Request, id int64) {
+	b, err := s.brains.GetBrain(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, r, http.StatusNotFound, "not found")
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	issues, err := s.loadBrainIssues(r.Context(), id)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, struct {
+		brain
+		Issues []brainIssue `json:"issues"`
+	}{b, issues})
+}
+
+func (s *Server) createBrain(w http.ResponseWriter, r *http.Request) {
+	var req brain
+	if err := decodeCreateBody(w, r, &req); err != nil {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("decode body: %v", err))
+		return
+	}
+	if name := r.URL.Query().Get("template"); name != "" {
+		t, err := s.loadTemplate(r.Context(), name)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				writeError(w, r, http.StatusBadRequest, fmt.Sprintf("unknown template %q", name))
+				return
+			}
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("query template: %v", err))
+			return
+		}
+		req = t.apply(req, time.Now())
+	}
+	// A project-bound key writes into its project without naming it.
+	project, scoped := store.ProjectFromContext(r.Context())
+	if scoped && req.Project == "" {
+		req.Project = project
+	}
+
+	if errs := validateBrain(req); len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+
+	// A record created without tags is answered with suggestions for it,
+	// worked out before it joins the records they are drawn from. They are
+	// drawn from every project, so project-bound keys go without.
+	var suggested []string
+	if strings.TrimSpace(req.Tags) == "" && !scoped {
+		var err error
+		suggested, err = s.suggestTags(r.Context(), req.Title+" "+req.Project+" "+req.Context, defaultTagSuggestions)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	b, err := s.insertBrain(r.Context(), req)
+	if err != nil {
+		if errors.Is(err, store.ErrOutOfProject) {
+			writeError(w, r, http.StatusForbidden, fmt.Sprintf("forbidden: this key may only write to project %q", project))
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSONStatus(w, http.StatusCreated, struct {
+		brain
+		SuggestedTags []string `json:"suggested_tags,omitempty"`
+	}{b, suggested})
+}
+
+// updateBrain replaces the editable fields of a brain record. The body must
+// carry the version it was edited from; a stale one is answered with 409 and
+// the current record. remind_at, pinned, favorite and archived are only
+// changed when the body includes them, so clients unaware of them do not
+// reset them.
+func (s *Server) updateBrain(w http.ResponseWriter, r *http.Request, id int64) {
+	var req struct {
+		brain
+		RemindAt *timestamp `json:"remind_at"`
+		Pinned   *bool      `json:"pinned"`
+		Favorite *bool      `json:"favorite"`
+		Archived *bool      `json:"archived"`
+		Summary  *string    `json:"summary"`
+		Version  *int64     `json:"version"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("decode body: %v", err))
+		return
+	}
+	if req.Summary != nil {
+		req.brain.Summary = *req.Summary
+	}
+
+	if errs := validateBrain(req.brain); len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+	if req.Version == nil {
+		writeError(w, r, http.StatusPreconditionRequired, "version is required: send the version of the record being edited")
+		return
+	}
+
+	before, err := s.brains.GetBrain(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, r, http.StatusNotFound, "not found")
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if *req.Version != before.Version {
+		writeVersionConflict(w, r, before)
+		return
+	}
+
+	after := before
+	after.Title, after.Context, after.Project, after.Commits, after.Tags = req.Title, req.Context, req.Project, req.Commits, req.Tags
+	if req.RemindAt != nil {
+		after.RemindAt = *req.RemindAt
+	}
+	if req.Pinned != nil {
+		after.Pinned = *req.Pinned
+	}
+	if req.Favorite != nil {
+		after.Favorite = *req.Favorite
+	}
+	if req.Archived != nil {
+		after.Archived = *req.Archived
+	}
+	// A summary describes the context it was made from, so a new context
+	// drops it unless the body brings its own.
+	switch {
+	case req.Summary != nil:
+		after.Summary = *req.Summary
+	case after.Context != before.Context:
+		after.Summary = ""
+	}
+	after.UpdatedAt = store.NewTimestamp(time.Now())
+	if after, err = s.brains.UpdateBrain(r.Context(), after); err != nil {
+		s.writeBrainUpdateError(w, r, id, err)
+		return
+	}
+
+	s.recordAudit(r.Context(), auditUpdate, "brain", id, before, after)
+	writeJSON(w, http.StatusOK, after)
+}
+
+// writeBrainUpdateError answers a failed UpdateBrain of the record with id:
+// 404 when it is gone, 409 with the current record when another write got
+// there first, 403 when a project-bound key moves it to another project,
+// 500 otherwise.
+func (s *Server) writeBrainUpdateError(w http.ResponseWriter, r *http.Request, id int64, err error) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		writeError(w, r, http.StatusNotFound, "not found")
+	case errors.Is(err, store.ErrOutOfProject):
+		writeError(w, r, http.StatusForbidden, "forbidden: a project-bound key cannot move records to another project")
+	case errors.Is(err, store.ErrConflict):
+		current, getErr := s.brains.GetBrain(r.Context(), id)
+		if getErr != nil {
+			writeError(w, r, http.StatusInternalServerError, getErr.Error())
+			return
+		}
+		writeVersionConflict(w, r, current)
+	default:
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+	}
+}
+
+// insertBrain stores a brain record and returns it as persisted, including
+// the generated id and created_at. The creation is recorded in the audit log
+// under the actor in ctx.
+func (s *Server) insertBrain(ctx context.Context, req brain) (brain, error) {
+	b, err := s.brains.CreateBrain(ctx, req)
+	if err != nil {
+		return brain{}, err
+	}
+	s.recordAudit(ctx, auditCreate, "brain", b.ID, nil, b)
+	return b, nil
+}
+
+func (s *Server) getLogs(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseLogFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	modified, err := s.logs.LogsModifiedAt(r.Context())
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if notModified(w, r, modified) {
+		return
+	}
+
+	if wantsNDJSON(r) {
+		stream := newNDJSONWriter(w)
+		_ = s.logs.ListLogs(r.Context(), filter, func(l logEntry) error { return stream.Write(l) })
+		return
+	}
+
+	var items []logEntry
+	if err := s.logs.ListLogs(r.Context(), filter, func(l logEntry) error {
+		items = append(items, l)
+		return nil
+	}); err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, listBody(r.Context(), items))
+}
+
+func (s *Server) getLogByID(w http.ResponseWriter, r *http.Request, id int64) {
+	l, err := s.logs.GetLog(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, r, http.StatusNotFound, "not found")
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, l)
+}
+
+func (s *Server) createLog(w http.ResponseWriter, r *http.Request) {
+	var req logEntry
+	if err := decodeCreateBody(w, r, &req); err != nil {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("decode body: %v", err))
+		return
+	}
+	errs, err := s.prepareLog(r, &req)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+
+	id, err := s.insertLog(r.Context(), req)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if id == 0 {
+		writeJSONStatus(w, http.StatusAccepted, map[string]any{"stored": false, "reason": "sampled out"})
+		return
+	}
+
+	l, err := s.logs.GetLog(r.Context(), id)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("load log: %v", err))
+		return
+	}
+	s.forwarder.enqueue(l)
+
+	writeJSONStatus(w, http.StatusCreated, l)
+}
+
+// prepareLog fills in the defaults of a log posted to r and validates it,
+// including that the brain it links to exists.
+func (s *Server) prepareLog(r *http.Request, req *logEntry) ([]FieldError, error) {
+	// created_at is always the ingestion time; clients that backfill with
+	// created_at (accepted before occurred_at existed) get it as occurred_at.
+	if req.OccurredAt == "" {
+		req.OccurredAt = req.CreatedAt
+	}
+	req.CreatedAt = ""
+
+	req.Level = strings.ToLower(strings.TrimSpace(req.Level))
+	if req.Level == "" {
+		req.Level = "info"
+	}
+	if req.Service = strings.TrimSpace(req.Service); req.Service == "" {
+		req.Service = defaultLogService(r)
+	}
+	errs := validateLog(*req)
+	if req.Service == "" && s.requireLogService {
+		errs = append(errs, FieldError{Field: "service", Message: "is required: set it here, in the X-Sbrain-Service header or on the API key"})
+	}
+	if len(errs) == 0 && req.BrainID != nil {
+		if _, err := s.brains.GetBrain(r.Context(), *req.BrainID); err != nil {
+			if !errors.Is(err, store.ErrNotFound) {
+				return nil, err
+			}
+			errs = append(errs, FieldError{Field: "brain_id", Message: "does not exist"})
+		}
+	}
+	return errs, nil
+}
+
+// insertLog stores a log entry and returns the id of the row holding it. It
+// is shared by the HTTP endpoint and the other ingestion paths. Sampling
+// may drop the entry, returning 0. It is then enriched, before the scrub
+// rules can redact its IP, and with deduplication on for its level it may
+// be collapsed into the previous log. Without a service it is refused when
+// services are required. Stored logs are queued for log forwarding.
+func (s *Server) insertLog(ctx context.Context, req logEntry) (int64, error) {
+	if req.Service == "" && s.requireLogService {
+		return 0, errLogServiceRequired
+	}
+	req.Sampled, req.SampleRate = false, 0
+	if !s.sample.sample(&req) {
+		return 0, nil
+	}
+	s.enrichLog(&req)
+	scrubLog(&req, s.scrub.current())
+	var id int64
+	var err error
+	if s.dedup.levels[req.Level] {
+		id, _, err = s.logs.CollapseLog(ctx, req, s.dedup.window)
+	} else {
+		id, err = s.logs.CreateLog(ctx, req)
+	}
+	if err == nil {
+		s.logForward.enqueue(ctx, req, id)
+	}
+	return id, err
+}
+
+// withID adapts a handler that takes a record id to a route with an {id}
+// wildcard, answering 400 when the segment is not an integer.
+func withID(fn func(w http.ResponseWriter, r *http.Request, id int64)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "invalid id")
+			return
+		}
+		fn(w, r, id)
+	}
+}
+
+// publicBaseURL returns the externally reachable base URL of the service,
+// preferring SBRAIN_PUBLIC_URL and falling back to the request's host.
+func publicBaseURL(r *http.Request) string {
+	if base := os.Getenv("SBRAIN_PUBLIC_URL"); base != "" {
+		return strings.TrimRight(base, "/")
+	}
+	scheme := "http"
+	if r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https") {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	writeJSONStatus(w, status, value)
+}
+
+func writeJSONStatus(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,227 @@
+package sbrain
+
+import (
+	"crypto/hmac"
+	"database/sql"
+	_ "embed"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"sbrain/store"
+)
+
+//go:embed web/share.html
+var shareHTML string
+
+var shareTemplate = template.Must(template.New("share").Parse(shareHTML))
+
+// brainShare is a public, read-only link to one brain record. The URL
+// carries a token signed with the session secret, so links only survive a
+// restart when SBRAIN_SESSION_SECRET is set.
+type brainShare struct {
+	ID        int64     `json:"id"`
+	CreatedAt timestamp `json:"created_at"`
+	CreatedBy string    `json:"created_by"`
+	BrainID   int64     `json:"brain_id"`
+	ExpiresAt timestamp `json:"expires_at"`
+	RevokedAt timestamp `json:"revoked_at"`
+	URL       string    `json:"url,omitempty"`
+}
+
+const brainShareColumns = `id, created_at, created_by, brain_id, expires_at, revoked_at`
+
+func scanBrainShare(row interface{ Scan(...any) error }) (brainShare, error) {
+	var sh brainShare
+	err := row.Scan(&sh.ID, &sh.CreatedAt, &sh.CreatedBy, &sh.BrainID, &sh.ExpiresAt, &sh.RevokedAt)
+	return sh, err
+}
+
+// shareClaims is the signed payload of a share token.
+type shareClaims struct {
+	ShareID   int64 `json:"sid"`
+	ExpiresAt int64 `json:"exp,omitempty"`
+}
+
+// shareSignaturePrefix keeps share signatures distinct from session
+// signatures made with the same secret, so neither token passes for the
+// other.
+const shareSignaturePrefix = "share."
+
+func (a *authConfig) issueShareToken(sh brainShare) string {
+	claims := shareClaims{ShareID: sh.ID}
+	if expires, ok := sh.ExpiresAt.Time(); ok {
+		claims.ExpiresAt = expires.Unix()
+	}
+	payload, _ := json.Marshal(claims)
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + a.sign(shareSignaturePrefix+encoded)
+}
+
+func (a *authConfig) verifyShareToken(token string) (shareClaims, error) {
+	var claims shareClaims
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(a.sign(shareSignaturePrefix+encoded))) {
+		return claims, errors.New("invalid share token")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || json.Unmarshal(payload, &claims) != nil {
+		return claims, errors.New("malformed share token")
+	}
+	return claims, nil
+}
+
+// createBrainShare serves POST /brain/{id}/share. The optional body sets
+// expires_in as a Go duration such as "72h".
+func (s *Server) createBrainShare(w http.ResponseWriter, r *http.Request, id int64) {
+	var req struct {
+		ExpiresIn string `json:"expires_in"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("decode body: %v", err))
+		return
+	}
+	var expiresAt timestamp
+	if req.ExpiresIn != "" {
+		ttl, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || ttl <= 0 {
+			writeValidationError(w, r, []FieldError{{Field: "expires_in", Message: "must be a positive duration such as 72h"}})
+			return
+		}
+		expiresAt = store.NewTimestamp(time.Now().Add(ttl))
+	}
+
+	if !s.brainExists(w, r, id) {
+		return
+	}
+
+	res, err := s.db.ExecContext(r.Context(), `INSERT INTO brain_shares (created_by, brain_id, expires_at) VALUES (?, ?, ?)`,
+		actorFromContext(r.Context()), id, expiresAt)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("insert share: %v", err))
+		return
+	}
+	shareID, _ := res.LastInsertId()
+	sh, err := scanBrainShare(s.db.QueryRowContext(r.Context(), `SELECT `+brainShareColumns+` FROM brain_shares WHERE id = ?`, shareID))
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("load share: %v", err))
+		return
+	}
+	s.recordAudit(r.Context(), auditCreate, "share", sh.ID, nil, sh)
+
+	sh.URL = publicBaseURL(r) + "/s/" + s.auth.issueShareToken(sh)
+	writeJSONStatus(w, http.StatusCreated, sh)
+}
+
+// listBrainShares serves GET /brain/{id}/shares, including expired and
+// revoked links. URLs are not repeated; create a new link instead.
+func (s *Server) listBrainShares(w http.ResponseWriter, r *http.Request, id int64) {
+	rows, err := s.db.QueryContext(r.Context(), `SELECT `+brainShareColumns+` FROM brain_shares
+		WHERE brain_id = ? ORDER BY id DESC`, id)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("query shares: %v", err))
+		return
+	}
+	defer rows.Close()
+
+	items := []brainShare{}
+	for rows.Next() {
+		sh, err := scanBrainShare(rows)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("scan share: %v", err))
+			return
+		}
+		items = append(items, sh)
+	}
+	if err := rows.Err(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("iterate shares: %v", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+// revokeBrainShare serves DELETE /shares/{id}. The row is kept, marked
+// revoked, so the audit trail still explains old links.
+func (s *Server) revokeBrainShare(w http.ResponseWriter, r *http.Request, id int64) {
+	before, err := scanBrainShare(s.db.QueryRowContext(r.Context(), `SELECT `+brainShareColumns+` FROM brain_shares WHERE id = ?`, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, r, http.StatusNotFound, "not found")
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("query share: %v", err))
+		return
+	}
+	if before.RevokedAt != "" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	after := before
+	after.RevokedAt = store.NewTimestamp(time.Now())
+	if _, err := s.db.ExecContext(r.Context(), `UPDATE brain_shares SET revoked_at = ? WHERE id = ?`, after.RevokedAt, id); err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("revoke share: %v", err))
+		return
+	}
+	s.recordAudit(r.Context(), auditUpdate, "share", id, before, after)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sharedBrainHandler serves GET /s/{token} without authentication: a
+// read-only HTML view of the shared record. Invalid, revoked and expired
+// links all answer 404 so they reveal nothing.
+func (s *Server) sharedBrainHandler(w http.ResponseWriter, r *http.Request) {
+	claims, err := s.auth.verifyShareToken(r.PathValue("token"))
+	if err != nil {
+		writeError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+	sh, err := scanBrainShare(s.db.QueryRowContext(r.Context(), `SELECT `+brainShareColumns+` FROM brain_shares WHERE id = ?`, claims.ShareID))
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("share %d: %v", claims.ShareID, err)
+		}
+		writeError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+	if expires, ok := sh.ExpiresAt.Time(); sh.RevokedAt != "" || (ok && !time.Now().Before(expires)) {
+		writeError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+	b, err := s.brains.GetBrain(r.Context(), sh.BrainID)
+	if err != nil {
+		writeError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+
+	view := struct {
+		Title, Project, Context, Commits string
+		Created, Updated, ExpiresAt      string
+		Tags                             []string
+	}{
+		Title:     b.Title,
+		Project:   b.Project,
+		Context:   b.Context,
+		Commits:   b.Commits,
+		Created:   b.CreatedAt.Display(),
+		ExpiresAt: sh.ExpiresAt.Display(),
+		Tags:      splitTags(b.Tags),
+	}
+	if b.UpdatedAt != b.CreatedAt {
+		view.Updated = b.UpdatedAt.Display()
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Robots-Tag", "noindex")
+	if err := shareTemplate.Execute(w, view); err != nil {
+		log.Printf("render share %d: %v", sh.ID, err)
+	}
+}
@@ -0,0 +1,295 @@
+package sbrain
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"sbrain/store"
+)
+
+//go:embed web/site.html
+var siteHTML string
+
+//go:embed web/site.js
+var siteJS []byte
+
+var siteTemplate = template.Must(template.New("site").Parse(siteHTML))
+
+// siteSearchTextLimit caps how much of each record's context goes into the
+// search index, which every page loads.
+const siteSearchTextLimit = 5000
+
+// siteLink is a project or tag page and how many records it lists.
+type siteLink struct {
+	Name  string
+	URL   string
+	Count int
+}
+
+type siteRecord struct {
+	ID               int64
+	URL              string
+	Title            string
+	Summary          string
+	Context          string
+	Commits          string
+	Created, Updated string
+	Project          *siteLink
+	Tags             []*siteLink
+}
+
+// sitePage is what web/site.html renders: a record page when Record is set,
+// otherwise a list of records with, on the index, the projects and tags.
+type sitePage struct {
+	SiteTitle string
+	Heading   string
+	// Root is the relative path from the page back to the site's root.
+	Root      string
+	Total     int
+	Generated string
+	Record    *siteRecord
+	Records   []*siteRecord
+	Projects  []*siteLink
+	Tags      []*siteLink
+}
+
+// siteSearchEntry is one record in search-index.js.
+type siteSearchEntry struct {
+	URL     string   `json:"url"`
+	Title   string   `json:"title"`
+	Project string   `json:"project"`
+	Tags    []string `json:"tags"`
+	Text    string   `json:"text"`
+}
+
+// buildSite renders a static, read-only copy of the records matching
+// filter: an index of projects, tags and records, a page per project, tag
+// and record, and a search index the pages query in the browser. Links are
+// relative, so the files work from any directory of any static host. It
+// returns the files by path and how many records they hold.
+func (s *Server) buildSite(ctx context.Context, filter brainFilter) (map[string][]byte, int, error) {
+	var items []brain
+	if err := s.brains.ListBrains(ctx, filter, func(b brain) error {
+		items = append(items, b)
+		return nil
+	}); err != nil {
+		return nil, 0, err
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].CreatedAt != items[j].CreatedAt {
+			return items[i].CreatedAt > items[j].CreatedAt
+		}
+		return items[i].ID > items[j].ID
+	})
+
+	projects, tags := map[string]*siteLink{}, map[string]*siteLink{}
+	usedSlugs := map[string]bool{}
+	group := func(groups map[string]*siteLink, dir, name string) *siteLink {
+		key := strings.ToLower(name)
+		if g, ok := groups[key]; ok {
+			g.Count++
+			return g
+		}
+		slug := siteSlug(name)
+		for n := 2; usedSlugs[dir+slug]; n++ {
+			slug = fmt.Sprintf("%s-%d", siteSlug(name), n)
+		}
+		usedSlugs[dir+slug] = true
+		g := &siteLink{Name: name, URL: dir + "/" + slug + ".html", Count: 1}
+		groups[key] = g
+		return g
+	}
+
+	records := make([]*siteRecord, 0, len(items))
+	search := make([]siteSearchEntry, 0, len(items))
+	for _, b := range items {
+		rec := &siteRecord{
+			ID:      b.ID,
+			URL:     fmt.Sprintf("records/%d.html", b.ID),
+			Title:   b.Title,
+			Summary: b.Summary,
+			Context: b.Context,
+			Commits: b.Commits,
+			Created: b.CreatedAt.Display(),
+		}
+		if b.UpdatedAt != b.CreatedAt {
+			rec.Updated = b.UpdatedAt.Display()
+		}
+		if b.Project != "" {
+			rec.Project = group(projects, "projects", b.Project)
+		}
+		tagNames := splitTags(b.Tags)
+		for _, tag := range tagNames {
+			rec.Tags = append(rec.Tags, group(tags, "tags", tag))
+		}
+		records = append(records, rec)
+
+		text := []rune(b.Context)
+		if len(text) > siteSearchTextLimit {
+			text = text[:siteSearchTextLimit]
+		}
+		if tagNames == nil {
+			tagNames = []string{}
+		}
+		search = append(search, siteSearchEntry{URL: rec.URL, Title: b.Title, Project: b.Project, Tags: tagNames, Text: string(text)})
+	}
+
+	sortLinks := func(groups map[string]*siteLink) []*siteLink {
+		out := make([]*siteLink, 0, len(groups))
+		for _, g := range groups {
+			out = append(out, g)
+		}
+		sort.Slice(out, func(i, j int) bool { return strings.ToLower(out[i].Name) < strings.ToLower(out[j].Name) })
+		return out
+	}
+	base := sitePage{SiteTitle: "sbrain", Total: len(records), Generated: store.NewTimestamp(time.Now()).Display()}
+	files := map[string][]byte{"search.js": siteJS, "favicon.svg": faviconSVG}
+
+	render := func(name string, page sitePage) error {
+		var buf bytes.Buffer
+		if err := siteTemplate.Execute(&buf, page); err != nil {
+			return fmt.Errorf("render %s: %w", name, err)
+		}
+		files[name] = buf.Bytes()
+		return nil
+	}
+	index := base
+	index.Records, index.Projects, index.Tags = records, sortLinks(projects), sortLinks(tags)
+	if err := render("index.html", index); err != nil {
+		return nil, 0, err
+	}
+	for _, rec := range records {
+		page := base
+		page.Root, page.Record = "../", rec
+		if err := render(rec.URL, page); err != nil {
+			return nil, 0, err
+		}
+	}
+	for _, groups := range []struct {
+		links   []*siteLink
+		heading func(string) string
+		member  func(*siteRecord, *siteLink) bool
+	}{
+		{index.Projects, func(name string) string { return "Project " + name }, func(r *siteRecord, g *siteLink) bool { return r.Project == g }},
+		{index.Tags, func(name string) string { return "Tagged " + name }, func(r *siteRecord, g *siteLink) bool {
+			for _, t := range r.Tags {
+				if t == g {
+					return true
+				}
+			}
+			return false
+		}},
+	} {
+		for _, g := range groups.links {
+			page := base
+			page.Root, page.Heading = "../", groups.heading(g.Name)
+			for _, rec := range records {
+				if groups.member(rec, g) {
+					page.Records = append(page.Records, rec)
+				}
+			}
+			if err := render(g.URL, page); err != nil {
+				return nil, 0, err
+			}
+		}
+	}
+
+	indexJSON, err := json.Marshal(search)
+	if err != nil {
+		return nil, 0, fmt.Errorf("encode search index: %w", err)
+	}
+	files["search-index.js"] = []byte("window.sbrainSearchIndex = " + string(indexJSON) + ";\n")
+	return files, len(records), nil
+}
+
+// siteSlug turns a project or tag into a file name: lower case letters,
+// digits, dots, dashes and underscores.
+func siteSlug(name string) string {
+	slug := strings.Trim(strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		}
+		return '-'
+	}, name), "-.")
+	if slug == "" {
+		slug = "untitled"
+	}
+	return slug
+}
+
+// siteExportHandler serves GET /export/site: the static site for the
+// records matching the brain list filters, as a zip to unpack on a static
+// host.
+func (s *Server) siteExportHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseBrainFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	files, _, err := s.buildSite(r.Context(), filter)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	filename := fmt.Sprintf("sbrain-site-%s.zip", time.Now().UTC().Format("20060102"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+
+	zw := zip.NewWriter(w)
+	modified := time.Now()
+	for _, name := range sortedKeys(files) {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+		if err != nil {
+			return
+		}
+		if _, err := fw.Write(files[name]); err != nil {
+			return
+		}
+	}
+	_ = zw.Close()
+}
+
+// ExportSite writes the static site for the records matching filter into
+// dir, creating it if needed, and returns how many records it holds. Files
+// of an earlier export that are no longer part of the site are left alone.
+func (s *Server) ExportSite(ctx context.Context, filter store.BrainFilter, dir string) (int, error) {
+	files, n, err := s.buildSite(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	for _, name := range sortedKeys(files) {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return 0, err
+		}
+		if err := os.WriteFile(path, files[name], 0o644); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+func sortedKeys(files map[string][]byte) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,131 @@
+package sbrain
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// slackMaxClockSkew is how far a request timestamp may drift from the
+// server clock before the request is treated as a replay.
+const slackMaxClockSkew = 5 * time.Minute
+
+// slackCommandHandler receives Slack slash commands such as
+// "/brain remember fixed the flaky deploy #infra". Requests must be signed
+// with SBRAIN_SLACK_SIGNING_SECRET.
+func (s *Server) slackCommandHandler(w http.ResponseWriter, r *http.Request) {
+	secret := os.Getenv("SBRAIN_SLACK_SIGNING_SECRET")
+	if secret == "" {
+		writeError(w, r, http.StatusNotFound, "slack integration is not configured")
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("read body: %v", err))
+		return
+	}
+	if err := verifySlackSignature(secret, r.Header, body, time.Now()); err != nil {
+		writeError(w, r, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("parse form: %v", err))
+		return
+	}
+
+	verb, rest, _ := strings.Cut(strings.TrimSpace(form.Get("text")), " ")
+	if !strings.EqualFold(verb, "remember") {
+		writeJSON(w, http.StatusOK, slackReply("Usage: `"+form.Get("command")+" remember <note> [#project]`"))
+		return
+	}
+
+	req := slackNoteToBrain(rest, form.Get("user_name"))
+	if req.Context == "" {
+		writeJSON(w, http.StatusOK, slackReply("Nothing to remember — add some text after `remember`."))
+		return
+	}
+
+	b, err := s.insertBrain(withActor(r.Context(), "slack:"+form.Get("user_name")), req)
+	if err != nil {
+		writeJSON(w, http.StatusOK, slackReply("Could not save note: "+err.Error()))
+		return
+	}
+
+	link := fmt.Sprintf("%s/brain/%d", publicBaseURL(r), b.ID)
+	writeJSON(w, http.StatusOK, slackReply(fmt.Sprintf("Saved to *%s*: <%s|%s>", b.Project, link, b.Title)))
+}
+
+func verifySlackSignature(secret string, header http.Header, body []byte, now time.Time) error {
+	timestamp := header.Get("X-Slack-Request-Timestamp")
+	signature := header.Get("X-Slack-Signature")
+	if timestamp == "" || signature == "" {
+		return errors.New("missing slack signature headers")
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("invalid slack request timestamp")
+	}
+	if skew := now.Sub(time.Unix(seconds, 0)); skew > slackMaxClockSkew || skew < -slackMaxClockSkew {
+		return errors.New("stale slack request timestamp")
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return errors.New("invalid slack signature")
+	}
+	return nil
+}
+
+// slackNoteToBrain turns free text into a brain record. A trailing "#name"
+// word selects the project; otherwise SBRAIN_SLACK_DEFAULT_PROJECT (or
+// "inbox") is used.
+func slackNoteToBrain(text string, user string) brain {
+	text = strings.TrimSpace(text)
+	project := os.Getenv("SBRAIN_SLACK_DEFAULT_PROJECT")
+	if project == "" {
+		project = "inbox"
+	}
+
+	if i := strings.LastIndex(text, " #"); i >= 0 && !strings.Contains(text[i+2:], " ") && text[i+2:] != "" {
+		project = text[i+2:]
+		text = strings.TrimSpace(text[:i])
+	}
+
+	title := text
+	if line, _, ok := strings.Cut(title, "\n"); ok {
+		title = line
+	}
+	if len([]rune(title)) > 80 {
+		title = string([]rune(title)[:77]) + "..."
+	}
+
+	tags := "slack"
+	if user != "" {
+		tags += ",from:" + user
+	}
+
+	return brain{Title: title, Context: text, Project: project, Tags: tags}
+}
+
+func slackReply(text string) map[string]any {
+	return map[string]any{
+		"response_type": "ephemeral",
+		"text":          text,
+	}
+}
@@ -0,0 +1,362 @@
+package sbrain
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"sbrain/store"
+)
+
+const (
+	defaultSLOWindow = 30 * 24 * time.Hour
+	// sloFastBurnWindow is the recent stretch each burn rate is also given
+	// for, so a budget being spent quickly right now stands out from one
+	// spent long ago.
+	sloFastBurnWindow = time.Hour
+)
+
+// slo is a service level objective for an endpoint, as it appears in the
+// logs. LatencyObjective is the share of requests, such as 0.99, that must
+// take at most LatencyThresholdMs; MaxErrorRate the share, such as 0.001,
+// that may fail, by an error or fatal level or a 5xx status. An Endpoint
+// ending in * covers every endpoint starting with the rest.
+type slo struct {
+	ID                 int64     `json:"id"`
+	CreatedAt          timestamp `json:"created_at"`
+	Endpoint           string    `json:"endpoint"`
+	LatencyThresholdMs *int64    `json:"latency_threshold_ms"`
+	LatencyObjective   *float64  `json:"latency_objective"`
+	MaxErrorRate       *float64  `json:"max_error_rate"`
+}
+
+const sloColumns = `id, created_at, endpoint, latency_threshold_ms, latency_objective, max_error_rate`
+
+func scanSLO(row interface{ Scan(...any) error }) (slo, error) {
+	var o slo
+	err := row.Scan(&o.ID, &o.CreatedAt, &o.Endpoint, &o.LatencyThresholdMs, &o.LatencyObjective, &o.MaxErrorRate)
+	return o, err
+}
+
+func (s *Server) loadSLO(ctx context.Context, id int64) (slo, error) {
+	return scanSLO(s.db.QueryRowContext(ctx, `SELECT `+sloColumns+` FROM slos WHERE id = ?`, id))
+}
+
+func (s *Server) loadSLOs(ctx context.Context) ([]slo, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+sloColumns+` FROM slos ORDER BY endpoint`)
+	if err != nil {
+		return nil, fmt.Errorf("query slos: %w", err)
+	}
+	defer rows.Close()
+
+	items := []slo{}
+	for rows.Next() {
+		o, err := scanSLO(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan slo: %w", err)
+		}
+		items = append(items, o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate slos: %w", err)
+	}
+	return items, nil
+}
+
+func validateSLO(o *slo) []FieldError {
+	o.Endpoint = strings.TrimSpace(o.Endpoint)
+
+	var v validator
+	v.required("endpoint", o.Endpoint)
+	if (o.LatencyThresholdMs == nil) != (o.LatencyObjective == nil) {
+		v.add("latency_objective", "is set together with latency_threshold_ms")
+	}
+	if o.LatencyThresholdMs != nil && *o.LatencyThresholdMs <= 0 {
+		v.add("latency_threshold_ms", "must be positive")
+	}
+	if o.LatencyObjective != nil && (*o.LatencyObjective <= 0 || *o.LatencyObjective >= 1) {
+		v.add("latency_objective", "must be between 0 and 1, such as 0.99")
+	}
+	if o.MaxErrorRate != nil && (*o.MaxErrorRate <= 0 || *o.MaxErrorRate >= 1) {
+		v.add("max_error_rate", "must be between 0 and 1, such as 0.001")
+	}
+	if o.LatencyObjective == nil && o.LatencyThresholdMs == nil && o.MaxErrorRate == nil {
+		v.add("max_error_rate", "or a latency objective is required")
+	}
+	return v.errors
+}
+
+// listSLOs serves GET /slos.
+func (s *Server) listSLOs(w http.ResponseWriter, r *http.Request) {
+	items, err := s.loadSLOs(r.Context())
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+// createSLO serves POST /slos.
+func (s *Server) createSLO(w http.ResponseWriter, r *http.Request) {
+	var req slo
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("decode body: %v", err))
+		return
+	}
+	if errs := validateSLO(&req); len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+	if s.sloEndpointTaken(r.Context(), req.Endpoint, 0) {
+		writeError(w, r, http.StatusConflict, fmt.Sprintf("endpoint %q already has an slo", req.Endpoint))
+		return
+	}
+	res, err := s.db.ExecContext(r.Context(), `INSERT INTO slos (endpoint, latency_threshold_ms, latency_objective, max_error_rate)
+		VALUES (?, ?, ?, ?)`, req.Endpoint, req.LatencyThresholdMs, req.LatencyObjective, req.MaxErrorRate)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("insert slo: %v", err))
+		return
+	}
+	id, _ := res.LastInsertId()
+	o, err := s.loadSLO(r.Context(), id)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("load slo: %v", err))
+		return
+	}
+	s.recordAudit(r.Context(), auditCreate, "slo", o.ID, nil, o)
+	writeJSONStatus(w, http.StatusCreated, o)
+}
+
+// updateSLO serves PUT /slos/{id}, replacing its objectives.
+func (s *Server) updateSLO(w http.ResponseWriter, r *http.Request, id int64) {
+	before, err := s.loadSLO(r.Context(), id)
+	if err != nil {
+		writeSLOLoadError(w, r, err)
+		return
+	}
+	req := slo{Endpoint: before.Endpoint}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("decode body: %v", err))
+		return
+	}
+	if errs := validateSLO(&req); len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return
+	}
+	if s.sloEndpointTaken(r.Context(), req.Endpoint, id) {
+		writeError(w, r, http.StatusConflict, fmt.Sprintf("endpoint %q already has an slo", req.Endpoint))
+		return
+	}
+	if _, err := s.db.ExecContext(r.Context(), `UPDATE slos SET endpoint = ?, latency_threshold_ms = ?, latency_objective = ?,
+		max_error_rate = ? WHERE id = ?`, req.Endpoint, req.LatencyThresholdMs, req.LatencyObjective, req.MaxErrorRate, id); err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("update slo: %v", err))
+		return
+	}
+	after, err := s.loadSLO(r.Context(), id)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("load slo: %v", err))
+		return
+	}
+	s.recordAudit(r.Context(), auditUpdate, "slo", id, before, after)
+	writeJSON(w, http.StatusOK, after)
+}
+
+// deleteSLO serves DELETE /slos/{id}.
+func (s *Server) deleteSLO(w http.ResponseWriter, r *http.Request, id int64) {
+	o, err := s.loadSLO(r.Context(), id)
+	if err != nil {
+		writeSLOLoadError(w, r, err)
+		return
+	}
+	if _, err := s.db.ExecContext(r.Context(), `DELETE FROM slos WHERE id = ?`, id); err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("delete slo: %v", err))
+		return
+	}
+	s.recordAudit(r.Context(), auditDelete, "slo", id, o, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sloEndpointTaken reports whether an slo other than exceptID is defined for
+// endpoint.
+func (s *Server) sloEndpointTaken(ctx context.Context, endpoint string, exceptID int64) bool {
+	var id int64
+	err := s.db.QueryRowContext(ctx, `SELECT id FROM slos WHERE endpoint = ? AND id != ?`, endpoint, exceptID).Scan(&id)
+	return err == nil
+}
+
+func writeSLOLoadError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+	writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("query slo: %v", err))
+}
+
+// sloCompliance is how one objective fared over the report's window.
+// Compliance, BurnRate and BudgetRemaining are nil without any requests.
+type sloCompliance struct {
+	// Objective is the share of requests that must be good.
+	Objective float64 `json:"objective"`
+	Total     int64   `json:"total"`
+	Bad       int64   `json:"bad"`
+	// Compliance is the share of requests that were good.
+	Compliance *float64 `json:"compliance"`
+	// BurnRate is how fast the error budget, the share of requests allowed
+	// to be bad, was spent: 1 spends exactly the budget over the window,
+	// more runs out before its end.
+	BurnRate *float64 `json:"burn_rate"`
+	// BurnRate1h is the burn rate over the last hour alone.
+	BurnRate1h *float64 `json:"burn_rate_1h"`
+	// BudgetRemaining is the share of the error budget left; negative once
+	// it is overspent.
+	BudgetRemaining *float64 `json:"budget_remaining"`
+	Met             bool     `json:"met"`
+}
+
+type sloReportEntry struct {
+	slo
+	Latency *sloCompliance `json:"latency,omitempty"`
+	Errors  *sloCompliance `json:"errors,omitempty"`
+	Met     bool           `json:"met"`
+}
+
+type sloReport struct {
+	Window string           `json:"window"`
+	Since  timestamp        `json:"since"`
+	Until  timestamp        `json:"until"`
+	SLOs   []sloReportEntry `json:"slos"`
+}
+
+// sloReportHandler serves GET /slo/report?window=30d: for every slo, how
+// many requests in the window met each objective and how fast its error
+// budget is burning.
+func (s *Server) sloReportHandler(w http.ResponseWriter, r *http.Request) {
+	raw := r.URL.Query().Get("window")
+	window := defaultSLOWindow
+	if raw != "" {
+		d, err := parseWindow(raw)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		window = d
+	} else {
+		raw = "30d"
+	}
+	report, err := s.sloReport(r.Context(), time.Now(), window)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	report.Window = raw
+	writeJSON(w, http.StatusOK, report)
+}
+
+// parseWindow parses a report window: a number of days such as "30d", or a
+// Go duration such as "12h".
+func parseWindow(raw string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(raw, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n > 0 {
+			return time.Duration(n) * 24 * time.Hour, nil
+		}
+	} else if d, err := time.ParseDuration(raw); err == nil && d > 0 {
+		return d, nil
+	}
+	return 0, fmt.Errorf("window must be a positive number of days such as 30d, or a duration such as 12h")
+}
+
+func (s *Server) sloReport(ctx context.Context, now time.Time, window time.Duration) (sloReport, error) {
+	report := sloReport{Since: store.NewTimestamp(now.Add(-window)), Until: store.NewTimestamp(now), SLOs: []sloReportEntry{}}
+	slos, err := s.loadSLOs(ctx)
+	if err != nil {
+		return report, err
+	}
+	recent := store.NewTimestamp(now.Add(-min(window, sloFastBurnWindow)))
+	for _, o := range slos {
+		entry := sloReportEntry{slo: o, Met: true}
+		if o.LatencyObjective != nil && o.LatencyThresholdMs != nil {
+			if entry.Latency, err = s.sloLatency(ctx, o, report.Since, recent); err != nil {
+				return report, err
+			}
+			entry.Met = entry.Met && entry.Latency.Met
+		}
+		if o.MaxErrorRate != nil {
+			if entry.Errors, err = s.sloErrors(ctx, o, report.Since, recent); err != nil {
+				return report, err
+			}
+			entry.Met = entry.Met && entry.Errors.Met
+		}
+		report.SLOs = append(report.SLOs, entry)
+	}
+	return report, nil
+}
+
+// sloLatency counts the requests with a response time, and those slower
+// than the threshold, as /logs/slow does: one per log row.
+func (s *Server) sloLatency(ctx context.Context, o slo, since, recent timestamp) (*sloCompliance, error) {
+	const query = `SELECT COUNT(*), COALESCE(SUM(CASE WHEN response_time_ms > ? THEN 1 ELSE 0 END), 0)
+		FROM logs WHERE occurred_at >= ? AND response_time_ms IS NOT NULL AND `
+	c := &sloCompliance{Objective: *o.LatencyObjective}
+	var recentTotal, recentBad int64
+	if err := s.sloCount(ctx, query, o, []any{*o.LatencyThresholdMs, since}, &c.Total, &c.Bad); err != nil {
+		return nil, fmt.Errorf("slo %d latency: %w", o.ID, err)
+	}
+	if err := s.sloCount(ctx, query, o, []any{*o.LatencyThresholdMs, recent}, &recentTotal, &recentBad); err != nil {
+		return nil, fmt.Errorf("slo %d latency: %w", o.ID, err)
+	}
+	c.compute(recentTotal, recentBad)
+	return c, nil
+}
+
+// sloErrors counts requests, deduplicated repeats included, and those that
+// failed.
+func (s *Server) sloErrors(ctx context.Context, o slo, since, recent timestamp) (*sloCompliance, error) {
+	const query = `SELECT COALESCE(SUM(count), 0),
+		COALESCE(SUM(CASE WHEN level IN ('error', 'fatal') OR status_code >= 500 THEN count ELSE 0 END), 0)
+		FROM logs WHERE occurred_at >= ? AND `
+	c := &sloCompliance{Objective: 1 - *o.MaxErrorRate}
+	var recentTotal, recentBad int64
+	if err := s.sloCount(ctx, query, o, []any{since}, &c.Total, &c.Bad); err != nil {
+		return nil, fmt.Errorf("slo %d errors: %w", o.ID, err)
+	}
+	if err := s.sloCount(ctx, query, o, []any{recent}, &recentTotal, &recentBad); err != nil {
+		return nil, fmt.Errorf("slo %d errors: %w", o.ID, err)
+	}
+	c.compute(recentTotal, recentBad)
+	return c, nil
+}
+
+func (s *Server) sloCount(ctx context.Context, query string, o slo, args []any, total, bad *int64) error {
+	if prefix, ok := strings.CutSuffix(o.Endpoint, "*"); ok {
+		query += `substr(endpoint, 1, ?) = ?`
+		args = append(args, len(prefix), prefix)
+	} else {
+		query += `endpoint = ?`
+		args = append(args, o.Endpoint)
+	}
+	return s.db.QueryRowContext(ctx, query, args...).Scan(total, bad)
+}
+
+// compute fills in the ratios from the counts over the window and over the
+// recent fast-burn window.
+func (c *sloCompliance) compute(recentTotal, recentBad int64) {
+	budget := 1 - c.Objective
+	c.Met = true
+	if c.Total > 0 {
+		badRatio := float64(c.Bad) / float64(c.Total)
+		compliance, burn := 1-badRatio, badRatio/budget
+		remaining := 1 - burn
+		c.Compliance, c.BurnRate, c.BudgetRemaining = &compliance, &burn, &remaining
+		c.Met = compliance >= c.Objective
+	}
+	if recentTotal > 0 {
+		burn := float64(recentBad) / float64(recentTotal) / budget
+		c.BurnRate1h = &burn
+	}
+}
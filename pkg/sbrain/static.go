@@ -0,0 +1,108 @@
+package sbrain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+//go:embed web/favicon.ico
+var faviconICO []byte
+
+//go:embed web/favicon.svg
+var faviconSVG []byte
+
+//go:embed web/landing.html
+var landingHTML []byte
+
+// staticAsset is a file embedded in the binary. Its ETag is a hash of its
+// contents, so it changes exactly when a new build changes the file.
+type staticAsset struct {
+	contentType  string
+	cacheControl string
+	data         []byte
+	etag         string
+}
+
+// Cache policies for embedded assets. Icons are cached for a day, since
+// their URLs carry no version; pages are revalidated on every load, which
+// the ETag keeps to a 304.
+const (
+	cacheIcon = "public, max-age=86400"
+	cachePage = "no-cache"
+)
+
+func newStaticAsset(contentType, cacheControl string, data []byte) *staticAsset {
+	sum := sha256.Sum256(data)
+	return &staticAsset{
+		contentType:  contentType,
+		cacheControl: cacheControl,
+		data:         data,
+		etag:         `"` + hex.EncodeToString(sum[:8]) + `"`,
+	}
+}
+
+var (
+	faviconICOAsset = newStaticAsset("image/x-icon", cacheIcon, faviconICO)
+	faviconSVGAsset = newStaticAsset("image/svg+xml", cacheIcon, faviconSVG)
+	docsAsset       = newStaticAsset("text/html; charset=utf-8", cachePage, docsHTML)
+	landingAsset    = newStaticAsset("text/html; charset=utf-8", cachePage, landingHTML)
+)
+
+// ServeHTTP writes the asset with its ETag and Cache-Control, answering 304
+// to an If-None-Match that matches and handling HEAD and Range.
+func (a *staticAsset) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", a.contentType)
+	w.Header().Set("Cache-Control", a.cacheControl)
+	w.Header().Set("ETag", a.etag)
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(a.data))
+}
+
+// wantsHTML reports whether the client is a browser asking for a page rather
+// than a script asking for JSON.
+func wantsHTML(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+// rootHandler greets browsers with a landing page linking to the docs, and
+// everything else, curl and monitors included, with the JSON status it has
+// always returned. The landing page is one of the browser pages the ui flag
+// turns off.
+func (s *Server) rootHandler(w http.ResponseWriter, r *http.Request) {
+	if wantsHTML(r) && s.features.enabled(featureUI) {
+		landingAsset.ServeHTTP(w, r)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"status": "ok",
+	})
+}
+
+// faviconOperation documents one of the favicon routes in the OpenAPI spec.
+func faviconOperation(operationID, contentType string) map[string]any {
+	return map[string]any{
+		"summary":     "The favicon, cached for a day and revalidated by ETag",
+		"operationId": operationID,
+		"parameters": []map[string]any{
+			{
+				"name":        "If-None-Match",
+				"in":          "header",
+				"description": "Answer 304 when the icon's ETag matches",
+				"schema":      map[string]any{"type": "string"},
+			},
+		},
+		"responses": map[string]any{
+			"200": map[string]any{
+				"description": "The icon",
+				"content": map[string]any{
+					contentType: map[string]any{"schema": map[string]any{"type": "string", "format": "binary"}},
+				},
+			},
+			"304": map[string]any{"description": "The icon has not changed"},
+		},
+	}
+}
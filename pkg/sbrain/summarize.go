@@ -0,0 +1,77 @@
+package sbrain
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"sbrain/store"
+)
+
+const summarizePrompt = `You summarize notes from a developer's second brain. Reply with a summary
+of at most three sentences that says what the note is about and any decision
+or outcome it records. Reply with the summary only, in the note's language.`
+
+// summarizeBrain serves POST /brain/{id}/summarize: it asks the configured
+// LLM for a short summary of the record's context and, with store=true,
+// saves it as the record's summary.
+func (s *Server) summarizeBrain(w http.ResponseWriter, r *http.Request, id int64) {
+	if s.llm == nil {
+		writeError(w, r, http.StatusServiceUnavailable, "summarization is not configured: set SBRAIN_LLM_URL")
+		return
+	}
+	save := false
+	if raw := r.URL.Query().Get("store"); raw != "" {
+		var err error
+		if save, err = strconv.ParseBool(raw); err != nil {
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("invalid store %q", raw))
+			return
+		}
+	}
+
+	before, err := s.brains.GetBrain(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, r, http.StatusNotFound, "not found")
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if strings.TrimSpace(before.Context) == "" {
+		writeError(w, r, http.StatusBadRequest, "the record has no context to summarize")
+		return
+	}
+
+	summary, err := s.llm.complete(r.Context(), summarizePrompt, "Title: "+before.Title+"\n\n"+before.Context)
+	if err != nil {
+		writeError(w, r, http.StatusBadGateway, err.Error())
+		return
+	}
+	if utf8.RuneCountInString(summary) > maxSummaryLength {
+		summary = string([]rune(summary)[:maxSummaryLength-1]) + "…"
+	}
+
+	resp := struct {
+		Summary string `json:"summary"`
+		Brain   *brain `json:"brain,omitempty"`
+	}{Summary: summary}
+	if save && summary != before.Summary {
+		after := before
+		after.Summary = summary
+		after.UpdatedAt = store.NewTimestamp(time.Now())
+		if after, err = s.brains.UpdateBrain(r.Context(), after); err != nil {
+			s.writeBrainUpdateError(w, r, id, err)
+			return
+		}
+		s.recordAudit(r.Context(), auditUpdate, "brain", id, before, after)
+		resp.Brain = &after
+	} else if save {
+		resp.Brain = &before
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
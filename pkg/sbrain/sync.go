@@ -0,0 +1,77 @@
+package sbrain
+
+import (
+	"fmt"
+	"net/http"
+
+	"sbrain/store"
+)
+
+// Tombstone records a brain deleted since the sync cursor.
+type Tombstone struct {
+	ID        int64     `json:"id"`
+	DeletedAt timestamp `json:"deleted_at"`
+}
+
+// SyncResponse is the body of GET /sync.
+type SyncResponse struct {
+	Brains  []brain     `json:"brains"`
+	Deleted []Tombstone `json:"deleted"`
+	Cursor  timestamp   `json:"cursor"`
+}
+
+// syncHandler returns every brain created, updated or restored at or after
+// ?since, plus tombstones for brains deleted in that window. Without since it
+// returns a full snapshot. The returned cursor is passed back as since on the
+// next call; because the bound is inclusive, changes made in the cursor's
+// second may be returned twice, so clients should apply them idempotently.
+func (s *Server) syncHandler(w http.ResponseWriter, r *http.Request) {
+	var since string
+	if raw := r.URL.Query().Get("since"); raw != "" {
+		t, ok := parseTimestamp(raw)
+		if !ok {
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("invalid since %q", raw))
+			return
+		}
+		since = t.UTC().Format(sqliteTimeLayout)
+	}
+
+	resp := SyncResponse{Brains: []brain{}, Deleted: []Tombstone{}, Cursor: timestamp(since)}
+
+	if err := s.brains.ListBrains(r.Context(), store.BrainFilter{UpdatedSince: since, Order: store.LeastRecentlyUpdatedFirst}, func(b brain) error {
+		resp.Brains = append(resp.Brains, b)
+		if b.UpdatedAt > resp.Cursor {
+			resp.Cursor = b.UpdatedAt
+		}
+		return nil
+	}); err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("list changed brains: %v", err))
+		return
+	}
+
+	rows, err := s.db.QueryContext(r.Context(), `SELECT id, deleted_at FROM brain_tombstones
+		WHERE deleted_at >= ? ORDER BY deleted_at ASC, id ASC`, since)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("query tombstones: %v", err))
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t Tombstone
+		if err := rows.Scan(&t.ID, &t.DeletedAt); err != nil {
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("scan tombstone: %v", err))
+			return
+		}
+		resp.Deleted = append(resp.Deleted, t)
+		if t.DeletedAt > resp.Cursor {
+			resp.Cursor = t.DeletedAt
+		}
+	}
+	if err := rows.Err(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("iterate tombstones: %v", err))
+		return
+	}
+
+	setPagination(r.Context(), pagination{Count: len(resp.Brains) + len(resp.Deleted), Cursor: string(resp.Cursor)})
+	writeJSON(w, http.StatusOK, resp)
+}
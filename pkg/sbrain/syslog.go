@@ -0,0 +1,284 @@
+package sbrain
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"sbrain/store"
+)
+
+// maxSyslogMessageBytes bounds a single syslog message on either transport.
+const maxSyslogMessageBytes = 64 * 1024
+
+// syslogMessage is a parsed RFC 5424 (or, best effort, RFC 3164) message.
+type syslogMessage struct {
+	Facility       int    `json:"facility"`
+	Severity       int    `json:"severity"`
+	Timestamp      string `json:"timestamp,omitempty"`
+	Hostname       string `json:"hostname,omitempty"`
+	AppName        string `json:"app_name,omitempty"`
+	ProcID         string `json:"procid,omitempty"`
+	MsgID          string `json:"msgid,omitempty"`
+	StructuredData string `json:"structured_data,omitempty"`
+	Message        string `json:"-"`
+}
+
+// syslogLevels maps syslog severities to log levels.
+var syslogLevels = [...]string{"fatal", "fatal", "fatal", "error", "warn", "info", "info", "debug"}
+
+// startSyslogListener accepts syslog messages on addr over both UDP and TCP
+// and stores each one in the logs table, until ctx is done.
+func (s *Server) startSyslogListener(ctx context.Context, addr string) error {
+	udp, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return fmt.Errorf("syslog: listen udp %s: %w", addr, err)
+	}
+	tcp, err := net.Listen("tcp", addr)
+	if err != nil {
+		udp.Close()
+		return fmt.Errorf("syslog: listen tcp %s: %w", addr, err)
+	}
+	log.Printf("syslog listener on %s (udp and tcp)", addr)
+
+	// Closing the listeners ends the loops below.
+	context.AfterFunc(ctx, func() {
+		udp.Close()
+		tcp.Close()
+	})
+	s.spawn(ctx, func(ctx context.Context) { s.serveSyslogUDP(ctx, udp) })
+	s.spawn(ctx, func(ctx context.Context) { s.serveSyslogTCP(ctx, tcp) })
+	return nil
+}
+
+func (s *Server) serveSyslogUDP(ctx context.Context, conn net.PacketConn) {
+	buf := make([]byte, maxSyslogMessageBytes)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("syslog: udp read: %v", err)
+			}
+			return
+		}
+		s.storeSyslog(buf[:n], from)
+	}
+}
+
+func (s *Server) serveSyslogTCP(ctx context.Context, ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("syslog: tcp accept: %v", err)
+			}
+			return
+		}
+		s.spawn(ctx, func(ctx context.Context) {
+			stop := context.AfterFunc(ctx, func() { conn.Close() })
+			defer stop()
+			s.handleSyslogConn(conn)
+		})
+	}
+}
+
+// handleSyslogConn reads messages framed either by octet counting
+// ("<length> <message>", RFC 6587) or by newlines, detected per message.
+func (s *Server) handleSyslogConn(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReaderSize(conn, maxSyslogMessageBytes)
+	for {
+		first, err := r.Peek(1)
+		if err != nil {
+			return
+		}
+
+		var msg []byte
+		if first[0] >= '0' && first[0] <= '9' {
+			lengthText, err := r.ReadString(' ')
+			if err != nil {
+				return
+			}
+			length, err := strconv.Atoi(strings.TrimSpace(lengthText))
+			if err != nil || length <= 0 || length > maxSyslogMessageBytes {
+				log.Printf("syslog: %s: invalid frame length %q", conn.RemoteAddr(), lengthText)
+				return
+			}
+			msg = make([]byte, length)
+			if _, err := io.ReadFull(r, msg); err != nil {
+				return
+			}
+		} else {
+			line, err := r.ReadSlice('\n')
+			if err != nil && !(errors.Is(err, io.EOF) && len(line) > 0) {
+				if errors.Is(err, bufio.ErrBufferFull) {
+					log.Printf("syslog: %s: message exceeds %d bytes", conn.RemoteAddr(), maxSyslogMessageBytes)
+				}
+				return
+			}
+			msg = line
+		}
+		s.storeSyslog(msg, conn.RemoteAddr())
+	}
+}
+
+func (s *Server) storeSyslog(raw []byte, from net.Addr) {
+	text := strings.TrimRight(string(raw), "\r\n\x00")
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+	m, err := parseSyslog(text)
+	if err != nil {
+		log.Printf("syslog: %s: %v", from, err)
+		return
+	}
+
+	metadata, _ := json.Marshal(m)
+	entry := logEntry{
+		Level:     syslogLevels[m.Severity],
+		Message:   m.Message,
+		UserAgent: "syslog",
+		Metadata:  string(metadata),
+		Service:   "syslog",
+	}
+	if validLogService(m.AppName) {
+		entry.Service = m.AppName
+	}
+	if m.Timestamp != "" {
+		entry.OccurredAt, _ = store.ParseTimestamp(m.Timestamp)
+	}
+	if host, _, err := net.SplitHostPort(from.String()); err == nil {
+		entry.IP = host
+	}
+	if entry.Message == "" {
+		entry.Message = "(empty syslog message)"
+	}
+	if _, err := s.insertLog(context.Background(), entry); err != nil {
+		log.Printf("syslog: %v", err)
+	}
+}
+
+// parseSyslog parses an RFC 5424 message:
+//
+//	<PRI>VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA [MSG]
+//
+// Messages without a version are treated as RFC 3164 ("<PRI>Mmm dd hh:mm:ss
+// HOST TAG: MSG"), which is what many daemons and journald forwarders emit.
+func parseSyslog(text string) (syslogMessage, error) {
+	var m syslogMessage
+	if !strings.HasPrefix(text, "<") {
+		return m, errors.New("missing <PRI>")
+	}
+	end := strings.IndexByte(text, '>')
+	if end < 2 || end > 4 {
+		return m, errors.New("malformed <PRI>")
+	}
+	pri, err := strconv.Atoi(text[1:end])
+	if err != nil || pri < 0 || pri > 191 {
+		return m, fmt.Errorf("invalid PRI %q", text[1:end])
+	}
+	m.Facility, m.Severity = pri/8, pri%8
+	rest := text[end+1:]
+
+	if !strings.HasPrefix(rest, "1 ") {
+		parseRFC3164(&m, rest)
+		return m, nil
+	}
+	rest = rest[2:]
+
+	fields := make([]string, 5)
+	for i := range fields {
+		field, tail, ok := strings.Cut(rest, " ")
+		if !ok {
+			return m, errors.New("truncated RFC 5424 header")
+		}
+		if field != "-" {
+			fields[i] = field
+		}
+		rest = tail
+	}
+	m.Timestamp, m.Hostname, m.AppName, m.ProcID, m.MsgID = fields[0], fields[1], fields[2], fields[3], fields[4]
+
+	sd, msg, err := splitStructuredData(rest)
+	if err != nil {
+		return m, err
+	}
+	if sd != "-" {
+		m.StructuredData = sd
+	}
+	m.Message = strings.TrimPrefix(msg, "\ufeff")
+	return m, nil
+}
+
+// splitStructuredData separates the STRUCTURED-DATA element ("-" or one or
+// more "[id param=\"value\"]" blocks, where values may escape ']' and '"')
+// from the free-form message that follows it.
+func splitStructuredData(rest string) (string, string, error) {
+	if strings.HasPrefix(rest, "-") {
+		return "-", strings.TrimPrefix(rest[1:], " "), nil
+	}
+	i := 0
+	for i < len(rest) && rest[i] == '[' {
+		n := sdElementLength(rest[i:])
+		if n == 0 {
+			return "", "", errors.New("unterminated structured data")
+		}
+		i += n
+	}
+	if i == 0 {
+		return "", "", errors.New("malformed structured data")
+	}
+	return rest[:i], strings.TrimPrefix(rest[i:], " "), nil
+}
+
+// sdElementLength returns the length of the "[...]" element at the start of
+// s, or 0 if it is not terminated.
+func sdElementLength(s string) int {
+	inQuotes := false
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if inQuotes {
+				i++
+			}
+		case '"':
+			inQuotes = !inQuotes
+		case ']':
+			if !inQuotes {
+				return i + 1
+			}
+		}
+	}
+	return 0
+}
+
+func parseRFC3164(m *syslogMessage, rest string) {
+	if len(rest) >= 16 {
+		if t, err := time.Parse(time.Stamp, rest[:15]); err == nil && rest[15] == ' ' {
+			now := time.Now()
+			m.Timestamp = time.Date(now.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.Local).Format(time.RFC3339)
+			rest = rest[16:]
+			if host, tail, ok := strings.Cut(rest, " "); ok {
+				m.Hostname, rest = host, tail
+			}
+		}
+	}
+	// TAG is the app name, optionally followed by "[pid]", and ends at ':'.
+	if tag, msg, ok := strings.Cut(rest, ": "); ok && !strings.ContainsAny(tag, " ") {
+		if name, pid, ok := strings.Cut(tag, "["); ok {
+			m.AppName, m.ProcID = name, strings.TrimSuffix(pid, "]")
+		} else {
+			m.AppName = tag
+		}
+		rest = msg
+	}
+	m.Message = rest
+}
@@ -0,0 +1,247 @@
+package sbrain
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Tag suggestion limits: suggestions returned by default and at most,
+// tagged records compared against (the most recent ones), and how many of
+// the most similar records vote with their tags.
+const (
+	defaultTagSuggestions = 5
+	maxTagSuggestions     = 20
+	tagSuggestCorpusRows  = 2000
+	tagSuggestNeighbours  = 10
+)
+
+// tagStopwords are common words never suggested as keyword tags.
+var tagStopwords = map[string]bool{}
+
+func init() {
+	for _, w := range strings.Fields(`about above after again against all also and any are because been before
+		being below between both but can could did does doing down during each few for from further had has
+		have having her here hers herself him himself his how into its itself just more most myself nor not
+		now off once only other our ours ourselves out over own same she should some such than that the their
+		theirs them themselves then there these they this those through too under until very was were what
+		when where which while who whom why will with would you your yours yourself yourselves use used using
+		get got make made new one two like need needs want still well way see`) {
+		tagStopwords[w] = true
+	}
+}
+
+// tagTerms splits text into lowercase words of at least three letters,
+// leaving out stopwords and numbers.
+func tagTerms(text string) []string {
+	var terms []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_'
+	}) {
+		word = strings.Trim(word, "-_")
+		if len([]rune(word)) < 3 || tagStopwords[word] || strings.IndexFunc(word, unicode.IsLetter) < 0 {
+			continue
+		}
+		terms = append(terms, word)
+	}
+	return terms
+}
+
+// tagDocument is a tagged record as a term-frequency vector.
+type tagDocument struct {
+	tags  []string
+	terms map[string]float64
+}
+
+func termFrequencies(terms []string) map[string]float64 {
+	tf := map[string]float64{}
+	for _, t := range terms {
+		tf[t]++
+	}
+	return tf
+}
+
+// suggestTags proposes up to limit tags for text. Existing tags come first:
+// those of the records most similar to text by TF-IDF cosine similarity,
+// plus any existing tag text mentions outright. Keywords of the text fill
+// any remaining places, so a record unlike anything stored still gets
+// suggestions.
+func (s *Server) suggestTags(ctx context.Context, text string, limit int) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT title, project, context, tags FROM second_brain
+		WHERE TRIM(tags) != '' ORDER BY id DESC LIMIT ?`, tagSuggestCorpusRows)
+	if err != nil {
+		return nil, fmt.Errorf("query tagged records: %w", err)
+	}
+	defer rows.Close()
+
+	var docs []tagDocument
+	df := map[string]float64{}
+	// spelling keeps the first (most recent) spelling of each tag, so
+	// suggestions match the existing taxonomy's case.
+	spelling := map[string]string{}
+	for rows.Next() {
+		var title, project, context, tags string
+		if err := rows.Scan(&title, &project, &context, &tags); err != nil {
+			return nil, fmt.Errorf("scan tagged record: %w", err)
+		}
+		doc := tagDocument{terms: termFrequencies(tagTerms(title + " " + project + " " + context))}
+		for _, tag := range splitTags(tags) {
+			key := strings.ToLower(tag)
+			if _, ok := spelling[key]; !ok {
+				spelling[key] = tag
+			}
+			doc.tags = append(doc.tags, key)
+		}
+		for term := range doc.terms {
+			df[term]++
+		}
+		docs = append(docs, doc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate tagged records: %w", err)
+	}
+
+	n := float64(len(docs))
+	idf := func(term string) float64 { return math.Log((n+1)/(df[term]+1)) + 1 }
+	weigh := func(tf map[string]float64) (map[string]float64, float64) {
+		vec := make(map[string]float64, len(tf))
+		norm := 0.0
+		for term, f := range tf {
+			w := (1 + math.Log(f)) * idf(term)
+			vec[term] = w
+			norm += w * w
+		}
+		return vec, math.Sqrt(norm)
+	}
+
+	terms := tagTerms(text)
+	query, queryNorm := weigh(termFrequencies(terms))
+	scores := map[string]float64{}
+
+	if queryNorm > 0 {
+		type neighbour struct {
+			doc        tagDocument
+			similarity float64
+		}
+		var neighbours []neighbour
+		for _, doc := range docs {
+			vec, norm := weigh(doc.terms)
+			if norm == 0 {
+				continue
+			}
+			dot := 0.0
+			for term, w := range query {
+				dot += w * vec[term]
+			}
+			if dot > 0 {
+				neighbours = append(neighbours, neighbour{doc, dot / (queryNorm * norm)})
+			}
+		}
+		sort.Slice(neighbours, func(i, j int) bool { return neighbours[i].similarity > neighbours[j].similarity })
+		if len(neighbours) > tagSuggestNeighbours {
+			neighbours = neighbours[:tagSuggestNeighbours]
+		}
+		for _, nb := range neighbours {
+			for _, tag := range nb.doc.tags {
+				scores[tag] += nb.similarity
+			}
+		}
+	}
+
+	mentioned := map[string]bool{}
+	for _, term := range terms {
+		mentioned[term] = true
+	}
+	for key := range spelling {
+		words := tagTerms(key)
+		all := len(words) > 0
+		for _, w := range words {
+			all = all && mentioned[w]
+		}
+		if all {
+			scores[key]++
+		}
+	}
+
+	ranked := make([]string, 0, len(scores))
+	for key := range scores {
+		ranked = append(ranked, key)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if scores[ranked[i]] != scores[ranked[j]] {
+			return scores[ranked[i]] > scores[ranked[j]]
+		}
+		return ranked[i] < ranked[j]
+	})
+	suggested := []string{}
+	seen := map[string]bool{}
+	for _, key := range ranked {
+		if len(suggested) == limit {
+			return suggested, nil
+		}
+		suggested = append(suggested, spelling[key])
+		seen[key] = true
+	}
+
+	keywords := make([]string, 0, len(query))
+	for term := range query {
+		if !seen[term] {
+			keywords = append(keywords, term)
+		}
+	}
+	sort.Slice(keywords, func(i, j int) bool {
+		if query[keywords[i]] != query[keywords[j]] {
+			return query[keywords[i]] > query[keywords[j]]
+		}
+		return keywords[i] < keywords[j]
+	})
+	for _, term := range keywords {
+		if len(suggested) == limit {
+			break
+		}
+		suggested = append(suggested, term)
+	}
+	return suggested, nil
+}
+
+// suggestTagsHandler serves POST /brain/suggest-tags: tag suggestions for
+// raw text, or for a record's title, project and context.
+func (s *Server) suggestTagsHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Text    string `json:"text"`
+		Title   string `json:"title"`
+		Project string `json:"project"`
+		Context string `json:"context"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("decode body: %v", err))
+		return
+	}
+	text := strings.Join([]string{req.Text, req.Title, req.Project, req.Context}, " ")
+	if strings.TrimSpace(text) == "" {
+		writeError(w, r, http.StatusBadRequest, "text is required")
+		return
+	}
+	limit := defaultTagSuggestions
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxTagSuggestions {
+			writeError(w, r, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxTagSuggestions))
+			return
+		}
+		limit = n
+	}
+
+	tags, err := s.suggestTags(r.Context(), text, limit)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"tags": tags})
+}
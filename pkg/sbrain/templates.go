@@ -0,0 +1,185 @@
+package sbrain
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"sbrain/store"
+)
+
+// brainTemplate pre-fills a new brain record. Title and Context may contain
+// the placeholders expanded by apply.
+type brainTemplate struct {
+	ID          int64     `json:"id"`
+	CreatedAt   timestamp `json:"created_at"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Title       string    `json:"title"`
+	Context     string    `json:"context"`
+	Project     string    `json:"project"`
+	Tags        string    `json:"tags"`
+}
+
+const brainTemplateColumns = `id, created_at, name, description, title, context, project, tags`
+
+func scanBrainTemplate(row interface{ Scan(...any) error }) (brainTemplate, error) {
+	var t brainTemplate
+	err := row.Scan(&t.ID, &t.CreatedAt, &t.Name, &t.Description, &t.Title, &t.Context, &t.Project, &t.Tags)
+	return t, err
+}
+
+// apply fills the fields of b left empty from the template. A template title
+// containing {{title}} wraps the given title instead of replacing it, and
+// the template's tags are added to b's. In the title and context, {{date}}
+// and {{week}} become today's date and ISO week in the display zone, and
+// {{title}} and {{project}} the record's own values.
+func (t brainTemplate) apply(b brain, now time.Time) brain {
+	if b.Project == "" {
+		b.Project = t.Project
+	}
+	now = now.In(store.DisplayLocation())
+	year, week := now.ISOWeek()
+	placeholders := []string{
+		"{{date}}", now.Format("2006-01-02"),
+		"{{week}}", fmt.Sprintf("%d-W%02d", year, week),
+		"{{project}}", b.Project,
+	}
+
+	switch {
+	case strings.Contains(t.Title, "{{title}}"):
+		if b.Title != "" {
+			b.Title = strings.NewReplacer(append(placeholders, "{{title}}", b.Title)...).Replace(t.Title)
+		}
+	case b.Title == "":
+		b.Title = strings.NewReplacer(placeholders...).Replace(t.Title)
+	}
+	if b.Context == "" {
+		b.Context = strings.NewReplacer(append(placeholders, "{{title}}", b.Title)...).Replace(t.Context)
+	}
+
+	tags := splitTags(t.Tags)
+	for _, tag := range splitTags(b.Tags) {
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	b.Tags = strings.Join(tags, ",")
+	return b
+}
+
+func (s *Server) loadTemplate(ctx context.Context, name string) (brainTemplate, error) {
+	return scanBrainTemplate(s.db.QueryRowContext(ctx, `SELECT `+brainTemplateColumns+` FROM brain_templates WHERE name = ?`, name))
+}
+
+func (s *Server) listTemplates(w http.ResponseWriter, r *http.Request) {
+	rows, err := s.db.QueryContext(r.Context(), `SELECT `+brainTemplateColumns+` FROM brain_templates ORDER BY name`)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("query templates: %v", err))
+		return
+	}
+	defer rows.Close()
+
+	items := []brainTemplate{}
+	for rows.Next() {
+		t, err := scanBrainTemplate(rows)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("scan template: %v", err))
+			return
+		}
+		items = append(items, t)
+	}
+	if err := rows.Err(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("iterate templates: %v", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+func (s *Server) getTemplate(w http.ResponseWriter, r *http.Request) {
+	t, err := s.loadTemplate(r.Context(), r.PathValue("name"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, r, http.StatusNotFound, "not found")
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("query template: %v", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, t)
+}
+
+func (s *Server) createTemplate(w http.ResponseWriter, r *http.Request) {
+	var req brainTemplate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, fmt.Sprintf("decode body: %v", err))
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+
+	var v validator
+	if v.required("name", req.Name) {
+		v.maxLength("name", req.Name, maxProjectLength)
+		if !projectSlugPattern.MatchString(req.Name) {
+			v.add("name", "must be a URL-safe slug (letters, digits, '.', '_' and '-', starting with a letter or digit)")
+		}
+	}
+	v.maxLength("title", req.Title, maxTitleLength)
+	v.maxLength("context", req.Context, maxContextLength)
+	if req.Project != "" && !projectSlugPattern.MatchString(req.Project) {
+		v.add("project", "must be a URL-safe slug (letters, digits, '.', '_' and '-', starting with a letter or digit)")
+	}
+	for _, tag := range splitTags(req.Tags) {
+		if len(tag) > maxTagLength || !tagPattern.MatchString(tag) {
+			v.add("tags", "invalid tag %q: use up to %d letters, digits, '_', '-' or '/'", tag, maxTagLength)
+		}
+	}
+	if len(v.errors) > 0 {
+		writeValidationError(w, r, v.errors)
+		return
+	}
+
+	if _, err := s.loadTemplate(r.Context(), req.Name); err == nil {
+		writeError(w, r, http.StatusConflict, fmt.Sprintf("template %q already exists", req.Name))
+		return
+	}
+	res, err := s.db.ExecContext(r.Context(), `INSERT INTO brain_templates (name, description, title, context, project, tags)
+		VALUES (?, ?, ?, ?, ?, ?)`, req.Name, req.Description, req.Title, req.Context, req.Project, req.Tags)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("insert template: %v", err))
+		return
+	}
+
+	id, _ := res.LastInsertId()
+	t, err := scanBrainTemplate(s.db.QueryRowContext(r.Context(), `SELECT `+brainTemplateColumns+` FROM brain_templates WHERE id = ?`, id))
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("load template: %v", err))
+		return
+	}
+	s.recordAudit(r.Context(), auditCreate, "template", t.ID, nil, t)
+	writeJSONStatus(w, http.StatusCreated, t)
+}
+
+func (s *Server) deleteTemplate(w http.ResponseWriter, r *http.Request) {
+	t, err := s.loadTemplate(r.Context(), r.PathValue("name"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, r, http.StatusNotFound, "not found")
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("query template: %v", err))
+		return
+	}
+	if _, err := s.db.ExecContext(r.Context(), `DELETE FROM brain_templates WHERE id = ?`, t.ID); err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("delete template: %v", err))
+		return
+	}
+	s.recordAudit(r.Context(), auditDelete, "template", t.ID, t, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,239 @@
+package sbrain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRequestTimeout = 30 * time.Second
+	defaultReadTimeout    = time.Minute
+	readHeaderTimeout     = 10 * time.Second
+	idleTimeout           = 2 * time.Minute
+	// writeTimeoutMargin is how much longer than the request timeout the
+	// connection's write deadline is by default, so the 504 a timed-out
+	// handler earns still has time to be sent.
+	writeTimeoutMargin = 15 * time.Second
+)
+
+// timeoutConfig bounds how long a request may take.
+//
+//   - SBRAIN_REQUEST_TIMEOUT: how long a handler may run before the request
+//     is answered 504, e.g. "30s" (default 30s; 0 turns it off)
+//   - SBRAIN_READ_TIMEOUT: how long reading a request, body included, may take
+//     (default 1m)
+//   - SBRAIN_WRITE_TIMEOUT: how long after its headers are read a response
+//     must be written (default the request timeout plus 15s)
+//
+// Streams and bulk transfers, see longRunning, are exempt from all three.
+type timeoutConfig struct {
+	request time.Duration
+	read    time.Duration
+	write   time.Duration
+}
+
+func loadTimeouts() (timeoutConfig, error) {
+	c := timeoutConfig{request: defaultRequestTimeout, read: defaultReadTimeout}
+	for _, setting := range []struct {
+		name string
+		d    *time.Duration
+	}{
+		{"SBRAIN_REQUEST_TIMEOUT", &c.request},
+		{"SBRAIN_READ_TIMEOUT", &c.read},
+		{"SBRAIN_WRITE_TIMEOUT", &c.write},
+	} {
+		raw := os.Getenv(setting.name)
+		if raw == "" {
+			continue
+		}
+		d, err := time.ParseDuration(raw)
+		if err != nil || d < 0 {
+			return timeoutConfig{}, fmt.Errorf("invalid %s %q: expected a duration such as 30s, or 0 for none", setting.name, raw)
+		}
+		*setting.d = d
+	}
+	if c.write == 0 && os.Getenv("SBRAIN_WRITE_TIMEOUT") == "" && c.request > 0 {
+		c.write = c.request + writeTimeoutMargin
+	}
+	return c, nil
+}
+
+// HTTPServer returns an http.Server for the API with the connection
+// timeouts from the environment, so a client that trickles its request or
+// never reads the response cannot hold a connection open indefinitely.
+func (s *Server) HTTPServer() *http.Server {
+	return &http.Server{
+		Handler:           s,
+		ReadHeaderTimeout: min(readHeaderTimeout, s.timeouts.read),
+		ReadTimeout:       s.timeouts.read,
+		WriteTimeout:      s.timeouts.write,
+		IdleTimeout:       idleTimeout,
+	}
+}
+
+// longRunning reports whether r is a stream or bulk transfer, which is
+// allowed to take as long as it needs: NDJSON and CSV streams, exports and
+// imports, and database upkeep.
+func longRunning(r *http.Request) bool {
+	if wantsNDJSON(r) {
+		return true
+	}
+	switch r.URL.Path {
+	case "/logs/export", "/export/markdown", "/export/pdf", "/export/site":
+		return true
+	}
+	return strings.HasPrefix(r.URL.Path, "/import/") || strings.HasPrefix(r.URL.Path, "/admin/db/")
+}
+
+// requestTimeout gives every request a deadline. Handlers pass the request's
+// context to their queries, so SQLite stops a slow one when it expires, and
+// the client gets a 504 APIError at the deadline even from a handler that is
+// still busy. Whatever the handler writes after that is dropped.
+func (s *Server) requestTimeout(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if longRunning(r) {
+			rc := http.NewResponseController(w)
+			_ = rc.SetReadDeadline(time.Time{})
+			_ = rc.SetWriteDeadline(time.Time{})
+			next.ServeHTTP(w, r)
+			return
+		}
+		if s.timeouts.request <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), s.timeouts.request)
+		defer cancel()
+		r = r.WithContext(ctx)
+		tw := &timeoutWriter{w: w, r: r, header: w.Header().Clone(), timeout: s.timeouts.request}
+		done := make(chan struct{})
+		panicked := make(chan any, 1)
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					if p != http.ErrAbortHandler {
+						p = capturePanic(p)
+					}
+					panicked <- p
+				}
+			}()
+			next.ServeHTTP(tw, r)
+			close(done)
+		}()
+		select {
+		case p := <-panicked:
+			panic(p)
+		case <-done:
+			tw.finish()
+		case <-ctx.Done():
+			select {
+			case <-done:
+				tw.finish()
+			default:
+				tw.expire()
+			}
+		}
+	})
+}
+
+// timeoutWriter lets a handler racing its deadline write the response until
+// the deadline passes, and not after. The handler gets its own header map,
+// copied to the real one when it writes, so an expiring request never reads
+// headers the handler is still changing.
+type timeoutWriter struct {
+	w       http.ResponseWriter
+	r       *http.Request
+	timeout time.Duration
+
+	mu          sync.Mutex
+	header      http.Header
+	wroteHeader bool
+	timedOut    bool
+}
+
+func (t *timeoutWriter) Header() http.Header { return t.header }
+
+func (t *timeoutWriter) WriteHeader(status int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.writeHeaderLocked(status)
+}
+
+func (t *timeoutWriter) writeHeaderLocked(status int) {
+	if t.timedOut || t.wroteHeader {
+		return
+	}
+	// A handler whose query was cut off by the deadline reports the error it
+	// got as a 500; the client is told what actually happened.
+	if status >= http.StatusInternalServerError && errors.Is(t.r.Context().Err(), context.DeadlineExceeded) {
+		t.writeTimeoutLocked()
+		return
+	}
+	t.wroteHeader = true
+	dst := t.w.Header()
+	for k, v := range t.header {
+		dst[k] = v
+	}
+	t.w.WriteHeader(status)
+}
+
+func (t *timeoutWriter) Write(b []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.wroteHeader {
+		t.writeHeaderLocked(http.StatusOK)
+	}
+	if t.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	return t.w.Write(b)
+}
+
+func (t *timeoutWriter) Flush() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.wroteHeader {
+		t.writeHeaderLocked(http.StatusOK)
+	}
+	if f, ok := t.w.(http.Flusher); !t.timedOut && ok {
+		f.Flush()
+	}
+}
+
+// finish copies the headers of a handler that returned without writing, so
+// the implicit 200 carries them.
+func (t *timeoutWriter) finish() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.wroteHeader && !t.timedOut {
+		t.writeHeaderLocked(http.StatusOK)
+	}
+}
+
+// expire answers 504 when the deadline passed before the handler started its
+// response. A client that went away gets nothing.
+func (t *timeoutWriter) expire() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.wroteHeader || t.timedOut {
+		t.timedOut = true
+		return
+	}
+	if !errors.Is(t.r.Context().Err(), context.DeadlineExceeded) {
+		t.timedOut = true
+		return
+	}
+	t.writeTimeoutLocked()
+}
+
+func (t *timeoutWriter) writeTimeoutLocked() {
+	t.timedOut = true
+	writeError(t.w, t.r, http.StatusGatewayTimeout, fmt.Sprintf("request timed out after %s", t.timeout))
+}
@@ -0,0 +1,224 @@
+package sbrain
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"sbrain/store"
+)
+
+// Audit actions specific to the trash.
+const (
+	auditRestore = "restore"
+	auditPurge   = "purge"
+)
+
+// defaultTrashRetentionDays is how long deleted brains stay restorable unless
+// SBRAIN_TRASH_RETENTION_DAYS says otherwise.
+const defaultTrashRetentionDays = 30
+
+type trashedBrain struct {
+	brain
+	DeletedAt timestamp `json:"deleted_at"`
+	DeletedBy string    `json:"deleted_by"`
+	PurgeAt   timestamp `json:"purge_at"`
+}
+
+func trashRetention() time.Duration {
+	days := defaultTrashRetentionDays
+	if raw := os.Getenv("SBRAIN_TRASH_RETENTION_DAYS"); raw != "" {
+		if n, err := strconv.Atoi(raw); err == nil && n > 0 {
+			days = n
+		} else {
+			log.Printf("invalid SBRAIN_TRASH_RETENTION_DAYS %q, using %d", raw, defaultTrashRetentionDays)
+		}
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// deleteBrain moves a brain into the trash. Its attachments are kept until the
+// trashed brain is purged.
+func (s *Server) deleteBrain(w http.ResponseWriter, r *http.Request, id int64) {
+	tx, err := s.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("begin delete: %v", err))
+		return
+	}
+	defer tx.Rollback()
+
+	var b brain
+	row := tx.QueryRowContext(r.Context(), `SELECT `+store.BrainColumns+`
+		FROM second_brain WHERE id = ?`, id)
+	if err := row.Scan(b.Fields()...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, r, http.StatusNotFound, "not found")
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("query brain: %v", err))
+		return
+	}
+
+	now := time.Now().UTC().Format(sqliteTimeLayout)
+	if _, err := tx.ExecContext(r.Context(), `INSERT INTO brain_trash (deleted_at, deleted_by, `+store.BrainColumns+`)
+		SELECT ?, ?, `+store.BrainColumns+` FROM second_brain WHERE id = ?`, now, actorFromContext(r.Context()), id); err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("move brain to trash: %v", err))
+		return
+	}
+	if _, err := tx.ExecContext(r.Context(), `INSERT OR REPLACE INTO brain_tombstones (id, deleted_at) VALUES (?, ?)`, b.ID, now); err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("record tombstone: %v", err))
+		return
+	}
+	if _, err := tx.ExecContext(r.Context(), `DELETE FROM second_brain WHERE id = ?`, id); err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("delete brain: %v", err))
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("commit delete: %v", err))
+		return
+	}
+
+	s.recordAudit(r.Context(), auditDelete, "brain", b.ID, b, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// trashCollectionHandler lists trashed brains, most recently deleted first.
+func (s *Server) trashCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	rows, err := s.db.QueryContext(r.Context(), `SELECT `+store.BrainColumns+`, deleted_at, deleted_by
+		FROM brain_trash ORDER BY deleted_at DESC, id DESC`)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("query trash: %v", err))
+		return
+	}
+	defer rows.Close()
+
+	retention := trashRetention()
+	items := []trashedBrain{}
+	for rows.Next() {
+		var t trashedBrain
+		if err := rows.Scan(append(t.Fields(), &t.DeletedAt, &t.DeletedBy)...); err != nil {
+			writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("scan trashed brain: %v", err))
+			return
+		}
+		if deleted, ok := t.DeletedAt.Time(); ok {
+			t.PurgeAt = store.NewTimestamp(deleted.Add(retention))
+		}
+		items = append(items, t)
+	}
+	if err := rows.Err(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("iterate trash: %v", err))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, items)
+}
+
+// restoreBrain serves POST /trash/{id}/restore.
+func (s *Server) restoreBrain(w http.ResponseWriter, r *http.Request, id int64) {
+	tx, err := s.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("begin restore: %v", err))
+		return
+	}
+	defer tx.Rollback()
+
+	var b brain
+	row := tx.QueryRowContext(r.Context(), `SELECT `+store.BrainColumns+`
+		FROM brain_trash WHERE id = ?`, id)
+	if err := row.Scan(b.Fields()...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, r, http.StatusNotFound, "not found")
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("query trashed brain: %v", err))
+		return
+	}
+
+	// The original id is reused so links and attachments keep pointing at it.
+	// Bumping updated_at makes the record reappear for syncing clients.
+	b.UpdatedAt = store.NewTimestamp(time.Now())
+	if _, err := tx.ExecContext(r.Context(), `INSERT INTO second_brain (`+store.BrainColumns+`)
+		SELECT `+store.BrainColumns+` FROM brain_trash WHERE id = ?`, id); err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("restore brain: %v", err))
+		return
+	}
+	if _, err := tx.ExecContext(r.Context(), `UPDATE second_brain SET updated_at = ? WHERE id = ?`, b.UpdatedAt, id); err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("restore brain: %v", err))
+		return
+	}
+	if _, err := tx.ExecContext(r.Context(), `DELETE FROM brain_tombstones WHERE id = ?`, id); err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("clear tombstone: %v", err))
+		return
+	}
+	if _, err := tx.ExecContext(r.Context(), `DELETE FROM brain_trash WHERE id = ?`, id); err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("remove from trash: %v", err))
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		writeError(w, r, http.StatusInternalServerError, fmt.Sprintf("commit restore: %v", err))
+		return
+	}
+
+	s.recordAudit(r.Context(), auditRestore, "brain", b.ID, nil, b)
+	writeJSON(w, http.StatusOK, b)
+}
+
+// runTrashPurger permanently removes trashed brains, and their attachments,
+// once they are older than the retention period.
+func (s *Server) runTrashPurger(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		if err := s.purgeTrash(ctx, time.Now().UTC().Add(-trashRetention())); err != nil {
+			log.Printf("trash purge: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) purgeTrash(ctx context.Context, cutoff time.Time) error {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+store.BrainColumns+`
+		FROM brain_trash WHERE deleted_at < ?`, cutoff.Format(sqliteTimeLayout))
+	if err != nil {
+		return fmt.Errorf("query expired trash: %w", err)
+	}
+	var expired []brain
+	for rows.Next() {
+		var b brain
+		if err := rows.Scan(b.Fields()...); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan expired trash: %w", err)
+		}
+		expired = append(expired, b)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterate expired trash: %w", err)
+	}
+
+	ctx = withActor(ctx, "system")
+	for _, b := range expired {
+		if _, err := s.db.ExecContext(ctx, `DELETE FROM attachments WHERE brain_id = ?`, b.ID); err != nil {
+			return fmt.Errorf("purge attachments of brain %d: %w", b.ID, err)
+		}
+		if _, err := s.db.ExecContext(ctx, `UPDATE logs SET brain_id = NULL WHERE brain_id = ?`, b.ID); err != nil {
+			return fmt.Errorf("unlink logs of brain %d: %w", b.ID, err)
+		}
+		if _, err := s.db.ExecContext(ctx, `DELETE FROM brain_trash WHERE id = ?`, b.ID); err != nil {
+			return fmt.Errorf("purge brain %d: %w", b.ID, err)
+		}
+		s.recordAudit(ctx, auditPurge, "brain", b.ID, b, nil)
+	}
+	return nil
+}
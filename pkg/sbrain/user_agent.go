@@ -0,0 +1,107 @@
+package sbrain
+
+import "strings"
+
+// userAgent is a parsed User-Agent header, stored under metadata's "ua"
+// key. Device is desktop, mobile, tablet, bot or other.
+type userAgent struct {
+	Browser        string `json:"browser,omitempty"`
+	BrowserVersion string `json:"browser_version,omitempty"`
+	OS             string `json:"os,omitempty"`
+	Device         string `json:"device"`
+}
+
+// uaBrowsers maps a product token to a browser name, in the order they are
+// tried: Chromium-based browsers also claim Chrome and Safari, so they come
+// first, and Safari is recognised by its Version/ token last.
+var uaBrowsers = []struct{ token, name string }{
+	{"Edg/", "Edge"},
+	{"EdgA/", "Edge"},
+	{"EdgiOS/", "Edge"},
+	{"OPR/", "Opera"},
+	{"SamsungBrowser/", "Samsung Internet"},
+	{"YaBrowser/", "Yandex Browser"},
+	{"Vivaldi/", "Vivaldi"},
+	{"Firefox/", "Firefox"},
+	{"FxiOS/", "Firefox"},
+	{"CriOS/", "Chrome"},
+	{"HeadlessChrome/", "Headless Chrome"},
+	{"Chromium/", "Chromium"},
+	{"Chrome/", "Chrome"},
+	{"MSIE ", "Internet Explorer"},
+	{"curl/", "curl"},
+	{"Wget/", "Wget"},
+	{"python-requests/", "python-requests"},
+	{"Go-http-client/", "Go http client"},
+	{"okhttp/", "OkHttp"},
+	{"axios/", "axios"},
+	{"node-fetch/", "node-fetch"},
+	{"PostmanRuntime/", "Postman"},
+	{"Version/", "Safari"},
+}
+
+// uaBotTokens mark crawlers and monitors, matched case-insensitively.
+var uaBotTokens = []string{"bot", "crawler", "spider", "slurp", "facebookexternalhit", "uptime", "pingdom", "headlesschrome"}
+
+// parseUserAgent recognises the common browsers, operating systems and HTTP
+// clients. It reports false for an empty header.
+func parseUserAgent(header string) (userAgent, bool) {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return userAgent{}, false
+	}
+	ua := userAgent{Device: "other"}
+
+	for _, b := range uaBrowsers {
+		i := strings.Index(header, b.token)
+		if i < 0 || (b.name == "Safari" && !strings.Contains(header, "Safari/")) {
+			continue
+		}
+		ua.Browser = b.name
+		ua.BrowserVersion = uaMajorVersion(header[i+len(b.token):])
+		break
+	}
+	if ua.Browser == "" && strings.Contains(header, "Trident/") {
+		ua.Browser = "Internet Explorer"
+	}
+
+	switch {
+	case strings.Contains(header, "iPad"):
+		ua.OS, ua.Device = "iPadOS", "tablet"
+	case strings.Contains(header, "iPhone"), strings.Contains(header, "iPod"):
+		ua.OS, ua.Device = "iOS", "mobile"
+	case strings.Contains(header, "Android"):
+		ua.OS, ua.Device = "Android", "tablet"
+		if strings.Contains(header, "Mobile") {
+			ua.Device = "mobile"
+		}
+	case strings.Contains(header, "Windows Phone"):
+		ua.OS, ua.Device = "Windows Phone", "mobile"
+	case strings.Contains(header, "Windows"):
+		ua.OS, ua.Device = "Windows", "desktop"
+	case strings.Contains(header, "Macintosh"), strings.Contains(header, "Mac OS X"):
+		ua.OS, ua.Device = "macOS", "desktop"
+	case strings.Contains(header, "CrOS"):
+		ua.OS, ua.Device = "ChromeOS", "desktop"
+	case strings.Contains(header, "Linux"), strings.Contains(header, "X11"):
+		ua.OS, ua.Device = "Linux", "desktop"
+	}
+
+	lower := strings.ToLower(header)
+	for _, token := range uaBotTokens {
+		if strings.Contains(lower, token) {
+			ua.Device = "bot"
+			break
+		}
+	}
+	return ua, true
+}
+
+// uaMajorVersion returns the leading number of a version such as "120.0.1".
+func uaMajorVersion(s string) string {
+	end := 0
+	for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+		end++
+	}
+	return s[:end]
+}
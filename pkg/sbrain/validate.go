@@ -0,0 +1,167 @@
+package sbrain
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Limits enforced on create and update payloads.
+const (
+	maxTitleLength    = 200
+	maxProjectLength  = 64
+	maxServiceLength  = 64
+	maxContextLength  = 100_000
+	maxSummaryLength  = 2000
+	maxTagLength      = 40
+	maxTagCount       = 20
+	maxMessageLength  = 10_000
+	maxMetadataLength = 64 * 1024
+	maxLabelCount     = 20
+	maxLabelKeyLength = 64
+	maxLabelLength    = 200
+)
+
+var (
+	projectSlugPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+	tagPattern         = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_/-]*$`)
+	labelKeyPattern    = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*$`)
+)
+
+// validLogService reports whether service can name the service of logs: a
+// URL-safe slug like a project.
+func validLogService(service string) bool {
+	return len(service) <= maxServiceLength && projectSlugPattern.MatchString(service)
+}
+
+// validLabelKey reports whether key can name a log label: letters, digits,
+// dots, dashes and underscores, as Loki and Prometheus label names are.
+func validLabelKey(key string) bool {
+	return len(key) <= maxLabelKeyLength && labelKeyPattern.MatchString(key)
+}
+
+// logLevels are the levels accepted by POST /logs.
+var logLevels = map[string]bool{"debug": true, "info": true, "warn": true, "error": true, "fatal": true}
+
+// FieldError reports one invalid field of a request body.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// validator collects every field error in a payload, so clients can fix them
+// all at once instead of one round trip per field.
+type validator struct {
+	errors []FieldError
+}
+
+func (v *validator) add(field string, format string, args ...any) {
+	v.errors = append(v.errors, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) required(field string, value string) bool {
+	if strings.TrimSpace(value) == "" {
+		v.add(field, "is required")
+		return false
+	}
+	return true
+}
+
+func (v *validator) maxLength(field string, value string, limit int) {
+	if n := utf8.RuneCountInString(value); n > limit {
+		v.add(field, "must be at most %d characters (got %d)", limit, n)
+	}
+}
+
+func validateBrain(b brain) []FieldError {
+	var v validator
+	if v.required("title", b.Title) {
+		v.maxLength("title", b.Title, maxTitleLength)
+	}
+	if v.required("context", b.Context) {
+		v.maxLength("context", b.Context, maxContextLength)
+	}
+	v.maxLength("summary", b.Summary, maxSummaryLength)
+	if v.required("project", b.Project) {
+		v.maxLength("project", b.Project, maxProjectLength)
+		if !projectSlugPattern.MatchString(b.Project) {
+			v.add("project", "must be a URL-safe slug (letters, digits, '.', '_' and '-', starting with a letter or digit)")
+		}
+	}
+
+	tags := splitTags(b.Tags)
+	if len(tags) > maxTagCount {
+		v.add("tags", "must have at most %d tags (got %d)", maxTagCount, len(tags))
+	}
+	for _, tag := range tags {
+		if len(tag) > maxTagLength || !tagPattern.MatchString(tag) {
+			v.add("tags", "invalid tag %q: use up to %d letters, digits, '_', '-' or '/'", tag, maxTagLength)
+		}
+	}
+	return v.errors
+}
+
+func validateLog(l logEntry) []FieldError {
+	var v validator
+	if v.required("message", l.Message) {
+		v.maxLength("message", l.Message, maxMessageLength)
+	}
+	if !logLevels[l.Level] {
+		v.add("level", "must be one of debug, info, warn, error, fatal")
+	}
+	if l.StatusCode != nil && (*l.StatusCode < 100 || *l.StatusCode > 599) {
+		v.add("status_code", "must be between 100 and 599")
+	}
+	if l.ResponseTimeMs != nil && *l.ResponseTimeMs < 0 {
+		v.add("response_time_ms", "must not be negative")
+	}
+	if l.Project != "" && (len(l.Project) > maxProjectLength || !projectSlugPattern.MatchString(l.Project)) {
+		v.add("project", "must be a URL-safe slug of at most %d characters", maxProjectLength)
+	}
+	if l.Service != "" && !validLogService(l.Service) {
+		v.add("service", "must be a URL-safe slug of at most %d characters", maxServiceLength)
+	}
+	if l.Metadata != "" {
+		if len(l.Metadata) > maxMetadataLength {
+			v.add("metadata", "must be at most %d bytes", maxMetadataLength)
+		} else if !json.Valid([]byte(l.Metadata)) {
+			v.add("metadata", "must be valid JSON")
+		}
+	}
+	if len(l.Labels) > maxLabelCount {
+		v.add("labels", "must have at most %d entries", maxLabelCount)
+	}
+	for _, key := range sortedLabelKeys(l.Labels) {
+		if !validLabelKey(key) {
+			v.add("labels", "key %q must be letters, digits, '.', '-' or '_' and at most %d characters", key, maxLabelKeyLength)
+		} else if utf8.RuneCountInString(l.Labels[key]) > maxLabelLength {
+			v.add("labels."+key, "must be at most %d characters", maxLabelLength)
+		}
+	}
+	return v.errors
+}
+
+func sortedLabelKeys(labels map[string]string) []string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// writeValidationError answers 400 with every field error in the payload.
+func writeValidationError(w http.ResponseWriter, r *http.Request, fields []FieldError) {
+	writeJSONStatus(w, http.StatusBadRequest, map[string]APIError{
+		"error": {
+			Code:      "validation_failed",
+			Message:   fmt.Sprintf("%d invalid field(s)", len(fields)),
+			RequestID: requestIDFromContext(r.Context()),
+			Fields:    fields,
+		},
+	})
+}
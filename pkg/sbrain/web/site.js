@@ -0,0 +1,49 @@
+// Searches the records in search-index.js as you type. Every word must
+// appear in a record's title, project, tags or text; titles rank first.
+(function () {
+  var input = document.getElementById("q");
+  var results = document.getElementById("results");
+  var root = document.body.getAttribute("data-root") || "";
+  var index = window.sbrainSearchIndex || [];
+
+  input.addEventListener("input", function () {
+    var terms = input.value.toLowerCase().split(/\s+/).filter(Boolean);
+    results.textContent = "";
+    results.hidden = terms.length === 0;
+    if (results.hidden) {
+      return;
+    }
+    var hits = [];
+    index.forEach(function (r) {
+      var title = r.title.toLowerCase();
+      var haystack = [title, r.project, r.tags.join(" "), r.text].join(" ").toLowerCase();
+      if (terms.every(function (t) { return haystack.indexOf(t) >= 0; })) {
+        var score = terms.filter(function (t) { return title.indexOf(t) >= 0; }).length;
+        hits.push({ record: r, score: score });
+      }
+    });
+    hits.sort(function (a, b) { return b.score - a.score; });
+
+    var list = document.createElement("ul");
+    list.className = "records";
+    hits.slice(0, 50).forEach(function (hit) {
+      var item = document.createElement("li");
+      var link = document.createElement("a");
+      link.href = root + hit.record.url;
+      link.textContent = hit.record.title;
+      item.appendChild(link);
+      if (hit.record.project) {
+        var meta = document.createElement("span");
+        meta.className = "meta";
+        meta.textContent = " " + hit.record.project;
+        item.appendChild(meta);
+      }
+      list.appendChild(item);
+    });
+    var summary = document.createElement("p");
+    summary.className = "meta";
+    summary.textContent = hits.length === 1 ? "1 record" : hits.length + " records";
+    results.appendChild(summary);
+    results.appendChild(list);
+  });
+})();
@@ -0,0 +1,696 @@
+package sbrain
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// plainYAMLKey matches mapping keys that need no quoting in YAML.
+var plainYAMLKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// encodeYAML writes v, which must marshal to JSON, as block-style YAML with
+// sorted keys. Strings are written as double-quoted scalars, whose escapes
+// are a superset of JSON's, so no value can be misread as another type.
+func encodeYAML(w io.Writer, v any) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return err
+	}
+	var b strings.Builder
+	writeYAMLNode(&b, doc, 0)
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+// writeYAMLNode writes a mapping or sequence as indented lines, and a
+// scalar or empty collection inline followed by a newline.
+func writeYAMLNode(b *strings.Builder, v any, indent int) {
+	pad := strings.Repeat("  ", indent)
+	switch v := v.(type) {
+	case map[string]any:
+		if len(v) == 0 {
+			b.WriteString("{}\n")
+			return
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			b.WriteString(pad + yamlKey(k) + ":")
+			writeYAMLChild(b, v[k], indent+1)
+		}
+	case []any:
+		if len(v) == 0 {
+			b.WriteString("[]\n")
+			return
+		}
+		for _, item := range v {
+			b.WriteString(pad + "-")
+			writeYAMLChild(b, item, indent+1)
+		}
+	default:
+		b.WriteString(yamlScalar(v) + "\n")
+	}
+}
+
+// writeYAMLChild writes the value after a "key:" or "-": non-empty
+// collections on the following lines, anything else on the same line.
+func writeYAMLChild(b *strings.Builder, v any, indent int) {
+	switch c := v.(type) {
+	case map[string]any:
+		if len(c) > 0 {
+			b.WriteString("\n")
+			writeYAMLNode(b, c, indent)
+			return
+		}
+	case []any:
+		if len(c) > 0 {
+			b.WriteString("\n")
+			writeYAMLNode(b, c, indent)
+			return
+		}
+	}
+	b.WriteString(" ")
+	writeYAMLNode(b, v, indent)
+}
+
+func yamlKey(k string) string {
+	if plainYAMLKey.MatchString(k) {
+		return k
+	}
+	return yamlScalar(k)
+}
+
+func yamlScalar(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return fmt.Sprint(v)
+	case json.Number:
+		return v.String()
+	case string:
+		quoted, _ := json.Marshal(v)
+		return string(quoted)
+	}
+	return fmt.Sprintf("%q", fmt.Sprint(v))
+}
+
+// decodeYAML parses a YAML document into the values encoding/json decodes
+// to (map[string]any, []any, string, bool, nil and json.Number), so a YAML
+// request body can be handled as the JSON it is equivalent to. It covers
+// what configuration-style documents use: block mappings and sequences,
+// flow collections on one line, plain, quoted and block (| and >) scalars,
+// and comments, with plain scalars resolved by the YAML 1.2 core schema.
+// Anchors, aliases, tags and multiple documents are rejected.
+func decodeYAML(data []byte) (any, error) {
+	p := &yamlParser{}
+	for i, raw := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		text := strings.TrimLeft(raw, " ")
+		if strings.HasPrefix(text, "\t") && yamlStripComment(text) != "" {
+			return nil, fmt.Errorf("line %d: tabs cannot indent YAML", i+1)
+		}
+		p.lines = append(p.lines, yamlLine{num: i + 1, indent: len(raw) - len(text), text: text})
+	}
+	p.skipBlank()
+	if p.pos < len(p.lines) && p.lines[p.pos].indent == 0 && yamlIsMarker(p.lines[p.pos].text, "---") {
+		if yamlStripComment(p.lines[p.pos].text[3:]) != "" {
+			return nil, fmt.Errorf("line %d: start the document on the line after ---", p.lines[p.pos].num)
+		}
+		p.pos++
+	}
+	p.skipBlank()
+	if p.pos >= len(p.lines) || p.lines[p.pos].indent == 0 && yamlIsMarker(p.lines[p.pos].text, "...") {
+		return nil, nil
+	}
+	v, err := p.parseBlock(p.lines[p.pos].indent)
+	if err != nil {
+		return nil, err
+	}
+	p.skipBlank()
+	if p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		switch {
+		case line.indent == 0 && yamlIsMarker(line.text, "..."):
+		case line.indent == 0 && yamlIsMarker(line.text, "---"):
+			return nil, fmt.Errorf("line %d: only one YAML document is accepted", line.num)
+		default:
+			return nil, fmt.Errorf("line %d: unexpected %q", line.num, yamlStripComment(line.text))
+		}
+	}
+	return v, nil
+}
+
+type yamlLine struct {
+	num    int
+	indent int
+	text   string // the line after its indentation
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+func yamlIsMarker(text, marker string) bool {
+	return text == marker || strings.HasPrefix(text, marker+" ") || strings.HasPrefix(text, marker+"\t")
+}
+
+// skipBlank moves past empty and comment-only lines.
+func (p *yamlParser) skipBlank() {
+	for p.pos < len(p.lines) && yamlStripComment(p.lines[p.pos].text) == "" {
+		p.pos++
+	}
+}
+
+// parseBlock parses the node starting on the current line, whose content
+// starts at column indent.
+func (p *yamlParser) parseBlock(indent int) (any, error) {
+	line := p.lines[p.pos]
+	text := yamlStripComment(line.text)
+	if text == "-" || strings.HasPrefix(text, "- ") {
+		return p.parseSequence(indent)
+	}
+	if _, _, ok, err := yamlSplitKey(text); err != nil {
+		return nil, fmt.Errorf("line %d: %v", line.num, err)
+	} else if ok {
+		return p.parseMapping(indent)
+	}
+	p.pos++
+	return p.parseValue(line, text, indent-1)
+}
+
+func (p *yamlParser) parseSequence(indent int) (any, error) {
+	items := []any{}
+	for {
+		p.skipBlank()
+		if p.endOfCollection(indent) {
+			break
+		}
+		line := p.lines[p.pos]
+		text := yamlStripComment(line.text)
+		if text != "-" && !strings.HasPrefix(text, "- ") {
+			break
+		}
+		rest := strings.TrimLeft(line.text[1:], " ")
+		var item any
+		var err error
+		if yamlStripComment(rest) == "" {
+			p.pos++
+			item, err = p.parseChild(indent, false)
+		} else {
+			// "- key: value" and "- - item" start a node inside the item.
+			p.lines[p.pos] = yamlLine{num: line.num, indent: indent + len(line.text) - len(rest), text: rest}
+			item, err = p.parseBlock(p.lines[p.pos].indent)
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, p.checkDedent(indent)
+}
+
+func (p *yamlParser) parseMapping(indent int) (any, error) {
+	m := map[string]any{}
+	for {
+		p.skipBlank()
+		if p.endOfCollection(indent) {
+			break
+		}
+		line := p.lines[p.pos]
+		key, rest, ok, err := yamlSplitKey(yamlStripComment(line.text))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line.num, err)
+		}
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected a key: value pair, got %q", line.num, yamlStripComment(line.text))
+		}
+		if _, dup := m[key]; dup {
+			return nil, fmt.Errorf("line %d: duplicate key %q", line.num, key)
+		}
+		p.pos++
+		var value any
+		if rest == "" {
+			value, err = p.parseChild(indent, true)
+		} else {
+			value, err = p.parseValue(line, rest, indent)
+		}
+		if err != nil {
+			return nil, err
+		}
+		m[key] = value
+	}
+	return m, p.checkDedent(indent)
+}
+
+// endOfCollection reports whether the collection at indent has no more
+// entries: the next line is indented differently or ends the document.
+func (p *yamlParser) endOfCollection(indent int) bool {
+	if p.pos >= len(p.lines) || p.lines[p.pos].indent != indent {
+		return true
+	}
+	text := p.lines[p.pos].text
+	return indent == 0 && (yamlIsMarker(text, "---") || yamlIsMarker(text, "..."))
+}
+
+// parseChild parses the block node below a "key:" or "-" with nothing after
+// it, which is null when the next line is not indented further. A mapping's
+// sequence may also sit at the key's own indentation.
+func (p *yamlParser) parseChild(parent int, inMapping bool) (any, error) {
+	p.skipBlank()
+	if p.pos >= len(p.lines) {
+		return nil, nil
+	}
+	line := p.lines[p.pos]
+	text := yamlStripComment(line.text)
+	if line.indent > parent || inMapping && line.indent == parent && (text == "-" || strings.HasPrefix(text, "- ")) {
+		return p.parseBlock(line.indent)
+	}
+	return nil, nil
+}
+
+// checkDedent fails on a line indented more than a finished collection's
+// entries but belonging to none of them.
+func (p *yamlParser) checkDedent(indent int) error {
+	p.skipBlank()
+	if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+		line := p.lines[p.pos]
+		return fmt.Errorf("line %d: unexpected indentation", line.num)
+	}
+	return nil
+}
+
+// parseValue parses the scalar or flow collection text that starts on
+// line, after a key or at the start of a node; parent is the indentation
+// its continuation lines must exceed.
+func (p *yamlParser) parseValue(line yamlLine, text string, parent int) (any, error) {
+	switch text[0] {
+	case '|', '>':
+		return p.parseBlockScalar(line, text, parent)
+	case '[', '{':
+		v, rest, err := parseYAMLFlow(text)
+		if err == nil && strings.TrimSpace(rest) != "" {
+			err = fmt.Errorf("unexpected %q after a flow collection", rest)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line.num, err)
+		}
+		return v, nil
+	case '"', '\'':
+		s, rest, err := parseYAMLQuoted(text)
+		if err == nil && strings.TrimSpace(rest) != "" {
+			err = fmt.Errorf("unexpected %q after a quoted string", rest)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line.num, err)
+		}
+		return s, nil
+	case '&', '*', '!':
+		return nil, fmt.Errorf("line %d: YAML anchors, aliases and tags are not supported", line.num)
+	}
+	// A plain scalar continues on more indented lines, folded into one.
+	var b strings.Builder
+	b.WriteString(text)
+	blanks := 0
+	for p.pos < len(p.lines) {
+		next := p.lines[p.pos]
+		stripped := yamlStripComment(next.text)
+		if next.text == "" || stripped == "" && next.text[0] != '#' {
+			blanks++
+			p.pos++
+			continue
+		}
+		if next.indent <= parent || stripped == "" {
+			break
+		}
+		if blanks > 0 {
+			b.WriteString(strings.Repeat("\n", blanks))
+		} else {
+			b.WriteByte(' ')
+		}
+		blanks = 0
+		b.WriteString(stripped)
+		p.pos++
+	}
+	if blanks > 0 {
+		// Blank lines after the scalar belong to whatever follows.
+		p.pos -= blanks
+	}
+	v, err := resolveYAMLScalar(b.String())
+	if err != nil {
+		return nil, fmt.Errorf("line %d: %v", line.num, err)
+	}
+	return v, nil
+}
+
+// parseBlockScalar reads a literal (|) or folded (>) block scalar from the
+// lines after its header.
+func (p *yamlParser) parseBlockScalar(line yamlLine, header string, parent int) (any, error) {
+	header = yamlStripComment(header)
+	style, chomp, indent := header[0], byte(0), 0
+	for _, c := range header[1:] {
+		switch {
+		case (c == '-' || c == '+') && chomp == 0:
+			chomp = byte(c)
+		case c >= '1' && c <= '9' && indent == 0:
+			indent = max(parent, 0) + int(c-'0')
+		default:
+			return nil, fmt.Errorf("line %d: invalid block scalar header %q", line.num, header)
+		}
+	}
+
+	var lines []string
+	for p.pos < len(p.lines) {
+		next := p.lines[p.pos]
+		if next.text == "" {
+			lines = append(lines, "")
+			p.pos++
+			continue
+		}
+		if indent == 0 {
+			if next.indent <= parent {
+				break
+			}
+			indent = next.indent
+		}
+		if next.indent < indent {
+			break
+		}
+		lines = append(lines, strings.Repeat(" ", next.indent-indent)+next.text)
+		p.pos++
+	}
+	trailing := 0
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+		trailing++
+	}
+	if len(lines) == 0 {
+		return "", nil
+	}
+
+	var s string
+	if style == '|' {
+		s = strings.Join(lines, "\n")
+	} else {
+		// Folding joins adjacent lines with a space; a run of blank lines
+		// stands for one newline each, and more indented lines keep theirs.
+		var b strings.Builder
+		blanks, prevNormal := 0, false
+		for i, l := range lines {
+			if l == "" {
+				blanks++
+				continue
+			}
+			normal := l[0] != ' '
+			switch {
+			case i == blanks:
+				b.WriteString(strings.Repeat("\n", blanks))
+			case prevNormal && normal && blanks == 0:
+				b.WriteByte(' ')
+			case prevNormal && normal:
+				b.WriteString(strings.Repeat("\n", blanks))
+			default:
+				b.WriteString(strings.Repeat("\n", blanks+1))
+			}
+			b.WriteString(l)
+			blanks, prevNormal = 0, normal
+		}
+		s = b.String()
+	}
+	switch chomp {
+	case '-':
+		return s, nil
+	case '+':
+		return s + strings.Repeat("\n", trailing+1), nil
+	}
+	return s + "\n", nil
+}
+
+// yamlStripComment removes a trailing comment and surrounding space from
+// text, leaving # inside quotes alone.
+func yamlStripComment(text string) string {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				if quote == '\'' && i+1 < len(text) && text[i+1] == '\'' {
+					i++
+				} else {
+					quote = 0
+				}
+			}
+		case (c == '"' || c == '\'') && (i == 0 || strings.ContainsRune(" \t[{,:-", rune(text[i-1]))):
+			quote = c
+		case c == '#' && (i == 0 || text[i-1] == ' ' || text[i-1] == '\t'):
+			return strings.TrimSpace(text[:i])
+		}
+	}
+	return strings.TrimSpace(text)
+}
+
+// yamlSplitKey splits a "key: value" line. ok is false when text is not a
+// mapping entry.
+func yamlSplitKey(text string) (key, rest string, ok bool, err error) {
+	if text == "" || text[0] == '[' || text[0] == '{' || text[0] == '-' && (len(text) == 1 || text[1] == ' ') {
+		return "", "", false, nil
+	}
+	if text[0] == '"' || text[0] == '\'' {
+		k, after, err := parseYAMLQuoted(text)
+		if err != nil {
+			return "", "", false, err
+		}
+		after = strings.TrimLeft(after, " ")
+		if after == ":" || strings.HasPrefix(after, ": ") {
+			return k.(string), strings.TrimSpace(after[1:]), true, nil
+		}
+		return "", "", false, nil
+	}
+	if strings.HasPrefix(text, "? ") || text == "?" {
+		return "", "", false, fmt.Errorf("complex mapping keys are not supported")
+	}
+	i := strings.Index(text, ": ")
+	if i < 0 {
+		if !strings.HasSuffix(text, ":") {
+			return "", "", false, nil
+		}
+		i = len(text) - 1
+	}
+	key = strings.TrimSpace(text[:i])
+	if key == "" {
+		return "", "", false, nil
+	}
+	return key, strings.TrimSpace(text[i+1:]), true, nil
+}
+
+// parseYAMLQuoted parses the double- or single-quoted scalar text starts
+// with, returning what follows it.
+func parseYAMLQuoted(text string) (any, string, error) {
+	quote := text[0]
+	var b strings.Builder
+	for i := 1; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == quote && quote == '\'' && i+1 < len(text) && text[i+1] == '\'':
+			b.WriteByte('\'')
+			i++
+		case c == quote:
+			return b.String(), text[i+1:], nil
+		case c == '\\' && quote == '"':
+			if i+1 >= len(text) {
+				return nil, "", fmt.Errorf("unterminated escape")
+			}
+			i++
+			switch e := text[i]; e {
+			case '0':
+				b.WriteByte(0)
+			case 'a':
+				b.WriteByte('\a')
+			case 'b':
+				b.WriteByte('\b')
+			case 't', '\t':
+				b.WriteByte('\t')
+			case 'n':
+				b.WriteByte('\n')
+			case 'v':
+				b.WriteByte('\v')
+			case 'f':
+				b.WriteByte('\f')
+			case 'r':
+				b.WriteByte('\r')
+			case 'e':
+				b.WriteByte(0x1b)
+			case ' ', '"', '/', '\\':
+				b.WriteByte(e)
+			case 'N':
+				b.WriteString("\u0085")
+			case '_':
+				b.WriteString("\u00a0")
+			case 'L':
+				b.WriteString("\u2028")
+			case 'P':
+				b.WriteString("\u2029")
+			case 'x', 'u', 'U':
+				n := map[byte]int{'x': 2, 'u': 4, 'U': 8}[e]
+				if i+n >= len(text) {
+					return nil, "", fmt.Errorf("short \\%c escape", e)
+				}
+				code, err := strconv.ParseUint(text[i+1:i+1+n], 16, 32)
+				if err != nil {
+					return nil, "", fmt.Errorf("invalid \\%c escape", e)
+				}
+				b.WriteRune(rune(code))
+				i += n
+			default:
+				return nil, "", fmt.Errorf("invalid escape \\%c", e)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return nil, "", fmt.Errorf("unterminated quoted string (quoted strings must end on the line they start)")
+}
+
+// parseYAMLFlow parses the flow collection or scalar text starts with,
+// returning what follows it.
+func parseYAMLFlow(text string) (any, string, error) {
+	text = strings.TrimLeft(text, " ")
+	if text == "" {
+		return nil, "", fmt.Errorf("unexpected end of line in a flow collection")
+	}
+	switch text[0] {
+	case '[':
+		items := []any{}
+		rest := strings.TrimLeft(text[1:], " ")
+		for {
+			if strings.HasPrefix(rest, "]") {
+				return items, rest[1:], nil
+			}
+			item, after, err := parseYAMLFlow(rest)
+			if err != nil {
+				return nil, "", err
+			}
+			items = append(items, item)
+			rest = strings.TrimLeft(after, " ")
+			if strings.HasPrefix(rest, ",") {
+				rest = strings.TrimLeft(rest[1:], " ")
+			} else if !strings.HasPrefix(rest, "]") {
+				return nil, "", fmt.Errorf("expected , or ] in a flow sequence")
+			}
+		}
+	case '{':
+		m := map[string]any{}
+		rest := strings.TrimLeft(text[1:], " ")
+		for {
+			if strings.HasPrefix(rest, "}") {
+				return m, rest[1:], nil
+			}
+			k, after, err := parseYAMLFlow(rest)
+			if err != nil {
+				return nil, "", err
+			}
+			key, ok := k.(string)
+			if !ok {
+				key = yamlScalarText(k)
+			}
+			rest = strings.TrimLeft(after, " ")
+			var value any
+			if strings.HasPrefix(rest, ":") {
+				value, after, err = parseYAMLFlow(rest[1:])
+				if err != nil {
+					return nil, "", err
+				}
+				rest = strings.TrimLeft(after, " ")
+			}
+			if _, dup := m[key]; dup {
+				return nil, "", fmt.Errorf("duplicate key %q", key)
+			}
+			m[key] = value
+			if strings.HasPrefix(rest, ",") {
+				rest = strings.TrimLeft(rest[1:], " ")
+			} else if !strings.HasPrefix(rest, "}") {
+				return nil, "", fmt.Errorf("expected , or } in a flow mapping")
+			}
+		}
+	case '"', '\'':
+		return parseYAMLQuoted(text)
+	case '&', '*', '!':
+		return nil, "", fmt.Errorf("YAML anchors, aliases and tags are not supported")
+	}
+	end := len(text)
+	for i := 0; i < len(text); i++ {
+		if c := text[i]; c == ',' || c == ']' || c == '}' || c == ':' && (i+1 == len(text) || strings.ContainsRune(" ,]}", rune(text[i+1]))) {
+			end = i
+			break
+		}
+	}
+	v, err := resolveYAMLScalar(strings.TrimSpace(text[:end]))
+	return v, text[end:], err
+}
+
+// yamlScalarText is the key a non-string flow mapping key stands for.
+func yamlScalarText(v any) string {
+	if v == nil {
+		return "null"
+	}
+	return fmt.Sprint(v)
+}
+
+var (
+	yamlInt   = regexp.MustCompile(`^[-+]?[0-9]+$`)
+	yamlFloat = regexp.MustCompile(`^[-+]?(\.[0-9]+|[0-9]+(\.[0-9]*)?)([eE][-+]?[0-9]+)?$`)
+)
+
+// resolveYAMLScalar gives a plain scalar its type under the core schema.
+func resolveYAMLScalar(s string) (any, error) {
+	switch s {
+	case "", "~", "null", "Null", "NULL":
+		return nil, nil
+	case "true", "True", "TRUE":
+		return true, nil
+	case "false", "False", "FALSE":
+		return false, nil
+	}
+	switch strings.ToLower(strings.TrimLeft(s, "+-")) {
+	case ".inf", ".nan":
+		return nil, fmt.Errorf("%s cannot be represented in JSON", s)
+	}
+	if yamlInt.MatchString(s) {
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return json.Number(strconv.FormatInt(n, 10)), nil
+		}
+	}
+	for prefix, base := range map[string]int{"0x": 16, "0o": 8} {
+		if digits, ok := strings.CutPrefix(s, prefix); ok {
+			if n, err := strconv.ParseUint(digits, base, 64); err == nil {
+				return json.Number(strconv.FormatUint(n, 10)), nil
+			}
+		}
+	}
+	if yamlFloat.MatchString(s) {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %s", s)
+		}
+		return json.Number(strconv.FormatFloat(f, 'g', -1, 64)), nil
+	}
+	return s, nil
+}
@@ -0,0 +1,121 @@
+package store
+
+import "strings"
+
+// BrainFilter narrows a brain listing. Zero fields are ignored.
+type BrainFilter struct {
+	IDs      []int64
+	Project  string
+	Tag      string
+	Pinned   *bool
+	Favorite *bool
+	Archived *bool
+	// Issue matches records linked to the Jira or Linear issue with this
+	// key, such as ENG-123, ignoring case.
+	Issue string
+	// CreatedSince and CreatedUntil bound created_at and are stored
+	// timestamps (see TimeLayout); CreatedUntil is exclusive.
+	CreatedSince string
+	CreatedUntil string
+	// CreatedDay matches records created on a day of the month ("12") or
+	// of the year ("06-12"), judged at each of DayOffsets, UTC offsets such
+	// as "+02:00" (UTC when empty). A record matches at any of them.
+	CreatedDay string
+	DayOffsets []string
+	// UpdatedSince bounds updated_at, inclusively, and is a stored
+	// timestamp.
+	UpdatedSince string
+	// Order sorts the listing; Where ignores it.
+	Order BrainOrder
+}
+
+// BrainOrder is the order ListBrains calls its function in.
+type BrainOrder int
+
+const (
+	// PinnedNewestFirst lists pinned records first, then newest first.
+	PinnedNewestFirst BrainOrder = iota
+	// OldestFirst lists records by creation, oldest first.
+	OldestFirst
+	// LeastRecentlyUpdatedFirst lists records by updated_at, oldest first.
+	LeastRecentlyUpdatedFirst
+)
+
+// orderBy renders o as a SQL ORDER BY clause.
+func (o BrainOrder) orderBy() string {
+	switch o {
+	case OldestFirst:
+		return " ORDER BY created_at ASC, id ASC"
+	case LeastRecentlyUpdatedFirst:
+		return " ORDER BY updated_at ASC, id ASC"
+	default:
+		return " ORDER BY pinned DESC, created_at DESC"
+	}
+}
+
+// Where renders the filter as a SQL WHERE clause (empty when no filters are
+// set) and its positional arguments.
+func (f BrainFilter) Where() (string, []any) {
+	var clauses []string
+	var args []any
+	add := func(clause string, arg any) {
+		clauses = append(clauses, clause)
+		args = append(args, arg)
+	}
+
+	if len(f.IDs) > 0 {
+		clauses = append(clauses, "id IN ("+strings.TrimSuffix(strings.Repeat("?, ", len(f.IDs)), ", ")+")")
+		for _, id := range f.IDs {
+			args = append(args, id)
+		}
+	}
+	if f.Project != "" {
+		add("project = ?", f.Project)
+	}
+	if f.Tag != "" {
+		// brain_tags, kept by triggers, indexes the comma-separated tags.
+		add("id IN (SELECT brain_id FROM brain_tags WHERE tag = ?)", f.Tag)
+	}
+	if f.Pinned != nil {
+		add("pinned = ?", *f.Pinned)
+	}
+	if f.Favorite != nil {
+		add("favorite = ?", *f.Favorite)
+	}
+	if f.Archived != nil {
+		add("archived = ?", *f.Archived)
+	}
+	if f.Issue != "" {
+		add("id IN (SELECT brain_id FROM brain_issues WHERE key = ? COLLATE NOCASE)", f.Issue)
+	}
+	if f.CreatedSince != "" {
+		add("created_at >= ?", f.CreatedSince)
+	}
+	if f.CreatedUntil != "" {
+		add("created_at < ?", f.CreatedUntil)
+	}
+	if f.CreatedDay != "" {
+		format := "%d"
+		if strings.Contains(f.CreatedDay, "-") {
+			format = "%m-%d"
+		}
+		offsets := f.DayOffsets
+		if len(offsets) == 0 {
+			offsets = []string{"+00:00"}
+		}
+		days := make([]string, len(offsets))
+		for i, offset := range offsets {
+			days[i] = "strftime('" + format + "', created_at, ?) = ?"
+			args = append(args, offset, f.CreatedDay)
+		}
+		clauses = append(clauses, "("+strings.Join(days, " OR ")+")")
+	}
+	if f.UpdatedSince != "" {
+		add("updated_at >= ?", f.UpdatedSince)
+	}
+
+	if len(clauses) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(clauses, " AND "), args
+}
@@ -0,0 +1,170 @@
+package store
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+)
+
+// LogFilter narrows a log query. Zero fields are ignored; Since and Until
+// bound occurred_at and are stored timestamps (see TimeLayout).
+type LogFilter struct {
+	Level string
+	// Levels matches logs at any of these levels.
+	Levels     []string
+	Endpoint   string
+	Method     string
+	RequestID  string
+	StatusCode int
+	BrainID    int64
+	Project    string
+	Service    string
+	// ExcludeServices leaves out the logs of these services.
+	ExcludeServices []string
+	// Country and City match the location geolocation stored under
+	// metadata's "geo" key; City ignores case.
+	Country string
+	City    string
+	// Labels must all be on the log; an empty Value matches any value.
+	Labels []LogLabel
+	Since  string
+	Until  string
+}
+
+// LogLabel is one key=value label in a LogFilter.
+type LogLabel struct {
+	Key   string
+	Value string
+}
+
+// IsZero reports whether no filter is set.
+func (f LogFilter) IsZero() bool {
+	clause, _ := f.Where()
+	return clause == ""
+}
+
+// Where renders the filter as a SQL WHERE clause (empty when no filters are
+// set) and its positional arguments.
+func (f LogFilter) Where() (string, []any) {
+	var clauses []string
+	var args []any
+	add := func(clause string, arg any) {
+		clauses = append(clauses, clause)
+		args = append(args, arg)
+	}
+
+	if f.Level != "" {
+		add("level = ?", f.Level)
+	}
+	if len(f.Levels) > 0 {
+		clauses = append(clauses, "level IN (?"+strings.Repeat(", ?", len(f.Levels)-1)+")")
+		for _, level := range f.Levels {
+			args = append(args, level)
+		}
+	}
+	if f.Endpoint != "" {
+		add("endpoint = ?", f.Endpoint)
+	}
+	if f.Method != "" {
+		add("method = ?", f.Method)
+	}
+	if f.RequestID != "" {
+		add("request_id = ?", f.RequestID)
+	}
+	if f.StatusCode != 0 {
+		add("status_code = ?", f.StatusCode)
+	}
+	if f.BrainID != 0 {
+		add("brain_id = ?", f.BrainID)
+	}
+	if f.Project != "" {
+		add("project = ?", f.Project)
+	}
+	if f.Service != "" {
+		add("service = ?", f.Service)
+	}
+	if len(f.ExcludeServices) > 0 {
+		clauses = append(clauses, "service NOT IN (?"+strings.Repeat(", ?", len(f.ExcludeServices)-1)+")")
+		for _, service := range f.ExcludeServices {
+			args = append(args, service)
+		}
+	}
+	if f.Country != "" {
+		add("json_extract(CASE WHEN json_valid(metadata) THEN metadata END, '$.geo.country') = ?", f.Country)
+	}
+	if f.City != "" {
+		add("json_extract(CASE WHEN json_valid(metadata) THEN metadata END, '$.geo.city') = ? COLLATE NOCASE", f.City)
+	}
+	for _, label := range f.Labels {
+		if label.Value == "" {
+			add("id IN (SELECT log_id FROM log_labels WHERE key = ?)", label.Key)
+			continue
+		}
+		clauses = append(clauses, "id IN (SELECT log_id FROM log_labels WHERE key = ? AND value = ?)")
+		args = append(args, label.Key, label.Value)
+	}
+	if f.Since != "" {
+		add("occurred_at >= ?", f.Since)
+	}
+	if f.Until != "" {
+		add("occurred_at < ?", f.Until)
+	}
+
+	if len(clauses) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(clauses, " AND "), args
+}
+
+// Matches reports whether l passes the filter, as Where would select it,
+// for logs that are not read back from the database.
+func (f LogFilter) Matches(l Log) bool {
+	for _, c := range []struct{ want, got string }{
+		{f.Level, l.Level}, {f.Endpoint, l.Endpoint}, {f.Method, l.Method},
+		{f.RequestID, l.RequestID}, {f.Project, l.Project}, {f.Service, l.Service},
+	} {
+		if c.want != "" && c.want != c.got {
+			return false
+		}
+	}
+	if f.StatusCode != 0 && (l.StatusCode == nil || *l.StatusCode != f.StatusCode) {
+		return false
+	}
+	if f.BrainID != 0 && (l.BrainID == nil || *l.BrainID != f.BrainID) {
+		return false
+	}
+	if len(f.Levels) > 0 && !slices.Contains(f.Levels, l.Level) {
+		return false
+	}
+	if slices.Contains(f.ExcludeServices, l.Service) {
+		return false
+	}
+	if f.Country != "" || f.City != "" {
+		var metadata struct {
+			Geo struct {
+				Country string `json:"country"`
+				City    string `json:"city"`
+			} `json:"geo"`
+		}
+		_ = json.Unmarshal([]byte(l.Metadata), &metadata)
+		if f.Country != "" && metadata.Geo.Country != f.Country {
+			return false
+		}
+		if f.City != "" && !strings.EqualFold(metadata.Geo.City, f.City) {
+			return false
+		}
+	}
+	for _, label := range f.Labels {
+		value, ok := l.Labels[label.Key]
+		if !ok || (label.Value != "" && value != label.Value) {
+			return false
+		}
+	}
+	if f.Since != "" && string(l.OccurredAt) < f.Since {
+		return false
+	}
+	if f.Until != "" && string(l.OccurredAt) >= f.Until {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,181 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrOutOfProject is returned when a caller confined to one project tries
+// to write a record into another.
+var ErrOutOfProject = errors.New("store: outside the caller's project")
+
+type projectContextKey struct{}
+
+// WithProject returns a context that confines the calls made with it to a
+// ProjectScoped store to project.
+func WithProject(ctx context.Context, project string) context.Context {
+	return context.WithValue(ctx, projectContextKey{}, project)
+}
+
+// ProjectFromContext returns the project set by WithProject.
+func ProjectFromContext(ctx context.Context) (string, bool) {
+	project, ok := ctx.Value(projectContextKey{}).(string)
+	return project, ok && project != ""
+}
+
+// ProjectScoped wraps a brain and log store so that calls made with a
+// context from WithProject only see and write that project's records:
+// brains whose project it is, and logs ingested for it. Records of other
+// projects read as ErrNotFound, and writing one is ErrOutOfProject. Calls
+// without a project pass straight through.
+type ProjectScoped struct {
+	Brains BrainStore
+	Logs   LogStore
+}
+
+var (
+	_ BrainStore = ProjectScoped{}
+	_ LogStore   = ProjectScoped{}
+)
+
+func (p ProjectScoped) ListBrains(ctx context.Context, filter BrainFilter, fn func(Brain) error) error {
+	if project, ok := ProjectFromContext(ctx); ok {
+		if filter.Project != "" && filter.Project != project {
+			return nil
+		}
+		filter.Project = project
+	}
+	return p.Brains.ListBrains(ctx, filter, fn)
+}
+
+func (p ProjectScoped) GetBrain(ctx context.Context, id int64) (Brain, error) {
+	b, err := p.Brains.GetBrain(ctx, id)
+	if err != nil {
+		return Brain{}, err
+	}
+	if project, ok := ProjectFromContext(ctx); ok && b.Project != project {
+		return Brain{}, ErrNotFound
+	}
+	return b, nil
+}
+
+func (p ProjectScoped) CreateBrain(ctx context.Context, b Brain) (Brain, error) {
+	if project, ok := ProjectFromContext(ctx); ok && b.Project != project {
+		return Brain{}, ErrOutOfProject
+	}
+	return p.Brains.CreateBrain(ctx, b)
+}
+
+func (p ProjectScoped) UpdateBrain(ctx context.Context, b Brain) (Brain, error) {
+	if project, ok := ProjectFromContext(ctx); ok {
+		if _, err := p.GetBrain(ctx, b.ID); err != nil {
+			return Brain{}, err
+		}
+		if b.Project != project {
+			return Brain{}, ErrOutOfProject
+		}
+	}
+	return p.Brains.UpdateBrain(ctx, b)
+}
+
+func (p ProjectScoped) UpdateBrains(ctx context.Context, filter BrainFilter, change func(*Brain) (bool, error), dryRun bool) (int, []BrainChange, error) {
+	project, ok := ProjectFromContext(ctx)
+	if !ok {
+		return p.Brains.UpdateBrains(ctx, filter, change, dryRun)
+	}
+	if filter.Project != "" && filter.Project != project {
+		return 0, nil, nil
+	}
+	filter.Project = project
+	return p.Brains.UpdateBrains(ctx, filter, func(b *Brain) (bool, error) {
+		changed, err := change(b)
+		if err == nil && b.Project != project {
+			err = ErrOutOfProject
+		}
+		return changed, err
+	}, dryRun)
+}
+
+func (p ProjectScoped) BrainsModifiedAt(ctx context.Context) (Timestamp, error) {
+	return p.Brains.BrainsModifiedAt(ctx)
+}
+
+func (p ProjectScoped) ListLogs(ctx context.Context, filter LogFilter, fn func(Log) error) error {
+	if project, ok := ProjectFromContext(ctx); ok {
+		if filter.Project != "" && filter.Project != project {
+			return nil
+		}
+		filter.Project = project
+	}
+	return p.Logs.ListLogs(ctx, filter, fn)
+}
+
+func (p ProjectScoped) CountLogs(ctx context.Context, filter LogFilter) (int64, error) {
+	if project, ok := ProjectFromContext(ctx); ok {
+		if filter.Project != "" && filter.Project != project {
+			return 0, nil
+		}
+		filter.Project = project
+	}
+	return p.Logs.CountLogs(ctx, filter)
+}
+
+func (p ProjectScoped) GetLog(ctx context.Context, id int64) (Log, error) {
+	l, err := p.Logs.GetLog(ctx, id)
+	if err != nil {
+		return Log{}, err
+	}
+	if project, ok := ProjectFromContext(ctx); ok && l.Project != project {
+		return Log{}, ErrNotFound
+	}
+	return l, nil
+}
+
+// CreateLog stores the log under the caller's project, whatever project
+// it names.
+func (p ProjectScoped) CreateLog(ctx context.Context, l Log) (int64, error) {
+	if project, ok := ProjectFromContext(ctx); ok {
+		l.Project = project
+	}
+	return p.Logs.CreateLog(ctx, l)
+}
+
+func (p ProjectScoped) CollapseLog(ctx context.Context, l Log, window time.Duration) (int64, bool, error) {
+	if project, ok := ProjectFromContext(ctx); ok {
+		l.Project = project
+	}
+	return p.Logs.CollapseLog(ctx, l, window)
+}
+
+func (p ProjectScoped) DeleteLog(ctx context.Context, id int64) error {
+	if _, ok := ProjectFromContext(ctx); ok {
+		if _, err := p.GetLog(ctx, id); err != nil {
+			return err
+		}
+	}
+	return p.Logs.DeleteLog(ctx, id)
+}
+
+// LinkLogs is refused within a project, since the logs and the brain may
+// belong to others.
+func (p ProjectScoped) LinkLogs(ctx context.Context, brainID *int64, ids []int64) (int64, error) {
+	if _, ok := ProjectFromContext(ctx); ok {
+		return 0, ErrOutOfProject
+	}
+	return p.Logs.LinkLogs(ctx, brainID, ids)
+}
+
+func (p ProjectScoped) PurgeLogs(ctx context.Context, filter LogFilter, batchSize int) (int64, error) {
+	if project, ok := ProjectFromContext(ctx); ok {
+		if filter.Project != "" && filter.Project != project {
+			return 0, nil
+		}
+		filter.Project = project
+	}
+	return p.Logs.PurgeLogs(ctx, filter, batchSize)
+}
+
+func (p ProjectScoped) LogsModifiedAt(ctx context.Context) (Timestamp, error) {
+	return p.Logs.LogsModifiedAt(ctx)
+}
@@ -0,0 +1,487 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	logColumns = `id, created_at, occurred_at, level, message, endpoint, method, ip, user_agent,
+		request_id, status_code, response_time_ms, metadata, brain_id, count, COALESCE(last_seen_at, ''), sample_rate, project, service,
+		(SELECT json_group_object(key, value) FROM log_labels WHERE log_id = logs.id)`
+)
+
+// SQLite implements BrainStore and LogStore on the sbrain SQLite schema. The
+// queries run on nearly every request are prepared once in NewSQLite rather
+// than parsed again for each call.
+type SQLite struct {
+	db *sql.DB
+
+	selectBrain *sql.Stmt
+	insertBrain *sql.Stmt
+	updateBrain *sql.Stmt
+	selectLog   *sql.Stmt
+	insertLog   *sql.Stmt
+}
+
+var (
+	_ BrainStore = (*SQLite)(nil)
+	_ LogStore   = (*SQLite)(nil)
+)
+
+// NewSQLite prepares the store's statements against db.
+func NewSQLite(db *sql.DB) (*SQLite, error) {
+	s := &SQLite{db: db}
+	for _, p := range []struct {
+		stmt  **sql.Stmt
+		query string
+	}{
+		{&s.selectBrain, `SELECT ` + BrainColumns + ` FROM second_brain WHERE id = ?`},
+		{&s.insertBrain, `INSERT INTO second_brain (title, context, project, commits, tags, remind_at, pinned, favorite, archived, summary, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)`},
+		{&s.updateBrain, `UPDATE second_brain SET title = ?, context = ?, project = ?, commits = ?, tags = ?,
+			reminded_at = CASE WHEN remind_at = ? THEN reminded_at ELSE '' END, remind_at = ?, pinned = ?, favorite = ?,
+			archived = ?, summary = ?, updated_at = ?, version = version + 1
+		WHERE id = ? AND version = ?`},
+		{&s.selectLog, `SELECT ` + logColumns + ` FROM logs WHERE id = ?`},
+		{&s.insertLog, `INSERT INTO logs (occurred_at, level, message, endpoint, method, ip, user_agent, request_id, status_code, response_time_ms, metadata, brain_id, sample_rate, project, service)
+		VALUES (COALESCE(NULLIF(?, ''), CURRENT_TIMESTAMP), ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`},
+	} {
+		stmt, err := db.Prepare(p.query)
+		if err != nil {
+			s.Close()
+			return nil, fmt.Errorf("prepare %q: %w", p.query, err)
+		}
+		*p.stmt = stmt
+	}
+	return s, nil
+}
+
+// Close releases the prepared statements. It does not close the database.
+func (s *SQLite) Close() error {
+	for _, stmt := range []*sql.Stmt{s.selectBrain, s.insertBrain, s.updateBrain, s.selectLog, s.insertLog} {
+		if stmt != nil {
+			stmt.Close()
+		}
+	}
+	return nil
+}
+
+// ListBrainsQuery returns the query ListBrains runs for filter.
+func ListBrainsQuery(filter BrainFilter) (string, []any) {
+	where, args := filter.Where()
+	return `SELECT ` + BrainColumns + ` FROM second_brain` + where + filter.Order.orderBy(), args
+}
+
+func (s *SQLite) ListBrains(ctx context.Context, filter BrainFilter, fn func(Brain) error) error {
+	query, args := ListBrainsQuery(filter)
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("query brains: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var b Brain
+		if err := rows.Scan(b.Fields()...); err != nil {
+			return fmt.Errorf("scan brain: %w", err)
+		}
+		if err := fn(b); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterate brains: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLite) GetBrain(ctx context.Context, id int64) (Brain, error) {
+	var b Brain
+	row := s.selectBrain.QueryRowContext(ctx, id)
+	if err := row.Scan(b.Fields()...); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Brain{}, ErrNotFound
+		}
+		return Brain{}, fmt.Errorf("query brain: %w", err)
+	}
+	return b, nil
+}
+
+func (s *SQLite) CreateBrain(ctx context.Context, b Brain) (Brain, error) {
+	res, err := s.insertBrain.ExecContext(ctx, b.Title, b.Context, b.Project, b.Commits, b.Tags, b.RemindAt, b.Pinned, b.Favorite, b.Archived, b.Summary)
+	if err != nil {
+		return Brain{}, fmt.Errorf("insert brain: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return Brain{}, fmt.Errorf("insert brain: %w", err)
+	}
+	created, err := s.GetBrain(ctx, id)
+	if err != nil {
+		return Brain{}, fmt.Errorf("load brain: %w", err)
+	}
+	return created, nil
+}
+
+func (s *SQLite) UpdateBrain(ctx context.Context, b Brain) (Brain, error) {
+	res, err := s.updateBrain.ExecContext(ctx, b.Title, b.Context, b.Project, b.Commits, b.Tags, b.RemindAt, b.RemindAt,
+		b.Pinned, b.Favorite, b.Archived, b.Summary, b.UpdatedAt, b.ID, b.Version)
+	if err != nil {
+		return Brain{}, fmt.Errorf("update brain: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		// Either the record is gone or its version moved on.
+		if _, err := s.GetBrain(ctx, b.ID); err != nil {
+			return Brain{}, err
+		}
+		return Brain{}, ErrConflict
+	}
+	b.Version++
+	return b, nil
+}
+
+func (s *SQLite) UpdateBrains(ctx context.Context, filter BrainFilter, change func(*Brain) (bool, error), dryRun bool) (int, []BrainChange, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, nil, fmt.Errorf("begin batch update: %w", err)
+	}
+	defer tx.Rollback()
+
+	where, args := filter.Where()
+	rows, err := tx.QueryContext(ctx, `SELECT `+BrainColumns+` FROM second_brain`+where+` ORDER BY id`, args...)
+	if err != nil {
+		return 0, nil, fmt.Errorf("query brains: %w", err)
+	}
+	var matched []Brain
+	for rows.Next() {
+		var b Brain
+		if err := rows.Scan(b.Fields()...); err != nil {
+			rows.Close()
+			return 0, nil, fmt.Errorf("scan brain: %w", err)
+		}
+		matched = append(matched, b)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, nil, fmt.Errorf("iterate brains: %w", err)
+	}
+
+	var changes []BrainChange
+	update := tx.StmtContext(ctx, s.updateBrain)
+	for _, before := range matched {
+		after := before
+		changed, err := change(&after)
+		if err != nil {
+			return 0, nil, err
+		}
+		if !changed {
+			continue
+		}
+		after.Version = before.Version + 1
+		changes = append(changes, BrainChange{Before: before, After: after})
+		if dryRun {
+			continue
+		}
+		b := after
+		if _, err := update.ExecContext(ctx, b.Title, b.Context, b.Project, b.Commits, b.Tags, b.RemindAt, b.RemindAt,
+			b.Pinned, b.Favorite, b.Archived, b.Summary, b.UpdatedAt, b.ID, before.Version); err != nil {
+			return 0, nil, fmt.Errorf("update brain %d: %w", b.ID, err)
+		}
+	}
+	if dryRun {
+		return len(matched), changes, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, nil, fmt.Errorf("commit batch update: %w", err)
+	}
+	return len(matched), changes, nil
+}
+
+func (s *SQLite) BrainsModifiedAt(ctx context.Context) (Timestamp, error) {
+	return s.tableModifiedAt(ctx, "second_brain")
+}
+
+// ListLogsQuery returns the query ListLogs runs for filter.
+func ListLogsQuery(filter LogFilter) (string, []any) {
+	where, args := filter.Where()
+	return `SELECT ` + logColumns + `
+		FROM logs` + where + ` ORDER BY occurred_at DESC, id DESC`, args
+}
+
+func (s *SQLite) ListLogs(ctx context.Context, filter LogFilter, fn func(Log) error) error {
+	query, args := ListLogsQuery(filter)
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("query logs: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		l, err := scanLog(rows)
+		if err != nil {
+			return fmt.Errorf("scan log: %w", err)
+		}
+		if err := fn(l); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterate logs: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLite) CountLogs(ctx context.Context, filter LogFilter) (int64, error) {
+	where, args := filter.Where()
+	var n int64
+	if err := s.db.QueryRowContext(ctx, `SELECT COALESCE(SUM(count), 0) FROM logs`+where, args...).Scan(&n); err != nil {
+		return 0, fmt.Errorf("count logs: %w", err)
+	}
+	return n, nil
+}
+
+func (s *SQLite) GetLog(ctx context.Context, id int64) (Log, error) {
+	l, err := scanLog(s.selectLog.QueryRowContext(ctx, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Log{}, ErrNotFound
+		}
+		return Log{}, fmt.Errorf("query log: %w", err)
+	}
+	return l, nil
+}
+
+func (s *SQLite) CreateLog(ctx context.Context, l Log) (int64, error) {
+	var statusCode any
+	if l.StatusCode != nil {
+		statusCode = *l.StatusCode
+	}
+	var responseMs any
+	if l.ResponseTimeMs != nil {
+		responseMs = *l.ResponseTimeMs
+	}
+
+	args := []any{l.OccurredAt, l.Level, l.Message, l.Endpoint, l.Method, l.IP, l.UserAgent, l.RequestID, statusCode, responseMs, l.Metadata, l.BrainID, sampleRate(l), l.Project, l.Service}
+	if len(l.Labels) == 0 {
+		res, err := s.insertLog.ExecContext(ctx, args...)
+		if err != nil {
+			return 0, fmt.Errorf("insert log: %w", err)
+		}
+		return res.LastInsertId()
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("insert log: %w", err)
+	}
+	defer tx.Rollback()
+	res, err := tx.StmtContext(ctx, s.insertLog).ExecContext(ctx, args...)
+	if err != nil {
+		return 0, fmt.Errorf("insert log: %w", err)
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("insert log: %w", err)
+	}
+	for key, value := range l.Labels {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO log_labels (log_id, key, value) VALUES (?, ?, ?)`, id, key, value); err != nil {
+			return 0, fmt.Errorf("insert log label: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("insert log: %w", err)
+	}
+	return id, nil
+}
+
+// labelSet renders labels in a canonical form to compare a log's labels in
+// SQL (see CollapseLog): "key=value" pairs sorted by key and joined by
+// newlines, or nil for none.
+func labelSet(labels map[string]string) any {
+	if len(labels) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = key + "=" + labels[key]
+	}
+	return strings.Join(pairs, "\n")
+}
+
+func (s *SQLite) CollapseLog(ctx context.Context, l Log, window time.Duration) (int64, bool, error) {
+	seen := l.OccurredAt
+	if seen == "" {
+		seen = NewTimestamp(time.Now())
+	}
+	t, ok := seen.Time()
+	if !ok {
+		return 0, false, fmt.Errorf("collapse log: invalid occurred_at %q", seen)
+	}
+	var statusCode any
+	if l.StatusCode != nil {
+		statusCode = *l.StatusCode
+	}
+
+	// One statement, so two identical logs arriving together cannot both
+	// miss the row the other is about to create and then both see it.
+	var id int64
+	err := s.db.QueryRowContext(ctx, `UPDATE logs SET count = count + 1,
+			last_seen_at = MAX(COALESCE(last_seen_at, occurred_at), ?)
+		WHERE id = (SELECT MAX(id) FROM logs)
+			AND level = ? AND message = ? AND COALESCE(endpoint, '') = ? AND COALESCE(method, '') = ?
+			AND status_code IS ? AND COALESCE(metadata, '') = ? AND brain_id IS ? AND sample_rate IS ?
+			AND project = ? AND service = ? AND COALESCE(last_seen_at, occurred_at) >= ?
+			AND (SELECT group_concat(key || '=' || value, char(10))
+				FROM (SELECT key, value FROM log_labels WHERE log_id = logs.id ORDER BY key)) IS ?
+		RETURNING id`,
+		seen, l.Level, l.Message, l.Endpoint, l.Method, statusCode, l.Metadata, l.BrainID, sampleRate(l), l.Project, l.Service,
+		NewTimestamp(t.Add(-window)), labelSet(l.Labels)).Scan(&id)
+	switch {
+	case err == nil:
+		return id, true, nil
+	case !errors.Is(err, sql.ErrNoRows):
+		return 0, false, fmt.Errorf("collapse log: %w", err)
+	}
+	id, err = s.CreateLog(ctx, l)
+	return id, false, err
+}
+
+// sampleRate is the sample_rate column value for l: NULL unless sampled.
+func sampleRate(l Log) any {
+	if !l.Sampled {
+		return nil
+	}
+	return l.SampleRate
+}
+
+func (s *SQLite) DeleteLog(ctx context.Context, id int64) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM logs WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("delete log: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLite) LinkLogs(ctx context.Context, brainID *int64, ids []int64) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	args := []any{brainID}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	res, err := s.db.ExecContext(ctx, `UPDATE logs SET brain_id = ? WHERE id IN (`+placeholders+`)`, args...)
+	if err != nil {
+		return 0, fmt.Errorf("link logs: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+func (s *SQLite) PurgeLogs(ctx context.Context, filter LogFilter, batchSize int) (int64, error) {
+	where, args := filter.Where()
+	query := `DELETE FROM logs WHERE id IN (SELECT id FROM logs` + where + ` LIMIT ?)`
+	args = append(args, batchSize)
+
+	var total int64
+	for {
+		n, err := s.purgeLogBatch(ctx, query, args)
+		total += n
+		if err != nil {
+			return total, err
+		}
+		if n < int64(batchSize) {
+			return total, nil
+		}
+	}
+}
+
+// purgeLogBatch runs one PurgeLogs batch in its own transaction, so a long
+// purge never holds the write lock for more than batchSize rows at a time.
+func (s *SQLite) purgeLogBatch(ctx context.Context, query string, args []any) (int64, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin purge: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("purge logs: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("purge logs: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit purge: %w", err)
+	}
+	return n, nil
+}
+
+func (s *SQLite) LogsModifiedAt(ctx context.Context) (Timestamp, error) {
+	return s.tableModifiedAt(ctx, "logs")
+}
+
+// tableModifiedAt reads the table_modified row that triggers keep current for
+// table.
+func (s *SQLite) tableModifiedAt(ctx context.Context, table string) (Timestamp, error) {
+	var modified Timestamp
+	err := s.db.QueryRowContext(ctx, `SELECT updated_at FROM table_modified WHERE table_name = ?`, table).Scan(&modified)
+	if err != nil {
+		return "", fmt.Errorf("query %s modification time: %w", table, err)
+	}
+	return modified, nil
+}
+
+// scanner is satisfied by both *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanLog(row scanner) (Log, error) {
+	var l Log
+	var statusCode sql.NullInt64
+	var responseMs sql.NullInt64
+	var brainID sql.NullInt64
+	var sampleRate sql.NullFloat64
+	var labels string
+	if err := row.Scan(&l.ID, &l.CreatedAt, &l.OccurredAt, &l.Level, &l.Message, &l.Endpoint, &l.Method, &l.IP,
+		&l.UserAgent, &l.RequestID, &statusCode, &responseMs, &l.Metadata, &brainID, &l.Count, &l.LastSeenAt, &sampleRate, &l.Project,
+		&l.Service, &labels); err != nil {
+		return Log{}, err
+	}
+	if labels != "{}" {
+		if err := json.Unmarshal([]byte(labels), &l.Labels); err != nil {
+			return Log{}, fmt.Errorf("decode labels: %w", err)
+		}
+	}
+	if statusCode.Valid {
+		sc := int(statusCode.Int64)
+		l.StatusCode = &sc
+	}
+	if responseMs.Valid {
+		rt := int(responseMs.Int64)
+		l.ResponseTimeMs = &rt
+	}
+	if brainID.Valid {
+		l.BrainID = &brainID.Int64
+	}
+	l.Sampled, l.SampleRate = sampleRate.Valid, sampleRate.Float64
+	return l, nil
+}
@@ -0,0 +1,294 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"sbrain/migrations"
+)
+
+// newTestStore returns a store on a fresh database with every migration
+// applied.
+func newTestStore(t *testing.T) *SQLite {
+	t.Helper()
+	db, err := sql.Open("sqlite3", "file:"+filepath.Join(t.TempDir(), "store.db")+"?_busy_timeout=5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	names, err := fs.Glob(migrations.Files, "*.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		script, err := migrations.Files.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec(string(script)); err != nil {
+			t.Fatalf("migration %s: %v", name, err)
+		}
+	}
+	s, err := NewSQLite(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func (s *SQLite) mustCreateBrain(t *testing.T, b Brain) Brain {
+	t.Helper()
+	created, err := s.CreateBrain(context.Background(), b)
+	if err != nil {
+		t.Fatalf("create brain: %v", err)
+	}
+	return created
+}
+
+func (s *SQLite) mustCreateLog(t *testing.T, l Log) int64 {
+	t.Helper()
+	if l.Level == "" {
+		l.Level = "info"
+	}
+	id, err := s.CreateLog(context.Background(), l)
+	if err != nil {
+		t.Fatalf("create log: %v", err)
+	}
+	return id
+}
+
+func TestUpdateBrainVersion(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	b := s.mustCreateBrain(t, Brain{Title: "t", Context: "c", Project: "p"})
+	if b.Version != 1 {
+		t.Fatalf("version = %d, want 1", b.Version)
+	}
+
+	stale := b
+	b.Title = "first edit"
+	updated, err := s.UpdateBrain(ctx, b)
+	if err != nil || updated.Version != 2 {
+		t.Fatalf("UpdateBrain = %+v, %v", updated, err)
+	}
+
+	// An edit made from the first version loses, and changes nothing.
+	stale.Title = "second edit"
+	if _, err := s.UpdateBrain(ctx, stale); !errors.Is(err, ErrConflict) {
+		t.Fatalf("stale update = %v, want ErrConflict", err)
+	}
+	if got, _ := s.GetBrain(ctx, b.ID); got.Title != "first edit" || got.Version != 2 {
+		t.Fatalf("stored = %+v", got)
+	}
+
+	stale.ID = 99
+	if _, err := s.UpdateBrain(ctx, stale); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("missing update = %v, want ErrNotFound", err)
+	}
+}
+
+func TestCollapseLog(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	start := time.Date(2024, 6, 12, 10, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) Timestamp { return NewTimestamp(start.Add(d)) }
+	collapse := func(l Log, wantCollapsed bool) int64 {
+		t.Helper()
+		if l.Level == "" {
+			l.Level, l.Message = "error", "upstream timeout"
+		}
+		id, collapsed, err := s.CollapseLog(ctx, l, 5*time.Minute)
+		if err != nil || collapsed != wantCollapsed {
+			t.Fatalf("CollapseLog(%+v) = %d, %t, %v; want collapsed %t", l, id, collapsed, err, wantCollapsed)
+		}
+		return id
+	}
+
+	first := collapse(Log{OccurredAt: at(0)}, false)
+	if id := collapse(Log{OccurredAt: at(time.Minute)}, true); id != first {
+		t.Fatalf("collapsed into %d, want %d", id, first)
+	}
+	// The window runs from the last time the log was seen.
+	collapse(Log{OccurredAt: at(5 * time.Minute)}, true)
+	l, err := s.GetLog(ctx, first)
+	if err != nil || l.Count != 3 || l.LastSeenAt != at(5*time.Minute) || l.OccurredAt != at(0) {
+		t.Fatalf("collapsed log = %+v, %v", l, err)
+	}
+
+	// Any difference, or a gap longer than the window, starts a new row.
+	collapse(Log{OccurredAt: at(11 * time.Minute)}, false)
+	collapse(Log{OccurredAt: at(11 * time.Minute), Message: "other", Level: "error"}, false)
+	labelled := collapse(Log{OccurredAt: at(11 * time.Minute), Labels: map[string]string{"env": "prod", "host": "a"}}, false)
+	if id := collapse(Log{OccurredAt: at(12 * time.Minute), Labels: map[string]string{"host": "a", "env": "prod"}}, true); id != labelled {
+		t.Fatalf("collapsed into %d, want %d", id, labelled)
+	}
+	collapse(Log{OccurredAt: at(12 * time.Minute), Labels: map[string]string{"env": "prod"}}, false)
+
+	// Only the most recent row is a candidate.
+	collapse(Log{OccurredAt: at(13 * time.Minute)}, false)
+	if n, err := s.CountLogs(ctx, LogFilter{}); err != nil || n != 9 {
+		t.Fatalf("CountLogs = %d, %v; want every occurrence", n, err)
+	}
+}
+
+func TestPurgeLogs(t *testing.T) {
+	for _, tt := range []struct {
+		errors, batch int
+	}{
+		{errors: 10, batch: 3},
+		{errors: 9, batch: 3},
+		{errors: 2, batch: 100},
+		{errors: 0, batch: 3},
+	} {
+		s := newTestStore(t)
+		ctx := context.Background()
+		for i := 0; i < tt.errors; i++ {
+			s.mustCreateLog(t, Log{Level: "error", Message: "boom"})
+			s.mustCreateLog(t, Log{Level: "info", Message: "fine"})
+		}
+		n, err := s.PurgeLogs(ctx, LogFilter{Level: "error"}, tt.batch)
+		if err != nil || n != int64(tt.errors) {
+			t.Fatalf("%d errors in batches of %d: PurgeLogs = %d, %v", tt.errors, tt.batch, n, err)
+		}
+		left, err := s.CountLogs(ctx, LogFilter{})
+		if err != nil || left != int64(tt.errors) {
+			t.Fatalf("%d errors in batches of %d: %d logs left, %v", tt.errors, tt.batch, left, err)
+		}
+		if errorsLeft, _ := s.CountLogs(ctx, LogFilter{Levels: []string{"error", "fatal"}}); errorsLeft != 0 {
+			t.Fatalf("%d error logs left", errorsLeft)
+		}
+	}
+}
+
+func TestListBrainsOrder(t *testing.T) {
+	s := newTestStore(t)
+	ctx := context.Background()
+	var ids []int64
+	for _, pinned := range []bool{false, true, false} {
+		ids = append(ids, s.mustCreateBrain(t, Brain{Title: "t", Pinned: pinned}).ID)
+	}
+	// Touch the first record last.
+	b, _ := s.GetBrain(ctx, ids[0])
+	b.UpdatedAt = NewTimestamp(time.Now().Add(time.Hour))
+	if _, err := s.UpdateBrain(ctx, b); err != nil {
+		t.Fatal(err)
+	}
+
+	list := func(filter BrainFilter) []int64 {
+		t.Helper()
+		var got []int64
+		if err := s.ListBrains(ctx, filter, func(b Brain) error {
+			got = append(got, b.ID)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+	for _, tt := range []struct {
+		filter BrainFilter
+		want   []int64
+	}{
+		{BrainFilter{Order: OldestFirst}, ids},
+		{BrainFilter{Order: LeastRecentlyUpdatedFirst}, []int64{ids[1], ids[2], ids[0]}},
+		{BrainFilter{UpdatedSince: string(b.UpdatedAt)}, []int64{ids[0]}},
+	} {
+		if got := list(tt.filter); len(got) != len(tt.want) || (len(got) > 0 && got[0] != tt.want[0]) || got[len(got)-1] != tt.want[len(tt.want)-1] {
+			t.Fatalf("ListBrains(%+v) = %v, want %v", tt.filter, got, tt.want)
+		}
+	}
+	// The default puts pinned records first.
+	if got := list(BrainFilter{}); got[0] != ids[1] {
+		t.Fatalf("ListBrains = %v, want %d first", got, ids[1])
+	}
+}
+
+func TestProjectScoped(t *testing.T) {
+	s := newTestStore(t)
+	p := ProjectScoped{Brains: s, Logs: s}
+	ctx := WithProject(context.Background(), "mine")
+	bg := context.Background()
+
+	mine := s.mustCreateBrain(t, Brain{Title: "mine", Project: "mine"})
+	theirs := s.mustCreateBrain(t, Brain{Title: "theirs", Project: "theirs"})
+
+	var listed []int64
+	for _, filter := range []BrainFilter{{}, {Project: "theirs"}} {
+		if err := p.ListBrains(ctx, filter, func(b Brain) error {
+			listed = append(listed, b.ID)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(listed) != 1 || listed[0] != mine.ID {
+		t.Fatalf("listed %v, want only %d", listed, mine.ID)
+	}
+	if _, err := p.GetBrain(ctx, theirs.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetBrain(theirs) = %v, want ErrNotFound", err)
+	}
+	if _, err := p.GetBrain(bg, theirs.ID); err != nil {
+		t.Fatalf("GetBrain without a project = %v", err)
+	}
+	if _, err := p.CreateBrain(ctx, Brain{Title: "t", Project: "theirs"}); !errors.Is(err, ErrOutOfProject) {
+		t.Fatalf("CreateBrain(theirs) = %v, want ErrOutOfProject", err)
+	}
+	if _, err := p.UpdateBrain(ctx, theirs); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("UpdateBrain(theirs) = %v, want ErrNotFound", err)
+	}
+	moved := mine
+	moved.Project = "theirs"
+	if _, err := p.UpdateBrain(ctx, moved); !errors.Is(err, ErrOutOfProject) {
+		t.Fatalf("moving a record out = %v, want ErrOutOfProject", err)
+	}
+	if _, _, err := p.UpdateBrains(ctx, BrainFilter{}, func(b *Brain) (bool, error) {
+		b.Project = "theirs"
+		return true, nil
+	}, false); !errors.Is(err, ErrOutOfProject) {
+		t.Fatalf("UpdateBrains moving records out = %v, want ErrOutOfProject", err)
+	}
+	if got, _ := s.GetBrain(bg, mine.ID); got.Project != "mine" {
+		t.Fatalf("record moved to %q", got.Project)
+	}
+
+	// Logs are written under the caller's project whatever they name.
+	ownLog, err := p.CreateLog(ctx, Log{Level: "info", Message: "m", Project: "theirs"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l, _ := s.GetLog(bg, ownLog); l.Project != "mine" {
+		t.Fatalf("log stored under %q", l.Project)
+	}
+	otherLog := s.mustCreateLog(t, Log{Project: "theirs"})
+	if _, err := p.GetLog(ctx, otherLog); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetLog(theirs) = %v, want ErrNotFound", err)
+	}
+	if err := p.DeleteLog(ctx, otherLog); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("DeleteLog(theirs) = %v, want ErrNotFound", err)
+	}
+	if _, err := p.LinkLogs(ctx, &mine.ID, []int64{ownLog}); !errors.Is(err, ErrOutOfProject) {
+		t.Fatalf("LinkLogs = %v, want ErrOutOfProject", err)
+	}
+	if n, _ := p.CountLogs(ctx, LogFilter{}); n != 1 {
+		t.Fatalf("CountLogs = %d, want only the project's", n)
+	}
+	if n, _ := p.CountLogs(ctx, LogFilter{Project: "theirs"}); n != 0 {
+		t.Fatalf("CountLogs(theirs) = %d", n)
+	}
+	if n, err := p.PurgeLogs(ctx, LogFilter{}, 10); err != nil || n != 1 {
+		t.Fatalf("PurgeLogs = %d, %v", n, err)
+	}
+	if _, err := s.GetLog(bg, otherLog); err != nil {
+		t.Fatalf("other project's log was purged: %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+// Package store holds the persistence layer behind the sbrain HTTP handlers.
+// Handlers read and write brain records and logs through the BrainStore and
+// LogStore interfaces rather than SQL, so a different backend or an
+// in-memory fake can stand in for SQLite. Aggregate reports (statistics,
+// Grafana series, alert counts), the trash, which moves a record between
+// tables in one transaction, and the markdown import, which backdates the
+// records it creates, still query the schema directly, as do the tables
+// the store does not cover.
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned when the requested record does not exist.
+var ErrNotFound = errors.New("store: not found")
+
+// ErrConflict is returned when an update was made from a stale version of
+// the record.
+var ErrConflict = errors.New("store: version conflict")
+
+// Brain is a second-brain note.
+type Brain struct {
+	ID        int64     `json:"id"`
+	CreatedAt Timestamp `json:"created_at"`
+	UpdatedAt Timestamp `json:"updated_at"`
+	Title     string    `json:"title"`
+	Context   string    `json:"context"`
+	Project   string    `json:"project"`
+	Commits   string    `json:"commits"`
+	Tags      string    `json:"tags"`
+	RemindAt  Timestamp `json:"remind_at"`
+	Pinned    bool      `json:"pinned"`
+	Favorite  bool      `json:"favorite"`
+	Archived  bool      `json:"archived"`
+	Version   int64     `json:"version"`
+	// Summary is a short digest of Context, usually generated; see
+	// POST /brain/{id}/summarize.
+	Summary string `json:"summary"`
+}
+
+// BrainColumns lists the columns a Brain is read from, in the order of
+// Brain.Fields. brain_trash carries the same columns as second_brain.
+const BrainColumns = `id, created_at, updated_at, title, context, project, commits, tags, remind_at, pinned, favorite, archived, version, summary`
+
+// Fields returns pointers to b's fields in BrainColumns order, for Scan.
+func (b *Brain) Fields() []any {
+	return []any{&b.ID, &b.CreatedAt, &b.UpdatedAt, &b.Title, &b.Context, &b.Project, &b.Commits, &b.Tags, &b.RemindAt, &b.Pinned, &b.Favorite, &b.Archived, &b.Version, &b.Summary}
+}
+
+// Log is one entry in the logs table. CreatedAt is when it was stored and
+// OccurredAt when the event happened; they differ for backfilled logs.
+type Log struct {
+	ID             int64     `json:"id"`
+	CreatedAt      Timestamp `json:"created_at"`
+	OccurredAt     Timestamp `json:"occurred_at"`
+	Level          string    `json:"level"`
+	Message        string    `json:"message"`
+	Endpoint       string    `json:"endpoint"`
+	Method         string    `json:"method"`
+	IP             string    `json:"ip"`
+	UserAgent      string    `json:"user_agent"`
+	RequestID      string    `json:"request_id"`
+	StatusCode     *int      `json:"status_code,omitempty"`
+	ResponseTimeMs *int      `json:"response_time_ms,omitempty"`
+	Metadata       string    `json:"metadata"`
+	BrainID        *int64    `json:"brain_id,omitempty"`
+	// Count is how many identical consecutive logs the row stands for, and
+	// LastSeenAt when the last of them occurred; see CollapseLog.
+	Count      int64     `json:"count"`
+	LastSeenAt Timestamp `json:"last_seen_at,omitempty"`
+	// Sampled marks a log kept by ingestion sampling, which stores the
+	// fraction SampleRate of the logs it applies to.
+	Sampled    bool    `json:"sampled"`
+	SampleRate float64 `json:"sample_rate,omitempty"`
+	// Project is the project the log belongs to, if any; see ProjectScoped.
+	Project string `json:"project,omitempty"`
+	// Service is the application the log came from, if known.
+	Service string `json:"service,omitempty"`
+	// Labels are the key=value pairs attached at ingestion, stored one row
+	// each in log_labels.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// BrainChange is one brain changed by UpdateBrains.
+type BrainChange struct {
+	Before Brain
+	After  Brain
+}
+
+// BrainStore reads and writes brain records.
+type BrainStore interface {
+	// ListBrains calls fn for every brain matching filter, in filter.Order,
+	// stopping at the first error fn returns.
+	ListBrains(ctx context.Context, filter BrainFilter, fn func(Brain) error) error
+	GetBrain(ctx context.Context, id int64) (Brain, error)
+	// CreateBrain stores b and returns it as persisted, with its generated
+	// id and timestamps.
+	CreateBrain(ctx context.Context, b Brain) (Brain, error)
+	// UpdateBrain replaces the editable fields and updated_at of the brain
+	// with b.ID, provided b.Version is still its stored version (ErrConflict
+	// otherwise), and returns b with the version incremented. Changing
+	// remind_at re-arms the reminder.
+	UpdateBrain(ctx context.Context, b Brain) (Brain, error)
+	// UpdateBrains calls change on every brain matching filter, in one
+	// transaction, and stores those it reports as changed, incrementing
+	// their versions. It returns how many brains matched and the changed
+	// ones. An error from change rolls
+	// everything back, and with dryRun nothing is stored at all.
+	UpdateBrains(ctx context.Context, filter BrainFilter, change func(*Brain) (bool, error), dryRun bool) (int, []BrainChange, error)
+	// BrainsModifiedAt returns when any brain was last created, changed or
+	// deleted.
+	BrainsModifiedAt(ctx context.Context) (Timestamp, error)
+}
+
+// LogStore reads and writes log entries.
+type LogStore interface {
+	// ListLogs calls fn for every log matching filter, most recently
+	// occurred first, stopping at the first error fn returns.
+	ListLogs(ctx context.Context, filter LogFilter, fn func(Log) error) error
+	// CountLogs returns how many logs matching filter occurred, counting
+	// each collapsed log as its count.
+	CountLogs(ctx context.Context, filter LogFilter) (int64, error)
+	GetLog(ctx context.Context, id int64) (Log, error)
+	// CreateLog stores l and returns its id. CreatedAt is always now;
+	// OccurredAt defaults to now when empty.
+	CreateLog(ctx context.Context, l Log) (int64, error)
+	// CollapseLog stores l like CreateLog unless the most recently stored log
+	// has the same level, message, endpoint, method, status code, metadata,
+	// brain, project, service and labels and was last seen no more than window before l
+	// occurred. That log's count is incremented and its last_seen_at moved
+	// to l's time instead, and collapsed reports it.
+	CollapseLog(ctx context.Context, l Log, window time.Duration) (id int64, collapsed bool, err error)
+	DeleteLog(ctx context.Context, id int64) error
+	// LinkLogs sets the brain record the logs with ids refer to, or clears it
+	// when brainID is nil, and returns how many logs exist among ids.
+	LinkLogs(ctx context.Context, brainID *int64, ids []int64) (int64, error)
+	// PurgeLogs deletes every log matching filter in transactions of at most
+	// batchSize rows and returns how many were deleted. A failed batch
+	// leaves the earlier ones deleted.
+	PurgeLogs(ctx context.Context, filter LogFilter, batchSize int) (int64, error)
+	// LogsModifiedAt returns when any log was last stored or deleted.
+	LogsModifiedAt(ctx context.Context) (Timestamp, error)
+}
@@ -0,0 +1,84 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TimeLayout is the stored form of every timestamp: UTC in the format of
+// SQLite's CURRENT_TIMESTAMP, so stored values sort and compare as text.
+const TimeLayout = "2006-01-02 15:04:05"
+
+// displayLocation is the zone timestamps are rendered in by MarshalJSON.
+var displayLocation = time.UTC
+
+// SetDisplayLocation sets the zone API responses render timestamps in.
+func SetDisplayLocation(loc *time.Location) {
+	displayLocation = loc
+}
+
+// DisplayLocation returns the zone set by SetDisplayLocation.
+func DisplayLocation() *time.Location {
+	return displayLocation
+}
+
+// Timestamp is a stored timestamp (see TimeLayout). It is written to JSON as
+// RFC 3339 in the display zone and read from JSON in any accepted layout,
+// normalizing to UTC, so the database only ever holds one format.
+type Timestamp string
+
+// NewTimestamp returns the stored form of t.
+func NewTimestamp(t time.Time) Timestamp {
+	return Timestamp(t.UTC().Format(TimeLayout))
+}
+
+// ParseTimestamp accepts RFC 3339 (any offset), the stored layout,
+// "2006-01-02T15:04:05" (taken as UTC) or a bare date.
+func ParseTimestamp(value string) (Timestamp, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{time.RFC3339, TimeLayout, "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return NewTimestamp(t), nil
+		}
+	}
+	return "", fmt.Errorf("invalid timestamp %q: expected RFC 3339", value)
+}
+
+// Time parses the stored value.
+func (t Timestamp) Time() (time.Time, bool) {
+	parsed, err := time.Parse(TimeLayout, string(t))
+	return parsed, err == nil
+}
+
+// Display renders the timestamp as RFC 3339 in the display zone. Empty and
+// unparsable values are returned unchanged.
+func (t Timestamp) Display() string {
+	parsed, ok := t.Time()
+	if !ok {
+		return string(t)
+	}
+	return parsed.In(displayLocation).Format(time.RFC3339)
+}
+
+func (t Timestamp) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.Display())
+}
+
+func (t *Timestamp) UnmarshalJSON(b []byte) error {
+	var value string
+	if err := json.Unmarshal(b, &value); err != nil {
+		return err
+	}
+	if value == "" {
+		*t = ""
+		return nil
+	}
+	parsed, err := ParseTimestamp(value)
+	if err != nil {
+		return err
+	}
+	*t = parsed
+	return nil
+}